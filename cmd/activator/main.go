@@ -17,138 +17,467 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/knative/serving/pkg/logging/logkey"
 
 	"github.com/knative/serving/pkg/activator"
+	"github.com/knative/serving/pkg/autoscaler"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
+	informers "github.com/knative/serving/pkg/client/informers/externalversions"
+	listers "github.com/knative/serving/pkg/client/listers/serving/v1alpha1"
 	"github.com/knative/serving/pkg/configmap"
-	"github.com/knative/serving/pkg/controller"
 	h2cutil "github.com/knative/serving/pkg/h2c"
+	"github.com/knative/serving/pkg/leaderelection"
 	"github.com/knative/serving/pkg/logging"
+	"github.com/knative/serving/pkg/queue"
 	"github.com/knative/serving/pkg/signals"
 	"github.com/knative/serving/pkg/system"
 	"github.com/knative/serving/third_party/h2c"
+	"go.opencensus.io/exporter/prometheus"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 const (
-	maxUploadBytes = 32e6 // 32MB - same as app engine
-	maxRetry       = 60
-	retryInterval  = 1 * time.Second
-	logLevelKey    = "activator"
+	logLevelKey = "activator"
+
+	// metricsAddr is where the activator's metrics are served for
+	// Prometheus to scrape.
+	metricsAddr = ":9090"
+
+	// adminAddr is where debugging and admin endpoints are served,
+	// separately from the proxied traffic.
+	adminAddr = ":8081"
+
+	// profilingAddr is where the Go runtime profiles are served when
+	// enabled.
+	profilingAddr = ":8008"
+
+	// httpsAddr is where the proxied traffic is served over TLS, next to
+	// the cleartext listener on :8080.
+	httpsAddr = ":8443"
+
+	// handoffMaxAge bounds how old a checkpoint handed off by another
+	// activator may be and still be resumed.
+	handoffMaxAge = 1 * time.Minute
+
+	// statSinkURL is where the multitenant autoscaler receives stats.
+	statSinkURL = "ws://autoscaler.%s.svc.cluster.local:8080"
+
+	// statReportingQueueLength bounds the stats waiting to be sent to
+	// the autoscaler, and requestCountingQueueLength the requests
+	// waiting to be counted.
+	statReportingQueueLength   = 100
+	requestCountingQueueLength = 1000
+
+	// statBacklogLength bounds the stats kept while disconnected from
+	// the autoscaler, about a minute's worth for a few dozen revisions.
+	statBacklogLength = 2000
+
+	// probeResultTTL bounds how long a revision found ready by one
+	// activator is trusted by the others without probing it again.
+	probeResultTTL = 30 * time.Second
+)
+
+var (
+	debugTokenFile = flag.String("debug-token-file", "",
+		"Path to a file holding the bearer token required by the debug and admin endpoints. "+
+			"They are disabled when unset.")
+	enableHandoff = flag.Bool("enable-handoff", false,
+		"On shutdown, checkpoint pending activations for other replicas to resume "+
+			"and redirect waiting requests instead of failing them.")
+	tlsCertDir = flag.String("tls-cert-dir", "",
+		"Path to a directory holding the tls.crt and tls.key to serve HTTPS with on "+httpsAddr+", "+
+			"reloaded whenever they change. HTTPS is disabled when unset.")
+	statsTokenFile = flag.String("stats-token-file", "",
+		"Path to a file holding the bearer token presented to the autoscaler when reporting stats.")
+	shareProbeResults = flag.Bool("share-probe-results", false,
+		"Share successful probe results with other replicas, so that each "+
+			"cold-starting revision is only probed by one of them.")
 )
 
 type activationHandler struct {
 	act    activator.Activator
+	tags   *activator.TagResolver
 	logger *zap.SugaredLogger
-}
 
-// retryRoundTripper retries on 503's for up to 60 seconds. The reason is there is
-// a small delay for k8s to include the ready IP in service.
-// https://github.com/knative/serving/issues/660#issuecomment-384062553
-type retryRoundTripper struct {
-	logger *zap.SugaredLogger
-}
+	// revisions resolves the timeout of revisions before requests wait
+	// on their activation.
+	revisions listers.RevisionLister
 
-func (rrt retryRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
-	var err error
-	var reqBody *bytes.Reader
+	// settings are replaced whenever the activator config changes.
+	settingsMux sync.RWMutex
+	settings    *proxySettings
 
-	transport := http.DefaultTransport
+	// upstreamTLS proxies requests to revisions that opted into TLS.
+	upstreamTLS *activator.UpstreamTLS
 
-	if r.ProtoMajor == 2 {
-		transport = h2cutil.NewTransport()
-	}
-
-	if r.Body != nil {
-		reqBytes, err := ioutil.ReadAll(r.Body)
+	// handoff redirects requests abandoned on shutdown so that clients
+	// retry them against another replica.
+	handoff bool
 
-		if err != nil {
-			rrt.logger.Errorf("Error reading request body: %s", err)
-			return nil, err
-		}
+	// balancer, when set, spreads requests across the pods of revisions.
+	balancer *activator.PodBalancer
 
-		reqBody = bytes.NewReader(reqBytes)
-		r.Body = ioutil.NopCloser(reqBody)
-	}
+	// evictions, when set, re-dispatches the requests waiting on pods
+	// the balancer stopped using for failing their probe.
+	evictions *activator.EvictionTracker
 
-	resp, err := transport.RoundTrip(r)
-	// TODO: Activator should retry with backoff.
-	// https://github.com/knative/serving/issues/1229
-	i := 1
-	for ; i < maxRetry; i++ {
-		if err == nil && resp != nil && resp.StatusCode != 503 {
-			break
-		}
+	reporter activator.StatsReporter
 
-		if err != nil {
-			rrt.logger.Errorf("Error making a request: %s", err)
-		}
+	// reqChan, when set, counts requests for the autoscaler.
+	reqChan chan activator.ReqEvent
 
-		if resp != nil {
-			resp.Body.Close()
-		}
+	// accessLog, when set, logs every request.
+	accessLog *activator.AccessLogger
 
-		time.Sleep(retryInterval)
+	// shadower, when set, mirrors requests to shadow revisions.
+	shadower *activator.Shadower
+}
 
-		// The request body cannot be read multiple times for retries.
-		// The workaround is to clone the request body into a byte reader
-		// so the body can be read multiple times.
-		if r.Body != nil {
-			reqBody.Seek(0, io.SeekStart)
-		}
+// requestInfo is filled in while a request is served, for logRequests
+// to log and report it.
+type requestInfo struct {
+	endpoint        activator.Endpoint
+	queued, proxied time.Duration
+}
 
-		resp, err = transport.RoundTrip(r)
-	}
-	// TODO: add metrics for number of tries and the response code.
-	if resp != nil {
-		rrt.logger.Infof("It took %d tries to get response code %d", i, resp.StatusCode)
-	}
-	return resp, err
+type requestInfoKey struct{}
+
+// logRequests is the stage logging every request and reporting its
+// metrics once it is served by the stages after it.
+func (a *activationHandler) logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := activator.NewStatusWriter(w)
+		start := time.Now()
+		info := &requestInfo{}
+		defer func() {
+			namespace, name, ok := a.tags.RevisionFromRequest(r)
+			if ok {
+				a.reporter.ReportRequest(namespace, name, sw.Status(), info.queued, info.proxied)
+			}
+			if a.accessLog != nil {
+				entry := activator.NewAccessLogEntry(r, sw, namespace, name, start, info.endpoint.Activated)
+				if err := a.accessLog.Log(entry); err != nil {
+					a.logger.Errorf("Failed to write access log: %v", err)
+				}
+			}
+		}()
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+	})
 }
 
 func (a *activationHandler) handler(w http.ResponseWriter, r *http.Request) {
-	if r.ContentLength > maxUploadBytes {
-		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	start := time.Now()
+	info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		info = &requestInfo{}
+	}
+
+	namespace, name, ok := a.tags.RevisionFromRequest(r)
+	if !ok {
+		http.Error(w, "Request does not name a revision", http.StatusBadRequest)
 		return
 	}
+	// Requests to pods are told apart by the revision they are for.
+	r = r.WithContext(activator.WithRevision(r.Context(), namespace, name))
+
+	if a.reqChan != nil {
+		key := namespace + "/" + name
+		a.reqChan <- activator.ReqEvent{Key: key, EventType: queue.ReqIn}
+		defer func() {
+			a.reqChan <- activator.ReqEvent{Key: key, EventType: queue.ReqOut}
+		}()
+	}
 
-	namespace := r.Header.Get(controller.GetRevisionHeaderNamespace())
-	name := r.Header.Get(controller.GetRevisionHeaderName())
-	endpoint, status, err := a.act.ActiveEndpoint(namespace, name)
+	// The revision timeout bounds the wait for activation too. Revisions
+	// the lister does not know yet are bounded once active instead.
+	timeout, timeoutKnown := a.revisionTimeout(namespace, name)
+	r, cancel := activator.WithRevisionTimeout(r, timeout, start)
+	defer cancel()
+	endpoint, status, err := activator.ActiveEndpointWithSpan(r.Context(), a.act, namespace, name)
+	info.endpoint = endpoint
+	info.queued = time.Since(start)
+	if a.reqChan != nil {
+		a.reqChan <- activator.ReqEvent{Key: namespace + "/" + name, EventType: queue.ReqDequeued}
+	}
+	if err == activator.ErrShuttingDown && a.handoff {
+		// The request has not been proxied yet, so it is safe to have the
+		// client retry it. Closing the connection sends the retry through
+		// the load balancer to another replica.
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Location", r.URL.RequestURI())
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf("Error getting active endpoint: %v", err)
-		a.logger.Error(msg)
+		a.logger.With(zap.String(logkey.RequestID, activator.RequestIDFrom(r.Context()))).Error(msg)
+		var full *activator.BufferFullError
+		if errors.As(err, &full) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(full.RetryAfter.Seconds()))))
+		}
 		http.Error(w, msg, int(status))
 		return
 	}
-	target := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s:%d", endpoint.FQDN, endpoint.Port),
+	// The limit of the revision is only known once it is active, but the
+	// body has yet to be read.
+	settings := a.proxySettings()
+	maxBody := settings.maxRequestBodyBytes
+	if endpoint.MaxRequestBodyBytes > 0 {
+		maxBody = endpoint.MaxRequestBodyBytes
+	}
+	if maxBody > 0 {
+		if r.ContentLength > maxBody {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		r = activator.LimitRequestBody(r, maxBody)
+	}
+	if a.shadower != nil {
+		r = a.shadower.Shadow(r, namespace, endpoint)
+	}
+	transport := a.transportFor(settings, endpoint)
+	if a.balancer != nil {
+		active := endpoint
+		var done func()
+		endpoint, done = a.balancer.Pick(namespace, name, active)
+		defer func() { done() }()
+		// Requests losing their connection to a pod are retried against
+		// another one.
+		r = r.WithContext(activator.WithRetryHost(r.Context(), func(failed string) string {
+			done()
+			var ep activator.Endpoint
+			ep, done = a.balancer.PickOther(namespace, name, active, failed)
+			return ep.Address()
+		}))
+		if a.evictions != nil {
+			r = r.WithContext(activator.WithEvictions(r.Context(), a.evictions))
+		}
+		// Requests to latency-critical revisions are hedged against
+		// another pod when the one picked is slow to respond.
+		if endpoint.HedgeDelay > 0 {
+			r = r.WithContext(activator.WithHedging(r.Context(), endpoint.HedgeDelay, func(primary string) (string, func()) {
+				ep, hedgeDone := a.balancer.PickOther(namespace, name, active, primary)
+				if ep.Address() == primary {
+					hedgeDone()
+					return "", nil
+				}
+				return ep.Address(), hedgeDone
+			}))
+		}
+	}
+	if settings.retryBudget != nil {
+		r = r.WithContext(activator.WithRetryBudget(r.Context(), settings.retryBudget, namespace, name))
+	}
+	if !timeoutKnown {
+		var cancel context.CancelFunc
+		r, cancel = activator.WithRevisionTimeout(r, endpoint.Timeout, start)
+		defer cancel()
+	}
+	ctx, span := trace.StartSpan(r.Context(), "activator/proxy")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("endpoint", endpoint.Address()))
+	if endpoint.Pod != nil {
+		span.AddAttributes(trace.StringAttribute("pod", endpoint.Pod.Name))
+	}
+	proxyStart := time.Now()
+	proxy := activator.NewProxy(endpoint, transport, a.logger)
+	proxy.FlushInterval = settings.flushInterval
+	proxy.BufferPool = settings.bufferPool
+	proxy.ServeHTTP(activator.FlushStreams(w), r.WithContext(ctx))
+	info.proxied = time.Since(proxyStart)
+}
+
+// revisionTimeout returns the timeout of the revision, and whether the
+// revision was found.
+func (a *activationHandler) revisionTimeout(namespace, name string) (time.Duration, bool) {
+	rev, err := a.revisions.Revisions(namespace).Get(name)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(rev.Spec.TimeoutSeconds) * time.Second, true
+}
+
+// transportFor returns the transport of settings requests to endpoint
+// are proxied through.
+func (a *activationHandler) transportFor(settings *proxySettings, endpoint activator.Endpoint) http.RoundTripper {
+	switch {
+	case endpoint.Scheme == "https":
+		return a.upstreamTLS.Transport(endpoint.ServerName)
+	case endpoint.H2C():
+		return settings.h2cTransport
+	}
+	return settings.transport
+}
+
+// proxySettings are the parts of the activator config applied to the
+// requests proxied to revisions.
+type proxySettings struct {
+	config *activator.Config
+
+	// transport and h2cTransport proxy requests to revisions serving
+	// HTTP/1 and cleartext HTTP/2. closeIdle closes their idle
+	// connections once they were replaced.
+	transport    http.RoundTripper
+	h2cTransport http.RoundTripper
+	closeIdle    func()
+
+	// flushInterval is how often proxied responses are flushed.
+	flushInterval time.Duration
+
+	// maxRequestBodyBytes bounds the request bodies proxied to revisions
+	// setting no limit of their own. Zero means no limit.
+	maxRequestBodyBytes int64
+
+	// bufferPool, when set, recycles the buffers proxied bodies are
+	// copied through.
+	bufferPool httputil.BufferPool
+
+	// retryBudget, when set, bounds the retries of requests to each
+	// revision.
+	retryBudget *activator.RetryBudget
+}
+
+// newProxySettings creates the proxySettings of cfg, keeping the
+// transports and buffer pool of prev, if any, unless cfg changed how
+// they are set up. Transports are replaced along with their connection
+// pools and circuit breakers.
+func newProxySettings(cfg *activator.Config, prev *proxySettings, reporter activator.StatsReporter, logger *zap.SugaredLogger) *proxySettings {
+	s := &proxySettings{
+		config:              cfg,
+		flushInterval:       cfg.ProxyFlushInterval,
+		maxRequestBodyBytes: int64(cfg.MaxRequestBodyBytes),
+	}
+	if prev != nil && !transportChanged(prev.config, cfg) {
+		s.transport, s.h2cTransport, s.closeIdle = prev.transport, prev.h2cTransport, prev.closeIdle
+	} else {
+		t := newProxyTransport(cfg)
+		// HTTP/2 multiplexes requests over a single connection per pod, so
+		// only the dialer applies.
+		h2cTransport := h2cutil.NewTransportWithDialer(newProxyDialer(cfg).DialContext, cfg.ProxyResponseTimeout)
+		s.transport = newActivatorTransport(t, cfg, logger)
+		s.h2cTransport = newActivatorTransport(h2cTransport, cfg, logger)
+		s.closeIdle = func() {
+			t.CloseIdleConnections()
+			if c, ok := h2cTransport.(interface{ CloseIdleConnections() }); ok {
+				c.CloseIdleConnections()
+			}
+		}
+	}
+	if prev != nil && prev.config.ProxyBufferSize == cfg.ProxyBufferSize {
+		s.bufferPool = prev.bufferPool
+	} else if cfg.ProxyBufferSize > 0 {
+		s.bufferPool = activator.NewBufferPool(cfg.ProxyBufferSize)
+	}
+	if prev != nil && prev.config.RetryBudgetPercent == cfg.RetryBudgetPercent &&
+		prev.config.RetryBudgetWindow == cfg.RetryBudgetWindow {
+		s.retryBudget = prev.retryBudget
+	} else if cfg.RetryBudgetPercent > 0 {
+		s.retryBudget = activator.NewRetryBudget(cfg.RetryBudgetPercent, cfg.RetryBudgetWindow, reporter)
+	}
+	return s
+}
+
+// transportChanged reports whether the transports proxying to revisions
+// are set up differently with cur than with prev.
+func transportChanged(prev, cur *activator.Config) bool {
+	return prev.ProxyConnectTimeout != cur.ProxyConnectTimeout ||
+		prev.ProxyResponseTimeout != cur.ProxyResponseTimeout ||
+		prev.ProxyMaxIdleConns != cur.ProxyMaxIdleConns ||
+		prev.ProxyMaxIdleConnsPerHost != cur.ProxyMaxIdleConnsPerHost ||
+		prev.ProxyIdleConnTimeout != cur.ProxyIdleConnTimeout ||
+		prev.ProxyKeepAlive != cur.ProxyKeepAlive ||
+		prev.CircuitBreakerFailures != cur.CircuitBreakerFailures ||
+		prev.CircuitBreakerCooldown != cur.CircuitBreakerCooldown
+}
+
+func (a *activationHandler) proxySettings() *proxySettings {
+	a.settingsMux.RLock()
+	defer a.settingsMux.RUnlock()
+	return a.settings
+}
+
+// setConfig applies cfg to the requests proxied from then on.
+func (a *activationHandler) setConfig(cfg *activator.Config) {
+	a.settingsMux.Lock()
+	prev := a.settings
+	a.settings = newProxySettings(cfg, prev, a.reporter, a.logger)
+	replaced := a.settings.transport != prev.transport
+	a.settingsMux.Unlock()
+	if replaced {
+		// Requests in flight keep using the previous transports.
+		prev.closeIdle()
 	}
-	proxy := httputil.NewSingleHostReverseProxy(target)
-	proxy.Transport = retryRoundTripper{
-		logger: a.logger,
+}
+
+// compressResponses compresses the responses served by h as the current
+// config says.
+func (a *activationHandler) compressResponses(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.proxySettings().config
+		if cfg.ResponseCompression == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		activator.CompressResponses(cfg.CompressionMinSize, cfg.CompressionContentTypes)(h).ServeHTTP(w, r)
+	})
+}
+
+// newProxyTransport returns a transport like http.DefaultTransport, but
+// with the proxy timeouts and connection pool of cfg.
+func newProxyTransport(cfg *activator.Config) *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           newProxyDialer(cfg).DialContext,
+		MaxIdleConns:          cfg.ProxyMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.ProxyMaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.ProxyIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: cfg.ProxyResponseTimeout,
 	}
+}
 
-	// TODO: Clear the host to avoid 404's.
-	// https://github.com/knative/serving/issues/964
-	r.Host = ""
+// newProxyDialer returns the dialer connections to revisions are opened
+// with.
+func newProxyDialer(cfg *activator.Config) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   cfg.ProxyConnectTimeout,
+		KeepAlive: cfg.ProxyKeepAlive,
+		DualStack: true,
+	}
+}
 
-	proxy.ServeHTTP(w, r)
+// newActivatorTransport wraps transport to retry requests to revisions
+// that were just activated, to hedge those to latency-critical ones and
+// to stop sending requests to failing ones.
+func newActivatorTransport(transport http.RoundTripper, cfg *activator.Config, logger *zap.SugaredLogger) http.RoundTripper {
+	return activator.NewCircuitBreakerRoundTripper(
+		activator.NewRetryRoundTripper(activator.NewHedgingRoundTripper(transport), logger),
+		cfg.CircuitBreakerFailures, cfg.CircuitBreakerCooldown)
 }
 
 func main() {
@@ -179,24 +508,309 @@ func main() {
 		logger.Fatal("Error building serving clientset: %v", zap.Error(err))
 	}
 
-	a := activator.NewRevisionActivator(kubeClient, servingClient, logger)
-	a = activator.NewDedupingActivator(a)
-	ah := &activationHandler{a, logger}
+	rawConfig, err := configmap.Load("/etc/config-activator")
+	if err != nil {
+		logger.Fatalf("Error reading config-activator: %v", err)
+	}
+	activatorConfig, err := activator.NewConfigFromMap(rawConfig)
+	if err != nil {
+		logger.Fatalf("Error loading config-activator: %v", err)
+	}
+
+	activator.DefaultProbeLimiter.SetCapacity(activatorConfig.MaxConcurrentProbes)
+	configs := activator.NewConfigStore(activatorConfig, logger)
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
+
+	health := activator.NewHealth()
+
+	exporter, err := prometheus.NewExporter(prometheus.Options{Namespace: "activator"})
+	if err != nil {
+		logger.Fatal("Failed to create prometheus exporter", zap.Error(err))
+	}
+	view.RegisterExporter(exporter)
+	view.SetReportingPeriod(1 * time.Second)
+	reporter := activator.NewStatsReporter()
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", exporter)
+		if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+			logger.Errorf("Metrics server failed: %v", err)
+		}
+	}()
+
+	podName, err := os.Hostname()
+	if err != nil {
+		logger.Fatalf("Error getting hostname: %v", err)
+	}
+
+	var (
+		probeResults activator.ProbeResults
+		buckets      *leaderelection.Buckets
+	)
+	if *shareProbeResults {
+		store := activator.NewProbeResultStore(kubeClient, system.Namespace, activator.ProbeResultsConfigMapName, probeResultTTL, logger)
+		health.AddReadinessCheck("probe results", activator.InformerSyncedCheck(store.Watch(stopCh, logger)))
+		probeResults = store
+		if activatorConfig.ProbeBuckets > 0 {
+			buckets = activator.NewProbeBuckets(kubeClient, system.Namespace, podName,
+				activatorConfig.ProbeBuckets, activatorConfig.ProbeBucketLeaseDuration)
+		}
+	}
+
+	var upstreamTLS *activator.UpstreamTLS
+	if activatorConfig.UpstreamCASecret != "" {
+		ca, err := activator.UpstreamCAFromSecret(kubeClient, system.Namespace, activatorConfig.UpstreamCASecret)
+		if err != nil {
+			logger.Fatalf("Error loading upstream CA: %v", err)
+		}
+		// Transports are set up with the config current when a server
+		// name is first proxied to.
+		upstreamTLS, err = activator.NewUpstreamTLS(ca, func(cfg *tls.Config) http.RoundTripper {
+			current := configs.Load()
+			t := newProxyTransport(current)
+			t.TLSClientConfig = cfg
+			// Revisions serving HTTP/2 negotiate it during the handshake.
+			if err := http2.ConfigureTransport(t); err != nil {
+				logger.Errorf("Failed to enable HTTP/2 to %s: %v", cfg.ServerName, err)
+			}
+			return newActivatorTransport(t, current, logger)
+		})
+		if err != nil {
+			logger.Fatalf("Error loading upstream CA: %v", err)
+		}
+	}
+
+	a := activator.NewRevisionActivator(kubeClient, servingClient, activatorConfig, probeResults, buckets, upstreamTLS, logger)
+	if hc, ok := a.(activator.HealthChecker); ok {
+		health.AddLivenessCheck("activator", hc.Healthy)
+	}
+	a = activator.NewDedupingActivator(a)
+	a = activator.NewBufferingActivator(a, activatorConfig.MaxPendingRequests, activatorConfig.ActivationQueueOrder, reporter)
+	if r, ok := a.(activator.Reconfigurable); ok {
+		configs.OnChange(func(_, cur *activator.Config) {
+			r.SetConfig(cur)
+		})
+	}
+	configs.OnChange(func(_, cur *activator.Config) {
+		activator.DefaultProbeLimiter.SetCapacity(cur.MaxConcurrentProbes)
+	})
+
+	servingInformerFactory := informers.NewSharedInformerFactory(servingClient, 30*time.Second)
+	routeInformer := servingInformerFactory.Serving().V1alpha1().Routes()
+	health.AddReadinessCheck("routes", activator.InformerSyncedCheck(routeInformer.Informer().HasSynced))
+	revisionInformer := servingInformerFactory.Serving().V1alpha1().Revisions()
+	health.AddReadinessCheck("revisions", activator.InformerSyncedCheck(revisionInformer.Informer().HasSynced))
+	if buckets != nil {
+		revisionInformer.Informer().AddEventHandler(activator.ProbeOwnedRevisions(a, buckets))
+		go buckets.Run(stopCh, logger)
+	}
+	servingInformerFactory.Start(stopCh)
+	ah := &activationHandler{
+		act:         a,
+		tags:        activator.NewTagResolver(routeInformer.Lister()),
+		logger:      logger,
+		revisions:   revisionInformer.Lister(),
+		settings:    newProxySettings(activatorConfig, nil, reporter, logger),
+		upstreamTLS: upstreamTLS,
+		handoff:     *enableHandoff,
+		reporter:    reporter,
+	}
+	ah.shadower = activator.NewShadower(a, activatorConfig.MaxShadowRequests, func(end activator.Endpoint) http.RoundTripper {
+		return ah.transportFor(ah.proxySettings(), end)
+	}, logger)
+	configs.OnChange(func(_, cur *activator.Config) {
+		ah.setConfig(cur)
+		ah.shadower.SetCapacity(cur.MaxShadowRequests)
+	})
+	if activatorConfig.StatReportingPeriod > 0 {
+		ah.reqChan = make(chan activator.ReqEvent, requestCountingQueueLength)
+		statChan := make(chan *autoscaler.StatMessage, statReportingQueueLength)
+		cr := activator.NewConcurrencyReporter(podName, activator.Channels{
+			ReqChan:    ah.reqChan,
+			ReportChan: time.NewTicker(activatorConfig.StatReportingPeriod).C,
+			StatChan:   statChan,
+		})
+		// Requests are still counted while draining on shutdown.
+		go cr.Run(nil)
+		var statsToken string
+		if *statsTokenFile != "" {
+			b, err := ioutil.ReadFile(*statsTokenFile)
+			if err != nil {
+				logger.Fatalf("Error reading stats token: %v", err)
+			}
+			statsToken = strings.TrimSpace(string(b))
+		}
+		sink := activator.NewStatSink(fmt.Sprintf(statSinkURL, system.Namespace), statBacklogLength, statsToken, logger)
+		go sink.Run(statChan, nil)
+		health.AddReadinessCheck("autoscaler", sink.Healthy)
+	}
+	if activatorConfig.AccessLogFormat != "" {
+		ah.accessLog, err = activator.NewAccessLogger(activatorConfig.AccessLogFormat, os.Stdout)
+		if err != nil {
+			logger.Fatalf("Error creating access logger: %v", err)
+		}
+	}
+
+	switch {
+	case activatorConfig.MeshCompatMode:
+		// Pods are neither probed nor proxied to by IP, which the mesh
+		// would reject.
+		if activatorConfig.LoadBalancingPolicy != "" {
+			logger.Infof("Ignoring load balancing policy %q in mesh-compatibility mode", activatorConfig.LoadBalancingPolicy)
+		}
+	case activatorConfig.LoadBalancingPolicy != "":
+		lb, err := activator.NewLoadBalancer(activatorConfig.LoadBalancingPolicy)
+		if err != nil {
+			logger.Fatalf("Error creating load balancer: %v", err)
+		}
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 30*time.Second)
+		endpointsInformer := kubeInformerFactory.Core().V1().Endpoints()
+		nodeInformer := kubeInformerFactory.Core().V1().Nodes()
+		backends := activator.NewRevisionBackendsManager(endpointsInformer, nodeInformer.Lister(), logger)
+		if activatorConfig.ProbeMonitorPeriod > 0 {
+			ah.evictions = activator.NewEvictionTracker()
+			backends.MonitorBackends(activatorConfig.ProbeMonitorPeriod, func(namespace, name, addr string) {
+				if n := ah.evictions.Evict(addr); n > 0 {
+					logger.Infof("Re-dispatching %d requests waiting on %s of %s/%s", n, addr, namespace, name)
+				}
+			})
+		}
+		ah.balancer = activator.NewPodBalancer(lb, backends, podName, activatorConfig.EndpointSubsetSize, activatorConfig.SlowStartWindow)
+		configs.OnChange(func(prev, cur *activator.Config) {
+			var lb activator.LoadBalancer
+			if cur.LoadBalancingPolicy != prev.LoadBalancingPolicy && cur.LoadBalancingPolicy != "" {
+				// The policy was validated along with the rest of the config.
+				lb, _ = activator.NewLoadBalancer(cur.LoadBalancingPolicy)
+			}
+			ah.balancer.SetConfig(lb, cur.EndpointSubsetSize, cur.SlowStartWindow)
+		})
+		kubeInformerFactory.Start(stopCh)
+		health.AddReadinessCheck("endpoints", activator.InformerSyncedCheck(endpointsInformer.Informer().HasSynced))
+		health.AddReadinessCheck("nodes", activator.InformerSyncedCheck(nodeInformer.Informer().HasSynced))
+	}
+
+	checkpoints := activator.NewCheckpointStore(kubeClient, system.Namespace, activator.CheckpointConfigMapName)
+	if *enableHandoff {
+		synced := checkpoints.Watch(stopCh, logger, func(cp activator.Checkpoint) {
+			activator.ResumeCheckpoint(a, cp, podName, handoffMaxAge, buckets, logger)
+		})
+		health.AddReadinessCheck("checkpoints", activator.InformerSyncedCheck(synced))
+	}
+
+	// Requests are authenticated ahead of the registered stages, so that
+	// denied ones never wake their revision.
+	authenticate := activator.Authenticate(ah.tags.RevisionFromRequest, logger, activator.RegisteredAuthenticators()...)
+	stages := append([]activator.Middleware{activator.AssignRequestIDs, activator.TraceRequests, ah.logRequests, activator.FilterHeaders, authenticate},
+		activator.RegisteredMiddleware()...)
+	stages = append(stages, ah.compressResponses)
+	drainer := activator.NewDrainer(activator.Chain(http.HandlerFunc(ah.handler), stages...), health)
+	connections := activator.NewConnectionTracker("http")
+	server := h2c.Server{Server: &http.Server{Addr: ":8080", Handler: drainer, ConnState: connections.ConnState}}
+	trackers := []*activator.ConnectionTracker{connections}
+	var tlsServer *http.Server
+	if *tlsCertDir != "" {
+		certs, err := activator.NewCertReloader(*tlsCertDir, logger)
+		if err != nil {
+			logger.Fatalf("Error loading the serving certificate: %v", err)
+		}
+		go func() {
+			if err := certs.Run(stopCh); err != nil {
+				logger.Errorf("Failed to watch the serving certificate, it will not be reloaded: %v", err)
+			}
+		}()
+		tlsConnections := activator.NewConnectionTracker("https")
+		tlsServer = &http.Server{
+			Addr:      httpsAddr,
+			Handler:   drainer,
+			TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+			ConnState: tlsConnections.ConnState,
+		}
+		trackers = append(trackers, tlsConnections)
+	}
 	go func() {
 		<-stopCh
-		a.Shutdown()
+		// With handoff, pending activations are abandoned right away so
+		// that the requests waiting on them are redirected to another
+		// replica while this one drains.
+		if *enableHandoff {
+			if c, ok := a.(activator.Checkpointer); ok {
+				cp := activator.Checkpoint{
+					Writer:    podName,
+					Time:      time.Now(),
+					Revisions: c.PendingRevisions(),
+				}
+				if err := checkpoints.Save(cp); err != nil {
+					logger.Errorf("Failed to checkpoint pending activations: %v", err)
+				}
+			}
+			a.Shutdown()
+		}
+		drainTimeout := configs.Load().DrainTimeout
+		logger.Infof("Draining requests for up to %v", drainTimeout)
+		if !drainer.Drain(drainTimeout) {
+			logger.Warnf("Requests still in flight after %v, shutting down anyway", drainTimeout)
+		}
+		if !*enableHandoff {
+			a.Shutdown()
+		}
+		server.Close()
+		if tlsServer != nil {
+			tlsServer.Close()
+		}
 	}()
 
 	// Watch the logging config map and dynamically update logging levels.
 	configMapWatcher := configmap.NewDefaultWatcher(kubeClient, system.Namespace)
 	configMapWatcher.Watch(logging.ConfigName, logging.UpdateLevelFromConfigMap(logger, atomicLevel, logLevelKey))
+	configMapWatcher.Watch(activator.ConfigName, configs.OnConfigChanged)
 	if err = configMapWatcher.Start(stopCh); err != nil {
 		logger.Fatalf("failed to start configuration manager: %v", err)
 	}
 
-	http.HandleFunc("/", ah.handler)
-	h2c.ListenAndServe(":8080", nil)
+	if *debugTokenFile != "" {
+		b, err := ioutil.ReadFile(*debugTokenFile)
+		if err != nil {
+			logger.Fatalf("Error reading debug token: %v", err)
+		}
+		token := strings.TrimSpace(string(b))
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/debug/probes", activator.RequireBearerToken(token, activator.DefaultProbeTracker))
+		// Lets revisions be warmed up ahead of expected traffic.
+		adminMux.Handle(activator.ActivatePathPrefix, activator.RequireBearerToken(token, activator.ActivationHandler(a, logger)))
+		go func() {
+			if err := http.ListenAndServe(adminAddr, adminMux); err != nil {
+				logger.Errorf("Admin server failed: %v", err)
+			}
+		}()
+	}
+
+	if activatorConfig.EnableProfiling {
+		profilingMux := http.NewServeMux()
+		profilingMux.HandleFunc("/debug/pprof/", pprof.Index)
+		profilingMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		profilingMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		profilingMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		profilingMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		profilingMux.Handle("/debug/connections", activator.ConnectionsHandler(trackers...))
+		go func() {
+			if err := http.ListenAndServe(profilingAddr, profilingMux); err != nil {
+				logger.Errorf("Profiling server failed: %v", err)
+			}
+		}()
+	}
+
+	if tlsServer != nil {
+		go func() {
+			// The certificate comes from TLSConfig.
+			if err := tlsServer.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+				logger.Fatalf("Activator TLS server failed: %v", err)
+			}
+		}()
+	}
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatalf("Activator server failed: %v", err)
+	}
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/knative/serving/cmd/util"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/autoscaler"
+	"github.com/knative/serving/pkg/autoscaler/statscraper"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
 	"github.com/knative/serving/pkg/configmap"
 	"github.com/knative/serving/pkg/logging"
@@ -126,6 +127,16 @@ func runAutoscaler() {
 	}
 }
 
+// scrapeStats pulls stats from the revision's pods, so that pods which
+// cannot push their stats are still accounted for.
+func scrapeStats(scraper *statscraper.Scraper) {
+	for range time.NewTicker(time.Second).C {
+		for _, s := range scraper.Scrape() {
+			statChan <- s
+		}
+	}
+}
+
 func scaleSerializer() {
 	for {
 		select {
@@ -281,6 +292,7 @@ func main() {
 
 	go runAutoscaler()
 	go scaleSerializer()
+	go scrapeStats(statscraper.New(kubeClient, servingNamespace, servingRevision, logger))
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handler)
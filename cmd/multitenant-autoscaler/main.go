@@ -18,36 +18,64 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/knative/serving/pkg/activator"
+	autoscalingapi "github.com/knative/serving/pkg/apis/autoscaling"
+	av1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/autoscaler"
+	"github.com/knative/serving/pkg/autoscaler/statscraper"
 	"github.com/knative/serving/pkg/autoscaler/statserver"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
 	"github.com/knative/serving/pkg/configmap"
 	"github.com/knative/serving/pkg/controller"
 	"github.com/knative/serving/pkg/controller/autoscaling"
+	"github.com/knative/serving/pkg/controller/metric"
+	"github.com/knative/serving/pkg/leaderelection"
 	"github.com/knative/serving/pkg/logging"
 	"github.com/knative/serving/pkg/signals"
+	"github.com/knative/serving/pkg/system"
 	"go.opencensus.io/exporter/prometheus"
 	"go.opencensus.io/stats/view"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
 	controllerThreads = 2
 	statsServerAddr   = ":8080"
+	debugAddr         = ":8081"
 	statsBufferLen    = 1000
+
+	// bucketsName names the ConfigMaps holding the leases of the buckets
+	// revisions are sharded into.
+	bucketsName = "autoscaler-bucket"
+	// bucketLeaseDuration is how long the buckets of a replica that stops
+	// renewing their leases take to be taken over by the others.
+	bucketLeaseDuration = 15 * time.Second
+
+	// checkpointInterval is how often the state of the scalers is saved
+	// to the checkpoint file.
+	checkpointInterval = 10 * time.Second
 )
 
 var (
-	masterURL  string
-	kubeconfig string
+	masterURL      string
+	kubeconfig     string
+	statsTokenFile string
+	debugTokenFile string
+	checkpointFile string
+	bucketCount    int
 )
 
 func main() {
@@ -82,19 +110,48 @@ func main() {
 		logger.Fatal("Error building serving clientset.", zap.Error(err))
 	}
 
-	revisionScaler := autoscaler.NewRevisionScaler(servingClientSet, kubeClientSet, logger)
+	revisionScaler := autoscaler.NewRevisionScaler(servingClientSet, kubeClientSet, statsReporterFactory, logger)
 
 	rawConfig, err := configmap.Load("/etc/config-autoscaler")
 	if err != nil {
 		logger.Fatalf("Error reading config-autoscaler: %v", err)
 	}
-	// TODO: support dynamic modification of the configuration as in, for example, https://github.com/knative/serving/pull/1417.
 	config, err := autoscaler.NewConfigFromMap(rawConfig)
 	if err != nil {
 		logger.Fatalf("Error loading config-autoscaler: %v", err)
 	}
 
-	multiScaler := autoscaler.NewMultiScaler(config, revisionScaler, stopCh, uniScalerFactory, logger)
+	// Revisions scaled on External and Custom metrics query them from the
+	// metrics APIs aggregated by the API server.
+	multiScaler := autoscaler.NewMultiScaler(config, revisionScaler, stopCh, newDeciderFactory(kubeClientSet.Discovery().RESTClient()), logger)
+
+	// Resume the revisions scaled before a restart with their recent
+	// history, rather than taking them for idle.
+	if checkpointFile != "" {
+		checkpoints, err := autoscaler.LoadCheckpoints(checkpointFile)
+		if err != nil {
+			logger.Error("Error loading checkpoints, starting afresh.", zap.Error(err))
+		} else {
+			logger.Infof("Restoring %d checkpoints.", len(checkpoints))
+			multiScaler.RestoreCheckpoints(checkpoints)
+		}
+	}
+
+	// Scrape stats from the pods of the targets of Metrics as well, so that
+	// pods which cannot push their stats are still accounted for.
+	statsScraperFactory := func(m *av1alpha1.Metric) autoscaler.StatsScraper {
+		return statscraper.New(kubeClientSet, m.Namespace, m.Spec.ScrapeTarget, logger)
+	}
+	collector := autoscaler.NewMetricCollector(statsScraperFactory, multiScaler, stopCh)
+
+	// Apply changes to config-autoscaler without restarting.
+	configs := autoscaler.NewConfigStore(config, logger)
+	configs.OnChange(multiScaler.SetConfig)
+	configMapWatcher := configmap.NewDefaultWatcher(kubeClientSet, system.Namespace)
+	configMapWatcher.Watch(autoscaler.ConfigName, configs.OnConfigChanged)
+	if err := configMapWatcher.Start(stopCh); err != nil {
+		logger.Fatal("Error starting the configuration watcher.", zap.Error(err))
+	}
 
 	opt := controller.Options{
 		KubeClientSet:    kubeClientSet,
@@ -102,13 +159,44 @@ func main() {
 		Logger: logger,
 	}
 
-	ctl := autoscaling.NewController(&opt, multiScaler, time.Second*30)
+	var (
+		revSynch    autoscaling.RevisionSynchronizer = multiScaler
+		metricSynch metric.MetricSynchronizer        = collector
+		buckets     *leaderelection.Buckets
+	)
+	if bucketCount > 0 {
+		// Share the revisions among the replicas, each scaling and
+		// collecting the stats of the revisions in the buckets it owns.
+		podName, err := os.Hostname()
+		if err != nil {
+			logger.Fatalf("Error getting hostname: %v", err)
+		}
+		buckets = leaderelection.NewBuckets(kubeClientSet, system.Namespace, bucketsName, podName, bucketCount, bucketLeaseDuration)
+		revSynch = &ownedRevisions{buckets: buckets, RevisionSynchronizer: multiScaler}
+		metricSynch = &ownedMetrics{buckets: buckets, MetricSynchronizer: collector}
+	}
+
+	ctl := autoscaling.NewController(&opt, revSynch, time.Second*30)
+	metricCtl := metric.NewController(&opt, metricSynch, time.Second*30)
 
 	var eg errgroup.Group
 
+	if buckets != nil {
+		// Reconcile everything again when buckets change hands, to start
+		// scaling the revisions acquired and stop scaling those given up.
+		buckets.OnChange(func() {
+			ctl.Resync()
+			metricCtl.Resync()
+		})
+		go buckets.Run(stopCh, logger)
+	}
+
 	eg.Go(func() error {
 		return ctl.Run(controllerThreads, stopCh)
 	})
+	eg.Go(func() error {
+		return metricCtl.Run(controllerThreads, stopCh)
+	})
 
 	// Setup the metrics to flow to Prometheus.
 	logger.Info("Initializing OpenCensus Prometheus exporter.")
@@ -121,11 +209,35 @@ func main() {
 
 	statsCh := make(chan *autoscaler.StatMessage, statsBufferLen)
 
-	statsServer := statserver.New(statsServerAddr, statsCh, logger)
+	var statsToken string
+	if statsTokenFile != "" {
+		b, err := ioutil.ReadFile(statsTokenFile)
+		if err != nil {
+			logger.Fatal("Error reading stats token.", zap.Error(err))
+		}
+		statsToken = strings.TrimSpace(string(b))
+	}
+	statsServer := statserver.New(statsServerAddr, statsCh, statsToken, logger)
 	eg.Go(func() error {
 		return statsServer.ListenAndServe()
 	})
 
+	if debugTokenFile != "" {
+		b, err := ioutil.ReadFile(debugTokenFile)
+		if err != nil {
+			logger.Fatal("Error reading debug token.", zap.Error(err))
+		}
+		token := strings.TrimSpace(string(b))
+		debugMux := http.NewServeMux()
+		// Tells why revisions are at their scale.
+		debugMux.Handle(autoscaler.DecidersPathPrefix, activator.RequireBearerToken(token, autoscaler.DecisionHandler(multiScaler)))
+		go func() {
+			if err := http.ListenAndServe(debugAddr, debugMux); err != nil {
+				logger.Error("Debug server failed.", zap.Error(err))
+			}
+		}()
+	}
+
 	go func() {
 		for {
 			sm, ok := <-statsCh
@@ -136,6 +248,21 @@ func main() {
 		}
 	}()
 
+	if checkpointFile != "" {
+		go func() {
+			ticker := time.NewTicker(checkpointInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopCh:
+					return
+				case <-ticker.C:
+					saveCheckpoints(multiScaler, logger)
+				}
+			}
+		}()
+	}
+
 	egCh := make(chan struct{})
 
 	go func() {
@@ -151,16 +278,58 @@ func main() {
 	}
 
 	statsServer.Shutdown(time.Second * 5)
+	if checkpointFile != "" {
+		saveCheckpoints(multiScaler, logger)
+	}
+}
+
+func saveCheckpoints(multiScaler *autoscaler.MultiScaler, logger *zap.SugaredLogger) {
+	if err := autoscaler.SaveCheckpoints(checkpointFile, multiScaler.Checkpoints(time.Now())); err != nil {
+		logger.Error("Error saving checkpoints.", zap.Error(err))
+	}
 }
 
-func uniScalerFactory(rev *v1alpha1.Revision, config *autoscaler.Config) (autoscaler.UniScaler, error) {
-	// Create a stats reporter which tags statistics by revision namespace, revision controller name, and revision name.
-	reporter, err := autoscaler.NewStatsReporter(rev.Namespace, revisionControllerName(rev), rev.Name)
+// newDeciderFactory returns a DeciderFactory querying the metric sources of revisions with the given client.
+func newDeciderFactory(metricsClient rest.Interface) autoscaler.DeciderFactory {
+	return func(rev *v1alpha1.Revision, config *autoscaler.Config) (autoscaler.Decider, error) {
+		return newDecider(rev, config, metricsClient)
+	}
+}
+
+func newDecider(rev *v1alpha1.Revision, config *autoscaler.Config, metricsClient rest.Interface) (autoscaler.Decider, error) {
+	reporter, err := statsReporterFactory(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations, err := autoscalingapi.ParseAnnotations(rev.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	name, scaler, err := autoscaler.ScalerFor(annotations)
 	if err != nil {
 		return nil, err
 	}
 
-	return autoscaler.New(config, rev.Spec.ConcurrencyModel, reporter), nil
+	a := autoscaler.New(config, rev.Spec.ConcurrencyModel, reporter)
+	a.SetScaleBounds(annotations.MinScale, annotations.MaxScale)
+	a.SetInitialScale(config.InitialScaleFor(annotations))
+	a.SetActivationScale(autoscaler.ActivationScaleFor(annotations))
+	a.SetMinScaleSchedule(annotations.MinScaleSchedule)
+	a.SetScaler(name, scaler, annotations.Target)
+	a.SetPrediction(annotations.PredictionHorizon)
+	a.SetWindows(annotations.StableWindow, annotations.PanicWindow)
+	if source := autoscaler.NewMetricSource(metricsClient, rev, annotations); source != nil {
+		a.SetMetricSource(source)
+	}
+	return a, nil
+}
+
+// statsReporterFactory creates a stats reporter which tags statistics by revision namespace, revision controller name,
+// and revision name.
+func statsReporterFactory(rev *v1alpha1.Revision) (autoscaler.StatsReporter, error) {
+	return autoscaler.NewStatsReporter(rev.Namespace, revisionControllerName(rev), rev.Name)
 }
 
 func revisionControllerName(rev *v1alpha1.Revision) string {
@@ -176,4 +345,8 @@ func revisionControllerName(rev *v1alpha1.Revision) string {
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.IntVar(&bucketCount, "buckets", 0, "The number of buckets the revisions are hashed into and shared among the replicas by. Every revision is scaled by this replica when zero.")
+	flag.StringVar(&checkpointFile, "checkpoint-file", "", "Path to a file the state of the scalers is saved to periodically and on shutdown, and restored from on start. The state is lost on restart when unset, and on pod replacement unless the file is on a volume outliving the pod.")
+	flag.StringVar(&debugTokenFile, "debug-token-file", "", "Path to a file holding the bearer token required by the debug endpoints. They are disabled when unset.")
+	flag.StringVar(&statsTokenFile, "stats-token-file", "", "Path to a file holding the bearer token stat reporters must present. Connections are not authenticated when unset.")
 }
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Knative Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	av1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/controller/autoscaling"
+	"github.com/knative/serving/pkg/controller/metric"
+	"github.com/knative/serving/pkg/leaderelection"
+	"go.uber.org/zap"
+)
+
+// ownedRevisions passes on to a RevisionSynchronizer only the revisions in
+// the buckets this replica owns. Revisions in other buckets are reported
+// absent, so that their scalers stop once a bucket is handed over.
+type ownedRevisions struct {
+	buckets *leaderelection.Buckets
+	autoscaling.RevisionSynchronizer
+}
+
+func (o *ownedRevisions) OnPresent(rev *v1alpha1.Revision, logger *zap.SugaredLogger) {
+	if !o.buckets.Owns(rev.Namespace, rev.Name) {
+		o.RevisionSynchronizer.OnAbsent(rev.Namespace, rev.Name, logger)
+		return
+	}
+	o.RevisionSynchronizer.OnPresent(rev, logger)
+}
+
+// ownedMetrics passes on to a MetricSynchronizer only the Metrics whose
+// scrape target is in the buckets this replica owns, so that their stats are
+// collected by the replica scaling the revision.
+type ownedMetrics struct {
+	buckets *leaderelection.Buckets
+	metric.MetricSynchronizer
+}
+
+func (o *ownedMetrics) OnPresent(m *av1alpha1.Metric, logger *zap.SugaredLogger) error {
+	if !o.buckets.Owns(m.Namespace, m.Spec.ScrapeTarget) {
+		o.MetricSynchronizer.OnAbsent(m.Namespace, m.Name, logger)
+		return metric.ErrNotOwned
+	}
+	return o.MetricSynchronizer.OnPresent(m, logger)
+}
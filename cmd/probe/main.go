@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// probe runs the activator's readiness probes from a shell, to reproduce
+// activations that never finish without digging through activator logs.
+//
+// Probe the endpoint the activator would for a revision:
+//
+//	probe -kubeconfig ~/.kube/config -namespace default -revision helloworld-00001
+//
+// Or probe any address with a probe spec read from a YAML file:
+//
+//	probe -probe-file probe.yaml -host 10.4.2.7 -port 8080
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/knative/serving/pkg/activator"
+	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
+	revisionresourcenames "github.com/knative/serving/pkg/controller/revision/resources/names"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	masterURL  = flag.String("master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	kubeconfig = flag.String("kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	namespace  = flag.String("namespace", "default", "Namespace of the revision.")
+	revision   = flag.String("revision", "", "Name of the revision whose readiness probe and endpoint to use.")
+	probeFile  = flag.String("probe-file", "", "Path to a YAML probe spec, used instead of the revision's readiness probe.")
+	host       = flag.String("host", "", "Host to probe, instead of the revision's service.")
+	port       = flag.Int("port", 0, "Port to probe, instead of the revision's service port.")
+	h2c        = flag.Bool("h2c", false, "Probe HTTP targets over HTTP/2 without TLS.")
+	caFile     = flag.String("ca-file", "", "Path to a PEM CA bundle. Probes over TLS, verifying the target against it.")
+	serverName = flag.String("server-name", "", "Name to verify the certificate of a TLS target against, instead of its host.")
+	timeout    = flag.Duration("timeout", 60*time.Second, "How long to keep probing before giving up.")
+	once       = flag.Bool("once", false, "Probe a single time instead of until the probe succeeds.")
+)
+
+func main() {
+	flag.Parse()
+
+	target, err := probeTarget()
+	if err != nil {
+		log.Fatalf("Error building probe target: %v", err)
+	}
+	if *probeFile != "" {
+		if target.Probe, err = readProbe(*probeFile); err != nil {
+			log.Fatalf("Error reading probe spec: %v", err)
+		}
+	}
+	if *host != "" {
+		target.Host = *host
+	}
+	if *port != 0 {
+		target.Port = int32(*port)
+	}
+	if *h2c {
+		target.H2C = true
+	}
+	if *caFile != "" {
+		if target.TLS, err = readTLSConfig(*caFile, target.Host); err != nil {
+			log.Fatalf("Error reading CA bundle: %v", err)
+		}
+	}
+	if target.Host == "" || target.Port == 0 {
+		log.Fatal("Either -revision or both -host and -port must be given")
+	}
+
+	log.Printf("Probing %s", describe(target))
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	if *once {
+		err = activator.NewProber(target.Probe).Probe(ctx, target)
+	} else {
+		tracker := activator.NewProbeTracker(1)
+		done := make(chan struct{})
+		go logProgress(tracker, done)
+		_, err = tracker.CheckProbe(ctx, target)
+		close(done)
+	}
+	if err != nil {
+		log.Printf("Not ready after %v: %v", time.Since(start), err)
+		os.Exit(1)
+	}
+	log.Printf("Ready after %v", time.Since(start))
+}
+
+// probeTarget returns the target the activator would probe for -revision,
+// or an empty target when no revision is given.
+func probeTarget() (activator.ProbeTarget, error) {
+	if *revision == "" {
+		return activator.ProbeTarget{}, nil
+	}
+	cfg, err := clientcmd.BuildConfigFromFlags(*masterURL, *kubeconfig)
+	if err != nil {
+		return activator.ProbeTarget{}, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return activator.ProbeTarget{}, fmt.Errorf("error building kubernetes clientset: %v", err)
+	}
+	servingClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return activator.ProbeTarget{}, fmt.Errorf("error building serving clientset: %v", err)
+	}
+
+	rev, err := servingClient.ServingV1alpha1().Revisions(*namespace).Get(*revision, metav1.GetOptions{})
+	if err != nil {
+		return activator.ProbeTarget{}, fmt.Errorf("unable to get revision: %v", err)
+	}
+	log.Printf("Revision %s/%s is %s, ready: %v", rev.Namespace, rev.Name, rev.Spec.ServingState, rev.Status.IsReady())
+	svc, err := kubeClient.CoreV1().Services(*namespace).Get(revisionresourcenames.K8sService(rev), metav1.GetOptions{})
+	if err != nil {
+		return activator.ProbeTarget{}, fmt.Errorf("unable to get service for revision: %v", err)
+	}
+	return activator.RevisionProbeTarget(rev, svc)
+}
+
+func readTLSConfig(path, host string) (*tls.Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	name := host
+	if *serverName != "" {
+		name = *serverName
+	}
+	return &tls.Config{RootCAs: roots, ServerName: name}, nil
+}
+
+func readProbe(path string) (*corev1.Probe, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	probe := &corev1.Probe{}
+	if err := yaml.Unmarshal(b, probe); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+func describe(target activator.ProbeTarget) string {
+	kind := "TCP"
+	if target.Probe != nil && target.Probe.HTTPGet != nil {
+		kind = "HTTP GET " + target.Probe.HTTPGet.Path
+		if target.H2C && target.TLS == nil {
+			kind = "h2c " + kind
+		}
+	}
+	if target.TLS != nil {
+		kind += " over TLS verifying " + target.TLS.ServerName
+	}
+	desc := fmt.Sprintf("%s:%d with %s", target.Host, target.Port, kind)
+	if target.ExpectedBody != nil {
+		desc += fmt.Sprintf(", expecting a body matching %q", target.ExpectedBody)
+	}
+	return desc
+}
+
+// logProgress logs every failed attempt recorded by tracker until done is
+// closed.
+func logProgress(tracker *activator.ProbeTracker, done <-chan struct{}) {
+	logged := 0
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for _, s := range tracker.States().InFlight {
+			if s.Attempts > logged && s.LastError != "" {
+				log.Printf("Attempt %d failed after %s: %s", s.Attempts, s.Elapsed, s.LastError)
+			}
+			logged = s.Attempts
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -28,8 +29,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -39,12 +39,17 @@ import (
 	h2cutil "github.com/knative/serving/pkg/h2c"
 	"github.com/knative/serving/pkg/logging"
 	"github.com/knative/serving/pkg/logging/logkey"
+	"github.com/knative/serving/pkg/network"
+	"github.com/knative/serving/pkg/probe"
 	"github.com/knative/serving/pkg/queue"
 	"github.com/knative/serving/pkg/system"
 	"github.com/knative/serving/third_party/h2c"
+	"go.opencensus.io/exporter/prometheus"
+	"go.opencensus.io/stats/view"
 	"go.uber.org/zap"
 
 	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -56,15 +61,32 @@ const (
 	statReportingQueueLength = 10
 	// Add enough buffer to not block request serving on stats collection
 	requestCountingQueueLength = 100
-	// Number of seconds the /quitquitquit handler should wait before
-	// returning.  The purpose is to kill the container alive a little
-	// bit longer, that it doesn't go away until the pod is truly
+	// How long the queue-proxy keeps serving the requests routed to it
+	// once its pod is terminating, before the /quitquitquit handler
+	// returns.  The purpose is to keep the containers alive a little
+	// bit longer, that they don't go away until the pod is truly
 	// removed from service.
-	quitSleepSecs = 20
-
-	// Single concurency queue depth.  The maximum number of requests
-	// to enqueue before returing 503 overload.
-	singleConcurrencyQueueDepth = 10
+	drainWindow = 20 * time.Second
+	// How long, from the start of the drain, the queue-proxy waits on
+	// the requests in flight before shutting down anyway.
+	drainTimeout = 25 * time.Second
+
+	// userTargetPort is the port the user container serves on.
+	userTargetPort = 8080
+	// queueProbeUserAgent is sent with the readiness probes of the user
+	// container.
+	queueProbeUserAgent = "kube-probe/queue-proxy"
+	// healthProbeTTL is how long the result of the readiness probe of the
+	// user container answers the health checks of the queue-proxy.
+	healthProbeTTL = time.Second
+
+	// The number of requests to enqueue per request allowed in flight
+	// by the container concurrency, before returning 503 overload.
+	queueDepthPerConcurrentRequest = 10
+
+	// metricsReportingPeriod is how often the metrics are exported, and
+	// the queue depth and concurrency gauges sampled.
+	metricsReportingPeriod = time.Second
 )
 
 var (
@@ -79,14 +101,22 @@ var (
 	reqChan               = make(chan queue.ReqEvent, requestCountingQueueLength)
 	kubeClient            *kubernetes.Clientset
 	statSink              *websocket.Conn
+	lastStat              atomic.Value
 	logger                *zap.SugaredLogger
+	statsReporter         queue.StatsReporter
 
 	h2cProxy  *httputil.ReverseProxy
 	httpProxy *httputil.ReverseProxy
+	// The proxies, bounded by the timeouts of the revision.
+	h2cHandler  http.Handler
+	httpHandler http.Handler
 
 	concurrencyQuantumOfTime = flag.Duration("concurrencyQuantumOfTime", 100*time.Millisecond, "")
 	concurrencyModel         = flag.String("concurrencyModel", string(v1alpha1.RevisionRequestConcurrencyModelMulti), "")
-	singleConcurrencyBreaker = queue.NewBreaker(singleConcurrencyQueueDepth, 1)
+	containerConcurrency     = flag.Int("containerConcurrency", 0, "")
+	revisionTimeout          = flag.Duration("revisionTimeout", 0, "")
+	responseStartTimeout     = flag.Duration("responseStartTimeout", 0, "")
+	protocol                 = flag.String("protocol", "", "")
 )
 
 func initEnv() {
@@ -134,6 +164,10 @@ func waitForClose(c *websocket.Conn) {
 func statReporter() {
 	for {
 		s := <-statChan
+		lastStat.Store(s)
+		if err := statsReporter.ReportStat(s); err != nil {
+			logger.Error("Failed to report the stat metrics", zap.Error(err))
+		}
 		if statSink == nil {
 			logger.Error("Stat sink not connected.")
 			continue
@@ -156,109 +190,146 @@ func statReporter() {
 	}
 }
 
-func proxyForRequest(req *http.Request) *httputil.ReverseProxy {
-	if req.ProtoMajor == 2 {
-		return h2cProxy
+// newHandler returns the handler of the requests to the user container,
+// which the container concurrency limits unless zero. Requests are logged
+// to requestLogger unless nil, and reported to the statsReporter.
+func newHandler(requestLogger *queue.RequestLogger) *queue.Handler {
+	h := &queue.Handler{
+		Proxy:         queue.ProxyFor(v1alpha1.RevisionProtocolType(*protocol), httpHandler, h2cHandler),
+		ReqChan:       reqChan,
+		RequestLogger: requestLogger,
+		StatsReporter: statsReporter,
 	}
-
-	return httpProxy
-}
-
-func isProbe(r *http.Request) bool {
-	// Since K8s 1.8, prober requests have
-	//   User-Agent = "kube-probe/{major-version}.{minor-version}".
-	return strings.HasPrefix(r.Header.Get("User-Agent"), "kube-probe/")
+	cc := int32(*containerConcurrency)
+	if cc == 0 && *concurrencyModel == string(v1alpha1.RevisionRequestConcurrencyModelSingle) {
+		// Controllers which predate the container concurrency only
+		// pass the concurrency model.
+		cc = 1
+	}
+	if cc > 0 {
+		// Enforce the container concurrency and breaking
+		h.Breaker = queue.NewBreaker(cc*queueDepthPerConcurrentRequest, cc)
+	}
+	return h
 }
 
-func handler(w http.ResponseWriter, r *http.Request) {
-	proxy := proxyForRequest(r)
-
-	if isProbe(r) {
-		// Do not count health checks for concurrency metrics
-		proxy.ServeHTTP(w, r)
-		return
+// reportQueueDepth samples the requests waiting in and admitted by h for
+// the metrics, as they change with every request.
+func reportQueueDepth(h *queue.Handler) {
+	for range time.NewTicker(metricsReportingPeriod).C {
+		if err := statsReporter.ReportQueueDepth(h.QueueDepth(), h.Concurrency()); err != nil {
+			logger.Error("Failed to report the queue depth", zap.Error(err))
+		}
 	}
+}
 
-	// Metrics for autoscaling
-	reqChan <- queue.ReqIn
-	defer func() {
-		reqChan <- queue.ReqOut
-	}()
-	if *concurrencyModel == string(v1alpha1.RevisionRequestConcurrencyModelSingle) {
-		// Enforce single concurrency and breaking
-		ok := singleConcurrencyBreaker.Maybe(func() {
-			proxy.ServeHTTP(w, r)
-		})
-		if !ok {
-			http.Error(w, "overload", http.StatusServiceUnavailable)
-		}
-	} else {
-		proxy.ServeHTTP(w, r)
+// serveMetrics serves the metrics of the queue-proxy for Prometheus to
+// scrape.
+func serveMetrics(exporter *prometheus.Exporter) {
+	mux := http.NewServeMux()
+	mux.Handle(fmt.Sprintf("/%s", queue.RequestQueueMetricsPath), exporter)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", queue.RequestQueueMetricsPort), mux); err != nil {
+		logger.Error("Metrics server failed", zap.Error(err))
 	}
 }
 
-// healthServer registers whether a PreStop hook has been called.
+// healthServer registers whether the pod is draining, and probes the
+// readiness of the user container.
 type healthServer struct {
-	alive bool
-	mutex sync.RWMutex
+	drainer *network.Drainer
+	probe   *probe.Cache
 }
 
-// isAlive() returns true until a PreStop hook has been called.
+// isAlive() returns true until a PreStop hook has been called or the
+// queue-proxy is terminated.
 func (h *healthServer) isAlive() bool {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-	return h.alive
-}
-
-// kill() marks that a PreStop hook has been called.
-func (h *healthServer) kill() {
-	h.mutex.Lock()
-	h.alive = false
-	h.mutex.Unlock()
+	return !h.drainer.Draining()
 }
 
 // healthHandler is used for readinessProbe/livenessCheck of
-// queue-proxy.
+// queue-proxy. It only succeeds once the user container is ready, so that
+// every revision can be probed on the same path.
 func (h *healthServer) healthHandler(w http.ResponseWriter, r *http.Request) {
-	if h.isAlive() {
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, "alive: true")
-	} else {
+	if !h.isAlive() {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, "alive: false")
+		return
 	}
+	if err := h.probe.Check(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, fmt.Sprintf("alive: true, ready: false: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "alive: true")
 }
 
-// quitHandler() is used for preStop hook of queue-proxy. It:
+// userReadinessProbe returns the readiness probe of the user container,
+// run against the port it serves on. The queue-proxy cannot run exec
+// probes in the user container, so those and unset probes check that it
+// accepts connections.
+func userReadinessProbe() (probe.Target, error) {
+	target := probe.Target{
+		Host:   "127.0.0.1",
+		Port:   userTargetPort,
+		Header: http.Header{"User-Agent": {queueProbeUserAgent}},
+		// gRPC servers only answer HTTP/2.
+		H2C: *protocol == string(v1alpha1.RevisionProtocolH2C),
+	}
+	if raw := os.Getenv("SERVING_READINESS_PROBE"); raw != "" {
+		target.Probe = &corev1.Probe{}
+		if err := json.Unmarshal([]byte(raw), target.Probe); err != nil {
+			return probe.Target{}, err
+		}
+	}
+	return target, nil
+}
+
+// quitHandler() is used for preStop hook of queue-proxy and of the user
+// container. It:
 // - marks the service as not ready, so that requests will no longer
 //   be routed to it,
-// - adds a small delay, so that the container doesn't get killed at
-//   the same time the pod is marked for removal.
+// - keeps serving the requests still routed to it for the drain window,
+//   so that the containers don't get killed at the same time the pod is
+//   marked for removal,
+// - waits on the requests in flight, so that the user container isn't
+//   terminated while serving them.
 func (h *healthServer) quitHandler(w http.ResponseWriter, r *http.Request) {
-	// First, we want to mark the container as not ready, so that even
-	// if the pod removal (from service) isn't yet effective, the
-	// readinessCheck will still prevent traffic to be routed to this
-	// pod.
-	h.kill()
-	// However, since both readinessCheck and pod removal from service
-	// is eventually consistent, we add here a small delay to have the
-	// container stay alive a little bit longer after.  We still have
-	// no guarantee that container termination is done only after
-	// removal from service is effective, but this has been showed to
-	// alleviate the issue.
-	time.Sleep(quitSleepSecs * time.Second)
+	// Since both readinessCheck and pod removal from service is
+	// eventually consistent, the drain window has the containers stay
+	// alive a little bit longer after the readinessCheck starts
+	// failing.  We still have no guarantee that container termination
+	// is done only after removal from service is effective, but this
+	// has been showed to alleviate the issue.
+	if !h.drainer.Drain(drainTimeout) {
+		logger.Warnf("Requests still in flight after %v, shutting down anyway", drainTimeout)
+	}
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "alive: false")
 }
 
-// Sets up /health and /quitquitquit endpoints.
-func setupAdminHandlers(server *http.Server) {
+// statsHandler serves the last stat reported, so that the autoscaler
+// can pull it when the stat sink is not connected.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := lastStat.Load().(*autoscaler.Stat)
+	if !ok {
+		http.Error(w, "no stats reported yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// Sets up /health, /quitquitquit and /stats endpoints.
+func setupAdminHandlers(server *http.Server, readiness probe.Target, drainer *network.Drainer) {
 	h := healthServer{
-		alive: true,
+		drainer: drainer,
+		probe:   probe.NewCache(readiness, healthProbeTTL),
 	}
 	mux := http.NewServeMux()
 	mux.HandleFunc(fmt.Sprintf("/%s", queue.RequestQueueHealthPath), h.healthHandler)
 	mux.HandleFunc(fmt.Sprintf("/%s", queue.RequestQueueQuitPath), h.quitHandler)
+	mux.HandleFunc(fmt.Sprintf("/%s", queue.RequestQueueStatsPath), statsHandler)
 	server.Handler = mux
 	server.ListenAndServe()
 }
@@ -276,16 +347,47 @@ func main() {
 		zap.String(logkey.Revision, servingRevision),
 		zap.String(logkey.Pod, podName))
 
-	target, err := url.Parse("http://localhost:8080")
+	target, err := url.Parse(fmt.Sprintf("http://localhost:%d", userTargetPort))
 	if err != nil {
 		logger.Fatal("Failed to parse localhost url", zap.Error(err))
 	}
 
+	readiness, err := userReadinessProbe()
+	if err != nil {
+		logger.Fatal("Failed to parse the readiness probe of the user container", zap.Error(err))
+	}
+
+	exporter, err := prometheus.NewExporter(prometheus.Options{Namespace: "queue"})
+	if err != nil {
+		logger.Fatal("Failed to create prometheus exporter", zap.Error(err))
+	}
+	view.RegisterExporter(exporter)
+	view.SetReportingPeriod(metricsReportingPeriod)
+	statsReporter, err = queue.NewStatsReporter(servingNamespace, servingConfiguration, servingRevision, podName)
+	if err != nil {
+		logger.Fatal("Failed to create stats reporter", zap.Error(err))
+	}
+	go serveMetrics(exporter)
+
+	var requestLogger *queue.RequestLogger
+	if tmpl := os.Getenv("SERVING_REQUEST_LOG_TEMPLATE"); tmpl != "" {
+		requestLogger, err = queue.NewRequestLogger(tmpl, os.Stdout)
+		if err != nil {
+			logger.Fatal("Failed to parse the request log template", zap.Error(err))
+		}
+	}
+
 	httpProxy = httputil.NewSingleHostReverseProxy(target)
 	h2cProxy = httputil.NewSingleHostReverseProxy(target)
 	h2cProxy.Transport = h2cutil.NewTransport()
-
-	logger.Infof("Queue container is starting, concurrencyModel: %s", *concurrencyModel)
+	// Flush after every write, so that gRPC streams are not held back in
+	// the proxy and the flow control of HTTP/2 applies end to end.
+	h2cProxy.FlushInterval = -1
+	httpHandler = queue.NewTimeoutHandler(httpProxy, *revisionTimeout, *responseStartTimeout)
+	h2cHandler = queue.NewTimeoutHandler(h2cProxy, *revisionTimeout, *responseStartTimeout)
+
+	logger.Infof("Queue container is starting, concurrencyModel: %s, containerConcurrency: %d, revisionTimeout: %v, responseStartTimeout: %v, protocol: %s",
+		*concurrencyModel, *containerConcurrency, *revisionTimeout, *responseStartTimeout, *protocol)
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		logger.Fatal("Error getting in cluster config", zap.Error(err))
@@ -316,9 +418,12 @@ func main() {
 		Handler: nil,
 	}
 
+	handler := newHandler(requestLogger)
+	go reportQueueDepth(handler)
+	drainer := network.NewDrainer(handler, drainWindow)
 	h2cServer := h2c.Server{Server: &http.Server{
 		Addr:    fmt.Sprintf(":%d", queue.RequestQueuePort),
-		Handler: http.HandlerFunc(handler),
+		Handler: drainer,
 	}}
 
 	// Add a SIGTERM handler to gracefully shutdown the servers during
@@ -327,6 +432,11 @@ func main() {
 	signal.Notify(sigTermChan, syscall.SIGTERM)
 	go func() {
 		<-sigTermChan
+		// Drain here should the PreStop hook have failed.  Otherwise
+		// the drain is already over and this returns at once.
+		if !drainer.Drain(drainTimeout) {
+			logger.Warnf("Requests still in flight after %v, shutting down anyway", drainTimeout)
+		}
 		// Calling server.Shutdown() allows pending requests to
 		// complete, while no new work is accepted.
 
@@ -336,5 +446,5 @@ func main() {
 	}()
 
 	go h2cServer.ListenAndServe()
-	setupAdminHandlers(adminServer)
+	setupAdminHandlers(adminServer, readiness, drainer)
 }
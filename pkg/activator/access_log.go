@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// JSONAccessLogFormat writes each access log entry as a JSON object
+	// on its own line.
+	JSONAccessLogFormat = "json"
+	// CombinedAccessLogFormat writes access log entries in the Apache
+	// combined log format, followed by the revision, the latency in
+	// milliseconds and whether the request waited on an activation.
+	CombinedAccessLogFormat = "combined"
+
+	// combinedTimeFormat is the timestamp layout of the Apache combined
+	// log format.
+	combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// AccessLogEntry describes a request handled by the activator.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Host       string    `json:"host"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Namespace  string    `json:"namespace"`
+	Revision   string    `json:"revision"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	// LatencyMillis is how long the activator took to answer the
+	// request, including waiting on the revision's activation.
+	LatencyMillis float64 `json:"latencyMillis"`
+	// Activation is set when the request waited on its revision being
+	// activated, rather than finding it warm.
+	Activation bool `json:"activation"`
+}
+
+// NewAccessLogEntry creates the entry for r, answered through w after
+// arriving at start.
+func NewAccessLogEntry(r *http.Request, w *StatusWriter, namespace, name string, start time.Time, activation bool) AccessLogEntry {
+	return AccessLogEntry{
+		Time:          start,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        r.Method,
+		URI:           r.RequestURI,
+		Proto:         r.Proto,
+		Host:          r.Host,
+		Referer:       r.Referer(),
+		UserAgent:     r.UserAgent(),
+		RequestID:     r.Header.Get(RequestIDHeader),
+		Namespace:     namespace,
+		Revision:      name,
+		Status:        w.Status(),
+		Bytes:         w.Bytes(),
+		LatencyMillis: milliseconds(time.Since(start)),
+		Activation:    activation,
+	}
+}
+
+// AccessLogger writes access log entries in one of the supported formats.
+type AccessLogger struct {
+	mux    sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// NewAccessLogger creates an AccessLogger writing entries to out in the
+// given format.
+func NewAccessLogger(format string, out io.Writer) (*AccessLogger, error) {
+	switch format {
+	case JSONAccessLogFormat, CombinedAccessLogFormat:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	return &AccessLogger{
+		out:    out,
+		format: format,
+	}, nil
+}
+
+// Log writes e as a single line.
+func (l *AccessLogger) Log(e AccessLogEntry) error {
+	var line []byte
+	switch l.format {
+	case JSONAccessLogFormat:
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	case CombinedAccessLogFormat:
+		line = []byte(combinedLine(e))
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	_, err := l.out.Write(line)
+	return err
+}
+
+func combinedLine(e AccessLogEntry) string {
+	start := "warm"
+	if e.Activation {
+		start = "activation"
+	}
+	return fmt.Sprintf("%s - - [%s] %q %d %d %q %q %s/%s %.3f %s\n",
+		remoteHost(e.RemoteAddr), e.Time.Format(combinedTimeFormat),
+		e.Method+" "+e.URI+" "+e.Proto, e.Status, e.Bytes,
+		orDash(e.Referer), orDash(e.UserAgent),
+		e.Namespace, e.Revision, e.LatencyMillis, start)
+}
+
+// remoteHost strips the port from a RemoteAddr.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return orDash(addr)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testAccessLogEntry() AccessLogEntry {
+	return AccessLogEntry{
+		Time:          time.Date(2018, time.July, 4, 10, 30, 0, 0, time.UTC),
+		RemoteAddr:    "10.0.0.1:54321",
+		Method:        "GET",
+		URI:           "/path?q=1",
+		Proto:         "HTTP/1.1",
+		Host:          "rev1-service.default",
+		UserAgent:     "curl/7.54.0",
+		Namespace:     "default",
+		Revision:      "rev1",
+		Status:        http.StatusOK,
+		Bytes:         42,
+		LatencyMillis: 1234.5,
+		Activation:    true,
+	}
+}
+
+func TestAccessLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewAccessLogger(JSONAccessLogFormat, &buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := testAccessLogEntry()
+	if err := l.Log(want); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got AccessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Access log is not JSON: %v: %q", err, buf.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected access log entry (-want +got): %v", diff)
+	}
+}
+
+func TestAccessLogger_Combined(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		entry func(*AccessLogEntry)
+		want  string
+	}{{
+		name:  "activation",
+		entry: func(*AccessLogEntry) {},
+		want: `10.0.0.1 - - [04/Jul/2018:10:30:00 +0000] "GET /path?q=1 HTTP/1.1" 200 42 "-" "curl/7.54.0" ` +
+			"default/rev1 1234.500 activation\n",
+	}, {
+		name: "warm",
+		entry: func(e *AccessLogEntry) {
+			e.Activation = false
+			e.RemoteAddr = "[::1]:80"
+			e.Referer = "http://example.com/"
+			e.UserAgent = ""
+			e.Status = http.StatusBadGateway
+		},
+		want: `::1 - - [04/Jul/2018:10:30:00 +0000] "GET /path?q=1 HTTP/1.1" 502 42 "http://example.com/" "-" ` +
+			"default/rev1 1234.500 warm\n",
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := NewAccessLogger(CombinedAccessLogFormat, &buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			e := testAccessLogEntry()
+			c.entry(&e)
+			if err := l.Log(e); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := buf.String(); got != c.want {
+				t.Errorf("Unexpected access log line. Want %q. Got %q.", c.want, got)
+			}
+		})
+	}
+}
+
+func TestNewAccessLogger_UnknownFormat(t *testing.T) {
+	if _, err := NewAccessLogger("xml", &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for an unknown format, got nil")
+	}
+}
+
+func TestNewAccessLogEntry(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://rev1-service.default/upload", nil)
+	r.Header.Set("User-Agent", "test")
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := NewStatusWriter(httptest.NewRecorder())
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("done"))
+	start := time.Now().Add(-time.Second)
+
+	e := NewAccessLogEntry(r, w, "default", "rev1", start, false)
+
+	if e.Status != http.StatusCreated || e.Bytes != 4 {
+		t.Errorf("Unexpected status and bytes. Want 201 and 4. Got %v and %v.", e.Status, e.Bytes)
+	}
+	if e.Method != "POST" || e.URI != "http://rev1-service.default/upload" || e.UserAgent != "test" {
+		t.Errorf("Unexpected request fields: %+v", e)
+	}
+	if e.RequestID != "req-1" {
+		t.Errorf("Unexpected request ID. Want %q. Got %q.", "req-1", e.RequestID)
+	}
+	if e.LatencyMillis < 1000 {
+		t.Errorf("Unexpected latency. Want at least 1000ms. Got %vms.", e.LatencyMillis)
+	}
+}
@@ -15,6 +15,17 @@ limitations under the License.
 */
 package activator
 
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
 const (
 	// The name of the activator service.
 	K8sServiceName = "activator-service"
@@ -24,9 +35,10 @@ const (
 type Status int
 
 // Activator provides an active endpoint for a revision or an error and
-// status code indicating why it could not.
+// status code indicating why it could not. Activating gives up once ctx
+// is done, which ends it for the requests that were waiting on it.
 type Activator interface {
-	ActiveEndpoint(namespace, name string) (Endpoint, Status, error)
+	ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error)
 	Shutdown()
 }
 
@@ -35,8 +47,91 @@ type revisionID struct {
 	name      string
 }
 
-// Endpoint is a fully-qualified domain name / port pair for an active revision.
+type revisionKey struct{}
+
+// WithRevision returns a copy of ctx in which requests are known to be
+// for the named revision.
+func WithRevision(ctx context.Context, namespace, name string) context.Context {
+	return context.WithValue(ctx, revisionKey{}, revisionID{namespace: namespace, name: name})
+}
+
+func revisionFrom(ctx context.Context) (revisionID, bool) {
+	rev, ok := ctx.Value(revisionKey{}).(revisionID)
+	return rev, ok
+}
+
+// Endpoint is a fully-qualified domain name / port pair for an active
+// revision, along with how to reach it.
 type Endpoint struct {
 	FQDN string
 	Port int32
+
+	// Scheme is the scheme requests are proxied to the revision with,
+	// "http" when empty.
+	Scheme string
+
+	// Protocol is the protocol the revision serves. Revisions serving
+	// cleartext HTTP/2, such as gRPC servers, must be proxied to over
+	// HTTP/2.
+	Protocol v1alpha1.RevisionProtocolType
+
+	// Pod, if set, is the pod of the revision FQDN addresses directly.
+	Pod *Pod
+
+	// Timeout is how long the revision is allowed for responding to a
+	// request. Zero means no limit.
+	Timeout time.Duration
+
+	// Activated is set when the revision was not ready to serve when it
+	// was asked for, so the request waited on it being activated rather
+	// than finding it warm.
+	Activated bool
+
+	// MaxRequestBodyBytes, if positive, caps the size of the request
+	// bodies forwarded to the revision instead of the activator's limit.
+	MaxRequestBodyBytes int64
+
+	// HedgeDelay, if positive, is how long requests to the revision wait
+	// for response headers before being hedged against another pod.
+	HedgeDelay time.Duration
+
+	// ShadowRevision, if set, names the revision in the same namespace
+	// that ShadowPercent percent of the requests to this one are
+	// mirrored to.
+	ShadowRevision string
+	ShadowPercent  int
+
+	// ServerName is the name the certificate of revisions proxied to
+	// over "https" is verified against, rather than FQDN, which may be
+	// the address of one of its pods.
+	ServerName string
+}
+
+// Pod identifies a pod serving a revision.
+type Pod struct {
+	Name string
+	UID  types.UID
+
+	// Zone is the failure domain of the node running the pod, empty if
+	// unknown.
+	Zone string
+}
+
+// Address returns the host:port address of the endpoint.
+func (e Endpoint) Address() string {
+	return net.JoinHostPort(e.FQDN, strconv.Itoa(int(e.Port)))
+}
+
+// URL returns the URL requests are proxied to the endpoint at.
+func (e Endpoint) URL() *url.URL {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return &url.URL{Scheme: scheme, Host: e.Address()}
+}
+
+// H2C reports whether the endpoint serves cleartext HTTP/2.
+func (e Endpoint) H2C() bool {
+	return e.Scheme != "https" && e.Protocol == v1alpha1.RevisionProtocolH2C
 }
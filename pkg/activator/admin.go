@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// ActivatePathPrefix is the prefix of the paths served by
+	// ActivationHandler, which are
+	// /api/v1/namespaces/{namespace}/revisions/{name}:activate.
+	ActivatePathPrefix = "/api/v1/namespaces/"
+
+	activateSuffix = ":activate"
+)
+
+// ActivationResult is the response of ActivationHandler.
+type ActivationResult struct {
+	Endpoint string `json:"endpoint"`
+
+	// Activated is set when the revision had to be activated, rather
+	// than being found ready to serve.
+	Activated bool `json:"activated"`
+}
+
+// ActivationHandler activates revisions on demand, without sending them
+// any traffic, so that they can be warmed up ahead of expected load. It
+// responds once the revision is ready to serve.
+func ActivationHandler(a Activator, logger *zap.SugaredLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace, name, ok := parseActivatePath(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		logger.Infof("Activating revision %s/%s on request", namespace, name)
+		endpoint, status, err := ActiveEndpointWithSpan(r.Context(), a, namespace, name)
+		if err != nil {
+			msg := fmt.Sprintf("Error activating revision %s/%s: %v", namespace, name, err)
+			logger.Error(msg)
+			http.Error(w, msg, int(status))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ActivationResult{
+			Endpoint:  endpoint.Address(),
+			Activated: endpoint.Activated,
+		})
+	})
+}
+
+// parseActivatePath returns the revision named by an activation path.
+func parseActivatePath(path string) (namespace, name string, ok bool) {
+	if !strings.HasPrefix(path, ActivatePathPrefix) || !strings.HasSuffix(path, activateSuffix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, ActivatePathPrefix), activateSuffix), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] != "revisions" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestActivationHandler(t *testing.T) {
+	f := newFakeActivator(t, map[revisionID]activationResult{
+		{"default", "cold"}: {
+			endpoint: Endpoint{FQDN: "cold.default.svc", Port: 8080, Activated: true},
+			status:   http.StatusOK,
+		},
+		{"default", "missing"}: {
+			status: http.StatusNotFound,
+			err:    errors.New("not found"),
+		},
+	})
+	h := ActivationHandler(f, TestLogger(t))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantCode   int
+		wantResult *ActivationResult
+	}{{
+		name:     "activates",
+		method:   http.MethodPost,
+		path:     "/api/v1/namespaces/default/revisions/cold:activate",
+		wantCode: http.StatusOK,
+		wantResult: &ActivationResult{
+			Endpoint:  "cold.default.svc:8080",
+			Activated: true,
+		},
+	}, {
+		name:     "activation error",
+		method:   http.MethodPost,
+		path:     "/api/v1/namespaces/default/revisions/missing:activate",
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "get",
+		method:   http.MethodGet,
+		path:     "/api/v1/namespaces/default/revisions/cold:activate",
+		wantCode: http.StatusMethodNotAllowed,
+	}, {
+		name:     "no verb",
+		method:   http.MethodPost,
+		path:     "/api/v1/namespaces/default/revisions/cold",
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "not a revision",
+		method:   http.MethodPost,
+		path:     "/api/v1/namespaces/default/services/cold:activate",
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "no namespace",
+		method:   http.MethodPost,
+		path:     "/api/v1/namespaces//revisions/cold:activate",
+		wantCode: http.StatusNotFound,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+			if rec.Code != test.wantCode {
+				t.Errorf("Unexpected status code. Want %v. Got %v.", test.wantCode, rec.Code)
+			}
+			if test.wantResult == nil {
+				return
+			}
+			var got ActivationResult
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			if got != *test.wantResult {
+				t.Errorf("Unexpected result. Want %+v. Got %+v.", *test.wantResult, got)
+			}
+		})
+	}
+
+	if got, want := len(f.record), 2; got != want {
+		t.Errorf("Unexpected number of activations. Want %v. Got %v.", want, got)
+	}
+}
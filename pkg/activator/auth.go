@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnauthenticated is returned by Authenticators for requests
+	// lacking valid credentials, which are answered with a 401.
+	ErrUnauthenticated = errors.New("request is not authenticated")
+
+	// ErrForbidden is returned by Authenticators for requests whose
+	// identity may not reach the revision, which are answered with a
+	// 403, as are those failing with any other error.
+	ErrForbidden = errors.New("request is not allowed to reach the revision")
+)
+
+// Authenticator decides whether requests may reach their revision. It is
+// consulted before a request waits on the activation of its revision, so
+// that denied requests never cause a revision to be probed or scaled up.
+type Authenticator interface {
+	// Authenticate returns nil if r, for the named revision, may be
+	// served, and otherwise why not.
+	Authenticate(r *http.Request, namespace, name string) error
+}
+
+// AuthenticatorFunc is a func implementing Authenticator.
+type AuthenticatorFunc func(r *http.Request, namespace, name string) error
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(r *http.Request, namespace, name string) error {
+	return f(r, namespace, name)
+}
+
+var registeredAuthenticators []Authenticator
+
+// RegisterAuthenticator adds a to the Authenticators the requests to
+// the activator must all pass, after the ones registered before it.
+// Like middleware, extensions register them from the init function of a
+// package imported by the activator binary.
+func RegisterAuthenticator(a Authenticator) {
+	registeredMux.Lock()
+	defer registeredMux.Unlock()
+	registeredAuthenticators = append(registeredAuthenticators, a)
+}
+
+// RegisteredAuthenticators returns the Authenticators added by
+// RegisterAuthenticator, in the order they were registered.
+func RegisteredAuthenticators() []Authenticator {
+	registeredMux.Lock()
+	defer registeredMux.Unlock()
+	return append([]Authenticator(nil), registeredAuthenticators...)
+}
+
+// Authenticate returns the stage answering requests that any of
+// authenticators denies right away, without passing them on. The
+// revision requests are for is found by revisionFrom, and requests for
+// none are passed on for the handler to reject.
+func Authenticate(revisionFrom func(*http.Request) (string, string, bool), logger *zap.SugaredLogger, authenticators ...Authenticator) Middleware {
+	return func(h http.Handler) http.Handler {
+		if len(authenticators) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			namespace, name, ok := revisionFrom(r)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			for _, a := range authenticators {
+				err := a.Authenticate(r, namespace, name)
+				if err == nil {
+					continue
+				}
+				// Denied requests may come in floods, so they are not
+				// logged above debug level.
+				logger.Debugf("Denied request for revision %s/%s: %v", namespace, name, err)
+				code := http.StatusForbidden
+				if errors.Is(err, ErrUnauthenticated) {
+					code = http.StatusUnauthorized
+				}
+				http.Error(w, http.StatusText(code), code)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	// The token of each revision is its name.
+	byToken := AuthenticatorFunc(func(r *http.Request, namespace, name string) error {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return ErrUnauthenticated
+		case "Bearer " + name:
+			return nil
+		default:
+			return fmt.Errorf("token for another revision: %w", ErrForbidden)
+		}
+	})
+	var checked []string
+	record := AuthenticatorFunc(func(r *http.Request, namespace, name string) error {
+		checked = append(checked, namespace+"/"+name)
+		return nil
+	})
+
+	tests := []struct {
+		name        string
+		auth        string
+		noRevision  bool
+		wantCode    int
+		wantChecked []string
+	}{{
+		name:        "authenticated",
+		auth:        "Bearer rev",
+		wantCode:    http.StatusOK,
+		wantChecked: []string{"ns/rev"},
+	}, {
+		name:     "no credentials",
+		wantCode: http.StatusUnauthorized,
+	}, {
+		name:     "wrong revision",
+		auth:     "Bearer other",
+		wantCode: http.StatusForbidden,
+	}, {
+		name:       "no revision",
+		noRevision: true,
+		wantCode:   http.StatusOK,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checked = nil
+			served := false
+			h := Authenticate(RevisionFromRequest, TestLogger(t), byToken, record)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					served = true
+				}))
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			if !test.noRevision {
+				r.Header.Set("Knative-Serving-Namespace", "ns")
+				r.Header.Set("Knative-Serving-Revision", "rev")
+			}
+			if test.auth != "" {
+				r.Header.Set("Authorization", test.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != test.wantCode {
+				t.Errorf("Unexpected status code. Want %v. Got %v.", test.wantCode, rec.Code)
+			}
+			if want := test.wantCode == http.StatusOK; served != want {
+				t.Errorf("Unexpected serving of the request. Want %v. Got %v.", want, served)
+			}
+			// Authenticators after the one denying a request are skipped.
+			if !cmp.Equal(test.wantChecked, checked) {
+				t.Errorf("Unexpected authenticators run. Want %v. Got %v.", test.wantChecked, checked)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_None(t *testing.T) {
+	served := false
+	h := Authenticate(RevisionFromRequest, TestLogger(t))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		}))
+	r := httptest.NewRequest("GET", "http://rev-service.ns.svc.cluster.local/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !served {
+		t.Error("Expected requests to be served without authenticators.")
+	}
+}
+
+func TestRegisterAuthenticator(t *testing.T) {
+	defer func(saved []Authenticator) {
+		registeredAuthenticators = saved
+	}(registeredAuthenticators)
+	registeredAuthenticators = nil
+
+	deny := errors.New("denied")
+	RegisterAuthenticator(AuthenticatorFunc(func(*http.Request, string, string) error { return nil }))
+	RegisterAuthenticator(AuthenticatorFunc(func(*http.Request, string, string) error { return deny }))
+	got := RegisteredAuthenticators()
+	if len(got) != 2 {
+		t.Fatalf("Unexpected number of authenticators. Want 2. Got %d.", len(got))
+	}
+	if err := got[1].Authenticate(nil, "ns", "rev"); err != deny {
+		t.Errorf("Unexpected authenticator order. Want the second to return %v. Got %v.", deny, err)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWeight is the weight of the latest activation in the
+	// average activation latency of a revision.
+	latencyWeight = 0.2
+
+	// Requests turned away are told to retry after the average activation
+	// latency of their revision, within these bounds.
+	minRetryAfter = 1 * time.Second
+	maxRetryAfter = 1 * time.Minute
+)
+
+// ErrBufferFull is returned for requests turned away because too many
+// requests are already waiting on the activation of their revision.
+var ErrBufferFull = errors.New("too many requests waiting for revision activation")
+
+// BufferFullError is the ErrBufferFull returned for a request, with how
+// long it should be retried after.
+type BufferFullError struct {
+	RetryAfter time.Duration
+}
+
+func (e *BufferFullError) Error() string {
+	return ErrBufferFull.Error()
+}
+
+// Unwrap returns ErrBufferFull.
+func (e *BufferFullError) Unwrap() error {
+	return ErrBufferFull
+}
+
+// QueueOrder is the order requests held on the activation of a revision
+// are released in once it is done.
+type QueueOrder string
+
+const (
+	// FIFOQueueOrder releases the requests that waited longest first,
+	// so that the tail latency of a burst is no worse than its
+	// activation.
+	FIFOQueueOrder QueueOrder = "fifo"
+
+	// LIFOQueueOrder releases the latest requests first, which are the
+	// most likely to still be within their clients' timeouts.
+	LIFOQueueOrder QueueOrder = "lifo"
+)
+
+var _ Activator = (*bufferingActivator)(nil)
+var _ Checkpointer = (*bufferingActivator)(nil)
+var _ Reconfigurable = (*bufferingActivator)(nil)
+
+type bufferingActivator struct {
+	mux        sync.Mutex
+	queues     map[revisionID]*waitQueue
+	latencies  map[revisionID]time.Duration
+	maxPending int
+	order      QueueOrder
+	activator  Activator
+	reporter   StatsReporter
+
+	// for testing
+	onRelease func(w *waiter)
+}
+
+// waitQueue holds the requests waiting on the activation of a revision,
+// in the order they arrived.
+type waitQueue struct {
+	waiters []*waiter
+	// releasing is set from releasing a waiter until it runs, so that
+	// the next one is only released after it.
+	releasing bool
+	arrivals  int
+}
+
+// waiter is a request held in a waitQueue.
+type waiter struct {
+	// seq numbers the requests to a revision in the order they arrived.
+	seq int
+	// done is set once the activation returned for the request.
+	done bool
+	// turn is closed when the request is released.
+	turn chan struct{}
+}
+
+// NewBufferingActivator creates an Activator that holds at most maxPending
+// requests per revision while it is activated, turning away the ones in
+// excess with a 503 rather than letting them pile up in memory. Those
+// get a BufferFullError telling them to retry after the time requests
+// usually wait on the revision's activation. A maxPending of zero or less
+// holds any number of requests. Once activated, the requests held are
+// released one at a time in the given order rather than the order their
+// goroutines happen to wake up in. The number of requests held and
+// turned away is reported to reporter, unless it is nil.
+func NewBufferingActivator(a Activator, maxPending int, order QueueOrder, reporter StatsReporter) Activator {
+	return &bufferingActivator{
+		queues:     make(map[revisionID]*waitQueue),
+		latencies:  make(map[revisionID]time.Duration),
+		maxPending: maxPending,
+		order:      order,
+		activator:  a,
+		reporter:   reporter,
+	}
+}
+
+func (a *bufferingActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error) {
+	id := revisionID{namespace: namespace, name: name}
+	w := a.reserve(id)
+	if w == nil {
+		return Endpoint{}, http.StatusServiceUnavailable, &BufferFullError{RetryAfter: a.retryAfter(id)}
+	}
+	start := time.Now()
+	endpoint, status, err := a.activator.ActiveEndpoint(ctx, namespace, name)
+	if err == nil && endpoint.Activated {
+		a.observeLatency(id, time.Since(start))
+	}
+	a.wait(ctx, id, w)
+	return endpoint, status, err
+}
+
+func (a *bufferingActivator) Shutdown() {
+	a.activator.Shutdown()
+}
+
+// SetConfig implements Reconfigurable, passing config on to the wrapped
+// Activator. Requests already held stay so when MaxPendingRequests is
+// lowered below their number.
+func (a *bufferingActivator) SetConfig(config *Config) {
+	a.mux.Lock()
+	a.maxPending = config.MaxPendingRequests
+	a.order = config.ActivationQueueOrder
+	a.mux.Unlock()
+	if r, ok := a.activator.(Reconfigurable); ok {
+		r.SetConfig(config)
+	}
+}
+
+// PendingRevisions implements Checkpointer.
+func (a *bufferingActivator) PendingRevisions() []CheckpointRevision {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	revs := make([]CheckpointRevision, 0, len(a.queues))
+	for id, q := range a.queues {
+		if len(q.waiters) == 0 {
+			continue
+		}
+		revs = append(revs, CheckpointRevision{
+			Namespace: id.namespace,
+			Name:      id.name,
+			Requests:  len(q.waiters),
+		})
+	}
+	return revs
+}
+
+// reserve queues a request for id, or returns nil if the queue is full.
+func (a *bufferingActivator) reserve(id revisionID) *waiter {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	q, ok := a.queues[id]
+	if !ok {
+		q = &waitQueue{}
+		a.queues[id] = q
+	}
+	if a.maxPending > 0 && len(q.waiters) >= a.maxPending {
+		if a.reporter != nil {
+			a.reporter.ReportShed(id.namespace, id.name)
+		}
+		return nil
+	}
+	w := &waiter{seq: q.arrivals, turn: make(chan struct{})}
+	q.arrivals++
+	q.waiters = append(q.waiters, w)
+	a.reportDepth(id)
+	return w
+}
+
+// wait holds w, whose activation returned, until it is released or ctx
+// is done.
+func (a *bufferingActivator) wait(ctx context.Context, id revisionID, w *waiter) {
+	a.mux.Lock()
+	w.done = true
+	a.releaseNext(id)
+	a.mux.Unlock()
+
+	select {
+	case <-w.turn:
+	case <-ctx.Done():
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	select {
+	case <-w.turn:
+		a.queues[id].releasing = false
+	default:
+		// The request gave up before its turn.
+		q := a.queues[id]
+		for i, other := range q.waiters {
+			if other == w {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				break
+			}
+		}
+		a.reportDepth(id)
+	}
+	a.releaseNext(id)
+}
+
+// releaseNext releases the next waiter for id in the queue order once
+// its activation returned, unless another one is still being released.
+// Requests share the activation in progress when they arrive, so in
+// FIFOQueueOrder the next waiter never holds the others back for longer
+// than their own activation. It is called with mux held.
+func (a *bufferingActivator) releaseNext(id revisionID) {
+	q := a.queues[id]
+	if q.releasing {
+		return
+	}
+	if len(q.waiters) == 0 {
+		delete(a.queues, id)
+		return
+	}
+	next := 0
+	if a.order == LIFOQueueOrder {
+		next = len(q.waiters) - 1
+	}
+	w := q.waiters[next]
+	if !w.done {
+		return
+	}
+	q.waiters = append(q.waiters[:next], q.waiters[next+1:]...)
+	q.releasing = true
+	a.reportDepth(id)
+	if a.onRelease != nil {
+		a.onRelease(w)
+	}
+	close(w.turn)
+}
+
+// observeLatency adds the time a request waited on the activation of id
+// to its average activation latency.
+func (a *bufferingActivator) observeLatency(id revisionID, latency time.Duration) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if avg, ok := a.latencies[id]; ok {
+		latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(avg))
+	}
+	a.latencies[id] = latency
+}
+
+// retryAfter returns how long requests to id turned away should wait
+// before retrying.
+func (a *bufferingActivator) retryAfter(id revisionID) time.Duration {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	switch latency := a.latencies[id]; {
+	case latency < minRetryAfter:
+		return minRetryAfter
+	case latency > maxRetryAfter:
+		return maxRetryAfter
+	default:
+		return latency
+	}
+}
+
+// reportDepth reports the requests held for id, with mux held.
+func (a *bufferingActivator) reportDepth(id revisionID) {
+	if a.reporter != nil {
+		a.reporter.ReportQueueDepth(id.namespace, id.name, len(a.queues[id].waiters))
+	}
+}
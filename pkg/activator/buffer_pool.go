@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http/httputil"
+	"sync"
+)
+
+var _ httputil.BufferPool = (*BufferPool)(nil)
+
+// BufferPool recycles the buffers proxied bodies are copied through, so
+// that every response does not allocate its own.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool creates a BufferPool of buffers of size bytes.
+func NewBufferPool(size int) *BufferPool {
+	return &BufferPool{size: size}
+}
+
+// Get implements httputil.BufferPool.
+func (p *BufferPool) Get() []byte {
+	if b, ok := p.pool.Get().(*[]byte); ok {
+		return *b
+	}
+	return make([]byte, p.size)
+}
+
+// Put implements httputil.BufferPool. Buffers smaller than the pool's
+// size are dropped.
+func (p *BufferPool) Put(b []byte) {
+	if cap(b) < p.size {
+		return
+	}
+	b = b[:p.size]
+	// Pointers are pooled so that putting a slice does not allocate.
+	p.pool.Put(&b)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool(1024)
+	b := p.Get()
+	if len(b) != 1024 {
+		t.Errorf("Unexpected buffer size. Want 1024. Got %v.", len(b))
+	}
+	p.Put(b[:10])
+	if got := p.Get(); len(got) != 1024 {
+		t.Errorf("Unexpected size of a recycled buffer. Want 1024. Got %v.", len(got))
+	}
+
+	// Too small buffers are not recycled.
+	p.Put(make([]byte, 10))
+	if got := p.Get(); len(got) != 1024 {
+		t.Errorf("Unexpected buffer size after putting a small one. Want 1024. Got %v.", len(got))
+	}
+}
+
+func TestProxy_BufferPool(t *testing.T) {
+	body := strings.Repeat("x", 10000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer s.Close()
+
+	proxy := NewProxy(serverEndpoint(t, s), http.DefaultTransport, TestLogger(t))
+	proxy.BufferPool = NewBufferPool(16)
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+		if got := resp.Body.String(); got != body {
+			t.Errorf("Unexpected body of %d bytes. Want %d bytes.", len(got), len(body))
+		}
+	}
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuffering_Overflow(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	id := revisionID{"default", "rev1"}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			id: activationResult{
+				endpoint: ep,
+				status:   Status(0),
+				err:      nil,
+			},
+		})
+	r := &fakeStatsReporter{}
+	b := NewBufferingActivator(f, 2, FIFOQueueOrder, r)
+	f.hold(id)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	_, status, err := b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+	if !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Unexpected error. Want %v. Got %v.", ErrBufferFull, err)
+	}
+	if e, ok := err.(*BufferFullError); !ok || e.RetryAfter != minRetryAfter {
+		t.Errorf("Unexpected retry after. Want %v. Got %v.", minRetryAfter, err)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, status)
+	}
+	if got := r.shedCount(); got != 1 {
+		t.Errorf("Unexpected shed count. Want 1. Got %v.", got)
+	}
+	got := b.(Checkpointer).PendingRevisions()
+	want := []CheckpointRevision{{Namespace: "default", Name: "rev1", Requests: 2}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected pending revisions. Want %+v. Got %+v.", want, got)
+	}
+
+	f.release(id)
+	wg.Wait()
+	endpoint, status, err := b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+	if err != nil {
+		t.Errorf("Unexpected error after activation: %v", err)
+	}
+	if endpoint != ep {
+		t.Errorf("Unexpected endpoint. Want %+v. Got %+v.", ep, endpoint)
+	}
+	if status != 0 {
+		t.Errorf("Unexpected status. Want 0. Got %v.", status)
+	}
+	if got := b.(Checkpointer).PendingRevisions(); len(got) != 0 {
+		t.Errorf("Unexpected pending revisions after activation. Got %+v.", got)
+	}
+}
+
+func TestBuffering_SetConfig(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	id := revisionID{"default", "rev1"}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			id: activationResult{ep, Status(0), nil},
+		})
+	b := NewBufferingActivator(f, 0, FIFOQueueOrder, nil)
+	f.hold(id)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+	}()
+	waitForPending(t, b.(*bufferingActivator), 1)
+
+	// The new limit applies to the requests arriving from then on.
+	b.(Reconfigurable).SetConfig(&Config{MaxPendingRequests: 1, ActivationQueueOrder: LIFOQueueOrder})
+	if _, _, err := b.ActiveEndpoint(context.TODO(), id.namespace, id.name); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Unexpected error with the lowered limit. Want %v. Got %v.", ErrBufferFull, err)
+	}
+	if got := b.(*bufferingActivator).order; got != LIFOQueueOrder {
+		t.Errorf("Unexpected queue order. Want %v. Got %v.", LIFOQueueOrder, got)
+	}
+
+	f.release(id)
+	wg.Wait()
+}
+
+func TestBuffering_PerRevision(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			revisionID{"default", "rev1"}: activationResult{ep, Status(0), nil},
+			revisionID{"default", "rev2"}: activationResult{ep, Status(0), nil},
+		})
+	b := NewBufferingActivator(f, 1, FIFOQueueOrder, nil)
+
+	got := concurrentTest(b, f, []revisionID{
+		revisionID{"default", "rev1"},
+		revisionID{"default", "rev2"},
+	})
+
+	want := []activationResult{
+		activationResult{ep, Status(0), nil},
+		activationResult{ep, Status(0), nil},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected results. Wanted %+v. Got %+v.", want, got)
+	}
+}
+
+func TestBuffering_Unbounded(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			revisionID{"default", "rev1"}: activationResult{ep, Status(0), nil},
+		})
+	b := NewBufferingActivator(f, 0, FIFOQueueOrder, nil)
+
+	ids := make([]revisionID, 10)
+	want := make([]activationResult, 10)
+	for i := range ids {
+		ids[i] = revisionID{"default", "rev1"}
+		want[i] = activationResult{ep, Status(0), nil}
+	}
+	got := concurrentTest(b, f, ids)
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected results. Wanted %+v. Got %+v.", want, got)
+	}
+}
+
+func TestBuffering_RetryAfter(t *testing.T) {
+	b := NewBufferingActivator(nil, 1, FIFOQueueOrder, nil).(*bufferingActivator)
+	id := revisionID{"default", "rev1"}
+
+	for _, test := range []struct {
+		latency time.Duration
+		want    time.Duration
+	}{{
+		latency: 5 * time.Second,
+		want:    5 * time.Second,
+	}, {
+		// The average moves towards the latest activations.
+		latency: 10 * time.Second,
+		want:    6 * time.Second,
+	}, {
+		latency: time.Hour,
+		want:    maxRetryAfter,
+	}} {
+		b.observeLatency(id, test.latency)
+		if got := b.retryAfter(id); got != test.want {
+			t.Errorf("Unexpected retry after observing %v. Want %v. Got %v.", test.latency, test.want, got)
+		}
+	}
+
+	other := revisionID{"default", "rev2"}
+	b.observeLatency(other, time.Millisecond)
+	if got := b.retryAfter(other); got != minRetryAfter {
+		t.Errorf("Unexpected retry after for a fast revision. Want %v. Got %v.", minRetryAfter, got)
+	}
+}
+
+func TestBuffering_ReportsQueueDepth(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	id := revisionID{"default", "rev1"}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			id: activationResult{ep, Status(0), nil},
+		})
+	r := &fakeStatsReporter{}
+	b := NewBufferingActivator(f, 0, FIFOQueueOrder, r)
+	f.hold(id)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	f.release(id)
+	wg.Wait()
+
+	want := []int{1, 2, 1, 0}
+	if got := r.queueDepths(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected queue depths. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestBuffering_ReleaseOrder(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	id := revisionID{"default", "rev1"}
+	tests := []struct {
+		name  string
+		order QueueOrder
+		want  []int
+	}{{
+		name:  "fifo",
+		order: FIFOQueueOrder,
+		want:  []int{0, 1, 2, 3, 4},
+	}, {
+		name:  "lifo",
+		order: LIFOQueueOrder,
+		want:  []int{4, 3, 2, 1, 0},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeActivator(t,
+				map[revisionID]activationResult{
+					id: activationResult{ep, Status(0), nil},
+				})
+			b := NewBufferingActivator(f, 0, test.order, nil).(*bufferingActivator)
+			var released []int
+			// Called with mux held.
+			b.onRelease = func(w *waiter) {
+				released = append(released, w.seq)
+			}
+			f.hold(id)
+
+			var wg sync.WaitGroup
+			for i := range test.want {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					b.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+				}()
+				// Each request arrives once the previous one is held.
+				waitForPending(t, b, i+1)
+			}
+			f.release(id)
+			wg.Wait()
+
+			if !reflect.DeepEqual(test.want, released) {
+				t.Errorf("Unexpected release order. Want %v. Got %v.", test.want, released)
+			}
+			if got := b.PendingRevisions(); len(got) != 0 {
+				t.Errorf("Unexpected pending revisions after release. Got %+v.", got)
+			}
+		})
+	}
+}
+
+func TestBuffering_GivesUpWaitingForTurn(t *testing.T) {
+	id := revisionID{"default", "rev1"}
+	a := &blockingActivator{
+		started:   make(chan struct{}, 1),
+		cancelled: make(chan struct{}),
+	}
+	b := NewBufferingActivator(a, 0, FIFOQueueOrder, nil).(*bufferingActivator)
+
+	headCtx, cancelHead := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		_, _, err := b.ActiveEndpoint(headCtx, id.namespace, id.name)
+		errCh <- err
+	}()
+	<-a.started
+
+	// A request behind the head of the queue, whose activation returned,
+	// waits for its turn until it gives up.
+	w := b.reserve(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.wait(ctx, id, w)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the request to give up.")
+	}
+	waitForPending(t, b, 1)
+
+	cancelHead()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Unexpected error. Want %v. Got %v.", context.Canceled, err)
+	}
+	if got := b.PendingRevisions(); len(got) != 0 {
+		t.Errorf("Unexpected pending revisions. Got %+v.", got)
+	}
+}
+
+// waitForPending waits until n requests to rev1 are held by b.
+func waitForPending(t *testing.T, b *bufferingActivator, n int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		pending := b.PendingRevisions()
+		if len(pending) == 1 && pending[0].Requests == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d pending requests. Got %+v.", n, pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeStatsReporter struct {
+	mux     sync.Mutex
+	depths  []int
+	shed    int
+	retries []bool
+}
+
+func (r *fakeStatsReporter) ReportRequest(namespace, revision string, responseCode int, queued, proxied time.Duration) error {
+	return nil
+}
+
+func (r *fakeStatsReporter) ReportQueueDepth(namespace, revision string, depth int) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.depths = append(r.depths, depth)
+	return nil
+}
+
+func (r *fakeStatsReporter) ReportShed(namespace, revision string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.shed++
+	return nil
+}
+
+func (r *fakeStatsReporter) ReportRetry(namespace, revision string, allowed bool, usage float64) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.retries = append(r.retries, allowed)
+	return nil
+}
+
+func (r *fakeStatsReporter) shedCount() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.shed
+}
+
+func (r *fakeStatsReporter) queueDepths() []int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]int(nil), r.depths...)
+}
+
+func (r *fakeStatsReporter) retriesReported() []bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]bool(nil), r.retries...)
+}
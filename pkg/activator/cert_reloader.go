@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CertReloader serves the TLS certificate held in a directory, such as
+// a mounted kubernetes.io/tls secret, reloading it whenever the
+// directory changes so that rotated certificates are picked up without
+// a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.SugaredLogger
+
+	mux  sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader creates a CertReloader for the certificate and key
+// stored under the tls.crt and tls.key files of dir, failing when they
+// cannot be loaded.
+func NewCertReloader(dir string, logger *zap.SugaredLogger) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: filepath.Join(dir, corev1.TLSCertKey),
+		keyFile:  filepath.Join(dir, corev1.TLSPrivateKeyKey),
+		logger:   logger,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+// GetCertificate returns the certificate last loaded, for use as the
+// function of the same name of a tls.Config.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
+
+// Run reloads the certificate whenever its directory changes, until
+// stopCh is closed. A certificate that fails to load, as when only one
+// of the files was updated yet, is logged and the previous one is kept.
+func (r *CertReloader) Run(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// Secret volumes are updated by swapping a symlink in the directory,
+	// which the files themselves link through.
+	if err := watcher.Add(filepath.Dir(r.certFile)); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-watcher.Events:
+			if err := r.reload(); err != nil {
+				r.logger.Errorf("Error reloading the serving certificate, keeping the previous one: %v", err)
+			} else {
+				r.logger.Debug("Reloaded the serving certificate")
+			}
+		case err := <-watcher.Errors:
+			r.logger.Errorf("Error watching the serving certificate: %v", err)
+		case <-stopCh:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// writeServingCert writes a self-signed certificate with the given
+// serial number and its key to dir.
+func writeServingCert(t *testing.T, dir string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: testServerName},
+		DNSNames:     []string{testServerName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() = %v", err)
+	}
+	writeFile(t, filepath.Join(dir, corev1.TLSPrivateKeyKey), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	writeFile(t, filepath.Join(dir, corev1.TLSCertKey), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// writeFile replaces the file at path at once, as secret volumes do.
+func writeFile(t *testing.T, path string, data []byte) {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Rename() = %v", err)
+	}
+}
+
+func servingSerial(t *testing.T, r *CertReloader) int64 {
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() = %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeServingCert(t, dir, 1)
+
+	r, err := NewCertReloader(dir, TestLogger(t))
+	if err != nil {
+		t.Fatalf("NewCertReloader() = %v", err)
+	}
+	if got := servingSerial(t, r); got != 1 {
+		t.Errorf("Unexpected serial of the initial certificate. Want 1. Got %v.", got)
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- r.Run(stopCh)
+	}()
+	// Give the watcher a moment to be set up.
+	time.Sleep(100 * time.Millisecond)
+
+	// A certificate that does not match its key yet is not served.
+	writeFile(t, filepath.Join(dir, corev1.TLSCertKey), []byte("garbage"))
+	time.Sleep(100 * time.Millisecond)
+	if got := servingSerial(t, r); got != 1 {
+		t.Errorf("Unexpected serial after a broken update. Want 1. Got %v.", got)
+	}
+
+	writeServingCert(t, dir, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for servingSerial(t, r) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the rotated certificate to be served.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stopCh)
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+}
+
+func TestNewCertReloader_Missing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewCertReloader(dir, TestLogger(t)); err == nil {
+		t.Error("Expected an error loading a missing certificate.")
+	}
+}
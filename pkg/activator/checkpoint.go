@@ -0,0 +1,196 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/knative/serving/pkg/leaderelection"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// CheckpointConfigMapName is the ConfigMap activators hand off their
+	// pending activations through.
+	CheckpointConfigMapName = "activator-checkpoint"
+
+	// checkpointKeyPrefix prefixes the key of the checkpoint of each
+	// activator, so that replicas shutting down together do not overwrite
+	// each other's checkpoints.
+	checkpointKeyPrefix = "checkpoint-"
+
+	// checkpointRetention is how long checkpoints are kept around. They
+	// are only resumed for a much shorter while.
+	checkpointRetention = time.Hour
+)
+
+// CheckpointRevision is a revision with requests waiting on its activation.
+type CheckpointRevision struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Requests  int    `json:"requests"`
+}
+
+// Checkpoint records the activations that were pending when an activator
+// shut down, so that another replica can resume them before the
+// redirected requests arrive.
+type Checkpoint struct {
+	// Writer identifies the activator that wrote the checkpoint.
+	Writer    string               `json:"writer"`
+	Time      time.Time            `json:"time"`
+	Revisions []CheckpointRevision `json:"revisions"`
+}
+
+// Checkpointer is implemented by Activators that can report the
+// activations they have pending.
+type Checkpointer interface {
+	PendingRevisions() []CheckpointRevision
+}
+
+// CheckpointStore persists checkpoints in a ConfigMap.
+type CheckpointStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+}
+
+// NewCheckpointStore creates a CheckpointStore backed by the named
+// ConfigMap, which is created on first save.
+func NewCheckpointStore(kubeClient kubernetes.Interface, namespace, name string) *CheckpointStore {
+	return &CheckpointStore{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+	}
+}
+
+// Save writes the checkpoint, replacing any previous one of its writer.
+func (s *CheckpointStore) Save(cp Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	key := checkpointKeyPrefix + cp.Writer
+
+	// Other replicas may be saving theirs at the same time, so start over
+	// from a fresh copy when an update conflicts with theirs.
+	configMaps := s.kubeClient.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(s.name, metav1.GetOptions{})
+		if apierrs.IsNotFound(err) {
+			_, err = configMaps.Create(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Data: map[string]string{key: string(b)},
+			})
+			if apierrs.IsAlreadyExists(err) {
+				// Another replica created it first, so update theirs.
+				return apierrs.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		// Drop old checkpoints so that the ConfigMap does not grow forever.
+		for k, raw := range cm.Data {
+			if old, err := parseCheckpoint(raw); err != nil || time.Since(old.Time) > checkpointRetention {
+				delete(cm.Data, k)
+			}
+		}
+		cm.Data[key] = string(b)
+		_, err = configMaps.Update(cm)
+		return err
+	})
+}
+
+// Watch calls onCheckpoint with every checkpoint written to the store
+// until stopCh is closed. It returns whether the checkpoint present when
+// watching started was seen.
+func (s *CheckpointStore) Watch(stopCh <-chan struct{}, logger *zap.SugaredLogger, onCheckpoint func(Checkpoint)) cache.InformerSynced {
+	sif := kubeinformers.NewFilteredSharedInformerFactory(s.kubeClient, 5*time.Minute, s.namespace,
+		func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fmt.Sprintf("metadata.name=%s", s.name)
+		})
+	// Only the checkpoints that changed are passed on, as every save
+	// updates the ConfigMap holding all of them.
+	handle := func(oldObj, obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		old, _ := oldObj.(*corev1.ConfigMap)
+		for key, raw := range cm.Data {
+			if !strings.HasPrefix(key, checkpointKeyPrefix) || (old != nil && old.Data[key] == raw) {
+				continue
+			}
+			cp, err := parseCheckpoint(raw)
+			if err != nil {
+				logger.Errorf("Ignoring invalid activator checkpoint %s: %v", key, err)
+				continue
+			}
+			onCheckpoint(cp)
+		}
+	}
+	informer := sif.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { handle(nil, obj) },
+		UpdateFunc: handle,
+	})
+	sif.Start(stopCh)
+	return informer.HasSynced
+}
+
+func parseCheckpoint(raw string) (Checkpoint, error) {
+	var cp Checkpoint
+	err := json.Unmarshal([]byte(raw), &cp)
+	return cp, err
+}
+
+// ResumeCheckpoint starts activating the revisions in cp, unless cp was
+// written by self or is older than maxAge. The activations run in the
+// background so that the redirected requests can join them. When probes
+// are sharded into buckets, only the revisions in the buckets owned by
+// this replica are resumed, since the other replicas wait on their owner
+// to probe them.
+func ResumeCheckpoint(a Activator, cp Checkpoint, self string, maxAge time.Duration, buckets *leaderelection.Buckets, logger *zap.SugaredLogger) {
+	if cp.Writer == self || time.Since(cp.Time) > maxAge {
+		return
+	}
+	for _, rev := range cp.Revisions {
+		if buckets != nil && !buckets.Owns(rev.Namespace, rev.Name) {
+			continue
+		}
+		logger.Infof("Resuming activation of %s/%s handed off by %s with %d waiting requests",
+			rev.Namespace, rev.Name, cp.Writer, rev.Requests)
+		go a.ActiveEndpoint(context.Background(), rev.Namespace, rev.Name)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/leaderelection"
+	. "github.com/knative/serving/pkg/logging/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckpointStore_SaveAndWatch(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewCheckpointStore(kubeClient, "knative-serving", CheckpointConfigMapName)
+
+	first := Checkpoint{
+		Writer:    "activator-1",
+		Time:      time.Now().UTC().Truncate(time.Second),
+		Revisions: []CheckpointRevision{{Namespace: "default", Name: "rev1", Requests: 3}},
+	}
+	if err := store.Save(first); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	second := first
+	second.Revisions = []CheckpointRevision{{Namespace: "default", Name: "rev2", Requests: 1}}
+	if err := store.Save(second); err != nil {
+		t.Fatalf("Save() on existing ConfigMap = %v", err)
+	}
+
+	other := Checkpoint{
+		Writer:    "activator-2",
+		Time:      first.Time,
+		Revisions: []CheckpointRevision{{Namespace: "default", Name: "rev3", Requests: 2}},
+	}
+	if err := store.Save(other); err != nil {
+		t.Fatalf("Save() by another replica = %v", err)
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(CheckpointConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get checkpoint ConfigMap: %v", err)
+	}
+	want := map[string]Checkpoint{"activator-1": second, "activator-2": other}
+	if got, want := len(cm.Data), len(want); got != want {
+		t.Errorf("Unexpected number of checkpoints. Want %v. Got %v.", want, got)
+	}
+	for writer, cp := range want {
+		got, err := parseCheckpoint(cm.Data[checkpointKeyPrefix+writer])
+		if err != nil {
+			t.Fatalf("parseCheckpoint() = %v", err)
+		}
+		if !reflect.DeepEqual(cp, got) {
+			t.Errorf("Unexpected checkpoint of %s. Want %+v. Got %+v.", writer, cp, got)
+		}
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watched := make(chan Checkpoint, len(want))
+	store.Watch(stopCh, TestLogger(t), func(cp Checkpoint) {
+		watched <- cp
+	})
+	for range want {
+		select {
+		case cp := <-watched:
+			if !reflect.DeepEqual(want[cp.Writer], cp) {
+				t.Errorf("Unexpected watched checkpoint. Want %+v. Got %+v.", want[cp.Writer], cp)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for checkpoint from Watch.")
+		}
+	}
+}
+
+func TestCheckpointStore_DropsOldCheckpoints(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewCheckpointStore(kubeClient, "knative-serving", CheckpointConfigMapName)
+
+	old := Checkpoint{Writer: "activator-1", Time: time.Now().Add(-2 * checkpointRetention)}
+	if err := store.Save(old); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	if err := store.Save(Checkpoint{Writer: "activator-2", Time: time.Now()}); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(CheckpointConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get checkpoint ConfigMap: %v", err)
+	}
+	if _, ok := cm.Data[checkpointKeyPrefix+"activator-1"]; ok {
+		t.Errorf("Old checkpoint was kept: %v", cm.Data)
+	}
+	if _, ok := cm.Data[checkpointKeyPrefix+"activator-2"]; !ok {
+		t.Errorf("New checkpoint is missing: %v", cm.Data)
+	}
+}
+
+func TestResumeCheckpoint(t *testing.T) {
+	id := revisionID{"default", "rev1"}
+	cp := Checkpoint{
+		Writer:    "activator-1",
+		Time:      time.Now(),
+		Revisions: []CheckpointRevision{{Namespace: id.namespace, Name: id.name, Requests: 1}},
+	}
+
+	owner := NewProbeBuckets(fakeK8s.NewSimpleClientset(), "knative-serving", "activator-2", 4, time.Minute)
+	owner.Sync(TestLogger(t))
+
+	tests := []struct {
+		name    string
+		self    string
+		age     time.Duration
+		buckets *leaderelection.Buckets
+		resume  bool
+	}{{
+		name:   "from another replica",
+		self:   "activator-2",
+		resume: true,
+	}, {
+		name: "own checkpoint",
+		self: "activator-1",
+	}, {
+		name: "stale checkpoint",
+		self: "activator-2",
+		age:  time.Hour,
+	}, {
+		name:    "owned by this replica",
+		self:    "activator-2",
+		buckets: owner,
+		resume:  true,
+	}, {
+		name:    "owned by another replica",
+		self:    "activator-3",
+		buckets: NewProbeBuckets(fakeK8s.NewSimpleClientset(), "knative-serving", "activator-3", 4, time.Minute),
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeActivator(t, map[revisionID]activationResult{
+				id: activationResult{endpoint: Endpoint{FQDN: "ip", Port: 8080}},
+			})
+			cp := cp
+			cp.Time = cp.Time.Add(-test.age)
+			ResumeCheckpoint(f, cp, test.self, time.Minute, test.buckets, TestLogger(t))
+			time.Sleep(100 * time.Millisecond)
+
+			f.recordMutex.Lock()
+			defer f.recordMutex.Unlock()
+			if got := len(f.record) == 1; got != test.resume {
+				t.Errorf("Resumed = %v, want %v", got, test.resume)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests turned away without being sent
+// because their revision kept failing recently.
+var ErrCircuitOpen = errors.New("revision is failing, circuit breaker open")
+
+// circuitIdleTimeout is how long the circuit of a revision no request
+// was sent to is kept, at least. Revisions scaled away or deleted would
+// keep theirs forever otherwise.
+const circuitIdleTimeout = 10 * time.Minute
+
+type circuit struct {
+	failures int
+	openedAt time.Time
+	// trial is set while a request is testing whether an open circuit
+	// can be closed again.
+	trial bool
+	// lastUsed is when a request to the revision was last seen.
+	lastUsed time.Time
+}
+
+var _ http.RoundTripper = (*circuitBreakerRoundTripper)(nil)
+
+type circuitBreakerRoundTripper struct {
+	transport http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+	// idleTimeout is how long circuits are kept without requests.
+	idleTimeout time.Duration
+	now         func() time.Time // for testing
+
+	mux       sync.Mutex
+	circuits  map[revisionID]*circuit
+	lastSweep time.Time
+}
+
+// NewCircuitBreakerRoundTripper wraps transport so that, after threshold
+// consecutive failures sending requests to a revision, further requests
+// to it fail with ErrCircuitOpen for cooldown. Then a single trial
+// request is let through at a time, until one succeeds and closes the
+// circuit. Failures are errors and 5xx responses. The revision of a
+// request is the one its context names with WithRevision, and requests
+// naming none are sent as they are. A threshold of zero or less disables
+// the breaker.
+func NewCircuitBreakerRoundTripper(transport http.RoundTripper, threshold int, cooldown time.Duration) http.RoundTripper {
+	if threshold <= 0 {
+		return transport
+	}
+	idleTimeout := circuitIdleTimeout
+	if cooldown > idleTimeout {
+		idleTimeout = cooldown
+	}
+	return &circuitBreakerRoundTripper{
+		transport:   transport,
+		threshold:   threshold,
+		cooldown:    cooldown,
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+		circuits:    make(map[revisionID]*circuit),
+	}
+}
+
+func (cb *circuitBreakerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rev, ok := revisionFrom(r.Context())
+	if !ok {
+		return cb.transport.RoundTrip(r)
+	}
+	trial, ok := cb.allow(rev)
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := cb.transport.RoundTrip(r)
+	switch {
+	case r.Context().Err() == context.Canceled:
+		// The client went away, which says nothing about the revision.
+		cb.abandon(rev, trial)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		cb.failure(rev, trial)
+	default:
+		cb.success(rev)
+	}
+	return resp, err
+}
+
+// allow reports whether a request to rev may be sent, and whether it is
+// the trial request of an open circuit.
+func (cb *circuitBreakerRoundTripper) allow(rev revisionID) (trial bool, ok bool) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	now := cb.now()
+	cb.sweepLocked(now)
+	c, found := cb.circuits[rev]
+	if found {
+		c.lastUsed = now
+	}
+	if !found || c.failures < cb.threshold {
+		return false, true
+	}
+	if c.trial || now.Sub(c.openedAt) < cb.cooldown {
+		return false, false
+	}
+	c.trial = true
+	return true, true
+}
+
+// sweepLocked drops the circuits of revisions no request was sent to for
+// idleTimeout. It only looks for them once in a while.
+func (cb *circuitBreakerRoundTripper) sweepLocked(now time.Time) {
+	if now.Sub(cb.lastSweep) < cb.idleTimeout {
+		return
+	}
+	cb.lastSweep = now
+	for rev, c := range cb.circuits {
+		if !c.trial && now.Sub(c.lastUsed) >= cb.idleTimeout {
+			delete(cb.circuits, rev)
+		}
+	}
+}
+
+func (cb *circuitBreakerRoundTripper) failure(rev revisionID, trial bool) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	c, found := cb.circuits[rev]
+	if !found {
+		c = &circuit{}
+		cb.circuits[rev] = c
+	}
+	c.lastUsed = cb.now()
+	if trial {
+		c.trial = false
+		c.openedAt = cb.now()
+		return
+	}
+	c.failures++
+	if c.failures == cb.threshold {
+		c.openedAt = cb.now()
+	}
+}
+
+func (cb *circuitBreakerRoundTripper) success(rev revisionID) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	delete(cb.circuits, rev)
+}
+
+func (cb *circuitBreakerRoundTripper) abandon(rev revisionID, trial bool) {
+	if !trial {
+		return
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if c, found := cb.circuits[rev]; found {
+		c.trial = false
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+type fakeRoundTripper struct {
+	status int
+	err    error
+	calls  int
+}
+
+func (f *fakeRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: f.status, Body: http.NoBody}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	upstream := &fakeRoundTripper{status: http.StatusBadGateway}
+	cb := NewCircuitBreakerRoundTripper(upstream, 2, 10*time.Second).(*circuitBreakerRoundTripper)
+	cb.now = func() time.Time { return now }
+	send := func(name string) error {
+		req := httptest.NewRequest("GET", "http://10.0.0.1/", nil)
+		_, err := cb.RoundTrip(req.WithContext(WithRevision(req.Context(), testNamespace, name)))
+		return err
+	}
+
+	// Two failures open the circuit.
+	for i := 0; i < 2; i++ {
+		if err := send("rev1"); err != nil {
+			t.Fatalf("Unexpected error before the circuit opened: %v", err)
+		}
+	}
+	if err := send("rev1"); err != ErrCircuitOpen {
+		t.Errorf("Unexpected error. Want %v. Got %v.", ErrCircuitOpen, err)
+	}
+	if upstream.calls != 2 {
+		t.Errorf("Unexpected upstream calls. Want 2. Got %v.", upstream.calls)
+	}
+	// Other revisions are unaffected.
+	upstream.status = http.StatusOK
+	if err := send("rev2"); err != nil {
+		t.Errorf("Unexpected error for another revision: %v", err)
+	}
+
+	// After the cooldown, a failed trial opens the circuit again.
+	upstream.status = http.StatusServiceUnavailable
+	now = now.Add(10 * time.Second)
+	if err := send("rev1"); err != nil {
+		t.Errorf("Unexpected error for the trial request: %v", err)
+	}
+	if err := send("rev1"); err != ErrCircuitOpen {
+		t.Errorf("Unexpected error after a failed trial. Want %v. Got %v.", ErrCircuitOpen, err)
+	}
+
+	// A successful trial closes it.
+	upstream.status = http.StatusOK
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if err := send("rev1"); err != nil {
+			t.Errorf("Unexpected error after a successful trial: %v", err)
+		}
+	}
+}
+
+func TestCircuitBreaker_SingleTrial(t *testing.T) {
+	now := time.Now()
+	upstream := &fakeRoundTripper{err: errors.New("connection refused")}
+	cb := NewCircuitBreakerRoundTripper(upstream, 1, time.Second).(*circuitBreakerRoundTripper)
+	cb.now = func() time.Time { return now }
+	req := httptest.NewRequest("GET", "http://rev1/", nil)
+	rev := revisionID{namespace: testNamespace, name: "rev1"}
+
+	cb.RoundTrip(req.WithContext(WithRevision(req.Context(), rev.namespace, rev.name)))
+	now = now.Add(time.Second)
+	if trial, ok := cb.allow(rev); !trial || !ok {
+		t.Errorf("Unexpected allow() for the trial. Want true, true. Got %v, %v.", trial, ok)
+	}
+	if trial, ok := cb.allow(rev); trial || ok {
+		t.Errorf("Unexpected allow() while a trial is in flight. Want false, false. Got %v, %v.", trial, ok)
+	}
+}
+
+func TestCircuitBreaker_EvictsIdle(t *testing.T) {
+	now := time.Now()
+	upstream := &fakeRoundTripper{status: http.StatusBadGateway}
+	cb := NewCircuitBreakerRoundTripper(upstream, 2, time.Second).(*circuitBreakerRoundTripper)
+	cb.now = func() time.Time { return now }
+	req := httptest.NewRequest("GET", "http://rev1/", nil)
+	cb.RoundTrip(req.WithContext(WithRevision(req.Context(), testNamespace, "rev1")))
+	if got := len(cb.circuits); got != 1 {
+		t.Fatalf("Unexpected number of circuits after a failure. Want 1. Got %v.", got)
+	}
+
+	now = now.Add(circuitIdleTimeout)
+	cb.allow(revisionID{namespace: testNamespace, name: "rev2"})
+	if got := len(cb.circuits); got != 0 {
+		t.Errorf("Unexpected number of circuits after the idle timeout. Want 0. Got %v.", got)
+	}
+}
+
+func TestCircuitBreaker_NoRevision(t *testing.T) {
+	upstream := &fakeRoundTripper{status: http.StatusBadGateway}
+	cb := NewCircuitBreakerRoundTripper(upstream, 1, time.Minute).(*circuitBreakerRoundTripper)
+	for i := 0; i < 2; i++ {
+		if _, err := cb.RoundTrip(httptest.NewRequest("GET", "http://rev1/", nil)); err != nil {
+			t.Errorf("Unexpected error for a request naming no revision: %v", err)
+		}
+	}
+	if got := len(cb.circuits); got != 0 {
+		t.Errorf("Unexpected number of circuits. Want 0. Got %v.", got)
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	upstream := &fakeRoundTripper{}
+	if got := NewCircuitBreakerRoundTripper(upstream, 0, time.Second); got != upstream {
+		t.Errorf("Unexpected round tripper for a disabled breaker. Want the transport. Got %v.", got)
+	}
+}
+
+func TestProxy_CircuitOpen(t *testing.T) {
+	proxy := NewProxy(Endpoint{FQDN: "rev1", Port: 8080}, &fakeRoundTripper{err: ErrCircuitOpen}, TestLogger(t))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+	}
+}
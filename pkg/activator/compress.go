@@ -0,0 +1,216 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GzipCompression compresses responses with gzip.
+const GzipCompression = "gzip"
+
+// DefaultCompressionContentTypes are the media types compressed when no
+// others are configured.
+var DefaultCompressionContentTypes = []string{
+	"text/*",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// CompressResponses returns a Middleware compressing the responses of
+// requests accepting gzip, when they are at least minSize bytes long,
+// have one of contentTypes and were not already compressed by the
+// revision. Content types ending in "/*" match every subtype. Streamed
+// responses are never compressed, so that they are not held back.
+func CompressResponses(minSize int, contentTypes []string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" ||
+				!acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				minSize:        minSize,
+				contentTypes:   contentTypes,
+			}
+			defer cw.close()
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, q := part, ""
+		if i := strings.Index(part, ";"); i >= 0 {
+			coding, q = part[:i], strings.TrimSpace(part[i+1:])
+		}
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if strings.HasPrefix(q, "q=") {
+			if v, err := strconv.ParseFloat(q[len("q="):], 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the start of the response until it knows
+// whether to compress it: once minSize bytes were written, or when the
+// response is flushed or ends first.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize      int
+	contentTypes []string
+
+	code    int
+	decided bool
+	buf     []byte
+	gz      *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+	if !w.compressible() {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher. Responses flushed before minSize bytes
+// were written are not compressed.
+func (w *compressWriter) Flush() {
+	if w.code != 0 && !w.decided {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressible reports whether the response could be compressed going
+// by its status and header.
+func (w *compressWriter) compressible() bool {
+	switch {
+	case w.code < http.StatusOK, w.code == http.StatusNoContent,
+		w.code == http.StatusPartialContent, w.code == http.StatusNotModified:
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || IsStreaming(h) || !w.allowedType(h.Get("Content-Type")) {
+		return false
+	}
+	// Caches must tell apart the responses of clients accepting gzip,
+	// whether or not this one ends up compressed.
+	h.Add("Vary", "Accept-Encoding")
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < w.minSize {
+		return false
+	}
+	return true
+}
+
+func (w *compressWriter) allowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range w.contentTypes {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// start writes the header and the body held back so far, compressed or
+// not.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", GzipCompression)
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) close() {
+	if w.code != 0 && !w.decided {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"gzip":                true,
+		"deflate, gzip;q=0.8": true,
+		"GZIP":                true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"deflate, br":         false,
+		"identity":            false,
+		"":                    false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("Unexpected acceptsGzip(%q). Want %v. Got %v.", header, want, got)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	long := strings.Repeat("knative ", 200)
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		contentType    string
+		encoding       string
+		code           int
+		body           string
+		wantCompressed bool
+	}{{
+		name:           "compressed",
+		acceptEncoding: "gzip",
+		contentType:    "text/html; charset=utf-8",
+		body:           long,
+		wantCompressed: true,
+	}, {
+		name:           "wildcard content type",
+		acceptEncoding: "gzip",
+		contentType:    "text/plain",
+		body:           long,
+		wantCompressed: true,
+	}, {
+		name:           "not accepted",
+		acceptEncoding: "br",
+		contentType:    "text/html",
+		body:           long,
+	}, {
+		name:           "below the threshold",
+		acceptEncoding: "gzip",
+		contentType:    "text/html",
+		body:           "short",
+	}, {
+		name:           "content type not allowed",
+		acceptEncoding: "gzip",
+		contentType:    "image/png",
+		body:           long,
+	}, {
+		name:           "already compressed",
+		acceptEncoding: "gzip",
+		contentType:    "text/html",
+		encoding:       "br",
+		body:           long,
+	}, {
+		name:           "streamed",
+		acceptEncoding: "gzip",
+		contentType:    "text/event-stream",
+		body:           long,
+	}, {
+		name:           "partial content",
+		acceptEncoding: "gzip",
+		contentType:    "text/html",
+		code:           http.StatusPartialContent,
+		body:           long,
+	}, {
+		name:           "head",
+		method:         http.MethodHead,
+		acceptEncoding: "gzip",
+		contentType:    "text/html",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := CompressResponses(1024, DefaultCompressionContentTypes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				if test.encoding != "" {
+					w.Header().Set("Content-Encoding", test.encoding)
+				}
+				if test.code != 0 {
+					w.WriteHeader(test.code)
+				}
+				// The body is written in pieces, so that the threshold is
+				// only reached across writes.
+				for i := 0; i < len(test.body); i += 100 {
+					end := i + 100
+					if end > len(test.body) {
+						end = len(test.body)
+					}
+					w.Write([]byte(test.body[i:end]))
+				}
+			}))
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://example.com/", nil)
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			wantCode := test.code
+			if wantCode == 0 {
+				wantCode = http.StatusOK
+			}
+			if rec.Code != wantCode {
+				t.Errorf("Unexpected response code. Want %v. Got %v.", wantCode, rec.Code)
+			}
+			compressed := rec.Header().Get("Content-Encoding") == "gzip"
+			if compressed != test.wantCompressed {
+				t.Fatalf("Unexpected compression. Want %v. Got %v.", test.wantCompressed, compressed)
+			}
+			body := rec.Body.String()
+			if compressed {
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() = %v", err)
+				}
+				b, err := ioutil.ReadAll(gz)
+				if err != nil {
+					t.Fatalf("Error decompressing the body: %v", err)
+				}
+				body = string(b)
+			}
+			if body != test.body {
+				t.Errorf("Unexpected body. Want %d bytes. Got %d.", len(test.body), len(body))
+			}
+		})
+	}
+}
+
+func TestCompressResponses_FlushedEarly(t *testing.T) {
+	h := CompressResponses(1024, DefaultCompressionContentTypes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Waiting..."))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("done ", 500)))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if !rec.Flushed {
+		t.Error("Expected the response to be flushed.")
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Unexpected Content-Encoding of a response flushed before the threshold. Want none. Got %q.", got)
+	}
+	if got, want := rec.Body.Len(), len("Waiting...")+5*500; got != want {
+		t.Errorf("Unexpected body length. Want %d. Got %d.", want, got)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"time"
+
+	"github.com/knative/serving/pkg/autoscaler"
+	"github.com/knative/serving/pkg/queue"
+)
+
+// ReqEvent records a request for the revision identified by Key, in the
+// form "namespace/name", arriving at or leaving the activator, or done
+// waiting for the revision to have an active endpoint.
+type ReqEvent struct {
+	Key       string
+	EventType queue.ReqEvent
+}
+
+// Channels holds the channels driving a ConcurrencyReporter.
+type Channels struct {
+	// ReqChan receives every request arriving, dequeued and completing.
+	ReqChan chan ReqEvent
+	// ReportChan ticks at the end of every reporting period.
+	ReportChan <-chan time.Time
+	// StatChan receives the stats of every revision with requests in
+	// the period just ended.
+	StatChan chan *autoscaler.StatMessage
+}
+
+// ConcurrencyReporter aggregates the requests the activator handles per
+// revision and reports them to the autoscaler, so that revisions scaled
+// to zero are scaled up according to the requests waiting on them.
+type ConcurrencyReporter struct {
+	podName string
+	ch      Channels
+}
+
+// NewConcurrencyReporter creates a ConcurrencyReporter reporting its
+// stats on behalf of podName.
+func NewConcurrencyReporter(podName string, channels Channels) *ConcurrencyReporter {
+	return &ConcurrencyReporter{
+		podName: podName,
+		ch:      channels,
+	}
+}
+
+// Run aggregates requests until stopCh is closed. Each period, the
+// concurrency reported for a revision is the most requests it had in
+// flight at once, so that requests shorter than the period are still
+// accounted for, and likewise for the requests pending on its activation,
+// from their arrival until they are dequeued. Stats are dropped rather
+// than holding up requests when StatChan is full.
+func (cr *ConcurrencyReporter) Run(stopCh <-chan struct{}) {
+	// The requests in flight, the most in flight during the period, the
+	// requests received during the period, the requests pending and the
+	// most pending during the period, per revision.
+	concurrency := make(map[string]int32)
+	maxConcurrency := make(map[string]int32)
+	requestCount := make(map[string]int32)
+	pending := make(map[string]int32)
+	maxPending := make(map[string]int32)
+	for {
+		select {
+		case event := <-cr.ch.ReqChan:
+			switch event.EventType {
+			case queue.ReqIn:
+				requestCount[event.Key]++
+				concurrency[event.Key]++
+				if concurrency[event.Key] > maxConcurrency[event.Key] {
+					maxConcurrency[event.Key] = concurrency[event.Key]
+				}
+				pending[event.Key]++
+				if pending[event.Key] > maxPending[event.Key] {
+					maxPending[event.Key] = pending[event.Key]
+				}
+			case queue.ReqDequeued:
+				pending[event.Key]--
+			case queue.ReqOut:
+				concurrency[event.Key]--
+				// Requests pending are among those in flight.
+				if pending[event.Key] > concurrency[event.Key] {
+					pending[event.Key] = concurrency[event.Key]
+				}
+			}
+		case now := <-cr.ch.ReportChan:
+			for key, max := range maxConcurrency {
+				now := now
+				sm := &autoscaler.StatMessage{
+					RevisionKey: key,
+					Stat: autoscaler.Stat{
+						Time:                      &now,
+						PodName:                   cr.podName,
+						AverageConcurrentRequests: float64(max),
+						RequestCount:              requestCount[key],
+						PendingRequests:           maxPending[key],
+					},
+				}
+				select {
+				case cr.ch.StatChan <- sm:
+				default:
+				}
+			}
+			// Revisions with requests still in flight are reported
+			// again next period.
+			maxConcurrency = make(map[string]int32)
+			requestCount = make(map[string]int32)
+			maxPending = make(map[string]int32)
+			for key, c := range concurrency {
+				if c == 0 {
+					delete(concurrency, key)
+				} else {
+					maxConcurrency[key] = c
+				}
+			}
+			for key, p := range pending {
+				if p == 0 {
+					delete(pending, key)
+				} else {
+					maxPending[key] = p
+				}
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/autoscaler"
+	"github.com/knative/serving/pkg/queue"
+)
+
+const (
+	testPodName = "activator-pod"
+	testKey1    = "test-namespace/test-revision-1"
+	testKey2    = "test-namespace/test-revision-2"
+)
+
+func TestConcurrencyReporter(t *testing.T) {
+	reqChan := make(chan ReqEvent)
+	reportChan := make(chan time.Time)
+	statChan := make(chan *autoscaler.StatMessage, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	cr := NewConcurrencyReporter(testPodName, Channels{
+		ReqChan:    reqChan,
+		ReportChan: reportChan,
+		StatChan:   statChan,
+	})
+	go cr.Run(stopCh)
+
+	now := time.Now()
+	report := func() []autoscaler.StatMessage {
+		reportChan <- now
+		// Run sends the period's stats before receiving another event,
+		// which it ignores as it is none of the request events.
+		reqChan <- ReqEvent{EventType: -1}
+		var got []autoscaler.StatMessage
+		for len(statChan) > 0 {
+			got = append(got, *<-statChan)
+		}
+		return got
+	}
+	stat := func(key string, concurrency float64, count, pending int32) autoscaler.StatMessage {
+		return autoscaler.StatMessage{
+			RevisionKey: key,
+			Stat: autoscaler.Stat{
+				Time:                      &now,
+				PodName:                   testPodName,
+				AverageConcurrentRequests: concurrency,
+				RequestCount:              count,
+				PendingRequests:           pending,
+			},
+		}
+	}
+	sortByKey := cmp.Transformer("sort", func(in []autoscaler.StatMessage) map[string]autoscaler.StatMessage {
+		m := make(map[string]autoscaler.StatMessage)
+		for _, sm := range in {
+			m[sm.RevisionKey] = sm
+		}
+		return m
+	})
+
+	if got := report(); len(got) != 0 {
+		t.Errorf("Unexpected stats without requests. Want none. Got %v.", got)
+	}
+
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqIn}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqDequeued}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqIn}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqDequeued}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}
+	reqChan <- ReqEvent{Key: testKey2, EventType: queue.ReqIn}
+	reqChan <- ReqEvent{Key: testKey2, EventType: queue.ReqDequeued}
+	reqChan <- ReqEvent{Key: testKey2, EventType: queue.ReqOut}
+	want := []autoscaler.StatMessage{
+		stat(testKey1, 2, 2, 1),
+		stat(testKey2, 1, 1, 1),
+	}
+	if got := report(); !cmp.Equal(want, got, sortByKey) {
+		t.Errorf("Unexpected stats. Want %v. Got %v.", want, got)
+	}
+
+	// The request still in flight is reported until it completes.
+	want = []autoscaler.StatMessage{stat(testKey1, 1, 0, 0)}
+	if got := report(); !cmp.Equal(want, got) {
+		t.Errorf("Unexpected stats. Want %v. Got %v.", want, got)
+	}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}
+	if got := report(); !cmp.Equal(want, got) {
+		t.Errorf("Unexpected stats. Want %v. Got %v.", want, got)
+	}
+	if got := report(); len(got) != 0 {
+		t.Errorf("Unexpected stats after requests completed. Want none. Got %v.", got)
+	}
+}
+
+func TestConcurrencyReporter_PendingRequests(t *testing.T) {
+	reqChan := make(chan ReqEvent)
+	reportChan := make(chan time.Time)
+	statChan := make(chan *autoscaler.StatMessage, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	cr := NewConcurrencyReporter(testPodName, Channels{
+		ReqChan:    reqChan,
+		ReportChan: reportChan,
+		StatChan:   statChan,
+	})
+	go cr.Run(stopCh)
+
+	report := func() int32 {
+		t.Helper()
+		reportChan <- time.Now()
+		reqChan <- ReqEvent{EventType: -1}
+		if len(statChan) != 1 {
+			t.Fatalf("Got %d stats, want 1", len(statChan))
+		}
+		return (<-statChan).Stat.PendingRequests
+	}
+
+	// Requests are pending on the activation of their revision until
+	// dequeued, and reported as such in the periods they span.
+	for i := 0; i < 3; i++ {
+		reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqIn}
+	}
+	if got := report(); got != 3 {
+		t.Errorf("PendingRequests = %d, want 3", got)
+	}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqDequeued}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqDequeued}
+	if got := report(); got != 3 {
+		t.Errorf("PendingRequests = %d, want the 3 pending at the start of the period", got)
+	}
+	if got := report(); got != 1 {
+		t.Errorf("PendingRequests = %d, want 1", got)
+	}
+
+	// Requests completing without being dequeued are no longer pending.
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}
+	if got := report(); got != 1 {
+		t.Errorf("PendingRequests = %d, want the 1 pending at the start of the period", got)
+	}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqIn}
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqDequeued}
+	if got := report(); got != 1 {
+		t.Errorf("PendingRequests = %d, want 1", got)
+	}
+}
+
+func TestConcurrencyReporter_DropsStatsWhenFull(t *testing.T) {
+	reqChan := make(chan ReqEvent)
+	reportChan := make(chan time.Time)
+	statChan := make(chan *autoscaler.StatMessage)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	cr := NewConcurrencyReporter(testPodName, Channels{
+		ReqChan:    reqChan,
+		ReportChan: reportChan,
+		StatChan:   statChan,
+	})
+	go cr.Run(stopCh)
+
+	reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqIn}
+	reportChan <- time.Now()
+	select {
+	case reqChan <- ReqEvent{Key: testKey1, EventType: queue.ReqOut}:
+	case <-time.After(time.Second):
+		t.Error("Requests were held up by an unread StatChan")
+	}
+}
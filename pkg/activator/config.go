@@ -0,0 +1,373 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ConfigName = "config-activator"
+)
+
+// Config defines the tunable activator parameters
+type Config struct {
+	// Probe timeouts. Connect bounds opening the connection to the
+	// revision and Response bounds waiting for its answer once connected.
+	// Zero uses the timeoutSeconds of the revision's readiness probe.
+	ProbeConnectTimeout  time.Duration
+	ProbeResponseTimeout time.Duration
+
+	// ProbeMonitorPeriod is how often revisions, and the pods requests
+	// are balanced across, are probed after they were found ready, to
+	// notice them stop being ready. Zero disables monitoring.
+	ProbeMonitorPeriod time.Duration
+
+	// MaxConcurrentProbes bounds how many probes run at once across all
+	// revisions. Zero means no limit.
+	MaxConcurrentProbes int
+
+	// ProbeBuckets is the number of buckets revisions are sharded into
+	// for their probes to be owned by a single replica, which holds the
+	// bucket's lease for ProbeBucketLeaseDuration. The other replicas wait
+	// up to ProbeOwnerTimeout for the owner's probe result before probing
+	// themselves. Zero disables sharding.
+	ProbeBuckets             int
+	ProbeBucketLeaseDuration time.Duration
+	ProbeOwnerTimeout        time.Duration
+
+	// MaxPendingRequests bounds how many requests are held per revision
+	// while it is activated. Zero means no limit.
+	MaxPendingRequests int
+
+	// ActivationQueueOrder is the order the requests held on the
+	// activation of a revision are released in once it is done.
+	ActivationQueueOrder QueueOrder
+
+	// MaxRequestBodyBytes bounds the size of the request bodies
+	// forwarded to revisions, unless they set their own limit. Zero means
+	// no limit.
+	MaxRequestBodyBytes int
+
+	// ColdStartSLO bounds how long a revision may take to become ready
+	// once its first request arrives. Activations running past it fail
+	// the requests waiting on them at once. Zero means no limit other
+	// than the probing budget.
+	ColdStartSLO time.Duration
+
+	// CircuitBreakerFailures is how many consecutive requests to a
+	// revision may fail before the following ones are turned away for
+	// CircuitBreakerCooldown. Zero disables the circuit breaker.
+	CircuitBreakerFailures int
+	CircuitBreakerCooldown time.Duration
+
+	// LoadBalancingPolicy names how requests are spread across the ready
+	// pods of a revision. Empty leaves it to the revision's service.
+	LoadBalancingPolicy string
+
+	// MeshCompatMode only reaches revisions through their service, for
+	// meshes rejecting connections made straight to pod IPs. Requests are
+	// then spread by the service rather than LoadBalancingPolicy.
+	MeshCompatMode bool
+
+	// EndpointSubsetSize bounds how many pods of a revision each
+	// activator replica spreads requests across. Zero means all of them.
+	EndpointSubsetSize int
+
+	// SlowStartWindow is how long the share of requests a pod gets with
+	// LoadBalancingPolicy takes to ramp up once it became ready. Zero
+	// gives new pods a full share right away.
+	SlowStartWindow time.Duration
+
+	// RetryBudgetPercent bounds the retries of the requests proxied to a
+	// revision after reaching it to this percentage of its requests
+	// within RetryBudgetWindow, plus a few. Zero means no bound.
+	RetryBudgetPercent int
+	RetryBudgetWindow  time.Duration
+
+	// MaxShadowRequests bounds how many requests mirrored to the shadow
+	// revisions of revisions are in flight at once, more being dropped.
+	// Zero disables mirroring.
+	MaxShadowRequests int
+
+	// DrainTimeout bounds how long requests in flight are waited for on
+	// shutdown.
+	DrainTimeout time.Duration
+
+	// Proxy timeouts, with the same meaning as the probe timeouts. Zero
+	// means no limit.
+	ProxyConnectTimeout  time.Duration
+	ProxyResponseTimeout time.Duration
+
+	// The pool of HTTP/1.1 connections to revisions. ProxyMaxIdleConns
+	// bounds the idle connections kept across all pods, zero meaning no
+	// limit, and ProxyMaxIdleConnsPerHost those kept to any one of them,
+	// zero meaning 2. Idle connections are closed after
+	// ProxyIdleConnTimeout, or never when zero. TCP keep-alives are sent
+	// every ProxyKeepAlive, or every 15s when zero.
+	ProxyMaxIdleConns        int
+	ProxyMaxIdleConnsPerHost int
+	ProxyIdleConnTimeout     time.Duration
+	ProxyKeepAlive           time.Duration
+
+	// ProxyFlushInterval is how often proxied responses are flushed to
+	// the client while they are being written. Zero only flushes them
+	// once the response buffer is full. Streamed responses are always
+	// flushed right away.
+	ProxyFlushInterval time.Duration
+
+	// ProxyBufferSize is the size in bytes of the buffers proxied bodies
+	// are copied through, which are recycled across requests. Zero
+	// allocates a buffer of the default size for every request.
+	ProxyBufferSize int
+
+	// ResponseCompression names the encoding proxied responses are
+	// compressed with for clients accepting it, GzipCompression being
+	// the only one supported. Only responses of at least
+	// CompressionMinSize bytes with one of CompressionContentTypes are
+	// compressed. Empty disables compression.
+	ResponseCompression     string
+	CompressionMinSize      int
+	CompressionContentTypes []string
+
+	// StatReportingPeriod is how often the requests handled for each
+	// revision are reported to the autoscaler. Zero disables reporting.
+	StatReportingPeriod time.Duration
+
+	// AccessLogFormat names the format requests are logged in, one of
+	// JSONAccessLogFormat or CombinedAccessLogFormat. Empty disables
+	// access logging.
+	AccessLogFormat string
+
+	// EnableProfiling serves the Go runtime profiles and the counts of
+	// client connections on a dedicated port, for diagnosing leaks.
+	EnableProfiling bool
+
+	// UpstreamCASecret names the secret, in the activator's namespace,
+	// holding the CA bundle that revisions opting into upstream TLS are
+	// verified against. Empty disables upstream TLS.
+	UpstreamCASecret string
+}
+
+// NewConfigFromMap creates a Config from the supplied map
+func NewConfigFromMap(data map[string]string) (*Config, error) {
+	c := &Config{}
+
+	// Process int fields
+	for _, i := range []struct {
+		key          string
+		field        *int
+		defaultValue int
+	}{{
+		key:   "max-concurrent-probes",
+		field: &c.MaxConcurrentProbes,
+	}, {
+		key:   "probe-buckets",
+		field: &c.ProbeBuckets,
+	}, {
+		key:   "max-pending-requests",
+		field: &c.MaxPendingRequests,
+	}, {
+		key:          "max-request-body-bytes",
+		field:        &c.MaxRequestBodyBytes,
+		defaultValue: 32e6, // 32MB - same as app engine
+	}, {
+		key:   "circuit-breaker-failures",
+		field: &c.CircuitBreakerFailures,
+	}, {
+		key:   "endpoint-subset-size",
+		field: &c.EndpointSubsetSize,
+	}, {
+		key:   "retry-budget-percent",
+		field: &c.RetryBudgetPercent,
+	}, {
+		key:   "max-shadow-requests",
+		field: &c.MaxShadowRequests,
+	}, {
+		key:   "proxy-buffer-size",
+		field: &c.ProxyBufferSize,
+	}, {
+		key:          "compression-min-size",
+		field:        &c.CompressionMinSize,
+		defaultValue: 1024,
+	}, {
+		key:          "proxy-max-idle-conns",
+		field:        &c.ProxyMaxIdleConns,
+		defaultValue: 1000,
+	}, {
+		key:          "proxy-max-idle-conns-per-host",
+		field:        &c.ProxyMaxIdleConnsPerHost,
+		defaultValue: 100,
+	}} {
+		if raw, ok := data[i.key]; !ok {
+			*i.field = i.defaultValue
+		} else if val, err := strconv.Atoi(raw); err != nil {
+			return nil, err
+		} else if val < 0 {
+			return nil, fmt.Errorf("Activator configmap has negative %q: %v", i.key, val)
+		} else {
+			*i.field = val
+		}
+	}
+
+	// Process Duration fields
+	for _, dur := range []struct {
+		key          string
+		field        *time.Duration
+		defaultValue time.Duration
+	}{{
+		key:   "probe-connect-timeout",
+		field: &c.ProbeConnectTimeout,
+	}, {
+		key:   "probe-response-timeout",
+		field: &c.ProbeResponseTimeout,
+	}, {
+		key:   "probe-monitor-period",
+		field: &c.ProbeMonitorPeriod,
+	}, {
+		key:          "probe-bucket-lease-duration",
+		field:        &c.ProbeBucketLeaseDuration,
+		defaultValue: 15 * time.Second,
+	}, {
+		key:          "probe-owner-timeout",
+		field:        &c.ProbeOwnerTimeout,
+		defaultValue: 5 * time.Second,
+	}, {
+		key:   "cold-start-slo",
+		field: &c.ColdStartSLO,
+	}, {
+		key:          "circuit-breaker-cooldown",
+		field:        &c.CircuitBreakerCooldown,
+		defaultValue: 10 * time.Second,
+	}, {
+		key:   "slow-start-window",
+		field: &c.SlowStartWindow,
+	}, {
+		key:          "retry-budget-window",
+		field:        &c.RetryBudgetWindow,
+		defaultValue: 10 * time.Second,
+	}, {
+		key:          "drain-timeout",
+		field:        &c.DrainTimeout,
+		defaultValue: 45 * time.Second,
+	}, {
+		key:          "proxy-connect-timeout",
+		field:        &c.ProxyConnectTimeout,
+		defaultValue: 30 * time.Second,
+	}, {
+		key:   "proxy-response-timeout",
+		field: &c.ProxyResponseTimeout,
+	}, {
+		key:   "proxy-flush-interval",
+		field: &c.ProxyFlushInterval,
+	}, {
+		key:          "proxy-idle-conn-timeout",
+		field:        &c.ProxyIdleConnTimeout,
+		defaultValue: 90 * time.Second,
+	}, {
+		key:          "proxy-keep-alive",
+		field:        &c.ProxyKeepAlive,
+		defaultValue: 30 * time.Second,
+	}, {
+		key:   "stat-reporting-period",
+		field: &c.StatReportingPeriod,
+	}} {
+		if raw, ok := data[dur.key]; !ok {
+			*dur.field = dur.defaultValue
+		} else if val, err := time.ParseDuration(raw); err != nil {
+			return nil, err
+		} else if val < 0 {
+			return nil, fmt.Errorf("Activator configmap has negative %q: %v", dur.key, val)
+		} else {
+			*dur.field = val
+		}
+	}
+
+	switch policy := data["load-balancing-policy"]; policy {
+	case "", RandomChoiceOfTwoPolicy, RoundRobinPolicy, LeastInflightPolicy:
+		c.LoadBalancingPolicy = policy
+	default:
+		return nil, fmt.Errorf("Activator configmap has unknown %q: %v", "load-balancing-policy", policy)
+	}
+
+	switch order := QueueOrder(data["activation-queue-order"]); order {
+	case "":
+		c.ActivationQueueOrder = FIFOQueueOrder
+	case FIFOQueueOrder, LIFOQueueOrder:
+		c.ActivationQueueOrder = order
+	default:
+		return nil, fmt.Errorf("Activator configmap has unknown %q: %v", "activation-queue-order", order)
+	}
+
+	switch encoding := data["response-compression"]; encoding {
+	case "", GzipCompression:
+		c.ResponseCompression = encoding
+	default:
+		return nil, fmt.Errorf("Activator configmap has unknown %q: %v", "response-compression", encoding)
+	}
+
+	c.CompressionContentTypes = DefaultCompressionContentTypes
+	if raw, ok := data["compression-content-types"]; ok {
+		c.CompressionContentTypes = nil
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				c.CompressionContentTypes = append(c.CompressionContentTypes, t)
+			}
+		}
+	}
+
+	switch format := data["access-log-format"]; format {
+	case "", JSONAccessLogFormat, CombinedAccessLogFormat:
+		c.AccessLogFormat = format
+	default:
+		return nil, fmt.Errorf("Activator configmap has unknown %q: %v", "access-log-format", format)
+	}
+
+	// Process bool fields
+	for _, b := range []struct {
+		key   string
+		field *bool
+	}{{
+		key:   "mesh-compat-mode",
+		field: &c.MeshCompatMode,
+	}, {
+		key:   "enable-profiling",
+		field: &c.EnableProfiling,
+	}} {
+		if raw, ok := data[b.key]; ok {
+			val, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, err
+			}
+			*b.field = val
+		}
+	}
+
+	c.UpstreamCASecret = data["upstream-ca-secret"]
+
+	return c, nil
+}
+
+// NewConfigFromConfigMap creates a Config from the supplied ConfigMap
+func NewConfigFromConfigMap(configMap *corev1.ConfigMap) (*Config, error) {
+	return NewConfigFromMap(configMap.Data)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reconfigurable is implemented by the parts of the activator applying a
+// new Config to the requests they handle from then on.
+type Reconfigurable interface {
+	SetConfig(*Config)
+}
+
+// ConfigStore holds the current activator Config, replaced whenever the
+// config-activator ConfigMap changes so that tuning the activator does
+// not require restarting it.
+type ConfigStore struct {
+	logger *zap.SugaredLogger
+
+	mux      sync.RWMutex
+	current  *Config
+	onChange []func(prev, cur *Config)
+}
+
+// NewConfigStore creates a ConfigStore starting with initial.
+func NewConfigStore(initial *Config, logger *zap.SugaredLogger) *ConfigStore {
+	return &ConfigStore{
+		logger:  logger,
+		current: initial,
+	}
+}
+
+// Load returns the current Config, which must not be modified.
+func (s *ConfigStore) Load() *Config {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.current
+}
+
+// OnChange registers f to be called with every new Config and the one
+// it replaced.
+func (s *ConfigStore) OnChange(f func(prev, cur *Config)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.onChange = append(s.onChange, f)
+}
+
+// OnConfigChanged replaces the current Config with the one in cm, for
+// use with a configmap.Watcher. An invalid ConfigMap is logged and
+// leaves the current Config in place.
+func (s *ConfigStore) OnConfigChanged(cm *corev1.ConfigMap) {
+	cur, err := NewConfigFromConfigMap(cm)
+	if err != nil {
+		s.logger.Errorf("Ignoring invalid %s: %v", ConfigName, err)
+		return
+	}
+	s.mux.Lock()
+	prev := s.current
+	if reflect.DeepEqual(prev, cur) {
+		s.mux.Unlock()
+		return
+	}
+	s.current = cur
+	onChange := s.onChange
+	s.mux.Unlock()
+
+	s.logger.Infof("Applying the updated %s", ConfigName)
+	if keys := restartRequired(prev, cur); len(keys) > 0 {
+		s.logger.Warnf("Changes to %v only apply once the activator restarts", keys)
+	}
+	for _, f := range onChange {
+		f(prev, cur)
+	}
+}
+
+// restartRequired returns the keys changed between prev and cur whose
+// values are only read when the activator starts.
+func restartRequired(prev, cur *Config) []string {
+	var keys []string
+	for _, c := range []struct {
+		key     string
+		changed bool
+	}{
+		{"probe-monitor-period", prev.ProbeMonitorPeriod != cur.ProbeMonitorPeriod},
+		{"probe-buckets", prev.ProbeBuckets != cur.ProbeBuckets},
+		{"probe-bucket-lease-duration", prev.ProbeBucketLeaseDuration != cur.ProbeBucketLeaseDuration},
+		// Pods are only watched when a policy is set on start, but the
+		// policy can be changed for another.
+		{"load-balancing-policy", (prev.LoadBalancingPolicy == "") != (cur.LoadBalancingPolicy == "")},
+		{"mesh-compat-mode", prev.MeshCompatMode != cur.MeshCompatMode},
+		{"stat-reporting-period", prev.StatReportingPeriod != cur.StatReportingPeriod},
+		{"access-log-format", prev.AccessLogFormat != cur.AccessLogFormat},
+		{"enable-profiling", prev.EnableProfiling != cur.EnableProfiling},
+		{"upstream-ca-secret", prev.UpstreamCASecret != cur.UpstreamCASecret},
+	} {
+		if c.changed {
+			keys = append(keys, c.key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func configMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigName},
+		Data:       data,
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	initial, err := NewConfigFromMap(map[string]string{"max-pending-requests": "10"})
+	if err != nil {
+		t.Fatalf("NewConfigFromMap() = %v", err)
+	}
+	s := NewConfigStore(initial, TestLogger(t))
+	var changes [][2]*Config
+	s.OnChange(func(prev, cur *Config) {
+		changes = append(changes, [2]*Config{prev, cur})
+	})
+
+	// An unchanged config is not applied again.
+	s.OnConfigChanged(configMap(map[string]string{"max-pending-requests": "10"}))
+	if len(changes) != 0 {
+		t.Errorf("Unexpected changes for the same config: %v", changes)
+	}
+
+	s.OnConfigChanged(configMap(map[string]string{"max-pending-requests": "20", "drain-timeout": "1m"}))
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected number of changes. Want 1. Got %d.", len(changes))
+	}
+	if changes[0][0] != initial {
+		t.Errorf("Unexpected previous config. Want %+v. Got %+v.", initial, changes[0][0])
+	}
+	if got := s.Load(); got != changes[0][1] || got.MaxPendingRequests != 20 || got.DrainTimeout != time.Minute {
+		t.Errorf("Unexpected current config: %+v", got)
+	}
+
+	// An invalid config leaves the current one in place.
+	current := s.Load()
+	s.OnConfigChanged(configMap(map[string]string{"max-pending-requests": "-1"}))
+	if got := s.Load(); got != current {
+		t.Errorf("Unexpected config after an invalid update. Want %+v. Got %+v.", current, got)
+	}
+	if len(changes) != 1 {
+		t.Errorf("Unexpected number of changes after an invalid update. Want 1. Got %d.", len(changes))
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	tests := []struct {
+		name string
+		prev *Config
+		cur  *Config
+		want []string
+	}{{
+		name: "hot",
+		prev: &Config{MaxPendingRequests: 1, LoadBalancingPolicy: RoundRobinPolicy},
+		cur:  &Config{MaxPendingRequests: 2, LoadBalancingPolicy: LeastInflightPolicy},
+	}, {
+		name: "load balancing enabled",
+		prev: &Config{},
+		cur:  &Config{LoadBalancingPolicy: RoundRobinPolicy},
+		want: []string{"load-balancing-policy"},
+	}, {
+		name: "restart",
+		prev: &Config{ProbeBuckets: 1, StatReportingPeriod: time.Second},
+		cur:  &Config{ProbeBuckets: 2, StatReportingPeriod: time.Second, UpstreamCASecret: "ca"},
+		want: []string{"probe-buckets", "upstream-ca-secret"},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, restartRequired(test.prev, test.cur)); diff != "" {
+				t.Errorf("Unexpected keys requiring a restart (-want +got): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Knative Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]string
+		want    *Config
+		wantErr bool
+	}{{
+		name:  "defaults",
+		input: map[string]string{},
+		want: &Config{
+			ProbeBucketLeaseDuration: 15 * time.Second,
+			ProbeOwnerTimeout:        5 * time.Second,
+			ActivationQueueOrder:     FIFOQueueOrder,
+			MaxRequestBodyBytes:      32e6,
+			CircuitBreakerCooldown:   10 * time.Second,
+			RetryBudgetWindow:        10 * time.Second,
+			DrainTimeout:             45 * time.Second,
+			ProxyConnectTimeout:      30 * time.Second,
+			ProxyMaxIdleConns:        1000,
+			ProxyMaxIdleConnsPerHost: 100,
+			ProxyIdleConnTimeout:     90 * time.Second,
+			CompressionMinSize:       1024,
+			CompressionContentTypes:  DefaultCompressionContentTypes,
+			ProxyKeepAlive:           30 * time.Second,
+		},
+	}, {
+		name: "all specified",
+		input: map[string]string{
+			"probe-connect-timeout":         "250ms",
+			"probe-response-timeout":        "5s",
+			"probe-monitor-period":          "10s",
+			"max-concurrent-probes":         "50",
+			"probe-buckets":                 "16",
+			"probe-bucket-lease-duration":   "30s",
+			"probe-owner-timeout":           "2s",
+			"max-pending-requests":          "20",
+			"activation-queue-order":        "lifo",
+			"max-request-body-bytes":        "1024",
+			"cold-start-slo":                "20s",
+			"circuit-breaker-failures":      "3",
+			"circuit-breaker-cooldown":      "5s",
+			"load-balancing-policy":         "round-robin",
+			"mesh-compat-mode":              "true",
+			"endpoint-subset-size":          "10",
+			"slow-start-window":             "20s",
+			"retry-budget-percent":          "20",
+			"max-shadow-requests":           "100",
+			"retry-budget-window":           "30s",
+			"drain-timeout":                 "1m",
+			"proxy-connect-timeout":         "1s",
+			"proxy-response-timeout":        "1m",
+			"proxy-flush-interval":          "50ms",
+			"proxy-buffer-size":             "4096",
+			"response-compression":          "gzip",
+			"compression-min-size":          "512",
+			"compression-content-types":     "text/html, application/json",
+			"proxy-max-idle-conns":          "1000",
+			"proxy-max-idle-conns-per-host": "50",
+			"proxy-idle-conn-timeout":       "1m",
+			"proxy-keep-alive":              "15s",
+			"stat-reporting-period":         "2s",
+			"access-log-format":             "combined",
+			"enable-profiling":              "true",
+			"upstream-ca-secret":            "upstream-ca",
+		},
+		want: &Config{
+			ProbeConnectTimeout:      250 * time.Millisecond,
+			ProbeResponseTimeout:     5 * time.Second,
+			ProbeMonitorPeriod:       10 * time.Second,
+			MaxConcurrentProbes:      50,
+			ProbeBuckets:             16,
+			ProbeBucketLeaseDuration: 30 * time.Second,
+			ProbeOwnerTimeout:        2 * time.Second,
+			MaxPendingRequests:       20,
+			ActivationQueueOrder:     LIFOQueueOrder,
+			MaxRequestBodyBytes:      1024,
+			ColdStartSLO:             20 * time.Second,
+			CircuitBreakerFailures:   3,
+			CircuitBreakerCooldown:   5 * time.Second,
+			LoadBalancingPolicy:      "round-robin",
+			MeshCompatMode:           true,
+			EndpointSubsetSize:       10,
+			SlowStartWindow:          20 * time.Second,
+			RetryBudgetPercent:       20,
+			MaxShadowRequests:        100,
+			RetryBudgetWindow:        30 * time.Second,
+			DrainTimeout:             1 * time.Minute,
+			ProxyConnectTimeout:      1 * time.Second,
+			ProxyResponseTimeout:     1 * time.Minute,
+			ProxyFlushInterval:       50 * time.Millisecond,
+			ProxyBufferSize:          4096,
+			ResponseCompression:      "gzip",
+			CompressionMinSize:       512,
+			CompressionContentTypes:  []string{"text/html", "application/json"},
+			ProxyMaxIdleConns:        1000,
+			ProxyMaxIdleConnsPerHost: 50,
+			ProxyIdleConnTimeout:     1 * time.Minute,
+			ProxyKeepAlive:           15 * time.Second,
+			StatReportingPeriod:      2 * time.Second,
+			AccessLogFormat:          "combined",
+			EnableProfiling:          true,
+			UpstreamCASecret:         "upstream-ca",
+		},
+	}, {
+		name: "malformed duration",
+		input: map[string]string{
+			"probe-connect-timeout": "fast",
+		},
+		wantErr: true,
+	}, {
+		name: "malformed int",
+		input: map[string]string{
+			"max-concurrent-probes": "lots",
+		},
+		wantErr: true,
+	}, {
+		name: "unknown load balancing policy",
+		input: map[string]string{
+			"load-balancing-policy": "fastest",
+		},
+		wantErr: true,
+	}, {
+		name: "unknown activation queue order",
+		input: map[string]string{
+			"activation-queue-order": "random",
+		},
+		wantErr: true,
+	}, {
+		name: "malformed bool",
+		input: map[string]string{
+			"mesh-compat-mode": "sometimes",
+		},
+		wantErr: true,
+	}, {
+		name: "unknown response compression",
+		input: map[string]string{
+			"response-compression": "br",
+		},
+		wantErr: true,
+	}, {
+		name: "unknown access log format",
+		input: map[string]string{
+			"access-log-format": "xml",
+		},
+		wantErr: true,
+	}, {
+		name: "negative duration",
+		input: map[string]string{
+			"proxy-response-timeout": "-1s",
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewConfigFromConfigMap(&corev1.ConfigMap{
+				Data: test.input,
+			})
+			if (err != nil) != test.wantErr {
+				t.Errorf("NewConfig() = %v, want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewConfig (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestOurConfig(t *testing.T) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.yaml", ConfigName))
+	if err != nil {
+		t.Errorf("ReadFile() = %v", err)
+	}
+	var cm corev1.ConfigMap
+	if err := yaml.Unmarshal(b, &cm); err != nil {
+		t.Errorf("yaml.Unmarshal() = %v", err)
+	}
+	if _, err := NewConfigFromConfigMap(&cm); err != nil {
+		t.Errorf("NewConfigFromConfigMap() = %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ConnectionStats counts the client connections of a listener.
+type ConnectionStats struct {
+	Active   int64 `json:"active"`
+	Accepted int64 `json:"accepted"`
+	Closed   int64 `json:"closed"`
+}
+
+// ConnectionTracker counts the connections of the http.Server whose
+// ConnState it is, and reports them as metrics tagged with the name of
+// its listener. Hijacked connections, like websockets, count as closed.
+type ConnectionTracker struct {
+	listener string
+	ctx      context.Context
+
+	mux   sync.Mutex
+	stats ConnectionStats
+}
+
+// NewConnectionTracker creates a ConnectionTracker for the named
+// listener.
+func NewConnectionTracker(listener string) *ConnectionTracker {
+	ctx, err := tag.New(context.Background(), tag.Insert(listenerTagKey, listener))
+	if err != nil {
+		// Only invalid tag values fail, and listener names are constants.
+		panic(err)
+	}
+	return &ConnectionTracker{
+		listener: listener,
+		ctx:      ctx,
+	}
+}
+
+// ConnState is the function of the same name of an http.Server.
+func (c *ConnectionTracker) ConnState(conn net.Conn, state http.ConnState) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	switch state {
+	case http.StateNew:
+		c.stats.Accepted++
+		c.stats.Active++
+		stats.Record(c.ctx, connectionAcceptedCountM.M(1))
+	case http.StateClosed, http.StateHijacked:
+		c.stats.Closed++
+		c.stats.Active--
+		stats.Record(c.ctx, connectionClosedCountM.M(1))
+	default:
+		return
+	}
+	stats.Record(c.ctx, connectionCountM.M(c.stats.Active))
+}
+
+// Stats returns the connections counted so far.
+func (c *ConnectionTracker) Stats() ConnectionStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.stats
+}
+
+// ConnectionsHandler serves the Stats of trackers as JSON, keyed by the
+// name of their listener.
+func ConnectionsHandler(trackers ...*ConnectionTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		all := make(map[string]ConnectionStats, len(trackers))
+		for _, c := range trackers {
+			all[c.listener] = c.Stats()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(all)
+	})
+}
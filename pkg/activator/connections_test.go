@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats/view"
+)
+
+func TestConnectionTracker(t *testing.T) {
+	resetViews(t)
+	c := NewConnectionTracker("test")
+	for _, state := range []http.ConnState{
+		http.StateNew, http.StateActive, http.StateIdle,
+		http.StateNew, http.StateActive,
+		http.StateNew, http.StateHijacked,
+		http.StateClosed,
+	} {
+		c.ConnState(nil, state)
+	}
+
+	want := ConnectionStats{Active: 1, Accepted: 3, Closed: 2}
+	if diff := cmp.Diff(want, c.Stats()); diff != "" {
+		t.Errorf("Unexpected connection stats (-want +got): %v", diff)
+	}
+	wantTags := map[string]string{"listener": "test"}
+	checkCount(t, "connection_accepted_count", wantTags, 3)
+	checkCount(t, "connection_closed_count", wantTags, 2)
+	d := rowsWithTags(t, "connection_count", wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of rows. Want 1. Got %v.", len(d))
+	}
+	if s, ok := d[0].Data.(*view.LastValueData); !ok {
+		t.Errorf("Unexpected data type. Want LastValueData. Got %T.", d[0].Data)
+	} else if s.Value != 1 {
+		t.Errorf("Unexpected connection count. Want 1. Got %v.", s.Value)
+	}
+}
+
+func TestConnectionsHandler(t *testing.T) {
+	plain, tls := NewConnectionTracker("plain"), NewConnectionTracker("tls")
+	plain.ConnState(nil, http.StateNew)
+	tls.ConnState(nil, http.StateNew)
+	tls.ConnState(nil, http.StateClosed)
+
+	rec := httptest.NewRecorder()
+	ConnectionsHandler(plain, tls).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/connections", nil))
+	var got map[string]ConnectionStats
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("Error decoding the connection stats: %v", err)
+	}
+	want := map[string]ConnectionStats{
+		"plain": {Active: 1, Accepted: 1},
+		"tls":   {Accepted: 1, Closed: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected connection stats (-want +got): %v", diff)
+	}
+}
+
+func TestConnectionTracker_Server(t *testing.T) {
+	c := NewConnectionTracker("server")
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Config.ConnState = c.ConnState
+	s.Start()
+
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	resp.Body.Close()
+	if got := c.Stats(); got.Accepted != 1 || got.Active != 1 {
+		t.Errorf("Unexpected connection stats with an idle connection. Want 1 accepted and active. Got %+v.", got)
+	}
+	s.Close()
+	if got := c.Stats(); got.Active != 0 || got.Closed != 1 {
+		t.Errorf("Unexpected connection stats once closed. Want 1 closed and none active. Got %+v.", got)
+	}
+}
@@ -16,14 +16,20 @@ limitations under the License.
 package activator
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net/http"
 	"sync"
 )
 
+// ErrShuttingDown is returned for activation requests that were
+// abandoned because the activator is shutting down.
+var ErrShuttingDown = errors.New("activator shutting down")
+
 var shuttingDownError = activationResult{
 	endpoint: Endpoint{},
 	status:   Status(500),
-	err:      fmt.Errorf("activator shutting down"),
+	err:      ErrShuttingDown,
 }
 
 type activationResult struct {
@@ -33,29 +39,44 @@ type activationResult struct {
 }
 
 var _ Activator = (*dedupingActivator)(nil)
+var _ Checkpointer = (*dedupingActivator)(nil)
+var _ Reconfigurable = (*dedupingActivator)(nil)
 
 type dedupingActivator struct {
 	mux             sync.Mutex
-	pendingRequests map[revisionID][]chan activationResult
+	pendingRequests map[revisionID]*pendingActivation
 	activator       Activator
 	shutdown        bool
 }
 
+// pendingActivation is an activation in progress and the requests
+// waiting on it. It is cancelled once they all gave up.
+type pendingActivation struct {
+	reqs   []chan activationResult
+	cancel context.CancelFunc
+}
+
 // NewDedupingActivator creates an Activator that deduplicates
-// activations requests for the same revision id and namespace.
+// activations requests for the same revision id and namespace. The
+// activation goes on for as long as any of the requests waits on it.
 func NewDedupingActivator(a Activator) Activator {
 	return &dedupingActivator{
-		pendingRequests: make(map[revisionID][]chan activationResult),
+		pendingRequests: make(map[revisionID]*pendingActivation),
 		activator:       a,
 	}
 }
 
-func (a *dedupingActivator) ActiveEndpoint(namespace, name string) (Endpoint, Status, error) {
+func (a *dedupingActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error) {
 	id := revisionID{namespace: namespace, name: name}
 	ch := make(chan activationResult, 1)
-	a.dedupe(id, ch)
-	result := <-ch
-	return result.endpoint, result.status, result.err
+	a.dedupe(ctx, id, ch)
+	select {
+	case result := <-ch:
+		return result.endpoint, result.status, result.err
+	case <-ctx.Done():
+		a.abandon(id, ch)
+		return Endpoint{}, http.StatusGatewayTimeout, ctx.Err()
+	}
 }
 
 func (a *dedupingActivator) Shutdown() {
@@ -63,30 +84,84 @@ func (a *dedupingActivator) Shutdown() {
 	a.mux.Lock()
 	defer a.mux.Unlock()
 	a.shutdown = true
-	for _, reqs := range a.pendingRequests {
-		for _, ch := range reqs {
+	for id, pending := range a.pendingRequests {
+		for _, ch := range pending.reqs {
 			ch <- shuttingDownError
 		}
+		delete(a.pendingRequests, id)
+		pending.cancel()
+	}
+}
+
+// SetConfig implements Reconfigurable, passing config on to the wrapped
+// Activator.
+func (a *dedupingActivator) SetConfig(config *Config) {
+	if r, ok := a.activator.(Reconfigurable); ok {
+		r.SetConfig(config)
+	}
+}
+
+// PendingRevisions implements Checkpointer.
+func (a *dedupingActivator) PendingRevisions() []CheckpointRevision {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	revs := make([]CheckpointRevision, 0, len(a.pendingRequests))
+	for id, pending := range a.pendingRequests {
+		revs = append(revs, CheckpointRevision{
+			Namespace: id.namespace,
+			Name:      id.name,
+			Requests:  len(pending.reqs),
+		})
 	}
+	return revs
 }
 
-func (a *dedupingActivator) dedupe(id revisionID, ch chan activationResult) {
+func (a *dedupingActivator) dedupe(reqCtx context.Context, id revisionID, ch chan activationResult) {
 	a.mux.Lock()
 	defer a.mux.Unlock()
 	if a.shutdown {
 		ch <- shuttingDownError
 		return
 	}
-	if reqs, ok := a.pendingRequests[id]; ok {
-		a.pendingRequests[id] = append(reqs, ch)
+	if pending, ok := a.pendingRequests[id]; ok {
+		pending.reqs = append(pending.reqs, ch)
 	} else {
-		a.pendingRequests[id] = []chan activationResult{ch}
-		go a.activate(id)
+		// The activation outlives the request starting it, but keeps its
+		// ID to be told apart in the logs and probes.
+		ctx, cancel := context.WithCancel(WithRequestID(context.Background(), RequestIDFrom(reqCtx)))
+		pending := &pendingActivation{
+			reqs:   []chan activationResult{ch},
+			cancel: cancel,
+		}
+		a.pendingRequests[id] = pending
+		go a.activate(ctx, id, pending)
+	}
+}
+
+// abandon stops ch from waiting on the activation of id, cancelling it
+// if no other request waits on it.
+func (a *dedupingActivator) abandon(id revisionID, ch chan activationResult) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	pending, ok := a.pendingRequests[id]
+	if !ok {
+		return
+	}
+	for i, req := range pending.reqs {
+		if req == ch {
+			pending.reqs = append(pending.reqs[:i], pending.reqs[i+1:]...)
+			break
+		}
+	}
+	if len(pending.reqs) == 0 {
+		delete(a.pendingRequests, id)
+		pending.cancel()
 	}
 }
 
-func (a *dedupingActivator) activate(id revisionID) {
-	endpoint, status, err := a.activator.ActiveEndpoint(id.namespace, id.name)
+func (a *dedupingActivator) activate(ctx context.Context, id revisionID, pending *pendingActivation) {
+	defer pending.cancel()
+	endpoint, status, err := a.activator.ActiveEndpoint(ctx, id.namespace, id.name)
 	a.mux.Lock()
 	defer a.mux.Unlock()
 	result := activationResult{
@@ -94,9 +169,11 @@ func (a *dedupingActivator) activate(id revisionID) {
 		status:   status,
 		err:      err,
 	}
-	if reqs, ok := a.pendingRequests[id]; ok {
+	// The requests may all have given up, and new ones started another
+	// activation since.
+	if a.pendingRequests[id] == pending {
 		delete(a.pendingRequests, id)
-		for _, ch := range reqs {
+		for _, ch := range pending.reqs {
 			ch <- result
 		}
 	}
@@ -16,6 +16,7 @@ limitations under the License.
 package activator
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -25,7 +26,7 @@ import (
 )
 
 func TestSingleRevision_SingleRequest_Success(t *testing.T) {
-	want := Endpoint{"ip", 8080}
+	want := Endpoint{FQDN: "ip", Port: 8080}
 	f := newFakeActivator(t,
 		map[revisionID]activationResult{
 			revisionID{"default", "rev1"}: activationResult{
@@ -36,7 +37,7 @@ func TestSingleRevision_SingleRequest_Success(t *testing.T) {
 		})
 	d := NewDedupingActivator(Activator(f))
 
-	endpoint, status, err := d.ActiveEndpoint("default", "rev1")
+	endpoint, status, err := d.ActiveEndpoint(context.TODO(), "default", "rev1")
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -53,7 +54,7 @@ func TestSingleRevision_SingleRequest_Success(t *testing.T) {
 }
 
 func TestSingleRevision_MultipleRequests_Success(t *testing.T) {
-	ep := Endpoint{"ip", 8080}
+	ep := Endpoint{FQDN: "ip", Port: 8080}
 	f := newFakeActivator(t,
 		map[revisionID]activationResult{
 			revisionID{"default", "rev1"}: activationResult{
@@ -82,8 +83,8 @@ func TestSingleRevision_MultipleRequests_Success(t *testing.T) {
 }
 
 func TestMultipleRevisions_MultipleRequests_Success(t *testing.T) {
-	ep1 := Endpoint{"ip1", 8080}
-	ep2 := Endpoint{"ip2", 8080}
+	ep1 := Endpoint{FQDN: "ip1", Port: 8080}
+	ep2 := Endpoint{FQDN: "ip2", Port: 8080}
 	f := newFakeActivator(t,
 		map[revisionID]activationResult{
 			revisionID{"default", "rev1"}: activationResult{
@@ -121,7 +122,7 @@ func TestMultipleRevisions_MultipleRequests_Success(t *testing.T) {
 }
 
 func TestMultipleRevisions_MultipleRequests_PartialSuccess(t *testing.T) {
-	ep1 := Endpoint{"ip1", 8080}
+	ep1 := Endpoint{FQDN: "ip1", Port: 8080}
 	status2 := Status(http.StatusInternalServerError)
 	error2 := fmt.Errorf("test error")
 	f := newFakeActivator(t,
@@ -175,7 +176,7 @@ func TestSingleRevision_MultipleRequests_FailureRecovery(t *testing.T) {
 	d := NewDedupingActivator(Activator(f))
 
 	// Activation initially fails
-	endpoint, status, err := d.ActiveEndpoint("default", "rev1")
+	endpoint, status, err := d.ActiveEndpoint(context.TODO(), "default", "rev1")
 
 	if err != failErr {
 		t.Errorf("Unexpected error. Want %v. Got %v.", failErr, err)
@@ -191,7 +192,7 @@ func TestSingleRevision_MultipleRequests_FailureRecovery(t *testing.T) {
 	}
 
 	// Later activation succeeds
-	successEp := Endpoint{"ip", 8080}
+	successEp := Endpoint{FQDN: "ip", Port: 8080}
 	successStatus := Status(0)
 	f.responses[revisionID{"default", "rev1"}] = activationResult{
 		endpoint: successEp,
@@ -199,7 +200,7 @@ func TestSingleRevision_MultipleRequests_FailureRecovery(t *testing.T) {
 		err:      nil,
 	}
 
-	endpoint, status, err = d.ActiveEndpoint("default", "rev1")
+	endpoint, status, err = d.ActiveEndpoint(context.TODO(), "default", "rev1")
 
 	if err != nil {
 		t.Errorf("Unexpected error. Want %v. Got %v.", nil, err)
@@ -216,7 +217,7 @@ func TestSingleRevision_MultipleRequests_FailureRecovery(t *testing.T) {
 }
 
 func TestShutdown_ReturnError(t *testing.T) {
-	ep := Endpoint{"ip", 8080}
+	ep := Endpoint{FQDN: "ip", Port: 8080}
 	f := newFakeActivator(t,
 		map[revisionID]activationResult{
 			revisionID{"default", "rev1"}: activationResult{
@@ -232,7 +233,7 @@ func TestShutdown_ReturnError(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 		d.Shutdown()
 	}()
-	endpoint, status, err := d.ActiveEndpoint("default", "rev1")
+	endpoint, status, err := d.ActiveEndpoint(context.TODO(), "default", "rev1")
 
 	want := Endpoint{}
 	if endpoint != want {
@@ -241,11 +242,134 @@ func TestShutdown_ReturnError(t *testing.T) {
 	if status != Status(http.StatusInternalServerError) {
 		t.Errorf("Unexpected error stats. Want %v. Got %v.", http.StatusInternalServerError, status)
 	}
-	if err == nil {
-		t.Errorf("Expected error. Want error. Got nil.")
+	if err != ErrShuttingDown {
+		t.Errorf("Unexpected error. Want %v. Got %v.", ErrShuttingDown, err)
 	}
 }
 
+func TestPendingRevisions(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	id := revisionID{"default", "rev1"}
+	f := newFakeActivator(t,
+		map[revisionID]activationResult{
+			id: activationResult{
+				endpoint: ep,
+				status:   Status(0),
+				err:      nil,
+			},
+		})
+	d := NewDedupingActivator(Activator(f))
+	f.hold(id)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.ActiveEndpoint(context.TODO(), id.namespace, id.name)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	got := d.(Checkpointer).PendingRevisions()
+	want := []CheckpointRevision{{Namespace: "default", Name: "rev1", Requests: 2}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected pending revisions. Want %+v. Got %+v.", want, got)
+	}
+
+	f.release(id)
+	wg.Wait()
+	if got := d.(Checkpointer).PendingRevisions(); len(got) != 0 {
+		t.Errorf("Unexpected pending revisions after activation. Got %+v.", got)
+	}
+}
+
+func TestAbandonedRequests_CancelActivation(t *testing.T) {
+	f := &blockingActivator{
+		started:   make(chan struct{}, 1),
+		cancelled: make(chan struct{}),
+	}
+	d := NewDedupingActivator(f)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, _, err := d.ActiveEndpoint(ctx1, "default", "rev1")
+		errs <- err
+	}()
+	<-f.started
+	go func() {
+		_, _, err := d.ActiveEndpoint(ctx2, "default", "rev1")
+		errs <- err
+	}()
+	// Wait for the second request to join the activation.
+	for len(d.(Checkpointer).PendingRevisions()) == 0 || d.(Checkpointer).PendingRevisions()[0].Requests < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Unexpected error. Want %v. Got %v.", context.Canceled, err)
+	}
+	select {
+	case <-f.cancelled:
+		t.Error("Activation cancelled while a request still waits on it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Unexpected error. Want %v. Got %v.", context.Canceled, err)
+	}
+	select {
+	case <-f.cancelled:
+	case <-time.After(time.Second):
+		t.Error("Activation not cancelled once no request waits on it")
+	}
+	if got := d.(Checkpointer).PendingRevisions(); len(got) != 0 {
+		t.Errorf("Unexpected pending revisions. Want none. Got %v.", got)
+	}
+}
+
+func TestActivation_KeepsRequestID(t *testing.T) {
+	f := &contextActivator{}
+	d := NewDedupingActivator(f)
+
+	d.ActiveEndpoint(WithRequestID(context.Background(), "req-1"), "default", "rev1")
+
+	if got := RequestIDFrom(f.ctx); got != "req-1" {
+		t.Errorf("Unexpected activation request ID. Want %q. Got %q.", "req-1", got)
+	}
+}
+
+// contextActivator records the context of its last activation.
+type contextActivator struct {
+	ctx context.Context
+}
+
+func (a *contextActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error) {
+	a.ctx = ctx
+	return Endpoint{}, 0, nil
+}
+
+func (a *contextActivator) Shutdown() {}
+
+// blockingActivator activates until its context is done.
+type blockingActivator struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (a *blockingActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error) {
+	a.started <- struct{}{}
+	<-ctx.Done()
+	close(a.cancelled)
+	return Endpoint{}, http.StatusGatewayTimeout, ctx.Err()
+}
+
+func (a *blockingActivator) Shutdown() {}
+
 type fakeActivator struct {
 	t         *testing.T
 	responses map[revisionID]activationResult
@@ -264,7 +388,7 @@ func newFakeActivator(t *testing.T, responses map[revisionID]activationResult) *
 	}
 }
 
-func (f *fakeActivator) ActiveEndpoint(namespace, name string) (Endpoint, Status, error) {
+func (f *fakeActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (Endpoint, Status, error) {
 	id := revisionID{namespace, name}
 
 	f.recordMutex.Lock()
@@ -314,7 +438,7 @@ func concurrentTest(a Activator, f *fakeActivator, ids []revisionID) []activatio
 		end.Add(1)
 		go func(index int, id revisionID) {
 			start.Done()
-			endpoint, status, err := a.ActiveEndpoint(id.namespace, id.name)
+			endpoint, status, err := a.ActiveEndpoint(context.TODO(), id.namespace, id.name)
 			results[index] = activationResult{endpoint, status, err}
 			end.Done()
 		}(i, id)
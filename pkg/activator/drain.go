@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/knative/serving/pkg/network"
+)
+
+// kubeProbeUserAgentPrefix starts the User-Agent of the kubelet's probes.
+const kubeProbeUserAgentPrefix = "kube-probe/"
+
+// Drainer wraps a handler to keep track of the requests it is serving,
+// so that they can be waited for on shutdown. It answers the kubelet's
+// probes with health until draining, then fails readiness so that the
+// pod stops receiving new requests.
+type Drainer struct {
+	drainer *network.Drainer
+	health  *Health
+}
+
+// NewDrainer creates a Drainer serving requests with h.
+func NewDrainer(h http.Handler, health *Health) *Drainer {
+	return &Drainer{
+		// The activator fails readiness as soon as it drains, so there
+		// is no window over which requests keep being routed to it.
+		drainer: network.NewDrainer(h, 0),
+		health:  health,
+	}
+}
+
+func (d *Drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("User-Agent"), kubeProbeUserAgentPrefix) {
+		switch {
+		case !d.Draining():
+			d.health.ServeHTTP(w, r)
+		case r.URL.Path == HealthzPath:
+			// Parts of the activator stop while it drains, which must not
+			// get it restarted.
+			fmt.Fprintln(w, "ok")
+		default:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		}
+		return
+	}
+	d.drainer.ServeHTTP(w, r)
+}
+
+// Draining reports whether Drain was called.
+func (d *Drainer) Draining() bool {
+	return d.drainer.Draining()
+}
+
+// Drain starts failing the kubelet's probes and waits up to timeout from
+// the first call for the requests in flight to finish. It reports whether
+// they did.
+func (d *Drainer) Drain(timeout time.Duration) bool {
+	return d.drainer.Drain(timeout)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func kubeProbe(path string) *http.Request {
+	r := httptest.NewRequest("GET", "http://activator"+path, nil)
+	r.Header.Set("User-Agent", "kube-probe/1.10")
+	return r
+}
+
+func TestDrainer_Probes(t *testing.T) {
+	d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unexpected kubelet probe passed to the handler.")
+	}), NewHealth())
+
+	resp := httptest.NewRecorder()
+	d.ServeHTTP(resp, kubeProbe(ReadyzPath))
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status before draining. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+
+	if !d.Drain(time.Second) {
+		t.Error("Expected an idle drainer to drain right away.")
+	}
+	resp = httptest.NewRecorder()
+	d.ServeHTTP(resp, kubeProbe(ReadyzPath))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status while draining. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+	}
+	// Draining does not make the activator unhealthy.
+	resp = httptest.NewRecorder()
+	d.ServeHTTP(resp, kubeProbe(HealthzPath))
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected liveness while draining. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+}
+
+func TestDrainer_WaitsForRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var once sync.Once
+	d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+	}), NewHealth())
+	done := make(chan struct{})
+	go func() {
+		d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://activator/", nil))
+		close(done)
+	}()
+	<-started
+
+	if d.Drain(50 * time.Millisecond) {
+		t.Error("Expected draining to time out with a request in flight.")
+	}
+	close(release)
+	<-done
+	if !d.Drain(time.Second) {
+		t.Error("Expected draining to finish once the request did.")
+	}
+
+	// Requests served while draining, like those still routed to the
+	// pod, are unaffected.
+	resp := httptest.NewRecorder()
+	d.ServeHTTP(resp, httptest.NewRequest("GET", "http://activator/", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status while draining. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+}
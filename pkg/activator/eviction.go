@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBackendEvicted is the error of requests that were waiting on a pod
+// when it was found to no longer be ready. They are retried against
+// another pod.
+var ErrBackendEvicted = errors.New("pod stopped being ready before responding")
+
+// EvictionTracker keeps track of the requests waiting on the response of
+// each pod, so that they can be re-dispatched as soon as the pod is
+// found to no longer be ready rather than waiting on it until they time
+// out.
+type EvictionTracker struct {
+	mux     sync.Mutex
+	waiting map[string]map[*waitingRequest]struct{}
+}
+
+type waitingRequest struct {
+	cancel  context.CancelFunc
+	evicted bool
+}
+
+// NewEvictionTracker creates an EvictionTracker.
+func NewEvictionTracker() *EvictionTracker {
+	return &EvictionTracker{
+		waiting: make(map[string]map[*waitingRequest]struct{}),
+	}
+}
+
+// Evict cancels the requests waiting on the response of the pod at the
+// host:port address addr, and returns how many there were.
+func (t *EvictionTracker) Evict(addr string) int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	waiting := t.waiting[addr]
+	delete(t.waiting, addr)
+	for w := range waiting {
+		w.evicted = true
+		w.cancel()
+	}
+	return len(waiting)
+}
+
+// wait returns a copy of ctx that is canceled if the pod at addr is
+// evicted, along with a func to call once the pod responded, which
+// reports whether it was evicted before.
+func (t *EvictionTracker) wait(ctx context.Context, addr string) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &waitingRequest{cancel: cancel}
+	t.mux.Lock()
+	if t.waiting[addr] == nil {
+		t.waiting[addr] = make(map[*waitingRequest]struct{})
+	}
+	t.waiting[addr][w] = struct{}{}
+	t.mux.Unlock()
+	return ctx, func() bool {
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		if waiting, ok := t.waiting[addr]; ok {
+			delete(waiting, w)
+			if len(waiting) == 0 {
+				delete(t.waiting, addr)
+			}
+		}
+		return w.evicted
+	}
+}
+
+type evictionsKey struct{}
+
+// WithEvictions returns a copy of ctx in which requests waiting on a pod
+// evicted from t are retried against another one, as set with
+// WithRetryHost.
+func WithEvictions(ctx context.Context, t *EvictionTracker) context.Context {
+	return context.WithValue(ctx, evictionsKey{}, t)
+}
+
+func evictionsFrom(ctx context.Context) *EvictionTracker {
+	t, _ := ctx.Value(evictionsKey{}).(*EvictionTracker)
+	return t
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// internalHeaderPrefix starts the names of the headers requests are
+// routed through Knative with, like Knative-Serving-Revision and
+// Knative-Serving-Namespace. They are meant for its components only.
+const internalHeaderPrefix = "Knative-Serving-"
+
+// connectionHeaders are the hop-by-hop headers of RFC 7230, section 6.1,
+// that make no sense past the connection a response is received on.
+// Trailer is left alone, as it announces the trailers of the response
+// being written, and Upgrade is handled with the status code.
+var connectionHeaders = []string{
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+}
+
+// StripInternalHeaders removes the headers Knative routes requests with
+// from h.
+func StripInternalHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), internalHeaderPrefix) {
+			delete(h, name)
+		}
+	}
+}
+
+// normalizeHopHeaders removes the hop-by-hop headers from the header h of
+// a response with the given status code. The headers named by Connection
+// are removed along with it, except for the close option, which still
+// tells the server to close the client's connection. Upgrade and its
+// Connection option are kept on 101 Switching Protocols responses.
+func normalizeHopHeaders(h http.Header, code int) {
+	upgrade := code == http.StatusSwitchingProtocols
+	var options []string
+	for _, v := range h["Connection"] {
+		for _, opt := range strings.Split(v, ",") {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "":
+			case strings.EqualFold(opt, "close"):
+				options = append(options, "close")
+			case upgrade && strings.EqualFold(opt, "Upgrade"):
+				options = append(options, "Upgrade")
+			default:
+				h.Del(opt)
+			}
+		}
+	}
+	h.Del("Connection")
+	if len(options) > 0 {
+		h.Set("Connection", strings.Join(options, ", "))
+	}
+	for _, name := range connectionHeaders {
+		h.Del(name)
+	}
+	if !upgrade {
+		h.Del("Upgrade")
+	}
+}
+
+// FilterHeaders is the stage keeping internal and hop-by-hop headers out
+// of the responses sent to clients, whether they were set by the
+// revision or by the activator itself.
+func FilterHeaders(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&headerFilterWriter{ResponseWriter: w}, r)
+	})
+}
+
+type headerFilterWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *headerFilterWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		// Informational responses come before the final one, which still
+		// has to be filtered.
+		w.wroteHeader = code >= http.StatusOK || code == http.StatusSwitchingProtocols
+		StripInternalHeaders(w.Header())
+		normalizeHopHeaders(w.Header(), code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerFilterWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, so that streamed responses are not held
+// back.
+func (w *headerFilterWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStripInternalHeaders(t *testing.T) {
+	h := http.Header{
+		"Knative-Serving-Revision":  {testRevision},
+		"Knative-Serving-Namespace": {testNamespace},
+		"knative-serving-probe":     {"true"},
+		"Content-Type":              {"text/plain"},
+	}
+	StripInternalHeaders(h)
+
+	want := http.Header{"Content-Type": {"text/plain"}}
+	if diff := cmp.Diff(want, h); diff != "" {
+		t.Errorf("Unexpected headers (-want +got): %v", diff)
+	}
+}
+
+func TestNormalizeHopHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		header http.Header
+		want   http.Header
+	}{{
+		name: "hop-by-hop headers",
+		code: http.StatusOK,
+		header: http.Header{
+			"Keep-Alive":         {"timeout=5"},
+			"Proxy-Authenticate": {"Basic"},
+			"Proxy-Connection":   {"keep-alive"},
+			"Transfer-Encoding":  {"chunked"},
+			"Upgrade":            {"websocket"},
+			"Trailer":            {"Grpc-Status"},
+			"Content-Type":       {"application/grpc"},
+		},
+		want: http.Header{
+			"Trailer":      {"Grpc-Status"},
+			"Content-Type": {"application/grpc"},
+		},
+	}, {
+		name: "connection options",
+		code: http.StatusOK,
+		header: http.Header{
+			"Connection":   {"X-Hop, keep-alive", "x-other"},
+			"X-Hop":        {"a"},
+			"X-Other":      {"b"},
+			"Content-Type": {"text/plain"},
+		},
+		want: http.Header{
+			"Content-Type": {"text/plain"},
+		},
+	}, {
+		name: "connection close",
+		code: http.StatusTemporaryRedirect,
+		header: http.Header{
+			"Connection": {"X-Hop, Close"},
+			"X-Hop":      {"a"},
+			"Location":   {"/"},
+		},
+		want: http.Header{
+			"Connection": {"close"},
+			"Location":   {"/"},
+		},
+	}, {
+		name: "upgrade",
+		code: http.StatusSwitchingProtocols,
+		header: http.Header{
+			"Connection": {"Upgrade"},
+			"Upgrade":    {"websocket"},
+			"Keep-Alive": {"timeout=5"},
+		},
+		want: http.Header{
+			"Connection": {"Upgrade"},
+			"Upgrade":    {"websocket"},
+		},
+	}, {
+		name: "upgrade refused",
+		code: http.StatusBadRequest,
+		header: http.Header{
+			"Connection": {"Upgrade"},
+			"Upgrade":    {"websocket"},
+		},
+		want: http.Header{},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalizeHopHeaders(test.header, test.code)
+			if diff := cmp.Diff(test.want, test.header); diff != "" {
+				t.Errorf("Unexpected headers (-want +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestFilterHeaders(t *testing.T) {
+	h := FilterHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Knative-Serving-Revision", testRevision)
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	want := http.Header{"Content-Type": {"text/plain"}}
+	if diff := cmp.Diff(want, resp.Header()); diff != "" {
+		t.Errorf("Unexpected response headers (-want +got): %v", diff)
+	}
+	if got := resp.Body.String(); got != "hello" {
+		t.Errorf("Unexpected body. Want %q. Got %q.", "hello", got)
+	}
+}
+
+func TestFilterHeaders_Flush(t *testing.T) {
+	h := FilterHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if !resp.Flushed {
+		t.Error("Expected the response to be flushed.")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// HealthzPath and ReadyzPath are the paths of the activator's
+	// liveness and readiness checks.
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// HealthChecker is implemented by Activators that can tell whether they
+// are working.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// Health collects the checks telling whether the activator is alive,
+// and should be restarted otherwise, and whether it is ready for
+// traffic.
+type Health struct {
+	mux   sync.Mutex
+	live  map[string]func() error
+	ready map[string]func() error
+}
+
+// NewHealth creates a Health without checks, so always alive and ready.
+func NewHealth() *Health {
+	return &Health{
+		live:  make(map[string]func() error),
+		ready: make(map[string]func() error),
+	}
+}
+
+// AddLivenessCheck adds a named check that must pass for the activator
+// to be alive. Liveness checks must also pass for it to be ready.
+func (h *Health) AddLivenessCheck(name string, check func() error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.live[name] = check
+}
+
+// AddReadinessCheck adds a named check that must pass for the activator
+// to be ready.
+func (h *Health) AddReadinessCheck(name string, check func() error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.ready[name] = check
+}
+
+// InformerSyncedCheck returns a check passing once synced does.
+func InformerSyncedCheck(synced cache.InformerSynced) func() error {
+	return func() error {
+		if !synced() {
+			return errors.New("not synced")
+		}
+		return nil
+	}
+}
+
+// Live returns the failures of the liveness checks.
+func (h *Health) Live() []string {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return failures(h.live)
+}
+
+// Ready returns the failures of the liveness and readiness checks.
+func (h *Health) Ready() []string {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return append(failures(h.live), failures(h.ready)...)
+}
+
+// ServeHTTP answers the liveness checks on HealthzPath and the readiness
+// checks on any other path, with a 503 listing the failures if any.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var failed []string
+	if r.URL.Path == HealthzPath {
+		failed = h.Live()
+	} else {
+		failed = h.Ready()
+	}
+	if len(failed) > 0 {
+		http.Error(w, strings.Join(failed, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func failures(checks map[string]func() error) []string {
+	var failed []string
+	for name, check := range checks {
+		if err := check(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
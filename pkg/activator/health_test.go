@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	h := NewHealth()
+	synced := false
+	h.AddReadinessCheck("informers", InformerSyncedCheck(func() bool { return synced }))
+	var liveErr error
+	h.AddLivenessCheck("monitor", func() error { return liveErr })
+
+	tests := []struct {
+		name     string
+		synced   bool
+		liveErr  error
+		path     string
+		wantCode int
+		wantBody string
+	}{{
+		name:     "not synced is alive",
+		path:     HealthzPath,
+		wantCode: http.StatusOK,
+		wantBody: "ok\n",
+	}, {
+		name:     "not synced is not ready",
+		path:     ReadyzPath,
+		wantCode: http.StatusServiceUnavailable,
+		wantBody: "informers: not synced\n",
+	}, {
+		name:     "synced is ready",
+		synced:   true,
+		path:     ReadyzPath,
+		wantCode: http.StatusOK,
+		wantBody: "ok\n",
+	}, {
+		name:     "dead is not ready",
+		synced:   true,
+		liveErr:  errors.New("stopped"),
+		path:     ReadyzPath,
+		wantCode: http.StatusServiceUnavailable,
+		wantBody: "monitor: stopped\n",
+	}, {
+		name:     "dead",
+		liveErr:  errors.New("stopped"),
+		path:     HealthzPath,
+		wantCode: http.StatusServiceUnavailable,
+		wantBody: "monitor: stopped\n",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			synced, liveErr = test.synced, test.liveErr
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, httptest.NewRequest("GET", "http://activator"+test.path, nil))
+			if resp.Code != test.wantCode {
+				t.Errorf("Unexpected status. Want %v. Got %v.", test.wantCode, resp.Code)
+			}
+			if got := resp.Body.String(); got != test.wantBody {
+				t.Errorf("Unexpected body. Want %q. Got %q.", test.wantBody, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+)
+
+// HedgeDelayFromAnnotations returns how long a revision has requests
+// wait before hedging them, or zero when it does not have them hedged.
+func HedgeDelayFromAnnotations(annotations map[string]string) (time.Duration, error) {
+	raw, ok := annotations[serving.HedgeDelayAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", serving.HedgeDelayAnnotationKey, err)
+	}
+	if delay <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive, got %v", serving.HedgeDelayAnnotationKey, delay)
+	}
+	return delay, nil
+}
+
+// HedgeHostFunc returns the host:port address of another pod than
+// primary to hedge a request against, along with a func to call once
+// the hedge is done with it. The address is empty when there is none.
+type HedgeHostFunc func(primary string) (string, func())
+
+type hedgeKey struct{}
+
+type hedge struct {
+	delay time.Duration
+	host  HedgeHostFunc
+}
+
+// WithHedging returns a copy of ctx in which requests without response
+// headers after delay are also sent to the address returned by f, the
+// first response received being kept and the other request canceled.
+func WithHedging(ctx context.Context, delay time.Duration, f HedgeHostFunc) context.Context {
+	return context.WithValue(ctx, hedgeKey{}, &hedge{delay: delay, host: f})
+}
+
+// hedgingRoundTripper sends requests hedged with WithHedging to two
+// pods when the first one is slow to respond. Only requests that are
+// safe to send twice and have no body to replay are hedged.
+type hedgingRoundTripper struct {
+	transport http.RoundTripper
+}
+
+// NewHedgingRoundTripper creates a RoundTripper sending requests through
+// transport, hedging them as set with WithHedging.
+func NewHedgingRoundTripper(transport http.RoundTripper) http.RoundTripper {
+	return &hedgingRoundTripper{transport: transport}
+}
+
+func (h *hedgingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	hg, _ := r.Context().Value(hedgeKey{}).(*hedge)
+	if hg == nil || !hedgeable(r) {
+		return h.transport.RoundTrip(r)
+	}
+
+	results := make(chan *hedgeAttempt, 2)
+	primary := h.send(r, nil, results)
+	timer := time.NewTimer(hg.delay)
+	select {
+	case a := <-results:
+		timer.Stop()
+		return a.response()
+	case <-timer.C:
+	}
+
+	host, done := hg.host(r.URL.Host)
+	if host == "" {
+		return (<-results).response()
+	}
+	hr := withHost(r, host)
+	hr.Body = nil
+	secondary := h.send(hr, done, results)
+
+	winner := <-results
+	if winner.err != nil {
+		// The other attempt may still succeed.
+		winner.finish()
+		return (<-results).response()
+	}
+	loser := primary
+	if winner == primary {
+		loser = secondary
+	}
+	loser.cancel()
+	go func() {
+		a := <-results
+		if a.resp != nil {
+			a.resp.Body.Close()
+		}
+		a.finish()
+	}()
+	return winner.response()
+}
+
+// hedgeable reports whether r may be sent to two pods at once: its
+// method is safe and it has neither a body nor a connection to upgrade.
+func hedgeable(r *http.Request) bool {
+	switch r.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	return r.ContentLength == 0 && r.Header.Get("Upgrade") == ""
+}
+
+type hedgeAttempt struct {
+	cancel context.CancelFunc
+	done   func()
+	resp   *http.Response
+	err    error
+}
+
+func (h *hedgingRoundTripper) send(r *http.Request, done func(), results chan<- *hedgeAttempt) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(r.Context())
+	a := &hedgeAttempt{cancel: cancel, done: done}
+	go func() {
+		a.resp, a.err = h.transport.RoundTrip(r.WithContext(ctx))
+		results <- a
+	}()
+	return a
+}
+
+// response returns the result of the attempt, whose request is kept
+// going until its response body is closed.
+func (a *hedgeAttempt) response() (*http.Response, error) {
+	if a.err != nil {
+		a.finish()
+		return nil, a.err
+	}
+	a.resp.Body = &hedgedBody{ReadCloser: a.resp.Body, finish: a.finish}
+	return a.resp, nil
+}
+
+func (a *hedgeAttempt) finish() {
+	a.cancel()
+	if a.done != nil {
+		a.done()
+	}
+}
+
+type hedgedBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+func (b *hedgedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.finish)
+	return err
+}
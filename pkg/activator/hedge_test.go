@@ -0,0 +1,214 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+)
+
+func TestHedgeDelayFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        time.Duration
+		wantErr     bool
+	}{{
+		name: "not annotated",
+	}, {
+		name:        "hedged",
+		annotations: map[string]string{serving.HedgeDelayAnnotationKey: "50ms"},
+		want:        50 * time.Millisecond,
+	}, {
+		name:        "zero",
+		annotations: map[string]string{serving.HedgeDelayAnnotationKey: "0s"},
+		wantErr:     true,
+	}, {
+		name:        "invalid",
+		annotations: map[string]string{serving.HedgeDelayAnnotationKey: "50"},
+		wantErr:     true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := HedgeDelayFromAnnotations(test.annotations)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("HedgeDelayFromAnnotations() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Unexpected result. Want %v. Got %v.", test.want, got)
+			}
+		})
+	}
+}
+
+// hedgeBackend answers with its name after waiting for delay, unless
+// its request is canceled first.
+type hedgeBackend struct {
+	*httptest.Server
+	canceled chan struct{}
+}
+
+func newHedgeBackend(name string, delay time.Duration) *hedgeBackend {
+	b := &hedgeBackend{canceled: make(chan struct{}, 1)}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			b.canceled <- struct{}{}
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	return b
+}
+
+func (b *hedgeBackend) host() string {
+	u, _ := url.Parse(b.URL)
+	return u.Host
+}
+
+func TestHedgingRoundTripper(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		primaryDelay time.Duration
+		noSecondary  bool
+		wantBody     string
+		wantHedged   bool
+	}{{
+		name:     "fast primary",
+		wantBody: "primary",
+	}, {
+		name:         "slow primary",
+		primaryDelay: time.Second,
+		wantBody:     "secondary",
+		wantHedged:   true,
+	}, {
+		name:         "no other pod",
+		primaryDelay: 200 * time.Millisecond,
+		noSecondary:  true,
+		wantBody:     "primary",
+	}, {
+		name:         "post not hedged",
+		method:       http.MethodPost,
+		primaryDelay: 200 * time.Millisecond,
+		wantBody:     "primary",
+	}, {
+		name:         "body not hedged",
+		body:         "hello",
+		primaryDelay: 200 * time.Millisecond,
+		wantBody:     "primary",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			primary := newHedgeBackend("primary", test.primaryDelay)
+			defer primary.Close()
+			secondary := newHedgeBackend("secondary", 0)
+			defer secondary.Close()
+
+			var hedged, released int32
+			ctx := WithHedging(context.Background(), 20*time.Millisecond, func(host string) (string, func()) {
+				if host != primary.host() {
+					t.Errorf("Unexpected primary. Want %v. Got %v.", primary.host(), host)
+				}
+				if test.noSecondary {
+					return "", nil
+				}
+				atomic.StoreInt32(&hedged, 1)
+				return secondary.host(), func() { atomic.AddInt32(&released, 1) }
+			})
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, primary.URL, strings.NewReader(test.body))
+			r.RequestURI = ""
+
+			resp, err := NewHedgingRoundTripper(http.DefaultTransport).RoundTrip(r.WithContext(ctx))
+			if err != nil {
+				t.Fatalf("RoundTrip() = %v", err)
+			}
+			got, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(got) != test.wantBody {
+				t.Errorf("Unexpected body. Want %v. Got %v.", test.wantBody, string(got))
+			}
+			if got := atomic.LoadInt32(&hedged) == 1; got != test.wantHedged {
+				t.Errorf("Unexpected hedging. Want %v. Got %v.", test.wantHedged, got)
+			}
+			if test.wantHedged {
+				select {
+				case <-primary.canceled:
+				case <-time.After(3 * time.Second):
+					t.Error("Timed out waiting for the slow primary request to be canceled.")
+				}
+				if got := atomic.LoadInt32(&released); got != 1 {
+					t.Errorf("Unexpected hedge releases. Want 1. Got %d.", got)
+				}
+			}
+		})
+	}
+}
+
+// slowFailingTransport fails requests to host after delay, and sends
+// the others through http.DefaultTransport.
+type slowFailingTransport struct {
+	host  string
+	delay time.Duration
+}
+
+func (f *slowFailingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host == f.host {
+		time.Sleep(f.delay)
+		return nil, errors.New("connection reset by peer")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHedgingRoundTripper_PrimaryFailsAfterHedging(t *testing.T) {
+	primary := newHedgeBackend("primary", 0)
+	defer primary.Close()
+	secondary := newHedgeBackend("secondary", 50*time.Millisecond)
+	defer secondary.Close()
+
+	ctx := WithHedging(context.Background(), 10*time.Millisecond, func(string) (string, func()) {
+		return secondary.host(), nil
+	})
+	r := httptest.NewRequest(http.MethodGet, primary.URL, nil)
+	r.RequestURI = ""
+
+	transport := &slowFailingTransport{host: primary.host(), delay: 30 * time.Millisecond}
+	resp, err := NewHedgingRoundTripper(transport).RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("RoundTrip() = %v", err)
+	}
+	defer resp.Body.Close()
+	if got, _ := ioutil.ReadAll(resp.Body); string(got) != "secondary" {
+		t.Errorf("Unexpected body. Want secondary. Got %v.", string(got))
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The load balancing policies spreading requests across the ready pods
+// of a revision.
+const (
+	RandomChoiceOfTwoPolicy = "random-choice-of-two"
+	RoundRobinPolicy        = "round-robin"
+	LeastInflightPolicy     = "least-inflight"
+)
+
+// LoadBalancer picks which of the addresses serving a revision a request
+// is sent to.
+type LoadBalancer interface {
+	// Pick returns one of addrs, which must not be empty, for a request
+	// to the revision identified by key, and a func to call once the
+	// request is done.
+	Pick(key string, addrs []string) (string, func())
+}
+
+// NewLoadBalancer creates a LoadBalancer applying the named policy.
+func NewLoadBalancer(policy string) (LoadBalancer, error) {
+	switch policy {
+	case RandomChoiceOfTwoPolicy:
+		return &randomChoiceOfTwo{
+			inflight: newInflight(),
+			rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		}, nil
+	case RoundRobinPolicy:
+		return &roundRobin{
+			inflight: newInflight(),
+			next:     make(map[string]int),
+		}, nil
+	case LeastInflightPolicy:
+		return &leastInflight{newInflight()}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing policy %q", policy)
+	}
+}
+
+// inflight counts the requests in flight to each address.
+type inflight struct {
+	mux    sync.Mutex
+	counts map[string]int
+}
+
+func newInflight() *inflight {
+	return &inflight{counts: make(map[string]int)}
+}
+
+// start records a request to addr, which must be called with mux held,
+// and returns the func recording its end.
+func (f *inflight) start(addr string) func() {
+	f.counts[addr]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mux.Lock()
+			defer f.mux.Unlock()
+			f.counts[addr]--
+			if f.counts[addr] <= 0 {
+				delete(f.counts, addr)
+			}
+		})
+	}
+}
+
+type randomChoiceOfTwo struct {
+	*inflight
+	rand *rand.Rand // for testing
+}
+
+func (lb *randomChoiceOfTwo) Pick(key string, addrs []string) (string, func()) {
+	lb.mux.Lock()
+	defer lb.mux.Unlock()
+	addr := addrs[lb.rand.Intn(len(addrs))]
+	if len(addrs) > 1 {
+		// Pick a second, different address and keep the less loaded one.
+		i := lb.rand.Intn(len(addrs) - 1)
+		if addrs[i] == addr {
+			i = len(addrs) - 1
+		}
+		if lb.counts[addrs[i]] < lb.counts[addr] {
+			addr = addrs[i]
+		}
+	}
+	return addr, lb.start(addr)
+}
+
+type roundRobin struct {
+	*inflight
+	next map[string]int
+}
+
+func (lb *roundRobin) Pick(key string, addrs []string) (string, func()) {
+	lb.mux.Lock()
+	defer lb.mux.Unlock()
+	addr := addrs[lb.next[key]%len(addrs)]
+	lb.next[key] = (lb.next[key] + 1) % len(addrs)
+	return addr, lb.start(addr)
+}
+
+type leastInflight struct {
+	*inflight
+}
+
+func (lb *leastInflight) Pick(key string, addrs []string) (string, func()) {
+	lb.mux.Lock()
+	defer lb.mux.Unlock()
+	addr := addrs[0]
+	for _, a := range addrs[1:] {
+		if lb.counts[a] < lb.counts[addr] {
+			addr = a
+		}
+	}
+	return addr, lb.start(addr)
+}
+
+// slowStartMinWeight is the share of requests a pod gets at the start
+// of its slow-start window, relative to the pods already warm.
+const slowStartMinWeight = 0.1
+
+// PodBalancer spreads the requests to a revision across its ready pods.
+type PodBalancer struct {
+	backends RevisionBackends
+	self     string
+
+	// for testing
+	now func() time.Time
+
+	mux        sync.Mutex
+	lb         LoadBalancer
+	subsetSize int
+	slowStart  time.Duration
+	rand       *rand.Rand
+}
+
+// NewPodBalancer creates a PodBalancer picking pods with lb among the
+// addresses listed by backends. Only the subset of subsetSize pods
+// that SubsetAddresses assigns to self is used, so that each activator
+// replica keeps connections to a few pods of large revisions while the
+// replicas together cover all of them. A subsetSize of zero or less uses
+// every ready pod. Pods that became ready within the last slowStart get
+// a share of the requests ramping up from slowStartMinWeight to a full
+// one over that window, so that they are not swamped by the requests
+// queued on a cold start. A slowStart of zero disables the ramp.
+func NewPodBalancer(lb LoadBalancer, backends RevisionBackends, self string, subsetSize int, slowStart time.Duration) *PodBalancer {
+	return &PodBalancer{
+		lb:         lb,
+		backends:   backends,
+		self:       self,
+		subsetSize: subsetSize,
+		slowStart:  slowStart,
+		now:        time.Now,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetConfig replaces the load balancer and the subset and slow-start
+// settings used for requests picked from then on. A nil lb keeps the
+// current one, along with the requests it counts in flight.
+func (b *PodBalancer) SetConfig(lb LoadBalancer, subsetSize int, slowStart time.Duration) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if lb != nil {
+		b.lb = lb
+	}
+	b.subsetSize = subsetSize
+	b.slowStart = slowStart
+}
+
+// Pick returns the endpoint of the pod a request to the named revision,
+// active at ep, is sent to, and a func to call once the request is done.
+// It falls back to ep while no ready pod is known.
+func (b *PodBalancer) Pick(namespace, name string, ep Endpoint) (Endpoint, func()) {
+	return b.pick(namespace, name, ep, "")
+}
+
+// PickOther is like Pick, but avoids the pod at the host:port address
+// failed that a request could not be served by, unless it is the only
+// one ready.
+func (b *PodBalancer) PickOther(namespace, name string, ep Endpoint, failed string) (Endpoint, func()) {
+	return b.pick(namespace, name, ep, failed)
+}
+
+func (b *PodBalancer) pick(namespace, name string, ep Endpoint, failed string) (Endpoint, func()) {
+	b.mux.Lock()
+	lb, subsetSize, slowStart := b.lb, b.subsetSize, b.slowStart
+	b.mux.Unlock()
+	addrs := SubsetAddresses(b.backends.Backends(namespace, name), b.self, subsetSize)
+	if failed != "" && len(addrs) > 1 {
+		others := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			if addr != failed {
+				others = append(others, addr)
+			}
+		}
+		addrs = others
+	}
+	if len(addrs) == 0 {
+		return ep, func() {}
+	}
+	addrs = b.rampUp(namespace, name, addrs, slowStart)
+	addr, done := lb.Pick(namespace+"/"+name, addrs)
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	ep.FQDN = host
+	ep.Port = int32(p)
+	ep.Pod = nil
+	if pod, ok := b.backends.Pod(namespace, name, addr); ok {
+		ep.Pod = &pod
+	}
+	return ep, done
+}
+
+// rampUp drops each of addrs still within its slowStart window with a
+// probability falling to zero over the window, so that the pods behind
+// them get a growing share of the requests. Not all of addrs are
+// dropped.
+func (b *PodBalancer) rampUp(namespace, name string, addrs []string, slowStart time.Duration) []string {
+	if slowStart <= 0 {
+		return addrs
+	}
+	now := b.now()
+	kept := make([]string, 0, len(addrs))
+	b.mux.Lock()
+	for _, addr := range addrs {
+		age := now.Sub(b.backends.ReadySince(namespace, name, addr))
+		if age >= slowStart {
+			kept = append(kept, addr)
+			continue
+		}
+		weight := slowStartMinWeight + (1-slowStartMinWeight)*float64(age)/float64(slowStart)
+		if b.rand.Float64() < weight {
+			kept = append(kept, addr)
+		}
+	}
+	b.mux.Unlock()
+	if len(kept) == 0 {
+		return addrs
+	}
+	return kept
+}
+
+// ReadyAddresses returns the host:port addresses of the ready pods in
+// eps, sorted.
+func ReadyAddresses(eps *corev1.Endpoints) []string {
+	var addrs []string
+	for _, subset := range eps.Subsets {
+		// TODO: in the future, the target service could have more than one port.
+		// https://github.com/knative/serving/issues/837
+		if len(subset.Ports) != 1 {
+			continue
+		}
+		port := strconv.Itoa(int(subset.Ports[0].Port))
+		for _, addr := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(addr.IP, port))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// SubsetAddresses returns the size addresses of addrs assigned to the
+// activator identified by self, sorted, or all of addrs if there are no
+// more than size. Addresses are ranked by a hash of self and the address,
+// so that every replica gets a different subset which only changes by
+// the pods added or removed.
+func SubsetAddresses(addrs []string, self string, size int) []string {
+	if size <= 0 || len(addrs) <= size {
+		return addrs
+	}
+	weights := make(map[string]uint64, len(addrs))
+	for _, addr := range addrs {
+		h := fnv.New64a()
+		h.Write([]byte(self))
+		h.Write([]byte{0})
+		h.Write([]byte(addr))
+		weights[addr] = h.Sum64()
+	}
+	ranked := append([]string(nil), addrs...)
+	sort.Slice(ranked, func(i, j int) bool {
+		return weights[ranked[i]] > weights[ranked[j]]
+	})
+	subset := ranked[:size]
+	sort.Strings(subset)
+	return subset
+}
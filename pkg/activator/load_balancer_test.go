@@ -0,0 +1,312 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+var testAddrs = []string{"10.0.0.1:8012", "10.0.0.2:8012", "10.0.0.3:8012"}
+
+func TestRoundRobin(t *testing.T) {
+	lb, err := NewLoadBalancer(RoundRobinPolicy)
+	if err != nil {
+		t.Fatalf("NewLoadBalancer() = %v", err)
+	}
+	var got []string
+	for i := 0; i < 4; i++ {
+		addr, done := lb.Pick("default/rev1", testAddrs)
+		done()
+		got = append(got, addr)
+	}
+	want := append(append([]string{}, testAddrs...), testAddrs[0])
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected picks (-want, +got) = %v", diff)
+	}
+	// Revisions take turns independently.
+	if addr, _ := lb.Pick("default/rev2", testAddrs); addr != testAddrs[0] {
+		t.Errorf("Unexpected pick for another revision. Want %v. Got %v.", testAddrs[0], addr)
+	}
+}
+
+func TestLeastInflight(t *testing.T) {
+	lb, err := NewLoadBalancer(LeastInflightPolicy)
+	if err != nil {
+		t.Fatalf("NewLoadBalancer() = %v", err)
+	}
+	first, doneFirst := lb.Pick("default/rev1", testAddrs)
+	second, _ := lb.Pick("default/rev1", testAddrs)
+	third, _ := lb.Pick("default/rev1", testAddrs)
+	if diff := cmp.Diff(testAddrs, []string{first, second, third}); diff != "" {
+		t.Errorf("Unexpected picks (-want, +got) = %v", diff)
+	}
+	doneFirst()
+	doneFirst() // Calling done twice only counts once.
+	if addr, _ := lb.Pick("default/rev1", testAddrs); addr != first {
+		t.Errorf("Unexpected pick after a request finished. Want %v. Got %v.", first, addr)
+	}
+	if addr, _ := lb.Pick("default/rev1", testAddrs); addr != testAddrs[0] {
+		t.Errorf("Unexpected pick with all addresses equally loaded. Want %v. Got %v.", testAddrs[0], addr)
+	}
+}
+
+func TestRandomChoiceOfTwo(t *testing.T) {
+	lb, err := NewLoadBalancer(RandomChoiceOfTwoPolicy)
+	if err != nil {
+		t.Fatalf("NewLoadBalancer() = %v", err)
+	}
+	addrs := testAddrs[:2]
+	// With two addresses both are always compared, so the load stays even.
+	for i := 0; i < 10; i++ {
+		lb.Pick("default/rev1", addrs)
+	}
+	counts := lb.(*randomChoiceOfTwo).counts
+	if counts[addrs[0]] != 5 || counts[addrs[1]] != 5 {
+		t.Errorf("Unexpected in-flight requests. Want 5 each. Got %v.", counts)
+	}
+	if addr, _ := lb.Pick("default/rev1", testAddrs[:1]); addr != testAddrs[0] {
+		t.Errorf("Unexpected pick of a single address. Want %v. Got %v.", testAddrs[0], addr)
+	}
+}
+
+func TestNewLoadBalancer_Unknown(t *testing.T) {
+	if _, err := NewLoadBalancer("fastest"); err == nil {
+		t.Error("Expected error for an unknown policy. Got nil.")
+	}
+}
+
+// fakeBackends lists the backends of revisions keyed by namespace/name.
+// Each backend is served by a pod named after its address.
+type fakeBackends map[string][]string
+
+func (f fakeBackends) Backends(namespace, name string) []string {
+	return f[namespace+"/"+name]
+}
+
+func (f fakeBackends) Pod(namespace, name, addr string) (Pod, bool) {
+	for _, a := range f[namespace+"/"+name] {
+		if a == addr {
+			return Pod{Name: "pod-" + addr}, true
+		}
+	}
+	return Pod{}, false
+}
+
+func (f fakeBackends) ReadySince(namespace, name, addr string) time.Time {
+	return time.Time{}
+}
+
+// rampingBackends are fakeBackends whose pods became ready at the given
+// times.
+type rampingBackends struct {
+	fakeBackends
+	readySince map[string]time.Time
+}
+
+func (r rampingBackends) ReadySince(namespace, name, addr string) time.Time {
+	return r.readySince[addr]
+}
+
+func TestPodBalancer(t *testing.T) {
+	backends := fakeBackends{}
+	lb, _ := NewLoadBalancer(RoundRobinPolicy)
+	b := NewPodBalancer(lb, backends, "activator-1", 0, 0)
+	ep := Endpoint{FQDN: testServiceFQDN, Port: 8080, Protocol: v1alpha1.RevisionProtocolH2C}
+
+	// Without known pods, requests go to the service.
+	if got, _ := b.Pick(testNamespace, testRevision, ep); got != ep {
+		t.Errorf("Unexpected endpoint without pods. Want %+v. Got %+v.", ep, got)
+	}
+
+	backends[testNamespace+"/"+testRevision] = []string{"10.0.0.1:8012", "10.0.0.2:8012"}
+	got, done := b.Pick(testNamespace, testRevision, ep)
+	defer done()
+	want := Endpoint{
+		FQDN:     "10.0.0.1",
+		Port:     8012,
+		Protocol: v1alpha1.RevisionProtocolH2C,
+		Pod:      &Pod{Name: "pod-10.0.0.1:8012"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected endpoint (-want +got): %v", diff)
+	}
+
+	// The pod a request failed against is skipped, though it is next.
+	got, done = b.PickOther(testNamespace, testRevision, ep, "10.0.0.2:8012")
+	defer done()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected endpoint avoiding the failed pod (-want +got): %v", diff)
+	}
+}
+
+func TestPodBalancer_SlowStart(t *testing.T) {
+	now := time.Now()
+	backends := rampingBackends{
+		fakeBackends: fakeBackends{
+			testNamespace + "/" + testRevision: {"10.0.0.1:8012", "10.0.0.2:8012", "10.0.0.3:8012"},
+		},
+		readySince: map[string]time.Time{
+			"10.0.0.1:8012": now.Add(-time.Hour),
+			"10.0.0.2:8012": now,
+			"10.0.0.3:8012": now.Add(-5 * time.Second),
+		},
+	}
+	lb, _ := NewLoadBalancer(RoundRobinPolicy)
+	b := NewPodBalancer(lb, backends, "activator-1", 0, 10*time.Second)
+	b.now = func() time.Time { return now }
+	b.rand = rand.New(rand.NewSource(1))
+
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		ep, done := b.Pick(testNamespace, testRevision, Endpoint{})
+		counts[ep.Address()]++
+		done()
+	}
+	// The pod that just became ready gets the smallest share, and the one
+	// halfway through its window a larger one, still short of the share
+	// of the warm pod.
+	warm, fresh, halfway := counts["10.0.0.1:8012"], counts["10.0.0.2:8012"], counts["10.0.0.3:8012"]
+	if fresh == 0 || fresh >= warm/5 {
+		t.Errorf("Unexpected share of a pod that just became ready. Want some under %d. Got %d.", warm/5, fresh)
+	}
+	if halfway <= fresh || halfway >= warm {
+		t.Errorf("Unexpected share of a pod halfway through its window. Want between %d and %d. Got %d.", fresh, warm, halfway)
+	}
+
+	// Once their window is over, pods get a full share.
+	b.now = func() time.Time { return now.Add(time.Minute) }
+	counts = make(map[string]int)
+	for i := 0; i < 300; i++ {
+		ep, done := b.Pick(testNamespace, testRevision, Endpoint{})
+		counts[ep.Address()]++
+		done()
+	}
+	for addr, n := range counts {
+		if n != 100 {
+			t.Errorf("Unexpected share of %s after its window. Want 100. Got %d.", addr, n)
+		}
+	}
+}
+
+func TestPodBalancer_SetConfig(t *testing.T) {
+	backends := fakeBackends{
+		testNamespace + "/" + testRevision: {"10.0.0.1:8012", "10.0.0.2:8012", "10.0.0.3:8012"},
+	}
+	lb, _ := NewLoadBalancer(LeastInflightPolicy)
+	b := NewPodBalancer(lb, backends, "activator-1", 0, 0)
+
+	// The least loaded pod is picked while a request is in flight to the
+	// first one.
+	first, firstDone := b.Pick(testNamespace, testRevision, Endpoint{})
+	if got, done := b.Pick(testNamespace, testRevision, Endpoint{}); got.Address() == first.Address() {
+		t.Errorf("Unexpected pick of the loaded pod %s.", got.Address())
+	} else {
+		done()
+	}
+
+	// Without a new load balancer, the requests in flight are still
+	// counted.
+	b.SetConfig(nil, 1, 0)
+	for i := 0; i < 3; i++ {
+		ep, done := b.Pick(testNamespace, testRevision, Endpoint{})
+		done()
+		if want := SubsetAddresses(backends[testNamespace+"/"+testRevision], "activator-1", 1); ep.Address() != want[0] {
+			t.Errorf("Unexpected pick outside of the subset. Want %s. Got %s.", want[0], ep.Address())
+		}
+	}
+	firstDone()
+
+	rr, _ := NewLoadBalancer(RoundRobinPolicy)
+	b.SetConfig(rr, 0, 0)
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		ep, done := b.Pick(testNamespace, testRevision, Endpoint{})
+		counts[ep.Address()]++
+		done()
+	}
+	for addr, n := range counts {
+		if n != 2 {
+			t.Errorf("Unexpected share of %s with round robin. Want 2. Got %d.", addr, n)
+		}
+	}
+}
+
+func TestSubsetAddresses(t *testing.T) {
+	addrs := make([]string, 100)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.0.%d:8012", i)
+	}
+
+	if got := SubsetAddresses(addrs, "activator-1", 0); !cmp.Equal(addrs, got) {
+		t.Errorf("Unexpected subset without a size. Want %v. Got %v.", addrs, got)
+	}
+	if got := SubsetAddresses(addrs[:5], "activator-1", 10); !cmp.Equal(addrs[:5], got) {
+		t.Errorf("Unexpected subset of fewer addresses than its size. Want %v. Got %v.", addrs[:5], got)
+	}
+
+	subset := SubsetAddresses(addrs, "activator-1", 10)
+	if len(subset) != 10 {
+		t.Fatalf("Unexpected subset size. Want 10. Got %v.", len(subset))
+	}
+	if !sort.StringsAreSorted(subset) {
+		t.Errorf("Unexpected unsorted subset %v", subset)
+	}
+	if got := SubsetAddresses(addrs, "activator-1", 10); !cmp.Equal(subset, got) {
+		t.Errorf("Unexpected subset change. Want %v. Got %v.", subset, got)
+	}
+	if got := SubsetAddresses(addrs, "activator-2", 10); cmp.Equal(subset, got) {
+		t.Errorf("Unexpected identical subsets for different activators: %v", got)
+	}
+
+	// Removing a pod outside of the subset leaves it unchanged, and
+	// removing one in it only replaces that pod.
+	var without []string
+	for _, addr := range addrs {
+		if addr != subset[0] {
+			without = append(without, addr)
+		}
+	}
+	got := SubsetAddresses(without, "activator-1", 10)
+	kept := 0
+	for _, addr := range got {
+		for _, old := range subset {
+			if addr == old {
+				kept++
+			}
+		}
+	}
+	if kept != 9 {
+		t.Errorf("Unexpected subset churn. Want 9 pods kept. Got %v: %v", kept, got)
+	}
+
+	// Together, the replicas cover every pod.
+	covered := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		for _, addr := range SubsetAddresses(addrs, fmt.Sprintf("activator-%d", i), 10) {
+			covered[addr] = true
+		}
+	}
+	if len(covered) < 90 {
+		t.Errorf("Unexpected coverage of 30 subsets of 10 out of 100 pods. Want at least 90. Got %v.", len(covered))
+	}
+}
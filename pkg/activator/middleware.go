@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Middleware is a stage of the activator's handler, wrapping the stages
+// after it with cross-cutting behavior such as authentication, rate
+// limiting or header rewriting.
+type Middleware func(http.Handler) http.Handler
+
+// Chain returns h wrapped in middlewares, the first of which sees
+// requests first.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+var (
+	registeredMux        sync.Mutex
+	registeredMiddleware []Middleware
+)
+
+// RegisterMiddleware adds m to the stages of the activator's handler,
+// after the ones registered before it. Requests reach registered stages
+// once traced and set up for access logging and metrics, and before they
+// wait on their revision's activation. Extensions register their stages
+// from the init function of a package imported by the activator binary.
+func RegisterMiddleware(m Middleware) {
+	registeredMux.Lock()
+	defer registeredMux.Unlock()
+	registeredMiddleware = append(registeredMiddleware, m)
+}
+
+// RegisteredMiddleware returns the stages added by RegisterMiddleware, in
+// the order they were registered.
+func RegisteredMiddleware() []Middleware {
+	registeredMux.Lock()
+	defer registeredMux.Unlock()
+	return append([]Middleware(nil), registeredMiddleware...)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// stage returns a Middleware recording its name in the order header.
+func stage(name string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("Order", name)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var got []string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header["Order"]
+	}), stage("first"), stage("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if want := []string{"first", "second"}; !cmp.Equal(want, got) {
+		t.Errorf("Unexpected order of stages. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestRegisterMiddleware(t *testing.T) {
+	defer func(saved []Middleware) {
+		registeredMiddleware = saved
+	}(registeredMiddleware)
+	registeredMiddleware = nil
+
+	RegisterMiddleware(stage("auth"))
+	RegisterMiddleware(stage("ratelimit"))
+	var got []string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header["Order"]
+	}), RegisteredMiddleware()...)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if want := []string{"auth", "ratelimit"}; !cmp.Equal(want, got) {
+		t.Errorf("Unexpected order of registered stages. Want %v. Got %v.", want, got)
+	}
+}
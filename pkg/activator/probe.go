@@ -0,0 +1,325 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/probe"
+	"go.opencensus.io/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// probeUserAgent is sent with HTTP probes. The queue-proxy does not
+	// count requests from "kube-probe/" user agents towards concurrency.
+	probeUserAgent = "kube-probe/activator"
+
+	// spanStatusUnknown is the google.rpc.Code of spans for failed probes.
+	spanStatusUnknown = 2
+
+	// defaultProbePeriod is used when a probe does not set PeriodSeconds.
+	// It is much shorter than the kubelet default since requests are
+	// waiting on the result.
+	defaultProbePeriod = 200 * time.Millisecond
+)
+
+// ProbeTarget is an address together with the probe to run against it.
+type ProbeTarget struct {
+	Host string
+	Port int32
+
+	// Pod, if set, is the pod Host addresses directly.
+	Pod *Pod
+
+	// Probe describes how to probe the target. Without an HTTPGet
+	// handler the target is probed by opening a TCP connection.
+	Probe *corev1.Probe
+
+	// ConnectTimeout bounds opening the connection and ResponseTimeout
+	// bounds waiting for the response headers once connected. When zero,
+	// each falls back to the timeout of Probe.
+	ConnectTimeout  time.Duration
+	ResponseTimeout time.Duration
+
+	// ExpectedBody, if set, must match the body of an HTTP probe response
+	// for the target to be considered ready.
+	ExpectedBody *regexp.Regexp
+
+	// H2C probes HTTP targets with HTTP/2 over cleartext, for targets
+	// that do not speak HTTP/1.
+	H2C bool
+
+	// TLS, if set, probes the target over TLS with this configuration.
+	// HTTP targets are then probed with HTTP/2 if they negotiate it,
+	// regardless of H2C.
+	TLS *tls.Config
+}
+
+// probeResult is the outcome of probing a single ProbeTarget.
+type probeResult struct {
+	Target ProbeTarget
+	// Err is nil if the target is ready.
+	Err error
+}
+
+// Prober performs a single probe attempt against a target.
+type Prober interface {
+	// Probe returns nil if the target is ready, or an error describing
+	// why it is not.
+	Probe(ctx context.Context, target ProbeTarget) error
+}
+
+var (
+	_ Prober = (*HttpGetProber)(nil)
+	_ Prober = (*TCPSocketProber)(nil)
+)
+
+// HttpGetProber probes a target with an HTTP GET request. Like the
+// kubelet, any status code in [200, 400) is considered a success.
+type HttpGetProber struct{}
+
+// Probe implements Prober.
+func (p *HttpGetProber) Probe(ctx context.Context, target ProbeTarget) error {
+	return (&probe.HTTPGetProber{}).Probe(ctx, target.probeTarget(ctx))
+}
+
+// ExpectedBodyFromAnnotations returns the expression that HTTP probe
+// responses must match according to the readiness probe body annotations,
+// or nil if neither is set.
+func ExpectedBodyFromAnnotations(annotations map[string]string) (*regexp.Regexp, error) {
+	substr, hasSubstr := annotations[serving.ReadinessProbeBodyAnnotationKey]
+	expr, hasExpr := annotations[serving.ReadinessProbeBodyRegexAnnotationKey]
+	switch {
+	case hasSubstr && hasExpr:
+		return nil, fmt.Errorf("only one of %s and %s may be set",
+			serving.ReadinessProbeBodyAnnotationKey, serving.ReadinessProbeBodyRegexAnnotationKey)
+	case hasSubstr:
+		return regexp.MustCompile(regexp.QuoteMeta(substr)), nil
+	case hasExpr:
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", serving.ReadinessProbeBodyRegexAnnotationKey, err)
+		}
+		return re, nil
+	default:
+		return nil, nil
+	}
+}
+
+// TCPSocketProber probes a target by opening a TCP connection to it.
+type TCPSocketProber struct{}
+
+// Probe implements Prober.
+func (p *TCPSocketProber) Probe(ctx context.Context, target ProbeTarget) error {
+	return (&probe.TCPSocketProber{}).Probe(ctx, target.probeTarget(ctx))
+}
+
+// NewProber returns the Prober implementation for the given probe.
+func NewProber(probe *corev1.Probe) Prober {
+	// TODO: Probe with the gRPC health protocol when probe.GRPC is set.
+	// The vendored Kubernetes API (1.10) predates GRPCAction, and no gRPC
+	// client is vendored, so gRPC probes need a dependency update first.
+	if probe != nil && probe.HTTPGet != nil {
+		return &HttpGetProber{}
+	}
+	return &TCPSocketProber{}
+}
+
+// CheckProbe probes the target until it succeeds SuccessThreshold times
+// in a row, or until ctx is done, and returns the number of probes it ran.
+// Progress is recorded in DefaultProbeTracker.
+func CheckProbe(ctx context.Context, target ProbeTarget) (int, error) {
+	return DefaultProbeTracker.CheckProbe(ctx, target)
+}
+
+// CheckProbe is like the package-level CheckProbe but records its
+// progress in t. The loop and each attempt are traced.
+//
+// TODO: Run the startup probe of the container first, as the kubelet does,
+// with its FailureThreshold defaulting to 3. The vendored Kubernetes API
+// (1.10) predates Container.StartupProbe, so this needs a dependency
+// update first.
+func (t *ProbeTracker) CheckProbe(ctx context.Context, target ProbeTarget) (attempts int, err error) {
+	ctx, span := trace.StartSpan(ctx, "activator/check_probe")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("target", getHostFromProbe(target)))
+	if id := RequestIDFrom(ctx); id != "" {
+		span.AddAttributes(trace.StringAttribute("request_id", id))
+	}
+	defer func() {
+		span.AddAttributes(
+			trace.Int64Attribute("attempts", int64(attempts)),
+			trace.BoolAttribute("ready", err == nil))
+		if err != nil {
+			span.SetStatus(trace.Status{Code: spanStatusUnknown, Message: err.Error()})
+		}
+	}()
+
+	prober := NewProber(target.Probe)
+	period := probePeriod(target.Probe)
+	threshold := 1
+	if target.Probe != nil && target.Probe.SuccessThreshold > 0 {
+		threshold = int(target.Probe.SuccessThreshold)
+	}
+
+	id := t.start(target)
+	var lastErr error
+	successes := 0
+	for {
+		attempts++
+		lastErr = probeWithSpan(ctx, prober, target, attempts)
+		t.attempt(id, lastErr)
+		if lastErr == nil {
+			successes++
+			if successes >= threshold {
+				t.finish(id, true)
+				return attempts, nil
+			}
+		} else {
+			successes = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			t.finish(id, false)
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return attempts, fmt.Errorf("probe of %s did not succeed: %v", getHostFromProbe(target), lastErr)
+		case <-time.After(period):
+		}
+	}
+}
+
+// probeAll probes every target once, running at most concurrency probes
+// at a time. Results are returned in the same order as targets. A
+// concurrency of zero or less probes all targets at once. The
+// RevisionBackendsManager probes the pods added to revisions with it.
+func probeAll(ctx context.Context, targets []ProbeTarget, concurrency int) []probeResult {
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+	results := make([]probeResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target ProbeTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = probeResult{
+				Target: target,
+				Err:    probeWithSpan(ctx, NewProber(target.Probe), target, 1),
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// probeWithSpan runs a single probe attempt in its own span, once
+// DefaultProbeLimiter lets it.
+func probeWithSpan(ctx context.Context, prober Prober, target ProbeTarget, attempt int) error {
+	ctx, span := trace.StartSpan(ctx, "activator/probe_attempt")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("target", getHostFromProbe(target)),
+		trace.Int64Attribute("attempt", int64(attempt)))
+	if err := DefaultProbeLimiter.Acquire(ctx, target.Host); err != nil {
+		span.SetStatus(trace.Status{Code: spanStatusUnknown, Message: err.Error()})
+		return err
+	}
+	defer DefaultProbeLimiter.Release()
+	err := prober.Probe(ctx, target)
+	span.AddAttributes(trace.BoolAttribute("ready", err == nil))
+	if err != nil {
+		span.SetStatus(trace.Status{Code: spanStatusUnknown, Message: err.Error()})
+	}
+	return err
+}
+
+// IsH2CPort reports whether a service port declares that it serves HTTP/2
+// over cleartext, either by being named "h2c" or by following the Istio
+// convention of an "http2" or "grpc" name prefix.
+func IsH2CPort(port corev1.ServicePort) bool {
+	name := strings.ToLower(port.Name)
+	return name == "h2c" || strings.HasPrefix(name, "http2") || strings.HasPrefix(name, "grpc")
+}
+
+// Endpoint returns the endpoint the target is proxied to at once it is
+// ready.
+func (target ProbeTarget) Endpoint() Endpoint {
+	ep := Endpoint{
+		FQDN:     target.Host,
+		Port:     target.Port,
+		Protocol: v1alpha1.RevisionProtocolHTTP1,
+		Pod:      target.Pod,
+	}
+	if target.H2C {
+		ep.Protocol = v1alpha1.RevisionProtocolH2C
+	}
+	if target.TLS != nil {
+		ep.Scheme = "https"
+		ep.ServerName = target.Host
+	}
+	return ep
+}
+
+func getHostFromProbe(target ProbeTarget) string {
+	return net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+}
+
+// probeTarget returns the target of the probes of package probe, sending
+// the request ID of ctx with HTTP probes.
+func (t ProbeTarget) probeTarget(ctx context.Context) probe.Target {
+	header := http.Header{"User-Agent": {probeUserAgent}}
+	if id := RequestIDFrom(ctx); id != "" {
+		header.Set(RequestIDHeader, id)
+	}
+	return probe.Target{
+		Host:            t.Host,
+		Port:            t.Port,
+		Probe:           t.Probe,
+		ConnectTimeout:  t.ConnectTimeout,
+		ResponseTimeout: t.ResponseTimeout,
+		ExpectedBody:    t.ExpectedBody,
+		H2C:             t.H2C,
+		TLS:             t.TLS,
+		Header:          header,
+	}
+}
+
+func probePeriod(probe *corev1.Probe) time.Duration {
+	if probe != nil && probe.PeriodSeconds > 0 {
+		return time.Duration(probe.PeriodSeconds) * time.Second
+	}
+	return defaultProbePeriod
+}
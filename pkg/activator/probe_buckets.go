@@ -0,0 +1,58 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/leaderelection"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// probeBucketsName names the ConfigMaps holding the leases of the buckets
+// activation probes are sharded into.
+const probeBucketsName = "activator-probe-bucket"
+
+// NewProbeBuckets creates the Buckets sharding activation probes across
+// activator replicas, so that each revision is probed by the replica
+// owning its bucket.
+func NewProbeBuckets(kubeClient kubernetes.Interface, namespace, self string, buckets int, leaseDuration time.Duration) *leaderelection.Buckets {
+	return leaderelection.NewBuckets(kubeClient, namespace, probeBucketsName, self, buckets, leaseDuration)
+}
+
+// ProbeOwnedRevisions returns an event handler for Revisions that
+// activates, and so probes, those becoming ready in the buckets owned by
+// this replica, for the replicas waiting on their probe result.
+func ProbeOwnedRevisions(a Activator, buckets *leaderelection.Buckets) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*v1alpha1.Revision)
+			if !ok {
+				return
+			}
+			rev, ok := newObj.(*v1alpha1.Revision)
+			if !ok {
+				return
+			}
+			if !old.Status.IsReady() && rev.Status.IsReady() && buckets.Owns(rev.Namespace, rev.Name) {
+				go a.ActiveEndpoint(context.Background(), rev.Namespace, rev.Name)
+			}
+		},
+	}
+}
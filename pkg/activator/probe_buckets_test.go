@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/knative/serving/pkg/logging/testing"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProbeOwnedRevisions(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	buckets := NewProbeBuckets(k8s, "knative-serving", "activator-a", 8, time.Minute)
+	buckets.Sync(TestLogger(t))
+
+	id := revisionID{namespace: testNamespace, name: testRevision}
+	f := newFakeActivator(t, map[revisionID]activationResult{
+		id: activationResult{endpoint: Endpoint{FQDN: "ip", Port: 8080}},
+	})
+	h := ProbeOwnedRevisions(f, buckets)
+
+	notReady := newRevisionBuilder().withReady(false).build()
+	ready := newRevisionBuilder().withReady(true).build()
+	h.OnUpdate(ready, ready)
+	h.OnUpdate(notReady, notReady)
+	h.OnUpdate(notReady, ready)
+	time.Sleep(100 * time.Millisecond)
+
+	f.recordMutex.Lock()
+	defer f.recordMutex.Unlock()
+	if want := []revisionID{id}; !cmp.Equal(want, f.record, cmp.AllowUnexported(revisionID{})) {
+		t.Errorf("Unexpected activations. Want %v. Got %v.", want, f.record)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultProbeLimiter bounds the probes run by CheckProbe and probeAll.
+// It is unlimited until its capacity is set.
+var DefaultProbeLimiter = NewProbeLimiter(0)
+
+// ProbeLimiter is a semaphore bounding how many probes run at once, so that
+// a burst of activations cannot exhaust the activator's sockets. Waiting
+// probes are queued per key and the queues are served in turn, so that a
+// revision with many waiting probes cannot starve the others.
+type ProbeLimiter struct {
+	mux      sync.Mutex
+	capacity int
+	inUse    int
+	// waiters holds the queue of each key with waiting probes, and order
+	// the keys in the order their queues are served.
+	waiters map[string][]chan struct{}
+	order   []string
+}
+
+// NewProbeLimiter creates a ProbeLimiter running at most capacity probes
+// at once. A capacity of zero or less is unlimited.
+func NewProbeLimiter(capacity int) *ProbeLimiter {
+	return &ProbeLimiter{
+		capacity: capacity,
+		waiters:  make(map[string][]chan struct{}),
+	}
+}
+
+// SetCapacity changes how many probes may run at once, admitting waiting
+// probes if it grew.
+func (l *ProbeLimiter) SetCapacity(capacity int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.capacity = capacity
+	for l.hasRoom() && len(l.order) > 0 {
+		l.admitNext()
+	}
+}
+
+// Acquire waits until a probe for key may run, or until ctx is done. Every
+// successful Acquire must be followed by a Release.
+func (l *ProbeLimiter) Acquire(ctx context.Context, key string) error {
+	l.mux.Lock()
+	if l.hasRoom() && len(l.order) == 0 {
+		l.inUse++
+		l.mux.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	if _, ok := l.waiters[key]; !ok {
+		l.order = append(l.order, key)
+	}
+	l.waiters[key] = append(l.waiters[key], ch)
+	l.mux.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		l.mux.Lock()
+		defer l.mux.Unlock()
+		select {
+		case <-ch:
+			// Admitted while giving up, so hand the slot on.
+			l.inUse--
+			l.admitWaiting()
+		default:
+			l.removeWaiter(key, ch)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release ends a probe started by Acquire.
+func (l *ProbeLimiter) Release() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.inUse--
+	l.admitWaiting()
+}
+
+// Waiting returns the number of probes waiting to run.
+func (l *ProbeLimiter) Waiting() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	n := 0
+	for _, q := range l.waiters {
+		n += len(q)
+	}
+	return n
+}
+
+func (l *ProbeLimiter) hasRoom() bool {
+	return l.capacity <= 0 || l.inUse < l.capacity
+}
+
+func (l *ProbeLimiter) admitWaiting() {
+	if l.hasRoom() && len(l.order) > 0 {
+		l.admitNext()
+	}
+}
+
+// admitNext admits the first waiter of the next key in turn.
+func (l *ProbeLimiter) admitNext() {
+	key := l.order[0]
+	l.order = l.order[1:]
+	q := l.waiters[key]
+	ch := q[0]
+	if len(q) > 1 {
+		l.waiters[key] = q[1:]
+		l.order = append(l.order, key)
+	} else {
+		delete(l.waiters, key)
+	}
+	l.inUse++
+	close(ch)
+}
+
+func (l *ProbeLimiter) removeWaiter(key string, ch chan struct{}) {
+	q := l.waiters[key]
+	for i, c := range q {
+		if c == ch {
+			q = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+	if len(q) > 0 {
+		l.waiters[key] = q
+		return
+	}
+	delete(l.waiters, key)
+	for i, k := range l.order {
+		if k == key {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
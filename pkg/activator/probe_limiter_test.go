@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeLimiter_Unlimited(t *testing.T) {
+	l := NewProbeLimiter(0)
+	for i := 0; i < 100; i++ {
+		if err := l.Acquire(context.Background(), "rev"); err != nil {
+			t.Fatalf("Acquire() = %v", err)
+		}
+	}
+}
+
+func TestProbeLimiter_FairBetweenKeys(t *testing.T) {
+	l := NewProbeLimiter(1)
+	if err := l.Acquire(context.Background(), "busy"); err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+
+	var mux sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	waiting := 0
+	acquire := func(key string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background(), key); err != nil {
+				t.Errorf("Acquire() = %v", err)
+				return
+			}
+			mux.Lock()
+			order = append(order, key)
+			mux.Unlock()
+			l.Release()
+		}()
+		waiting++
+		waitForWaiting(t, l, waiting)
+	}
+	// Three probes of a busy revision queue up before one of a quiet one.
+	acquire("busy")
+	acquire("busy")
+	acquire("busy")
+	acquire("quiet")
+
+	l.Release()
+	wg.Wait()
+	if want := []string{"busy", "quiet", "busy", "busy"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Probes ran in order %v, want %v", order, want)
+	}
+}
+
+func TestProbeLimiter_AcquireCancelled(t *testing.T) {
+	l := NewProbeLimiter(1)
+	if err := l.Acquire(context.Background(), "rev"); err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx, "rev"); err == nil {
+		t.Fatal("Acquire() = nil, want error once the context is done")
+	}
+	if got := l.Waiting(); got != 0 {
+		t.Errorf("Waiting() = %d, want 0 after the waiter gave up", got)
+	}
+	l.Release()
+	if err := l.Acquire(context.Background(), "rev"); err != nil {
+		t.Errorf("Acquire() = %v after Release", err)
+	}
+}
+
+func TestProbeLimiter_SetCapacity(t *testing.T) {
+	l := NewProbeLimiter(1)
+	if err := l.Acquire(context.Background(), "rev"); err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- l.Acquire(context.Background(), "rev")
+	}()
+	waitForWaiting(t, l, 1)
+
+	l.SetCapacity(2)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Acquire() = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the capacity increase to admit the waiting probe.")
+	}
+}
+
+func waitForWaiting(t *testing.T, l *ProbeLimiter, n int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for l.Waiting() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d waiting probes.", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
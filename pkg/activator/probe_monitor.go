@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultMonitorFailureThreshold is used when a probe does not set
+// FailureThreshold, the same default as the kubelet.
+const defaultMonitorFailureThreshold = 3
+
+// ProbeMonitor keeps probing targets after they were found ready, at a low
+// frequency, and reports when they stop being ready.
+type ProbeMonitor struct {
+	period     time.Duration
+	onNotReady func(target ProbeTarget, err error)
+
+	// failureThreshold, when positive, is used instead of the
+	// FailureThreshold of the targets' probes.
+	failureThreshold int
+
+	mux     sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	targets map[string]*monitoredTarget
+	wg      sync.WaitGroup
+}
+
+type monitoredTarget struct {
+	cancel context.CancelFunc
+}
+
+// NewProbeMonitor creates a ProbeMonitor probing every period. onNotReady
+// is called once a monitored target fails FailureThreshold probes in a
+// row, after which the target is no longer monitored.
+func NewProbeMonitor(period time.Duration, onNotReady func(target ProbeTarget, err error)) *ProbeMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ProbeMonitor{
+		period:     period,
+		onNotReady: onNotReady,
+		ctx:        ctx,
+		cancel:     cancel,
+		targets:    make(map[string]*monitoredTarget),
+	}
+}
+
+// Monitor starts monitoring a target that was found ready. Monitoring a
+// target that is already monitored does nothing.
+func (m *ProbeMonitor) Monitor(target ProbeTarget) {
+	key := getHostFromProbe(target)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if _, ok := m.targets[key]; ok || m.ctx.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	mt := &monitoredTarget{cancel: cancel}
+	m.targets[key] = mt
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		err := m.monitor(ctx, target)
+		m.mux.Lock()
+		// The target may have been unmonitored, and even monitored anew,
+		// in the meantime.
+		current := m.targets[key] == mt
+		if current {
+			delete(m.targets, key)
+		}
+		m.mux.Unlock()
+		if err != nil && current {
+			m.onNotReady(target, err)
+		}
+	}()
+}
+
+// Unmonitor stops monitoring target, if it is monitored, without
+// reporting it not ready.
+func (m *ProbeMonitor) Unmonitor(target ProbeTarget) {
+	key := getHostFromProbe(target)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if mt, ok := m.targets[key]; ok {
+		mt.cancel()
+		delete(m.targets, key)
+	}
+}
+
+// Monitored reports whether target is being monitored.
+func (m *ProbeMonitor) Monitored(target ProbeTarget) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	_, ok := m.targets[getHostFromProbe(target)]
+	return ok
+}
+
+// Running reports whether the monitor was not stopped.
+func (m *ProbeMonitor) Running() bool {
+	return m.ctx.Err() == nil
+}
+
+// Stop stops monitoring all targets and waits for the monitors to exit.
+func (m *ProbeMonitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// monitor probes target until it fails FailureThreshold times in a row,
+// returning the last error, or until ctx is done, returning nil.
+func (m *ProbeMonitor) monitor(ctx context.Context, target ProbeTarget) error {
+	prober := NewProber(target.Probe)
+	threshold := defaultMonitorFailureThreshold
+	switch {
+	case m.failureThreshold > 0:
+		threshold = m.failureThreshold
+	case target.Probe != nil && target.Probe.FailureThreshold > 0:
+		threshold = int(target.Probe.FailureThreshold)
+	}
+	ticker := time.NewTicker(m.period)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		err := prober.Probe(ctx, target)
+		switch {
+		case err == nil:
+			failures = 0
+		case ctx.Err() != nil:
+			return nil
+		default:
+			failures++
+			if failures >= threshold {
+				return err
+			}
+		}
+	}
+}
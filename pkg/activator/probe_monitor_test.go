@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeMonitor_ReportsNotReady(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notReady := make(chan ProbeTarget, 2)
+	m := NewProbeMonitor(10*time.Millisecond, func(target ProbeTarget, err error) {
+		notReady <- target
+	})
+	defer m.Stop()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	m.Monitor(target)
+	m.Monitor(target)
+	if !m.Monitored(target) {
+		t.Fatal("Expected target to be monitored.")
+	}
+
+	select {
+	case <-notReady:
+		t.Fatal("Unexpected not ready notification for a ready target.")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	select {
+	case got := <-notReady:
+		if got != target {
+			t.Errorf("Unexpected not ready target. Want %+v. Got %+v.", target, got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for not ready notification.")
+	}
+	select {
+	case <-notReady:
+		t.Error("Expected a single not ready notification for a target monitored twice.")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if m.Monitored(target) {
+		t.Error("Expected target to no longer be monitored once not ready.")
+	}
+}
+
+func TestProbeMonitor_Stop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	m := NewProbeMonitor(10*time.Millisecond, func(target ProbeTarget, err error) {
+		t.Errorf("Unexpected not ready notification: %v", err)
+	})
+	target := serverTarget(t, server)
+	m.Monitor(target)
+	m.Stop()
+
+	if m.Monitored(target) {
+		t.Error("Expected target to no longer be monitored after Stop.")
+	}
+	m.Monitor(target)
+	if m.Monitored(target) {
+		t.Error("Expected Monitor to do nothing after Stop.")
+	}
+}
+
+func TestProbeMonitor_Unmonitor(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notReady := make(chan ProbeTarget, 1)
+	m := NewProbeMonitor(10*time.Millisecond, func(target ProbeTarget, err error) {
+		notReady <- target
+	})
+	m.failureThreshold = 1
+	defer m.Stop()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	m.Monitor(target)
+	m.Unmonitor(target)
+	if m.Monitored(target) {
+		t.Error("Expected target to no longer be monitored once unmonitored.")
+	}
+	atomic.StoreInt32(&healthy, 0)
+	select {
+	case <-notReady:
+		t.Fatal("Unexpected not ready notification for an unmonitored target.")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A single failure is enough with a threshold of 1.
+	m.Monitor(target)
+	select {
+	case <-notReady:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for not ready notification.")
+	}
+}
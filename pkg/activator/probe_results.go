@@ -0,0 +1,274 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+// ProbeResultsConfigMapName is the ConfigMap activators share successful
+// probe results through.
+const ProbeResultsConfigMapName = "activator-probe-results"
+
+// ProbeResults remembers which targets were recently found ready, so that
+// they need not be probed again.
+type ProbeResults interface {
+	// Ready reports whether target was found ready recently enough to
+	// skip probing it.
+	Ready(target ProbeTarget) bool
+	// MarkReady records that target was found ready.
+	MarkReady(target ProbeTarget)
+	// MarkNotReady forgets that target was found ready.
+	MarkNotReady(target ProbeTarget)
+}
+
+var _ ProbeResults = (*ProbeResultStore)(nil)
+
+// ProbeResultStore shares successful probe results between activator
+// replicas through a ConfigMap, so that a cold-starting revision is only
+// probed by the first replica to see it become ready. Only positive
+// results are shared, and only for ttl, since a revision that was ready
+// can stop being so. Results are written to the ConfigMap in the
+// background, so that activations do not wait on the API server, and those
+// recorded while a write is in flight are batched into the next one.
+type ProbeResultStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+	ttl        time.Duration
+	logger     *zap.SugaredLogger
+
+	mux     sync.RWMutex
+	results map[string]time.Time
+	// pending holds the results not written to the ConfigMap yet, with
+	// the zero time for those to forget.
+	pending map[string]time.Time
+	writing bool
+	writes  sync.WaitGroup
+}
+
+// NewProbeResultStore creates a ProbeResultStore backed by the named
+// ConfigMap, which is created on first use.
+func NewProbeResultStore(kubeClient kubernetes.Interface, namespace, name string, ttl time.Duration, logger *zap.SugaredLogger) *ProbeResultStore {
+	return &ProbeResultStore{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+		ttl:        ttl,
+		logger:     logger,
+		results:    make(map[string]time.Time),
+		pending:    make(map[string]time.Time),
+	}
+}
+
+// Ready implements ProbeResults.
+func (s *ProbeResultStore) Ready(target ProbeTarget) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	t, ok := s.results[probeResultKey(target)]
+	return ok && time.Since(t) < s.ttl
+}
+
+// MarkReady implements ProbeResults. The result is visible to this replica
+// immediately and to the others once the ConfigMap update reaches them.
+func (s *ProbeResultStore) MarkReady(target ProbeTarget) {
+	now := time.Now()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.results[probeResultKey(target)] = now
+	s.queueWrite(probeResultKey(target), now)
+}
+
+// MarkNotReady implements ProbeResults.
+func (s *ProbeResultStore) MarkNotReady(target ProbeTarget) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.results, probeResultKey(target))
+	s.queueWrite(probeResultKey(target), time.Time{})
+}
+
+// queueWrite records the result for key to be written, and starts writing
+// unless a write is in flight already. s.mux must be held.
+func (s *ProbeResultStore) queueWrite(key string, t time.Time) {
+	s.pending[key] = t
+	if s.writing {
+		return
+	}
+	s.writing = true
+	s.writes.Add(1)
+	go s.writePending()
+}
+
+// writePending writes the pending results until there are none left.
+func (s *ProbeResultStore) writePending() {
+	defer s.writes.Done()
+	for {
+		s.mux.Lock()
+		if len(s.pending) == 0 {
+			s.writing = false
+			s.mux.Unlock()
+			return
+		}
+		batch := make(map[string]time.Time, len(s.pending))
+		for key, t := range s.pending {
+			batch[key] = t
+		}
+		s.mux.Unlock()
+
+		if err := s.write(batch); err != nil {
+			s.logger.Errorf("Failed to share %d probe results: %v", len(batch), err)
+		}
+
+		// Results recorded again during the write are written next.
+		s.mux.Lock()
+		for key, t := range batch {
+			if s.pending[key] == t {
+				delete(s.pending, key)
+			}
+		}
+		s.mux.Unlock()
+	}
+}
+
+// write applies batch to the ConfigMap.
+func (s *ProbeResultStore) write(batch map[string]time.Time) error {
+	// Other replicas update the ConfigMap too, so start over from a fresh
+	// copy when an update conflicts with theirs.
+	configMaps := s.kubeClient.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(s.name, metav1.GetOptions{})
+		create := apierrs.IsNotFound(err)
+		if create {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+			}
+		} else if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		// Drop expired results so that the ConfigMap does not grow forever.
+		now := time.Now()
+		for key, raw := range cm.Data {
+			if t, err := parseProbeResult(raw); err != nil || now.Sub(t) >= s.ttl {
+				delete(cm.Data, key)
+			}
+		}
+		for key, t := range batch {
+			if t.IsZero() {
+				delete(cm.Data, key)
+			} else {
+				cm.Data[key] = formatProbeResult(t)
+			}
+		}
+		if create {
+			if len(cm.Data) == 0 {
+				return nil
+			}
+			_, err = configMaps.Create(cm)
+			if apierrs.IsAlreadyExists(err) {
+				// Another replica created it first, so update theirs.
+				return apierrs.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		_, err = configMaps.Update(cm)
+		return err
+	})
+}
+
+// Watch keeps the store up to date with the results shared by other
+// replicas until stopCh is closed. It returns whether the store has
+// caught up with them.
+func (s *ProbeResultStore) Watch(stopCh <-chan struct{}, logger *zap.SugaredLogger) cache.InformerSynced {
+	sif := kubeinformers.NewFilteredSharedInformerFactory(s.kubeClient, 5*time.Minute, s.namespace,
+		func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fmt.Sprintf("metadata.name=%s", s.name)
+		})
+	handle := func(obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		results := make(map[string]time.Time, len(cm.Data))
+		for key, raw := range cm.Data {
+			t, err := parseProbeResult(raw)
+			if err != nil {
+				logger.Errorf("Ignoring invalid probe result for %s: %v", key, err)
+				continue
+			}
+			results[key] = t
+		}
+		// The ConfigMap is authoritative, so that results forgotten by
+		// another replica are forgotten here too, but for the results of
+		// this replica that are not written yet.
+		s.mux.Lock()
+		for key, t := range s.pending {
+			if t.IsZero() {
+				delete(results, key)
+			} else {
+				results[key] = t
+			}
+		}
+		s.results = results
+		s.mux.Unlock()
+	}
+	informer := sif.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+	})
+	sif.Start(stopCh)
+	return informer.HasSynced
+}
+
+// probeResultKey returns the ConfigMap key for target. Keys may only hold
+// alphanumerics, '-', '_' and '.'.
+func probeResultKey(target ProbeTarget) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, target.Host) + "_" + strconv.Itoa(int(target.Port))
+}
+
+func formatProbeResult(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseProbeResult(raw string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, raw)
+}
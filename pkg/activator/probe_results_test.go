@@ -0,0 +1,237 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+)
+
+func TestProbeResultStore_SharedBetweenReplicas(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	first := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	second := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	target := ProbeTarget{Host: "rev.default.svc.cluster.local", Port: 80}
+
+	if first.Ready(target) {
+		t.Fatal("Expected target not to be ready before it was marked.")
+	}
+	first.MarkReady(target)
+	if !first.Ready(target) {
+		t.Error("Expected target to be ready on the replica that marked it.")
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	second.Watch(stopCh, TestLogger(t))
+	deadline := time.Now().Add(3 * time.Second)
+	for !second.Ready(target) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the probe result to reach the other replica.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if second.Ready(ProbeTarget{Host: "other.default.svc.cluster.local", Port: 80}) {
+		t.Error("Expected an unmarked target not to be ready.")
+	}
+}
+
+func TestProbeResultStore_MarkNotReady(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	target := ProbeTarget{Host: "rev.default.svc.cluster.local", Port: 80}
+
+	store.MarkNotReady(target)
+	store.MarkReady(target)
+	store.writes.Wait()
+	store.MarkNotReady(target)
+	if store.Ready(target) {
+		t.Error("Expected target not to be ready after MarkNotReady.")
+	}
+	store.writes.Wait()
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(ProbeResultsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get probe results ConfigMap: %v", err)
+	}
+	if _, ok := cm.Data[probeResultKey(target)]; ok {
+		t.Error("Expected the result to be removed from the ConfigMap.")
+	}
+}
+
+func TestProbeResultStore_RetriesConflicts(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	first := ProbeTarget{Host: "first.default.svc.cluster.local", Port: 80}
+	second := ProbeTarget{Host: "second.default.svc.cluster.local", Port: 80}
+	store.MarkReady(first)
+	store.writes.Wait()
+
+	// The first update conflicts with one of another replica.
+	conflicts := 0
+	kubeClient.PrependReactor("update", "configmaps", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrs.NewConflict(corev1.Resource("configmaps"), ProbeResultsConfigMapName, errors.New("conflict"))
+	})
+	store.MarkReady(second)
+	store.MarkNotReady(first)
+
+	store.writes.Wait()
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(ProbeResultsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get probe results ConfigMap: %v", err)
+	}
+	if _, ok := cm.Data[probeResultKey(second)]; !ok {
+		t.Error("Expected the result to be written despite the conflict.")
+	}
+	if _, ok := cm.Data[probeResultKey(first)]; ok {
+		t.Error("Expected the result to be removed from the ConfigMap.")
+	}
+}
+
+func TestProbeResultStore_RetriesConcurrentCreate(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	ours := ProbeTarget{Host: "ours.default.svc.cluster.local", Port: 80}
+	theirs := ProbeTarget{Host: "theirs.default.svc.cluster.local", Port: 80}
+
+	// Another replica creates the ConfigMap between our Get and Create.
+	if _, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ProbeResultsConfigMapName, Namespace: "knative-serving"},
+		Data:       map[string]string{probeResultKey(theirs): formatProbeResult(time.Now())},
+	}); err != nil {
+		t.Fatalf("Failed to create the ConfigMap of the other replica: %v", err)
+	}
+	missed := false
+	kubeClient.PrependReactor("get", "configmaps", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		if missed {
+			return false, nil, nil
+		}
+		missed = true
+		return true, nil, apierrs.NewNotFound(corev1.Resource("configmaps"), ProbeResultsConfigMapName)
+	})
+	store.MarkReady(ours)
+
+	store.writes.Wait()
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(ProbeResultsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get probe results ConfigMap: %v", err)
+	}
+	for _, target := range []ProbeTarget{ours, theirs} {
+		if _, ok := cm.Data[probeResultKey(target)]; !ok {
+			t.Errorf("Expected the result for %s to be stored.", target.Host)
+		}
+	}
+}
+
+func TestProbeResultStore_BatchesWrites(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+
+	// Hold the first write until more results were recorded.
+	release := make(chan struct{})
+	var writes int32
+	kubeClient.PrependReactor("*", "configmaps", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			if atomic.AddInt32(&writes, 1) == 1 {
+				<-release
+			}
+		}
+		return false, nil, nil
+	})
+	targets := []ProbeTarget{
+		{Host: "first.default.svc.cluster.local", Port: 80},
+		{Host: "second.default.svc.cluster.local", Port: 80},
+		{Host: "third.default.svc.cluster.local", Port: 80},
+	}
+	store.MarkReady(targets[0])
+	for atomic.LoadInt32(&writes) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	store.MarkReady(targets[1])
+	store.MarkReady(targets[2])
+	close(release)
+
+	store.writes.Wait()
+	if got, want := atomic.LoadInt32(&writes), int32(2); got != want {
+		t.Errorf("Unexpected number of writes. Want %v. Got %v.", want, got)
+	}
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(ProbeResultsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get probe results ConfigMap: %v", err)
+	}
+	for _, target := range targets {
+		if _, ok := cm.Data[probeResultKey(target)]; !ok {
+			t.Errorf("Expected the result for %s to be stored.", target.Host)
+		}
+	}
+}
+
+func TestProbeResultStore_Expiry(t *testing.T) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	store := NewProbeResultStore(kubeClient, "knative-serving", ProbeResultsConfigMapName, 50*time.Millisecond, TestLogger(t))
+	stale := ProbeTarget{Host: "stale.default.svc.cluster.local", Port: 80}
+	fresh := ProbeTarget{Host: "fresh.default.svc.cluster.local", Port: 80}
+
+	store.MarkReady(stale)
+	time.Sleep(100 * time.Millisecond)
+	if store.Ready(stale) {
+		t.Error("Expected an expired result not to be ready.")
+	}
+	store.MarkReady(fresh)
+
+	store.writes.Wait()
+	cm, err := kubeClient.CoreV1().ConfigMaps("knative-serving").Get(ProbeResultsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get probe results ConfigMap: %v", err)
+	}
+	if _, ok := cm.Data[probeResultKey(stale)]; ok {
+		t.Error("Expected the expired result to be pruned.")
+	}
+	if _, ok := cm.Data[probeResultKey(fresh)]; !ok {
+		t.Error("Expected the fresh result to be stored.")
+	}
+}
+
+func TestProbeResultKey(t *testing.T) {
+	tests := []struct {
+		target ProbeTarget
+		want   string
+	}{{
+		target: ProbeTarget{Host: "rev.default.svc.cluster.local", Port: 80},
+		want:   "rev.default.svc.cluster.local_80",
+	}, {
+		target: ProbeTarget{Host: "fd00::1", Port: 8080},
+		want:   "fd00__1_8080",
+	}}
+	for _, test := range tests {
+		if got := probeResultKey(test.target); got != test.want {
+			t.Errorf("probeResultKey(%+v) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/apis/serving"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"go.opencensus.io/trace"
+	"golang.org/x/net/http2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestHttpGetProber(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		path    string
+		wantErr bool
+	}{{
+		name:   "ok",
+		status: http.StatusOK,
+		path:   "/healthz",
+	}, {
+		name:   "redirect is success",
+		status: http.StatusFound,
+		path:   "healthz",
+	}, {
+		name:    "server error",
+		status:  http.StatusServiceUnavailable,
+		path:    "/healthz",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotPath, gotAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAgent = r.Header.Get("User-Agent")
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			target := serverTarget(t, server)
+			target.Probe = httpGetProbe(test.path)
+			err := (&HttpGetProber{}).Probe(context.Background(), target)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Probe() = %v, wantErr %v", err, test.wantErr)
+			}
+			if gotPath != "/healthz" {
+				t.Errorf("Probed path = %q, want %q", gotPath, "/healthz")
+			}
+			if gotAgent != probeUserAgent {
+				t.Errorf("Probe User-Agent = %q, want %q", gotAgent, probeUserAgent)
+			}
+		})
+	}
+}
+
+func TestHttpGetProber_RequestID(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(RequestIDHeader)
+	}))
+	defer server.Close()
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	if err := (&HttpGetProber{}).Probe(ctx, serverTarget(t, server)); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+	if got != "req-1" {
+		t.Errorf("Probe %s = %q, want %q", RequestIDHeader, got, "req-1")
+	}
+}
+
+func TestTCPSocketProber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	target := ProbeTarget{Host: "127.0.0.1", Port: int32(addr.Port)}
+
+	if err := (&TCPSocketProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+
+	l.Close()
+	if err := (&TCPSocketProber{}).Probe(context.Background(), target); err == nil {
+		t.Error("Probe() = nil, want error after listener closed")
+	}
+}
+
+func TestHttpGetProber_ExpectedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"starting"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		body    *regexp.Regexp
+		wantErr bool
+	}{{
+		name: "no expectation",
+	}, {
+		name: "matching body",
+		body: regexp.MustCompile(`"status":"(starting|ok)"`),
+	}, {
+		name:    "body not matching",
+		body:    regexp.MustCompile(`"status":"ok"`),
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := serverTarget(t, server)
+			target.Probe = httpGetProbe("/")
+			target.ExpectedBody = test.body
+			err := (&HttpGetProber{}).Probe(context.Background(), target)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Probe() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpectedBodyFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{{
+		name: "none",
+	}, {
+		name: "substring is quoted",
+		annotations: map[string]string{
+			serving.ReadinessProbeBodyAnnotationKey: `{"status":"ok"}`,
+		},
+		want: `\{"status":"ok"\}`,
+	}, {
+		name: "regex",
+		annotations: map[string]string{
+			serving.ReadinessProbeBodyRegexAnnotationKey: `"status": *"ok"`,
+		},
+		want: `"status": *"ok"`,
+	}, {
+		name: "invalid regex",
+		annotations: map[string]string{
+			serving.ReadinessProbeBodyRegexAnnotationKey: `(`,
+		},
+		wantErr: true,
+	}, {
+		name: "both",
+		annotations: map[string]string{
+			serving.ReadinessProbeBodyAnnotationKey:      "ok",
+			serving.ReadinessProbeBodyRegexAnnotationKey: "ok",
+		},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			re, err := ExpectedBodyFromAnnotations(test.annotations)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ExpectedBodyFromAnnotations() = %v, wantErr %v", err, test.wantErr)
+			}
+			got := ""
+			if re != nil {
+				got = re.String()
+			}
+			if got != test.want {
+				t.Errorf("ExpectedBodyFromAnnotations() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHttpGetProber_H2C(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	defer l.Close()
+	// Serve HTTP/2 with prior knowledge only, like an h2c-only revision.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.ProtoMajor != 2 {
+						w.WriteHeader(http.StatusHTTPVersionNotSupported)
+					}
+				}),
+			})
+		}
+	}()
+
+	target := ProbeTarget{
+		Host:  "127.0.0.1",
+		Port:  int32(l.Addr().(*net.TCPAddr).Port),
+		Probe: httpGetProbe("/"),
+		H2C:   true,
+	}
+	if err := (&HttpGetProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+
+	target.H2C = false
+	if err := (&HttpGetProber{}).Probe(context.Background(), target); err == nil {
+		t.Error("Probe() = nil, want error probing an h2c-only server with HTTP/1")
+	}
+}
+
+func TestIsH2CPort(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{{
+		name: "http",
+	}, {
+		name: "h2c",
+		want: true,
+	}, {
+		name: "http2-server",
+		want: true,
+	}, {
+		name: "grpc",
+		want: true,
+	}}
+	for _, test := range tests {
+		if got := IsH2CPort(corev1.ServicePort{Name: test.name}); got != test.want {
+			t.Errorf("IsH2CPort(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProbeTarget_Endpoint(t *testing.T) {
+	pod := &Pod{Name: "pod-1"}
+	tests := []struct {
+		name    string
+		target  ProbeTarget
+		want    Endpoint
+		wantURL string
+	}{{
+		name:   "http",
+		target: ProbeTarget{Host: "rev.default.svc", Port: 80},
+		want: Endpoint{
+			FQDN:     "rev.default.svc",
+			Port:     80,
+			Protocol: v1alpha1.RevisionProtocolHTTP1,
+		},
+		wantURL: "http://rev.default.svc:80",
+	}, {
+		name:   "h2c pod",
+		target: ProbeTarget{Host: "10.0.0.1", Port: 8012, Pod: pod, H2C: true},
+		want: Endpoint{
+			FQDN:     "10.0.0.1",
+			Port:     8012,
+			Protocol: v1alpha1.RevisionProtocolH2C,
+			Pod:      pod,
+		},
+		wantURL: "http://10.0.0.1:8012",
+	}, {
+		name:   "tls",
+		target: ProbeTarget{Host: "rev.default.svc", Port: 443, TLS: &tls.Config{}},
+		want: Endpoint{
+			FQDN:       "rev.default.svc",
+			Port:       443,
+			Scheme:     "https",
+			Protocol:   v1alpha1.RevisionProtocolHTTP1,
+			ServerName: "rev.default.svc",
+		},
+		wantURL: "https://rev.default.svc:443",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.target.Endpoint()
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Unexpected endpoint (-want +got): %v", diff)
+			}
+			if got := got.URL().String(); got != test.wantURL {
+				t.Errorf("Unexpected URL. Want %v. Got %v.", test.wantURL, got)
+			}
+		})
+	}
+}
+
+func TestHttpGetProber_ResponseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	target.ConnectTimeout = time.Second
+	target.ResponseTimeout = 50 * time.Millisecond
+	if err := (&HttpGetProber{}).Probe(context.Background(), target); err == nil {
+		t.Error("Probe() = nil, want error for a response slower than the response timeout")
+	}
+
+	target.ResponseTimeout = time.Second
+	if err := (&HttpGetProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+}
+
+func TestNewProber(t *testing.T) {
+	if _, ok := NewProber(nil).(*TCPSocketProber); !ok {
+		t.Error("NewProber(nil) is not a TCPSocketProber")
+	}
+	if _, ok := NewProber(httpGetProbe("/")).(*HttpGetProber); !ok {
+		t.Error("NewProber(httpGet) is not an HttpGetProber")
+	}
+}
+
+func TestCheckProbe_SucceedsEventually(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := CheckProbe(ctx, target); err != nil {
+		t.Errorf("CheckProbe() = %v, want nil", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Probe attempts = %d, want 3", got)
+	}
+}
+
+func TestCheckProbe_TimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := CheckProbe(ctx, target); err == nil {
+		t.Error("CheckProbe() = nil, want error")
+	}
+}
+
+type spanRecorder struct {
+	mux   sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestCheckProbe_Traced(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	parent := trace.NewSpan("test", nil, trace.StartOptions{Sampler: trace.AlwaysSample()})
+	ctx := trace.WithSpan(context.Background(), parent)
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	if _, err := CheckProbe(ctx, target); err != nil {
+		t.Fatalf("CheckProbe() = %v, want nil", err)
+	}
+	parent.End()
+
+	recorder.mux.Lock()
+	defer recorder.mux.Unlock()
+	var loops, attempts, failed int
+	for _, s := range recorder.spans {
+		if s.TraceID != parent.SpanContext().TraceID {
+			continue
+		}
+		switch s.Name {
+		case "activator/check_probe":
+			loops++
+			if got := s.Attributes["attempts"]; got != int64(2) {
+				t.Errorf("check_probe attempts = %v, want 2", got)
+			}
+		case "activator/probe_attempt":
+			attempts++
+			if s.Status.Code != 0 {
+				failed++
+			}
+		}
+	}
+	if loops != 1 || attempts != 2 || failed != 1 {
+		t.Errorf("Got %d check_probe spans and %d probe_attempt spans with %d failed, want 1, 2 and 1", loops, attempts, failed)
+	}
+}
+
+func TestProbeAll(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	httpProbe := httpGetProbe("/")
+	var targets []ProbeTarget
+	want := []bool{}
+	for i := 0; i < 5; i++ {
+		server, ready := ok, true
+		if i%2 == 1 {
+			server, ready = bad, false
+		}
+		target := serverTarget(t, server)
+		target.Probe = httpProbe
+		targets = append(targets, target)
+		want = append(want, ready)
+	}
+
+	results := probeAll(context.Background(), targets, 2)
+	if len(results) != len(targets) {
+		t.Fatalf("len(probeAll()) = %d, want %d", len(results), len(targets))
+	}
+	for i, result := range results {
+		if result.Target != targets[i] {
+			t.Errorf("results[%d].Target = %+v, want %+v", i, result.Target, targets[i])
+		}
+		if got := result.Err == nil; got != want[i] {
+			t.Errorf("results[%d] ready = %v, want %v (err: %v)", i, got, want[i], result.Err)
+		}
+	}
+}
+
+func serverTarget(t *testing.T, server *httptest.Server) ProbeTarget {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatalf("Failed to split host and port: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Failed to parse port: %v", err)
+	}
+	return ProbeTarget{Host: host, Port: int32(port)}
+}
+
+func httpGetProbe(path string) *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: path},
+		},
+	}
+}
+
+func TestGetHostFromProbe(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{{
+		host: "rev.ns.svc.cluster.local",
+		want: "rev.ns.svc.cluster.local:8080",
+	}, {
+		host: "10.0.0.1",
+		want: "10.0.0.1:8080",
+	}, {
+		host: "fd00::1",
+		want: "[fd00::1]:8080",
+	}}
+	for _, test := range tests {
+		if got := getHostFromProbe(ProbeTarget{Host: test.host, Port: 8080}); got != test.want {
+			t.Errorf("getHostFromProbe(%q) = %q, want %q", test.host, got, test.want)
+		}
+	}
+}
+
+func TestProbers_IPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	target := ProbeTarget{Host: "::1", Port: int32(l.Addr().(*net.TCPAddr).Port)}
+	if err := (&TCPSocketProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("TCPSocketProber.Probe() = %v, want nil", err)
+	}
+	target.Probe = httpGetProbe("/")
+	if err := (&HttpGetProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("HttpGetProber.Probe() = %v, want nil", err)
+	}
+}
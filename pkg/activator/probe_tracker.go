@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentProbeStates is the number of completed probes kept by
+// DefaultProbeTracker.
+const recentProbeStates = 100
+
+// DefaultProbeTracker records the probes run by CheckProbe.
+var DefaultProbeTracker = NewProbeTracker(recentProbeStates)
+
+// ProbeState describes a probe loop that is in flight or has recently
+// completed.
+type ProbeState struct {
+	Target    string    `json:"target"`
+	Pod       string    `json:"pod,omitempty"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	Started   time.Time `json:"started"`
+	Elapsed   string    `json:"elapsed"`
+	Ready     bool      `json:"ready"`
+}
+
+// ProbeStates is a snapshot of the probes known to a ProbeTracker.
+type ProbeStates struct {
+	InFlight []ProbeState `json:"inFlight"`
+	Recent   []ProbeState `json:"recent"`
+}
+
+type probeRecord struct {
+	target   string
+	pod      string
+	attempts int
+	lastErr  error
+	started  time.Time
+	finished time.Time
+	ready    bool
+}
+
+func (r *probeRecord) state(now time.Time) ProbeState {
+	s := ProbeState{
+		Target:   r.target,
+		Pod:      r.pod,
+		Attempts: r.attempts,
+		Started:  r.started,
+		Ready:    r.ready,
+	}
+	if r.lastErr != nil {
+		s.LastError = r.lastErr.Error()
+	}
+	if !r.finished.IsZero() {
+		now = r.finished
+	}
+	s.Elapsed = now.Sub(r.started).String()
+	return s
+}
+
+// ProbeTracker keeps track of in-flight probes and a bounded history of
+// completed ones, for debugging activations that never finish.
+type ProbeTracker struct {
+	mux       sync.Mutex
+	nextID    int
+	inFlight  map[int]*probeRecord
+	recent    []*probeRecord
+	maxRecent int
+}
+
+// NewProbeTracker creates a ProbeTracker remembering up to maxRecent
+// completed probes.
+func NewProbeTracker(maxRecent int) *ProbeTracker {
+	return &ProbeTracker{
+		inFlight:  make(map[int]*probeRecord),
+		maxRecent: maxRecent,
+	}
+}
+
+func (t *ProbeTracker) start(target ProbeTarget) int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.nextID++
+	r := &probeRecord{
+		target:  getHostFromProbe(target),
+		started: time.Now(),
+	}
+	if target.Pod != nil {
+		r.pod = target.Pod.Name
+	}
+	t.inFlight[t.nextID] = r
+	return t.nextID
+}
+
+func (t *ProbeTracker) attempt(id int, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if r, ok := t.inFlight[id]; ok {
+		r.attempts++
+		r.lastErr = err
+	}
+}
+
+func (t *ProbeTracker) finish(id int, ready bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	r, ok := t.inFlight[id]
+	if !ok {
+		return
+	}
+	delete(t.inFlight, id)
+	r.finished = time.Now()
+	r.ready = ready
+	t.recent = append(t.recent, r)
+	if len(t.recent) > t.maxRecent {
+		t.recent = t.recent[len(t.recent)-t.maxRecent:]
+	}
+}
+
+// States returns a snapshot of in-flight and recently completed probes,
+// each ordered from oldest to newest.
+func (t *ProbeTracker) States() ProbeStates {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	now := time.Now()
+	states := ProbeStates{
+		InFlight: []ProbeState{},
+		Recent:   []ProbeState{},
+	}
+	ids := make([]int, 0, len(t.inFlight))
+	for id := range t.inFlight {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		states.InFlight = append(states.InFlight, t.inFlight[id].state(now))
+	}
+	for _, r := range t.recent {
+		states.Recent = append(states.Recent, r.state(now))
+	}
+	return states
+}
+
+// ServeHTTP writes the tracker's States as JSON.
+func (t *ProbeTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.States())
+}
+
+// RequireBearerToken wraps h so that it is only served to requests
+// presenting the given bearer token in their Authorization header. An
+// empty token rejects every request.
+func RequireBearerToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, prefix) ||
+			subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbeTracker_States(t *testing.T) {
+	tracker := NewProbeTracker(2)
+	target := ProbeTarget{Host: "host", Port: 80}
+
+	first := tracker.start(target)
+	tracker.attempt(first, errors.New("connection refused"))
+	tracker.attempt(first, nil)
+	tracker.finish(first, true)
+
+	second := tracker.start(target)
+	tracker.attempt(second, errors.New("connection refused"))
+
+	states := tracker.States()
+	if got, want := len(states.InFlight), 1; got != want {
+		t.Fatalf("len(InFlight) = %d, want %d", got, want)
+	}
+	if got, want := states.InFlight[0].LastError, "connection refused"; got != want {
+		t.Errorf("InFlight[0].LastError = %q, want %q", got, want)
+	}
+	if got, want := len(states.Recent), 1; got != want {
+		t.Fatalf("len(Recent) = %d, want %d", got, want)
+	}
+	recent := states.Recent[0]
+	if recent.Target != "host:80" || recent.Attempts != 2 || !recent.Ready || recent.LastError != "" {
+		t.Errorf("Unexpected recent state: %+v", recent)
+	}
+}
+
+func TestProbeTracker_BoundsRecent(t *testing.T) {
+	tracker := NewProbeTracker(2)
+	for i := 0; i < 5; i++ {
+		tracker.finish(tracker.start(ProbeTarget{Host: "host", Port: int32(i)}), false)
+	}
+	states := tracker.States()
+	if got, want := len(states.Recent), 2; got != want {
+		t.Fatalf("len(Recent) = %d, want %d", got, want)
+	}
+	if got, want := states.Recent[1].Target, "host:4"; got != want {
+		t.Errorf("Newest recent target = %q, want %q", got, want)
+	}
+}
+
+func TestProbeTracker_CheckProbeRecordsAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tracker := NewProbeTracker(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	if _, err := tracker.CheckProbe(ctx, target); err == nil {
+		t.Fatal("CheckProbe() = nil, want error")
+	}
+
+	states := tracker.States()
+	if len(states.InFlight) != 0 || len(states.Recent) != 1 {
+		t.Fatalf("Unexpected states: %+v", states)
+	}
+	if got := states.Recent[0]; got.Ready || got.Attempts < 2 || got.LastError == "" {
+		t.Errorf("Unexpected recent state: %+v", got)
+	}
+}
+
+func TestProbeTracker_ServeHTTP(t *testing.T) {
+	tracker := NewProbeTracker(1)
+	tracker.start(ProbeTarget{Host: "host", Port: 80})
+	handler := RequireBearerToken("secret", tracker)
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{{
+		name:   "no token",
+		status: http.StatusUnauthorized,
+	}, {
+		name:   "wrong token",
+		auth:   "Bearer nope",
+		status: http.StatusUnauthorized,
+	}, {
+		name:   "right token",
+		auth:   "Bearer secret",
+		status: http.StatusOK,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/probes", nil)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("Status = %d, want %d", w.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var states ProbeStates
+			if err := json.NewDecoder(w.Body).Decode(&states); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(states.InFlight) != 1 || states.InFlight[0].Target != "host:80" {
+				t.Errorf("Unexpected states: %+v", states)
+			}
+		})
+	}
+}
+
+func TestRequireBearerToken_EmptyTokenRejects(t *testing.T) {
+	handler := RequireBearerToken("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/debug/probes", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
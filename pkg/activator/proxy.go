@@ -0,0 +1,365 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"syscall"
+	"time"
+
+	"github.com/knative/serving/pkg/logging/logkey"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// Requests are retried for up to about a minute, backing off from
+	// initialRetryBackoff to maxRetryBackoff between attempts.
+	maxProxyAttempts    = 60
+	initialRetryBackoff = 50 * time.Millisecond
+	maxRetryBackoff     = 1 * time.Second
+
+	// maxConnectionLostRetries bounds how many times a request is
+	// retried after the revision closed the connection without
+	// answering it.
+	maxConnectionLostRetries = 3
+
+	// maxWarmUnavailableRetries bounds how many times a request to a
+	// revision that was warm already is retried after a 503. Such a 503
+	// more likely means the revision is overloaded, as when its
+	// queue-proxy sheds requests, than that it is missing from its
+	// service's endpoints.
+	maxWarmUnavailableRetries = 1
+
+	// maxRetryBodyBytes bounds the request bodies buffered to be replayed
+	// on retries. Requests with larger bodies are not retried.
+	maxRetryBodyBytes = 1 << 20
+)
+
+// NewProxy returns a handler proxying requests to the endpoint through
+// transport, propagating the span of their context if any and leaving
+// out the headers Knative routed them with. Requests whose deadline
+// passes before the revision responds are answered with a 504, and those
+// turned away by a circuit breaker with a 503. Bodies cut off by
+// LimitRequestBody are answered with a 413. Other errors are logged to
+// logger and answered with a 502.
+func NewProxy(endpoint Endpoint, transport http.RoundTripper, logger *zap.SugaredLogger) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(endpoint.URL())
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		// The revision was found from the internal headers already, and
+		// has no use for them.
+		StripInternalHeaders(r.Header)
+		if span := trace.FromContext(r.Context()); span != nil {
+			SetSpanContextHeaders(r, span.SpanContext())
+		}
+		// TODO: Clear the host to avoid 404's.
+		// https://github.com/knative/serving/issues/964
+		r.Host = ""
+	}
+	proxy.Transport = transport
+	if endpoint.Activated {
+		proxy.Transport = &activatedRoundTripper{transport: transport}
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// AssignRequestIDs already echoes the request ID, which revisions
+		// may echo too.
+		resp.Header.Del(RequestIDHeader)
+		if span := trace.FromContext(resp.Request.Context()); span != nil {
+			setSpanStatus(span, resp.StatusCode)
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, ErrRequestBodyTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err == ErrCircuitOpen {
+			http.Error(w, "Revision is failing, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Context().Err() == context.DeadlineExceeded {
+			http.Error(w, fmt.Sprintf("Revision did not respond within its timeout of %v", endpoint.Timeout),
+				http.StatusGatewayTimeout)
+			return
+		}
+		logger.Errorw("Proxy error", zap.String(logkey.RequestID, RequestIDFrom(r.Context())), zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
+
+// WithRevisionTimeout bounds r by timeout, the timeout of its revision,
+// counted from start so that the time r spends waiting for the revision
+// to activate counts against it. A timeout of zero means no limit. The
+// returned CancelFunc must be called once r is served.
+func WithRevisionTimeout(r *http.Request, timeout time.Duration, start time.Time) (*http.Request, context.CancelFunc) {
+	if timeout <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), start.Add(timeout))
+	return r.WithContext(ctx), cancel
+}
+
+type activatedKey struct{}
+
+// activatedRoundTripper marks the requests it sends as sent to a revision
+// that was just activated, for retryRoundTripper to keep retrying their
+// 503s.
+type activatedRoundTripper struct {
+	transport http.RoundTripper
+}
+
+func (a *activatedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return a.transport.RoundTrip(r.WithContext(context.WithValue(r.Context(), activatedKey{}, true)))
+}
+
+func activatedFrom(ctx context.Context) bool {
+	activated, _ := ctx.Value(activatedKey{}).(bool)
+	return activated
+}
+
+// RetryHostFunc returns the host:port address a request that could not
+// be served by the one at failed is retried against.
+type RetryHostFunc func(failed string) string
+
+type retryHostKey struct{}
+
+// WithRetryHost returns a copy of ctx in which requests that lose their
+// connection are retried against the address returned by f, rather than
+// the one they were sent to.
+func WithRetryHost(ctx context.Context, f RetryHostFunc) context.Context {
+	return context.WithValue(ctx, retryHostKey{}, f)
+}
+
+func retryHostFrom(ctx context.Context) RetryHostFunc {
+	f, _ := ctx.Value(retryHostKey{}).(RetryHostFunc)
+	return f
+}
+
+type retryBudgetKey struct{}
+
+type revisionRetryBudget struct {
+	budget    *RetryBudget
+	namespace string
+	name      string
+}
+
+// WithRetryBudget returns a copy of ctx in which requests count against
+// the retry budget of the named revision, and are only retried after
+// reaching the revision while it allows.
+func WithRetryBudget(ctx context.Context, budget *RetryBudget, namespace, name string) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, &revisionRetryBudget{
+		budget:    budget,
+		namespace: namespace,
+		name:      name,
+	})
+}
+
+func retryBudgetFrom(ctx context.Context) *revisionRetryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*revisionRetryBudget)
+	return b
+}
+
+var _ http.RoundTripper = (*retryRoundTripper)(nil)
+
+// retryRoundTripper retries requests that failed to connect or were
+// answered with a 503. A revision that was just found ready may still be
+// missing from its service's endpoints for a little while.
+// https://github.com/knative/serving/issues/660#issuecomment-384062553
+// Only requests proxied by NewProxy to a revision it had to activate are
+// retried that long after a 503, and others at most
+// maxWarmUnavailableRetries times.
+// Requests whose connection was lost before any response arrived, as
+// when a pod is killed right after passing its readiness probe, or whose
+// pod was evicted with WithEvictions, are also retried a few times,
+// against another pod when WithRetryHost says so.
+// Retries of requests that reached the revision are bounded by the
+// budget set with WithRetryBudget, if any.
+type retryRoundTripper struct {
+	transport http.RoundTripper
+	logger    *zap.SugaredLogger
+
+	// for testing
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxBodyBytes   int64
+}
+
+// NewRetryRoundTripper creates a RoundTripper sending requests through
+// transport, retrying with backoff those that could not connect, lost
+// their connection before a response or got a 503.
+func NewRetryRoundTripper(transport http.RoundTripper, logger *zap.SugaredLogger) http.RoundTripper {
+	return &retryRoundTripper{
+		transport:      transport,
+		logger:         logger,
+		maxAttempts:    maxProxyAttempts,
+		initialBackoff: initialRetryBackoff,
+		maxBackoff:     maxRetryBackoff,
+		maxBodyBytes:   maxRetryBodyBytes,
+	}
+}
+
+func (rrt *retryRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport := rrt.transport
+
+	// Bodies of unknown length, like gRPC streams, and those too large to
+	// buffer are passed through as they arrive, so they are not retried.
+	if r.Body != nil && r.Body != http.NoBody && (r.ContentLength < 0 || r.ContentLength > rrt.maxBodyBytes) {
+		return transport.RoundTrip(r)
+	}
+
+	// The request body cannot be read multiple times for retries, so it
+	// is buffered to be replayed.
+	var reqBody *bytes.Reader
+	if r.Body != nil {
+		reqBytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			rrt.logger.Errorf("Error reading request body: %s", err)
+			return nil, err
+		}
+		reqBody = bytes.NewReader(reqBytes)
+		r.Body = ioutil.NopCloser(reqBody)
+	}
+
+	budget := retryBudgetFrom(r.Context())
+	if budget != nil {
+		budget.budget.Request(budget.namespace, budget.name)
+	}
+
+	activated := activatedFrom(r.Context())
+	backoff := rrt.initialBackoff
+	attempts := 1
+	connectionsLost := 0
+	unavailableRetries := 0
+	resp, err := sendEvictable(transport, r)
+	for ; attempts < rrt.maxAttempts && shouldRetry(resp, err) &&
+		(err != nil || activated || unavailableRetries < maxWarmUnavailableRetries) &&
+		rrt.withinBudget(budget, err); attempts++ {
+		if err != nil {
+			rrt.logger.Errorf("Error making a request: %s", err)
+		} else {
+			resp.Body.Close()
+			unavailableRetries++
+		}
+		if connectionLost(err) || err == ErrBackendEvicted {
+			connectionsLost++
+			if connectionsLost > maxConnectionLostRetries {
+				break
+			}
+			if f := retryHostFrom(r.Context()); f != nil {
+				r = withHost(r, f(r.URL.Host))
+			}
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		backoff *= 2
+		if backoff > rrt.maxBackoff {
+			backoff = rrt.maxBackoff
+		}
+
+		if reqBody != nil {
+			reqBody.Seek(0, io.SeekStart)
+		}
+		resp, err = sendEvictable(transport, r)
+	}
+	if resp != nil {
+		rrt.logger.Infof("It took %d tries to get response code %d", attempts, resp.StatusCode)
+	}
+	return resp, err
+}
+
+// withinBudget reports whether the request that failed with err, or a
+// 503 if nil, may be retried within budget. Requests that never reached the
+// revision, as while it is missing from its service's endpoints right
+// after activation, add no load to it and are always retried.
+func (rrt *retryRoundTripper) withinBudget(budget *revisionRetryBudget, err error) bool {
+	if budget == nil || isDialError(err) {
+		return true
+	}
+	if !budget.budget.AllowRetry(budget.namespace, budget.name) {
+		rrt.logger.Infof("Not retrying, the retry budget of %s/%s is used up", budget.namespace, budget.name)
+		return false
+	}
+	return true
+}
+
+// sendEvictable sends r through transport, failing it with
+// ErrBackendEvicted if its pod is evicted from the EvictionTracker set
+// with WithEvictions before responding.
+func sendEvictable(transport http.RoundTripper, r *http.Request) (*http.Response, error) {
+	evictions := evictionsFrom(r.Context())
+	if evictions == nil {
+		return transport.RoundTrip(r)
+	}
+	ctx, responded := evictions.wait(r.Context(), r.URL.Host)
+	resp, err := transport.RoundTrip(r.WithContext(ctx))
+	if responded() && err != nil {
+		return nil, ErrBackendEvicted
+	}
+	return resp, err
+}
+
+// shouldRetry reports whether a request can safely be sent again: it
+// either never reached the revision, lost its connection or had its pod
+// evicted before any of the response was received, or was turned away
+// with a 503. Nothing has been written to the client in any of those
+// cases.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return isDialError(err) || connectionLost(err) || err == ErrBackendEvicted
+	}
+	return resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// isDialError reports whether err means that the connection to the
+// revision could not be opened.
+func isDialError(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// connectionLost reports whether err means that the revision closed or
+// reset the connection of a request before answering it.
+func connectionLost(err error) bool {
+	return err != nil && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET))
+}
+
+// withHost returns a shallow copy of r sent to host instead.
+func withHost(r *http.Request, host string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Host = host
+	r2.URL = &u
+	return r2
+}
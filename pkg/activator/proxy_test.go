@@ -0,0 +1,547 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/h2c"
+	. "github.com/knative/serving/pkg/logging/testing"
+	"golang.org/x/net/http2"
+)
+
+func testRetryRoundTripper(t *testing.T, maxAttempts int) http.RoundTripper {
+	rt := NewRetryRoundTripper(http.DefaultTransport, TestLogger(t)).(*retryRoundTripper)
+	rt.maxAttempts = maxAttempts
+	rt.initialBackoff = time.Millisecond
+	rt.maxBackoff = 5 * time.Millisecond
+	return rt
+}
+
+func serverEndpoint(t *testing.T, s *httptest.Server) Endpoint {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Unexpected server URL %q: %v", s.URL, err)
+	}
+	p, _ := strconv.Atoi(port)
+	return Endpoint{FQDN: host, Port: int32(p)}
+}
+
+// activatedEndpoint is the endpoint of s, as found for a revision that had
+// to be activated.
+func activatedEndpoint(t *testing.T, s *httptest.Server) Endpoint {
+	end := serverEndpoint(t, s)
+	end.Activated = true
+	return end
+}
+
+func TestProxy_RetriesUnavailable(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer s.Close()
+
+	proxy := NewProxy(activatedEndpoint(t, s), testRetryRoundTripper(t, 5), TestLogger(t))
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+	if got := resp.Body.String(); got != "hello" {
+		t.Errorf("Unexpected body. Want %q. Got %q.", "hello", got)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("Unexpected number of attempts. Want 3. Got %v.", got)
+	}
+}
+
+func TestProxy_CapsAttempts(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	proxy := NewProxy(activatedEndpoint(t, s), testRetryRoundTripper(t, 4), TestLogger(t))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 4 {
+		t.Errorf("Unexpected number of attempts. Want 4. Got %v.", got)
+	}
+}
+
+func TestProxy_CapsWarmUnavailableRetries(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	// The revision was warm, so its 503s are not waited out.
+	proxy := NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 10), TestLogger(t))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+	}
+	if got, want := atomic.LoadInt32(&attempts), int32(1+maxWarmUnavailableRetries); got != want {
+		t.Errorf("Unexpected number of attempts. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestProxy_NoRetryOnUnbufferedBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength int64
+	}{{
+		name:          "unknown length",
+		contentLength: -1,
+	}, {
+		name:          "too large",
+		contentLength: 5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer s.Close()
+
+			rt := testRetryRoundTripper(t, 5)
+			rt.(*retryRoundTripper).maxBodyBytes = 4
+			req := httptest.NewRequest("POST", "http://example.com/", ioutil.NopCloser(strings.NewReader("hello")))
+			req.ContentLength = test.contentLength
+			resp := httptest.NewRecorder()
+			NewProxy(serverEndpoint(t, s), rt, TestLogger(t)).ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusServiceUnavailable {
+				t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+			}
+			if got := atomic.LoadInt32(&attempts); got != 1 {
+				t.Errorf("Unexpected number of attempts. Want 1. Got %v.", got)
+			}
+		})
+	}
+}
+
+func TestProxy_RetryBudget(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	// A single request only gets the few retries every revision has.
+	r := &fakeStatsReporter{}
+	budget := NewRetryBudget(20, time.Minute, r)
+	proxy := NewProxy(activatedEndpoint(t, s), testRetryRoundTripper(t, 10), TestLogger(t))
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req = req.WithContext(WithRetryBudget(req.Context(), budget, testNamespace, testRevision))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusServiceUnavailable, resp.Code)
+	}
+	if got, want := atomic.LoadInt32(&attempts), int32(1+minRetryBudget); got != want {
+		t.Errorf("Unexpected number of attempts. Want %v. Got %v.", want, got)
+	}
+	want := []bool{true, true, true, false}
+	if got := r.retriesReported(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected retries reported. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestProxy_RetryBudgetSparesDialErrors(t *testing.T) {
+	// Nothing listens on the address of a closed server.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ep := serverEndpoint(t, s)
+	s.Close()
+
+	r := &fakeStatsReporter{}
+	budget := NewRetryBudget(20, time.Minute, r)
+	proxy := NewProxy(ep, testRetryRoundTripper(t, 6), TestLogger(t))
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req = req.WithContext(WithRetryBudget(req.Context(), budget, testNamespace, testRevision))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := r.retriesReported(); len(got) != 0 {
+		t.Errorf("Unexpected retries charged to the budget for dial errors: %v", got)
+	}
+}
+
+func TestProxy_NoRetryOnOtherErrors(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	proxy := NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 4), TestLogger(t))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusInternalServerError, resp.Code)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("Unexpected number of attempts. Want 1. Got %v.", got)
+	}
+}
+
+// closingServer returns a server closing the connection of the first
+// closes requests it receives without answering them.
+func closingServer(t *testing.T, closes int32, attempts *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(attempts, 1) <= closes {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack() = %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Write(body)
+	}))
+}
+
+func TestProxy_RetriesLostConnection(t *testing.T) {
+	var attempts int32
+	s := closingServer(t, 2, &attempts)
+	defer s.Close()
+
+	proxy := NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 10), TestLogger(t))
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+	if got := resp.Body.String(); got != "hello" {
+		t.Errorf("Unexpected body. Want %q. Got %q.", "hello", got)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("Unexpected number of attempts. Want 3. Got %v.", got)
+	}
+}
+
+func TestProxy_CapsLostConnectionRetries(t *testing.T) {
+	var attempts int32
+	s := closingServer(t, 100, &attempts)
+	defer s.Close()
+
+	proxy := NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 10), TestLogger(t))
+	resp := httptest.NewRecorder()
+	proxy.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/", nil))
+
+	if resp.Code != http.StatusBadGateway {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusBadGateway, resp.Code)
+	}
+	if got, want := atomic.LoadInt32(&attempts), int32(maxConnectionLostRetries+1); got != want {
+		t.Errorf("Unexpected number of attempts. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestProxy_RetriesLostConnectionElsewhere(t *testing.T) {
+	var failing, healthy int32
+	bad := closingServer(t, 100, &failing)
+	defer bad.Close()
+	good := closingServer(t, 0, &healthy)
+	defer good.Close()
+
+	endpoint := serverEndpoint(t, bad)
+	badHost := net.JoinHostPort(endpoint.FQDN, strconv.Itoa(int(endpoint.Port)))
+	var retriedFrom string
+	ctx := WithRetryHost(context.Background(), func(failed string) string {
+		retriedFrom = failed
+		return strings.TrimPrefix(good.URL, "http://")
+	})
+	req := httptest.NewRequest("GET", "http://example.com/", nil).WithContext(ctx)
+	resp := httptest.NewRecorder()
+	NewProxy(endpoint, testRetryRoundTripper(t, 10), TestLogger(t)).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+	if retriedFrom != badHost {
+		t.Errorf("Unexpected failed host. Want %q. Got %q.", badHost, retriedFrom)
+	}
+	if got := atomic.LoadInt32(&failing); got != 1 {
+		t.Errorf("Unexpected number of attempts against the failing pod. Want 1. Got %v.", got)
+	}
+	if got := atomic.LoadInt32(&healthy); got != 1 {
+		t.Errorf("Unexpected number of attempts against the healthy pod. Want 1. Got %v.", got)
+	}
+}
+
+func TestProxy_RedispatchesEvicted(t *testing.T) {
+	release := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stuck.Close()
+	defer close(release)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	endpoint := serverEndpoint(t, stuck)
+	stuckHost := endpoint.Address()
+	evictions := NewEvictionTracker()
+	ctx := WithRetryHost(context.Background(), func(failed string) string {
+		return strings.TrimPrefix(good.URL, "http://")
+	})
+	ctx = WithEvictions(ctx, evictions)
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("body")).WithContext(ctx)
+	resp := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		NewProxy(endpoint, testRetryRoundTripper(t, 10), TestLogger(t)).ServeHTTP(resp, req)
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for evictions.Evict(stuckHost) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the request to wait on the stuck pod.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-served:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the evicted request to be re-dispatched.")
+	}
+	if resp.Code != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusOK, resp.Code)
+	}
+}
+
+func TestProxy_H2CStream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	defer l.Close()
+	// Serve HTTP/2 with prior knowledge only, answering like a gRPC server.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.ProtoMajor != 2 {
+						w.WriteHeader(http.StatusHTTPVersionNotSupported)
+						return
+					}
+					body, _ := ioutil.ReadAll(r.Body)
+					w.Header().Set("Trailer", "Grpc-Status")
+					w.Header().Set("Content-Type", "application/grpc")
+					w.Write(body)
+					w.Header().Set("Grpc-Status", "0")
+				}),
+			})
+		}
+	}()
+
+	endpoint := Endpoint{
+		FQDN:     "127.0.0.1",
+		Port:     int32(l.Addr().(*net.TCPAddr).Port),
+		Protocol: v1alpha1.RevisionProtocolH2C,
+	}
+	transport := NewRetryRoundTripper(h2c.NewTransportWithTimeouts(time.Second, 0), TestLogger(t))
+	req := httptest.NewRequest("POST", "http://example.com/pkg.Service/Method", ioutil.NopCloser(strings.NewReader("message")))
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	NewProxy(endpoint, transport, TestLogger(t)).ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusOK, resp.StatusCode)
+	}
+	if got := rec.Body.String(); got != "message" {
+		t.Errorf("Unexpected body. Want %q. Got %q.", "message", got)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Unexpected Grpc-Status trailer. Want %q. Got %q.", "0", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want bool
+	}{{
+		name: "unavailable",
+		resp: &http.Response{StatusCode: http.StatusServiceUnavailable},
+		want: true,
+	}, {
+		name: "ok",
+		resp: &http.Response{StatusCode: http.StatusOK},
+	}, {
+		name: "dial error",
+		err:  &net.OpError{Op: "dial", Net: "tcp"},
+		want: true,
+	}, {
+		name: "read error",
+		err:  &net.OpError{Op: "read", Net: "tcp"},
+	}, {
+		name: "connection reset",
+		err:  &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		want: true,
+	}, {
+		name: "connection closed",
+		err:  io.EOF,
+		want: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := shouldRetry(test.resp, test.err); got != test.want {
+				t.Errorf("Unexpected shouldRetry. Want %v. Got %v.", test.want, got)
+			}
+		})
+	}
+}
+
+func TestProxy_RevisionTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+
+	endpoint := serverEndpoint(t, s)
+	endpoint.Timeout = 100 * time.Millisecond
+	// Most of the timeout was already spent waiting for activation.
+	req, cancel := WithRevisionTimeout(httptest.NewRequest("GET", "http://example.com/", nil),
+		endpoint.Timeout, time.Now().Add(-50*time.Millisecond))
+	defer cancel()
+	resp := httptest.NewRecorder()
+	start := time.Now()
+	NewProxy(endpoint, testRetryRoundTripper(t, 4), TestLogger(t)).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusGatewayTimeout {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusGatewayTimeout, resp.Code)
+	}
+	if got := resp.Body.String(); !strings.Contains(got, "timeout of 100ms") {
+		t.Errorf("Unexpected body. Want the revision timeout. Got %q.", got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Unexpected proxy duration. Want about 50ms. Got %v.", elapsed)
+	}
+}
+
+func TestProxy_StripsInternalHeaders(t *testing.T) {
+	var got http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer s.Close()
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Knative-Serving-Revision", testRevision)
+	req.Header.Set("Knative-Serving-Namespace", testNamespace)
+	req.Header.Set("X-Custom", "kept")
+	NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 1), TestLogger(t)).ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, name := range []string{"Knative-Serving-Revision", "Knative-Serving-Namespace"} {
+		if v, ok := got[name]; ok {
+			t.Errorf("Unexpected %s header sent to the revision: %v", name, v)
+		}
+	}
+	if v := got.Get("X-Custom"); v != "kept" {
+		t.Errorf("Unexpected X-Custom header. Want %q. Got %q.", "kept", v)
+	}
+	// The revision is still known from the request that was received.
+	if v := req.Header.Get("Knative-Serving-Revision"); v != testRevision {
+		t.Errorf("Unexpected Knative-Serving-Revision header on the request. Want %q. Got %q.", testRevision, v)
+	}
+}
+
+func TestProxy_RequestBodyTooLarge(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer s.Close()
+
+	// Without a length, the body is only found too large once read.
+	req := httptest.NewRequest("POST", "http://example.com/", ioutil.NopCloser(strings.NewReader("abcde")))
+	req.ContentLength = -1
+	resp := httptest.NewRecorder()
+	NewProxy(serverEndpoint(t, s), testRetryRoundTripper(t, 1), TestLogger(t)).ServeHTTP(resp, LimitRequestBody(req, 4))
+
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status. Want %v. Got %v.", http.StatusRequestEntityTooLarge, resp.Code)
+	}
+	if calls != 0 {
+		t.Errorf("Unexpected requests to the revision. Want 0. Got %v.", calls)
+	}
+}
+
+func TestWithRevisionTimeout_NoLimit(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	got, cancel := WithRevisionTimeout(req, 0, time.Now())
+	defer cancel()
+	if _, ok := got.Context().Deadline(); ok {
+		t.Error("Unexpected deadline for a revision without a timeout.")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/knative/serving/pkg/apis/serving"
+)
+
+// ErrRequestBodyTooLarge is returned when reading a request body past the
+// limit set by LimitRequestBody.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// MaxRequestBodyBytesFromAnnotations returns the request body limit a
+// revision sets with its annotations, or zero when it sets none.
+func MaxRequestBodyBytesFromAnnotations(annotations map[string]string) (int64, error) {
+	raw, ok := annotations[serving.MaxRequestBodyBytesAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", serving.MaxRequestBodyBytesAnnotationKey, err)
+	}
+	if limit <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive, got %d", serving.MaxRequestBodyBytesAnnotationKey, limit)
+	}
+	return limit, nil
+}
+
+// LimitRequestBody returns a shallow copy of r whose body fails with
+// ErrRequestBodyTooLarge once more than limit bytes were read from it.
+func LimitRequestBody(r *http.Request, limit int64) *http.Request {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Body = &limitedBody{ReadCloser: r.Body, remaining: limit}
+	return r2
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrRequestBodyTooLarge
+	}
+	// Reading one byte past the limit tells bodies of exactly the limit
+	// from larger ones.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, ErrRequestBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/knative/serving/pkg/apis/serving"
+)
+
+func TestMaxRequestBodyBytesFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int64
+		wantErr     bool
+	}{{
+		name: "not annotated",
+	}, {
+		name:        "limited",
+		annotations: map[string]string{serving.MaxRequestBodyBytesAnnotationKey: "1024"},
+		want:        1024,
+	}, {
+		name:        "zero",
+		annotations: map[string]string{serving.MaxRequestBodyBytesAnnotationKey: "0"},
+		wantErr:     true,
+	}, {
+		name:        "invalid",
+		annotations: map[string]string{serving.MaxRequestBodyBytesAnnotationKey: "1MB"},
+		wantErr:     true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := MaxRequestBodyBytesFromAnnotations(test.annotations)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("MaxRequestBodyBytesFromAnnotations() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Unexpected result. Want %v. Got %v.", test.want, got)
+			}
+		})
+	}
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{{
+		name: "under the limit",
+		body: "abc",
+	}, {
+		name: "at the limit",
+		body: "abcd",
+	}, {
+		name:    "over the limit",
+		body:    "abcde",
+		wantErr: ErrRequestBodyTooLarge,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := LimitRequestBody(httptest.NewRequest("POST", "http://example.com/", strings.NewReader(test.body)), 4)
+			got, err := ioutil.ReadAll(r.Body)
+			if err != test.wantErr {
+				t.Errorf("Unexpected error. Want %v. Got %v.", test.wantErr, err)
+			}
+			if want := test.body[:len(got)]; string(got) != want || len(got) > 4 {
+				t.Errorf("Unexpected body. Got %q.", got)
+			}
+		})
+	}
+}
+
+func TestLimitRequestBody_NoBody(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	if got := LimitRequestBody(r, 4); got != r {
+		t.Errorf("Unexpected request. Want %v. Got %v.", r, got)
+	}
+}
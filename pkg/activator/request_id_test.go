@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestAssignRequestIDs(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header string
+	}{{
+		name: "generated",
+	}, {
+		name:   "kept",
+		header: "req-1",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			var gotHeader, gotCtx string
+			h := AssignRequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotHeader = r.Header.Get(RequestIDHeader)
+				gotCtx = RequestIDFrom(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			if test.header != "" {
+				req.Header.Set(RequestIDHeader, test.header)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			if test.header != "" && gotHeader != test.header {
+				t.Errorf("Unexpected request ID. Want %q. Got %q.", test.header, gotHeader)
+			}
+			if test.header == "" && !uuidPattern.MatchString(gotHeader) {
+				t.Errorf("Unexpected request ID. Want a UUID. Got %q.", gotHeader)
+			}
+			if gotCtx != gotHeader {
+				t.Errorf("Unexpected request ID in context. Want %q. Got %q.", gotHeader, gotCtx)
+			}
+			if got := resp.Header().Get(RequestIDHeader); got != gotHeader {
+				t.Errorf("Unexpected response request ID. Want %q. Got %q.", gotHeader, got)
+			}
+		})
+	}
+}
+
+func TestNewRequestID_Unique(t *testing.T) {
+	if a, b := newRequestID(), newRequestID(); a == b {
+		t.Errorf("Unexpected duplicate request ID %q.", a)
+	}
+}
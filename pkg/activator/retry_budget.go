@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// retryBudgetBuckets is the number of buckets the window of a retry
+	// budget slides by.
+	retryBudgetBuckets = 10
+
+	// minRetryBudget is how many retries a revision is allowed within
+	// the window regardless of its requests, so that revisions getting
+	// few requests can still retry some.
+	minRetryBudget = 3
+)
+
+// RetryBudget bounds the retries of the requests to each revision to a
+// percentage of those requests over a sliding window, so that retries
+// do not pile up on a revision that is already struggling.
+type RetryBudget struct {
+	percent  int
+	window   time.Duration
+	reporter StatsReporter
+	now      func() time.Time // for testing
+
+	mux       sync.Mutex
+	revisions map[revisionID]*retryWindow
+}
+
+type retryWindow struct {
+	buckets [retryBudgetBuckets]retryBucket
+}
+
+type retryBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// NewRetryBudget creates a RetryBudget allowing the retries of each
+// revision to reach percent of its requests within window, plus a few.
+// The retries allowed and skipped are reported to reporter, unless it
+// is nil.
+func NewRetryBudget(percent int, window time.Duration, reporter StatsReporter) *RetryBudget {
+	return &RetryBudget{
+		percent:   percent,
+		window:    window,
+		reporter:  reporter,
+		now:       time.Now,
+		revisions: make(map[revisionID]*retryWindow),
+	}
+}
+
+// bucket returns the current bucket of the window of id, emptying it if
+// it last belonged to an earlier turn of the window. It is called with
+// mux held.
+func (b *RetryBudget) bucket(id revisionID) *retryBucket {
+	w, ok := b.revisions[id]
+	if !ok {
+		w = &retryWindow{}
+		b.revisions[id] = w
+	}
+	width := b.window / retryBudgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+	start := b.now().Truncate(width)
+	bucket := &w.buckets[int(start.UnixNano()/int64(width))%retryBudgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBucket{start: start}
+	}
+	return bucket
+}
+
+// totals returns the requests and retries of id within the window. It
+// is called with mux held.
+func (b *RetryBudget) totals(id revisionID) (requests, retries int) {
+	w := b.revisions[id]
+	since := b.now().Add(-b.window)
+	for _, bucket := range w.buckets {
+		if bucket.start.After(since) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
+
+// Request records a request to the named revision.
+func (b *RetryBudget) Request(namespace, name string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.bucket(revisionID{namespace: namespace, name: name}).requests++
+}
+
+// AllowRetry reports whether a request to the named revision may be
+// retried within its budget, recording the retry if so.
+func (b *RetryBudget) AllowRetry(namespace, name string) bool {
+	id := revisionID{namespace: namespace, name: name}
+	b.mux.Lock()
+	bucket := b.bucket(id)
+	requests, retries := b.totals(id)
+	allowed := requests*b.percent/100 + minRetryBudget
+	ok := retries < allowed
+	if ok {
+		bucket.retries++
+		retries++
+	}
+	b.mux.Unlock()
+
+	if b.reporter != nil {
+		b.reporter.ReportRetry(namespace, name, ok, float64(retries)/float64(allowed))
+	}
+	return ok
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Now()
+	b := NewRetryBudget(20, 10*time.Second, nil)
+	b.now = func() time.Time { return now }
+
+	// 50 requests allow 10 retries, plus the few every revision has.
+	for i := 0; i < 50; i++ {
+		b.Request("ns", "rev")
+	}
+	want := 50*20/100 + minRetryBudget
+	for i := 0; i < want; i++ {
+		if !b.AllowRetry("ns", "rev") {
+			t.Fatalf("Unexpected retry %d denied. Want %d allowed.", i+1, want)
+		}
+	}
+	if b.AllowRetry("ns", "rev") {
+		t.Error("Unexpected retry allowed past the budget.")
+	}
+
+	// Other revisions have their own budget.
+	if !b.AllowRetry("ns", "other") {
+		t.Error("Unexpected retry denied for another revision.")
+	}
+
+	// Requests and retries fall out of the window as it slides.
+	now = now.Add(11 * time.Second)
+	for i := 0; i < minRetryBudget; i++ {
+		if !b.AllowRetry("ns", "rev") {
+			t.Fatalf("Unexpected retry %d denied once the window slid.", i+1)
+		}
+	}
+	if b.AllowRetry("ns", "rev") {
+		t.Error("Unexpected retry allowed without requests in the window.")
+	}
+}
+
+func TestRetryBudget_PartialSlide(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	b := NewRetryBudget(50, 10*time.Second, nil)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 20; i++ {
+		b.Request("ns", "rev")
+	}
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 20; i++ {
+		b.Request("ns", "rev")
+	}
+
+	// Half the window later, only the later requests still count.
+	now = now.Add(6 * time.Second)
+	allowed := 0
+	for b.AllowRetry("ns", "rev") {
+		allowed++
+	}
+	if want := 20*50/100 + minRetryBudget; allowed != want {
+		t.Errorf("Unexpected number of retries allowed. Want %d. Got %d.", want, allowed)
+	}
+}
@@ -16,52 +16,211 @@ limitations under the License.
 package activator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
+	servingScheme "github.com/knative/serving/pkg/client/clientset/versioned/scheme"
 	revisionresourcenames "github.com/knative/serving/pkg/controller/revision/resources/names"
+	"github.com/knative/serving/pkg/leaderelection"
 	"github.com/knative/serving/pkg/logging/logkey"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
+// ErrColdStartSLOExceeded is returned for activations that took longer
+// than the cold-start SLO.
+var ErrColdStartSLOExceeded = errors.New("revision did not become ready within its cold-start SLO")
+
+// probeResultPollInterval is how often the probe results shared by the
+// activator owning a revision are checked while waiting on them.
+const probeResultPollInterval = 100 * time.Millisecond
+
 var _ Activator = (*revisionActivator)(nil)
+var _ HealthChecker = (*revisionActivator)(nil)
+var _ Reconfigurable = (*revisionActivator)(nil)
 
 type revisionActivator struct {
-	readyTimout time.Duration // for testing
-	kubeClient  kubernetes.Interface
-	knaClient   clientset.Interface
-	logger      *zap.SugaredLogger
+	readyTimout  time.Duration                            // for testing
+	checkProbe   func(context.Context, ProbeTarget) (int, error) // for testing
+	kubeClient   kubernetes.Interface
+	knaClient    clientset.Interface
+	configMux    sync.RWMutex
+	config       *Config
+	probeResults ProbeResults
+	buckets      *leaderelection.Buckets
+	upstreamTLS  *UpstreamTLS
+	monitor      *ProbeMonitor
+	recorder     record.EventRecorder
+	logger       *zap.SugaredLogger
+
+	// verified holds the addresses of the endpoints this activator probed
+	// ready since their revision last was not, which are not probed again
+	// while it stays ready.
+	verifiedMux sync.Mutex
+	verified    map[string]bool
 }
 
 // NewRevisionActivator creates an Activator that changes revision
 // serving status to active if necessary, then returns the endpoint
-// once the revision is ready to serve traffic.
-func NewRevisionActivator(kubeClient kubernetes.Interface, servingClient clientset.Interface, logger *zap.SugaredLogger) Activator {
-	return &revisionActivator{
-		readyTimout: 60 * time.Second,
-		kubeClient:  kubeClient,
-		knaClient:   servingClient,
-		logger:      logger,
+// once the revision is ready to serve traffic. probeResults may be nil
+// to always probe revisions before returning their endpoint. With
+// buckets, revisions owned by another replica are only probed if it does
+// not share their probe result in time. buckets is ignored without
+// probeResults, and may be nil. upstreamTLS may be nil if no revision is
+// to be reached over TLS.
+func NewRevisionActivator(kubeClient kubernetes.Interface, servingClient clientset.Interface, config *Config, probeResults ProbeResults, buckets *leaderelection.Buckets, upstreamTLS *UpstreamTLS, logger *zap.SugaredLogger) Activator {
+	r := &revisionActivator{
+		readyTimout:  60 * time.Second,
+		checkProbe:   CheckProbe,
+		kubeClient:   kubeClient,
+		knaClient:    servingClient,
+		config:       config,
+		probeResults: probeResults,
+		buckets:      buckets,
+		upstreamTLS:  upstreamTLS,
+		recorder:     newEventRecorder(kubeClient, logger),
+		logger:       logger,
+		verified:     make(map[string]bool),
 	}
+	if config.ProbeMonitorPeriod > 0 {
+		r.monitor = NewProbeMonitor(config.ProbeMonitorPeriod, r.endpointNotReady)
+	}
+	return r
+}
+
+// newEventRecorder creates a recorder that publishes Events on behalf of
+// the activator.
+func newEventRecorder(kubeClient kubernetes.Interface, logger *zap.SugaredLogger) record.EventRecorder {
+	// Revisions must be known to the scheme to record Events against them.
+	// A scheme of its own keeps the client-go scheme other packages share
+	// as it is.
+	eventScheme := runtime.NewScheme()
+	servingScheme.AddToScheme(eventScheme)
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(logger.Named("event-broadcaster").Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: "activator"})
+}
+
+// SetConfig implements Reconfigurable. The probe monitor keeps the
+// period it was started with.
+func (r *revisionActivator) SetConfig(config *Config) {
+	r.configMux.Lock()
+	defer r.configMux.Unlock()
+	r.config = config
+}
+
+func (r *revisionActivator) loadConfig() *Config {
+	r.configMux.RLock()
+	defer r.configMux.RUnlock()
+	return r.config
 }
 
 func (r *revisionActivator) Shutdown() {
-	// nothing to do
+	if r.monitor != nil {
+		r.monitor.Stop()
+	}
+}
+
+// Healthy implements HealthChecker.
+func (r *revisionActivator) Healthy() error {
+	if r.monitor != nil && !r.monitor.Running() {
+		return errors.New("probe monitor stopped")
+	}
+	return nil
+}
+
+// endpointNotReady is called when a monitored endpoint stops being ready,
+// so that it is probed again on its next activation.
+func (r *revisionActivator) endpointNotReady(target ProbeTarget, err error) {
+	r.logger.Infof("Endpoint %s is no longer ready: %v", getHostFromProbe(target), err)
+	r.setVerified(target, false)
+	if r.probeResults != nil {
+		r.probeResults.MarkNotReady(target)
+	}
+}
+
+func (r *revisionActivator) isVerified(target ProbeTarget) bool {
+	r.verifiedMux.Lock()
+	defer r.verifiedMux.Unlock()
+	return r.verified[getHostFromProbe(target)]
 }
 
-func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint, status Status, activationError error) {
+func (r *revisionActivator) setVerified(target ProbeTarget, verified bool) {
+	r.verifiedMux.Lock()
+	defer r.verifiedMux.Unlock()
+	if verified {
+		r.verified[getHostFromProbe(target)] = true
+	} else {
+		delete(r.verified, getHostFromProbe(target))
+	}
+}
+
+// awaitProbeResult waits up to the probe owner timeout for another
+// replica to share that target is ready, and reports whether it did. It
+// gives up early once ctx is done.
+func (r *revisionActivator) awaitProbeResult(ctx context.Context, target ProbeTarget) bool {
+	deadline := time.Now().Add(r.loadConfig().ProbeOwnerTimeout)
+	for !r.probeResults.Ready(target) {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		select {
+		case <-time.After(probeResultPollInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (r *revisionActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (end Endpoint, status Status, activationError error) {
 	logger := loggerWithRevisionInfo(r.logger, namespace, name)
+	if id := RequestIDFrom(ctx); id != "" {
+		logger = logger.With(zap.String(logkey.RequestID, id))
+	}
 	rev := revisionID{namespace: namespace, name: name}
 
 	internalError := func(msg string, args ...interface{}) (Endpoint, Status, error) {
 		logger.Infof(msg, args...)
 		return Endpoint{}, http.StatusInternalServerError, fmt.Errorf(fmt.Sprintf("%s for namespace: %s, revision name: %s ", msg, namespace, name), args...)
 	}
+	// Past the cold-start SLO, the activation is given up on as if
+	// nobody waited on it anymore.
+	start := time.Now()
+	config := r.loadConfig()
+	requestCtx := ctx
+	if config.ColdStartSLO > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.ColdStartSLO)
+		defer cancel()
+	}
+	var revision *v1alpha1.Revision
+	// Activations nobody waits on anymore are abandoned without counting
+	// as a failure of the revision, unlike those exceeding the SLO.
+	abandoned := func() (Endpoint, Status, error) {
+		if requestCtx.Err() == nil {
+			logger.Infof("Activation exceeded the cold-start SLO after %v", time.Since(start))
+			r.recorder.Eventf(revision, corev1.EventTypeWarning, "ColdStartSLOExceeded",
+				"Revision did not become ready within the cold-start SLO of %v", config.ColdStartSLO)
+			return Endpoint{}, http.StatusServiceUnavailable, ErrColdStartSLOExceeded
+		}
+		logger.Infof("Abandoned activation: %v", ctx.Err())
+		return Endpoint{}, http.StatusGatewayTimeout, ctx.Err()
+	}
 
 	// Get the current revision serving state
 	revisionClient := r.knaClient.ServingV1alpha1().Revisions(rev.namespace)
@@ -69,6 +228,7 @@ func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint
 	if err != nil {
 		return internalError("Unable to get revision: %v", err)
 	}
+	activated := !revision.Status.IsReady()
 	switch revision.Spec.ServingState {
 	default:
 		return internalError("Disregarding activation request for revision in unknown state %v", revision.Spec.ServingState)
@@ -83,8 +243,13 @@ func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint
 			return internalError("Failed to activate revision %v", err)
 		}
 		logger.Info("Activated revision")
+		activated = true
 	}
 
+	// The number of times the revision was observed to be not ready, by
+	// its initial Get and by the updates of the watch below.
+	notReadyUpdates := 1
+
 	// Wait for the revision to be ready
 	if !revision.Status.IsReady() {
 		wi, err := r.knaClient.ServingV1alpha1().Revisions(rev.namespace).Watch(metav1.ListOptions{
@@ -95,15 +260,31 @@ func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint
 		}
 		defer wi.Stop()
 		ch := wi.ResultChan()
+
+		// Watch the revision's pods as well, so that we can give up early
+		// if they cannot start rather than waiting for the timeout.
+		pw, err := r.kubeClient.CoreV1().Pods(rev.namespace).Watch(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", serving.RevisionLabelKey, rev.name),
+		})
+		if err != nil {
+			return internalError("Failed to watch the revision pods")
+		}
+		defer pw.Stop()
+		podCh := pw.ResultChan()
 	RevisionReady:
 		for {
 			select {
 			case <-time.After(r.readyTimout):
+				r.recordActivationFailure(revision, "Revision was reported not ready %d times before activation failed: %s",
+					notReadyUpdates, "timed out waiting for revision to become ready")
 				return internalError("Timeout waiting for revision to become ready")
+			case <-ctx.Done():
+				return abandoned()
 			case event := <-ch:
 				if revision, ok := event.Object.(*v1alpha1.Revision); ok {
 					if !revision.Status.IsReady() {
 						logger.Info("Revision is not yet ready")
+						notReadyUpdates++
 						continue
 					} else {
 						logger.Info("Revision is ready")
@@ -112,6 +293,21 @@ func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint
 				} else {
 					return internalError("Unexpected result type for revision: %v", event)
 				}
+			case event, ok := <-podCh:
+				if !ok {
+					// The pod watch ended; keep waiting on the revision alone.
+					podCh = nil
+					continue
+				}
+				pod, ok := event.Object.(*corev1.Pod)
+				if !ok || event.Type == watch.Deleted {
+					continue
+				}
+				if message, failed := podFailure(pod); failed {
+					r.recordActivationFailure(revision, "Revision was reported not ready %d times before activation failed: %s",
+						notReadyUpdates, message)
+					return internalError("Revision failed to activate: %s", message)
+				}
 			}
 		}
 	}
@@ -125,20 +321,132 @@ func (r *revisionActivator) ActiveEndpoint(namespace, name string) (end Endpoint
 			serviceName, err)
 	}
 
+	target, err := RevisionProbeTarget(revision, svc)
+	if err != nil {
+		return internalError("Unable to probe revision: %v", err)
+	}
+	target.ConnectTimeout = config.ProbeConnectTimeout
+	target.ResponseTimeout = config.ProbeResponseTimeout
+	useTLS, err := UpstreamTLSFromAnnotations(revision.Annotations)
+	if err != nil {
+		return internalError("Unable to probe revision: %v", err)
+	}
+	if useTLS {
+		if r.upstreamTLS == nil {
+			return internalError("Revision requires upstream TLS, but no upstream CA is configured")
+		}
+		target.TLS = r.upstreamTLS.ClientConfig(target.Host)
+	}
+	maxRequestBodyBytes, err := MaxRequestBodyBytesFromAnnotations(revision.Annotations)
+	if err != nil {
+		return internalError("Unable to proxy to revision: %v", err)
+	}
+	hedgeDelay, err := HedgeDelayFromAnnotations(revision.Annotations)
+	if err != nil {
+		return internalError("Unable to proxy to revision: %v", err)
+	}
+	shadowRevision, shadowPercent, err := ShadowFromAnnotations(revision.Annotations)
+	if err != nil {
+		return internalError("Unable to proxy to revision: %v", err)
+	}
+
+	// The revision reporting ready does not mean its service is routable
+	// yet, so probe the endpoint before handing it out. Revisions that were
+	// ready already are only probed until this activator found them so.
+	if activated {
+		r.setVerified(target, false)
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, r.readyTimout)
+	defer cancel()
+	switch {
+	case !activated && r.isVerified(target):
+		// Warm revisions cost no probe on top of every request.
+	case r.probeResults != nil && r.probeResults.Ready(target):
+		logger.Info("Skipping probe of revision found ready by another activator")
+	case r.probeResults != nil && r.buckets != nil && !r.buckets.Owns(namespace, name) && r.awaitProbeResult(ctx, target):
+		logger.Info("Skipping probe of revision found ready by the activator owning it")
+	case ctx.Err() != nil:
+		return abandoned()
+	default:
+		if attempts, err := r.checkProbe(probeCtx, target); err != nil {
+			if ctx.Err() != nil {
+				return abandoned()
+			}
+			r.recordActivationFailure(revision, "Revision endpoint failed %d probe attempts before activation failed: %s",
+				attempts, err.Error())
+			return internalError("Revision endpoint did not become ready: %v", err)
+		}
+		r.setVerified(target, true)
+		if r.probeResults != nil {
+			r.probeResults.MarkReady(target)
+		}
+	}
+	if r.monitor != nil {
+		r.monitor.Monitor(target)
+	}
+
+	// Return the endpoint and active=true
+	end = target.Endpoint()
+	end.Timeout = time.Duration(revision.Spec.TimeoutSeconds) * time.Second
+	end.Activated = activated
+	end.MaxRequestBodyBytes = maxRequestBodyBytes
+	end.HedgeDelay = hedgeDelay
+	end.ShadowRevision, end.ShadowPercent = shadowRevision, shadowPercent
+	return end, 0, nil
+}
+
+// RevisionProbeTarget returns the target probed to tell whether revision,
+// served by svc, is ready for traffic.
+func RevisionProbeTarget(revision *v1alpha1.Revision, svc *corev1.Service) (ProbeTarget, error) {
 	// TODO: in the future, the target service could have more than one port.
 	// https://github.com/knative/serving/issues/837
 	if len(svc.Spec.Ports) != 1 {
-		return internalError("Revision needs one port. Found %v", len(svc.Spec.Ports))
+		return ProbeTarget{}, fmt.Errorf("revision needs one port, found %v", len(svc.Spec.Ports))
+	}
+	expectedBody, err := ExpectedBodyFromAnnotations(revision.Annotations)
+	if err != nil {
+		return ProbeTarget{}, fmt.Errorf("invalid readiness probe annotation: %v", err)
 	}
-	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, revision.Namespace)
-	port := svc.Spec.Ports[0].Port
+	return ProbeTarget{
+		Host:  fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, revision.Namespace),
+		Port:  svc.Spec.Ports[0].Port,
+		Probe: revision.Spec.Container.ReadinessProbe,
 
-	// Return the endpoint and active=true
-	end = Endpoint{
-		FQDN: fqdn,
-		Port: port,
+		ExpectedBody: expectedBody,
+		H2C:          IsH2CPort(svc.Spec.Ports[0]),
+	}, nil
+}
+
+// terminalWaitingReasons are the reasons of waiting containers that do
+// not recover without a change to the revision, so that the revision
+// cannot become ready.
+var terminalWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// podFailure reports whether a container of the given pod is in a terminal
+// state, meaning the revision cannot become ready, along with a
+// human-readable message. Pods being deleted are not failures, as they are
+// replaced while the revision still needs them.
+func podFailure(pod *corev1.Pod) (string, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if w := status.State.Waiting; w != nil && terminalWaitingReasons[w.Reason] {
+			return fmt.Sprintf("container %s in pod %s is in %s: %s", status.Name, pod.Name, w.Reason, w.Message), true
+		}
 	}
-	return end, 0, nil
+	return "", false
+}
+
+// recordActivationFailure emits a warning Event on the revision so that
+// activation failures show up in `kubectl describe revision`.
+func (r *revisionActivator) recordActivationFailure(revision *v1alpha1.Revision, messageFmt string, args ...interface{}) {
+	r.recorder.Eventf(revision, corev1.EventTypeWarning, "ActivationProbeFailed", messageFmt, args...)
 }
 
 // loggerWithRevisionInfo enriches the logs with revision name and namespace.
@@ -0,0 +1,391 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// zoneLabelKey is the label of nodes naming their failure domain.
+const zoneLabelKey = "failure-domain.beta.kubernetes.io/zone"
+
+// RevisionBackends lists the addresses of the pods ready to serve
+// revisions.
+type RevisionBackends interface {
+	// Backends returns the host:port addresses of the pods ready to
+	// serve the named revision, sorted.
+	Backends(namespace, name string) []string
+
+	// Pod returns the pod at the host:port address addr among the
+	// backends of the named revision, if known.
+	Pod(namespace, name, addr string) (Pod, bool)
+
+	// ReadySince returns when the pod at addr became one of the backends
+	// of the named revision, or the zero time if it is not one.
+	ReadySince(namespace, name, addr string) time.Time
+}
+
+var _ RevisionBackends = (*RevisionBackendsManager)(nil)
+
+// RevisionBackendsManager tracks the pods ready to serve each revision
+// from the Endpoints of its service. Pods Kubernetes adds to the ready
+// addresses are probed once before they are used, so that requests are
+// not sent to pods the activator cannot reach yet. Pods failing that
+// probe are probed again on the next update of the Endpoints, at the
+// latest when the informer resyncs.
+type RevisionBackendsManager struct {
+	nodes  corev1listers.NodeLister
+	logger *zap.SugaredLogger
+
+	// for testing
+	probeAll func(ctx context.Context, targets []ProbeTarget, concurrency int) []probeResult
+
+	// monitor, when set, keeps probing the pods in use, and onNotReady
+	// is called with those dropped for failing.
+	monitor    *ProbeMonitor
+	onNotReady func(namespace, name, addr string)
+
+	mux         sync.RWMutex
+	backends    map[revisionID]*revisionBackends
+	subscribers []func(namespace, name string, addrs []string)
+	// monitored maps the addresses of the monitored pods to their
+	// revision.
+	monitored map[string]revisionID
+}
+
+type revisionBackends struct {
+	// generation counts the updates of the Endpoints, so that the
+	// results of probes started for an outdated update are dropped.
+	generation int
+	healthy    []string
+	// readySince records when each healthy address passed its probe.
+	readySince map[string]time.Time
+
+	// pods maps the ready addresses of the Endpoints to their pods.
+	pods map[string]Pod
+}
+
+// NewRevisionBackendsManager creates a RevisionBackendsManager fed by the
+// Endpoints known to informer. Endpoints are matched to revisions by
+// their serving.RevisionLabelKey label, which they inherit from the
+// revision's service. The zones of the pods are looked up in nodes,
+// unless it is nil.
+func NewRevisionBackendsManager(informer corev1informers.EndpointsInformer, nodes corev1listers.NodeLister, logger *zap.SugaredLogger) *RevisionBackendsManager {
+	m := &RevisionBackendsManager{
+		nodes:     nodes,
+		logger:    logger,
+		probeAll:  probeAll,
+		backends:  make(map[revisionID]*revisionBackends),
+		monitored: make(map[string]revisionID),
+	}
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    m.updateEndpoints,
+		UpdateFunc: func(_, obj interface{}) { m.updateEndpoints(obj) },
+		DeleteFunc: m.deleteEndpoints,
+	})
+	return m
+}
+
+// MonitorBackends has the pods in use probed every period, so that a pod
+// failing a single probe is dropped right away rather than once
+// Kubernetes finds it not ready, after which onNotReady is called with
+// it. Dropped pods are probed again on the next update of the Endpoints.
+// It must be called before any Endpoints are known.
+func (m *RevisionBackendsManager) MonitorBackends(period time.Duration, onNotReady func(namespace, name, addr string)) {
+	m.monitor = NewProbeMonitor(period, m.backendNotReady)
+	m.monitor.failureThreshold = 1
+	m.onNotReady = onNotReady
+}
+
+// Backends implements RevisionBackends.
+func (m *RevisionBackendsManager) Backends(namespace, name string) []string {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if rb, ok := m.backends[revisionID{namespace: namespace, name: name}]; ok {
+		return append([]string(nil), rb.healthy...)
+	}
+	return nil
+}
+
+// Pod implements RevisionBackends.
+func (m *RevisionBackendsManager) Pod(namespace, name, addr string) (Pod, bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if rb, ok := m.backends[revisionID{namespace: namespace, name: name}]; ok {
+		pod, ok := rb.pods[addr]
+		return pod, ok
+	}
+	return Pod{}, false
+}
+
+// ReadySince implements RevisionBackends.
+func (m *RevisionBackendsManager) ReadySince(namespace, name, addr string) time.Time {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if rb, ok := m.backends[revisionID{namespace: namespace, name: name}]; ok {
+		return rb.readySince[addr]
+	}
+	return time.Time{}
+}
+
+// Subscribe calls f with the addresses of the pods ready to serve a
+// revision every time they change. f must not block.
+func (m *RevisionBackendsManager) Subscribe(f func(namespace, name string, addrs []string)) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.subscribers = append(m.subscribers, f)
+}
+
+func revisionIDFromEndpoints(obj interface{}) (revisionID, *corev1.Endpoints, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	eps, ok := obj.(*corev1.Endpoints)
+	if !ok {
+		return revisionID{}, nil, false
+	}
+	name, ok := eps.Labels[serving.RevisionLabelKey]
+	if !ok {
+		return revisionID{}, nil, false
+	}
+	return revisionID{namespace: eps.Namespace, name: name}, eps, true
+}
+
+func (m *RevisionBackendsManager) updateEndpoints(obj interface{}) {
+	id, eps, ok := revisionIDFromEndpoints(obj)
+	if !ok {
+		return
+	}
+	ready := ReadyAddresses(eps)
+	pods := m.readyPods(eps)
+
+	m.mux.Lock()
+	rb, ok := m.backends[id]
+	if !ok {
+		rb = &revisionBackends{readySince: make(map[string]time.Time)}
+		m.backends[id] = rb
+	}
+	rb.generation++
+	generation := rb.generation
+	rb.pods = pods
+	// Pods that are no longer ready are dropped right away, while new
+	// ones are only added once they pass their probe.
+	known := make(map[string]bool, len(rb.healthy))
+	for _, addr := range rb.healthy {
+		known[addr] = true
+	}
+	var healthy, added []string
+	for _, addr := range ready {
+		if known[addr] {
+			healthy = append(healthy, addr)
+			delete(known, addr)
+		} else {
+			added = append(added, addr)
+		}
+	}
+	// The pods left in known are no longer ready.
+	for addr := range known {
+		m.unmonitorLocked(addr)
+	}
+	readySince := make(map[string]time.Time, len(healthy))
+	for _, addr := range healthy {
+		readySince[addr] = rb.readySince[addr]
+	}
+	rb.readySince = readySince
+	changed := len(healthy) != len(rb.healthy)
+	rb.healthy = healthy
+	m.mux.Unlock()
+
+	if changed {
+		m.notify(id, healthy)
+	}
+	if len(added) > 0 {
+		go m.probe(id, generation, added, pods)
+	}
+}
+
+// readyPods returns the pods behind the ready addresses of eps, keyed by
+// address.
+func (m *RevisionBackendsManager) readyPods(eps *corev1.Endpoints) map[string]Pod {
+	pods := make(map[string]Pod)
+	for _, subset := range eps.Subsets {
+		if len(subset.Ports) != 1 {
+			continue
+		}
+		port := strconv.Itoa(int(subset.Ports[0].Port))
+		for _, addr := range subset.Addresses {
+			if addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod := Pod{Name: addr.TargetRef.Name, UID: addr.TargetRef.UID}
+			if m.nodes != nil && addr.NodeName != nil {
+				if node, err := m.nodes.Get(*addr.NodeName); err == nil {
+					pod.Zone = node.Labels[zoneLabelKey]
+				}
+			}
+			pods[net.JoinHostPort(addr.IP, port)] = pod
+		}
+	}
+	return pods
+}
+
+// probe adds the addrs passing their probe to the backends of the
+// revision, unless its Endpoints were updated since generation.
+func (m *RevisionBackendsManager) probe(id revisionID, generation int, addrs []string, pods map[string]Pod) {
+	targets := make([]ProbeTarget, 0, len(addrs))
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		p, _ := strconv.Atoi(port)
+		target := ProbeTarget{Host: host, Port: int32(p)}
+		if pod, ok := pods[addr]; ok {
+			target.Pod = &pod
+		}
+		targets = append(targets, target)
+	}
+	var passed []string
+	var passedTargets []ProbeTarget
+	for _, result := range m.probeAll(context.Background(), targets, 0) {
+		if result.Err != nil {
+			m.logger.Infof("Pod %s of %s/%s is not reachable yet: %v",
+				podDescription(result.Target), id.namespace, id.name, result.Err)
+			continue
+		}
+		passed = append(passed, getHostFromProbe(result.Target))
+		passedTargets = append(passedTargets, result.Target)
+	}
+	if len(passed) == 0 {
+		return
+	}
+
+	m.mux.Lock()
+	rb, ok := m.backends[id]
+	if !ok || rb.generation != generation {
+		m.mux.Unlock()
+		return
+	}
+	healthy := append(append([]string(nil), rb.healthy...), passed...)
+	sort.Strings(healthy)
+	rb.healthy = healthy
+	now := time.Now()
+	for _, addr := range passed {
+		rb.readySince[addr] = now
+	}
+	if m.monitor != nil {
+		for _, target := range passedTargets {
+			m.monitored[getHostFromProbe(target)] = id
+			m.monitor.Monitor(target)
+		}
+	}
+	m.mux.Unlock()
+	m.notify(id, healthy)
+}
+
+// backendNotReady is called by the monitor when a pod in use fails its
+// probe, to drop it.
+func (m *RevisionBackendsManager) backendNotReady(target ProbeTarget, err error) {
+	addr := getHostFromProbe(target)
+	m.mux.Lock()
+	id, ok := m.monitored[addr]
+	delete(m.monitored, addr)
+	rb, found := m.backends[id]
+	if !ok || !found {
+		m.mux.Unlock()
+		return
+	}
+	healthy := make([]string, 0, len(rb.healthy))
+	for _, a := range rb.healthy {
+		if a != addr {
+			healthy = append(healthy, a)
+		}
+	}
+	dropped := len(healthy) != len(rb.healthy)
+	rb.healthy = healthy
+	delete(rb.readySince, addr)
+	m.mux.Unlock()
+	if !dropped {
+		return
+	}
+
+	m.logger.Infof("Pod %s of %s/%s is no longer ready: %v", podDescription(target), id.namespace, id.name, err)
+	m.notify(id, healthy)
+	if m.onNotReady != nil {
+		m.onNotReady(id.namespace, id.name, addr)
+	}
+}
+
+// unmonitorLocked stops monitoring the pod at addr, if it is. m.mux must
+// be held.
+func (m *RevisionBackendsManager) unmonitorLocked(addr string) {
+	if _, ok := m.monitored[addr]; !ok {
+		return
+	}
+	delete(m.monitored, addr)
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	m.monitor.Unmonitor(ProbeTarget{Host: host, Port: int32(p)})
+}
+
+func (m *RevisionBackendsManager) deleteEndpoints(obj interface{}) {
+	id, _, ok := revisionIDFromEndpoints(obj)
+	if !ok {
+		return
+	}
+	m.mux.Lock()
+	rb, ok := m.backends[id]
+	if ok {
+		for _, addr := range rb.healthy {
+			m.unmonitorLocked(addr)
+		}
+	}
+	delete(m.backends, id)
+	m.mux.Unlock()
+	if ok {
+		m.notify(id, nil)
+	}
+}
+
+func (m *RevisionBackendsManager) notify(id revisionID, addrs []string) {
+	m.mux.RLock()
+	subscribers := m.subscribers
+	m.mux.RUnlock()
+	for _, f := range subscribers {
+		f(id.namespace, id.name, append([]string(nil), addrs...))
+	}
+}
+
+// podDescription names the pod probed by target, along with its address.
+func podDescription(target ProbeTarget) string {
+	if target.Pod == nil {
+		return getHostFromProbe(target)
+	}
+	return fmt.Sprintf("%s (%s)", target.Pod.Name, getHostFromProbe(target))
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/apis/serving"
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeinformers "k8s.io/client-go/informers"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNode = "node-1"
+	testZone = "zone-a"
+)
+
+func testEndpoints(ready, notReady []string) *corev1.Endpoints {
+	eps := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      testRevision + "-service",
+			Labels:    map[string]string{serving.RevisionLabelKey: testRevision},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 8012}},
+		}},
+	}
+	node := testNode
+	for _, ip := range ready {
+		eps.Subsets[0].Addresses = append(eps.Subsets[0].Addresses, corev1.EndpointAddress{
+			IP:        ip,
+			NodeName:  &node,
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "pod-" + ip, UID: types.UID("uid-" + ip)},
+		})
+	}
+	for _, ip := range notReady {
+		eps.Subsets[0].NotReadyAddresses = append(eps.Subsets[0].NotReadyAddresses, corev1.EndpointAddress{IP: ip})
+	}
+	return eps
+}
+
+func testRevisionBackendsManager(t *testing.T, unreachable ...string) (*RevisionBackendsManager, <-chan []string) {
+	k8s := fakeK8s.NewSimpleClientset()
+	factory := kubeinformers.NewSharedInformerFactory(k8s, time.Minute)
+	nodes := factory.Core().V1().Nodes()
+	nodes.Informer().GetIndexer().Add(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   testNode,
+			Labels: map[string]string{zoneLabelKey: testZone},
+		},
+	})
+	m := NewRevisionBackendsManager(factory.Core().V1().Endpoints(), nodes.Lister(), TestLogger(t))
+	m.probeAll = func(_ context.Context, targets []ProbeTarget, _ int) []probeResult {
+		results := make([]probeResult, len(targets))
+		for i, target := range targets {
+			results[i].Target = target
+			for _, host := range unreachable {
+				if target.Host == host {
+					results[i].Err = errors.New("connection refused")
+				}
+			}
+		}
+		return results
+	}
+	updates := make(chan []string, 10)
+	m.Subscribe(func(namespace, name string, addrs []string) {
+		if namespace == testNamespace && name == testRevision {
+			updates <- addrs
+		}
+	})
+	return m, updates
+}
+
+func waitForBackends(t *testing.T, updates <-chan []string, want []string) {
+	t.Helper()
+	select {
+	case got := <-updates:
+		if !cmp.Equal(want, got) {
+			t.Errorf("Unexpected backends. Want %v. Got %v.", want, got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Timed out waiting for backends %v", want)
+	}
+}
+
+func TestRevisionBackendsManager(t *testing.T) {
+	m, updates := testRevisionBackendsManager(t, "10.0.0.2")
+
+	// Only the ready pods passing their probe are used.
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.3"}))
+	want := []string{"10.0.0.1:8012"}
+	waitForBackends(t, updates, want)
+	if got := m.Backends(testNamespace, testRevision); !cmp.Equal(want, got) {
+		t.Errorf("Unexpected backends. Want %v. Got %v.", want, got)
+	}
+
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1", "10.0.0.4"}, nil))
+	waitForBackends(t, updates, []string{"10.0.0.1:8012", "10.0.0.4:8012"})
+
+	// Pods that are no longer ready are dropped without probing.
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.4"}, []string{"10.0.0.1"}))
+	waitForBackends(t, updates, []string{"10.0.0.4:8012"})
+
+	if m.ReadySince(testNamespace, testRevision, "10.0.0.4:8012").IsZero() {
+		t.Error("Unexpected readiness time of a backend. Want one. Got none.")
+	}
+	if got := m.ReadySince(testNamespace, testRevision, "10.0.0.1:8012"); !got.IsZero() {
+		t.Errorf("Unexpected readiness time of a pod no longer ready. Want none. Got %v.", got)
+	}
+
+	m.deleteEndpoints(testEndpoints(nil, nil))
+	waitForBackends(t, updates, nil)
+	if got := m.Backends(testNamespace, testRevision); got != nil {
+		t.Errorf("Unexpected backends after deletion. Want none. Got %v.", got)
+	}
+}
+
+func TestRevisionBackendsManager_Pod(t *testing.T) {
+	m, updates := testRevisionBackendsManager(t)
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1"}, nil))
+	waitForBackends(t, updates, []string{"10.0.0.1:8012"})
+
+	want := Pod{Name: "pod-10.0.0.1", UID: "uid-10.0.0.1", Zone: testZone}
+	if got, ok := m.Pod(testNamespace, testRevision, "10.0.0.1:8012"); !ok || got != want {
+		t.Errorf("Unexpected pod. Want %+v. Got %+v.", want, got)
+	}
+	if got, ok := m.Pod(testNamespace, testRevision, "10.0.0.2:8012"); ok {
+		t.Errorf("Unexpected pod for an unknown address. Want none. Got %+v.", got)
+	}
+}
+
+func TestRevisionBackendsManager_DropsOutdatedProbes(t *testing.T) {
+	m, updates := testRevisionBackendsManager(t)
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1"}, nil))
+	waitForBackends(t, updates, []string{"10.0.0.1:8012"})
+
+	// A probe started before the last update does not add its pod.
+	m.updateEndpoints(testEndpoints(nil, nil))
+	waitForBackends(t, updates, nil)
+	id := revisionID{namespace: testNamespace, name: testRevision}
+	m.probe(id, m.backends[id].generation-1, []string{"10.0.0.2:8012"}, nil)
+	if got := m.Backends(testNamespace, testRevision); len(got) != 0 {
+		t.Errorf("Unexpected backends from an outdated probe. Want none. Got %v.", got)
+	}
+}
+
+func TestRevisionBackendsManager_DropsNotReady(t *testing.T) {
+	m, updates := testRevisionBackendsManager(t)
+	notReady := make(chan string, 1)
+	// The monitor never probes within the test, which reports pods not
+	// ready itself.
+	m.MonitorBackends(time.Hour, func(namespace, name, addr string) {
+		notReady <- addr
+	})
+	defer m.monitor.Stop()
+
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1", "10.0.0.2"}, nil))
+	waitForBackends(t, updates, []string{"10.0.0.1:8012", "10.0.0.2:8012"})
+	target := ProbeTarget{Host: "10.0.0.1", Port: 8012}
+	if !m.monitor.Monitored(target) {
+		t.Fatal("Expected a pod in use to be monitored.")
+	}
+
+	m.backendNotReady(target, errors.New("connection refused"))
+	waitForBackends(t, updates, []string{"10.0.0.2:8012"})
+	select {
+	case got := <-notReady:
+		if got != "10.0.0.1:8012" {
+			t.Errorf("Unexpected pod reported not ready. Want 10.0.0.1:8012. Got %v.", got)
+		}
+	default:
+		t.Error("Expected the dropped pod to be reported not ready.")
+	}
+
+	// It is probed again on the next update of the Endpoints.
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.1", "10.0.0.2"}, nil))
+	waitForBackends(t, updates, []string{"10.0.0.1:8012", "10.0.0.2:8012"})
+
+	// Pods Kubernetes finds not ready are no longer monitored.
+	m.updateEndpoints(testEndpoints([]string{"10.0.0.2"}, []string{"10.0.0.1"}))
+	waitForBackends(t, updates, []string{"10.0.0.2:8012"})
+	if m.monitor.Monitored(target) {
+		t.Error("Expected a pod no longer in use to no longer be monitored.")
+	}
+}
+
+func TestRevisionBackendsManager_IgnoresOtherEndpoints(t *testing.T) {
+	m, _ := testRevisionBackendsManager(t)
+	eps := testEndpoints([]string{"10.0.0.1"}, nil)
+	eps.Labels = nil
+	m.updateEndpoints(eps)
+	if len(m.backends) != 0 {
+		t.Errorf("Unexpected backends for Endpoints of no revision: %v", m.backends)
+	}
+}
@@ -16,10 +16,15 @@ limitations under the License.
 package activator
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
 	fakeKna "github.com/knative/serving/pkg/client/clientset/versioned/fake"
@@ -28,6 +33,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeK8s "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -41,11 +47,11 @@ func TestActiveEndpoint_Active_StaysActive(t *testing.T) {
 	k8s, kna := fakeClients()
 	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
 	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
-	a := NewRevisionActivator(k8s, kna, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
 
-	got, status, err := a.ActiveEndpoint(testNamespace, testRevision)
+	got, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
 
-	want := Endpoint{testServiceFQDN, 8080}
+	want := Endpoint{FQDN: testServiceFQDN, Port: 8080, Protocol: v1alpha1.RevisionProtocolHTTP1}
 	if got != want {
 		t.Errorf("Wrong endpoint. Want %+v. Got %+v.", want, got)
 	}
@@ -64,11 +70,11 @@ func TestActiveEndpoint_Reserve_BecomesActive(t *testing.T) {
 			withServingState(v1alpha1.RevisionServingStateReserve).
 			build())
 	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
-	a := NewRevisionActivator(k8s, kna, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
 
-	got, status, err := a.ActiveEndpoint(testNamespace, testRevision)
+	got, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
 
-	want := Endpoint{testServiceFQDN, 8080}
+	want := Endpoint{FQDN: testServiceFQDN, Port: 8080, Protocol: v1alpha1.RevisionProtocolHTTP1, Activated: true}
 	if got != want {
 		t.Errorf("Wrong endpoint. Want %+v. Got %+v.", want, got)
 	}
@@ -92,9 +98,9 @@ func TestActiveEndpoint_Retired_StaysRetiredWithError(t *testing.T) {
 			withServingState(v1alpha1.RevisionServingStateRetired).
 			build())
 	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
-	a := NewRevisionActivator(k8s, kna, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
 
-	got, status, err := a.ActiveEndpoint(testNamespace, testRevision)
+	got, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
 
 	want := Endpoint{}
 	if got != want {
@@ -121,11 +127,11 @@ func TestActiveEndpoint_Reserve_WaitsForReady(t *testing.T) {
 			withReady(false).
 			build())
 	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
-	a := NewRevisionActivator(k8s, kna, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
 
 	ch := make(chan activationResult)
 	go func() {
-		endpoint, status, err := a.ActiveEndpoint(testNamespace, testRevision)
+		endpoint, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
 		ch <- activationResult{endpoint, status, err}
 	}()
 
@@ -144,7 +150,7 @@ func TestActiveEndpoint_Reserve_WaitsForReady(t *testing.T) {
 	time.Sleep(3 * time.Second)
 	select {
 	case result := <-ch:
-		want := Endpoint{testServiceFQDN, 8080}
+		want := Endpoint{FQDN: testServiceFQDN, Port: 8080, Protocol: v1alpha1.RevisionProtocolHTTP1, Activated: true}
 		if result.endpoint != want {
 			t.Errorf("Unexpected endpoint. Want %+v. Got %+v.", want, result.endpoint)
 		}
@@ -167,12 +173,14 @@ func TestActiveEndpoint_Reserve_ReadyTimeoutWithError(t *testing.T) {
 			withReady(false).
 			build())
 	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
-	a := NewRevisionActivator(k8s, kna, TestLogger(t))
-	a.(*revisionActivator).readyTimout = 200 * time.Millisecond
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.readyTimout = 200 * time.Millisecond
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
 
 	ch := make(chan activationResult)
 	go func() {
-		endpoint, status, err := a.ActiveEndpoint(testNamespace, testRevision)
+		endpoint, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
 		ch <- activationResult{endpoint, status, err}
 	}()
 
@@ -198,6 +206,466 @@ func TestActiveEndpoint_Reserve_ReadyTimeoutWithError(t *testing.T) {
 	default:
 		t.Errorf("Expected result after timeout.")
 	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "ActivationProbeFailed") {
+			t.Errorf("Unexpected event. Want ActivationProbeFailed. Got %q.", event)
+		}
+	default:
+		t.Errorf("Expected an ActivationProbeFailed event after timeout.")
+	}
+}
+
+func TestActiveEndpoint_Reserve_AbandonedByRequest(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(
+		newRevisionBuilder().
+			withServingState(v1alpha1.RevisionServingStateReserve).
+			withReady(false).
+			build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, status, err := a.ActiveEndpoint(ctx, testNamespace, testRevision)
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error. Want %v. Got %v.", context.DeadlineExceeded, err)
+	}
+	if want := Status(http.StatusGatewayTimeout); status != want {
+		t.Errorf("Unexpected error status. Want %v. Got %v.", want, status)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Unexpected activation duration. Want about 100ms. Got %v.", elapsed)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Unexpected event for an abandoned activation: %q", event)
+	default:
+	}
+}
+
+func TestActiveEndpoint_Active_ProbeAbandonedByRequest(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
+	ctx, cancel := context.WithCancel(context.Background())
+	a.checkProbe = func(probeCtx context.Context, _ ProbeTarget) (int, error) {
+		cancel()
+		<-probeCtx.Done()
+		return 1, probeCtx.Err()
+	}
+
+	if _, _, err := a.ActiveEndpoint(ctx, testNamespace, testRevision); err != context.Canceled {
+		t.Errorf("Unexpected error. Want %v. Got %v.", context.Canceled, err)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Unexpected event for an abandoned activation: %q", event)
+	default:
+	}
+}
+
+func TestActiveEndpoint_Reserve_ColdStartSLOExceeded(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(
+		newRevisionBuilder().
+			withServingState(v1alpha1.RevisionServingStateReserve).
+			withReady(false).
+			build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.config.ColdStartSLO = 100 * time.Millisecond
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
+
+	start := time.Now()
+	_, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+
+	if err != ErrColdStartSLOExceeded {
+		t.Errorf("Unexpected error. Want %v. Got %v.", ErrColdStartSLOExceeded, err)
+	}
+	if want := Status(http.StatusServiceUnavailable); status != want {
+		t.Errorf("Unexpected error status. Want %v. Got %v.", want, status)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Unexpected activation duration. Want about 100ms. Got %v.", elapsed)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "ColdStartSLOExceeded") {
+			t.Errorf("Unexpected event. Want ColdStartSLOExceeded. Got %q.", event)
+		}
+	default:
+		t.Errorf("Expected a ColdStartSLOExceeded event.")
+	}
+}
+
+func TestActiveEndpoint_Active_ProbeColdStartSLOExceeded(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.config.ColdStartSLO = 100 * time.Millisecond
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
+	a.checkProbe = func(probeCtx context.Context, _ ProbeTarget) (int, error) {
+		<-probeCtx.Done()
+		return 1, probeCtx.Err()
+	}
+
+	if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != ErrColdStartSLOExceeded {
+		t.Errorf("Unexpected error. Want %v. Got %v.", ErrColdStartSLOExceeded, err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "ColdStartSLOExceeded") {
+			t.Errorf("Unexpected event. Want ColdStartSLOExceeded. Got %q.", event)
+		}
+	default:
+		t.Errorf("Expected a ColdStartSLOExceeded event.")
+	}
+}
+
+func TestActiveEndpoint_Reserve_CrashLoopFailsFast(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(
+		newRevisionBuilder().
+			withServingState(v1alpha1.RevisionServingStateReserve).
+			withReady(false).
+			build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	pod := newPodBuilder().build()
+	k8s.CoreV1().Pods(testNamespace).Create(pod)
+	a := newTestRevisionActivator(t, k8s, kna)
+
+	ch := make(chan activationResult)
+	go func() {
+		endpoint, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+		ch <- activationResult{endpoint, status, err}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name: "user-container",
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+	}}
+	k8s.CoreV1().Pods(testNamespace).Update(pod)
+
+	select {
+	case result := <-ch:
+		if got, want := result.status, Status(http.StatusInternalServerError); got != want {
+			t.Errorf("Unexpected error state. Want %v. Got %v.", want, got)
+		}
+		if result.err == nil || !strings.Contains(result.err.Error(), "CrashLoopBackOff") {
+			t.Errorf("Expected CrashLoopBackOff error. Got %v.", result.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Expected result after pod entered CrashLoopBackOff.")
+	}
+
+	// The revision controller owns the revision status.
+	rev, _ := kna.ServingV1alpha1().Revisions(testNamespace).Get(testRevision, metav1.GetOptions{})
+	if c := rev.Status.GetCondition(v1alpha1.RevisionConditionContainerHealthy); c != nil && c.Reason == "CrashLoopBackOff" {
+		t.Errorf("Unexpected ContainerHealthy condition set by the activator. Got %+v.", c)
+	}
+}
+
+func TestPodFailure(t *testing.T) {
+	for _, test := range []struct {
+		reason string
+		failed bool
+	}{
+		{"CrashLoopBackOff", true},
+		{"ImagePullBackOff", true},
+		{"CreateContainerConfigError", true},
+		{"ContainerCreating", false},
+		{"PodInitializing", false},
+	} {
+		pod := newPodBuilder().build()
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: "user-container",
+			State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: test.reason},
+			},
+		}}
+		message, failed := podFailure(pod)
+		if failed != test.failed {
+			t.Errorf("podFailure(%s) = %v, want %v", test.reason, failed, test.failed)
+		}
+		if failed && !strings.Contains(message, test.reason) {
+			t.Errorf("podFailure(%s) message = %q, want the reason", test.reason, message)
+		}
+	}
+}
+
+func TestActiveEndpoint_Reserve_PodDeletedKeepsWaiting(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(
+		newRevisionBuilder().
+			withServingState(v1alpha1.RevisionServingStateReserve).
+			withReady(false).
+			build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	pod := newPodBuilder().build()
+	k8s.CoreV1().Pods(testNamespace).Create(pod)
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.readyTimout = 500 * time.Millisecond
+
+	ch := make(chan activationResult)
+	go func() {
+		endpoint, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+		ch <- activationResult{endpoint, status, err}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	k8s.CoreV1().Pods(testNamespace).Delete(pod.Name, &metav1.DeleteOptions{})
+
+	select {
+	case <-ch:
+		t.Errorf("Unexpected result after pod was deleted.")
+	case <-time.After(200 * time.Millisecond):
+	}
+	select {
+	case result := <-ch:
+		if result.err == nil || !strings.Contains(result.err.Error(), "Timeout") {
+			t.Errorf("Expected timeout error. Got %v.", result.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Expected result after timeout.")
+	}
+}
+
+func TestActiveEndpoint_Active_ProbeFailsWithError(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	recorder := record.NewFakeRecorder(10)
+	a.recorder = recorder
+	var probed ProbeTarget
+	a.checkProbe = func(_ context.Context, target ProbeTarget) (int, error) {
+		probed = target
+		return 4, errors.New("connection refused")
+	}
+
+	got, status, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+
+	if want := (Endpoint{}); got != want {
+		t.Errorf("Wrong endpoint. Want %+v. Got %+v.", want, got)
+	}
+	if want := Status(http.StatusInternalServerError); status != want {
+		t.Errorf("Unexpected error status. Want %v. Got %v.", want, status)
+	}
+	if err == nil {
+		t.Errorf("Expected error. Want error. Got nil.")
+	}
+	if want := (ProbeTarget{Host: testServiceFQDN, Port: 8080}); probed != want {
+		t.Errorf("Unexpected probe target. Want %+v. Got %+v.", want, probed)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "failed 4 probe attempts") {
+			t.Errorf("Unexpected event. Want the probe attempts. Got %q.", event)
+		}
+	default:
+		t.Errorf("Expected an ActivationProbeFailed event after the probe failed.")
+	}
+}
+
+func TestActiveEndpoint_Active_WarmRevisionNotProbed(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	probes := 0
+	a.checkProbe = func(context.Context, ProbeTarget) (int, error) {
+		probes++
+		return 1, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != nil {
+			t.Fatalf("ActiveEndpoint() = %v", err)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("Unexpected probes of a warm revision. Want 1. Got %v.", probes)
+	}
+
+	// An endpoint found no longer ready is probed again.
+	a.endpointNotReady(ProbeTarget{Host: testServiceFQDN, Port: 8080}, errors.New("connection refused"))
+	if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != nil {
+		t.Fatalf("ActiveEndpoint() = %v", err)
+	}
+	if probes != 2 {
+		t.Errorf("Unexpected probes after the endpoint stopped being ready. Want 2. Got %v.", probes)
+	}
+}
+
+func TestActiveEndpoint_Active_SharedProbeResults(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	results := NewProbeResultStore(k8s, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.probeResults = results
+	probes := 0
+	a.checkProbe = func(context.Context, ProbeTarget) (int, error) {
+		probes++
+		return 1, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != nil {
+			t.Fatalf("ActiveEndpoint() = %v", err)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("Unexpected probes. Want 1. Got %v.", probes)
+	}
+	if !results.Ready(ProbeTarget{Host: testServiceFQDN, Port: 8080}) {
+		t.Error("Expected the probe result to be shared.")
+	}
+}
+
+func TestActiveEndpoint_Active_WaitsForOwnerProbe(t *testing.T) {
+	k8s, kna := fakeClients()
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(newRevisionBuilder().build())
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	results := NewProbeResultStore(k8s, "knative-serving", ProbeResultsConfigMapName, time.Minute, TestLogger(t))
+	a := newTestRevisionActivator(t, k8s, kna)
+	a.config = &Config{ProbeOwnerTimeout: time.Second}
+	a.probeResults = results
+	// Without syncing its leases, this replica owns no revision.
+	a.buckets = NewProbeBuckets(k8s, "knative-serving", "activator-a", 4, time.Minute)
+	probes := 0
+	a.checkProbe = func(context.Context, ProbeTarget) (int, error) {
+		probes++
+		return 1, nil
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		results.MarkReady(ProbeTarget{Host: testServiceFQDN, Port: 8080})
+	}()
+	if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != nil {
+		t.Fatalf("ActiveEndpoint() = %v", err)
+	}
+	if probes != 0 {
+		t.Errorf("Unexpected probes of a revision probed by its owner. Want 0. Got %v.", probes)
+	}
+
+	// The replica probes itself when the owner does not share a result.
+	results.MarkNotReady(ProbeTarget{Host: testServiceFQDN, Port: 8080})
+	if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err != nil {
+		t.Fatalf("ActiveEndpoint() = %v", err)
+	}
+	if probes != 1 {
+		t.Errorf("Unexpected probes after the owner timed out. Want 1. Got %v.", probes)
+	}
+}
+
+func TestActiveEndpoint_UpstreamTLS(t *testing.T) {
+	k8s, kna := fakeClients()
+	rev := newRevisionBuilder().build()
+	rev.Annotations = map[string]string{serving.UpstreamTLSAnnotationKey: "true"}
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(rev)
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+	var probed ProbeTarget
+	a.checkProbe = func(_ context.Context, target ProbeTarget) (int, error) {
+		probed = target
+		return 1, nil
+	}
+
+	if _, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision); err == nil {
+		t.Error("Expected an error without an upstream CA configured, got nil")
+	}
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	a.upstreamTLS = testUpstreamTLS(t, serverCA(server))
+	got, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+	if err != nil {
+		t.Fatalf("ActiveEndpoint() = %v", err)
+	}
+	want := Endpoint{
+		FQDN:       testServiceFQDN,
+		Port:       8080,
+		Scheme:     "https",
+		Protocol:   v1alpha1.RevisionProtocolHTTP1,
+		ServerName: testServiceFQDN,
+	}
+	if got != want {
+		t.Errorf("Wrong endpoint. Want %+v. Got %+v.", want, got)
+	}
+	if probed.TLS == nil || probed.TLS.ServerName != testServiceFQDN {
+		t.Errorf("Unexpected probe TLS configuration. Want server name %v. Got %+v.", testServiceFQDN, probed.TLS)
+	}
+}
+
+func TestActiveEndpoint_MaxRequestBodyBytes(t *testing.T) {
+	k8s, kna := fakeClients()
+	rev := newRevisionBuilder().build()
+	rev.Annotations = map[string]string{serving.MaxRequestBodyBytesAnnotationKey: "1024"}
+	kna.ServingV1alpha1().Revisions(testNamespace).Create(rev)
+	k8s.CoreV1().Services(testNamespace).Create(newServiceBuilder().build())
+	a := newTestRevisionActivator(t, k8s, kna)
+
+	got, _, err := a.ActiveEndpoint(context.TODO(), testNamespace, testRevision)
+	if err != nil {
+		t.Fatalf("ActiveEndpoint() = %v", err)
+	}
+	if got.MaxRequestBodyBytes != 1024 {
+		t.Errorf("Unexpected request body limit. Want 1024. Got %v.", got.MaxRequestBodyBytes)
+	}
+}
+
+func TestRevisionProbeTarget(t *testing.T) {
+	rev := newRevisionBuilder().build()
+	rev.Annotations = map[string]string{serving.ReadinessProbeBodyAnnotationKey: "ok"}
+	svc := newServiceBuilder().build()
+	svc.Spec.Ports[0].Name = "h2c"
+
+	got, err := RevisionProbeTarget(rev, svc)
+	if err != nil {
+		t.Fatalf("RevisionProbeTarget() = %v", err)
+	}
+	if got.Host != testServiceFQDN || got.Port != 8080 {
+		t.Errorf("Unexpected probe address. Want %s:8080. Got %s:%d.", testServiceFQDN, got.Host, got.Port)
+	}
+	if !got.H2C {
+		t.Error("Expected an h2c port to be probed over h2c.")
+	}
+	if got.ExpectedBody == nil || got.ExpectedBody.String() != "ok" {
+		t.Errorf("Unexpected expected body. Want %q. Got %v.", "ok", got.ExpectedBody)
+	}
+
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "other", Port: 9090})
+	if _, err := RevisionProbeTarget(rev, svc); err == nil {
+		t.Error("Expected error for a service with two ports. Got nil.")
+	}
+}
+
+// newTestRevisionActivator creates a revisionActivator whose endpoint
+// probes always succeed.
+func newTestRevisionActivator(t *testing.T, k8s kubernetes.Interface, kna clientset.Interface) *revisionActivator {
+	a := NewRevisionActivator(k8s, kna, &Config{}, nil, nil, nil, TestLogger(t)).(*revisionActivator)
+	a.checkProbe = func(context.Context, ProbeTarget) (int, error) {
+		return 1, nil
+	}
+	return a
 }
 
 func fakeClients() (kubernetes.Interface, clientset.Interface) {
@@ -285,3 +753,25 @@ func newServiceBuilder() *serviceBuilder {
 func (b *serviceBuilder) build() *corev1.Service {
 	return b.service
 }
+
+type podBuilder struct {
+	pod *corev1.Pod
+}
+
+func newPodBuilder() *podBuilder {
+	return &podBuilder{
+		pod: &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testRevision + "-pod",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					serving.RevisionLabelKey: testRevision,
+				},
+			},
+		},
+	}
+}
+
+func (b *podBuilder) build() *corev1.Pod {
+	return b.pod
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	"go.uber.org/zap"
+)
+
+const (
+	// ShadowHeader is set on the requests mirrored to shadow revisions,
+	// which can tell them from the requests they serve for real.
+	ShadowHeader = "Knative-Shadow"
+
+	// maxShadowBodyBytes bounds the request bodies that are buffered to
+	// be mirrored. Larger requests are not mirrored.
+	maxShadowBodyBytes = 1 << 20
+
+	// shadowTimeout bounds how long a mirrored request may take,
+	// including activating its shadow revision.
+	shadowTimeout = time.Minute
+)
+
+// ShadowFromAnnotations returns the revision a revision has its requests
+// mirrored to with its annotations, and the percentage of them that is,
+// or an empty name when it has none mirrored.
+func ShadowFromAnnotations(annotations map[string]string) (string, int, error) {
+	revision, ok := annotations[serving.ShadowRevisionAnnotationKey]
+	if !ok {
+		return "", 0, nil
+	}
+	if revision == "" {
+		return "", 0, fmt.Errorf("invalid %s: must not be empty", serving.ShadowRevisionAnnotationKey)
+	}
+	raw, ok := annotations[serving.ShadowPercentAnnotationKey]
+	if !ok {
+		return revision, 100, nil
+	}
+	percent, err := strconv.Atoi(raw)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s: %v", serving.ShadowPercentAnnotationKey, err)
+	}
+	if percent < 0 || percent > 100 {
+		return "", 0, fmt.Errorf("invalid %s: must be between 0 and 100, got %d", serving.ShadowPercentAnnotationKey, percent)
+	}
+	return revision, percent, nil
+}
+
+// Shadower mirrors requests to the shadow revisions of the revisions
+// they are sent to, for validating new revisions against production
+// traffic. The responses of mirrored requests are discarded, and at most
+// a bounded number of them are in flight, extra ones being dropped
+// rather than slowing down the requests they mirror.
+type Shadower struct {
+	act       Activator
+	transport func(Endpoint) http.RoundTripper
+	logger    *zap.SugaredLogger
+
+	mux      sync.Mutex
+	capacity int
+	inFlight int
+	rand     *rand.Rand
+}
+
+// NewShadower creates a Shadower activating shadow revisions with act
+// and proxying to them through the transport returned for their
+// endpoint, with up to capacity mirrored requests in flight.
+func NewShadower(act Activator, capacity int, transport func(Endpoint) http.RoundTripper, logger *zap.SugaredLogger) *Shadower {
+	return &Shadower{
+		act:       act,
+		transport: transport,
+		logger:    logger,
+		capacity:  capacity,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetCapacity changes how many mirrored requests may be in flight. Zero
+// stops mirroring requests.
+func (s *Shadower) SetCapacity(capacity int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.capacity = capacity
+}
+
+// Shadow mirrors r, sent to the revision of endpoint in namespace, to
+// the shadow revision of endpoint if it has one and r is sampled. It
+// returns the request to proxy in place of r, whose body may have been
+// buffered for mirroring.
+func (s *Shadower) Shadow(r *http.Request, namespace string, endpoint Endpoint) *http.Request {
+	if endpoint.ShadowRevision == "" || !shadowable(r) || !s.acquire(endpoint.ShadowPercent) {
+		return r
+	}
+
+	var body []byte
+	if r.Body != nil && r.ContentLength > 0 {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+		// What was read is replayed to the revision ahead of the rest.
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Body = &replayedBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		r = r2
+		if err != nil {
+			s.release()
+			return r
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	sr := r.WithContext(ctx)
+	sr.Header = r.Header.Clone()
+	sr.Header.Set(ShadowHeader, "true")
+	sr.Body = ioutil.NopCloser(bytes.NewReader(body))
+	go func() {
+		defer s.release()
+		defer cancel()
+		s.mirror(sr, namespace, endpoint.ShadowRevision)
+	}()
+	return r
+}
+
+func (s *Shadower) mirror(r *http.Request, namespace, name string) {
+	end, _, err := s.act.ActiveEndpoint(r.Context(), namespace, name)
+	if err != nil {
+		s.logger.Infof("Not mirroring request to shadow revision %s/%s: %v", namespace, name, err)
+		return
+	}
+	proxy := NewProxy(end, s.transport(end), s.logger)
+	proxy.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, r.WithContext(WithRevision(r.Context(), namespace, name)))
+}
+
+// acquire reports whether a request is sampled with the given percentage
+// and, if so, saves it room in flight.
+func (s *Shadower) acquire(percent int) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.inFlight >= s.capacity || s.rand.Intn(100) >= percent {
+		return false
+	}
+	s.inFlight++
+	return true
+}
+
+func (s *Shadower) release() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.inFlight--
+}
+
+// shadowable reports whether r can be mirrored: its body is small
+// enough to be buffered and it has no connection to upgrade.
+func shadowable(r *http.Request) bool {
+	return r.ContentLength >= 0 && r.ContentLength <= maxShadowBodyBytes && r.Header.Get("Upgrade") == ""
+}
+
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// discardResponseWriter is the ResponseWriter mirrored requests are
+// answered through.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestShadowFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		wantRevision string
+		wantPercent  int
+		wantErr      bool
+	}{{
+		name: "not annotated",
+	}, {
+		name:         "every request",
+		annotations:  map[string]string{serving.ShadowRevisionAnnotationKey: "next"},
+		wantRevision: "next",
+		wantPercent:  100,
+	}, {
+		name: "some requests",
+		annotations: map[string]string{
+			serving.ShadowRevisionAnnotationKey: "next",
+			serving.ShadowPercentAnnotationKey:  "10",
+		},
+		wantRevision: "next",
+		wantPercent:  10,
+	}, {
+		name:        "empty revision",
+		annotations: map[string]string{serving.ShadowRevisionAnnotationKey: ""},
+		wantErr:     true,
+	}, {
+		name: "percent out of range",
+		annotations: map[string]string{
+			serving.ShadowRevisionAnnotationKey: "next",
+			serving.ShadowPercentAnnotationKey:  "101",
+		},
+		wantErr: true,
+	}, {
+		name: "invalid percent",
+		annotations: map[string]string{
+			serving.ShadowRevisionAnnotationKey: "next",
+			serving.ShadowPercentAnnotationKey:  "10%",
+		},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revision, percent, err := ShadowFromAnnotations(test.annotations)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ShadowFromAnnotations() = %v, wantErr %v", err, test.wantErr)
+			}
+			if revision != test.wantRevision {
+				t.Errorf("Unexpected revision. Want %v. Got %v.", test.wantRevision, revision)
+			}
+			if percent != test.wantPercent {
+				t.Errorf("Unexpected percent. Want %v. Got %v.", test.wantPercent, percent)
+			}
+		})
+	}
+}
+
+type shadowedRequest struct {
+	method string
+	body   string
+	header string
+}
+
+func TestShadower(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacity   int
+		percent    int
+		body       string
+		wantShadow bool
+	}{{
+		name:       "mirrored",
+		capacity:   10,
+		percent:    100,
+		body:       "hello",
+		wantShadow: true,
+	}, {
+		name:     "not sampled",
+		capacity: 10,
+		percent:  0,
+		body:     "hello",
+	}, {
+		name:    "disabled",
+		percent: 100,
+		body:    "hello",
+	}, {
+		name:     "body too large",
+		capacity: 10,
+		percent:  100,
+		body:     strings.Repeat("x", maxShadowBodyBytes+1),
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shadowed := make(chan shadowedRequest, 1)
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				shadowed <- shadowedRequest{method: r.Method, body: string(body), header: r.Header.Get(ShadowHeader)}
+				w.Write([]byte("discarded"))
+			}))
+			defer s.Close()
+
+			act := newFakeActivator(t, map[revisionID]activationResult{
+				{namespace: testNamespace, name: "shadow"}: {endpoint: serverEndpoint(t, s)},
+			})
+			shadower := NewShadower(act, test.capacity, func(Endpoint) http.RoundTripper {
+				return http.DefaultTransport
+			}, TestLogger(t))
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(test.body))
+			endpoint := Endpoint{ShadowRevision: "shadow", ShadowPercent: test.percent}
+			r = shadower.Shadow(r, testNamespace, endpoint)
+
+			if body, _ := ioutil.ReadAll(r.Body); string(body) != test.body {
+				t.Errorf("Unexpected body of %d bytes left to proxy. Want %d bytes.", len(body), len(test.body))
+			}
+			select {
+			case got := <-shadowed:
+				if !test.wantShadow {
+					t.Fatal("Unexpected request mirrored to the shadow revision.")
+				}
+				want := shadowedRequest{method: http.MethodPost, body: test.body, header: "true"}
+				if got != want {
+					t.Errorf("Unexpected mirrored request. Want %+v. Got %+v.", want, got)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if test.wantShadow {
+					t.Error("Timed out waiting for the request to be mirrored to the shadow revision.")
+				}
+			}
+		})
+	}
+}
+
+func TestShadower_DropsOverCapacity(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 2)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer s.Close()
+	defer close(release)
+
+	act := newFakeActivator(t, map[revisionID]activationResult{
+		{namespace: testNamespace, name: "shadow"}: {endpoint: serverEndpoint(t, s)},
+	})
+	shadower := NewShadower(act, 1, func(Endpoint) http.RoundTripper {
+		return http.DefaultTransport
+	}, TestLogger(t))
+	endpoint := Endpoint{ShadowRevision: "shadow", ShadowPercent: 100}
+
+	shadower.Shadow(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), testNamespace, endpoint)
+	select {
+	case <-received:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the first request to be mirrored.")
+	}
+	shadower.Shadow(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), testNamespace, endpoint)
+	select {
+	case <-received:
+		t.Error("Unexpected request mirrored over capacity.")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
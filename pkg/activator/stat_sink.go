@@ -0,0 +1,190 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/knative/serving/pkg/autoscaler"
+	"go.uber.org/zap"
+)
+
+const (
+	// Connecting to the autoscaler is retried with backoff, from
+	// initialReconnectBackoff up to maxReconnectBackoff.
+	initialReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff     = 5 * time.Second
+
+	statSinkHandshakeTimeout = 3 * time.Second
+)
+
+// StatSink streams stat messages to the autoscaler over a WebSocket. The
+// stats reported while it is disconnected are kept, up to a bound, and
+// sent once it reconnects.
+type StatSink struct {
+	url     string
+	header  http.Header
+	dialer  *websocket.Dialer
+	backlog int
+	logger  *zap.SugaredLogger
+
+	mux       sync.Mutex
+	connected bool
+	dropped   int
+
+	// for testing
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewStatSink creates a StatSink sending stats to the WebSocket at url,
+// keeping up to backlog stats while disconnected. Unless token is empty,
+// it is presented to the autoscaler as a bearer token.
+func NewStatSink(url string, backlog int, token string, logger *zap.SugaredLogger) *StatSink {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return &StatSink{
+		url:            url,
+		header:         header,
+		dialer:         &websocket.Dialer{HandshakeTimeout: statSinkHandshakeTimeout},
+		backlog:        backlog,
+		logger:         logger,
+		initialBackoff: initialReconnectBackoff,
+		maxBackoff:     maxReconnectBackoff,
+	}
+}
+
+// Run sends the stats received on statChan until it is closed or stopCh
+// is.
+func (s *StatSink) Run(statChan <-chan *autoscaler.StatMessage, stopCh <-chan struct{}) {
+	var (
+		conn    *websocket.Conn
+		pending []*autoscaler.StatMessage
+		retry   <-chan time.Time
+	)
+	backoff := s.initialBackoff
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		if conn == nil && retry == nil {
+			c, _, err := s.dialer.Dial(s.url, s.header)
+			if err != nil {
+				s.logger.Errorf("Failed to connect to autoscaler at %s, retrying in %v: %v", s.url, backoff, err)
+				retry = time.After(backoff)
+				backoff *= 2
+				if backoff > s.maxBackoff {
+					backoff = s.maxBackoff
+				}
+			} else {
+				s.logger.Infof("Connected to autoscaler at %s", s.url)
+				conn = c
+				backoff = s.initialBackoff
+				s.setConnected(true)
+			}
+		}
+		for conn != nil && len(pending) > 0 {
+			if err := s.send(conn, pending[0]); err != nil {
+				s.disconnect(conn, err)
+				conn = nil
+				break
+			}
+			pending = pending[1:]
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-retry:
+			retry = nil
+		case sm, ok := <-statChan:
+			if !ok {
+				return
+			}
+			if conn != nil {
+				err := s.send(conn, sm)
+				if err == nil {
+					continue
+				}
+				s.disconnect(conn, err)
+				conn = nil
+			}
+			if len(pending) == s.backlog {
+				pending = pending[1:]
+				s.drop()
+			}
+			if s.backlog > 0 {
+				pending = append(pending, sm)
+			} else {
+				s.drop()
+			}
+		}
+	}
+}
+
+func (s *StatSink) send(conn *websocket.Conn, sm *autoscaler.StatMessage) error {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(sm); err != nil {
+		// Another message may still be sent.
+		s.logger.Errorf("Failed to encode stats: %v", err)
+		return nil
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, b.Bytes())
+}
+
+// disconnect closes conn after sending on it failed with err.
+func (s *StatSink) disconnect(conn *websocket.Conn, err error) {
+	s.logger.Errorf("Failed to send stats to autoscaler: %v", err)
+	conn.Close()
+	s.setConnected(false)
+}
+
+func (s *StatSink) setConnected(connected bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.connected = connected
+	if connected {
+		s.dropped = 0
+	}
+}
+
+func (s *StatSink) drop() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.dropped++
+}
+
+// Healthy fails while the sink is disconnected from the autoscaler for
+// so long that it dropped stats, so that scaling no longer follows the
+// requests handled. Momentary disconnects do not fail it.
+func (s *StatSink) Healthy() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.connected && s.dropped > 0 {
+		return fmt.Errorf("disconnected from the autoscaler, dropped %d stats", s.dropped)
+	}
+	return nil
+}
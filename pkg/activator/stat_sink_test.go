@@ -0,0 +1,165 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/knative/serving/pkg/autoscaler"
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+// statServer is an autoscaler stat endpoint that rejects connections
+// until accept is set, and those not presenting auth when it is set.
+type statServer struct {
+	*httptest.Server
+	accept int32
+	auth   string
+	keys   chan string
+}
+
+func newStatServer(t *testing.T) *statServer {
+	s := &statServer{keys: make(chan string, 10)}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.accept) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if s.auth != "" && r.Header.Get("Authorization") != s.auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade() = %v", err)
+			return
+		}
+		defer conn.Close()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var sm autoscaler.StatMessage
+			if err := gob.NewDecoder(bytes.NewBuffer(msg)).Decode(&sm); err != nil {
+				t.Errorf("Decode() = %v", err)
+				return
+			}
+			s.keys <- sm.RevisionKey
+		}
+	}))
+	return s
+}
+
+func (s *statServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func (s *statServer) expectKeys(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-s.keys:
+			if got != w {
+				t.Errorf("Unexpected stat. Want %v. Got %v.", w, got)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for stat %v", w)
+		}
+	}
+}
+
+func newTestStatSink(t *testing.T, url string, backlog int) *StatSink {
+	return newTestStatSinkWithToken(t, url, backlog, "")
+}
+
+func newTestStatSinkWithToken(t *testing.T, url string, backlog int, token string) *StatSink {
+	s := NewStatSink(url, backlog, token, TestLogger(t))
+	s.initialBackoff = time.Millisecond
+	s.maxBackoff = 10 * time.Millisecond
+	return s
+}
+
+func TestStatSinkSendsBacklogOnReconnect(t *testing.T) {
+	server := newStatServer(t)
+	defer server.Close()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	statChan := make(chan *autoscaler.StatMessage)
+	sink := newTestStatSink(t, server.url(), 10)
+	go sink.Run(statChan, stopCh)
+
+	for _, key := range []string{"a", "b", "c"} {
+		statChan <- &autoscaler.StatMessage{RevisionKey: key}
+	}
+	if err := sink.Healthy(); err != nil {
+		t.Errorf("Unexpected error before dropping stats. Want nil. Got %v.", err)
+	}
+	atomic.StoreInt32(&server.accept, 1)
+	server.expectKeys(t, "a", "b", "c")
+
+	statChan <- &autoscaler.StatMessage{RevisionKey: "d"}
+	server.expectKeys(t, "d")
+}
+
+func TestStatSinkSendsToken(t *testing.T) {
+	server := newStatServer(t)
+	server.auth = "Bearer secret"
+	atomic.StoreInt32(&server.accept, 1)
+	defer server.Close()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	statChan := make(chan *autoscaler.StatMessage)
+	sink := newTestStatSinkWithToken(t, server.url(), 10, "secret")
+	go sink.Run(statChan, stopCh)
+
+	statChan <- &autoscaler.StatMessage{RevisionKey: "a"}
+	server.expectKeys(t, "a")
+}
+
+func TestStatSinkUnhealthyAfterDropping(t *testing.T) {
+	server := newStatServer(t)
+	defer server.Close()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	statChan := make(chan *autoscaler.StatMessage)
+	sink := newTestStatSink(t, server.url(), 1)
+	go sink.Run(statChan, stopCh)
+
+	for _, key := range []string{"a", "b"} {
+		statChan <- &autoscaler.StatMessage{RevisionKey: key}
+	}
+	// Run only receives the next stat once it kept the previous one.
+	statChan <- &autoscaler.StatMessage{RevisionKey: "c"}
+	if err := sink.Healthy(); err == nil {
+		t.Error("Unexpected health after dropping stats. Want error. Got nil.")
+	}
+
+	atomic.StoreInt32(&server.accept, 1)
+	server.expectKeys(t, "c")
+	if err := sink.Healthy(); err != nil {
+		t.Errorf("Unexpected error after reconnecting. Want nil. Got %v.", err)
+	}
+}
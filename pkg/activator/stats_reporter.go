@@ -0,0 +1,280 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	requestCountM = stats.Int64(
+		"request_count",
+		"Number of requests received by the activator",
+		stats.UnitNone)
+	queueDepthM = stats.Int64(
+		"request_queue_depth",
+		"Number of requests held while their revision is activated",
+		stats.UnitNone)
+	shedCountM = stats.Int64(
+		"request_shed_count",
+		"Number of requests turned away because too many were held for their revision",
+		stats.UnitNone)
+	queuedLatenciesM = stats.Float64(
+		"request_queued_latencies",
+		"Time requests spent held while their revision was activated",
+		stats.UnitMilliseconds)
+	proxyLatenciesM = stats.Float64(
+		"request_proxy_latencies",
+		"Time taken by revisions to respond to proxied requests",
+		stats.UnitMilliseconds)
+	retryCountM = stats.Int64(
+		"request_retry_count",
+		"Number of proxied requests retried within their revision's retry budget",
+		stats.UnitNone)
+	retrySkippedCountM = stats.Int64(
+		"request_retry_skipped_count",
+		"Number of proxied requests not retried because their revision's retry budget was used up",
+		stats.UnitNone)
+	retryBudgetUsageM = stats.Float64(
+		"retry_budget_usage",
+		"Share of the retry budget of a revision used within its window",
+		stats.UnitNone)
+	connectionCountM = stats.Int64(
+		"connection_count",
+		"Number of client connections open to the activator",
+		stats.UnitNone)
+	connectionAcceptedCountM = stats.Int64(
+		"connection_accepted_count",
+		"Number of client connections accepted by the activator",
+		stats.UnitNone)
+	connectionClosedCountM = stats.Int64(
+		"connection_closed_count",
+		"Number of client connections to the activator closed or hijacked",
+		stats.UnitNone)
+
+	// Latency buckets in milliseconds, from a fast response to a slow
+	// cold start.
+	latencyBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000}
+
+	namespaceTagKey     tag.Key
+	revisionTagKey      tag.Key
+	responseClassTagKey tag.Key
+	listenerTagKey      tag.Key
+
+	// views are the views of the measures above, registered on init.
+	views []*view.View
+)
+
+func init() {
+	var err error
+	// Create the tag keys that will be used to add tags to our measurements.
+	namespaceTagKey, err = tag.NewKey("destination_namespace")
+	if err != nil {
+		panic(err)
+	}
+	revisionTagKey, err = tag.NewKey("destination_revision")
+	if err != nil {
+		panic(err)
+	}
+	responseClassTagKey, err = tag.NewKey("response_code_class")
+	if err != nil {
+		panic(err)
+	}
+	listenerTagKey, err = tag.NewKey("listener")
+	if err != nil {
+		panic(err)
+	}
+
+	views = []*view.View{
+		&view.View{
+			Description: "Number of requests received by the activator",
+			Measure:     requestCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey, responseClassTagKey},
+		},
+		&view.View{
+			Description: "Number of requests held while their revision is activated",
+			Measure:     queueDepthM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Number of requests turned away because too many were held for their revision",
+			Measure:     shedCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Time requests spent held while their revision was activated",
+			Measure:     queuedLatenciesM,
+			Aggregation: view.Distribution(latencyBounds...),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Time taken by revisions to respond to proxied requests",
+			Measure:     proxyLatenciesM,
+			Aggregation: view.Distribution(latencyBounds...),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey, responseClassTagKey},
+		},
+		&view.View{
+			Description: "Number of proxied requests retried within their revision's retry budget",
+			Measure:     retryCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Number of proxied requests not retried because their revision's retry budget was used up",
+			Measure:     retrySkippedCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Share of the retry budget of a revision used within its window",
+			Measure:     retryBudgetUsageM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{namespaceTagKey, revisionTagKey},
+		},
+		&view.View{
+			Description: "Number of client connections open to the activator",
+			Measure:     connectionCountM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{listenerTagKey},
+		},
+		&view.View{
+			Description: "Number of client connections accepted by the activator",
+			Measure:     connectionAcceptedCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{listenerTagKey},
+		},
+		&view.View{
+			Description: "Number of client connections to the activator closed or hijacked",
+			Measure:     connectionClosedCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{listenerTagKey},
+		},
+	}
+	if err := view.Register(views...); err != nil {
+		panic(err)
+	}
+}
+
+// StatsReporter defines the interface for sending activator metrics
+type StatsReporter interface {
+	// ReportRequest records a request to a revision answered with
+	// responseCode, after being held for queued while the revision was
+	// activated and then taking proxied to be answered by the revision.
+	// proxied is zero for requests that were not proxied.
+	ReportRequest(namespace, revision string, responseCode int, queued, proxied time.Duration) error
+	// ReportQueueDepth records the number of requests held for a
+	// revision.
+	ReportQueueDepth(namespace, revision string, depth int) error
+	// ReportShed records a request to a revision turned away because
+	// too many requests were already held for it.
+	ReportShed(namespace, revision string) error
+	// ReportRetry records whether a request to a revision was retried
+	// within its retry budget, and the share of the budget used.
+	ReportRetry(namespace, revision string, allowed bool, usage float64) error
+}
+
+// Reporter reports activator metrics through OpenCensus.
+type Reporter struct{}
+
+var _ StatsReporter = (*Reporter)(nil)
+
+// NewStatsReporter creates a reporter that collects and reports activator
+// metrics.
+func NewStatsReporter() *Reporter {
+	return &Reporter{}
+}
+
+// ReportRequest implements StatsReporter.
+func (r *Reporter) ReportRequest(namespace, revision string, responseCode int, queued, proxied time.Duration) error {
+	ctx, err := tag.New(
+		context.Background(),
+		tag.Insert(namespaceTagKey, namespace),
+		tag.Insert(revisionTagKey, revision))
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, queuedLatenciesM.M(milliseconds(queued)))
+
+	ctx, err = tag.New(ctx, tag.Insert(responseClassTagKey, responseCodeClass(responseCode)))
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, requestCountM.M(1))
+	if proxied > 0 {
+		stats.Record(ctx, proxyLatenciesM.M(milliseconds(proxied)))
+	}
+	return nil
+}
+
+// ReportQueueDepth implements StatsReporter.
+func (r *Reporter) ReportQueueDepth(namespace, revision string, depth int) error {
+	ctx, err := tag.New(
+		context.Background(),
+		tag.Insert(namespaceTagKey, namespace),
+		tag.Insert(revisionTagKey, revision))
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, queueDepthM.M(int64(depth)))
+	return nil
+}
+
+// ReportShed implements StatsReporter.
+func (r *Reporter) ReportShed(namespace, revision string) error {
+	ctx, err := tag.New(
+		context.Background(),
+		tag.Insert(namespaceTagKey, namespace),
+		tag.Insert(revisionTagKey, revision))
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, shedCountM.M(1))
+	return nil
+}
+
+// ReportRetry implements StatsReporter.
+func (r *Reporter) ReportRetry(namespace, revision string, allowed bool, usage float64) error {
+	ctx, err := tag.New(
+		context.Background(),
+		tag.Insert(namespaceTagKey, namespace),
+		tag.Insert(revisionTagKey, revision))
+	if err != nil {
+		return err
+	}
+	if allowed {
+		stats.Record(ctx, retryCountM.M(1), retryBudgetUsageM.M(usage))
+	} else {
+		stats.Record(ctx, retrySkippedCountM.M(1), retryBudgetUsageM.M(usage))
+	}
+	return nil
+}
+
+func responseCodeClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestReporter_ReportRequest(t *testing.T) {
+	resetViews(t)
+	r := NewStatsReporter()
+	wantTags := map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "testrev",
+		"response_code_class":   "2xx",
+	}
+
+	expectSuccess(t, func() error {
+		return r.ReportRequest("testns", "testrev", http.StatusOK, 1500*time.Millisecond, 30*time.Millisecond)
+	})
+	expectSuccess(t, func() error {
+		return r.ReportRequest("testns", "testrev", http.StatusCreated, 0, 10*time.Millisecond)
+	})
+	checkCount(t, "request_count", wantTags, 2)
+	checkDistribution(t, "request_proxy_latencies", wantTags, 2, 10, 30)
+	checkDistribution(t, "request_queued_latencies", map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "testrev",
+	}, 2, 0, 1500)
+}
+
+func TestReporter_ReportRequestNotProxied(t *testing.T) {
+	resetViews(t)
+	r := NewStatsReporter()
+	wantTags := map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "unproxied",
+		"response_code_class":   "5xx",
+	}
+
+	expectSuccess(t, func() error {
+		return r.ReportRequest("testns", "unproxied", http.StatusServiceUnavailable, time.Second, 0)
+	})
+	checkCount(t, "request_count", wantTags, 1)
+	if d := rowsWithTags(t, "request_proxy_latencies", wantTags); len(d) != 0 {
+		t.Errorf("Unexpected proxy latencies for a request that was not proxied: %v", d)
+	}
+}
+
+func TestReporter_ReportQueueDepth(t *testing.T) {
+	resetViews(t)
+	r := NewStatsReporter()
+	wantTags := map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "queued",
+	}
+
+	expectSuccess(t, func() error { return r.ReportQueueDepth("testns", "queued", 3) })
+	expectSuccess(t, func() error { return r.ReportQueueDepth("testns", "queued", 1) })
+	d := rowsWithTags(t, "request_queue_depth", wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of rows. Want 1. Got %v.", len(d))
+	}
+	if s, ok := d[0].Data.(*view.LastValueData); !ok {
+		t.Errorf("Unexpected data type. Want LastValueData. Got %T.", d[0].Data)
+	} else if s.Value != 1 {
+		t.Errorf("Unexpected queue depth. Want 1. Got %v.", s.Value)
+	}
+}
+
+func TestReporter_ReportShed(t *testing.T) {
+	resetViews(t)
+	r := NewStatsReporter()
+	wantTags := map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "shed",
+	}
+
+	expectSuccess(t, func() error { return r.ReportShed("testns", "shed") })
+	expectSuccess(t, func() error { return r.ReportShed("testns", "shed") })
+	checkCount(t, "request_shed_count", wantTags, 2)
+}
+
+func TestReporter_ReportRetry(t *testing.T) {
+	resetViews(t)
+	r := NewStatsReporter()
+	wantTags := map[string]string{
+		"destination_namespace": "testns",
+		"destination_revision":  "retried",
+	}
+
+	expectSuccess(t, func() error { return r.ReportRetry("testns", "retried", true, 0.5) })
+	expectSuccess(t, func() error { return r.ReportRetry("testns", "retried", true, 1) })
+	expectSuccess(t, func() error { return r.ReportRetry("testns", "retried", false, 1) })
+	checkCount(t, "request_retry_count", wantTags, 2)
+	checkCount(t, "request_retry_skipped_count", wantTags, 1)
+	d := rowsWithTags(t, "retry_budget_usage", wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of rows. Want 1. Got %v.", len(d))
+	}
+	if s, ok := d[0].Data.(*view.LastValueData); !ok {
+		t.Errorf("Unexpected data type. Want LastValueData. Got %T.", d[0].Data)
+	} else if s.Value != 1 {
+		t.Errorf("Unexpected retry budget usage. Want 1. Got %v.", s.Value)
+	}
+}
+
+func TestResponseCodeClass(t *testing.T) {
+	for code, want := range map[int]string{
+		http.StatusOK:                  "2xx",
+		http.StatusTemporaryRedirect:   "3xx",
+		http.StatusBadRequest:          "4xx",
+		http.StatusGatewayTimeout:      "5xx",
+		http.StatusInternalServerError: "5xx",
+	} {
+		if got := responseCodeClass(code); got != want {
+			t.Errorf("Unexpected class for %v. Want %v. Got %v.", code, want, got)
+		}
+	}
+}
+
+// resetViews registers the views again once t is done, dropping the data
+// it recorded so that the counts of the next run start from zero.
+func resetViews(t *testing.T) {
+	t.Cleanup(func() {
+		view.Unregister(views...)
+		if err := view.Register(views...); err != nil {
+			t.Fatalf("Error registering the views again: %v", err)
+		}
+	})
+}
+
+func expectSuccess(t *testing.T, f func() error) {
+	t.Helper()
+	if err := f(); err != nil {
+		t.Errorf("Reporter.Report() expected success but got error %v", err)
+	}
+}
+
+// rowsWithTags returns the rows of the named view with exactly wantTags.
+func rowsWithTags(t *testing.T, name string, wantTags map[string]string) []*view.Row {
+	t.Helper()
+	d, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("Error retrieving %v: %v", name, err)
+	}
+	var rows []*view.Row
+	for _, row := range d {
+		if len(row.Tags) != len(wantTags) {
+			continue
+		}
+		match := true
+		for _, got := range row.Tags {
+			if wantTags[got.Key.Name()] != got.Value {
+				match = false
+			}
+		}
+		if match {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func checkCount(t *testing.T, name string, wantTags map[string]string, want int64) {
+	t.Helper()
+	d := rowsWithTags(t, name, wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of %v rows. Want 1. Got %v.", name, len(d))
+	}
+	if s, ok := d[0].Data.(*view.CountData); !ok {
+		t.Errorf("Unexpected data type. Want CountData. Got %T.", d[0].Data)
+	} else if s.Value != want {
+		t.Errorf("Unexpected %v. Want %v. Got %v.", name, want, s.Value)
+	}
+}
+
+func checkDistribution(t *testing.T, name string, wantTags map[string]string, count int64, min, max float64) {
+	t.Helper()
+	d := rowsWithTags(t, name, wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of %v rows. Want 1. Got %v.", name, len(d))
+	}
+	s, ok := d[0].Data.(*view.DistributionData)
+	if !ok {
+		t.Fatalf("Unexpected data type. Want DistributionData. Got %T.", d[0].Data)
+	}
+	if s.Count != count || s.Min != min || s.Max != max {
+		t.Errorf("Unexpected %v. Want count %v, min %v, max %v. Got count %v, min %v, max %v.",
+			name, count, min, max, s.Count, s.Min, s.Max)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// FlushStreams wraps w so that streamed responses, like server-sent
+// events and gRPC, are flushed as soon as they are written rather than
+// every FlushInterval of the proxy writing them.
+func FlushStreams(w http.ResponseWriter) http.ResponseWriter {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return w
+	}
+	return &streamWriter{ResponseWriter: w, flusher: f}
+}
+
+// IsStreaming reports whether a response with the given header streams
+// its body, which must then reach the client without delay.
+func IsStreaming(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/event-stream" || strings.HasPrefix(mediaType, "application/grpc")
+}
+
+type streamWriter struct {
+	http.ResponseWriter
+	flusher     http.Flusher
+	wroteHeader bool
+	streaming   bool
+}
+
+func (w *streamWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.streaming = IsStreaming(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+	if w.streaming {
+		w.flusher.Flush()
+	}
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if w.streaming {
+		w.flusher.Flush()
+	}
+	return n, err
+}
+
+func (w *streamWriter) Flush() {
+	w.flusher.Flush()
+}
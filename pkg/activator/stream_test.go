@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestIsStreaming(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/event-stream":                true,
+		"text/event-stream; charset=utf-8": true,
+		"application/grpc":                 true,
+		"application/grpc+proto":           true,
+		"application/json":                 false,
+		"text/plain":                       false,
+		"":                                 false,
+	} {
+		h := http.Header{"Content-Type": []string{contentType}}
+		if got := IsStreaming(h); got != want {
+			t.Errorf("Unexpected IsStreaming(%q). Want %v. Got %v.", contentType, want, got)
+		}
+	}
+}
+
+func TestFlushStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		wantFlushed bool
+	}{{
+		name:        "server-sent events",
+		contentType: "text/event-stream",
+		wantFlushed: true,
+	}, {
+		name:        "grpc",
+		contentType: "application/grpc",
+		wantFlushed: true,
+	}, {
+		name:        "not streamed",
+		contentType: "text/plain",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := FlushStreams(rec)
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write([]byte("data: 1\n\n"))
+			if rec.Flushed != test.wantFlushed {
+				t.Errorf("Unexpected flush. Want %v. Got %v.", test.wantFlushed, rec.Flushed)
+			}
+		})
+	}
+}
+
+func TestProxy_StreamsEvents(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		// The event must reach the client while the stream is still
+		// open.
+		<-done
+	}))
+	defer s.Close()
+	endpoint := serverEndpoint(t, s)
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy := NewProxy(endpoint, http.DefaultTransport, TestLogger(t))
+		proxy.FlushInterval = time.Hour
+		proxy.ServeHTTP(FlushStreams(w), r)
+	}))
+	defer front.Close()
+	// Ending the stream first lets the servers shut down.
+	defer close(done)
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "data: 1\n" {
+			t.Errorf("Unexpected event. Want %q. Got %q.", "data: 1\n", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out waiting for the streamed event.")
+	}
+}
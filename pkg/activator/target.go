@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	listers "github.com/knative/serving/pkg/client/listers/serving/v1alpha1"
+	"github.com/knative/serving/pkg/controller"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// revisionServiceSuffix ends the name of the Kubernetes service of a
+// revision.
+const revisionServiceSuffix = "-service"
+
+// RevisionFromRequest returns the namespace and name of the revision r
+// is for. They are taken from the Knative-Serving-Namespace and
+// Knative-Serving-Revision headers when both are set, and otherwise from
+// a Host addressing the revision's service, like
+// rev-service.ns.svc.cluster.local. ok is false when neither names a
+// revision. Either way the revision is known from r alone, without
+// looking up its route or configuration. Requests for tagged traffic
+// targets are resolved by a TagResolver instead.
+func RevisionFromRequest(r *http.Request) (namespace, name string, ok bool) {
+	namespace = r.Header.Get(controller.GetRevisionHeaderNamespace())
+	name = r.Header.Get(controller.GetRevisionHeaderName())
+	if namespace != "" && name != "" {
+		return namespace, name, true
+	}
+	return revisionFromHost(r.Host)
+}
+
+func revisionFromHost(host string) (namespace, name string, ok bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".svc.cluster.local")
+	host = strings.TrimSuffix(host, ".svc")
+	parts := strings.Split(host, ".")
+	if len(parts) != 2 || parts[1] == "" || !strings.HasSuffix(parts[0], revisionServiceSuffix) {
+		return "", "", false
+	}
+	name = strings.TrimSuffix(parts[0], revisionServiceSuffix)
+	if name == "" {
+		return "", "", false
+	}
+	return parts[1], name, true
+}
+
+// TagResolver finds the revisions of the tagged traffic targets of
+// routes, which are named by the Knative-Serving-Tag header of requests
+// for the route's domain, or by the subdomain of the route's domain
+// requests are for.
+type TagResolver struct {
+	routes listers.RouteLister
+}
+
+// NewTagResolver creates a TagResolver looking up routes in routes.
+func NewTagResolver(routes listers.RouteLister) *TagResolver {
+	return &TagResolver{routes: routes}
+}
+
+// RevisionFromRequest is like the package's RevisionFromRequest, except
+// that requests addressing a tag of a route in the namespace of the
+// revision are for the revision of that tag.
+func (t *TagResolver) RevisionFromRequest(r *http.Request) (namespace, name string, ok bool) {
+	namespace, name, ok = RevisionFromRequest(r)
+	if !ok {
+		return "", "", false
+	}
+	if tagged, found := t.taggedRevision(namespace, r); found {
+		return namespace, tagged, true
+	}
+	return namespace, name, true
+}
+
+// taggedRevision returns the revision of the traffic target named by the
+// tag r addresses, among the routes of namespace.
+func (t *TagResolver) taggedRevision(namespace string, r *http.Request) (string, bool) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	header := r.Header.Get(controller.GetTagHeaderName())
+	routes, err := t.routes.Routes(namespace).List(labels.Everything())
+	if err != nil {
+		return "", false
+	}
+	for _, route := range routes {
+		tag := header
+		if tag != "" {
+			if host != route.Status.Domain && host != route.Status.DomainInternal {
+				continue
+			}
+		} else if domain := route.Status.Domain; domain != "" && strings.HasSuffix(host, "."+domain) {
+			tag = strings.TrimSuffix(host, "."+domain)
+		}
+		if tag == "" || strings.Contains(tag, ".") {
+			continue
+		}
+		for _, target := range route.Status.Traffic {
+			if target.Name == tag && target.RevisionName != "" {
+				return target.RevisionName, true
+			}
+		}
+	}
+	return "", false
+}
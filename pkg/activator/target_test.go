@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	fakeKna "github.com/knative/serving/pkg/client/clientset/versioned/fake"
+	"github.com/knative/serving/pkg/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRevisionFromRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		headers       map[string]string
+		wantNamespace string
+		wantName      string
+		wantOK        bool
+	}{{
+		name: "headers",
+		host: "my-route.default.example.com",
+		headers: map[string]string{
+			"Knative-Serving-Namespace": "ns",
+			"Knative-Serving-Revision":  "rev",
+		},
+		wantNamespace: "ns",
+		wantName:      "rev",
+		wantOK:        true,
+	}, {
+		name: "headers win over host",
+		host: "other-service.default.svc.cluster.local",
+		headers: map[string]string{
+			"Knative-Serving-Namespace": "ns",
+			"Knative-Serving-Revision":  "rev",
+		},
+		wantNamespace: "ns",
+		wantName:      "rev",
+		wantOK:        true,
+	}, {
+		name: "partial headers fall back to host",
+		host: "rev-service.ns.svc.cluster.local:80",
+		headers: map[string]string{
+			"Knative-Serving-Revision": "other",
+		},
+		wantNamespace: "ns",
+		wantName:      "rev",
+		wantOK:        true,
+	}, {
+		name:          "short service host",
+		host:          "rev-service.ns",
+		wantNamespace: "ns",
+		wantName:      "rev",
+		wantOK:        true,
+	}, {
+		name: "route host",
+		host: "my-route.default.example.com",
+	}, {
+		name: "not a revision service",
+		host: "activator.knative-serving.svc.cluster.local",
+	}, {
+		name: "empty revision name",
+		host: "-service.ns.svc",
+	}, {
+		name: "nothing",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://activator/", nil)
+			r.Host = test.host
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			namespace, name, ok := RevisionFromRequest(r)
+			if namespace != test.wantNamespace || name != test.wantName || ok != test.wantOK {
+				t.Errorf("Unexpected revision. Want %s/%s, %v. Got %s/%s, %v.",
+					test.wantNamespace, test.wantName, test.wantOK, namespace, name, ok)
+			}
+		})
+	}
+}
+
+func TestTagResolver(t *testing.T) {
+	routes := externalversions.NewSharedInformerFactory(fakeKna.NewSimpleClientset(), time.Minute).Serving().V1alpha1().Routes()
+	routes.Informer().GetIndexer().Add(&v1alpha1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "my-route"},
+		Status: v1alpha1.RouteStatus{
+			Domain:         "my-route.ns.example.com",
+			DomainInternal: "my-route.ns.svc.cluster.local",
+			Traffic: []v1alpha1.TrafficTarget{{
+				RevisionName: "current",
+				Percent:      100,
+			}, {
+				Name:         "candidate",
+				RevisionName: "next",
+			}},
+		},
+	})
+	resolver := NewTagResolver(routes.Lister())
+
+	tests := []struct {
+		name     string
+		host     string
+		tag      string
+		wantName string
+		wantOK   bool
+	}{{
+		name:     "untagged",
+		host:     "my-route.ns.example.com",
+		wantName: "current",
+		wantOK:   true,
+	}, {
+		name:     "tag header",
+		host:     "my-route.ns.example.com",
+		tag:      "candidate",
+		wantName: "next",
+		wantOK:   true,
+	}, {
+		name:     "tag header on the internal domain",
+		host:     "my-route.ns.svc.cluster.local:80",
+		tag:      "candidate",
+		wantName: "next",
+		wantOK:   true,
+	}, {
+		name:     "tag subdomain",
+		host:     "candidate.my-route.ns.example.com",
+		wantName: "next",
+		wantOK:   true,
+	}, {
+		name:     "unknown tag",
+		host:     "my-route.ns.example.com",
+		tag:      "other",
+		wantName: "current",
+		wantOK:   true,
+	}, {
+		name:     "tag header for another host",
+		host:     "other-route.ns.example.com",
+		tag:      "candidate",
+		wantName: "current",
+		wantOK:   true,
+	}, {
+		name:     "nested subdomain",
+		host:     "a.candidate.my-route.ns.example.com",
+		wantName: "current",
+		wantOK:   true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://activator/", nil)
+			r.Host = test.host
+			r.Header.Set("Knative-Serving-Namespace", "ns")
+			r.Header.Set("Knative-Serving-Revision", "current")
+			if test.tag != "" {
+				r.Header.Set("Knative-Serving-Tag", test.tag)
+			}
+			namespace, name, ok := resolver.RevisionFromRequest(r)
+			if namespace != "ns" || name != test.wantName || ok != test.wantOK {
+				t.Errorf("Unexpected revision. Want ns/%s, %v. Got %s/%s, %v.",
+					test.wantName, test.wantOK, namespace, name, ok)
+			}
+		})
+	}
+
+	// Requests naming no revision are not resolved.
+	if _, _, ok := resolver.RevisionFromRequest(httptest.NewRequest("GET", "http://activator/", nil)); ok {
+		t.Error("Unexpected revision for a request naming none.")
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opencensus.io/trace"
+)
+
+// Headers propagating traces, in the W3C Trace Context and the Zipkin B3
+// formats.
+const (
+	traceparentHeader    = "traceparent"
+	b3TraceIDHeader      = "X-B3-TraceId"
+	b3SpanIDHeader       = "X-B3-SpanId"
+	b3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	b3SampledHeader      = "X-B3-Sampled"
+	b3FlagsHeader        = "X-B3-Flags"
+)
+
+// SpanContextFromRequest returns the span context propagated with r in a
+// traceparent header or, failing that, in B3 headers.
+func SpanContextFromRequest(r *http.Request) (trace.SpanContext, bool) {
+	if sc, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+		return sc, true
+	}
+	return parseB3(r.Header)
+}
+
+// SetSpanContextHeaders propagates sc with r in both the traceparent and
+// B3 formats, replacing the headers r came in with.
+func SetSpanContextHeaders(r *http.Request, sc trace.SpanContext) {
+	flags := "00"
+	sampled := "0"
+	if sc.IsSampled() {
+		flags = "01"
+		sampled = "1"
+	}
+	r.Header.Set(traceparentHeader, fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags))
+	r.Header.Set(b3TraceIDHeader, sc.TraceID.String())
+	r.Header.Set(b3SpanIDHeader, sc.SpanID.String())
+	r.Header.Set(b3SampledHeader, sampled)
+	r.Header.Del(b3ParentSpanIDHeader)
+	r.Header.Del(b3FlagsHeader)
+}
+
+// TraceRequests wraps h so that requests are served in an
+// "activator/request" span, continuing the trace they came with if any.
+func TraceRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var span *trace.Span
+		if sc, ok := SpanContextFromRequest(r); ok {
+			span = trace.NewSpanWithRemoteParent("activator/request", sc, trace.StartOptions{SpanKind: trace.SpanKindServer})
+		} else {
+			span = trace.NewSpan("activator/request", nil, trace.StartOptions{SpanKind: trace.SpanKindServer})
+		}
+		defer span.End()
+		span.AddAttributes(
+			trace.StringAttribute("http.host", r.Host),
+			trace.StringAttribute("http.method", r.Method),
+			trace.StringAttribute("http.path", r.URL.Path))
+		if id := RequestIDFrom(r.Context()); id != "" {
+			span.AddAttributes(trace.StringAttribute("request_id", id))
+		}
+
+		sw := NewStatusWriter(w)
+		h.ServeHTTP(sw, r.WithContext(trace.WithSpan(r.Context(), span)))
+		setSpanStatus(span, sw.Status())
+	})
+}
+
+// ActiveEndpointWithSpan calls a.ActiveEndpoint in an
+// "activator/activation_wait" span, child of the span in ctx, covering
+// the time the request waited for the revision to be activated and
+// probed.
+func ActiveEndpointWithSpan(ctx context.Context, a Activator, namespace, name string) (Endpoint, Status, error) {
+	ctx, span := trace.StartSpan(ctx, "activator/activation_wait")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", namespace),
+		trace.StringAttribute("revision", name))
+	endpoint, status, err := a.ActiveEndpoint(ctx, namespace, name)
+	if err != nil {
+		span.SetStatus(trace.Status{Code: spanStatusUnknown, Message: err.Error()})
+	}
+	return endpoint, status, err
+}
+
+func setSpanStatus(span *trace.Span, status int) {
+	span.AddAttributes(trace.Int64Attribute("http.status_code", int64(status)))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(trace.Status{Code: spanStatusUnknown, Message: http.StatusText(status)})
+	}
+}
+
+func parseTraceparent(h string) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+	parts := strings.Split(h, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if !decodeID(sc.TraceID[:], parts[1]) || !decodeID(sc.SpanID[:], parts[2]) {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+	sc.TraceOptions = trace.TraceOptions(flags[0] & 1)
+	return sc, true
+}
+
+func parseB3(h http.Header) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+	traceID := h.Get(b3TraceIDHeader)
+	// 64-bit trace IDs are left-padded to 128 bits.
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !decodeID(sc.TraceID[:], traceID) || !decodeID(sc.SpanID[:], h.Get(b3SpanIDHeader)) {
+		return sc, false
+	}
+	switch h.Get(b3SampledHeader) {
+	case "1", "true":
+		sc.TraceOptions = 1
+	}
+	if h.Get(b3FlagsHeader) == "1" {
+		sc.TraceOptions = 1
+	}
+	return sc, true
+}
+
+// decodeID decodes the hex encoded s into id, which s must fill exactly
+// with a value other than all zeros.
+func decodeID(id []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(id)) {
+		return false
+	}
+	if _, err := hex.Decode(id, []byte(s)); err != nil {
+		return false
+	}
+	for _, b := range id {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+	"go.opencensus.io/trace"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestSpanContextFromRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantTraceID string
+		wantSampled bool
+		wantOK      bool
+	}{{
+		name:        "traceparent",
+		headers:     map[string]string{"traceparent": "00-" + testTraceID + "-" + testSpanID + "-01"},
+		wantTraceID: testTraceID,
+		wantSampled: true,
+		wantOK:      true,
+	}, {
+		name: "traceparent wins over b3",
+		headers: map[string]string{
+			"traceparent":  "00-" + testTraceID + "-" + testSpanID + "-00",
+			"X-B3-TraceId": "a3ce929d0e0e4736",
+			"X-B3-SpanId":  testSpanID,
+		},
+		wantTraceID: testTraceID,
+		wantOK:      true,
+	}, {
+		name: "b3",
+		headers: map[string]string{
+			"X-B3-TraceId": testTraceID,
+			"X-B3-SpanId":  testSpanID,
+			"X-B3-Sampled": "1",
+		},
+		wantTraceID: testTraceID,
+		wantSampled: true,
+		wantOK:      true,
+	}, {
+		name: "b3 with 64-bit trace id",
+		headers: map[string]string{
+			"X-B3-TraceId": "a3ce929d0e0e4736",
+			"X-B3-SpanId":  testSpanID,
+			"X-B3-Flags":   "1",
+		},
+		wantTraceID: "0000000000000000a3ce929d0e0e4736",
+		wantSampled: true,
+		wantOK:      true,
+	}, {
+		name:    "invalid traceparent",
+		headers: map[string]string{"traceparent": "00-" + testTraceID + "-nothex-01"},
+	}, {
+		name:    "zero trace id",
+		headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-" + testSpanID + "-01"},
+	}, {
+		name: "none",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://activator/", nil)
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			sc, ok := SpanContextFromRequest(r)
+			if ok != test.wantOK {
+				t.Fatalf("Unexpected ok. Want %v. Got %v.", test.wantOK, ok)
+			}
+			if !ok {
+				return
+			}
+			if got := sc.TraceID.String(); got != test.wantTraceID {
+				t.Errorf("Unexpected trace ID. Want %v. Got %v.", test.wantTraceID, got)
+			}
+			if got := sc.SpanID.String(); got != testSpanID {
+				t.Errorf("Unexpected span ID. Want %v. Got %v.", testSpanID, got)
+			}
+			if got := sc.IsSampled(); got != test.wantSampled {
+				t.Errorf("Unexpected sampled. Want %v. Got %v.", test.wantSampled, got)
+			}
+		})
+	}
+}
+
+func TestSetSpanContextHeaders(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://activator/", nil)
+	r.Header.Set("X-B3-ParentSpanId", testSpanID)
+	sc, _ := parseTraceparent("00-" + testTraceID + "-" + testSpanID + "-01")
+	SetSpanContextHeaders(r, sc)
+
+	if got, want := r.Header.Get("traceparent"), "00-"+testTraceID+"-"+testSpanID+"-01"; got != want {
+		t.Errorf("Unexpected traceparent. Want %q. Got %q.", want, got)
+	}
+	got, ok := parseB3(r.Header)
+	if !ok || got != sc {
+		t.Errorf("Unexpected B3 span context. Want %v. Got %v, %v.", sc, got, ok)
+	}
+	if got := r.Header.Get("X-B3-ParentSpanId"); got != "" {
+		t.Errorf("Unexpected X-B3-ParentSpanId. Want none. Got %q.", got)
+	}
+}
+
+func TestTraceRequests_Proxy(t *testing.T) {
+	var upstream trace.SpanContext
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream, _ = SpanContextFromRequest(r)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	endpoint := serverEndpoint(t, s)
+	h := TraceRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trace.StartSpan(r.Context(), "activator/proxy")
+		defer span.End()
+		NewProxy(endpoint, http.DefaultTransport, TestLogger(t)).ServeHTTP(w, r.WithContext(ctx))
+	}))
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("traceparent", "00-"+testTraceID+"-"+testSpanID+"-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := upstream.TraceID.String(); got != testTraceID {
+		t.Errorf("Unexpected upstream trace ID. Want %v. Got %v.", testTraceID, got)
+	}
+	recorder.mux.Lock()
+	defer recorder.mux.Unlock()
+	spans := make(map[string]*trace.SpanData)
+	for _, s := range recorder.spans {
+		if s.TraceID.String() == testTraceID {
+			spans[s.Name] = s
+		}
+	}
+	request, proxy := spans["activator/request"], spans["activator/proxy"]
+	if request == nil || proxy == nil {
+		t.Fatalf("Unexpected spans. Want activator/request and activator/proxy. Got %v.", spans)
+	}
+	if got := request.ParentSpanID.String(); got != testSpanID {
+		t.Errorf("Unexpected request span parent. Want %v. Got %v.", testSpanID, got)
+	}
+	if proxy.ParentSpanID != request.SpanID {
+		t.Errorf("Unexpected proxy span parent. Want %v. Got %v.", request.SpanID, proxy.ParentSpanID)
+	}
+	if upstream.SpanID != proxy.SpanID {
+		t.Errorf("Unexpected upstream parent span. Want %v. Got %v.", proxy.SpanID, upstream.SpanID)
+	}
+	for _, s := range []*trace.SpanData{request, proxy} {
+		if got := s.Attributes["http.status_code"]; got != int64(http.StatusServiceUnavailable) {
+			t.Errorf("Unexpected %s status code. Want %v. Got %v.", s.Name, http.StatusServiceUnavailable, got)
+		}
+	}
+}
+
+func TestActiveEndpointWithSpan(t *testing.T) {
+	ep := Endpoint{FQDN: "ip", Port: 8080}
+	f := newFakeActivator(t, map[revisionID]activationResult{
+		revisionID{"default", "rev1"}: activationResult{endpoint: ep},
+	})
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	parent := trace.NewSpan("test", nil, trace.StartOptions{Sampler: trace.AlwaysSample()})
+
+	got, _, err := ActiveEndpointWithSpan(trace.WithSpan(context.Background(), parent), f, "default", "rev1")
+	parent.End()
+	if err != nil || got != ep {
+		t.Errorf("Unexpected endpoint. Want %+v. Got %+v, %v.", ep, got, err)
+	}
+	recorder.mux.Lock()
+	defer recorder.mux.Unlock()
+	for _, s := range recorder.spans {
+		if s.Name == "activator/activation_wait" && s.ParentSpanID == parent.SpanContext().SpanID {
+			return
+		}
+	}
+	t.Error("Expected an activator/activation_wait span under the request span.")
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package activator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// UpstreamCAKey is the key of the CA bundle in the secret named by the
+// upstream-ca-secret activator config.
+const UpstreamCAKey = "ca.crt"
+
+// UpstreamTLS verifies revisions that opt into TLS against a CA bundle,
+// and keeps a transport for each server name proxied to.
+type UpstreamTLS struct {
+	roots        *x509.CertPool
+	newTransport func(*tls.Config) http.RoundTripper
+
+	mux        sync.Mutex
+	transports map[string]http.RoundTripper
+}
+
+// NewUpstreamTLS creates an UpstreamTLS trusting the PEM certificates in
+// caBundle. newTransport creates the transport proxying to a server name
+// with the given TLS configuration.
+func NewUpstreamTLS(caBundle []byte, newTransport func(*tls.Config) http.RoundTripper) (*UpstreamTLS, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("no certificates found in the upstream CA bundle")
+	}
+	return &UpstreamTLS{
+		roots:        roots,
+		newTransport: newTransport,
+		transports:   make(map[string]http.RoundTripper),
+	}, nil
+}
+
+// UpstreamCAFromSecret returns the CA bundle held by the named secret.
+func UpstreamCAFromSecret(kubeClient kubernetes.Interface, namespace, name string) ([]byte, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ca, ok := secret.Data[UpstreamCAKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %q key", namespace, name, UpstreamCAKey)
+	}
+	return ca, nil
+}
+
+// ClientConfig returns the TLS configuration verifying the certificate
+// of serverName.
+func (u *UpstreamTLS) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		RootCAs:    u.roots,
+		ServerName: serverName,
+	}
+}
+
+// Transport returns the transport proxying to serverName, which is
+// reused across requests so that connections are kept alive.
+func (u *UpstreamTLS) Transport(serverName string) http.RoundTripper {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	t, ok := u.transports[serverName]
+	if !ok {
+		t = u.newTransport(u.ClientConfig(serverName))
+		u.transports[serverName] = t
+	}
+	return t
+}
+
+// UpstreamTLSFromAnnotations reports whether the upstream TLS annotation
+// opts a revision into TLS.
+func UpstreamTLSFromAnnotations(annotations map[string]string) (bool, error) {
+	raw, ok := annotations[serving.UpstreamTLSAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %v", serving.UpstreamTLSAnnotationKey, err)
+	}
+	return enabled, nil
+}
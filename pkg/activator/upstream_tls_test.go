@@ -0,0 +1,218 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving"
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+// testServerName is one of the names the certificate of httptest TLS
+// servers is valid for.
+const testServerName = "example.com"
+
+func serverCA(server *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+// otherCA returns a CA bundle that did not sign the certificate of
+// httptest TLS servers.
+func otherCA(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: testServerName},
+		DNSNames:              []string{testServerName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func testUpstreamTLS(t *testing.T, ca []byte) *UpstreamTLS {
+	u, err := NewUpstreamTLS(ca, func(cfg *tls.Config) http.RoundTripper {
+		return &http.Transport{TLSClientConfig: cfg}
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamTLS() = %v", err)
+	}
+	return u
+}
+
+func TestNewUpstreamTLS_NoCertificates(t *testing.T) {
+	if _, err := NewUpstreamTLS([]byte("not a certificate"), nil); err == nil {
+		t.Error("Expected an error for a CA bundle without certificates, got nil")
+	}
+}
+
+func TestUpstreamTLS_Probe(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	other := otherCA(t)
+
+	tests := []struct {
+		name       string
+		ca         []byte
+		serverName string
+		probe      *corev1.Probe
+		wantErr    bool
+	}{{
+		name:       "http trusted",
+		ca:         serverCA(server),
+		serverName: testServerName,
+		probe:      httpGetProbe("/"),
+	}, {
+		name:       "tcp trusted",
+		ca:         serverCA(server),
+		serverName: testServerName,
+	}, {
+		name:       "http untrusted",
+		ca:         other,
+		serverName: testServerName,
+		probe:      httpGetProbe("/"),
+		wantErr:    true,
+	}, {
+		name:       "tcp untrusted",
+		ca:         other,
+		serverName: testServerName,
+		wantErr:    true,
+	}, {
+		name:       "wrong server name",
+		ca:         serverCA(server),
+		serverName: "example.org",
+		probe:      httpGetProbe("/"),
+		wantErr:    true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := serverTarget(t, server)
+			target.Probe = test.probe
+			target.TLS = testUpstreamTLS(t, test.ca).ClientConfig(test.serverName)
+			err := NewProber(test.probe).Probe(context.Background(), target)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Probe() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpstreamTLS_Proxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer server.Close()
+	u := testUpstreamTLS(t, serverCA(server))
+
+	target := serverTarget(t, server)
+	endpoint := Endpoint{FQDN: target.Host, Port: target.Port, Scheme: "https", ServerName: testServerName}
+	transport := u.Transport(testServerName)
+	if u.Transport(testServerName) != transport {
+		t.Error("Expected the transport of a server name to be reused.")
+	}
+
+	w := httptest.NewRecorder()
+	NewProxy(endpoint, transport, TestLogger(t)).ServeHTTP(w, httptest.NewRequest("GET", "http://rev1-service.default/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status. Want %v. Got %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if got, want := w.Body.String(), "HTTP/1.1"; got != want {
+		t.Errorf("Unexpected protocol. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestUpstreamCAFromSecret(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "upstream-ca", Namespace: "knative-serving"},
+		Data:       map[string][]byte{UpstreamCAKey: []byte("ca")},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "knative-serving"},
+	})
+
+	got, err := UpstreamCAFromSecret(k8s, "knative-serving", "upstream-ca")
+	if err != nil {
+		t.Fatalf("UpstreamCAFromSecret() = %v", err)
+	}
+	if string(got) != "ca" {
+		t.Errorf("Unexpected CA bundle. Want %q. Got %q.", "ca", got)
+	}
+	if _, err := UpstreamCAFromSecret(k8s, "knative-serving", "other"); err == nil {
+		t.Error("Expected an error for a secret without a CA bundle, got nil")
+	}
+	if _, err := UpstreamCAFromSecret(k8s, "knative-serving", "missing"); err == nil {
+		t.Error("Expected an error for a missing secret, got nil")
+	}
+}
+
+func TestUpstreamTLSFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+		wantErr     bool
+	}{{
+		name: "not annotated",
+	}, {
+		name:        "enabled",
+		annotations: map[string]string{serving.UpstreamTLSAnnotationKey: "true"},
+		want:        true,
+	}, {
+		name:        "disabled",
+		annotations: map[string]string{serving.UpstreamTLSAnnotationKey: "false"},
+	}, {
+		name:        "invalid",
+		annotations: map[string]string{serving.UpstreamTLSAnnotationKey: "yes please"},
+		wantErr:     true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := UpstreamTLSFromAnnotations(test.annotations)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("UpstreamTLSFromAnnotations() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Unexpected result. Want %v. Got %v.", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Annotations are the autoscaling annotations of a Revision, as parsed and
+// validated by ParseAnnotations. Unset annotations are left zero.
+type Annotations struct {
+	// Class is the class of autoscaler scaling the Revision: KPA or HPA.
+	// It is KPA when unset.
+	Class string
+
+	MinScale         int32
+	MaxScale         int32
+	InitialScale     int32
+	ActivationScale  int32
+	MinScaleSchedule MinScaleSchedule
+
+	// PredictionHorizon is how far ahead the traffic of the Revision is
+	// forecast, or zero when it is not.
+	PredictionHorizon time.Duration
+
+	// StableWindow and PanicWindow are the windows the Revision is scaled
+	// over in place of those of the autoscaler config, or zero when they
+	// are not overridden.
+	StableWindow time.Duration
+	PanicWindow  time.Duration
+
+	// Metric is the metric the Revision is scaled on. The metrics of the
+	// KPA class are registered with the autoscaler, so any name is valid.
+	Metric string
+	// Target is the target of the metric: a percentage of the requests
+	// for the CPU and Memory metrics of the HPA class, and the value per
+	// pod for the metrics of the KPA class.
+	Target float64
+	// TargetQuantity is the average value per pod of the custom metrics
+	// of the HPA class, which require it.
+	TargetQuantity *resource.Quantity
+
+	// MetricName is the name of the External or Custom metric in its API,
+	// which they require, and MetricSelector the label selector of the
+	// series of the External metric.
+	MetricName     string
+	MetricSelector string
+}
+
+// AnnotationError is the error of an invalid autoscaling annotation.
+type AnnotationError struct {
+	Key    string
+	Value  string
+	Reason string
+}
+
+// Error implements error
+func (e *AnnotationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Key, e.Value, e.Reason)
+}
+
+// ParseAnnotations parses and validates the autoscaling annotations of a
+// Revision, those prefixed by GroupName, returning an *AnnotationError
+// for the first invalid one.
+func ParseAnnotations(annotations map[string]string) (*Annotations, error) {
+	a := &Annotations{Class: KPA}
+	if raw, ok := annotations[ClassAnnotationKey]; ok {
+		if raw != KPA && raw != HPA {
+			return nil, &AnnotationError{Key: ClassAnnotationKey, Value: raw, Reason: fmt.Sprintf("must be %s or %s", KPA, HPA)}
+		}
+		a.Class = raw
+	}
+
+	for _, scale := range []struct {
+		key   string
+		field *int32
+	}{
+		{MinScaleAnnotationKey, &a.MinScale},
+		{MaxScaleAnnotationKey, &a.MaxScale},
+		{InitialScaleAnnotationKey, &a.InitialScale},
+		{ActivationScaleAnnotationKey, &a.ActivationScale},
+	} {
+		raw, ok := annotations[scale.key]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || v < 1 {
+			return nil, &AnnotationError{Key: scale.key, Value: raw, Reason: "must be a positive integer"}
+		}
+		*scale.field = int32(v)
+	}
+	if a.MaxScale > 0 && a.MinScale > a.MaxScale {
+		return nil, &AnnotationError{Key: MinScaleAnnotationKey, Value: annotations[MinScaleAnnotationKey],
+			Reason: fmt.Sprintf("must not be above %s %d", MaxScaleAnnotationKey, a.MaxScale)}
+	}
+
+	if raw, ok := annotations[MinScaleScheduleAnnotationKey]; ok {
+		schedule, err := ParseMinScaleSchedule(raw)
+		if err != nil {
+			return nil, &AnnotationError{Key: MinScaleScheduleAnnotationKey, Value: raw, Reason: err.Error()}
+		}
+		a.MinScaleSchedule = schedule
+	}
+
+	if raw, ok := annotations[PredictionHorizonAnnotationKey]; ok {
+		d, err := time.ParseDuration(raw)
+		switch {
+		case err != nil || d <= 0 || d > maxPredictionHorizon:
+			return nil, &AnnotationError{Key: PredictionHorizonAnnotationKey, Value: raw, Reason: fmt.Sprintf("must be a positive duration of at most %v", maxPredictionHorizon)}
+		case a.Class != KPA:
+			return nil, &AnnotationError{Key: PredictionHorizonAnnotationKey, Value: raw, Reason: fmt.Sprintf("is only valid for class %s", KPA)}
+		}
+		a.PredictionHorizon = d
+	}
+
+	for _, window := range []struct {
+		key      string
+		field    *time.Duration
+		min, max time.Duration
+	}{
+		{StableWindowAnnotationKey, &a.StableWindow, minStableWindow, maxWindow},
+		{PanicWindowAnnotationKey, &a.PanicWindow, minPanicWindow, maxWindow},
+	} {
+		raw, ok := annotations[window.key]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		switch {
+		case err != nil || d < window.min || d > window.max:
+			return nil, &AnnotationError{Key: window.key, Value: raw, Reason: fmt.Sprintf("must be a duration from %v to %v", window.min, window.max)}
+		case a.Class != KPA:
+			return nil, &AnnotationError{Key: window.key, Value: raw, Reason: fmt.Sprintf("is only valid for class %s", KPA)}
+		}
+		*window.field = d
+	}
+	if a.StableWindow > 0 && a.PanicWindow > a.StableWindow {
+		return nil, &AnnotationError{Key: PanicWindowAnnotationKey, Value: annotations[PanicWindowAnnotationKey],
+			Reason: fmt.Sprintf("must not be above %s %v", StableWindowAnnotationKey, a.StableWindow)}
+	}
+
+	if err := a.parseTarget(annotations); err != nil {
+		return nil, err
+	}
+	if err := a.parseMetricName(annotations); err != nil {
+		return nil, err
+	}
+
+	// Reject misspelled annotations rather than ignore them.
+	var unknown []string
+	for key := range annotations {
+		if strings.HasPrefix(key, GroupName+"/") && !knownAnnotations[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &AnnotationError{Key: unknown[0], Value: annotations[unknown[0]], Reason: "unknown annotation"}
+	}
+	return a, nil
+}
+
+// maxPredictionHorizon bounds how far ahead traffic is forecast, beyond
+// which recent traffic tells little.
+const maxPredictionHorizon = time.Hour
+
+// The bounds of the stable and panic windows of a Revision. Shorter stable
+// windows hold too few stats to scale on, and longer ones scale too late to
+// follow traffic.
+const (
+	minStableWindow = 6 * time.Second
+	minPanicWindow  = time.Second
+	maxWindow       = time.Hour
+)
+
+// knownAnnotations are the keys ParseAnnotations parses.
+var knownAnnotations = map[string]bool{
+	ClassAnnotationKey:             true,
+	MinScaleAnnotationKey:          true,
+	MaxScaleAnnotationKey:          true,
+	InitialScaleAnnotationKey:      true,
+	ActivationScaleAnnotationKey:   true,
+	MinScaleScheduleAnnotationKey:  true,
+	PredictionHorizonAnnotationKey: true,
+	StableWindowAnnotationKey:      true,
+	PanicWindowAnnotationKey:       true,
+	MetricAnnotationKey:            true,
+	TargetAnnotationKey:            true,
+	MetricNameAnnotationKey:        true,
+	MetricSelectorAnnotationKey:    true,
+}
+
+// parseTarget parses the metric and its target, as the class of the
+// Revision expects them.
+func (a *Annotations) parseTarget(annotations map[string]string) error {
+	a.Metric = annotations[MetricAnnotationKey]
+	if _, ok := annotations[MetricAnnotationKey]; ok && a.Metric == "" {
+		return &AnnotationError{Key: MetricAnnotationKey, Value: a.Metric, Reason: "must not be empty"}
+	}
+	raw, hasTarget := annotations[TargetAnnotationKey]
+
+	switch {
+	case a.Class == HPA && (a.Metric == "" || a.Metric == CPU || a.Metric == Memory):
+		if !hasTarget {
+			return nil
+		}
+		u, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || u < 1 {
+			return &AnnotationError{Key: TargetAnnotationKey, Value: raw, Reason: "must be a positive percentage"}
+		}
+		a.Target = float64(u)
+
+	case a.Class == HPA:
+		if !hasTarget {
+			return &AnnotationError{Key: TargetAnnotationKey, Value: raw, Reason: fmt.Sprintf("is required for custom metric %q", a.Metric)}
+		}
+		q, err := resource.ParseQuantity(raw)
+		if err != nil || q.Sign() <= 0 {
+			return &AnnotationError{Key: TargetAnnotationKey, Value: raw, Reason: "must be a positive quantity"}
+		}
+		a.TargetQuantity = &q
+
+	case hasTarget:
+		t, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(t > 0) || math.IsInf(t, 1) {
+			return &AnnotationError{Key: TargetAnnotationKey, Value: raw, Reason: "must be a positive number"}
+		}
+		a.Target = t
+	}
+	return nil
+}
+
+// parseMetricName parses the name of the External and Custom metrics of the
+// KPA class, and the selector of the External one.
+func (a *Annotations) parseMetricName(annotations map[string]string) error {
+	fromAPI := a.Class == KPA && (a.Metric == External || a.Metric == Custom)
+	raw, hasName := annotations[MetricNameAnnotationKey]
+	switch {
+	case fromAPI && raw == "":
+		return &AnnotationError{Key: MetricNameAnnotationKey, Value: raw, Reason: fmt.Sprintf("is required for metric %q", a.Metric)}
+	case fromAPI && a.Target == 0:
+		return &AnnotationError{Key: TargetAnnotationKey, Value: annotations[TargetAnnotationKey], Reason: fmt.Sprintf("is required for metric %q", a.Metric)}
+	case !fromAPI && hasName:
+		return &AnnotationError{Key: MetricNameAnnotationKey, Value: raw, Reason: fmt.Sprintf("is only valid for metrics %q and %q", External, Custom)}
+	}
+	a.MetricName = raw
+
+	raw, hasSelector := annotations[MetricSelectorAnnotationKey]
+	if !hasSelector {
+		return nil
+	}
+	if a.Class != KPA || a.Metric != External {
+		return &AnnotationError{Key: MetricSelectorAnnotationKey, Value: raw, Reason: fmt.Sprintf("is only valid for metric %q", External)}
+	}
+	if _, err := labels.Parse(raw); err != nil {
+		return &AnnotationError{Key: MetricSelectorAnnotationKey, Value: raw, Reason: err.Error()}
+	}
+	a.MetricSelector = raw
+	return nil
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	half := resource.MustParse("500m")
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Annotations
+	}{{
+		name: "none",
+		want: &Annotations{Class: KPA},
+	}, {
+		name: "others ignored",
+		annotations: map[string]string{
+			"serving.knative.dev/configuration": "foo",
+		},
+		want: &Annotations{Class: KPA},
+	}, {
+		name: "scales",
+		annotations: map[string]string{
+			MinScaleAnnotationKey:        "2",
+			MaxScaleAnnotationKey:        "10",
+			InitialScaleAnnotationKey:    "3",
+			ActivationScaleAnnotationKey: "4",
+		},
+		want: &Annotations{Class: KPA, MinScale: 2, MaxScale: 10, InitialScale: 3, ActivationScale: 4},
+	}, {
+		name: "prediction horizon",
+		annotations: map[string]string{
+			PredictionHorizonAnnotationKey: "5m",
+		},
+		want: &Annotations{Class: KPA, PredictionHorizon: 5 * time.Minute},
+	}, {
+		name: "windows",
+		annotations: map[string]string{
+			StableWindowAnnotationKey: "10m",
+			PanicWindowAnnotationKey:  "1m",
+		},
+		want: &Annotations{Class: KPA, StableWindow: 10 * time.Minute, PanicWindow: time.Minute},
+	}, {
+		name: "panic window alone",
+		annotations: map[string]string{
+			PanicWindowAnnotationKey: "2s",
+		},
+		want: &Annotations{Class: KPA, PanicWindow: 2 * time.Second},
+	}, {
+		name: "kpa metric and target",
+		annotations: map[string]string{
+			MetricAnnotationKey: RPS,
+			TargetAnnotationKey: "12.5",
+		},
+		want: &Annotations{Class: KPA, Metric: RPS, Target: 12.5},
+	}, {
+		name: "hpa utilization",
+		annotations: map[string]string{
+			ClassAnnotationKey:  HPA,
+			MetricAnnotationKey: Memory,
+			TargetAnnotationKey: "60",
+		},
+		want: &Annotations{Class: HPA, Metric: Memory, Target: 60},
+	}, {
+		name: "hpa custom metric",
+		annotations: map[string]string{
+			ClassAnnotationKey:  HPA,
+			MetricAnnotationKey: "queue_length",
+			TargetAnnotationKey: "500m",
+		},
+		want: &Annotations{Class: HPA, Metric: "queue_length", TargetQuantity: &half},
+	}, {
+		name: "external metric",
+		annotations: map[string]string{
+			MetricAnnotationKey:         External,
+			MetricNameAnnotationKey:     "kafka_consumergroup_lag",
+			MetricSelectorAnnotationKey: "topic=orders",
+			TargetAnnotationKey:         "100",
+		},
+		want: &Annotations{Class: KPA, Metric: External, Target: 100, MetricName: "kafka_consumergroup_lag", MetricSelector: "topic=orders"},
+	}, {
+		name: "custom metric",
+		annotations: map[string]string{
+			MetricAnnotationKey:     Custom,
+			MetricNameAnnotationKey: "jobs_in_progress",
+			TargetAnnotationKey:     "2",
+		},
+		want: &Annotations{Class: KPA, Metric: Custom, Target: 2, MetricName: "jobs_in_progress"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAnnotations(test.annotations)
+			if err != nil {
+				t.Fatalf("ParseAnnotations() = %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreUnexported(resource.Quantity{})); diff != "" {
+				t.Errorf("ParseAnnotations (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestParseAnnotations_MinScaleSchedule(t *testing.T) {
+	got, err := ParseAnnotations(map[string]string{
+		MinScaleScheduleAnnotationKey: "30 7 * * 1-5 10h 5",
+	})
+	if err != nil {
+		t.Fatalf("ParseAnnotations() = %v", err)
+	}
+	if len(got.MinScaleSchedule) != 1 {
+		t.Errorf("ParseAnnotations() = %d windows, want 1", len(got.MinScaleSchedule))
+	}
+}
+
+func TestParseAnnotationsErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantKey     string
+	}{{
+		name: "unknown class",
+		annotations: map[string]string{
+			ClassAnnotationKey: "vpa." + GroupName,
+		},
+		wantKey: ClassAnnotationKey,
+	}, {
+		name: "invalid min scale",
+		annotations: map[string]string{
+			MinScaleAnnotationKey: "zero",
+		},
+		wantKey: MinScaleAnnotationKey,
+	}, {
+		name: "non-positive max scale",
+		annotations: map[string]string{
+			MaxScaleAnnotationKey: "0",
+		},
+		wantKey: MaxScaleAnnotationKey,
+	}, {
+		name: "min scale above max scale",
+		annotations: map[string]string{
+			MinScaleAnnotationKey: "5",
+			MaxScaleAnnotationKey: "2",
+		},
+		wantKey: MinScaleAnnotationKey,
+	}, {
+		name: "initial scale below 1",
+		annotations: map[string]string{
+			InitialScaleAnnotationKey: "0",
+		},
+		wantKey: InitialScaleAnnotationKey,
+	}, {
+		name: "malformed activation scale",
+		annotations: map[string]string{
+			ActivationScaleAnnotationKey: "ten",
+		},
+		wantKey: ActivationScaleAnnotationKey,
+	}, {
+		name: "invalid schedule",
+		annotations: map[string]string{
+			MinScaleScheduleAnnotationKey: "mornings",
+		},
+		wantKey: MinScaleScheduleAnnotationKey,
+	}, {
+		name: "prediction horizon beyond an hour",
+		annotations: map[string]string{
+			PredictionHorizonAnnotationKey: "2h",
+		},
+		wantKey: PredictionHorizonAnnotationKey,
+	}, {
+		name: "prediction horizon of hpa class",
+		annotations: map[string]string{
+			ClassAnnotationKey:             HPA,
+			PredictionHorizonAnnotationKey: "5m",
+		},
+		wantKey: PredictionHorizonAnnotationKey,
+	}, {
+		name: "stable window below 6s",
+		annotations: map[string]string{
+			StableWindowAnnotationKey: "5s",
+		},
+		wantKey: StableWindowAnnotationKey,
+	}, {
+		name: "panic window beyond an hour",
+		annotations: map[string]string{
+			PanicWindowAnnotationKey: "61m",
+		},
+		wantKey: PanicWindowAnnotationKey,
+	}, {
+		name: "invalid panic window",
+		annotations: map[string]string{
+			PanicWindowAnnotationKey: "6",
+		},
+		wantKey: PanicWindowAnnotationKey,
+	}, {
+		name: "panic window above stable window",
+		annotations: map[string]string{
+			StableWindowAnnotationKey: "30s",
+			PanicWindowAnnotationKey:  "1m",
+		},
+		wantKey: PanicWindowAnnotationKey,
+	}, {
+		name: "stable window of hpa class",
+		annotations: map[string]string{
+			ClassAnnotationKey:        HPA,
+			StableWindowAnnotationKey: "10m",
+		},
+		wantKey: StableWindowAnnotationKey,
+	}, {
+		name: "empty metric",
+		annotations: map[string]string{
+			MetricAnnotationKey: "",
+		},
+		wantKey: MetricAnnotationKey,
+	}, {
+		name: "non-positive kpa target",
+		annotations: map[string]string{
+			TargetAnnotationKey: "-1",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "not a number kpa target",
+		annotations: map[string]string{
+			TargetAnnotationKey: "NaN",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "invalid hpa utilization",
+		annotations: map[string]string{
+			ClassAnnotationKey:  HPA,
+			TargetAnnotationKey: "80%",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "hpa custom metric without target",
+		annotations: map[string]string{
+			ClassAnnotationKey:  HPA,
+			MetricAnnotationKey: "queue_length",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "hpa custom metric with invalid target",
+		annotations: map[string]string{
+			ClassAnnotationKey:  HPA,
+			MetricAnnotationKey: "queue_length",
+			TargetAnnotationKey: "lots",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "external metric without name",
+		annotations: map[string]string{
+			MetricAnnotationKey: External,
+			TargetAnnotationKey: "100",
+		},
+		wantKey: MetricNameAnnotationKey,
+	}, {
+		name: "custom metric without target",
+		annotations: map[string]string{
+			MetricAnnotationKey:     Custom,
+			MetricNameAnnotationKey: "jobs_in_progress",
+		},
+		wantKey: TargetAnnotationKey,
+	}, {
+		name: "metric name of a metric of pod stats",
+		annotations: map[string]string{
+			MetricAnnotationKey:     RPS,
+			MetricNameAnnotationKey: "requests",
+		},
+		wantKey: MetricNameAnnotationKey,
+	}, {
+		name: "selector of custom metric",
+		annotations: map[string]string{
+			MetricAnnotationKey:         Custom,
+			MetricNameAnnotationKey:     "jobs_in_progress",
+			MetricSelectorAnnotationKey: "topic=orders",
+			TargetAnnotationKey:         "2",
+		},
+		wantKey: MetricSelectorAnnotationKey,
+	}, {
+		name: "invalid selector",
+		annotations: map[string]string{
+			MetricAnnotationKey:         External,
+			MetricNameAnnotationKey:     "kafka_consumergroup_lag",
+			MetricSelectorAnnotationKey: "topic in orders",
+			TargetAnnotationKey:         "100",
+		},
+		wantKey: MetricSelectorAnnotationKey,
+	}, {
+		name: "unknown annotation",
+		annotations: map[string]string{
+			GroupName + "/minscale": "2",
+		},
+		wantKey: GroupName + "/minscale",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAnnotations(test.annotations)
+			ae, ok := err.(*AnnotationError)
+			if !ok {
+				t.Fatalf("ParseAnnotations() = %v, %v, wanted an *AnnotationError", got, err)
+			}
+			if ae.Key != test.wantKey {
+				t.Errorf("ParseAnnotations() = %v, wanted an error for %s", err, test.wantKey)
+			}
+		})
+	}
+}
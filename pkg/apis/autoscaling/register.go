@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+const (
+	GroupName = "autoscaling.knative.dev"
+
+	// ClassAnnotationKey is the annotation key on a Revision holding the class of
+	// autoscaler that scales it: KPA, the default, or HPA.
+	ClassAnnotationKey = GroupName + "/class"
+	// KPA is the class of the built-in, concurrency based autoscaler.
+	KPA = "kpa." + GroupName
+	// HPA is the class of Revisions scaled by a Kubernetes HorizontalPodAutoscaler.
+	HPA = "hpa." + GroupName
+
+	// MinScaleAnnotationKey is the annotation key on a Revision holding the lowest
+	// number of pods it is scaled to.
+	MinScaleAnnotationKey = GroupName + "/minScale"
+	// MaxScaleAnnotationKey is the annotation key on a Revision holding the highest
+	// number of pods it is scaled to.
+	MaxScaleAnnotationKey = GroupName + "/maxScale"
+	// InitialScaleAnnotationKey is the annotation key on a Revision holding the
+	// number of pods it starts with, overriding the cluster-wide default.
+	InitialScaleAnnotationKey = GroupName + "/initial-scale"
+	// ActivationScaleAnnotationKey is the annotation key on a Revision holding the
+	// number of pods it is scaled to when activated from zero.
+	ActivationScaleAnnotationKey = GroupName + "/activation-scale"
+	// MinScaleScheduleAnnotationKey is the annotation key on a Revision holding the
+	// cron scheduled windows during which its minimum scale is raised, separated
+	// by semicolons, e.g. "30 7 * * 1-5 10h 5" for at least 5 pods from 7:30 UTC
+	// for 10 hours on week days.
+	MinScaleScheduleAnnotationKey = GroupName + "/minScaleSchedule"
+	// PredictionHorizonAnnotationKey is the annotation key on a Revision of the KPA
+	// class holding how far ahead, as a duration of at most an hour, the autoscaler
+	// forecasts its traffic to scale it up ahead of increases. Revisions are only
+	// scaled on the forecast when set.
+	PredictionHorizonAnnotationKey = GroupName + "/predictionHorizon"
+	// StableWindowAnnotationKey is the annotation key on a Revision of the KPA
+	// class holding the duration, from 6s to an hour, of the stable window it is
+	// scaled over, in place of the stable-window of the autoscaler config.
+	StableWindowAnnotationKey = GroupName + "/stableWindow"
+	// PanicWindowAnnotationKey is the annotation key on a Revision of the KPA
+	// class holding the duration, from 1s to its stable window, of the panic
+	// window it panics over, in place of the panic-window of the autoscaler
+	// config.
+	PanicWindowAnnotationKey = GroupName + "/panicWindow"
+
+	// MetricAnnotationKey is the annotation key on a Revision holding the metric it
+	// is scaled on. For the HPA class: CPU, the default, Memory, or the name of a
+	// custom metric of its pods. For the KPA class: Concurrency, the default, RPS,
+	// External, Custom, or the name of a Scaler registered with the autoscaler.
+	MetricAnnotationKey = GroupName + "/metric"
+	// CPU is the metric of Revisions scaled on the utilization of their CPU requests.
+	CPU = "cpu"
+	// Memory is the metric of Revisions scaled on the utilization of their memory requests.
+	Memory = "memory"
+	// Concurrency is the metric of Revisions scaled on the concurrent requests of
+	// their pods.
+	Concurrency = "concurrency"
+	// RPS is the metric of Revisions scaled on the requests per second of their pods.
+	RPS = "rps"
+	// External is the metric of Revisions scaled on the metric of the external
+	// metrics API named by their metric name annotation, e.g. the lag of a queue
+	// they consume.
+	External = "external"
+	// Custom is the metric of Revisions scaled on the metric of their pods from
+	// the custom metrics API named by their metric name annotation.
+	Custom = "custom"
+
+	// MetricNameAnnotationKey is the annotation key on a Revision scaled on the
+	// External or Custom metric holding the name of the metric in its API.
+	MetricNameAnnotationKey = GroupName + "/metricName"
+	// MetricSelectorAnnotationKey is the annotation key on a Revision scaled on
+	// the External metric holding the label selector of the series of the metric
+	// it is scaled on, all of them when unset.
+	MetricSelectorAnnotationKey = GroupName + "/metricSelector"
+
+	// TargetAnnotationKey is the annotation key on a Revision holding the target of
+	// its metric. For the HPA class: a percentage of the requests for CPU and
+	// Memory, or an average value per pod, as a quantity, for custom metrics. For
+	// the KPA class: the value per pod of its metric, overriding the cluster-wide
+	// target, which the External and Custom metrics require.
+	TargetAnnotationKey = GroupName + "/target"
+)
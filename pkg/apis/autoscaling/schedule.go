@@ -0,0 +1,221 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxScheduledWindow is the longest window of a MinScaleSchedule,
+	// bounding the minutes searched for its start.
+	maxScheduledWindow = 24 * time.Hour
+
+	// cronTZPrefix prefixes the time zone a window is scheduled in,
+	// which defaults to UTC.
+	cronTZPrefix = "CRON_TZ="
+)
+
+// MinScaleSchedule is a list of windows during which the minimum scale of
+// a revision is raised. Each window starts at the times matching a cron
+// expression and lasts for a duration.
+type MinScaleSchedule []scheduledWindow
+
+type scheduledWindow struct {
+	schedule *cronSchedule
+	duration time.Duration
+	scale    int32
+}
+
+// ParseMinScaleSchedule parses windows separated by semicolons, each made
+// of a five field cron expression, optionally prefixed by CRON_TZ= and a
+// time zone, the duration of the window and its minimum scale, e.g.
+// "CRON_TZ=Europe/Paris 30 7 * * 1-5 10h 5".
+func ParseMinScaleSchedule(raw string) (MinScaleSchedule, error) {
+	var schedule MinScaleSchedule
+	for _, entry := range strings.Split(raw, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		loc := time.UTC
+		if strings.HasPrefix(fields[0], cronTZPrefix) {
+			var err error
+			if loc, err = time.LoadLocation(strings.TrimPrefix(fields[0], cronTZPrefix)); err != nil {
+				return nil, err
+			}
+			fields = fields[1:]
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("window %q is not a cron expression followed by a duration and a scale", strings.TrimSpace(entry))
+		}
+		cron, err := parseCron(fields[:5], loc)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(fields[5])
+		if err != nil || duration < time.Minute || duration > maxScheduledWindow {
+			return nil, fmt.Errorf("window duration %q must be from 1m to %v", fields[5], maxScheduledWindow)
+		}
+		scale, err := strconv.ParseInt(fields[6], 10, 32)
+		if err != nil || scale < 1 {
+			return nil, fmt.Errorf("window scale %q must be a positive integer", fields[6])
+		}
+		schedule = append(schedule, scheduledWindow{schedule: cron, duration: duration, scale: int32(scale)})
+	}
+	return schedule, nil
+}
+
+// MinScale returns the highest scale of the windows open at now, or zero
+// when none is.
+func (s MinScaleSchedule) MinScale(now time.Time) int32 {
+	var scale int32
+	for _, w := range s {
+		if w.scale > scale && w.open(now) {
+			scale = w.scale
+		}
+	}
+	return scale
+}
+
+// open tells whether the window started less than its duration before now.
+func (w scheduledWindow) open(now time.Time) bool {
+	t := now.In(w.schedule.loc).Truncate(time.Minute)
+	for from := now.Add(-w.duration); t.After(from); t = t.Add(-time.Minute) {
+		if w.schedule.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// cronSchedule is a parsed cron expression: the minutes, hours, days of the
+// month, months and days of the week matching it, as bit sets.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether the days of the month or of the week are restricted, in
+	// which case a day matches either of them.
+	domRestricted, dowRestricted bool
+	loc                          *time.Location
+}
+
+// cronFields are the names and bounds of the fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max uint
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// Both 0 and 7 are Sunday.
+	{"day of week", 0, 7},
+}
+
+// parseCron parses the five fields of a cron expression, each a comma
+// separated list of *, values or ranges, optionally stepped with /.
+func parseCron(fields []string, loc *time.Location) (*cronSchedule, error) {
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", cronFields[i].name, field, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+		loc:           loc,
+	}, nil
+}
+
+func parseCronField(field string, min, max uint) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, uint64(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("step %q must be a positive integer", part[i+1:])
+			}
+			rng, step = part[:i], s
+		}
+		lo, hi := min, max
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+		case i >= 0:
+			var err error
+			if lo, err = parseCronValue(rng[:i], min, max); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(rng[i+1:], min, max); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q is decreasing", rng)
+			}
+		default:
+			var err error
+			if lo, err = parseCronValue(rng, min, max); err != nil {
+				return 0, err
+			}
+			// A stepped value ranges up to the maximum.
+			if step == 1 {
+				hi = lo
+			}
+		}
+		for v := uint64(lo); v <= uint64(hi); v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(raw string, min, max uint) (uint, error) {
+	v, err := strconv.ParseUint(raw, 10, 8)
+	if err != nil || uint(v) < min || uint(v) > max {
+		return 0, fmt.Errorf("value %q is not within [%d, %d]", raw, min, max)
+	}
+	return uint(v), nil
+}
+
+// matches tells whether the minute of t, in the location of the schedule,
+// matches it.
+func (c *cronSchedule) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
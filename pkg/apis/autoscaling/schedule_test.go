@@ -0,0 +1,189 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMinScaleSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr bool
+	}{{
+		name: "empty",
+		raw:  "",
+	}, {
+		name: "one window",
+		raw:  "30 7 * * 1-5 10h 5",
+		want: 1,
+	}, {
+		name: "several windows",
+		raw:  "30 7 * * 1-5 10h 5; 0 */2 1,15 * * 30m 2;",
+		want: 2,
+	}, {
+		name: "time zone",
+		raw:  "CRON_TZ=UTC 30 7 * * 1-5 10h 5",
+		want: 1,
+	}, {
+		name:    "unknown time zone",
+		raw:     "CRON_TZ=Nowhere/Special 30 7 * * 1-5 10h 5",
+		wantErr: true,
+	}, {
+		name:    "missing scale",
+		raw:     "30 7 * * 1-5 10h",
+		wantErr: true,
+	}, {
+		name:    "minute out of range",
+		raw:     "60 7 * * 1-5 10h 5",
+		wantErr: true,
+	}, {
+		name:    "decreasing range",
+		raw:     "30 7 * * 5-1 10h 5",
+		wantErr: true,
+	}, {
+		name:    "zero step",
+		raw:     "*/0 7 * * * 10h 5",
+		wantErr: true,
+	}, {
+		name:    "window longer than a day",
+		raw:     "30 7 * * 1-5 25h 5",
+		wantErr: true,
+	}, {
+		name:    "scale below 1",
+		raw:     "30 7 * * 1-5 10h 0",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseMinScaleSchedule(test.raw)
+			if (err != nil) != test.wantErr {
+				t.Errorf("ParseMinScaleSchedule() = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(got) != test.want {
+				t.Errorf("ParseMinScaleSchedule() = %d windows, want %d", len(got), test.want)
+			}
+		})
+	}
+}
+
+func TestMinScaleSchedule_MinScale(t *testing.T) {
+	schedule, err := ParseMinScaleSchedule("30 7 * * 1-5 10h 5; 0 12 * * 1-5 1h 8; 0 22 * * 5 4h 2")
+	if err != nil {
+		t.Fatalf("ParseMinScaleSchedule() = %v", err)
+	}
+
+	// Monday, January 7th 2019.
+	monday := time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want int32
+	}{{
+		name: "before the morning window",
+		now:  monday.Add(7*time.Hour + 29*time.Minute + 59*time.Second),
+		want: 0,
+	}, {
+		name: "as the morning window opens",
+		now:  monday.Add(7*time.Hour + 30*time.Minute),
+		want: 5,
+	}, {
+		name: "highest of the open windows",
+		now:  monday.Add(12*time.Hour + 30*time.Minute),
+		want: 8,
+	}, {
+		name: "as the morning window closes",
+		now:  monday.Add(17*time.Hour + 30*time.Minute),
+		want: 0,
+	}, {
+		name: "on a weekend",
+		now:  monday.Add(-2*24*time.Hour + 8*time.Hour),
+		want: 0,
+	}, {
+		name: "past midnight of a window opened on Friday",
+		now:  monday.Add(-2*24*time.Hour + 1*time.Hour),
+		want: 2,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := schedule.MinScale(test.now); got != test.want {
+				t.Errorf("MinScale() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_Matches(t *testing.T) {
+	tests := []struct {
+		name string
+		cron string
+		at   time.Time
+		want bool
+	}{{
+		name: "step",
+		cron: "*/15 * * * *",
+		at:   time.Date(2019, time.January, 7, 3, 45, 0, 0, time.UTC),
+		want: true,
+	}, {
+		name: "off step",
+		cron: "*/15 * * * *",
+		at:   time.Date(2019, time.January, 7, 3, 46, 0, 0, time.UTC),
+		want: false,
+	}, {
+		name: "stepped range",
+		cron: "0 8-18/5 * * *",
+		at:   time.Date(2019, time.January, 7, 13, 0, 0, 0, time.UTC),
+		want: true,
+	}, {
+		name: "stepped value",
+		cron: "0 20/2 * * *",
+		at:   time.Date(2019, time.January, 7, 22, 0, 0, 0, time.UTC),
+		want: true,
+	}, {
+		name: "Sunday as 7",
+		cron: "0 0 * * 7",
+		at:   time.Date(2019, time.January, 6, 0, 0, 0, 0, time.UTC),
+		want: true,
+	}, {
+		name: "day of month or of week",
+		cron: "0 0 1 * 1",
+		at:   time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC),
+		want: true,
+	}, {
+		name: "month",
+		cron: "0 0 * 2,3 *",
+		at:   time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC),
+		want: false,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseMinScaleSchedule(test.cron + " 1m 1")
+			if err != nil {
+				t.Fatalf("ParseMinScaleSchedule() = %v", err)
+			}
+			if got := schedule[0].schedule.matches(test.at); got != test.want {
+				t.Errorf("matches(%v) = %v, want %v", test.at, got, test.want)
+			}
+		})
+	}
+}
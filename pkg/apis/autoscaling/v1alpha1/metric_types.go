@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Knative Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Metric describes the statistics the autoscaler collects for a Revision.
+// The revision controller creates a Metric for every Revision scaled by the
+// KPA, and the autoscaler collects its statistics for as long as it exists.
+type Metric struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state of the Metric (from the client).
+	// +optional
+	Spec MetricSpec `json:"spec,omitempty"`
+
+	// Status communicates the observed state of the Metric (from the controller).
+	// +optional
+	Status MetricStatus `json:"status,omitempty"`
+}
+
+// MetricSpec describes what the autoscaler collects for a Revision.
+type MetricSpec struct {
+	// ScrapeTarget is the name of the Revision, in the namespace of the
+	// Metric, whose pods are scraped for statistics.
+	ScrapeTarget string `json:"scrapeTarget"`
+}
+
+// MetricConditionType is used to communicate the status of the collection
+// of a Metric.
+type MetricConditionType string
+
+const (
+	// MetricConditionReady is set when the autoscaler collects the statistics
+	// the Metric describes.
+	MetricConditionReady MetricConditionType = "Ready"
+)
+
+// MetricCondition defines a readiness condition for a Metric.
+// See: https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#typical-status-properties
+type MetricCondition struct {
+	Type MetricConditionType `json:"type" description:"type of Metric condition"`
+
+	Status corev1.ConditionStatus `json:"status" description:"status of the condition, one of True, False, Unknown"`
+
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty" description:"last time the condition transit from one status to another"`
+
+	// +optional
+	Reason string `json:"reason,omitempty" description:"one-word CamelCase reason for the condition's last transition"`
+
+	// +optional
+	Message string `json:"message,omitempty" description:"human-readable message indicating details about last transition"`
+}
+
+// MetricStatus communicates the observed state of the Metric.
+type MetricStatus struct {
+	// Conditions communicates information about ongoing/complete
+	// reconciliation processes that bring the "spec" inline with the observed
+	// state of the world.
+	// +optional
+	Conditions []MetricCondition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MetricList is a list of Metric resources
+type MetricList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Metric `json:"items"`
+}
+
+// IsReady looks at the conditions and if the Status has a condition
+// MetricConditionReady returns true if ConditionStatus is True
+func (ms *MetricStatus) IsReady() bool {
+	if c := ms.GetCondition(MetricConditionReady); c != nil {
+		return c.Status == corev1.ConditionTrue
+	}
+	return false
+}
+
+func (ms *MetricStatus) GetCondition(t MetricConditionType) *MetricCondition {
+	for _, cond := range ms.Conditions {
+		if cond.Type == t {
+			return &cond
+		}
+	}
+	return nil
+}
+
+// MarkReady records that the statistics of the Metric are collected.
+func (ms *MetricStatus) MarkReady() {
+	ms.setCondition(&MetricCondition{
+		Type:   MetricConditionReady,
+		Status: corev1.ConditionTrue,
+	})
+}
+
+// MarkNotReady records that the statistics of the Metric cannot be collected,
+// and why.
+func (ms *MetricStatus) MarkNotReady(reason, message string) {
+	ms.setCondition(&MetricCondition{
+		Type:    MetricConditionReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+func (ms *MetricStatus) setCondition(new *MetricCondition) {
+	if new == nil {
+		return
+	}
+
+	t := new.Type
+	var conditions []MetricCondition
+	for _, cond := range ms.Conditions {
+		if cond.Type != t {
+			conditions = append(conditions, cond)
+		} else {
+			// If we'd only update the LastTransitionTime, then return.
+			new.LastTransitionTime = cond.LastTransitionTime
+			if reflect.DeepEqual(new, &cond) {
+				return
+			}
+		}
+	}
+	new.LastTransitionTime = metav1.NewTime(time.Now())
+	conditions = append(conditions, *new)
+	ms.Conditions = conditions
+}
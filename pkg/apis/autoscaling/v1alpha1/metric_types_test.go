@@ -0,0 +1,60 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMetricIsReady(t *testing.T) {
+	ms := &MetricStatus{}
+	if ms.IsReady() {
+		t.Error("Empty status should not be ready")
+	}
+
+	ms.MarkNotReady("CollectionFailed", "no scrape target")
+	if ms.IsReady() {
+		t.Error("Status marked not ready should not be ready")
+	}
+	c := ms.GetCondition(MetricConditionReady)
+	if got, want := c.Reason, "CollectionFailed"; got != want {
+		t.Errorf("Ready reason = %q, want %q", got, want)
+	}
+
+	ms.MarkReady()
+	if !ms.IsReady() {
+		t.Error("Status marked ready should be ready")
+	}
+	if got, want := len(ms.Conditions), 1; got != want {
+		t.Errorf("len(Conditions) = %d, want %d", got, want)
+	}
+}
+
+func TestMetricMarkReadyKeepsTransitionTime(t *testing.T) {
+	ms := &MetricStatus{}
+	ms.MarkReady()
+	want := ms.GetCondition(MetricConditionReady).LastTransitionTime
+
+	ms.MarkReady()
+	if got := ms.GetCondition(MetricConditionReady); got.LastTransitionTime != want {
+		t.Errorf("LastTransitionTime = %v, want %v", got.LastTransitionTime, want)
+	}
+	if got := ms.GetCondition(MetricConditionReady).Status; got != corev1.ConditionTrue {
+		t.Errorf("Ready status = %v, want %v", got, corev1.ConditionTrue)
+	}
+}
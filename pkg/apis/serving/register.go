@@ -46,4 +46,43 @@ const (
 	// ServiceLabelKey is the label key attached to a Route and Configuration indicating by
 	// which Service they are created.
 	ServiceLabelKey = GroupName + "/service"
+
+	// ReadinessProbeBodyAnnotationKey is the annotation key on a Revision holding a
+	// substring that the body of its HTTP readiness probe response must contain for
+	// the activator to consider it ready.
+	ReadinessProbeBodyAnnotationKey = GroupName + "/readinessProbeBody"
+
+	// ReadinessProbeBodyRegexAnnotationKey is like ReadinessProbeBodyAnnotationKey,
+	// but holds a regular expression the body must match.
+	ReadinessProbeBodyRegexAnnotationKey = GroupName + "/readinessProbeBodyRegex"
+
+	// UpstreamTLSAnnotationKey is the annotation key on a Revision that, when "true",
+	// has the activator probe and proxy to its pods over TLS.
+	UpstreamTLSAnnotationKey = GroupName + "/upstreamTLS"
+
+	// MaxRequestBodyBytesAnnotationKey is the annotation key on a Revision holding the
+	// largest request body, in bytes, that the activator forwards to it, overriding
+	// the activator's own limit.
+	MaxRequestBodyBytesAnnotationKey = GroupName + "/maxRequestBodyBytes"
+
+	// HedgeDelayAnnotationKey is the annotation key on a latency-critical Revision
+	// holding how long the activator waits for the response headers of one of its
+	// pods before sending the same request to another one and keeping whichever
+	// answers first.
+	HedgeDelayAnnotationKey = GroupName + "/hedgeDelay"
+
+	// ShadowRevisionAnnotationKey is the annotation key on a Revision holding the
+	// name of another Revision, in the same namespace, that the activator mirrors
+	// its requests to, discarding the responses.
+	ShadowRevisionAnnotationKey = GroupName + "/shadowRevision"
+
+	// ShadowPercentAnnotationKey is the annotation key on a Revision holding the
+	// percentage of its requests mirrored to its shadow Revision, all of them when
+	// unset.
+	ShadowPercentAnnotationKey = GroupName + "/shadowPercent"
+
+	// ActivatorInPathAnnotationKey is the annotation key the autoscaler sets to "true"
+	// on a Revision whose pods lack the spare capacity for the target burst capacity,
+	// so that routes keep the activator in its data path to buffer bursts.
+	ActivatorInPathAnnotationKey = GroupName + "/activatorInPath"
 )
@@ -99,6 +99,23 @@ const (
 	RevisionRequestConcurrencyModelMulti RevisionRequestConcurrencyModelType = "Multi"
 )
 
+// RevisionContainerConcurrencyMax is the highest ContainerConcurrency of a
+// Revision.
+const RevisionContainerConcurrencyMax = 1000
+
+// RevisionProtocolType is an enumeration of the protocols a Revision
+// Container may serve.
+type RevisionProtocolType string
+
+const (
+	// RevisionProtocolHTTP1 is HTTP/1.1, which Revisions serve unless
+	// told otherwise.
+	RevisionProtocolHTTP1 RevisionProtocolType = "http1"
+	// RevisionProtocolH2C is HTTP/2 over cleartext, as served by gRPC
+	// servers.
+	RevisionProtocolH2C RevisionProtocolType = "h2c"
+)
+
 // RevisionSpec holds the desired state of the Revision (from the client).
 type RevisionSpec struct {
 	// TODO: Generation does not work correctly with CRD. They are scrubbed
@@ -121,6 +138,20 @@ type RevisionSpec struct {
 	// +optional
 	ConcurrencyModel RevisionRequestConcurrencyModelType `json:"concurrencyModel,omitempty"`
 
+	// ContainerConcurrency holds the maximum number of requests in flight
+	// to each instance of the Container, up to
+	// RevisionContainerConcurrencyMax. Requests in excess of it are queued
+	// by the instance, and rejected with a 503 once its queue is full.
+	// Zero means no limit, unless the ConcurrencyModel is Single, which
+	// limits it to one.
+	// +optional
+	ContainerConcurrency int64 `json:"containerConcurrency,omitempty"`
+
+	// TimeoutSeconds holds the max duration the instance is allowed for
+	// responding to a request. Zero means no limit.
+	// +optional
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+
 	// ServiceAccountName holds the name of the Kubernetes service account
 	// as which the underlying K8s resources should be run. If unspecified
 	// this will default to the "default" service account for the namespace
@@ -139,6 +170,8 @@ type RevisionSpec struct {
 	// Container defines the unit of execution for this Revision.
 	// In the context of a Revision, we disallow a number of the fields of
 	// this Container, including: name, resources, ports, and volumeMounts.
+	// A single port may only be given a name, which is the
+	// RevisionProtocolType the Container serves.
 	// TODO(mattmoor): Link to the runtime contract tracked by:
 	// https://github.com/knative/serving/issues/627
 	// +optional
@@ -229,6 +262,25 @@ func (r *Revision) GetSpecJSON() ([]byte, error) {
 	return json.Marshal(r.Spec)
 }
 
+// GetProtocol returns the protocol the Revision's Container serves, as
+// named by its port. It defaults to RevisionProtocolHTTP1.
+func (rs *RevisionSpec) GetProtocol() RevisionProtocolType {
+	if ports := rs.Container.Ports; len(ports) > 0 && RevisionProtocolType(ports[0].Name) == RevisionProtocolH2C {
+		return RevisionProtocolH2C
+	}
+	return RevisionProtocolHTTP1
+}
+
+// GetContainerConcurrency returns the maximum number of requests in flight
+// to each instance of the Container: its ContainerConcurrency, or one for
+// the Single concurrency model. Zero means no limit.
+func (rs *RevisionSpec) GetContainerConcurrency() int64 {
+	if rs.ContainerConcurrency == 0 && rs.ConcurrencyModel == RevisionRequestConcurrencyModelSingle {
+		return 1
+	}
+	return rs.ContainerConcurrency
+}
+
 // IsReady looks at the conditions and if the Status has a condition
 // RevisionConditionReady returns true if ConditionStatus is True
 func (rs *RevisionStatus) IsReady() bool {
@@ -37,6 +37,57 @@ func TestGeneration(t *testing.T) {
 
 }
 
+func TestGetProtocol(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		ports []corev1.ContainerPort
+		want  RevisionProtocolType
+	}{{
+		name: "no port",
+		want: RevisionProtocolHTTP1,
+	}, {
+		name:  "http1",
+		ports: []corev1.ContainerPort{{Name: "http1"}},
+		want:  RevisionProtocolHTTP1,
+	}, {
+		name:  "h2c",
+		ports: []corev1.ContainerPort{{Name: "h2c"}},
+		want:  RevisionProtocolH2C,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			rs := &RevisionSpec{Container: corev1.Container{Ports: test.ports}}
+			if got := rs.GetProtocol(); got != test.want {
+				t.Errorf("GetProtocol() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetContainerConcurrency(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		rs   RevisionSpec
+		want int64
+	}{{
+		name: "unset",
+		want: 0,
+	}, {
+		name: "multi",
+		rs:   RevisionSpec{ConcurrencyModel: RevisionRequestConcurrencyModelMulti, ContainerConcurrency: 10},
+		want: 10,
+	}, {
+		name: "single",
+		rs:   RevisionSpec{ConcurrencyModel: RevisionRequestConcurrencyModelSingle},
+		want: 1,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rs.GetContainerConcurrency(); got != test.want {
+				t.Errorf("GetContainerConcurrency() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
 func TestIsActivationRequired(t *testing.T) {
 	cases := []struct {
 		name                 string
@@ -17,21 +17,42 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func (rt *Revision) Validate() *FieldError {
+	if err := validateAnnotations(rt.Annotations); err != nil {
+		return err.ViaField("metadata")
+	}
 	return rt.Spec.Validate().ViaField("spec")
 }
 
 func (rt *RevisionTemplateSpec) Validate() *FieldError {
+	if err := validateAnnotations(rt.Annotations); err != nil {
+		return err.ViaField("metadata")
+	}
 	return rt.Spec.Validate().ViaField("spec")
 }
 
+// validateAnnotations validates the autoscaling annotations of revisions.
+func validateAnnotations(annotations map[string]string) *FieldError {
+	_, err := autoscaling.ParseAnnotations(annotations)
+	if ae, ok := err.(*autoscaling.AnnotationError); ok {
+		fe := errInvalidValue(ae.Value, "annotations."+ae.Key)
+		fe.Details = ae.Reason
+		return fe
+	}
+	return nil
+}
+
 func (rs *RevisionSpec) Validate() *FieldError {
 	if equality.Semantic.DeepEqual(rs, &RevisionSpec{}) {
 		return errMissingField(currentField)
@@ -42,7 +63,30 @@ func (rs *RevisionSpec) Validate() *FieldError {
 	if err := validateContainer(rs.Container); err != nil {
 		return err.ViaField("container")
 	}
-	return rs.ConcurrencyModel.Validate().ViaField("concurrencyModel")
+	if rs.TimeoutSeconds < 0 {
+		return errInvalidValue(strconv.FormatInt(rs.TimeoutSeconds, 10), "timeoutSeconds")
+	}
+	if err := rs.ConcurrencyModel.Validate().ViaField("concurrencyModel"); err != nil {
+		return err
+	}
+	return rs.validateContainerConcurrency()
+}
+
+// validateContainerConcurrency validates that the ContainerConcurrency is
+// within bounds, and agrees with the Single concurrency model.
+func (rs *RevisionSpec) validateContainerConcurrency() *FieldError {
+	cc := rs.ContainerConcurrency
+	if cc < 0 || cc > RevisionContainerConcurrencyMax {
+		fe := errInvalidValue(strconv.FormatInt(cc, 10), "containerConcurrency")
+		fe.Details = fmt.Sprintf("must be from 0 to %d", RevisionContainerConcurrencyMax)
+		return fe
+	}
+	if rs.ConcurrencyModel == RevisionRequestConcurrencyModelSingle && cc > 1 {
+		fe := errInvalidValue(strconv.FormatInt(cc, 10), "containerConcurrency")
+		fe.Details = fmt.Sprintf("must be at most 1 for concurrencyModel %s", RevisionRequestConcurrencyModelSingle)
+		return fe
+	}
+	return nil
 }
 
 func (ss RevisionServingStateType) Validate() *FieldError {
@@ -82,7 +126,7 @@ func validateContainer(container corev1.Container) *FieldError {
 	if !equality.Semantic.DeepEqual(container.Resources, corev1.ResourceRequirements{}) {
 		ignoredFields = append(ignoredFields, "resources")
 	}
-	if len(container.Ports) > 0 {
+	if len(container.Ports) > 0 && !namesProtocolOnly(container.Ports) {
 		ignoredFields = append(ignoredFields, "ports")
 	}
 	if len(container.VolumeMounts) > 0 {
@@ -95,6 +139,13 @@ func validateContainer(container corev1.Container) *FieldError {
 		// Complain about all ignored fields so that user can remove them all at once.
 		return errDisallowedFields(ignoredFields...)
 	}
+	if len(container.Ports) > 0 {
+		switch name := container.Ports[0].Name; RevisionProtocolType(name) {
+		case RevisionProtocolHTTP1, RevisionProtocolH2C:
+		default:
+			return errInvalidValue(name, "ports.name")
+		}
+	}
 	// Validate our probes
 	if err := validateProbe(container.ReadinessProbe); err != nil {
 		return err.ViaField("readinessProbe")
@@ -105,6 +156,12 @@ func validateContainer(container corev1.Container) *FieldError {
 	return nil
 }
 
+// namesProtocolOnly reports whether ports is a single port with nothing
+// but a name, which is the only way a Revision may set ports.
+func namesProtocolOnly(ports []corev1.ContainerPort) bool {
+	return len(ports) == 1 && ports[0] == corev1.ContainerPort{Name: ports[0].Name}
+}
+
 func validateProbe(p *corev1.Probe) *FieldError {
 	if p == nil {
 		return nil
@@ -20,8 +20,10 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -65,6 +67,33 @@ func TestContainerValidation(t *testing.T) {
 			}},
 		},
 		want: errDisallowedFields("ports"),
+	}, {
+		name: "names h2c protocol",
+		c: corev1.Container{
+			Image: "foo",
+			Ports: []corev1.ContainerPort{{
+				Name: "h2c",
+			}},
+		},
+		want: nil,
+	}, {
+		name: "names unknown protocol",
+		c: corev1.Container{
+			Ports: []corev1.ContainerPort{{
+				Name: "spdy",
+			}},
+		},
+		want: errInvalidValue("spdy", "ports.name"),
+	}, {
+		name: "names multiple ports",
+		c: corev1.Container{
+			Ports: []corev1.ContainerPort{{
+				Name: "h2c",
+			}, {
+				Name: "http1",
+			}},
+		},
+		want: errDisallowedFields("ports"),
 	}, {
 		name: "has volumeMounts",
 		c: corev1.Container{
@@ -264,6 +293,52 @@ func TestRevisionSpecValidation(t *testing.T) {
 			ConcurrencyModel: "bogus",
 		},
 		want: errInvalidValue("bogus", "concurrencyModel"),
+	}, {
+		name: "negative timeout",
+		rs: &RevisionSpec{
+			Container: corev1.Container{
+				Image: "helloworld",
+			},
+			TimeoutSeconds: -1,
+		},
+		want: errInvalidValue("-1", "timeoutSeconds"),
+	}, {
+		name: "container concurrency",
+		rs: &RevisionSpec{
+			Container: corev1.Container{
+				Image: "helloworld",
+			},
+			ConcurrencyModel:     "Multi",
+			ContainerConcurrency: 10,
+		},
+		want: nil,
+	}, {
+		name: "container concurrency above max",
+		rs: &RevisionSpec{
+			Container: corev1.Container{
+				Image: "helloworld",
+			},
+			ContainerConcurrency: RevisionContainerConcurrencyMax + 1,
+		},
+		want: &FieldError{
+			Message: `invalid value "1001"`,
+			Paths:   []string{"containerConcurrency"},
+			Details: "must be from 0 to 1000",
+		},
+	}, {
+		name: "container concurrency of single concurrency model",
+		rs: &RevisionSpec{
+			Container: corev1.Container{
+				Image: "helloworld",
+			},
+			ConcurrencyModel:     "Single",
+			ContainerConcurrency: 2,
+		},
+		want: &FieldError{
+			Message: `invalid value "2"`,
+			Paths:   []string{"containerConcurrency"},
+			Details: "must be at most 1 for concurrencyModel Single",
+		},
 	}, {
 		name: "bad container spec",
 		rs: &RevisionSpec{
@@ -317,6 +392,26 @@ func TestRevisionTemplateSpecValidation(t *testing.T) {
 			},
 		},
 		want: errDisallowedFields("spec.container.name"),
+	}, {
+		name: "invalid autoscaling annotation",
+		rts: &RevisionTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					autoscaling.MinScaleAnnotationKey: "none",
+				},
+			},
+			Spec: RevisionSpec{
+				Container: corev1.Container{
+					Image: "helloworld",
+				},
+				ConcurrencyModel: "Multi",
+			},
+		},
+		want: &FieldError{
+			Message: `invalid value "none"`,
+			Paths:   []string{"metadata.annotations." + autoscaling.MinScaleAnnotationKey},
+			Details: "must be a positive integer",
+		},
 	}}
 
 	for _, test := range tests {
@@ -361,6 +456,43 @@ func TestRevisionValidation(t *testing.T) {
 			},
 		},
 		want: errDisallowedFields("spec.container.name"),
+	}, {
+		name: "valid autoscaling annotations",
+		r: &Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					autoscaling.MetricAnnotationKey: autoscaling.RPS,
+					autoscaling.TargetAnnotationKey: "150",
+				},
+			},
+			Spec: RevisionSpec{
+				Container: corev1.Container{
+					Image: "helloworld",
+				},
+				ConcurrencyModel: "Multi",
+			},
+		},
+		want: nil,
+	}, {
+		name: "unknown autoscaling annotation",
+		r: &Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					autoscaling.GroupName + "/minscale": "2",
+				},
+			},
+			Spec: RevisionSpec{
+				Container: corev1.Container{
+					Image: "helloworld",
+				},
+				ConcurrencyModel: "Multi",
+			},
+		},
+		want: &FieldError{
+			Message: `invalid value "2"`,
+			Paths:   []string{"metadata.annotations." + autoscaling.GroupName + "/minscale"},
+			Details: "unknown annotation",
+		},
 	}}
 
 	for _, test := range tests {
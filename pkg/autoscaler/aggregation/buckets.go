@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"sync"
+	"time"
+)
+
+// TimedFloat64Buckets keeps the sums of the samples recorded during each
+// period of a given granularity, for as many periods as fit in a window.
+// It is safe for concurrent use.
+type TimedFloat64Buckets struct {
+	mux         sync.RWMutex
+	granularity time.Duration
+	buckets     []bucket
+}
+
+// A bucket holds the samples of the period with the given index, counted
+// in granularities since the zero Unix time.
+type bucket struct {
+	index int64
+	sum   float64
+}
+
+// NewTimedFloat64Buckets creates a TimedFloat64Buckets holding the samples
+// of the given window, in buckets of the given granularity.
+func NewTimedFloat64Buckets(window, granularity time.Duration) *TimedFloat64Buckets {
+	n := int(window / granularity)
+	if window%granularity != 0 {
+		n++
+	}
+	if n < 1 {
+		n = 1
+	}
+	buckets := make([]bucket, n)
+	for i := range buckets {
+		// No period has a negative index.
+		buckets[i].index = -1
+	}
+	return &TimedFloat64Buckets{
+		granularity: granularity,
+		buckets:     buckets,
+	}
+}
+
+// Record adds the value sampled at time t, as of now. Samples from clocks
+// ahead of now are recorded as of now, and samples older than the window
+// ending at now are dropped. It reports whether the sample was recorded.
+func (t *TimedFloat64Buckets) Record(now, at time.Time, value float64) bool {
+	if at.After(now) {
+		at = now
+	}
+	index, oldest := t.index(at), t.index(now)-int64(len(t.buckets))
+	if index <= oldest {
+		return false
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	b := &t.buckets[index%int64(len(t.buckets))]
+	if b.index > index {
+		// Newer samples took the bucket over while this one was in flight.
+		return false
+	}
+	if b.index < index {
+		*b = bucket{index: index}
+	}
+	b.sum += value
+	return true
+}
+
+// WindowAverage returns the average over the buckets holding samples within
+// the given window ending at now of the sums of their samples, such as the
+// total concurrency of all pods of a revision, and whether there were any.
+// Windows are capped to the one the buckets were created for.
+func (t *TimedFloat64Buckets) WindowAverage(now time.Time, window time.Duration) (float64, bool) {
+	n := int64(window / t.granularity)
+	if n < 1 {
+		n = 1
+	}
+	if n > int64(len(t.buckets)) {
+		n = int64(len(t.buckets))
+	}
+	last := t.index(now)
+
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	var sum float64
+	var buckets int
+	for index := last - n + 1; index <= last; index++ {
+		if index < 0 {
+			continue
+		}
+		if b := t.buckets[index%int64(len(t.buckets))]; b.index == index {
+			sum += b.sum
+			buckets++
+		}
+	}
+	if buckets == 0 {
+		return 0, false
+	}
+	return sum / float64(buckets), true
+}
+
+// index returns the index of the period holding the given time.
+func (t *TimedFloat64Buckets) index(at time.Time) int64 {
+	return at.UnixNano() / int64(t.granularity)
+}
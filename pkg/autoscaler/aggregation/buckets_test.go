@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimedFloat64BucketsWindowAverage(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(5*time.Second, time.Second)
+
+	if _, ok := buckets.WindowAverage(now, 5*time.Second); ok {
+		t.Error("WindowAverage() = _, true, want false without samples")
+	}
+
+	// Two pods report every second, the sum of their concurrency growing
+	// from 2 to 10.
+	for i := 0; i < 5; i++ {
+		at := now.Add(time.Duration(i) * time.Second)
+		buckets.Record(at, at, float64(i+1))
+		buckets.Record(at, at.Add(100*time.Millisecond), float64(i+1))
+	}
+	now = now.Add(4 * time.Second)
+
+	for _, test := range []struct {
+		name   string
+		window time.Duration
+		want   float64
+	}{{
+		name:   "full window",
+		window: 5 * time.Second,
+		want:   6,
+	}, {
+		name:   "shorter window",
+		window: 2 * time.Second,
+		want:   9,
+	}, {
+		name:   "window beyond the buckets",
+		window: time.Minute,
+		want:   6,
+	}, {
+		name:   "window below the granularity",
+		window: time.Millisecond,
+		want:   10,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			if got, ok := buckets.WindowAverage(now, test.window); !ok || got != test.want {
+				t.Errorf("WindowAverage() = %v, %v, want %v, true", got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestTimedFloat64BucketsSkipsGaps(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(10*time.Second, time.Second)
+
+	buckets.Record(now, now, 4)
+	now = now.Add(5 * time.Second)
+	buckets.Record(now, now, 8)
+
+	// Seconds without samples do not pull the average down.
+	if got, ok := buckets.WindowAverage(now, 10*time.Second); !ok || got != 6 {
+		t.Errorf("WindowAverage() = %v, %v, want 6, true", got, ok)
+	}
+}
+
+func TestTimedFloat64BucketsExpiresOldBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(3*time.Second, time.Second)
+
+	buckets.Record(now, now, 100)
+	// Go around the ring, reusing the bucket of the first sample.
+	for i := 1; i <= 3; i++ {
+		buckets.Record(now.Add(time.Duration(i)*time.Second), now.Add(time.Duration(i)*time.Second), 1)
+	}
+	now = now.Add(3 * time.Second)
+
+	if got, ok := buckets.WindowAverage(now, 3*time.Second); !ok || got != 1 {
+		t.Errorf("WindowAverage() = %v, %v, want 1, true", got, ok)
+	}
+
+	// Once the window has passed without samples, there is no data.
+	if _, ok := buckets.WindowAverage(now.Add(time.Minute), 3*time.Second); ok {
+		t.Error("WindowAverage() = _, true, want false once all samples expired")
+	}
+}
+
+func TestTimedFloat64BucketsLateSamples(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(3*time.Second, time.Second)
+
+	// A sample arriving late, but still within the window, is added to the
+	// bucket of the time it was taken.
+	if !buckets.Record(now, now.Add(-2*time.Second), 3) {
+		t.Error("Record() = false for a late sample within the window")
+	}
+	buckets.Record(now, now, 5)
+	if got, ok := buckets.WindowAverage(now, 3*time.Second); !ok || got != 4 {
+		t.Errorf("WindowAverage() = %v, %v, want 4, true", got, ok)
+	}
+
+	// A sample older than the window is dropped.
+	if buckets.Record(now, now.Add(-3*time.Second), 1000) {
+		t.Error("Record() = true for a sample older than the window")
+	}
+	if got, ok := buckets.WindowAverage(now, 3*time.Second); !ok || got != 4 {
+		t.Errorf("WindowAverage() = %v, %v, want 4, true", got, ok)
+	}
+
+	// A sample recorded with an older now than the data in its bucket is
+	// dropped rather than wiping the newer data.
+	later := now.Add(3 * time.Second)
+	buckets.Record(later, later, 7)
+	if buckets.Record(now, now, 1000) {
+		t.Error("Record() = true for a sample whose bucket holds newer samples")
+	}
+	if got, ok := buckets.WindowAverage(later, time.Second); !ok || got != 7 {
+		t.Errorf("WindowAverage() = %v, %v, want 7, true", got, ok)
+	}
+}
+
+func TestTimedFloat64BucketsClockSkew(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(3*time.Second, time.Second)
+
+	// A pod with its clock an hour ahead is recorded as of now, and does
+	// not take over a bucket the window will need later.
+	if !buckets.Record(now, now.Add(time.Hour), 2) {
+		t.Error("Record() = false for a sample from a clock ahead")
+	}
+	buckets.Record(now, now, 4)
+	if got, ok := buckets.WindowAverage(now, time.Second); !ok || got != 6 {
+		t.Errorf("WindowAverage() = %v, %v, want 6, true", got, ok)
+	}
+
+	for i := 1; i <= 3; i++ {
+		at := now.Add(time.Duration(i) * time.Second)
+		if !buckets.Record(at, at, 1) {
+			t.Errorf("Record() = false at %v after a sample from a clock ahead", at)
+		}
+	}
+	if got, ok := buckets.WindowAverage(now.Add(3*time.Second), 3*time.Second); !ok || got != 1 {
+		t.Errorf("WindowAverage() = %v, %v, want 1, true", got, ok)
+	}
+}
+
+func TestTimedFloat64BucketsConcurrentUse(t *testing.T) {
+	now := time.Unix(1000, 0)
+	buckets := NewTimedFloat64Buckets(time.Minute, time.Second)
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				buckets.Record(now, now, 1)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+
+	if got, ok := buckets.WindowAverage(now, time.Minute); !ok || got != 1000 {
+		t.Errorf("WindowAverage() = %v, %v, want 1000, true", got, ok)
+	}
+}
@@ -18,10 +18,13 @@ package autoscaler
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/logging"
 )
@@ -40,6 +43,10 @@ type Stat struct {
 
 	// Number of requests received since last Stat (approximately QPS).
 	RequestCount int32
+
+	// Most requests waiting at once since last Stat for the revision to
+	// have an active endpoint. Only reported by the activator.
+	PendingRequests int32
 }
 
 // StatMessage wraps a Stat with identifying information so it can be routed
@@ -54,27 +61,43 @@ type statKey struct {
 	time    time.Time
 }
 
-// Creates a new totalAggregation
-func newTotalAggregation() *totalAggregation {
+// Creates a new totalAggregation over the window ending at now. Stats are
+// weighted by the time they cover, decaying by half every halfLife when it
+// is positive.
+func newTotalAggregation(window time.Duration, now time.Time, halfLife time.Duration) *totalAggregation {
 	return &totalAggregation{
+		start:              now.Add(-window),
+		end:                now,
+		halfLife:           halfLife,
 		perPodAggregations: make(map[string]*perPodAggregation),
 	}
 }
 
 // Holds an aggregation across all pods
 type totalAggregation struct {
+	start              time.Time
+	end                time.Time
+	halfLife           time.Duration
 	perPodAggregations map[string]*perPodAggregation
 	probeCount         int32
 }
 
-// Aggregates a given stat to the correct pod-aggregation
+// Aggregates a given stat within the window to the correct pod-aggregation.
+// Stats from pods with clocks ahead are taken as of the end of the window.
 func (agg *totalAggregation) aggregate(stat Stat) {
+	t := *stat.Time
+	if !t.After(agg.start) {
+		return
+	}
+	if t.After(agg.end) {
+		t = agg.end
+	}
 	current, exists := agg.perPodAggregations[stat.PodName]
 	if !exists {
 		current = &perPodAggregation{}
 		agg.perPodAggregations[stat.PodName] = current
 	}
-	current.aggregate(stat.AverageConcurrentRequests)
+	current.aggregate(t, stat)
 	agg.probeCount += 1
 }
 
@@ -86,33 +109,104 @@ func (agg *totalAggregation) observedPods() int {
 // The observed concurrency per pod (sum of all average concurrencies
 // distributed over the observed pods)
 func (agg *totalAggregation) observedConcurrencyPerPod() float64 {
-	accumulatedConcurrency := float64(0)
+	return agg.averagePerPod(func(s sample) float64 { return s.concurrency })
+}
+
+// The observed requests per second per pod (sum of all average request
+// counts, each covering about a second, distributed over the observed pods)
+func (agg *totalAggregation) observedRequestsPerSecondPerPod() float64 {
+	return agg.averagePerPod(func(s sample) float64 { return s.requests })
+}
+
+// averagePerPod sums the averages of the given value of the samples of
+// each pod, and distributes it over the observed pods.
+func (agg *totalAggregation) averagePerPod(value func(sample) float64) float64 {
+	accumulated := float64(0)
 	for _, perPod := range agg.perPodAggregations {
-		accumulatedConcurrency += perPod.calculateAverage()
+		accumulated += perPod.calculateAverage(agg, value)
 	}
-	return accumulatedConcurrency / float64(agg.observedPods())
+	return accumulated / float64(agg.observedPods())
+}
+
+// weight returns the weight of the stats covering the time from a to b.
+func (agg *totalAggregation) weight(a, b time.Time) float64 {
+	if agg.halfLife <= 0 {
+		return float64(b.Sub(a))
+	}
+	// The integral of 2^(-age/halfLife) over the ages from b to a.
+	h := float64(agg.halfLife)
+	decay := func(t time.Time) float64 {
+		return math.Exp2(-float64(agg.end.Sub(t)) / h)
+	}
+	return h / math.Ln2 * (decay(b) - decay(a))
 }
 
 // Hols an aggregation per pod
 type perPodAggregation struct {
-	accumulatedConcurrency float64
-	probeCount             int32
+	samples []sample
 }
 
-// Aggregates the given concurrency
-func (agg *perPodAggregation) aggregate(concurrency float64) {
-	agg.accumulatedConcurrency += concurrency
-	agg.probeCount += 1
+// A concurrency and request count observed by a pod at a time.
+type sample struct {
+	time        time.Time
+	concurrency float64
+	requests    float64
+}
+
+// Aggregates the concurrency and request count of the given stat, taken as
+// of t
+func (agg *perPodAggregation) aggregate(t time.Time, stat Stat) {
+	agg.samples = append(agg.samples, sample{
+		time:        t,
+		concurrency: stat.AverageConcurrentRequests,
+		requests:    float64(stat.RequestCount),
+	})
+}
+
+// Calculates the average of the given value, weighting every value by the time
+// since the previous stat of the pod, which it covers. A stat following a
+// gap in reporting thus stands for the whole gap rather than for a single
+// period. The first stat covers the average period of the pod.
+func (agg *perPodAggregation) calculateAverage(total *totalAggregation, value func(sample) float64) float64 {
+	n := len(agg.samples)
+	sort.Slice(agg.samples, func(i, j int) bool {
+		return agg.samples[i].time.Before(agg.samples[j].time)
+	})
+	first, last := agg.samples[0].time, agg.samples[n-1].time
+	if n == 1 || !last.After(first) {
+		sum := float64(0)
+		for _, s := range agg.samples {
+			sum += value(s)
+		}
+		return sum / float64(n)
+	}
+	period := last.Sub(first) / time.Duration(n-1)
+
+	var accumulatedValue, accumulatedWeight float64
+	from := first.Add(-period)
+	for _, s := range agg.samples {
+		w := total.weight(from, s.time)
+		accumulatedValue += value(s) * w
+		accumulatedWeight += w
+		from = s.time
+	}
+	return accumulatedValue / accumulatedWeight
 }
 
-// Calculates the average concurrency over all values given
-func (agg *perPodAggregation) calculateAverage() float64 {
-	return agg.accumulatedConcurrency / float64(agg.probeCount)
+// A desired scale and the time it was computed at.
+type timedScale struct {
+	time  time.Time
+	scale int32
 }
 
 // Autoscaler stores current state of an instance of an autoscaler
 type Autoscaler struct {
 	*Config
+	// config is the Config as set, before the windows of the revision
+	// override those of the embedded one.
+	config                       *Config
+	stableWindow                 time.Duration
+	panicWindow                  time.Duration
 	stats                        map[statKey]Stat
 	statsMutex                   sync.Mutex
 	model                        v1alpha1.RevisionRequestConcurrencyModelType
@@ -122,20 +216,147 @@ type Autoscaler struct {
 	reporter                     StatsReporter
 	lastRequestTime              time.Time
 	scaleToZeroThresholdExceeded bool
+	minScale                     int32
+	maxScale                     int32
+	recentScales                 []timedScale
+	excessBurstCapacity          float64
+	activatorInPath              bool
+	activatorNeededTime          *time.Time
+	initialScale                 int32
+	receivedTraffic              bool
+	activationScale              int32
+	activationTime               *time.Time
+	minScaleSchedule             autoscaling.MinScaleSchedule
+	decision                     Decision
+	scalerName                   string
+	scaler                       Scaler
+	target                       float64
+	metricSource                 MetricSource
+	pendingRequests              int32
+	predictionHorizon            time.Duration
+	predictor                    *predictor
+	predictedPodCount            float64
 }
 
 // New creates a new instance of autoscaler
 func New(config *Config, model v1alpha1.RevisionRequestConcurrencyModelType, reporter StatsReporter) *Autoscaler {
 	return &Autoscaler{
 		Config:                       config,
+		config:                       config,
 		model:                        model,
 		stats:                        make(map[statKey]Stat),
 		reporter:                     reporter,
 		lastRequestTime:              time.Now(),
 		scaleToZeroThresholdExceeded: false,
+		scalerName:                   autoscaling.Concurrency,
+		scaler:                       ScalerFunc(scaleOnConcurrency),
 	}
 }
 
+// SetConfig replaces the configuration the autoscaler scales with from the
+// next proposal on.
+func (a *Autoscaler) SetConfig(config *Config) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.config = config
+	a.Config = a.windowed(config)
+}
+
+// SetWindows scales the revision over the given stable and panic windows in
+// place of those of its Config, unless zero. A panic window above the stable
+// window is cut down to it.
+func (a *Autoscaler) SetWindows(stableWindow, panicWindow time.Duration) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.stableWindow = stableWindow
+	a.panicWindow = panicWindow
+	a.Config = a.windowed(a.config)
+}
+
+// windowed returns config with its windows overridden by those of the
+// revision, or config itself when they are not.
+func (a *Autoscaler) windowed(config *Config) *Config {
+	if a.stableWindow == 0 && a.panicWindow == 0 {
+		return config
+	}
+	c := *config
+	if a.stableWindow > 0 {
+		c.StableWindow = a.stableWindow
+	}
+	if a.panicWindow > 0 {
+		c.PanicWindow = a.panicWindow
+	}
+	if c.PanicWindow > c.StableWindow {
+		c.PanicWindow = c.StableWindow
+	}
+	return &c
+}
+
+// SetScaleBounds keeps the desired scale at or above minScale and at or
+// below maxScale, unless zero, and the revision from scaling to zero while
+// minScale is not.
+func (a *Autoscaler) SetScaleBounds(minScale, maxScale int32) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.minScale = minScale
+	a.maxScale = maxScale
+}
+
+// SetInitialScale keeps the desired scale at or above the given number of
+// pods until the revision receives traffic.
+func (a *Autoscaler) SetInitialScale(scale int32) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.initialScale = scale
+}
+
+// SetActivationScale keeps the desired scale at or above the given number of
+// pods for a stable window after the revision is activated from zero.
+func (a *Autoscaler) SetActivationScale(scale int32) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.activationScale = scale
+}
+
+// SetMinScaleSchedule keeps the desired scale at or above the scale of the
+// open windows of the given schedule, and the revision from scaling to zero
+// while they are.
+func (a *Autoscaler) SetMinScaleSchedule(schedule autoscaling.MinScaleSchedule) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.minScaleSchedule = schedule
+}
+
+// SetScaler replaces the concurrency Scaler the desired scale is computed
+// with by the given one, registered under name, scaling to the given
+// target, or its own when zero.
+func (a *Autoscaler) SetScaler(name string, scaler Scaler, target float64) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.scalerName = name
+	a.scaler = scaler
+	a.target = target
+}
+
+// SetMetricSource makes the Scaler scale on the value of the given source
+// along with the stats of the pods. Revisions with a metric source are
+// scaled up from zero on its value alone, for their pods to serve no
+// requests, and do not panic.
+func (a *Autoscaler) SetMetricSource(source MetricSource) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.metricSource = source
+}
+
+// SetPrediction scales the revision up ahead of the traffic forecast over
+// the given horizon. The revision is not scaled on a forecast when the
+// horizon is zero.
+func (a *Autoscaler) SetPrediction(horizon time.Duration) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	a.predictionHorizon = horizon
+}
+
 // Record a data point.
 func (a *Autoscaler) Record(ctx context.Context, stat Stat) {
 	if stat.Time == nil {
@@ -146,9 +367,11 @@ func (a *Autoscaler) Record(ctx context.Context, stat Stat) {
 	a.statsMutex.Lock()
 	defer a.statsMutex.Unlock()
 
+	// Key on the time in UTC, so that the same stat pushed by a pod and
+	// scraped from it is only recorded once.
 	key := statKey{
 		podName: stat.PodName,
-		time:    *stat.Time,
+		time:    stat.Time.UTC(),
 	}
 	a.stats[key] = stat
 }
@@ -156,14 +379,17 @@ func (a *Autoscaler) Record(ctx context.Context, stat Stat) {
 // Scale calculates the desired scale based on current statistics given the current time.
 func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 	logger := logging.FromContext(ctx)
+	// Query the metric source before locking, for stats to be recorded
+	// meanwhile.
+	metricValue, hasSource, err := a.metricSourceValue()
 	a.statsMutex.Lock()
 	defer a.statsMutex.Unlock()
 
 	// 60 second window
-	stableData := newTotalAggregation()
+	stableData := newTotalAggregation(a.StableWindow, now, a.StatDecayHalfLife)
 
 	// 6 second window
-	panicData := newTotalAggregation()
+	panicData := newTotalAggregation(a.PanicWindow, now, a.StatDecayHalfLife)
 
 	// Last stat per Pod
 	lastStat := make(map[string]Stat)
@@ -171,11 +397,9 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 	// accumulate stats into their respective buckets
 	for key, stat := range a.stats {
 		instant := key.time
-		if instant.Add(a.PanicWindow).After(now) {
-			panicData.aggregate(stat)
-		}
 		if instant.Add(a.StableWindow).After(now) {
 			stableData.aggregate(stat)
+			panicData.aggregate(stat)
 
 			// If there's no last stat for this pod, set it
 			if _, ok := lastStat[stat.PodName]; !ok {
@@ -188,8 +412,7 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 			// Update lastRequestTime if the current stat is newer and
 			// actually contains requests
 			if a.lastRequestTime.Before(*stat.Time) && stat.RequestCount > 0 {
-				a.lastRequestTime = *stat.Time
-				a.scaleToZeroThresholdExceeded = false
+				a.requested(*stat.Time)
 			}
 		} else {
 			// Drop metrics after 60 seconds
@@ -197,17 +420,57 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 		}
 	}
 
-	// Scale to zero if the last request is from too long ago
-	if !a.scaleToZeroThresholdExceeded && a.lastRequestTime.Add(a.ScaleToZeroThreshold).Before(now) {
+	// Requests pending on the activator, as last reported by each of its
+	// pods within the panic window.
+	a.pendingRequests = 0
+	a.predictedPodCount = 0
+	for _, stat := range lastStat {
+		if stat.Time.Add(a.PanicWindow).After(now) {
+			a.pendingRequests += stat.PendingRequests
+		}
+	}
+
+	// Revisions scaled on a metric source are in demand as long as its
+	// value is positive.
+	if hasSource {
+		if err != nil {
+			logger.Errorf("Error getting the value of the metric source: %v", err)
+			return a.decided(now, Decision{Reason: DecisionNoData})
+		}
+		if metricValue > 0 {
+			a.requested(now)
+		}
+	}
+
+	// Scale to zero if the last request is from too long ago, unless the
+	// revision has a min scale or a window of the min scale schedule is
+	// open. Then the threshold is checked again once it closes.
+	scheduledScale := a.minScaleSchedule.MinScale(now)
+	if scheduledScale > 0 || a.minScale > 0 {
+		a.scaleToZeroThresholdExceeded = false
+	} else if !a.scaleToZeroThresholdExceeded && a.lastRequestTime.Add(a.ScaleToZeroThreshold).Before(now) {
 		logger.Debug("Last request is older than scale to zero threshold. Scaling to 0.")
 		a.scaleToZeroThresholdExceeded = true
-		return 0, true
+		a.recentScales = nil
+		a.predictor = nil
+		return a.decided(now, Decision{Reason: DecisionScaleToZero, DesiredScale: 0, Scaled: true})
 	}
 
-	// Do nothing when we have no data.
-	if stableData.observedPods() == 0 {
+	// Scale to the min scale schedule or the min scale, or do nothing, when
+	// we have no data. Revisions scaled on a metric source scale on its
+	// value without stats, unless scaled to zero.
+	noData := stableData.observedPods() == 0 && (!hasSource || a.scaleToZeroThresholdExceeded)
+	if noData && scheduledScale > 0 && scheduledScale >= a.minScale {
+		logger.Debugf("No data to scale on. Scaling to the scheduled minimum scale of %d.", scheduledScale)
+		return a.decided(now, a.adjust(now, Decision{}, DecisionScheduled, scheduledScale))
+	}
+	if noData && a.minScale > 0 {
+		logger.Debugf("No data to scale on. Scaling to the minimum scale of %d.", a.minScale)
+		return a.decided(now, a.adjust(now, Decision{}, DecisionMinScale, a.minScale))
+	}
+	if noData {
 		logger.Debug("No data to scale on.")
-		return 0, false
+		return a.decided(now, Decision{Reason: DecisionNoData})
 	}
 
 	// Log system totals
@@ -219,20 +482,34 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 	}
 	logger.Debugf("Current QPS: %v  Current concurrent clients: %v", totalCurrentQPS, totalCurrentConcurrency)
 
-	observedStableConcurrencyPerPod := stableData.observedConcurrencyPerPod()
-	observedPanicConcurrencyPerPod := panicData.observedConcurrencyPerPod()
-	// Desired scaling ratio is observed concurrency over desired (stable) concurrency.
-	// Rate limited to within MaxScaleUpRate.
-	desiredStableScalingRatio := a.rateLimited(observedStableConcurrencyPerPod / a.TargetConcurrency(a.model))
-	desiredPanicScalingRatio := a.rateLimited(observedPanicConcurrencyPerPod / a.TargetConcurrency(a.model))
-
-	desiredStablePodCount := desiredStableScalingRatio * float64(stableData.observedPods())
-	desiredPanicPodCount := desiredPanicScalingRatio * float64(stableData.observedPods())
+	stableSnapshot := newSnapshot(a.StableWindow, stableData, metricValue)
+	panicSnapshot := newSnapshot(a.PanicWindow, panicData, metricValue)
+	observedStableConcurrencyPerPod := stableSnapshot.ConcurrencyPerPod
+	observedPanicConcurrencyPerPod := panicSnapshot.ConcurrencyPerPod
+	// The Scaler computes the desired pod count from the observed pods of
+	// the stable window. Rate limited to within MaxScaleUpRate and
+	// MaxScaleDownRate.
+	currentScale := float64(stableData.observedPods())
+	spec := a.scalerSpec()
+	desiredStablePodCount := a.rateLimited(a.scaler.DesiredScale(stableSnapshot, currentScale, spec), currentScale)
+	desiredPanicPodCount := a.rateLimited(a.scaler.DesiredScale(panicSnapshot, currentScale, spec), currentScale)
+	a.predictedPodCount = a.predict(now, a.scaler.DesiredScale(panicSnapshot, currentScale, spec), currentScale)
+
+	a.excessBurstCapacity = a.calculateExcessBurstCapacity(panicData)
+	logger.Debugf("Excess burst capacity: %0.3f", a.excessBurstCapacity)
+	a.activatorInPath = a.holdActivatorInPath(now)
 
 	a.reporter.Report(ObservedPodCountM, float64(stableData.observedPods()))
 	a.reporter.Report(ObservedStableConcurrencyM, observedStableConcurrencyPerPod)
 	a.reporter.Report(ObservedPanicConcurrencyM, observedPanicConcurrencyPerPod)
-	a.reporter.Report(TargetConcurrencyM, a.TargetConcurrency(a.model))
+	a.reporter.Report(TargetConcurrencyM, a.targetConcurrency())
+	a.reporter.Report(ExcessBurstCapacityM, a.excessBurstCapacity)
+
+	decision := Decision{
+		Stable:      newWindowDecision(stableSnapshot, stableData, desiredStablePodCount),
+		Panic:       newWindowDecision(panicSnapshot, panicData, desiredPanicPodCount),
+		MetricValue: metricValue,
+	}
 
 	logger.Debugf("STABLE: Observed average %0.3f concurrency over %v seconds over %v samples over %v pods.",
 		observedStableConcurrencyPerPod, a.StableWindow, stableData.probeCount, stableData.observedPods())
@@ -248,8 +525,12 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 		a.maxPanicPods = 0
 	}
 
-	// Begin panicking when we cross the 6 second concurrency threshold.
-	if !a.panicking && panicData.observedPods() > 0 && observedPanicConcurrencyPerPod >= (a.TargetConcurrency(a.model)*2) {
+	// Begin panicking when the 6 second window calls for panic threshold
+	// times the capacity of a pod, regardless of the target utilization.
+	// The value of a metric source is not windowed.
+	capacity := spec
+	capacity.Utilization = 1
+	if !a.panicking && !hasSource && panicData.observedPods() > 0 && a.scaler.DesiredScale(panicSnapshot, 1, capacity) >= a.panicThreshold() {
 		logger.Info("PANICKING")
 		a.reporter.Report(PanicM, 1)
 		a.panicking = true
@@ -263,15 +544,285 @@ func (a *Autoscaler) Scale(ctx context.Context, now time.Time) (int32, bool) {
 			a.panicTime = &now
 			a.maxPanicPods = desiredPanicPodCount
 		}
-		return int32(math.Max(1.0, math.Ceil(a.maxPanicPods))), true
+		return a.decided(now, a.adjust(now, decision, DecisionPanic, int32(math.Max(1.0, math.Ceil(a.maxPanicPods)))))
 	}
 	logger.Debug("Operating in stable mode.")
-	return int32(math.Max(1.0, math.Ceil(desiredStablePodCount))), true
+	return a.decided(now, a.adjust(now, decision, DecisionStable, int32(math.Max(1.0, math.Ceil(desiredStablePodCount)))))
+}
+
+// newSnapshot returns the snapshot of the stats aggregated over the window,
+// and of the value of the metric source.
+func newSnapshot(window time.Duration, agg *totalAggregation, metricValue float64) Snapshot {
+	snapshot := Snapshot{
+		Window:       window,
+		ObservedPods: agg.observedPods(),
+		MetricValue:  metricValue,
+	}
+	if snapshot.ObservedPods > 0 {
+		snapshot.ConcurrencyPerPod = agg.observedConcurrencyPerPod()
+		snapshot.RequestsPerSecondPerPod = agg.observedRequestsPerSecondPerPod()
+	}
+	return snapshot
+}
+
+// metricSourceValue returns the value of the metric source, and whether
+// the revision is scaled on one.
+func (a *Autoscaler) metricSourceValue() (float64, bool, error) {
+	a.statsMutex.Lock()
+	source := a.metricSource
+	a.statsMutex.Unlock()
+	if source == nil {
+		return 0, false, nil
+	}
+	value, err := source.Value()
+	return value, true, err
+}
+
+// requested records that the revision was in demand at t, activating it
+// if it was scaled to zero.
+func (a *Autoscaler) requested(t time.Time) {
+	if a.scaleToZeroThresholdExceeded && a.EnableScaleToZero {
+		// Traffic returned to a revision scaled to zero.
+		activationTime := t
+		a.activationTime = &activationTime
+	}
+	a.lastRequestTime = t
+	a.scaleToZeroThresholdExceeded = false
+	a.receivedTraffic = true
+}
+
+// scalerSpec returns the spec of the revision passed to the Scaler.
+func (a *Autoscaler) scalerSpec() ScalerSpec {
+	spec := ScalerSpec{
+		Config:      a.Config,
+		Model:       a.model,
+		Target:      a.target,
+		Utilization: a.TargetUtilization,
+	}
+	if spec.Utilization <= 0 {
+		spec.Utilization = 1
+	}
+	return spec
+}
+
+// newWindowDecision describes the snapshot of the stats aggregated over a
+// window, and the scale they call for. Windows without stats call for none.
+func newWindowDecision(snapshot Snapshot, agg *totalAggregation, desiredPodCount float64) WindowDecision {
+	d := WindowDecision{
+		Window:       snapshot.Window.String(),
+		Samples:      agg.probeCount,
+		ObservedPods: snapshot.ObservedPods,
+	}
+	if d.ObservedPods > 0 {
+		d.ObservedConcurrencyPerPod = snapshot.ConcurrencyPerPod
+		d.ObservedRequestsPerSecondPerPod = snapshot.RequestsPerSecondPerPod
+		d.DesiredPodCount = desiredPodCount
+	}
+	return d
+}
+
+// adjust returns the decision of the given reason for the given scale, once
+// delayed, raised to the pods the requests pending on the activator need,
+// raised to the pods forecast, raised to the minimum scale and capped at
+// the max scale.
+func (a *Autoscaler) adjust(now time.Time, d Decision, reason string, scale int32) Decision {
+	d.Reason = reason
+	d.Scaled = true
+	delayed := a.delayScaleDown(now, scale)
+	if delayed > scale {
+		d.Adjustments = append(d.Adjustments, fmt.Sprintf("held at %d by the scale down delay of %v", delayed, a.ScaleDownDelay))
+	}
+	raised := delayed
+	if target := a.targetConcurrency(); a.pendingRequests > 0 && target > 0 {
+		if backlog := int32(math.Ceil(float64(a.pendingRequests) / target)); backlog > raised {
+			raised = backlog
+			d.Adjustments = append(d.Adjustments, fmt.Sprintf("raised to %d for the %d requests pending on the activator", raised, a.pendingRequests))
+		}
+	}
+	if predicted := int32(math.Ceil(a.predictedPodCount)); predicted > raised {
+		raised = predicted
+		d.Adjustments = append(d.Adjustments, fmt.Sprintf("raised to %d ahead of the traffic forecast %v from now", raised, a.predictionHorizon))
+	}
+	d.DesiredScale = a.holdMinimumScale(now, raised)
+	if d.DesiredScale > raised {
+		d.Adjustments = append(d.Adjustments, fmt.Sprintf("raised to the minimum scale of %d", d.DesiredScale))
+	}
+	if a.maxScale > 0 && d.DesiredScale > a.maxScale {
+		d.DesiredScale = a.maxScale
+		d.Adjustments = append(d.Adjustments, fmt.Sprintf("capped at the max scale of %d", a.maxScale))
+	}
+	return d
 }
 
-func (a *Autoscaler) rateLimited(desiredRate float64) float64 {
-	if desiredRate > a.MaxScaleUpRate {
-		return a.MaxScaleUpRate
+// decided records d as the last decision, taken at now, and returns its
+// scale.
+func (a *Autoscaler) decided(now time.Time, d Decision) (int32, bool) {
+	d.Time = now
+	d.Scaler = a.scalerName
+	d.Panicking = a.panicking
+	d.TargetConcurrency = a.targetConcurrency()
+	d.ExcessBurstCapacity = a.excessBurstCapacity
+	d.PendingRequests = a.pendingRequests
+	d.PredictedPodCount = a.predictedPodCount
+	a.decision = d
+	return d.DesiredScale, d.Scaled
+}
+
+// holdMinimumScale returns the desired scale, raised to the min scale, to
+// the initial scale until the revision receives traffic, to the activation
+// scale for a stable window after it is activated from zero, and to the
+// scale of the open windows of the min scale schedule.
+func (a *Autoscaler) holdMinimumScale(now time.Time, desired int32) int32 {
+	if desired < a.minScale {
+		desired = a.minScale
+	}
+	if scheduled := a.minScaleSchedule.MinScale(now); desired < scheduled {
+		desired = scheduled
+	}
+	if !a.receivedTraffic && desired < a.initialScale {
+		desired = a.initialScale
+	}
+	if a.activationTime != nil && a.activationTime.Add(a.StableWindow).After(now) && desired < a.activationScale {
+		desired = a.activationScale
+	}
+	return desired
+}
+
+// ExcessBurstCapacity returns the spare capacity, in concurrent requests,
+// of the revision's pods beyond the target burst capacity as of the last
+// Scale. It is negative when the activator is needed in the data path.
+func (a *Autoscaler) ExcessBurstCapacity() float64 {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	return a.excessBurstCapacity
+}
+
+// ActivatorInPath reports whether the activator should stay in the data
+// path as of the last Scale.
+func (a *Autoscaler) ActivatorInPath() bool {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	return a.activatorInPath
+}
+
+// holdActivatorInPath returns whether the activator should stay in the
+// data path: while the excess burst capacity is negative, and for a stable
+// window after, so that the routes of a revision hovering around its
+// target burst capacity do not flip back and forth.
+func (a *Autoscaler) holdActivatorInPath(now time.Time) bool {
+	if a.excessBurstCapacity < 0 {
+		a.activatorNeededTime = &now
+		return true
+	}
+	return a.activatorNeededTime != nil && now.Before(a.activatorNeededTime.Add(a.StableWindow))
+}
+
+// calculateExcessBurstCapacity returns the capacity of the pods observed
+// over the panic window, less the concurrency they handled and the target
+// burst capacity.
+func (a *Autoscaler) calculateExcessBurstCapacity(panicData *totalAggregation) float64 {
+	switch a.TargetBurstCapacity {
+	case 0:
+		return 0
+	case -1:
+		return -1
+	}
+	pods := float64(panicData.observedPods())
+	if pods == 0 {
+		return -a.TargetBurstCapacity
+	}
+	capacity := pods * a.concurrencyTarget()
+	return capacity - panicData.observedConcurrencyPerPod()*pods - a.TargetBurstCapacity
+}
+
+// delayScaleDown records the desired scale and returns the highest scale
+// desired over the last ScaleDownDelay.
+func (a *Autoscaler) delayScaleDown(now time.Time, desired int32) int32 {
+	if a.ScaleDownDelay <= 0 {
+		return desired
+	}
+	cutoff := now.Add(-a.ScaleDownDelay)
+	i := 0
+	for i < len(a.recentScales) && !a.recentScales[i].time.After(cutoff) {
+		i++
+	}
+	a.recentScales = append(a.recentScales[i:], timedScale{time: now, scale: desired})
+	max := desired
+	for _, s := range a.recentScales {
+		if s.scale > max {
+			max = s.scale
+		}
+	}
+	return max
+}
+
+// concurrencyTarget is the concurrency a pod handles at capacity: the
+// target of revisions scaled on concurrency that set one, or the target
+// concurrency of the model.
+func (a *Autoscaler) concurrencyTarget() float64 {
+	if a.scalerName == autoscaling.Concurrency && a.target > 0 {
+		return a.target
+	}
+	return a.TargetConcurrency(a.model)
+}
+
+// targetConcurrency is the concurrency per pod the autoscaler scales to: the
+// concurrency target, reduced by the target utilization.
+func (a *Autoscaler) targetConcurrency() float64 {
+	if a.TargetUtilization <= 0 {
+		return a.concurrencyTarget()
+	}
+	return a.concurrencyTarget() * a.TargetUtilization
+}
+
+// panicThreshold returns the PanicThreshold of the config, or the
+// default for configs not setting one.
+func (a *Autoscaler) panicThreshold() float64 {
+	if a.PanicThreshold <= 0 {
+		return DefaultPanicThreshold
+	}
+	return a.PanicThreshold
+}
+
+// rateLimited returns the desired pod count, limited to MaxScaleUpRate
+// times the current one, and to the current one divided by
+// MaxScaleDownRate when it is set.
+func (a *Autoscaler) rateLimited(desired, current float64) float64 {
+	desired = math.Min(desired, a.MaxScaleUpRate*current)
+	if a.MaxScaleDownRate > 0 {
+		desired = math.Max(desired, current/a.MaxScaleDownRate)
+	}
+	return desired
+}
+
+// predict observes the pod count the panic window calls for, and returns
+// that forecast over the prediction horizon, rate limited and bounded by
+// the max scale. It is zero for revisions not scaled on a forecast, and
+// until there is a trend.
+func (a *Autoscaler) predict(now time.Time, desired, current float64) float64 {
+	if a.predictionHorizon <= 0 {
+		return 0
+	}
+	levelSmoothing, trendSmoothing := a.PredictionLevelSmoothing, a.PredictionTrendSmoothing
+	if levelSmoothing <= 0 {
+		levelSmoothing = DefaultPredictionLevelSmoothing
+	}
+	if trendSmoothing <= 0 {
+		trendSmoothing = DefaultPredictionTrendSmoothing
+	}
+	if a.predictor == nil {
+		a.predictor = newPredictor(levelSmoothing, trendSmoothing)
+	}
+	// Apply changes of the config to the forecast from now on.
+	a.predictor.levelSmoothing, a.predictor.trendSmoothing = levelSmoothing, trendSmoothing
+	a.predictor.observe(now, desired)
+	forecast, ok := a.predictor.forecast(now.Add(a.predictionHorizon))
+	if !ok || forecast <= 0 {
+		return 0
+	}
+	forecast = a.rateLimited(forecast, current)
+	if a.maxScale > 0 {
+		forecast = math.Min(forecast, float64(a.maxScale))
 	}
-	return desiredRate
+	return forecast
 }
@@ -18,9 +18,12 @@ package autoscaler
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 
 	. "github.com/knative/serving/pkg/logging/testing"
@@ -153,6 +156,43 @@ func TestAutoscaler_PanicMode_DoublePodCount(t *testing.T) {
 	a.expectScale(t, now, 20, true)
 }
 
+func TestAutoscaler_PanicThreshold(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.PanicThreshold = 3.0
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 10,
+			endConcurrency:   10,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	// Twice the capacity is not enough to panic anymore.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 20,
+			endConcurrency:   20,
+			durationSeconds:  6,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 11, true)
+
+	// Three times the capacity is.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 30,
+			endConcurrency:   30,
+			durationSeconds:  6,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 30, true)
+}
+
 // QPS is increasing exponentially. Each scaling event bring concurrency
 // back to the target level (1.0) but then traffic continues to increase.
 // At 1296 QPS traffic stablizes.
@@ -254,6 +294,422 @@ func TestAutoscaler_PanicThenUnPanic_ScaleDown(t *testing.T) {
 	a.expectScale(t, now, 10, true) // back to stable mode
 }
 
+func TestAutoscaler_ScaleDownDelay(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.ScaleDownDelay = 90 * time.Second
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 15,
+			endConcurrency:   15,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 15, true)
+
+	// Traffic drops off, but the burst is still within the delay.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         15,
+		})
+	a.expectScale(t, now, 15, true)
+
+	// Once the burst is older than the delay the revision scales down.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         15,
+		})
+	a.expectScale(t, now, 8, true)
+}
+
+func TestAutoscaler_ExcessBurstCapacity(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.TargetBurstCapacity = 30
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 5, true)
+	a.expectExcessBurstCapacity(t, 20)
+
+	// The spare capacity of the pods no longer covers the target burst capacity.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 8,
+			endConcurrency:   8,
+			durationSeconds:  10,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 6, true)
+	a.expectExcessBurstCapacity(t, -10)
+}
+
+func TestAutoscaler_ActivatorInPathHeldForStableWindow(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.TargetBurstCapacity = 30
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 8,
+			endConcurrency:   8,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.Scale(TestContextWithLogger(t), now)
+	a.expectActivatorInPath(t, true)
+
+	// The spare capacity covers the target burst capacity again, but only
+	// for less than a stable window.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  30,
+			podCount:         10,
+		})
+	a.Scale(TestContextWithLogger(t), now)
+	a.expectExcessBurstCapacity(t, 20)
+	a.expectActivatorInPath(t, true)
+
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  31,
+			podCount:         10,
+		})
+	a.Scale(TestContextWithLogger(t), now)
+	a.expectActivatorInPath(t, false)
+}
+
+func TestAutoscaler_ExcessBurstCapacityActivatorAlwaysInPath(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.TargetBurstCapacity = -1
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 1, true)
+	a.expectExcessBurstCapacity(t, -1)
+}
+
+func TestAutoscaler_InitialScale_HeldUntilTraffic(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.SetInitialScale(5)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 0,
+			endConcurrency:   0,
+			durationSeconds:  60,
+			podCount:         5,
+		})
+	a.expectScale(t, now, 5, true)
+
+	// Once traffic arrives the revision scales on its load alone.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         5,
+		})
+	a.expectScale(t, now, 1, true)
+}
+
+func TestAutoscaler_ActivationScale_HeldAfterScaleFromZero(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.EnableScaleToZero = true
+	a.SetActivationScale(5)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 1, true)
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 0,
+			endConcurrency:   0,
+			durationSeconds:  300, // 5 minutes
+			podCount:         1,
+		})
+	a.expectScale(t, now, 0, true)
+
+	// Traffic returns and the revision is activated straight to the activation scale.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  10,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 5, true)
+
+	// After a stable window the revision scales on its load alone.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 1, true)
+}
+
+func TestAutoscaler_MinScaleSchedule(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.EnableScaleToZero = true
+	schedule, err := autoscaling.ParseMinScaleSchedule("* * * * * 1h 5")
+	if err != nil {
+		t.Fatalf("ParseMinScaleSchedule() = %v", err)
+	}
+	a.SetMinScaleSchedule(schedule)
+
+	// Revisions without stats are scaled to the schedule.
+	now := time.Now()
+	a.expectScale(t, now, 5, true)
+	if d := a.Decision(); d.Reason != DecisionScheduled {
+		t.Errorf("Unexpected decision reason. Expected %v. Got %v.", DecisionScheduled, d.Reason)
+	}
+
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         2,
+		})
+	a.expectScale(t, now, 5, true)
+
+	// Idle revisions are not scaled to zero while the window is open,
+	// but are once it closes.
+	now = now.Add(10 * time.Minute)
+	a.expectScale(t, now, 5, true)
+	a.SetMinScaleSchedule(nil)
+	a.expectScale(t, now, 0, true)
+}
+
+func TestAutoscaler_MaxScaleDownRate(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.MaxScaleDownRate = 2.0
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         20,
+		})
+	// The 2 pods called for are limited to half of the 20 observed.
+	a.expectScale(t, now, 10, true)
+	if d := a.Decision(); d.Stable.DesiredPodCount != 10 {
+		t.Errorf("Unexpected stable desired pod count. Expected 10. Got %v.", d.Stable.DesiredPodCount)
+	}
+}
+
+func TestAutoscaler_TargetUtilization(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.TargetUtilization = 0.5
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 10, true)
+}
+
+func TestAutoscaler_RequestsPerSecond(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.RequestsPerSecondTarget = 20
+	_, scaler, err := ScalerFor(&autoscaling.Annotations{Metric: autoscaling.RPS})
+	if err != nil {
+		t.Fatalf("ScalerFor() = %v", err)
+	}
+	a.SetScaler(autoscaling.RPS, scaler, 0)
+
+	// 10 pods at 30 requests per second, with a concurrency of 1 that
+	// alone would not call for scaling up.
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		for j := 1; j <= 10; j++ {
+			ts := now.Add(time.Duration(j) * time.Millisecond)
+			a.Record(TestContextWithLogger(t), Stat{
+				Time:                      &ts,
+				PodName:                   fmt.Sprintf("pod-%v", j),
+				AverageConcurrentRequests: 1,
+				RequestCount:              30,
+			})
+		}
+		now = now.Add(time.Second)
+	}
+	a.expectScale(t, now, 15, true)
+	if d := a.Decision(); d.Scaler != autoscaling.RPS || d.Stable.ObservedRequestsPerSecondPerPod != 30 {
+		t.Errorf("Unexpected decision: %+v.", d)
+	}
+
+	// The target of the revision overrides the cluster-wide one.
+	a.SetScaler(autoscaling.RPS, scaler, 10)
+	a.expectScale(t, now, 30, true)
+}
+
+func TestAutoscaler_ConcurrencyTarget(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.SetScaler(autoscaling.Concurrency, ScalerFunc(scaleOnConcurrency), 5)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 10, true)
+	if d := a.Decision(); d.TargetConcurrency != 5 {
+		t.Errorf("Unexpected target concurrency. Expected 5. Got %v.", d.TargetConcurrency)
+	}
+}
+
+func TestAutoscaler_CustomScaler(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	var got ScalerSpec
+	a.SetScaler("custom", ScalerFunc(func(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64 {
+		got = spec
+		return currentScale * 1.2
+	}), 3)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 12, true)
+	if got.Target != 3 || got.Utilization != 1 || got.Config != a.Config {
+		t.Errorf("Unexpected spec: %+v.", got)
+	}
+
+	// The desired scale stays rate limited.
+	a.MaxScaleUpRate = 1.1
+	a.expectScale(t, now, 11, true)
+}
+
+func TestAutoscaler_SetConfig(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 10,
+			endConcurrency:   10,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 10, true)
+
+	config := *a.Config
+	config.MultiTargetConcurrency = 5.0
+	a.SetConfig(&config)
+	a.expectScale(t, now, 20, true)
+}
+
+func TestTotalAggregation_TimeWeighted(t *testing.T) {
+	now := time.Now()
+	agg := newTotalAggregation(time.Minute, now, 0)
+	for _, s := range []struct {
+		age         time.Duration
+		concurrency float64
+	}{
+		{10 * time.Second, 2},
+		{9 * time.Second, 2},
+		// Covers the 5 seconds without stats before it.
+		{4 * time.Second, 8},
+		// Outside of the window.
+		{2 * time.Minute, 100},
+	} {
+		ts := now.Add(-s.age)
+		agg.aggregate(Stat{Time: &ts, PodName: "pod", AverageConcurrentRequests: s.concurrency})
+	}
+	// The first stat covers the average period of 3 seconds.
+	if got, want := agg.observedConcurrencyPerPod(), (3*2+1*2+5*8)/9.0; math.Abs(got-want) > 1e-9 {
+		t.Errorf("observedConcurrencyPerPod() = %v, want %v", got, want)
+	}
+	if got, want := agg.probeCount, int32(3); got != want {
+		t.Errorf("probeCount = %v, want %v", got, want)
+	}
+}
+
+func TestTotalAggregation_ExponentialDecay(t *testing.T) {
+	now := time.Now()
+	agg := newTotalAggregation(time.Minute, now, time.Second)
+	for _, s := range []struct {
+		age         time.Duration
+		concurrency float64
+	}{
+		{2 * time.Second, 0},
+		{1 * time.Second, 0},
+		{0, 8},
+	} {
+		ts := now.Add(-s.age)
+		agg.aggregate(Stat{Time: &ts, PodName: "pod", AverageConcurrentRequests: s.concurrency})
+	}
+	// The last second weighs 1/2 of the 7/8 covered by the stats.
+	if got, want := agg.observedConcurrencyPerPod(), 8*(1/2.0)/(7/8.0); math.Abs(got-want) > 1e-9 {
+		t.Errorf("observedConcurrencyPerPod() = %v, want %v", got, want)
+	}
+}
+
 // Autoscaler should drop data after 60 seconds.
 func TestAutoscaler_Stats_TrimAfterStableWindow(t *testing.T) {
 	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelSingle, 10.0)
@@ -277,6 +733,66 @@ func TestAutoscaler_Stats_TrimAfterStableWindow(t *testing.T) {
 	}
 }
 
+func TestAutoscaler_MinScale(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.EnableScaleToZero = true
+	a.SetScaleBounds(3, 0)
+
+	// Revisions without stats are scaled to their min scale.
+	now := time.Now()
+	a.expectScale(t, now, 3, true)
+	if d := a.Decision(); d.Reason != DecisionMinScale {
+		t.Errorf("Unexpected decision reason. Expected %v. Got %v.", DecisionMinScale, d.Reason)
+	}
+
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1,
+			endConcurrency:   1,
+			durationSeconds:  60,
+			podCount:         2,
+		})
+	a.expectScale(t, now, 3, true)
+
+	// Idle revisions are not scaled to zero while they have a min scale.
+	now = now.Add(10 * time.Minute)
+	a.expectScale(t, now, 3, true)
+	a.SetScaleBounds(0, 0)
+	a.expectScale(t, now, 0, true)
+}
+
+func TestAutoscaler_MaxScale(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.SetScaleBounds(0, 5)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 100,
+			endConcurrency:   100,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 5, true)
+	if d := a.Decision(); len(d.Adjustments) != 1 {
+		t.Errorf("Decision = %#v, want the scale capped at the max scale", d)
+	}
+
+	// The max scale holds in panic mode too.
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 1000,
+			endConcurrency:   1000,
+			durationSeconds:  10,
+			podCount:         5,
+		})
+	a.expectScale(t, now, 5, true)
+}
+
 type linearSeries struct {
 	startConcurrency int
 	endConcurrency   int
@@ -349,3 +865,305 @@ func (a *Autoscaler) expectScale(t *testing.T, now time.Time, expectScale int32,
 		t.Errorf("Unexpected scale. Expected %v. Got %v.", expectScale, scale)
 	}
 }
+
+func (a *Autoscaler) expectActivatorInPath(t *testing.T, expectInPath bool) {
+	t.Helper()
+	if got := a.ActivatorInPath(); got != expectInPath {
+		t.Errorf("Unexpected activator in path. Expected %v. Got %v.", expectInPath, got)
+	}
+}
+
+func (a *Autoscaler) expectExcessBurstCapacity(t *testing.T, expectCapacity float64) {
+	t.Helper()
+	if got := a.ExcessBurstCapacity(); got != expectCapacity {
+		t.Errorf("Unexpected excess burst capacity. Expected %v. Got %v.", expectCapacity, got)
+	}
+}
+
+func TestAutoscaler_Decision(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.Scale(TestContextWithLogger(t), time.Now())
+	if d := a.Decision(); d.Reason != DecisionNoData || d.Scaled {
+		t.Errorf("Unexpected decision without stats: %+v.", d)
+	}
+
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 15,
+			endConcurrency:   15,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 15, true)
+
+	d := a.Decision()
+	if d.Reason != DecisionStable || d.DesiredScale != 15 || !d.Scaled || d.Panicking {
+		t.Errorf("Unexpected decision: %+v.", d)
+	}
+	if d.Scaler != autoscaling.Concurrency {
+		t.Errorf("Unexpected scaler. Expected %q. Got %q.", autoscaling.Concurrency, d.Scaler)
+	}
+	if d.TargetConcurrency != 10 {
+		t.Errorf("Unexpected target concurrency. Expected 10. Got %v.", d.TargetConcurrency)
+	}
+	if d.Stable.Window != "1m0s" || d.Stable.ObservedPods != 10 || d.Stable.ObservedConcurrencyPerPod != 15 || d.Stable.DesiredPodCount != 15 {
+		t.Errorf("Unexpected stable window: %+v.", d.Stable)
+	}
+	if d.Panic.Window != "6s" || d.Panic.ObservedPods != 10 || d.Panic.Samples != 60 {
+		t.Errorf("Unexpected panic window: %+v.", d.Panic)
+	}
+	if len(d.Stats) != 600 {
+		t.Fatalf("Unexpected number of stats. Expected 600. Got %v.", len(d.Stats))
+	}
+	for i := 1; i < len(d.Stats); i++ {
+		if d.Stats[i].Time.Before(*d.Stats[i-1].Time) {
+			t.Fatalf("Stats are not ordered by time: %v is before %v.", d.Stats[i].Time, d.Stats[i-1].Time)
+		}
+	}
+}
+
+func TestAutoscaler_Decision_Adjustments(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.ScaleDownDelay = 90 * time.Second
+	a.SetInitialScale(20)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 15,
+			endConcurrency:   15,
+			durationSeconds:  60,
+			podCount:         10,
+		})
+	a.expectScale(t, now, 15, true)
+	if d := a.Decision(); len(d.Adjustments) != 0 {
+		t.Errorf("Unexpected adjustments once the revision received traffic: %v.", d.Adjustments)
+	}
+
+	now = a.recordLinearSeries(
+		t,
+		now,
+		linearSeries{
+			startConcurrency: 5,
+			endConcurrency:   5,
+			durationSeconds:  60,
+			podCount:         15,
+		})
+	a.expectScale(t, now, 15, true)
+	want := []string{"held at 15 by the scale down delay of 1m30s"}
+	if d := a.Decision(); !reflect.DeepEqual(d.Adjustments, want) {
+		t.Errorf("Unexpected adjustments. Expected %v. Got %v.", want, d.Adjustments)
+	}
+}
+
+type fakeMetricSource struct {
+	value float64
+	err   error
+}
+
+func (s *fakeMetricSource) Value() (float64, error) {
+	return s.value, s.err
+}
+
+func TestAutoscaler_MetricSource(t *testing.T) {
+	source := &fakeMetricSource{value: 250}
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.EnableScaleToZero = true
+	a.SetScaler(autoscaling.External, ScalerFunc(scaleOnMetricValue), 100)
+	a.SetMetricSource(source)
+	start := time.Now()
+
+	// Without stats, the revision is scaled up on the value of the source,
+	// at first to a single pod.
+	a.expectScale(t, start, 1, true)
+
+	now := a.recordLinearSeries(
+		t,
+		start,
+		linearSeries{
+			startConcurrency: 0,
+			endConcurrency:   0,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 3, true)
+	if d := a.Decision(); d.MetricValue != 250 || d.Panicking {
+		t.Errorf("Decision = %#v, want a metric value of 250 without panicking", d)
+	}
+
+	// The revision is scaled to zero once the value stays at zero over the
+	// threshold, and stays at zero until it rises again.
+	source.value = 0
+	a.expectScale(t, now, 1, true)
+	now = now.Add(6 * time.Minute)
+	a.expectScale(t, now, 0, true)
+	a.expectScale(t, now.Add(time.Second), 0, false)
+	source.value = 50
+	a.expectScale(t, now.Add(2*time.Second), 1, true)
+}
+
+func TestAutoscaler_MetricSource_Error(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.SetScaler(autoscaling.External, ScalerFunc(scaleOnMetricValue), 100)
+	a.SetMetricSource(&fakeMetricSource{err: fmt.Errorf("metrics API unavailable")})
+	a.expectScale(t, time.Now(), 0, false)
+	if d := a.Decision(); d.Reason != DecisionNoData {
+		t.Errorf("Decision reason = %q, want %q", d.Reason, DecisionNoData)
+	}
+}
+
+func TestAutoscaler_PendingRequests(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	now := time.Now()
+	// The activator reports 95 requests waiting on the activation of the
+	// revision, which is scaled to their backlog at once rather than to
+	// the rate limit of the concurrency it handles.
+	a.Record(TestContextWithLogger(t), Stat{
+		Time:                      &now,
+		PodName:                   "activator",
+		AverageConcurrentRequests: 95,
+		RequestCount:              95,
+		PendingRequests:           95,
+	})
+	a.MaxScaleUpRate = 2
+	a.expectScale(t, now, 10, true)
+	d := a.Decision()
+	if d.PendingRequests != 95 || len(d.Adjustments) != 1 {
+		t.Errorf("Decision = %#v, want 95 pending requests raising the scale", d)
+	}
+
+	// Requests last reported pending over a panic window ago are not.
+	a.expectScale(t, now.Add(a.PanicWindow), 2, true)
+}
+
+func TestAutoscaler_Prediction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxScale int32
+		want     int32
+	}{{
+		name: "unbounded",
+		// The concurrency of 39 rises by 0.5 a second, to 69 a minute
+		// from now.
+		want: 7,
+	}, {
+		name:     "bounded by max scale",
+		maxScale: 5,
+		want:     5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+			a.SetPrediction(time.Minute)
+			a.SetScaleBounds(0, test.maxScale)
+			start := time.Now()
+			var scale int32
+			for i := 0; i < 30; i++ {
+				now := start.Add(time.Duration(i) * 2 * time.Second)
+				stat := Stat{
+					Time:                      &now,
+					PodName:                   "pod-1",
+					AverageConcurrentRequests: float64(10 + i),
+					RequestCount:              1,
+				}
+				a.Record(TestContextWithLogger(t), stat)
+				scale, _ = a.Scale(TestContextWithLogger(t), now)
+			}
+			if scale != test.want {
+				t.Errorf("Scale() = %d, want %d ahead of the ramp (%#v)", scale, test.want, a.Decision())
+			}
+		})
+	}
+}
+
+func TestAutoscaler_Prediction_Disabled(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		now := start.Add(time.Duration(i) * 2 * time.Second)
+		a.Record(TestContextWithLogger(t), Stat{
+			Time:                      &now,
+			PodName:                   "pod-1",
+			AverageConcurrentRequests: float64(10 + i),
+			RequestCount:              1,
+		})
+		a.Scale(TestContextWithLogger(t), now)
+	}
+	if d := a.Decision(); d.PredictedPodCount != 0 {
+		t.Errorf("PredictedPodCount = %v, want none without a prediction horizon", d.PredictedPodCount)
+	}
+}
+
+func TestAutoscaler_Windows(t *testing.T) {
+	tests := []struct {
+		name                  string
+		stableWindow          time.Duration
+		panicWindow           time.Duration
+		wantStable, wantPanic string
+		wantScale             int32
+	}{{
+		name:       "config windows",
+		wantStable: "1m0s",
+		wantPanic:  "6s",
+		wantScale:  5,
+	}, {
+		name:         "long windows",
+		stableWindow: 10 * time.Minute,
+		panicWindow:  time.Minute,
+		wantStable:   "10m0s",
+		wantPanic:    "1m0s",
+		// Averages the stats of both minutes.
+		wantScale: 10,
+	}, {
+		name:        "panic window above the stable window",
+		panicWindow: 2 * time.Minute,
+		wantStable:  "1m0s",
+		wantPanic:   "1m0s",
+		wantScale:   5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+			a.SetWindows(test.stableWindow, test.panicWindow)
+			now := a.recordLinearSeries(
+				t,
+				time.Now(),
+				linearSeries{
+					startConcurrency: 15,
+					endConcurrency:   15,
+					durationSeconds:  60,
+					podCount:         10,
+				})
+			now = a.recordLinearSeries(
+				t,
+				now,
+				linearSeries{
+					startConcurrency: 5,
+					endConcurrency:   5,
+					durationSeconds:  60,
+					podCount:         10,
+				})
+			a.expectScale(t, now, test.wantScale, true)
+			d := a.Decision()
+			if d.Stable.Window != test.wantStable || d.Panic.Window != test.wantPanic {
+				t.Errorf("Windows = %s and %s, want %s and %s", d.Stable.Window, d.Panic.Window, test.wantStable, test.wantPanic)
+			}
+		})
+	}
+}
+
+func TestAutoscaler_SetConfig_KeepsWindows(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.SetWindows(10*time.Minute, 0)
+
+	config := *a.config
+	config.PanicWindow = 10 * time.Second
+	a.SetConfig(&config)
+	if a.StableWindow != 10*time.Minute || a.PanicWindow != 10*time.Second {
+		t.Errorf("Windows = %v and %v, want %v and %v", a.StableWindow, a.PanicWindow, 10*time.Minute, 10*time.Second)
+	}
+}
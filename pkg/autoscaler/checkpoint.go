@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the state of a Decider saved so that a restarted
+// autoscaler resumes with the recent history of the revision, rather than
+// taking it for idle.
+type Checkpoint struct {
+	// Time is when the checkpoint was taken.
+	Time time.Time `json:"time"`
+	// Stats are the stats in the stable window as of Time.
+	Stats []Stat `json:"stats,omitempty"`
+
+	LastRequestTime time.Time  `json:"lastRequestTime"`
+	ReceivedTraffic bool       `json:"receivedTraffic,omitempty"`
+	ScaledToZero    bool       `json:"scaledToZero,omitempty"`
+	ActivationTime  *time.Time `json:"activationTime,omitempty"`
+	PanicTime       *time.Time `json:"panicTime,omitempty"`
+	MaxPanicPods    float64    `json:"maxPanicPods,omitempty"`
+	// ActivatorNeededTime is when the activator was last needed in the
+	// data path.
+	ActivatorNeededTime *time.Time `json:"activatorNeededTime,omitempty"`
+	// RecentScales are the scales desired over the scale down delay.
+	RecentScales []CheckpointScale `json:"recentScales,omitempty"`
+}
+
+// CheckpointScale is a desired scale and the time it was computed at.
+type CheckpointScale struct {
+	Time  time.Time `json:"time"`
+	Scale int32     `json:"scale"`
+}
+
+// Checkpoint returns the state of the autoscaler as of now.
+func (a *Autoscaler) Checkpoint(now time.Time) Checkpoint {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	c := Checkpoint{
+		Time:            now,
+		LastRequestTime: a.lastRequestTime,
+		ReceivedTraffic: a.receivedTraffic,
+		ScaledToZero:    a.scaleToZeroThresholdExceeded,
+		ActivationTime:  a.activationTime,
+		MaxPanicPods:    a.maxPanicPods,
+
+		ActivatorNeededTime: a.activatorNeededTime,
+	}
+	if a.panicking {
+		c.PanicTime = a.panicTime
+	}
+	for key, stat := range a.stats {
+		if key.time.Add(a.StableWindow).After(now) {
+			c.Stats = append(c.Stats, stat)
+		}
+	}
+	for _, s := range a.recentScales {
+		c.RecentScales = append(c.RecentScales, CheckpointScale{Time: s.time, Scale: s.scale})
+	}
+	return c
+}
+
+// Restore resumes the autoscaler from the given checkpoint. Stats recorded
+// since it was created are kept, and so is its state once it has scaled on
+// a request.
+func (a *Autoscaler) Restore(c Checkpoint) {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	for _, stat := range c.Stats {
+		if stat.Time == nil {
+			continue
+		}
+		key := statKey{
+			podName: stat.PodName,
+			time:    stat.Time.UTC(),
+		}
+		if _, exists := a.stats[key]; !exists {
+			a.stats[key] = stat
+		}
+	}
+	if !a.receivedTraffic {
+		a.lastRequestTime = c.LastRequestTime
+		a.scaleToZeroThresholdExceeded = c.ScaledToZero
+		a.activationTime = c.ActivationTime
+	}
+	a.receivedTraffic = a.receivedTraffic || c.ReceivedTraffic
+	if c.PanicTime != nil && !a.panicking {
+		a.panicking = true
+		a.panicTime = c.PanicTime
+		a.maxPanicPods = c.MaxPanicPods
+	}
+	if a.activatorNeededTime == nil {
+		a.activatorNeededTime = c.ActivatorNeededTime
+	}
+	if a.recentScales == nil {
+		for _, s := range c.RecentScales {
+			a.recentScales = append(a.recentScales, timedScale{time: s.Time, scale: s.Scale})
+		}
+	}
+}
+
+// LoadCheckpoints reads the checkpoints saved to the given file by
+// SaveCheckpoints, keyed by revision. A missing file holds none.
+func LoadCheckpoints(path string) (map[string]Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]Checkpoint{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	checkpoints := make(map[string]Checkpoint)
+	if err := json.Unmarshal(b, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// SaveCheckpoints writes the given checkpoints, keyed by revision, to the
+// given file. The file is replaced at once, so that an autoscaler stopped
+// while saving finds the previous checkpoints on restart.
+func SaveCheckpoints(path string, checkpoints map[string]Checkpoint) error {
+	b, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+)
+
+func TestAutoscaler_Restore_ResumesStats(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 50,
+			endConcurrency:   50,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	a.expectScale(t, now, 5, true)
+
+	checkpoints := saveAndLoadCheckpoints(t, map[string]Checkpoint{"ns/rev": a.Checkpoint(now)})
+
+	restarted := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	restarted.Restore(checkpoints["ns/rev"])
+	restarted.expectScale(t, now, 5, true)
+}
+
+func TestAutoscaler_Restore_KeepsIdleTime(t *testing.T) {
+	start := time.Now()
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	a.EnableScaleToZero = true
+	a.lastRequestTime = start
+
+	checkpoints := saveAndLoadCheckpoints(t, map[string]Checkpoint{"ns/rev": a.Checkpoint(start)})
+
+	// A restarted autoscaler counts the idle time from the last request
+	// before the restart, rather than from the restart.
+	restarted := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	restarted.EnableScaleToZero = true
+	restarted.Restore(checkpoints["ns/rev"])
+	restarted.expectScale(t, start.Add(6*time.Minute), 0, true)
+	if d := restarted.Decision(); d.Reason != DecisionScaleToZero {
+		t.Errorf("Decision reason = %q, want %q", d.Reason, DecisionScaleToZero)
+	}
+}
+
+func TestAutoscaler_Restore_ResumesPanic(t *testing.T) {
+	a := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	now := a.recordLinearSeries(
+		t,
+		time.Now(),
+		linearSeries{
+			startConcurrency: 10,
+			endConcurrency:   100,
+			durationSeconds:  60,
+			podCount:         1,
+		})
+	scale, _ := a.Scale(TestContextWithLogger(t), now)
+	if !a.panicking {
+		t.Fatal("Autoscaler is not panicking")
+	}
+
+	restarted := newTestAutoscaler(v1alpha1.RevisionRequestConcurrencyModelMulti, 10.0)
+	restarted.Restore(a.Checkpoint(now))
+	if !restarted.panicking {
+		t.Error("Restored autoscaler is not panicking")
+	}
+	// Without stats, the restored autoscaler holds the panic scale from
+	// the stats it restored.
+	restarted.expectScale(t, now, scale, true)
+}
+
+func TestLoadCheckpoints_MissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoints, err := LoadCheckpoints(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("LoadCheckpoints() = %v", err)
+	}
+	if len(checkpoints) != 0 {
+		t.Errorf("LoadCheckpoints() = %#v, want none", checkpoints)
+	}
+}
+
+func saveAndLoadCheckpoints(t *testing.T, checkpoints map[string]Checkpoint) map[string]Checkpoint {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoints.json")
+	if err := SaveCheckpoints(path, checkpoints); err != nil {
+		t.Fatalf("SaveCheckpoints() = %v", err)
+	}
+	loaded, err := LoadCheckpoints(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoints() = %v", err)
+	}
+	if len(loaded) != len(checkpoints) {
+		t.Fatalf("LoadCheckpoints() = %#v, want %d checkpoints", loaded, len(checkpoints))
+	}
+	return loaded
+}
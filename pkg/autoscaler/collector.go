@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	av1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// How often stats are scraped from the pods of each revision.
+const statsScrapeInterval = time.Second
+
+// StatsScraper pulls statistics from the pods of a revision.
+type StatsScraper interface {
+	// Scrape returns the latest statistics of the revision's pods.
+	Scrape() []Stat
+}
+
+// StatsScraperFactory creates a StatsScraper for the pods a given Metric describes.
+type StatsScraperFactory func(*av1alpha1.Metric) StatsScraper
+
+// StatsRecorder records the statistics collected for revisions.
+type StatsRecorder interface {
+	// RecordStat records a stat of the revision with the given key, of the form namespace/name.
+	RecordStat(revKey string, stat Stat)
+}
+
+// collection is the scraping of the pods of a Metric's target.
+type collection struct {
+	target string
+	stopCh chan struct{}
+}
+
+// MetricCollector collects the statistics described by Metrics and passes them to a StatsRecorder,
+// leaving the decisions based on them to it.
+type MetricCollector struct {
+	collections      map[string]*collection
+	collectionsMutex sync.Mutex
+	stopCh           <-chan struct{}
+
+	statsScraperFactory StatsScraperFactory
+	recorder            StatsRecorder
+}
+
+// NewMetricCollector constructs a MetricCollector passing the stats scraped by the StatsScrapers the
+// factory creates to the recorder, until stopCh is closed.
+func NewMetricCollector(statsScraperFactory StatsScraperFactory, recorder StatsRecorder, stopCh <-chan struct{}) *MetricCollector {
+	return &MetricCollector{
+		collections:         make(map[string]*collection),
+		stopCh:              stopCh,
+		statsScraperFactory: statsScraperFactory,
+		recorder:            recorder,
+	}
+}
+
+// OnPresent starts, if necessary, collecting the statistics the given Metric describes. A Metric
+// whose target changed is collected from the new target from then on.
+func (c *MetricCollector) OnPresent(metric *av1alpha1.Metric, logger *zap.SugaredLogger) error {
+	c.collectionsMutex.Lock()
+	defer c.collectionsMutex.Unlock()
+	key := string(newRevisionKey(metric.Namespace, metric.Name))
+	if existing, exists := c.collections[key]; exists {
+		if existing.target == metric.Spec.ScrapeTarget {
+			return nil
+		}
+		close(existing.stopCh)
+		delete(c.collections, key)
+	}
+	if metric.Spec.ScrapeTarget == "" {
+		return errors.New("metric has no scrape target")
+	}
+
+	col := &collection{
+		target: metric.Spec.ScrapeTarget,
+		stopCh: make(chan struct{}),
+	}
+	c.collections[key] = col
+	go c.collect(logging.WithLogger(context.TODO(), logger), c.statsScraperFactory(metric),
+		string(newRevisionKey(metric.Namespace, col.target)), col.stopCh)
+	logger.Info("Started collecting metric.")
+	return nil
+}
+
+// OnAbsent stops, if necessary, collecting the statistics of the Metric in the given namespace and
+// with the given name.
+func (c *MetricCollector) OnAbsent(namespace string, name string, logger *zap.SugaredLogger) {
+	c.collectionsMutex.Lock()
+	defer c.collectionsMutex.Unlock()
+	key := string(newRevisionKey(namespace, name))
+	if col, exists := c.collections[key]; exists {
+		close(col.stopCh)
+		delete(c.collections, key)
+		logger.Info("Stopped collecting metric.")
+	}
+}
+
+func (c *MetricCollector) collect(ctx context.Context, scraper StatsScraper, revKey string, stopCh <-chan struct{}) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(statsScrapeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			stats := scraper.Scrape()
+			logger.Debugf("Scraped %d stats.", len(stats))
+			for _, stat := range stats {
+				c.recorder.RecordStat(revKey, stat)
+			}
+		}
+	}
+}
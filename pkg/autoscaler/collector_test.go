@@ -0,0 +1,192 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	av1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/autoscaler"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMetricCollectorScrapesStatistics(t *testing.T) {
+	now := time.Now()
+	testStat := autoscaler.Stat{
+		Time:                      &now,
+		PodName:                   "test-pod",
+		AverageConcurrentRequests: 3.5,
+		RequestCount:              20,
+	}
+	c, recorder, scrapers, logger := createMetricCollector(fakeStatsScraper{testStat})
+
+	metric := newMetric(testRevision)
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	defer c.OnAbsent(metric.Namespace, metric.Name, logger)
+
+	// Stats are recorded for the target, whatever the Metric is named.
+	recorder.awaitStat(t, testRevisionKey, testStat)
+	if got, want := scrapers.created(), []string{testRevision}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scrapers created for %v, want %v", got, want)
+	}
+}
+
+func TestMetricCollectorTargetChange(t *testing.T) {
+	c, _, scrapers, logger := createMetricCollector(fakeStatsScraper{})
+
+	metric := newMetric("first")
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	defer c.OnAbsent(metric.Namespace, metric.Name, logger)
+
+	// The same Metric is collected once.
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	if got, want := scrapers.created(), []string{"first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scrapers created for %v, want %v", got, want)
+	}
+
+	metric = newMetric("second")
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	if got, want := scrapers.created(), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scrapers created for %v, want %v", got, want)
+	}
+}
+
+func TestMetricCollectorOnAbsent(t *testing.T) {
+	c, _, scrapers, logger := createMetricCollector(fakeStatsScraper{})
+
+	metric := newMetric(testRevision)
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	c.OnAbsent(metric.Namespace, metric.Name, logger)
+
+	// The Metric is collected anew once it is present again.
+	if err := c.OnPresent(metric, logger); err != nil {
+		t.Fatalf("OnPresent() = %v", err)
+	}
+	defer c.OnAbsent(metric.Namespace, metric.Name, logger)
+	if got, want := scrapers.created(), []string{testRevision, testRevision}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scrapers created for %v, want %v", got, want)
+	}
+}
+
+func TestMetricCollectorNoScrapeTarget(t *testing.T) {
+	c, _, scrapers, logger := createMetricCollector(fakeStatsScraper{})
+
+	metric := newMetric("")
+	if err := c.OnPresent(metric, logger); err == nil {
+		t.Error("OnPresent() = nil, wanted an error")
+	}
+	if got := scrapers.created(); len(got) != 0 {
+		t.Errorf("Scrapers created for %v, want none", got)
+	}
+}
+
+func createMetricCollector(scraper autoscaler.StatsScraper) (*autoscaler.MetricCollector, *fakeStatsRecorder, *fakeScraperFactory, *zap.SugaredLogger) {
+	logger := zap.NewNop().Sugar()
+	recorder := &fakeStatsRecorder{}
+	scrapers := &fakeScraperFactory{scraper: scraper}
+
+	stopChan := make(chan struct{})
+	c := autoscaler.NewMetricCollector(scrapers.newScraper, recorder, stopChan)
+	return c, recorder, scrapers, logger
+}
+
+func newMetric(target string) *av1alpha1.Metric {
+	return &av1alpha1.Metric{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      testRevision + "-metric",
+		},
+		Spec: av1alpha1.MetricSpec{
+			ScrapeTarget: target,
+		},
+	}
+}
+
+type fakeStatsScraper []autoscaler.Stat
+
+func (s fakeStatsScraper) Scrape() []autoscaler.Stat {
+	return s
+}
+
+type fakeScraperFactory struct {
+	mutex   sync.Mutex
+	scraper autoscaler.StatsScraper
+	targets []string
+}
+
+func (f *fakeScraperFactory) newScraper(metric *av1alpha1.Metric) autoscaler.StatsScraper {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.targets = append(f.targets, metric.Spec.ScrapeTarget)
+	return f.scraper
+}
+
+func (f *fakeScraperFactory) created() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]string(nil), f.targets...)
+}
+
+type fakeStatsRecorder struct {
+	mutex sync.Mutex
+	stats map[string]autoscaler.Stat
+}
+
+func (r *fakeStatsRecorder) RecordStat(revKey string, stat autoscaler.Stat) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stats == nil {
+		r.stats = make(map[string]autoscaler.Stat)
+	}
+	r.stats[revKey] = stat
+}
+
+func (r *fakeStatsRecorder) awaitStat(t *testing.T, revKey string, stat autoscaler.Stat) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		r.mutex.Lock()
+		got, ok := r.stats[revKey]
+		r.mutex.Unlock()
+		if ok && got == stat {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Last statistic recorded for %s was %#v instead of expected statistic %#v", revKey, got, stat)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
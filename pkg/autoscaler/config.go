@@ -22,12 +22,27 @@ import (
 	"strings"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 const (
 	ConfigName = "config-autoscaler"
+
+	// DefaultPanicThreshold is the PanicThreshold used when the config
+	// does not set one.
+	DefaultPanicThreshold = 2.0
+
+	// DefaultMaxScaleDownRate is the MaxScaleDownRate used when the config
+	// does not set one.
+	DefaultMaxScaleDownRate = 2.0
+
+	// DefaultPredictionLevelSmoothing and DefaultPredictionTrendSmoothing
+	// are the PredictionLevelSmoothing and PredictionTrendSmoothing used
+	// when the config does not set them.
+	DefaultPredictionLevelSmoothing = 0.5
+	DefaultPredictionTrendSmoothing = 0.2
 )
 
 // Config defines the tunable autoscaler parameters
@@ -41,6 +56,11 @@ type Config struct {
 	MultiTargetConcurrency    float64
 	VPAMultiTargetConcurrency float64
 
+	// RequestsPerSecondTarget is the number of requests per second of
+	// each pod that the rps Scaler scales revisions to, unless they set
+	// their own target.
+	RequestsPerSecondTarget float64
+
 	// General autoscaler algorithm configuration.
 	MaxScaleUpRate           float64
 	StableWindow             time.Duration
@@ -48,6 +68,53 @@ type Config struct {
 	TickInterval             time.Duration
 	ScaleToZeroThreshold     time.Duration
 	ConcurrencyQuantumOfTime time.Duration
+
+	// ScaleToZeroGracePeriod is how long the pods of a revision scaled to
+	// zero are kept once its traffic is routed to the activator, so that
+	// the requests still routed to them are served.
+	ScaleToZeroGracePeriod time.Duration
+
+	// MaxScaleDownRate is the maximum ratio of observed pods versus
+	// desired pods, limiting how fast the autoscaler decreases the pod
+	// count. Zero does not limit it.
+	MaxScaleDownRate float64
+
+	// ScaleDownDelay is how long the desired scale is held at its recent
+	// maximum before reductions take effect. Zero scales down right away.
+	ScaleDownDelay time.Duration
+
+	// PanicThreshold is the multiple of the target concurrency, and so of
+	// the capacity of the current pods, that the average concurrency over
+	// PanicWindow must reach for the autoscaler to panic.
+	PanicThreshold float64
+
+	// TargetBurstCapacity is the number of concurrent requests beyond the
+	// observed concurrency that the pods of a revision should absorb
+	// before the activator is kept in its data path to buffer them. Zero
+	// only routes through the activator when scaled to zero, and -1
+	// always does.
+	TargetBurstCapacity float64
+
+	// InitialScale is the number of pods new revisions start with, and
+	// are kept at until they receive traffic, unless they override it.
+	InitialScale int32
+
+	// StatDecayHalfLife is the age at which stats weigh half as much as
+	// current ones when averaged over the stable and panic windows. Zero
+	// weighs stats by the time they cover alone.
+	StatDecayHalfLife time.Duration
+
+	// TargetUtilization is the fraction of the target concurrency that
+	// the autoscaler scales pods to, leaving the rest as headroom for
+	// bursts while new pods start.
+	TargetUtilization float64
+
+	// PredictionLevelSmoothing and PredictionTrendSmoothing weigh the
+	// latest level and trend of the traffic of revisions against the
+	// previous ones when it is forecast, from 0 exclusive, for a smoother
+	// forecast, to 1, for the latest alone.
+	PredictionLevelSmoothing float64
+	PredictionTrendSmoothing float64
 }
 
 func (c *Config) TargetConcurrency(model v1alpha1.RevisionRequestConcurrencyModelType) float64 {
@@ -65,6 +132,30 @@ func (c *Config) TargetConcurrency(model v1alpha1.RevisionRequestConcurrencyMode
 	}
 }
 
+// InitialScaleFor returns the number of pods a revision with the given
+// autoscaling annotations starts with: that of its initial-scale
+// annotation, or the cluster-wide default, which is one for configs not
+// setting one.
+func (c *Config) InitialScaleFor(annotations *autoscaling.Annotations) int32 {
+	if annotations.InitialScale > 0 {
+		return annotations.InitialScale
+	}
+	if c.InitialScale < 1 {
+		return 1
+	}
+	return c.InitialScale
+}
+
+// ActivationScaleFor returns the number of pods a revision with the given
+// autoscaling annotations is scaled to when it is activated from zero: that
+// of its activation-scale annotation, or one.
+func ActivationScaleFor(annotations *autoscaling.Annotations) int32 {
+	if annotations.ActivationScale > 0 {
+		return annotations.ActivationScale
+	}
+	return 1
+}
+
 // NewConfigFromMap creates a Config from the supplied map
 func NewConfigFromMap(data map[string]string) (*Config, error) {
 	lc := &Config{}
@@ -97,6 +188,11 @@ func NewConfigFromMap(data map[string]string) (*Config, error) {
 	}{{
 		key:   "max-scale-up-rate",
 		field: &lc.MaxScaleUpRate,
+	}, {
+		key:          "max-scale-down-rate",
+		field:        &lc.MaxScaleDownRate,
+		optional:     true,
+		defaultValue: DefaultMaxScaleDownRate,
 	}, {
 		key:   "single-concurrency-target",
 		field: &lc.SingleTargetConcurrency,
@@ -108,6 +204,35 @@ func NewConfigFromMap(data map[string]string) (*Config, error) {
 		field:        &lc.VPAMultiTargetConcurrency,
 		optional:     true,
 		defaultValue: 10.0,
+	}, {
+		key:          "requests-per-second-target",
+		field:        &lc.RequestsPerSecondTarget,
+		optional:     true,
+		defaultValue: 200.0,
+	}, {
+		key:          "panic-threshold",
+		field:        &lc.PanicThreshold,
+		optional:     true,
+		defaultValue: DefaultPanicThreshold,
+	}, {
+		key:      "target-burst-capacity",
+		field:    &lc.TargetBurstCapacity,
+		optional: true,
+	}, {
+		key:          "target-utilization",
+		field:        &lc.TargetUtilization,
+		optional:     true,
+		defaultValue: 1.0,
+	}, {
+		key:          "prediction-level-smoothing",
+		field:        &lc.PredictionLevelSmoothing,
+		optional:     true,
+		defaultValue: DefaultPredictionLevelSmoothing,
+	}, {
+		key:          "prediction-trend-smoothing",
+		field:        &lc.PredictionTrendSmoothing,
+		optional:     true,
+		defaultValue: DefaultPredictionTrendSmoothing,
 	}} {
 		if raw, ok := data[f64.key]; !ok {
 			if f64.optional {
@@ -122,10 +247,52 @@ func NewConfigFromMap(data map[string]string) (*Config, error) {
 		}
 	}
 
+	// Panicking below the capacity of the current pods would mean never
+	// leaving panic mode.
+	if lc.PanicThreshold < 1 {
+		return nil, fmt.Errorf("Autoscaling configmap has %q below 1: %v", "panic-threshold", lc.PanicThreshold)
+	}
+	// Scaling down at a rate of 1 or less would mean never scaling down.
+	if lc.MaxScaleDownRate <= 1 {
+		return nil, fmt.Errorf("Autoscaling configmap has %q that is not above 1: %v", "max-scale-down-rate", lc.MaxScaleDownRate)
+	}
+	if lc.TargetBurstCapacity < 0 && lc.TargetBurstCapacity != -1 {
+		return nil, fmt.Errorf("Autoscaling configmap has %q that is neither -1 nor non-negative: %v", "target-burst-capacity", lc.TargetBurstCapacity)
+	}
+	for _, fraction := range []struct {
+		key   string
+		value float64
+	}{
+		{"target-utilization", lc.TargetUtilization},
+		{"prediction-level-smoothing", lc.PredictionLevelSmoothing},
+		{"prediction-trend-smoothing", lc.PredictionTrendSmoothing},
+	} {
+		if fraction.value <= 0 || fraction.value > 1 {
+			return nil, fmt.Errorf("Autoscaling configmap has %q outside of (0, 1]: %v", fraction.key, fraction.value)
+		}
+	}
+	for _, target := range []struct {
+		key   string
+		value float64
+	}{
+		{"max-scale-up-rate", lc.MaxScaleUpRate},
+		{"single-concurrency-target", lc.SingleTargetConcurrency},
+		{"multi-concurrency-target", lc.MultiTargetConcurrency},
+		{"vpa-multi-concurrency-target", lc.VPAMultiTargetConcurrency},
+		{"requests-per-second-target", lc.RequestsPerSecondTarget},
+	} {
+		if target.value <= 0 {
+			return nil, fmt.Errorf("Autoscaling configmap has non-positive %q: %v", target.key, target.value)
+		}
+	}
+
 	// Process Duration fields
 	for _, dur := range []struct {
-		key   string
-		field *time.Duration
+		key      string
+		field    *time.Duration
+		optional bool
+		// specified exactly when optional
+		defaultValue time.Duration
 	}{{
 		key:   "stable-window",
 		field: &lc.StableWindow,
@@ -141,8 +308,25 @@ func NewConfigFromMap(data map[string]string) (*Config, error) {
 	}, {
 		key:   "tick-interval",
 		field: &lc.TickInterval,
+	}, {
+		key:          "scale-to-zero-grace-period",
+		field:        &lc.ScaleToZeroGracePeriod,
+		optional:     true,
+		defaultValue: 2 * time.Minute,
+	}, {
+		key:      "scale-down-delay",
+		field:    &lc.ScaleDownDelay,
+		optional: true,
+	}, {
+		key:      "stat-decay-half-life",
+		field:    &lc.StatDecayHalfLife,
+		optional: true,
 	}} {
 		if raw, ok := data[dur.key]; !ok {
+			if dur.optional {
+				*dur.field = dur.defaultValue
+				continue
+			}
 			return nil, fmt.Errorf("Autoscaling configmap is missing %q", dur.key)
 		} else if val, err := time.ParseDuration(raw); err != nil {
 			return nil, err
@@ -151,6 +335,45 @@ func NewConfigFromMap(data map[string]string) (*Config, error) {
 		}
 	}
 
+	// Process int32 fields
+	for _, i32 := range []struct {
+		key          string
+		field        *int32
+		defaultValue int32
+	}{{
+		key:          "initial-scale",
+		field:        &lc.InitialScale,
+		defaultValue: 1,
+	}} {
+		if raw, ok := data[i32.key]; !ok {
+			*i32.field = i32.defaultValue
+		} else if val, err := strconv.ParseInt(raw, 10, 32); err != nil {
+			return nil, err
+		} else {
+			*i32.field = int32(val)
+		}
+	}
+
+	if lc.InitialScale < 1 {
+		return nil, fmt.Errorf("Autoscaling configmap has %q below 1: %v", "initial-scale", lc.InitialScale)
+	}
+
+	if lc.StableWindow <= 0 {
+		return nil, fmt.Errorf("Autoscaling configmap has non-positive %q: %v", "stable-window", lc.StableWindow)
+	}
+	if lc.PanicWindow <= 0 || lc.PanicWindow > lc.StableWindow {
+		return nil, fmt.Errorf("Autoscaling configmap has %q that is not within %q: %v", "panic-window", "stable-window", lc.PanicWindow)
+	}
+	if lc.TickInterval <= 0 {
+		return nil, fmt.Errorf("Autoscaling configmap has non-positive %q: %v", "tick-interval", lc.TickInterval)
+	}
+	if lc.ScaleDownDelay < 0 {
+		return nil, fmt.Errorf("Autoscaling configmap has negative %q: %v", "scale-down-delay", lc.ScaleDownDelay)
+	}
+	if lc.StatDecayHalfLife < 0 {
+		return nil, fmt.Errorf("Autoscaling configmap has negative %q: %v", "stat-decay-half-life", lc.StatDecayHalfLife)
+	}
+
 	return lc, nil
 }
 
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConfigStore holds the current autoscaler Config, replaced whenever the
+// config-autoscaler ConfigMap changes so that tuning the autoscaler does
+// not require restarting it.
+type ConfigStore struct {
+	logger *zap.SugaredLogger
+
+	mux      sync.RWMutex
+	current  *Config
+	onChange []func(*Config)
+}
+
+// NewConfigStore creates a ConfigStore starting with initial.
+func NewConfigStore(initial *Config, logger *zap.SugaredLogger) *ConfigStore {
+	return &ConfigStore{
+		logger:  logger,
+		current: initial,
+	}
+}
+
+// Load returns the current Config, which must not be modified.
+func (s *ConfigStore) Load() *Config {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.current
+}
+
+// OnChange registers f to be called with every new Config.
+func (s *ConfigStore) OnChange(f func(*Config)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.onChange = append(s.onChange, f)
+}
+
+// OnConfigChanged replaces the current Config with the one in cm, for
+// use with a configmap.Watcher. An invalid ConfigMap is logged and
+// leaves the current Config in place.
+func (s *ConfigStore) OnConfigChanged(cm *corev1.ConfigMap) {
+	cur, err := NewConfigFromConfigMap(cm)
+	if err != nil {
+		s.logger.Errorf("Ignoring invalid %s: %v", ConfigName, err)
+		return
+	}
+	s.mux.Lock()
+	if reflect.DeepEqual(s.current, cur) {
+		s.mux.Unlock()
+		return
+	}
+	s.current = cur
+	onChange := s.onChange
+	s.mux.Unlock()
+
+	s.logger.Infof("Applying the updated %s: %#v", ConfigName, cur)
+	for _, f := range onChange {
+		f(cur)
+	}
+}
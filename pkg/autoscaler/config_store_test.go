@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var validConfig = map[string]string{
+	"max-scale-up-rate":           "1.0",
+	"single-concurrency-target":   "1.0",
+	"multi-concurrency-target":    "1.0",
+	"stable-window":               "5m",
+	"panic-window":                "10s",
+	"scale-to-zero-threshold":     "10m",
+	"concurrency-quantum-of-time": "100ms",
+	"tick-interval":               "2s",
+}
+
+func configMap(overrides map[string]string) *corev1.ConfigMap {
+	data := make(map[string]string)
+	for k, v := range validConfig {
+		data[k] = v
+	}
+	for k, v := range overrides {
+		data[k] = v
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigName},
+		Data:       data,
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	initial, err := NewConfigFromConfigMap(configMap(nil))
+	if err != nil {
+		t.Fatalf("NewConfigFromConfigMap() = %v", err)
+	}
+	s := NewConfigStore(initial, TestLogger(t))
+	var changes []*Config
+	s.OnChange(func(cur *Config) {
+		changes = append(changes, cur)
+	})
+
+	// An unchanged config is not applied again.
+	s.OnConfigChanged(configMap(nil))
+	if len(changes) != 0 {
+		t.Errorf("Unexpected changes for the same config: %v", changes)
+	}
+
+	s.OnConfigChanged(configMap(map[string]string{"stable-window": "2m", "multi-concurrency-target": "5"}))
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected number of changes. Want 1. Got %d.", len(changes))
+	}
+	if got := s.Load(); got != changes[0] || got.StableWindow != 2*time.Minute || got.MultiTargetConcurrency != 5 {
+		t.Errorf("Unexpected current config: %+v", got)
+	}
+
+	// An invalid config leaves the current one in place.
+	current := s.Load()
+	s.OnConfigChanged(configMap(map[string]string{"panic-window": "10m"}))
+	if got := s.Load(); got != current {
+		t.Errorf("Unexpected config after an invalid update. Want %+v. Got %+v.", current, got)
+	}
+	if len(changes) != 1 {
+		t.Errorf("Unexpected number of changes after an invalid update. Want 1. Got %d.", len(changes))
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 )
 
@@ -82,6 +83,62 @@ func TestTargetConcurrency(t *testing.T) {
 	}
 }
 
+func TestInitialScaleFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		annotations *autoscaling.Annotations
+		want        int32
+	}{{
+		name:        "cluster default",
+		config:      &Config{InitialScale: 3},
+		annotations: &autoscaling.Annotations{},
+		want:        3,
+	}, {
+		name:        "unset cluster default",
+		config:      &Config{},
+		annotations: &autoscaling.Annotations{},
+		want:        1,
+	}, {
+		name:        "annotation overrides cluster default",
+		config:      &Config{InitialScale: 3},
+		annotations: &autoscaling.Annotations{InitialScale: 10},
+		want:        10,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.InitialScaleFor(test.annotations); got != test.want {
+				t.Errorf("InitialScaleFor() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestActivationScaleFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations *autoscaling.Annotations
+		want        int32
+	}{{
+		name:        "default",
+		annotations: &autoscaling.Annotations{},
+		want:        1,
+	}, {
+		name:        "annotation",
+		annotations: &autoscaling.Annotations{ActivationScale: 5},
+		want:        5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ActivationScaleFor(test.annotations); got != test.want {
+				t.Errorf("ActivationScaleFor() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
 func TestNewConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -104,12 +161,20 @@ func TestNewConfig(t *testing.T) {
 			SingleTargetConcurrency:   1.0,
 			MultiTargetConcurrency:    1.0,
 			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
 			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
 			StableWindow:              5 * time.Minute,
 			PanicWindow:               10 * time.Second,
 			ScaleToZeroThreshold:      10 * time.Minute,
 			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
 			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
 		},
 	}, {
 		name: "with vpa specified",
@@ -128,13 +193,571 @@ func TestNewConfig(t *testing.T) {
 			SingleTargetConcurrency:   1.0,
 			MultiTargetConcurrency:    1.0,
 			VPAMultiTargetConcurrency: 1.0, // not the default!
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "with panic threshold specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"panic-threshold":             "3.5",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            3.5,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "panic threshold below capacity",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"panic-threshold":             "0.5",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "with scale to zero grace period specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"scale-to-zero-grace-period":  "30s",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    30 * time.Second,
+		},
+	}, {
+		name: "with scale down delay specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"scale-down-delay":            "1m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+			ScaleDownDelay:            time.Minute,
+		},
+	}, {
+		name: "negative scale down delay",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"scale-down-delay":            "-1m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "with target burst capacity specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"target-burst-capacity":       "200",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			TargetBurstCapacity:       200,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "with activator always in path",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"target-burst-capacity":       "-1",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			TargetBurstCapacity:       -1,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "invalid negative target burst capacity",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"target-burst-capacity":       "-2",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "with initial scale specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"initial-scale":               "3",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              3,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "initial scale below 1",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"initial-scale":               "0",
+		},
+		wantErr: true,
+	}, {
+		name: "malformed initial scale",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"initial-scale":               "many",
+		},
+		wantErr: true,
+	}, {
+		name: "with target utilization specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"target-utilization":          "0.7",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         0.7,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "with max scale down rate specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"max-scale-down-rate":         "1.5",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          1.5,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "max scale down rate not above 1",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"max-scale-down-rate":         "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "with prediction smoothing specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"prediction-level-smoothing":  "0.8",
+			"prediction-trend-smoothing":  "1",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.8,
+			PredictionTrendSmoothing:  1.0,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "prediction trend smoothing of zero",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"prediction-trend-smoothing":  "0",
+		},
+		wantErr: true,
+	}, {
+		name: "with requests per second target specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"requests-per-second-target":  "50",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   50.0,
+			PanicThreshold:            2.0,
+			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
+			StableWindow:              5 * time.Minute,
+			PanicWindow:               10 * time.Second,
+			ScaleToZeroThreshold:      10 * time.Minute,
+			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
+			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+		},
+	}, {
+		name: "non-positive requests per second target",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"requests-per-second-target":  "0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "with stat decay half life specified",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"stat-decay-half-life":        "30s",
+		},
+		want: &Config{
+			SingleTargetConcurrency:   1.0,
+			MultiTargetConcurrency:    1.0,
+			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
 			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
 			StableWindow:              5 * time.Minute,
 			PanicWindow:               10 * time.Second,
 			ScaleToZeroThreshold:      10 * time.Minute,
 			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
 			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
+			StatDecayHalfLife:         30 * time.Second,
+		},
+	}, {
+		name: "negative stat decay half life",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"stat-decay-half-life":        "-1s",
+		},
+		wantErr: true,
+	}, {
+		name: "target utilization above 1",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"target-utilization":          "1.5",
+		},
+		wantErr: true,
+	}, {
+		name: "zero target utilization",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+			"target-utilization":          "0",
+		},
+		wantErr: true,
+	}, {
+		name: "non-positive concurrency target",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
 		},
+		wantErr: true,
+	}, {
+		name: "panic window longer than stable window",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10m",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+		wantErr: true,
+	}, {
+		name: "non-positive tick interval",
+		input: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "0s",
+		},
+		wantErr: true,
 	}, {
 		name: "with toggles on",
 		input: map[string]string{
@@ -155,12 +778,20 @@ func TestNewConfig(t *testing.T) {
 			SingleTargetConcurrency:   1.0,
 			MultiTargetConcurrency:    1.0,
 			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
 			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
 			StableWindow:              5 * time.Minute,
 			PanicWindow:               10 * time.Second,
 			ScaleToZeroThreshold:      10 * time.Minute,
 			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
 			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
 		},
 	}, {
 		name: "with toggles on strange casing",
@@ -182,12 +813,20 @@ func TestNewConfig(t *testing.T) {
 			SingleTargetConcurrency:   1.0,
 			MultiTargetConcurrency:    1.0,
 			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
 			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
 			StableWindow:              5 * time.Minute,
 			PanicWindow:               10 * time.Second,
 			ScaleToZeroThreshold:      10 * time.Minute,
 			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
 			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
 		},
 	}, {
 		name: "with toggles explicitly off",
@@ -207,12 +846,20 @@ func TestNewConfig(t *testing.T) {
 			SingleTargetConcurrency:   1.0,
 			MultiTargetConcurrency:    1.0,
 			VPAMultiTargetConcurrency: 10.0,
+			RequestsPerSecondTarget:   200.0,
+			PanicThreshold:            2.0,
 			MaxScaleUpRate:            1.0,
+			MaxScaleDownRate:          2.0,
+			PredictionLevelSmoothing:  0.5,
+			PredictionTrendSmoothing:  0.2,
 			StableWindow:              5 * time.Minute,
 			PanicWindow:               10 * time.Second,
 			ScaleToZeroThreshold:      10 * time.Minute,
 			ConcurrencyQuantumOfTime:  100 * time.Millisecond,
 			TickInterval:              2 * time.Second,
+			InitialScale:              1,
+			TargetUtilization:         1.0,
+			ScaleToZeroGracePeriod:    2 * time.Minute,
 		},
 	}, {
 		name: "missing required float field",
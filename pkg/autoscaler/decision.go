@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DecidersPathPrefix is the prefix of the paths served by DecisionHandler,
+// which are /debug/deciders/{namespace}/{revision}.
+const DecidersPathPrefix = "/debug/deciders/"
+
+// The reasons of a Decision.
+const (
+	// DecisionScaleToZero is the reason of revisions scaled to zero for
+	// receiving no request over the scale to zero threshold.
+	DecisionScaleToZero = "ScaleToZero"
+	// DecisionNoData is the reason of revisions left as they are for
+	// lack of stats.
+	DecisionNoData = "NoData"
+	// DecisionScheduled is the reason of revisions without stats scaled to
+	// the minimum scale of an open window of their min scale schedule.
+	DecisionScheduled = "Scheduled"
+	// DecisionMinScale is the reason of revisions without stats scaled to
+	// their min scale.
+	DecisionMinScale = "MinScale"
+	// DecisionStable is the reason of revisions scaled on the stats of
+	// the stable window.
+	DecisionStable = "Stable"
+	// DecisionPanic is the reason of revisions scaled on the stats of
+	// the panic window, for their Scaler calling for panic threshold
+	// times the capacity of a pod.
+	DecisionPanic = "Panic"
+)
+
+// Decision describes the last scale proposed by a Decider, and the stats
+// it was based on, to tell why a revision is at its scale.
+type Decision struct {
+	// Time is when the scale was proposed.
+	Time time.Time `json:"time"`
+	// Reason tells which of the Decision constants the scale follows.
+	Reason string `json:"reason"`
+	// DesiredScale is the scale proposed, when Scaled is set.
+	DesiredScale int32 `json:"desiredScale"`
+	Scaled       bool  `json:"scaled"`
+	// Adjustments lists how the scale computed from the windows was
+	// raised to become DesiredScale.
+	Adjustments []string `json:"adjustments,omitempty"`
+
+	// Scaler is the name of the Scaler the windows are scaled with.
+	Scaler              string         `json:"scaler"`
+	TargetConcurrency   float64        `json:"targetConcurrency"`
+	Stable              WindowDecision `json:"stable"`
+	Panic               WindowDecision `json:"panic"`
+	Panicking           bool           `json:"panicking"`
+	ExcessBurstCapacity float64        `json:"excessBurstCapacity"`
+	// MetricValue is the value of the metric source of revisions scaled
+	// on one.
+	MetricValue float64 `json:"metricValue,omitempty"`
+	// PendingRequests are the requests waiting on the activator for the
+	// revision to have an active endpoint.
+	PendingRequests int32 `json:"pendingRequests,omitempty"`
+	// PredictedPodCount is the pod count forecast over the prediction
+	// horizon of revisions scaled on a forecast.
+	PredictedPodCount float64 `json:"predictedPodCount,omitempty"`
+
+	// Stats are the stats in the stable window as of now, rather than as
+	// of Time, ordered by time.
+	Stats []Stat `json:"stats"`
+}
+
+// WindowDecision describes the stats of a window, and the scale they call
+// for.
+type WindowDecision struct {
+	Window                          string  `json:"window"`
+	Samples                         int32   `json:"samples"`
+	ObservedPods                    int     `json:"observedPods"`
+	ObservedConcurrencyPerPod       float64 `json:"observedConcurrencyPerPod"`
+	ObservedRequestsPerSecondPerPod float64 `json:"observedRequestsPerSecondPerPod"`
+	DesiredPodCount                 float64 `json:"desiredPodCount"`
+}
+
+// Decision returns the last scale proposed and the stats in the stable
+// window.
+func (a *Autoscaler) Decision() Decision {
+	a.statsMutex.Lock()
+	defer a.statsMutex.Unlock()
+	d := a.decision
+	d.Stats = make([]Stat, 0, len(a.stats))
+	for _, stat := range a.stats {
+		d.Stats = append(d.Stats, stat)
+	}
+	sort.Slice(d.Stats, func(i, j int) bool {
+		if !d.Stats[i].Time.Equal(*d.Stats[j].Time) {
+			return d.Stats[i].Time.Before(*d.Stats[j].Time)
+		}
+		return d.Stats[i].PodName < d.Stats[j].PodName
+	})
+	return d
+}
+
+// DecisionHandler serves as JSON the Decision of the Decider of the
+// revision named by the path.
+func DecisionHandler(m *MultiScaler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, DecidersPathPrefix), "/")
+		if !strings.HasPrefix(r.URL.Path, DecidersPathPrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		d, ok := m.Decision(parts[0], parts[1])
+		if !ok {
+			http.Error(w, "no decider for revision "+parts[0]+"/"+parts[1], http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/autoscaler"
+)
+
+func TestDecisionHandler(t *testing.T) {
+	ms, stopCh, _, decider, logger := createMultiScaler(&autoscaler.Config{
+		TickInterval: time.Hour,
+	})
+	defer close(stopCh)
+
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	decider.setScaleResult(7, true)
+	ms.OnPresent(revision, logger)
+	h := autoscaler.DecisionHandler(ms)
+
+	for _, tc := range []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{{
+		name:       "revision with a decider",
+		path:       autoscaler.DecidersPathPrefix + revision.Namespace + "/" + revision.Name,
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "revision without a decider",
+		path:       autoscaler.DecidersPathPrefix + revision.Namespace + "/other",
+		wantStatus: http.StatusNotFound,
+	}, {
+		name:       "no revision",
+		path:       autoscaler.DecidersPathPrefix + revision.Namespace,
+		wantStatus: http.StatusNotFound,
+	}, {
+		name:       "extra segment",
+		path:       autoscaler.DecidersPathPrefix + revision.Namespace + "/" + revision.Name + "/more",
+		wantStatus: http.StatusNotFound,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var d autoscaler.Decision
+			if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+				t.Fatalf("Error decoding decision: %v", err)
+			}
+			if d.DesiredScale != 7 || !d.Scaled {
+				t.Errorf("Decision = %+v, want desired scale 7", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	externalMetricsAPI = "/apis/external.metrics.k8s.io/v1beta1"
+	customMetricsAPI   = "/apis/custom.metrics.k8s.io/v1beta1"
+
+	// metricSourceTimeout bounds how long the metrics APIs may take to
+	// return the value of a metric.
+	metricSourceTimeout = 5 * time.Second
+)
+
+// MetricSource provides the value of the metric a revision is scaled on
+// from outside of the stats of its pods.
+type MetricSource interface {
+	// Value returns the current value of the metric, summed over all of
+	// its series.
+	Value() (float64, error)
+}
+
+// NewMetricSource returns the MetricSource of the External or Custom metric
+// of the given revision, querying the metrics APIs with the given client,
+// or nil for revisions scaled on the stats of their pods.
+func NewMetricSource(client rest.Interface, rev *v1alpha1.Revision, annotations *autoscaling.Annotations) MetricSource {
+	switch annotations.Metric {
+	case autoscaling.External:
+		return &metricsAPISource{
+			client:   client,
+			path:     []string{externalMetricsAPI, "namespaces", rev.Namespace, annotations.MetricName},
+			selector: annotations.MetricSelector,
+		}
+	case autoscaling.Custom:
+		return &metricsAPISource{
+			client:   client,
+			path:     []string{customMetricsAPI, "namespaces", rev.Namespace, "pods", "*", annotations.MetricName},
+			selector: fmt.Sprintf("%s=%s", serving.RevisionLabelKey, rev.Name),
+		}
+	}
+	return nil
+}
+
+// metricsAPISource is a MetricSource summing the values listed by the
+// external or custom metrics API at a path.
+type metricsAPISource struct {
+	client   rest.Interface
+	path     []string
+	selector string
+}
+
+// metricValueList holds what the MetricSource needs of the
+// ExternalMetricValueList and MetricValueList of the metrics APIs.
+type metricValueList struct {
+	Items []struct {
+		Value resource.Quantity `json:"value"`
+	} `json:"items"`
+}
+
+// Value implements MetricSource
+func (s *metricsAPISource) Value() (float64, error) {
+	req := s.client.Get().AbsPath(s.path...).Timeout(metricSourceTimeout)
+	if s.selector != "" {
+		req = req.Param("labelSelector", s.selector)
+	}
+	body, err := req.Do().Raw()
+	if err != nil {
+		return 0, err
+	}
+	var list metricValueList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return 0, err
+	}
+	sum := float64(0)
+	for _, item := range list.Items {
+		sum += float64(item.Value.MilliValue()) / 1000
+	}
+	return sum, nil
+}
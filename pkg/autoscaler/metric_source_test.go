@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+func TestMetricSource(t *testing.T) {
+	rev := &v1alpha1.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test-namespace",
+			Name:      "test-revision",
+		},
+	}
+	tests := []struct {
+		name         string
+		annotations  *autoscaling.Annotations
+		wantPath     string
+		wantSelector string
+	}{{
+		name: "external",
+		annotations: &autoscaling.Annotations{
+			Metric:         autoscaling.External,
+			MetricName:     "kafka_consumergroup_lag",
+			MetricSelector: "topic=orders",
+		},
+		wantPath:     "/apis/external.metrics.k8s.io/v1beta1/namespaces/test-namespace/kafka_consumergroup_lag",
+		wantSelector: "topic=orders",
+	}, {
+		name: "custom",
+		annotations: &autoscaling.Annotations{
+			Metric:     autoscaling.Custom,
+			MetricName: "jobs_in_progress",
+		},
+		wantPath:     "/apis/custom.metrics.k8s.io/v1beta1/namespaces/test-namespace/pods/*/jobs_in_progress",
+		wantSelector: "serving.knative.dev/revision=test-revision",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != test.wantPath {
+					t.Errorf("Path = %q, want %q", r.URL.Path, test.wantPath)
+				}
+				if got := r.URL.Query().Get("labelSelector"); got != test.wantSelector {
+					t.Errorf("labelSelector = %q, want %q", got, test.wantSelector)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"items": [{"value": "1500m"}, {"value": "40"}]}`))
+			}))
+			defer server.Close()
+
+			source := NewMetricSource(newMetricsClient(t, server.URL), rev, test.annotations)
+			got, err := source.Value()
+			if err != nil {
+				t.Fatalf("Value() = %v", err)
+			}
+			if got != 41.5 {
+				t.Errorf("Value() = %v, want 41.5", got)
+			}
+		})
+	}
+}
+
+func TestMetricSource_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such metric", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	source := NewMetricSource(newMetricsClient(t, server.URL), &v1alpha1.Revision{}, &autoscaling.Annotations{
+		Metric:     autoscaling.External,
+		MetricName: "missing",
+	})
+	if got, err := source.Value(); err == nil {
+		t.Errorf("Value() = %v, wanted an error", got)
+	}
+}
+
+func TestMetricSource_StatsMetrics(t *testing.T) {
+	for _, metric := range []string{"", autoscaling.Concurrency, autoscaling.RPS} {
+		if source := NewMetricSource(nil, &v1alpha1.Revision{}, &autoscaling.Annotations{Metric: metric}); source != nil {
+			t.Errorf("NewMetricSource(%q) = %v, want nil", metric, source)
+		}
+	}
+}
+
+func newMetricsClient(t *testing.T, host string) rest.Interface {
+	t.Helper()
+	client, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: host})
+	if err != nil {
+		t.Fatalf("NewDiscoveryClientForConfig() = %v", err)
+	}
+	return client.RESTClient()
+}
@@ -22,6 +22,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/logging"
 	"github.com/knative/serving/pkg/logging/logkey"
@@ -36,29 +37,54 @@ const (
 	scaleBufferSize = 10
 )
 
-// UniScaler records statistics for a particular revision and proposes the scale for the revision based on those statistics.
-type UniScaler interface {
+// Decider records statistics for a particular revision and proposes the scale for the revision based on those
+// statistics. It does not collect the statistics itself: they are passed to it however they were collected.
+type Decider interface {
 	// Record records the given statistics.
 	Record(context.Context, Stat)
 
 	// Scale either proposes a number of replicas or skips proposing. The proposal is requested at the given time.
 	// The returned boolean is true if and only if a proposal was returned.
 	Scale(context.Context, time.Time) (int32, bool)
+
+	// ActivatorInPath reports whether the activator should stay in the revision's data path as of the last
+	// proposal, which it should while the spare capacity of the revision's pods is short of the target burst
+	// capacity.
+	ActivatorInPath() bool
+
+	// SetConfig replaces the configuration the proposals are based on.
+	SetConfig(*Config)
+
+	// Decision describes the last proposal and the statistics it was based on.
+	Decision() Decision
+
+	// Checkpoint returns the state of the Decider as of the given time, to be restored by a restarted autoscaler.
+	Checkpoint(time.Time) Checkpoint
+
+	// Restore resumes the Decider from the given checkpoint.
+	Restore(Checkpoint)
 }
 
-// UniScalerFactory creates a UniScaler for a given revision using the given configuration.
-type UniScalerFactory func(*v1alpha1.Revision, *Config) (UniScaler, error)
+// DeciderFactory creates a Decider for a given revision using the given configuration.
+type DeciderFactory func(*v1alpha1.Revision, *Config) (Decider, error)
 
 // RevisionScaler knows how to scale revisions.
 type RevisionScaler interface {
-	// Scale attempts to scale the given revision to the desired scale.
-	Scale(rev *v1alpha1.Revision, desiredScale int32)
+	// Scale attempts to scale the given revision to the desired scale, and publishes whether the activator should
+	// stay in its data path.
+	Scale(rev *v1alpha1.Revision, desiredScale int32, activatorInPath bool)
 }
 
-// scalerRunner wraps a UniScaler and a channel for implementing shutdown behavior.
+// scaleRequest is a decision of a Decider to be applied by a RevisionScaler.
+type scaleRequest struct {
+	desiredScale    int32
+	activatorInPath bool
+}
+
+// scalerRunner wraps a Decider and a channel for implementing shutdown behavior.
 type scalerRunner struct {
-	scaler UniScaler
-	stopCh chan struct{}
+	decider Decider
+	stopCh  chan struct{}
 }
 
 type revisionKey string
@@ -67,36 +93,44 @@ func newRevisionKey(namespace string, name string) revisionKey {
 	return revisionKey(fmt.Sprintf("%s/%s", namespace, name))
 }
 
-// MultiScaler maintains a collection of UniScalers indexed by revisionKey.
+// MultiScaler maintains a collection of Deciders indexed by revisionKey.
 type MultiScaler struct {
 	scalers       map[revisionKey]*scalerRunner
 	scalersMutex  sync.RWMutex
 	scalersStopCh <-chan struct{}
 
-	config *Config
+	config      *Config
+	configMutex sync.RWMutex
 
 	revisionScaler RevisionScaler
 
-	uniScalerFactory UniScalerFactory
+	deciderFactory DeciderFactory
+
+	// checkpoints are restored into the Deciders of their revisions once created.
+	checkpoints map[revisionKey]Checkpoint
 
 	logger *zap.SugaredLogger
 }
 
-// NewMultiScaler constructs a MultiScaler.
-func NewMultiScaler(config *Config, revisionScaler RevisionScaler, stopCh <-chan struct{}, uniScalerFactory UniScalerFactory, logger *zap.SugaredLogger) *MultiScaler {
+// NewMultiScaler constructs a MultiScaler. The Deciders it creates are passed the stats given to RecordStat.
+func NewMultiScaler(config *Config, revisionScaler RevisionScaler, stopCh <-chan struct{}, deciderFactory DeciderFactory,
+	logger *zap.SugaredLogger) *MultiScaler {
 	logger.Debugf("Creating MultiScalar with configuration %#v", config)
 	return &MultiScaler{
-		scalers:          make(map[revisionKey]*scalerRunner),
-		scalersStopCh:    stopCh,
-		config:           config,
-		revisionScaler:   revisionScaler,
-		uniScalerFactory: uniScalerFactory,
-		logger:           logger,
+		scalers:        make(map[revisionKey]*scalerRunner),
+		scalersStopCh:  stopCh,
+		config:         config,
+		revisionScaler: revisionScaler,
+		deciderFactory: deciderFactory,
+		logger:         logger,
 	}
 }
 
-// OnPresent adds, if necessary, a scaler for the given revision.
+// OnPresent adds, if necessary, a scaler for the given revision. Revisions scaled by an HPA are left to it.
 func (m *MultiScaler) OnPresent(rev *v1alpha1.Revision, logger *zap.SugaredLogger) {
+	if rev.Annotations[autoscaling.ClassAnnotationKey] == autoscaling.HPA {
+		return
+	}
 	m.scalersMutex.Lock()
 	defer m.scalersMutex.Unlock()
 	key := newRevisionKey(rev.Namespace, rev.Name)
@@ -109,6 +143,11 @@ func (m *MultiScaler) OnPresent(rev *v1alpha1.Revision, logger *zap.SugaredLogge
 			return
 		}
 		logger.Info("Created scaler for revision.")
+		if checkpoint, ok := m.checkpoints[key]; ok {
+			scaler.decider.Restore(checkpoint)
+			delete(m.checkpoints, key)
+			logger.Info("Restored scaler for revision.")
+		}
 		m.scalers[key] = scaler
 	}
 }
@@ -131,17 +170,18 @@ func loggerWithRevisionInfo(logger *zap.SugaredLogger, ns string, name string) *
 }
 
 func (m *MultiScaler) createScaler(ctx context.Context, rev *v1alpha1.Revision) (*scalerRunner, error) {
-	scaler, err := m.uniScalerFactory(rev, m.config)
+	config := m.getConfig()
+	decider, err := m.deciderFactory(rev, config)
 	if err != nil {
 		return nil, err
 	}
 
 	stopCh := make(chan struct{})
-	runner := &scalerRunner{scaler: scaler, stopCh: stopCh}
+	runner := &scalerRunner{decider: decider, stopCh: stopCh}
 
-	ticker := time.NewTicker(m.config.TickInterval)
+	ticker := time.NewTicker(config.TickInterval)
 
-	scaleChan := make(chan int32, scaleBufferSize)
+	scaleChan := make(chan scaleRequest, scaleBufferSize)
 
 	go func() {
 		for {
@@ -153,7 +193,7 @@ func (m *MultiScaler) createScaler(ctx context.Context, rev *v1alpha1.Revision)
 				ticker.Stop()
 				return
 			case <-ticker.C:
-				m.tickScaler(ctx, scaler, scaleChan)
+				m.tickScaler(ctx, decider, scaleChan)
 			}
 		}
 	}()
@@ -167,8 +207,9 @@ func (m *MultiScaler) createScaler(ctx context.Context, rev *v1alpha1.Revision)
 				return
 			case <-stopCh:
 				return
-			case desiredScale := <-scaleChan:
-				m.revisionScaler.Scale(rev, mostRecentDesiredScale(desiredScale, scaleChan, logger))
+			case req := <-scaleChan:
+				req = mostRecentScaleRequest(req, scaleChan, logger)
+				m.revisionScaler.Scale(rev, req.desiredScale, req.activatorInPath)
 			}
 		}
 	}()
@@ -176,21 +217,21 @@ func (m *MultiScaler) createScaler(ctx context.Context, rev *v1alpha1.Revision)
 	return runner, nil
 }
 
-func mostRecentDesiredScale(desiredScale int32, scaleChan chan int32, logger *zap.SugaredLogger) int32 {
+func mostRecentScaleRequest(req scaleRequest, scaleChan chan scaleRequest, logger *zap.SugaredLogger) scaleRequest {
 	for {
 		select {
-		case desiredScale = <-scaleChan:
+		case req = <-scaleChan:
 			logger.Info("Scaling is not keeping up with autoscaling requests")
 		default:
 			// scaleChan is empty
-			return desiredScale
+			return req
 		}
 	}
 }
 
-func (m *MultiScaler) tickScaler(ctx context.Context, scaler UniScaler, scaleChan chan<- int32) {
+func (m *MultiScaler) tickScaler(ctx context.Context, decider Decider, scaleChan chan<- scaleRequest) {
 	logger := logging.FromContext(ctx)
-	desiredScale, scaled := scaler.Scale(ctx, time.Now())
+	desiredScale, scaled := decider.Scale(ctx, time.Now())
 
 	if scaled {
 		// Cannot scale negative.
@@ -200,12 +241,72 @@ func (m *MultiScaler) tickScaler(ctx context.Context, scaler UniScaler, scaleCha
 		}
 
 		// Don't scale to zero if scale to zero is disabled.
-		if desiredScale == 0 && !m.config.EnableScaleToZero {
+		if desiredScale == 0 && !m.getConfig().EnableScaleToZero {
 			logger.Warn("Cannot scale: Desired scale == 0 && EnableScaleToZero == false.")
 			return
 		}
 
-		scaleChan <- desiredScale
+		scaleChan <- scaleRequest{
+			desiredScale:    desiredScale,
+			activatorInPath: decider.ActivatorInPath(),
+		}
+	}
+}
+
+// SetConfig applies the given configuration to the Deciders of all revisions.
+// The tick interval of existing scalers is left unchanged.
+func (m *MultiScaler) SetConfig(config *Config) {
+	m.configMutex.Lock()
+	m.config = config
+	m.configMutex.Unlock()
+
+	m.scalersMutex.RLock()
+	defer m.scalersMutex.RUnlock()
+	for _, scaler := range m.scalers {
+		scaler.decider.SetConfig(config)
+	}
+}
+
+func (m *MultiScaler) getConfig() *Config {
+	m.configMutex.RLock()
+	defer m.configMutex.RUnlock()
+	return m.config
+}
+
+// Decision returns the Decision of the Decider of the revision in the given namespace and with the given name, and
+// whether the revision has one.
+func (m *MultiScaler) Decision(namespace, name string) (Decision, bool) {
+	m.scalersMutex.RLock()
+	defer m.scalersMutex.RUnlock()
+	scaler, exists := m.scalers[newRevisionKey(namespace, name)]
+	if !exists {
+		return Decision{}, false
+	}
+	return scaler.decider.Decision(), true
+}
+
+// Checkpoints returns the checkpoints of the Deciders of all revisions as of the given time, keyed by revisions of
+// the form namespace/name.
+func (m *MultiScaler) Checkpoints(now time.Time) map[string]Checkpoint {
+	m.scalersMutex.RLock()
+	defer m.scalersMutex.RUnlock()
+	checkpoints := make(map[string]Checkpoint, len(m.scalers))
+	for key, scaler := range m.scalers {
+		checkpoints[string(key)] = scaler.decider.Checkpoint(now)
+	}
+	return checkpoints
+}
+
+// RestoreCheckpoints restores the given checkpoints, keyed by revisions of the form namespace/name, into the
+// Deciders of their revisions when they are created. Checkpoints of revisions which already have one are dropped.
+func (m *MultiScaler) RestoreCheckpoints(checkpoints map[string]Checkpoint) {
+	m.scalersMutex.Lock()
+	defer m.scalersMutex.Unlock()
+	m.checkpoints = make(map[revisionKey]Checkpoint, len(checkpoints))
+	for key, checkpoint := range checkpoints {
+		if _, exists := m.scalers[revisionKey(key)]; !exists {
+			m.checkpoints[revisionKey(key)] = checkpoint
+		}
 	}
 }
 
@@ -224,6 +325,6 @@ func (m *MultiScaler) RecordStat(revKey string, stat Stat) {
 		}
 		logger := loggerWithRevisionInfo(m.logger, namespace, name)
 		ctx := logging.WithLogger(context.TODO(), logger)
-		scaler.scaler.Record(ctx, stat)
+		scaler.decider.Record(ctx, stat)
 	}
 }
@@ -22,18 +22,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/autoscaler"
 	"go.uber.org/zap"
 )
 
 func TestMultiScalerScaling(t *testing.T) {
-	ms, _, revisionScaler, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval: time.Millisecond * 1,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(1, true)
+	decider.setScaleResult(1, true)
 
 	ms.OnPresent(revision, logger)
 
@@ -44,13 +45,49 @@ func TestMultiScalerScaling(t *testing.T) {
 	revisionScaler.checkScaleNoLongerCalled(t)
 }
 
+func TestMultiScalerPublishesActivatorInPath(t *testing.T) {
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
+		TickInterval: time.Millisecond * 1,
+	})
+
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	decider.setScaleResult(1, true)
+	decider.setActivatorInPath(true)
+
+	ms.OnPresent(revision, logger)
+	defer ms.OnAbsent(revision.Namespace, revision.Name, logger)
+
+	revisionScaler.checkScaleCall(t, 0, revision, 1)
+	if !revisionScaler.scaleParameters[0].activatorInPath {
+		t.Error("Scale was called with the activator out of path despite the decider keeping it in")
+	}
+}
+
+func TestMultiScalerIgnoresHPAClassRevisions(t *testing.T) {
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
+		TickInterval: time.Millisecond * 1,
+	})
+
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	revision.Annotations = map[string]string{
+		autoscaling.ClassAnnotationKey: autoscaling.HPA,
+	}
+	decider.setScaleResult(1, true)
+
+	ms.OnPresent(revision, logger)
+
+	revisionScaler.checkScaleNoLongerCalled(t)
+
+	ms.OnAbsent(revision.Namespace, revision.Name, logger)
+}
+
 func TestMultiScalerStop(t *testing.T) {
-	ms, stopChan, revisionScaler, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, stopChan, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval: time.Millisecond * 1,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(1, true)
+	decider.setScaleResult(1, true)
 
 	close(stopChan)
 
@@ -62,13 +99,13 @@ func TestMultiScalerStop(t *testing.T) {
 }
 
 func TestMultiScalerScaleToZeroWhenEnabled(t *testing.T) {
-	ms, _, revisionScaler, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval:      time.Millisecond * 1,
 		EnableScaleToZero: true,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(0, true)
+	decider.setScaleResult(0, true)
 
 	ms.OnPresent(revision, logger)
 
@@ -80,13 +117,13 @@ func TestMultiScalerScaleToZeroWhenEnabled(t *testing.T) {
 }
 
 func TestMultiScalerDoesNotScaleToZeroWhenDisabled(t *testing.T) {
-	ms, _, revisionScaler, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval:      time.Millisecond * 1,
 		EnableScaleToZero: false,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(0, true)
+	decider.setScaleResult(0, true)
 
 	ms.OnPresent(revision, logger)
 
@@ -96,12 +133,12 @@ func TestMultiScalerDoesNotScaleToZeroWhenDisabled(t *testing.T) {
 }
 
 func TestMultiScalerIgnoresNegativeScales(t *testing.T) {
-	ms, _, revisionScaler, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, _, revisionScaler, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval: time.Millisecond * 1,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(-1, true)
+	decider.setScaleResult(-1, true)
 
 	ms.OnPresent(revision, logger)
 
@@ -111,12 +148,12 @@ func TestMultiScalerIgnoresNegativeScales(t *testing.T) {
 }
 
 func TestMultiScalerRecordsStatistics(t *testing.T) {
-	ms, _, _, uniScaler, logger := createMultiScaler(&autoscaler.Config{
+	ms, _, _, decider, logger := createMultiScaler(&autoscaler.Config{
 		TickInterval: time.Millisecond * 1,
 	})
 
 	revision := newRevision(v1alpha1.RevisionServingStateActive)
-	uniScaler.setScaleResult(1, true)
+	decider.setScaleResult(1, true)
 
 	ms.OnPresent(revision, logger)
 
@@ -129,11 +166,11 @@ func TestMultiScalerRecordsStatistics(t *testing.T) {
 	}
 
 	ms.RecordStat(testRevisionKey, testStat)
-	uniScaler.checkLastStat(t, testStat)
+	decider.checkLastStat(t, testStat)
 
 	testStat.RequestCount = 10
 	ms.RecordStat(testRevisionKey, testStat)
-	uniScaler.checkLastStat(t, testStat)
+	decider.checkLastStat(t, testStat)
 
 	ms.OnAbsent(revision.Namespace, revision.Name, logger)
 
@@ -141,41 +178,92 @@ func TestMultiScalerRecordsStatistics(t *testing.T) {
 	newStat := testStat
 	newStat.RequestCount = 30
 	ms.RecordStat(testRevisionKey, newStat)
-	uniScaler.checkLastStat(t, testStat)
+	decider.checkLastStat(t, testStat)
 }
 
-func createMultiScaler(config *autoscaler.Config) (*autoscaler.MultiScaler, chan<- struct{}, *fakeRevisionScaler, *fakeUniScaler, *zap.SugaredLogger) {
+func TestMultiScalerSetConfig(t *testing.T) {
+	ms, _, _, decider, logger := createMultiScaler(&autoscaler.Config{
+		TickInterval: time.Hour,
+	})
+
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	ms.OnPresent(revision, logger)
+	defer ms.OnAbsent(revision.Namespace, revision.Name, logger)
+
+	config := &autoscaler.Config{
+		TickInterval:      time.Hour,
+		EnableScaleToZero: true,
+	}
+	ms.SetConfig(config)
+
+	if got := decider.getConfig(); got != config {
+		t.Errorf("Decider config = %#v, want %#v", got, config)
+	}
+}
+
+func TestMultiScalerCheckpoints(t *testing.T) {
+	ms, _, _, decider, logger := createMultiScaler(&autoscaler.Config{
+		TickInterval: time.Hour,
+	})
+
+	saved := time.Now().Add(-time.Minute)
+	ms.RestoreCheckpoints(map[string]autoscaler.Checkpoint{
+		testRevisionKey: {Time: saved, ReceivedTraffic: true},
+	})
+	if decider.getRestored() != nil {
+		t.Fatal("Checkpoint restored before the revision was present")
+	}
+
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	ms.OnPresent(revision, logger)
+	defer ms.OnAbsent(revision.Namespace, revision.Name, logger)
+
+	if got := decider.getRestored(); got == nil || !got.Time.Equal(saved) || !got.ReceivedTraffic {
+		t.Errorf("Restored checkpoint = %#v, want the one saved at %v", got, saved)
+	}
+
+	now := time.Now()
+	checkpoints := ms.Checkpoints(now)
+	if got, ok := checkpoints[testRevisionKey]; len(checkpoints) != 1 || !ok || !got.Time.Equal(now) {
+		t.Errorf("Checkpoints() = %#v, want one for %s as of %v", checkpoints, testRevisionKey, now)
+	}
+}
+
+func createMultiScaler(config *autoscaler.Config) (*autoscaler.MultiScaler, chan<- struct{}, *fakeRevisionScaler, *fakeDecider, *zap.SugaredLogger) {
 	logger := zap.NewNop().Sugar()
 	revisionScaler := &fakeRevisionScaler{
 		scaleChan: make(chan scaleParameterValues),
 	}
-	uniscaler := &fakeUniScaler{}
+	decider := &fakeDecider{}
 
 	stopChan := make(chan struct{})
-	ms := autoscaler.NewMultiScaler(config, revisionScaler, stopChan, uniscaler.fakeUniScalerFactory, logger)
+	ms := autoscaler.NewMultiScaler(config, revisionScaler, stopChan, decider.fakeDeciderFactory, logger)
 
-	return ms, stopChan, revisionScaler, uniscaler, logger
+	return ms, stopChan, revisionScaler, decider, logger
 }
 
-type fakeUniScaler struct {
-	mutex    sync.Mutex
-	replicas int32
-	scaled   bool
-	lastStat autoscaler.Stat
+type fakeDecider struct {
+	mutex               sync.Mutex
+	replicas            int32
+	scaled              bool
+	activatorInPath     bool
+	lastStat            autoscaler.Stat
+	config              *autoscaler.Config
+	restored            *autoscaler.Checkpoint
 }
 
-func (u *fakeUniScaler) fakeUniScalerFactory(*v1alpha1.Revision, *autoscaler.Config) (autoscaler.UniScaler, error) {
+func (u *fakeDecider) fakeDeciderFactory(*v1alpha1.Revision, *autoscaler.Config) (autoscaler.Decider, error) {
 	return u, nil
 }
 
-func (u *fakeUniScaler) Scale(context.Context, time.Time) (int32, bool) {
+func (u *fakeDecider) Scale(context.Context, time.Time) (int32, bool) {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
 	return u.replicas, u.scaled
 }
 
-func (u *fakeUniScaler) setScaleResult(replicas int32, scaled bool) {
+func (u *fakeDecider) setScaleResult(replicas int32, scaled bool) {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
@@ -183,14 +271,66 @@ func (u *fakeUniScaler) setScaleResult(replicas int32, scaled bool) {
 	u.scaled = scaled
 }
 
-func (u *fakeUniScaler) Record(ctx context.Context, stat autoscaler.Stat) {
+func (u *fakeDecider) ActivatorInPath() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.activatorInPath
+}
+
+func (u *fakeDecider) setActivatorInPath(activatorInPath bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.activatorInPath = activatorInPath
+}
+
+func (u *fakeDecider) SetConfig(config *autoscaler.Config) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.config = config
+}
+
+func (u *fakeDecider) getConfig() *autoscaler.Config {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.config
+}
+
+func (u *fakeDecider) Decision() autoscaler.Decision {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return autoscaler.Decision{DesiredScale: u.replicas, Scaled: u.scaled}
+}
+
+func (u *fakeDecider) Checkpoint(now time.Time) autoscaler.Checkpoint {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return autoscaler.Checkpoint{Time: now}
+}
+
+func (u *fakeDecider) Restore(checkpoint autoscaler.Checkpoint) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.restored = &checkpoint
+}
+
+func (u *fakeDecider) getRestored() *autoscaler.Checkpoint {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.restored
+}
+
+func (u *fakeDecider) Record(ctx context.Context, stat autoscaler.Stat) {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
 	u.lastStat = stat
 }
 
-func (u *fakeUniScaler) checkLastStat(t *testing.T, stat autoscaler.Stat) {
+func (u *fakeDecider) checkLastStat(t *testing.T, stat autoscaler.Stat) {
 	t.Helper()
 
 	if u.lastStat != stat {
@@ -199,8 +339,9 @@ func (u *fakeUniScaler) checkLastStat(t *testing.T, stat autoscaler.Stat) {
 }
 
 type scaleParameterValues struct {
-	revision *v1alpha1.Revision
-	replicas int32
+	revision        *v1alpha1.Revision
+	replicas        int32
+	activatorInPath bool
 }
 
 type fakeRevisionScaler struct {
@@ -208,8 +349,8 @@ type fakeRevisionScaler struct {
 	scaleChan       chan scaleParameterValues
 }
 
-func (rs *fakeRevisionScaler) Scale(rev *v1alpha1.Revision, desiredScale int32) {
-	rs.scaleChan <- scaleParameterValues{rev, desiredScale}
+func (rs *fakeRevisionScaler) Scale(rev *v1alpha1.Revision, desiredScale int32, activatorInPath bool) {
+	rs.scaleChan <- scaleParameterValues{rev, desiredScale, activatorInPath}
 }
 
 func (rs *fakeRevisionScaler) awaitScale(t *testing.T, n int) {
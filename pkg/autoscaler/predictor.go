@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"time"
+)
+
+// predictor forecasts a series observed at irregular intervals with Holt's
+// linear trend method: the level of the series and its trend per second
+// are exponentially smoothed, weighting the latest observation by
+// levelSmoothing and the latest change of level by trendSmoothing.
+type predictor struct {
+	levelSmoothing float64
+	trendSmoothing float64
+
+	level float64
+	trend float64
+	last  time.Time
+	// observations counts up to the two observations needed for a trend.
+	observations int
+}
+
+func newPredictor(levelSmoothing, trendSmoothing float64) *predictor {
+	return &predictor{
+		levelSmoothing: levelSmoothing,
+		trendSmoothing: trendSmoothing,
+	}
+}
+
+// observe updates the level and trend of the series with its value at t.
+// Values observed no later than the previous one are ignored.
+func (p *predictor) observe(t time.Time, value float64) {
+	if p.observations == 0 {
+		p.level = value
+		p.last = t
+		p.observations++
+		return
+	}
+	if !t.After(p.last) {
+		return
+	}
+	dt := t.Sub(p.last).Seconds()
+	level := p.levelSmoothing*value + (1-p.levelSmoothing)*(p.level+p.trend*dt)
+	trend := (level - p.level) / dt
+	if p.observations > 1 {
+		trend = p.trendSmoothing*trend + (1-p.trendSmoothing)*p.trend
+	}
+	p.level, p.trend, p.last = level, trend, t
+	if p.observations < 2 {
+		p.observations++
+	}
+}
+
+// forecast returns the value of the series forecast at t, and whether
+// enough of it was observed for a trend.
+func (p *predictor) forecast(t time.Time) (float64, bool) {
+	if p.observations < 2 {
+		return 0, false
+	}
+	return p.level + p.trend*t.Sub(p.last).Seconds(), true
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPredictor(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		series func(seconds float64) float64
+		// at is how many seconds after the last observation the series
+		// is forecast.
+		at   float64
+		want float64
+	}{{
+		name:   "constant",
+		series: func(float64) float64 { return 7 },
+		at:     60,
+		want:   7,
+	}, {
+		name:   "linear ramp",
+		series: func(s float64) float64 { return 10 + 0.5*s },
+		at:     60,
+		// The ramp reaches 10 + 0.5 * (118 + 60) seconds.
+		want: 99,
+	}, {
+		name:   "linear decline",
+		series: func(s float64) float64 { return 100 - s/2 },
+		at:     30,
+		want:   26,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newPredictor(0.5, 0.2)
+			if _, ok := p.forecast(start); ok {
+				t.Fatal("Forecast without observations")
+			}
+			var last time.Time
+			for s := 0.0; s < 120; s += 2 {
+				last = start.Add(time.Duration(s) * time.Second)
+				p.observe(last, test.series(s))
+			}
+			got, ok := p.forecast(last.Add(time.Duration(test.at) * time.Second))
+			if !ok {
+				t.Fatal("No forecast after 60 observations")
+			}
+			if math.Abs(got-test.want) > 0.01 {
+				t.Errorf("forecast() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPredictor_IgnoresOutOfOrderObservations(t *testing.T) {
+	start := time.Now()
+	p := newPredictor(0.5, 0.2)
+	p.observe(start, 10)
+	p.observe(start, 1000)
+	p.observe(start.Add(-time.Second), 1000)
+	if _, ok := p.forecast(start); ok {
+		t.Error("Forecast with a single observation in order")
+	}
+	p.observe(start.Add(time.Second), 10)
+	if got, _ := p.forecast(start.Add(time.Minute)); got != 10 {
+		t.Errorf("forecast() = %v, want 10", got)
+	}
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package autoscaler
 
 import (
+	"time"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
 	"github.com/knative/serving/pkg/controller/revision/resources/names"
 	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -29,20 +34,25 @@ import (
 type revisionScaler struct {
 	servingClientSet clientset.Interface
 	kubeClientSet    kubernetes.Interface
+	newReporter      StatsReporterFactory
 	logger           *zap.SugaredLogger
 }
 
-// NewRevisionScaler creates a revisionScaler.
-func NewRevisionScaler(servingClientSet clientset.Interface, kubeClientSet kubernetes.Interface, logger *zap.SugaredLogger) RevisionScaler {
+// NewRevisionScaler creates a revisionScaler reporting the desired and actual pod counts of revisions with the
+// reporters created by newReporter.
+func NewRevisionScaler(servingClientSet clientset.Interface, kubeClientSet kubernetes.Interface, newReporter StatsReporterFactory,
+	logger *zap.SugaredLogger) RevisionScaler {
 	return &revisionScaler{
 		servingClientSet: servingClientSet,
 		kubeClientSet:    kubeClientSet,
+		newReporter:      newReporter,
 		logger:           logger,
 	}
 }
 
-// Scale attempts to scale the given revision to the desired scale.
-func (rs *revisionScaler) Scale(oldRev *v1alpha1.Revision, desiredScale int32) {
+// Scale attempts to scale the given revision to the desired scale, and publishes whether the activator should
+// stay in its data path.
+func (rs *revisionScaler) Scale(oldRev *v1alpha1.Revision, desiredScale int32, activatorInPath bool) {
 	logger := loggerWithRevisionInfo(rs.logger, oldRev.Namespace, oldRev.Name)
 
 	// Do not scale an inactive revision.
@@ -50,9 +60,17 @@ func (rs *revisionScaler) Scale(oldRev *v1alpha1.Revision, desiredScale int32) {
 	revisionClient := rs.servingClientSet.ServingV1alpha1().Revisions(oldRev.Namespace)
 	rev, err := revisionClient.Get(oldRev.Name, metav1.GetOptions{})
 	if err == nil && rev.Spec.ServingState != v1alpha1.RevisionServingStateActive {
+		if rev.Spec.ServingState == v1alpha1.RevisionServingStateReserve && desiredScale > 0 {
+			rs.activate(rev, logger)
+		}
 		return
 	}
 
+	// A revision scaled to zero is routed through the activator regardless.
+	if err == nil && desiredScale > 0 {
+		rs.publishActivatorInPath(rev, activatorInPath, logger)
+	}
+
 	// Get the revision's deployment.
 	//TODO scale the revision's scaleTargetRef. See https://github.com/knative/serving/issues/1507
 	deploymentName := names.Deployment(oldRev)
@@ -62,6 +80,7 @@ func (rs *revisionScaler) Scale(oldRev *v1alpha1.Revision, desiredScale int32) {
 		return
 	}
 	currentScale := *deployment.Spec.Replicas
+	rs.reportPodCounts(oldRev, desiredScale, deployment, logger)
 
 	if desiredScale == currentScale {
 		return
@@ -96,3 +115,61 @@ func (rs *revisionScaler) Scale(oldRev *v1alpha1.Revision, desiredScale int32) {
 
 	logger.Debug("Successfully scaled.")
 }
+
+// activate activates the revision when it has a min scale, when a window of its min scale schedule is open, or when
+// it is scaled on a metric source, for the revision controller to scale its deployment from zero. Otherwise revisions
+// are only activated by the activator.
+func (rs *revisionScaler) activate(rev *v1alpha1.Revision, logger *zap.SugaredLogger) {
+	annotations, err := autoscaling.ParseAnnotations(rev.Annotations)
+	if err != nil {
+		logger.Error("Error parsing autoscaling annotations.", zap.Error(err))
+		return
+	}
+	switch {
+	case annotations.MinScale > 0:
+		logger.Infof("Activating revision for its min scale of %d.", annotations.MinScale)
+	case annotations.MinScaleSchedule.MinScale(time.Now()) > 0:
+		logger.Info("Activating revision for its min scale schedule.")
+	case annotations.Metric == autoscaling.External || annotations.Metric == autoscaling.Custom:
+		logger.Infof("Activating revision for its %s metric %q.", annotations.Metric, annotations.MetricName)
+	default:
+		return
+	}
+	rev = rev.DeepCopy()
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateActive
+	if _, err := rs.servingClientSet.ServingV1alpha1().Revisions(rev.Namespace).Update(rev); err != nil {
+		logger.Error("Error updating revision serving state.", zap.Error(err))
+	}
+}
+
+// reportPodCounts reports the desired pod count of the revision along with those of its deployment.
+func (rs *revisionScaler) reportPodCounts(rev *v1alpha1.Revision, desiredScale int32, deployment *appsv1.Deployment, logger *zap.SugaredLogger) {
+	reporter, err := rs.newReporter(rev)
+	if err != nil {
+		logger.Error("Error creating stats reporter.", zap.Error(err))
+		return
+	}
+	reporter.Report(DesiredPodCountM, float64(desiredScale))
+	reporter.Report(RequestedPodCountM, float64(deployment.Status.Replicas))
+	reporter.Report(ActualPodCountM, float64(deployment.Status.ReadyReplicas))
+}
+
+// publishActivatorInPath records on the revision whether routes should keep the activator in its data path.
+func (rs *revisionScaler) publishActivatorInPath(rev *v1alpha1.Revision, activatorInPath bool, logger *zap.SugaredLogger) {
+	if (rev.Annotations[serving.ActivatorInPathAnnotationKey] == "true") == activatorInPath {
+		return
+	}
+	rev = rev.DeepCopy()
+	if activatorInPath {
+		if rev.Annotations == nil {
+			rev.Annotations = make(map[string]string)
+		}
+		rev.Annotations[serving.ActivatorInPathAnnotationKey] = "true"
+	} else {
+		delete(rev.Annotations, serving.ActivatorInPathAnnotationKey)
+	}
+	logger.Infof("Setting activator in path to %v", activatorInPath)
+	if _, err := rs.servingClientSet.ServingV1alpha1().Revisions(rev.Namespace).Update(rev); err != nil {
+		logger.Error("Error updating revision activator in path annotation.", zap.Error(err))
+	}
+}
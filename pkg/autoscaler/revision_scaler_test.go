@@ -19,6 +19,8 @@ package autoscaler_test
 import (
 	"testing"
 
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/autoscaler"
 	clientset "github.com/knative/serving/pkg/client/clientset/versioned"
@@ -45,7 +47,7 @@ func TestRevisionScalerScalesToZero(t *testing.T) {
 
 	revisionScaler, servingClient, _ := createRevisionScaler(t, revision, deployment)
 
-	revisionScaler.Scale(revision, 0)
+	revisionScaler.Scale(revision, 0, false)
 
 	checkServingState(t, servingClient, v1alpha1.RevisionServingStateReserve)
 }
@@ -55,7 +57,7 @@ func TestRevisionScalerScalesUp(t *testing.T) {
 	deployment := newDeployment(revision, 1)
 	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
 
-	revisionScaler.Scale(revision, 10)
+	revisionScaler.Scale(revision, 10, false)
 
 	checkServingState(t, servingClient, v1alpha1.RevisionServingStateActive)
 	checkReplicas(t, kubeClient, deployment, 10)
@@ -66,28 +68,130 @@ func TestRevisionScalerDoesScaleUpInactiveRevision(t *testing.T) {
 	deployment := newDeployment(revision, 1)
 	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
 
-	revisionScaler.Scale(revision, 10)
+	revisionScaler.Scale(revision, 10, false)
 
 	checkServingState(t, servingClient, v1alpha1.RevisionServingStateReserve)
 	checkReplicas(t, kubeClient, deployment, 1)
 }
 
+func TestRevisionScalerActivatesScheduledRevision(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateReserve)
+	revision.Annotations = map[string]string{
+		autoscaling.MinScaleScheduleAnnotationKey: "* * * * * 1h 3",
+	}
+	deployment := newDeployment(revision, 0)
+	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
+
+	revisionScaler.Scale(revision, 3, false)
+
+	// The revision controller scales the deployment of the activated revision.
+	checkServingState(t, servingClient, v1alpha1.RevisionServingStateActive)
+	checkReplicas(t, kubeClient, deployment, 0)
+}
+
+func TestRevisionScalerActivatesMinScaleRevision(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateReserve)
+	revision.Annotations = map[string]string{
+		autoscaling.MinScaleAnnotationKey: "2",
+	}
+	deployment := newDeployment(revision, 0)
+	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
+
+	revisionScaler.Scale(revision, 2, false)
+
+	checkServingState(t, servingClient, v1alpha1.RevisionServingStateActive)
+	checkReplicas(t, kubeClient, deployment, 0)
+}
+
+func TestRevisionScalerDoesNotActivateOutsideOfSchedule(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateReserve)
+	// Scheduled on February 30th, which never comes.
+	revision.Annotations = map[string]string{
+		autoscaling.MinScaleScheduleAnnotationKey: "0 0 30 2 * 1h 3",
+	}
+	deployment := newDeployment(revision, 0)
+	revisionScaler, servingClient, _ := createRevisionScaler(t, revision, deployment)
+
+	revisionScaler.Scale(revision, 3, false)
+
+	checkServingState(t, servingClient, v1alpha1.RevisionServingStateReserve)
+}
+
+func TestRevisionScalerActivatesRevisionScaledOnMetricSource(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateReserve)
+	revision.Annotations = map[string]string{
+		autoscaling.MetricAnnotationKey:     autoscaling.External,
+		autoscaling.MetricNameAnnotationKey: "kafka_consumergroup_lag",
+		autoscaling.TargetAnnotationKey:     "100",
+	}
+	deployment := newDeployment(revision, 0)
+	revisionScaler, servingClient, _ := createRevisionScaler(t, revision, deployment)
+
+	revisionScaler.Scale(revision, 1, false)
+
+	checkServingState(t, servingClient, v1alpha1.RevisionServingStateActive)
+}
+
 func TestRevisionScalerDoesNotScaleUpFromZero(t *testing.T) {
 	revision := newRevision(v1alpha1.RevisionServingStateActive) // normally implies a non-zero scale
 	deployment := newDeployment(revision, 0)
 	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
 
-	revisionScaler.Scale(revision, 10)
+	revisionScaler.Scale(revision, 10, false)
 
 	checkServingState(t, servingClient, v1alpha1.RevisionServingStateActive)
 	checkReplicas(t, kubeClient, deployment, 0)
 }
 
+func TestRevisionScalerPublishesActivatorInPath(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	deployment := newDeployment(revision, 1)
+	revisionScaler, servingClient, kubeClient := createRevisionScaler(t, revision, deployment)
+
+	revisionScaler.Scale(revision, 1, true)
+
+	checkActivatorInPath(t, servingClient, true)
+	checkReplicas(t, kubeClient, deployment, 1)
+
+	revisionScaler.Scale(revision, 1, false)
+
+	checkActivatorInPath(t, servingClient, false)
+}
+
+func TestRevisionScalerReportsPodCounts(t *testing.T) {
+	revision := newRevision(v1alpha1.RevisionServingStateActive)
+	deployment := newDeployment(revision, 3)
+	deployment.Status.Replicas = 3
+	deployment.Status.ReadyReplicas = 2
+	reporter := &fakeStatsReporter{reports: make(map[autoscaler.Measurement]float64)}
+	revisionScaler, _, _ := createRevisionScalerWithReporter(t, revision, deployment, reporter)
+
+	revisionScaler.Scale(revision, 5, false)
+
+	for m, want := range map[autoscaler.Measurement]float64{
+		autoscaler.DesiredPodCountM:   5,
+		autoscaler.RequestedPodCountM: 3,
+		autoscaler.ActualPodCountM:    2,
+	} {
+		if got, ok := reporter.reports[m]; !ok || got != want {
+			t.Errorf("Reported %v for measurement %v, want %v", got, m, want)
+		}
+	}
+}
+
 func createRevisionScaler(t *testing.T, revision *v1alpha1.Revision, deployment *v1.Deployment) (autoscaler.RevisionScaler, clientset.Interface, kubernetes.Interface) {
+	return createRevisionScalerWithReporter(t, revision, deployment, &fakeStatsReporter{reports: make(map[autoscaler.Measurement]float64)})
+}
+
+func createRevisionScalerWithReporter(t *testing.T, revision *v1alpha1.Revision, deployment *v1.Deployment,
+	reporter *fakeStatsReporter) (autoscaler.RevisionScaler, clientset.Interface, kubernetes.Interface) {
 	kubeClient := fakeK8s.NewSimpleClientset()
 	servingClient := fakeKna.NewSimpleClientset()
 
-	revisionScaler := autoscaler.NewRevisionScaler(servingClient, kubeClient, zap.NewNop().Sugar())
+	newReporter := func(*v1alpha1.Revision) (autoscaler.StatsReporter, error) {
+		return reporter, nil
+	}
+	revisionScaler := autoscaler.NewRevisionScaler(servingClient, kubeClient, newReporter, zap.NewNop().Sugar())
 
 	_, err := servingClient.ServingV1alpha1().Revisions(testNamespace).Create(revision)
 	if err != nil {
@@ -99,6 +203,15 @@ func createRevisionScaler(t *testing.T, revision *v1alpha1.Revision, deployment
 	return revisionScaler, servingClient, kubeClient
 }
 
+type fakeStatsReporter struct {
+	reports map[autoscaler.Measurement]float64
+}
+
+func (r *fakeStatsReporter) Report(m autoscaler.Measurement, v float64) error {
+	r.reports[m] = v
+	return nil
+}
+
 func newRevision(servingState v1alpha1.RevisionServingStateType) *v1alpha1.Revision {
 	return &v1alpha1.Revision{
 		ObjectMeta: metav1.ObjectMeta{
@@ -137,6 +250,19 @@ func checkServingState(t *testing.T, servingClient clientset.Interface, servingS
 	}
 }
 
+func checkActivatorInPath(t *testing.T, servingClient clientset.Interface, activatorInPath bool) {
+	t.Helper()
+
+	updatedRev, err := servingClient.ServingV1alpha1().Revisions(testNamespace).Get(testRevision, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("Failed to get revision.", err)
+	}
+
+	if got := updatedRev.Annotations[serving.ActivatorInPathAnnotationKey] == "true"; got != activatorInPath {
+		t.Fatal("Unexpected activator in path annotation.", updatedRev.Annotations)
+	}
+}
+
 func checkReplicas(t *testing.T, kubeClient kubernetes.Interface, deployment *v1.Deployment, expectedScale int) {
 	t.Helper()
 
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+// Snapshot holds the stats of a revision aggregated over a window.
+type Snapshot struct {
+	Window       time.Duration
+	ObservedPods int
+	// ConcurrencyPerPod is the average number of concurrent requests
+	// handled by each pod.
+	ConcurrencyPerPod float64
+	// RequestsPerSecondPerPod is the average number of requests received
+	// by each pod per second.
+	RequestsPerSecondPerPod float64
+	// MetricValue is the value of the metric source of the revision, for
+	// revisions scaled on one.
+	MetricValue float64
+}
+
+// ScalerSpec is what a Scaler knows of the revision it scales.
+type ScalerSpec struct {
+	Config *Config
+	Model  v1alpha1.RevisionRequestConcurrencyModelType
+	// Target is the value per pod of the metric of the Scaler that the
+	// revision sets with its target annotation, or zero when it leaves it
+	// to the Scaler.
+	Target float64
+	// Utilization is the fraction of the target that pods are scaled to.
+	Utilization float64
+	// Annotations are those of the revision, for Scalers taking their own
+	// parameters.
+	Annotations map[string]string
+}
+
+// Scaler is a strategy computing the number of pods a revision needs.
+type Scaler interface {
+	// DesiredScale returns the number of pods, possibly fractional, that
+	// the revision needs to handle the traffic of the snapshot, taken
+	// while it ran currentScale pods.
+	DesiredScale(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64
+}
+
+// ScalerFunc adapts a function to a Scaler.
+type ScalerFunc func(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64
+
+// DesiredScale calls f.
+func (f ScalerFunc) DesiredScale(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64 {
+	return f(snapshot, currentScale, spec)
+}
+
+var (
+	scalersMutex sync.RWMutex
+	scalers      = make(map[string]Scaler)
+)
+
+func init() {
+	RegisterScaler(autoscaling.Concurrency, ScalerFunc(scaleOnConcurrency))
+	RegisterScaler(autoscaling.RPS, ScalerFunc(scaleOnRequestsPerSecond))
+	RegisterScaler(autoscaling.External, ScalerFunc(scaleOnMetricValue))
+	RegisterScaler(autoscaling.Custom, ScalerFunc(scaleOnMetricValue))
+}
+
+// RegisterScaler makes the Scaler available to revisions naming it in
+// their metric annotation. It panics when a Scaler is already registered
+// under the name, and is meant to be called from init functions.
+func RegisterScaler(name string, scaler Scaler) {
+	scalersMutex.Lock()
+	defer scalersMutex.Unlock()
+	if _, ok := scalers[name]; ok {
+		panic(fmt.Sprintf("autoscaler: Scaler %q registered twice", name))
+	}
+	scalers[name] = scaler
+}
+
+// ScalerFor returns the name and the registered Scaler of the metric of
+// the given autoscaling annotations, which defaults to concurrency.
+func ScalerFor(annotations *autoscaling.Annotations) (string, Scaler, error) {
+	name := annotations.Metric
+	if name == "" {
+		name = autoscaling.Concurrency
+	}
+	scalersMutex.RLock()
+	defer scalersMutex.RUnlock()
+	scaler, ok := scalers[name]
+	if !ok {
+		return "", nil, fmt.Errorf("invalid %s %q: no such Scaler", autoscaling.MetricAnnotationKey, name)
+	}
+	return name, scaler, nil
+}
+
+// scaleOnConcurrency scales the pods to the target concurrency of the
+// revision, or that of its concurrency model.
+func scaleOnConcurrency(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64 {
+	target := spec.Target
+	if target <= 0 {
+		target = spec.Config.TargetConcurrency(spec.Model)
+	}
+	return currentScale * (snapshot.ConcurrencyPerPod / (target * spec.Utilization))
+}
+
+// scaleOnRequestsPerSecond scales the pods to the target requests per
+// second of the revision, or the cluster-wide one.
+func scaleOnRequestsPerSecond(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64 {
+	target := spec.Target
+	if target <= 0 {
+		target = spec.Config.RequestsPerSecondTarget
+	}
+	return currentScale * (snapshot.RequestsPerSecondPerPod / (target * spec.Utilization))
+}
+
+// scaleOnMetricValue scales the pods for each to handle the target of the
+// revision out of the value of its metric source, however many there are.
+func scaleOnMetricValue(snapshot Snapshot, currentScale float64, spec ScalerSpec) float64 {
+	if spec.Target <= 0 {
+		return currentScale
+	}
+	return snapshot.MetricValue / (spec.Target * spec.Utilization)
+}
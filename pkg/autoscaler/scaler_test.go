@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+func TestScalerFor(t *testing.T) {
+	RegisterScaler("test-scaler-for", ScalerFunc(func(Snapshot, float64, ScalerSpec) float64 { return 42 }))
+
+	tests := []struct {
+		name    string
+		metric  string
+		want    string
+		wantErr bool
+	}{{
+		name: "default",
+		want: autoscaling.Concurrency,
+	}, {
+		name:   "rps",
+		metric: autoscaling.RPS,
+		want:   autoscaling.RPS,
+	}, {
+		name:   "registered",
+		metric: "test-scaler-for",
+		want:   "test-scaler-for",
+	}, {
+		name:    "unregistered",
+		metric:  "cpu",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, scaler, err := ScalerFor(&autoscaling.Annotations{Metric: test.metric})
+			if (err != nil) != test.wantErr {
+				t.Errorf("ScalerFor() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ScalerFor() = %q, want %q", got, test.want)
+			}
+			if (scaler == nil) != test.wantErr {
+				t.Errorf("ScalerFor() = %v, want a Scaler %v", scaler, !test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterScaler_Twice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterScaler() did not panic on a name registered twice")
+		}
+	}()
+	RegisterScaler(autoscaling.Concurrency, ScalerFunc(scaleOnConcurrency))
+}
+
+func TestBuiltinScalers(t *testing.T) {
+	config := &Config{
+		MultiTargetConcurrency:  10,
+		RequestsPerSecondTarget: 100,
+	}
+	snapshot := Snapshot{
+		Window:                  time.Minute,
+		ObservedPods:            4,
+		ConcurrencyPerPod:       20,
+		RequestsPerSecondPerPod: 50,
+		MetricValue:             300,
+	}
+
+	tests := []struct {
+		name   string
+		scaler Scaler
+		spec   ScalerSpec
+		want   float64
+	}{{
+		name:   "concurrency",
+		scaler: ScalerFunc(scaleOnConcurrency),
+		spec:   ScalerSpec{Config: config, Model: v1alpha1.RevisionRequestConcurrencyModelMulti, Utilization: 1},
+		want:   8,
+	}, {
+		name:   "concurrency with target and utilization",
+		scaler: ScalerFunc(scaleOnConcurrency),
+		spec:   ScalerSpec{Config: config, Model: v1alpha1.RevisionRequestConcurrencyModelMulti, Target: 40, Utilization: 0.5},
+		want:   4,
+	}, {
+		name:   "rps",
+		scaler: ScalerFunc(scaleOnRequestsPerSecond),
+		spec:   ScalerSpec{Config: config, Utilization: 1},
+		want:   2,
+	}, {
+		name:   "rps with target and utilization",
+		scaler: ScalerFunc(scaleOnRequestsPerSecond),
+		spec:   ScalerSpec{Config: config, Target: 25, Utilization: 0.5},
+		want:   16,
+	}, {
+		name:   "metric value",
+		scaler: ScalerFunc(scaleOnMetricValue),
+		spec:   ScalerSpec{Config: config, Target: 50, Utilization: 0.5},
+		want:   12,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.scaler.DesiredScale(snapshot, 4, test.spec); got != test.want {
+				t.Errorf("DesiredScale() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
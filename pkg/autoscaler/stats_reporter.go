@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
@@ -46,6 +47,8 @@ const (
 	TargetConcurrencyM
 	// PanicM is used as a flag to indicate if autoscaler is in panic mode or not
 	PanicM
+	// ExcessBurstCapacityM is the spare capacity of the pods beyond the target burst capacity
+	ExcessBurstCapacityM
 )
 
 var (
@@ -82,6 +85,10 @@ var (
 			"panic_mode",
 			"1 if autoscaler is in panic mode, 0 otherwise",
 			stats.UnitNone),
+		ExcessBurstCapacityM: stats.Float64(
+			"excess_burst_capacity",
+			"Concurrent requests the pods can absorb beyond the target burst capacity, negative while the activator is kept in the data path",
+			stats.UnitNone),
 	}
 	namespaceTagKey tag.Key
 	configTagKey    tag.Key
@@ -160,6 +167,12 @@ func init() {
 			Aggregation: view.LastValue(),
 			TagKeys:     []tag.Key{namespaceTagKey, configTagKey, revisionTagKey},
 		},
+		&view.View{
+			Description: "Concurrent requests the pods can absorb beyond the target burst capacity, negative while the activator is kept in the data path",
+			Measure:     measurements[ExcessBurstCapacityM],
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{namespaceTagKey, configTagKey, revisionTagKey},
+		},
 	)
 	if err != nil {
 		panic(err)
@@ -172,6 +185,9 @@ type StatsReporter interface {
 	Report(m Measurement, v float64) error
 }
 
+// StatsReporterFactory creates a StatsReporter tagging metrics with the given revision.
+type StatsReporterFactory func(*v1alpha1.Revision) (StatsReporter, error)
+
 // Reporter holds cached metric objects to report autoscaler metrics
 type Reporter struct {
 	ctx         context.Context
@@ -61,6 +61,7 @@ func TestReporter_Report(t *testing.T) {
 	expectSuccess(t, func() error { return r.Report(ObservedStableConcurrencyM, 2) })
 	expectSuccess(t, func() error { return r.Report(ObservedPanicConcurrencyM, 3) })
 	expectSuccess(t, func() error { return r.Report(TargetConcurrencyM, 0.9) })
+	expectSuccess(t, func() error { return r.Report(ExcessBurstCapacityM, -4) })
 	checkData(t, "desired_pod_count", wantTags, 10)
 	checkData(t, "requested_pod_count", wantTags, 7)
 	checkData(t, "actual_pod_count", wantTags, 5)
@@ -69,6 +70,7 @@ func TestReporter_Report(t *testing.T) {
 	checkData(t, "observed_stable_concurrency", wantTags, 2)
 	checkData(t, "observed_panic_concurrency", wantTags, 3)
 	checkData(t, "target_concurrency_per_pod", wantTags, 0.9)
+	checkData(t, "excess_burst_capacity", wantTags, -4)
 
 	// All the stats are gauges - record multiple entries for one stat - last one should stick
 	expectSuccess(t, func() error { return r.Report(DesiredPodCountM, 1) })
@@ -0,0 +1,25 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+
+Package statscraper pulls autoscaler statistics from the queue proxy sidecar containers of a revision's pods, so that
+pods whose WebSocket connection to the autoscaler is broken are still accounted for. The pods are found in the endpoints
+of the revision's service, and those of large revisions are sampled at random rather than all scraped, for the cost of
+scraping to stay bounded as revisions grow to hundreds of pods.
+
+*/
+package statscraper
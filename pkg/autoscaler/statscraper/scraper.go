@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statscraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/autoscaler"
+	revisionresourcenames "github.com/knative/serving/pkg/controller/revision/resources/names"
+	"github.com/knative/serving/pkg/queue"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MaxFullyScrapedPods is the number of pods up to which every pod of
+	// a revision is scraped. Larger revisions are sampled.
+	MaxFullyScrapedPods = 16
+
+	// zScore95 is the z-score of a 95% confidence level.
+	zScore95 = 1.96
+	// marginOfError is how far, in standard deviations of the stats of a
+	// revision's pods, the mean of a sample may be from the mean of all
+	// of them.
+	marginOfError = 0.2
+
+	scrapeTimeout = time.Second
+)
+
+// Scraper pulls the latest stats from the queue proxies of a revision's pods.
+type Scraper struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	revision   string
+	service    string
+	client     *http.Client
+	logger     *zap.SugaredLogger
+
+	// statsURL returns the URL the stats of the pod at the given IP are
+	// served at.
+	statsURL func(ip string) string
+	// rand picks the pods sampled.
+	rand *rand.Rand
+}
+
+// New creates a Scraper for the pods of the given revision.
+func New(kubeClient kubernetes.Interface, namespace, revision string, logger *zap.SugaredLogger) *Scraper {
+	return &Scraper{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		revision:   revision,
+		service:    revisionresourcenames.K8sService(&v1alpha1.Revision{ObjectMeta: metav1.ObjectMeta{Name: revision}}),
+		client:     &http.Client{Timeout: scrapeTimeout},
+		logger:     logger.Named("stats-scraper"),
+		statsURL: func(ip string) string {
+			return fmt.Sprintf("http://%s:%d/%s", ip, queue.RequestQueueAdminPort, queue.RequestQueueStatsPath)
+		},
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// target is a pod serving the revision, as listed in the endpoints of
+// its service.
+type target struct {
+	pod string
+	ip  string
+}
+
+// Scrape returns the latest stats of the pods ready to serve the
+// revision, as listed in the endpoints of its service. Revisions with
+// more than MaxFullyScrapedPods pods are sampled at random, and the stats
+// of the pods sampled stand for those of all of them. Pods that cannot be
+// scraped are skipped. Scrape must not be called concurrently.
+func (s *Scraper) Scrape() []autoscaler.Stat {
+	endpoints, err := s.kubeClient.CoreV1().Endpoints(s.namespace).Get(s.service, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Errorw("Error getting endpoints", zap.Error(err))
+		return nil
+	}
+	var targets []target
+	for _, subset := range endpoints.Subsets {
+		for _, addr := range subset.Addresses {
+			t := target{ip: addr.IP}
+			if addr.TargetRef != nil {
+				t.pod = addr.TargetRef.Name
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	sample := targets
+	if n := sampleSize(len(targets)); n < len(targets) {
+		sample = make([]target, n)
+		for i, j := range s.rand.Perm(len(targets))[:n] {
+			sample[i] = targets[j]
+		}
+	}
+
+	var (
+		mux   sync.Mutex
+		wg    sync.WaitGroup
+		stats []autoscaler.Stat
+	)
+	for _, t := range sample {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			stat, err := s.scrapePod(t)
+			if err != nil {
+				s.logger.Debugf("Error scraping pod %q: %v", t.pod, err)
+				return
+			}
+			mux.Lock()
+			stats = append(stats, stat)
+			mux.Unlock()
+		}(t)
+	}
+	wg.Wait()
+
+	if len(sample) < len(targets) {
+		e := extrapolate(stats, len(targets))
+		s.logger.Debugf("Estimated %0.3f concurrent requests (95%% confidence %0.3f to %0.3f) over %d pods from %d samples.",
+			e.concurrency, e.low, e.high, len(targets), len(stats))
+	}
+	return stats
+}
+
+// sampleSize returns how many of the given number of pods to scrape for
+// the mean of their stats to be within marginOfError of the mean of all
+// of them with 95% confidence, and to scrape every pod of small
+// revisions.
+func sampleSize(pods int) int {
+	if pods <= MaxFullyScrapedPods {
+		return pods
+	}
+	// The sample size of an infinite population, corrected for the
+	// finite number of pods.
+	n0 := math.Pow(zScore95/marginOfError, 2)
+	n := int(math.Ceil(n0 / (1 + (n0-1)/float64(pods))))
+	if n < MaxFullyScrapedPods {
+		return MaxFullyScrapedPods
+	}
+	return n
+}
+
+// estimate is the total concurrency of a revision's pods extrapolated
+// from the stats of a sample of them, with its 95% confidence interval.
+type estimate struct {
+	concurrency float64
+	low         float64
+	high        float64
+}
+
+// extrapolate estimates the total concurrency of the given number of
+// pods from the stats of a random sample of them.
+func extrapolate(sample []autoscaler.Stat, pods int) estimate {
+	n := len(sample)
+	if n == 0 || pods == 0 {
+		return estimate{}
+	}
+	var sum float64
+	for _, stat := range sample {
+		sum += stat.AverageConcurrentRequests
+	}
+	mean := sum / float64(n)
+	e := estimate{
+		concurrency: mean * float64(pods),
+		low:         mean * float64(pods),
+		high:        mean * float64(pods),
+	}
+	if n < 2 || n >= pods {
+		return e
+	}
+	var squares float64
+	for _, stat := range sample {
+		squares += math.Pow(stat.AverageConcurrentRequests-mean, 2)
+	}
+	// The standard error of the mean, corrected for sampling without
+	// replacement from a finite number of pods.
+	stdErr := math.Sqrt(squares/float64(n-1)/float64(n)) * math.Sqrt(float64(pods-n)/float64(pods-1))
+	margin := zScore95 * stdErr * float64(pods)
+	e.low = math.Max(0, e.concurrency-margin)
+	e.high = e.concurrency + margin
+	return e
+}
+
+func (s *Scraper) scrapePod(t target) (autoscaler.Stat, error) {
+	var stat autoscaler.Stat
+	resp, err := s.client.Get(s.statsURL(t.ip))
+	if err != nil {
+		return stat, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stat, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stat); err != nil {
+		return stat, err
+	}
+	if stat.Time == nil {
+		return stat, fmt.Errorf("stat has no time")
+	}
+	return stat, nil
+}
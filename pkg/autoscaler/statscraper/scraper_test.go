@@ -0,0 +1,227 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statscraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/autoscaler"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "test-namespace"
+	testRevision  = "test-revision"
+)
+
+// testEndpoints lists the given pods as ready to serve the revision.
+// The IP of each pod is its name, for the test server to tell them apart.
+func testEndpoints(revision string, ready []string, notReady ...string) *corev1.Endpoints {
+	addresses := func(pods []string) []corev1.EndpointAddress {
+		var addrs []corev1.EndpointAddress
+		for _, pod := range pods {
+			addrs = append(addrs, corev1.EndpointAddress{
+				IP:        pod,
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod},
+			})
+		}
+		return addrs
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      revision + "-service",
+			Namespace: testNamespace,
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         addresses(ready),
+			NotReadyAddresses: addresses(notReady),
+		}},
+	}
+}
+
+// newTestScraper creates a Scraper whose pods serve a stat named after
+// the pod, except for the pods in failing.
+func newTestScraper(failing map[string]bool, objs ...runtime.Object) (*Scraper, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if failing[name] {
+			http.Error(w, "no stats reported yet", http.StatusServiceUnavailable)
+			return
+		}
+		now := time.Now()
+		json.NewEncoder(w).Encode(autoscaler.Stat{
+			Time:                      &now,
+			PodName:                   name,
+			AverageConcurrentRequests: 1.0,
+		})
+	}))
+	s := New(fakekubeclientset.NewSimpleClientset(objs...), testNamespace, testRevision, zap.NewNop().Sugar())
+	s.statsURL = func(ip string) string {
+		return server.URL + "/" + ip
+	}
+	s.rand = rand.New(rand.NewSource(1))
+	return s, server.Close
+}
+
+func scrapedPods(s *Scraper) []string {
+	var names []string
+	for _, stat := range s.Scrape() {
+		names = append(names, stat.PodName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestScrape(t *testing.T) {
+	s, done := newTestScraper(map[string]bool{"failing": true},
+		testEndpoints(testRevision, []string{"ready", "failing"}, "not-ready"),
+		testEndpoints("other-revision", []string{"other"}))
+	defer done()
+
+	if want, got := []string{"ready"}, scrapedPods(s); !cmp.Equal(want, got) {
+		t.Errorf("Unexpected scraped pods. Want %v. Got %v.", want, got)
+	}
+}
+
+func TestScrape_NoEndpoints(t *testing.T) {
+	s, done := newTestScraper(nil)
+	defer done()
+
+	if got := scrapedPods(s); len(got) != 0 {
+		t.Errorf("Unexpected scraped pods. Want none. Got %v.", got)
+	}
+}
+
+func TestScrape_SamplesLargeRevisions(t *testing.T) {
+	podCount := 200
+	var pods []string
+	for i := 0; i < podCount; i++ {
+		pods = append(pods, fmt.Sprintf("pod-%03d", i))
+	}
+	s, done := newTestScraper(nil, testEndpoints(testRevision, pods))
+	defer done()
+
+	want := sampleSize(podCount)
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		names := scrapedPods(s)
+		if len(names) != want {
+			t.Fatalf("Unexpected number of scraped pods. Want %d. Got %d.", want, len(names))
+		}
+		for j, name := range names {
+			if j > 0 && names[j-1] == name {
+				t.Errorf("Pod %s scraped more than once.", name)
+			}
+			seen[name] = true
+		}
+	}
+	// Every scrape samples the pods anew.
+	if len(seen) <= want {
+		t.Errorf("Unexpected number of distinct scraped pods. Want more than %d. Got %d.", want, len(seen))
+	}
+}
+
+func TestSampleSize(t *testing.T) {
+	for _, tc := range []struct {
+		pods int
+		want int
+	}{
+		{0, 0},
+		{1, 1},
+		{MaxFullyScrapedPods, MaxFullyScrapedPods},
+		{MaxFullyScrapedPods + 1, MaxFullyScrapedPods},
+		{100, 50},
+		{1000, 88},
+		{10000, 96},
+	} {
+		if got := sampleSize(tc.pods); got != tc.want {
+			t.Errorf("sampleSize(%d) = %d, want %d", tc.pods, got, tc.want)
+		}
+	}
+}
+
+func TestExtrapolate(t *testing.T) {
+	stats := func(concurrencies ...float64) []autoscaler.Stat {
+		var stats []autoscaler.Stat
+		for _, c := range concurrencies {
+			stats = append(stats, autoscaler.Stat{AverageConcurrentRequests: c})
+		}
+		return stats
+	}
+	// The standard error of the mean of 1 and 3, corrected for sampling
+	// 2 of 4 pods.
+	margin := zScore95 * math.Sqrt(2.0/3.0) * 4
+	for _, tc := range []struct {
+		name   string
+		sample []autoscaler.Stat
+		pods   int
+		want   estimate
+	}{{
+		name: "no sample",
+		pods: 4,
+	}, {
+		name:   "every pod sampled",
+		sample: stats(1, 3),
+		pods:   2,
+		want:   estimate{concurrency: 4, low: 4, high: 4},
+	}, {
+		name:   "uniform sample",
+		sample: stats(2, 2),
+		pods:   10,
+		want:   estimate{concurrency: 20, low: 20, high: 20},
+	}, {
+		name:   "half of the pods sampled",
+		sample: stats(1, 3),
+		pods:   4,
+		want:   estimate{concurrency: 8, low: 8 - margin, high: 8 + margin},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := extrapolate(tc.sample, tc.pods)
+			if !cmp.Equal(tc.want, got, cmp.AllowUnexported(estimate{}), cmp.Comparer(func(a, b float64) bool {
+				return math.Abs(a-b) < 1e-9
+			})) {
+				t.Errorf("extrapolate() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtrapolate_NoNegativeBound(t *testing.T) {
+	sample := []autoscaler.Stat{
+		{AverageConcurrentRequests: 0},
+		{AverageConcurrentRequests: 0},
+		{AverageConcurrentRequests: 9},
+	}
+	got := extrapolate(sample, 100)
+	if got.concurrency != 300 || got.low != 0 || got.high <= 300 {
+		t.Errorf("extrapolate() = %+v, want 300 between 0 and more than 300", got)
+	}
+}
@@ -19,9 +19,12 @@ package statserver
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/gob"
+	"encoding/json"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,8 +36,14 @@ import (
 const closeCodeServiceRestart = 1012 // See https://www.iana.org/assignments/websocket/websocket.xhtml
 
 // Server receives autoscaler statistics over WebSocket and sends them to a channel.
+//
+// Stat messages are gob encoded in binary messages or JSON encoded in text
+// messages. A connection is only read from while its last stat can be sent
+// to the channel, so that clients are slowed down rather than their stats
+// buffered without bound.
 type Server struct {
 	addr        string
+	token       string
 	wsSrv       http.Server
 	servingCh   chan struct{}
 	stopCh      chan struct{}
@@ -44,9 +53,11 @@ type Server struct {
 }
 
 // New creates a Server which will receive autoscaler statistics and forward them to statsCh until Shutdown is called.
-func New(statsServerAddr string, statsCh chan<- *autoscaler.StatMessage, logger *zap.SugaredLogger) *Server {
+// Unless token is empty, connections must present it as a bearer token in their Authorization header.
+func New(statsServerAddr string, statsCh chan<- *autoscaler.StatMessage, token string, logger *zap.SugaredLogger) *Server {
 	svr := Server{
 		addr:        statsServerAddr,
+		token:       token,
 		servingCh:   make(chan struct{}),
 		stopCh:      make(chan struct{}),
 		statsCh:     statsCh,
@@ -103,9 +114,14 @@ func (l keepAlive) Accept() (net.Conn, error) {
 }
 
 // Handler exposes a websocket handler for receiving stats from queue
-// sidecar containers.
+// sidecar containers and activators.
 func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
 	s.logger.Debug("Handle entered")
+	if !s.authorized(r) {
+		s.logger.Error("Rejecting connection without a valid token.")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	var upgrader websocket.Upgrader
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -115,7 +131,10 @@ func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
 
 	handlerCh := make(chan struct{})
 
-	s.openClients.Add(1)
+	// The receive loop is waited for as well, so that it never sends on
+	// statsCh once Shutdown closed it.
+	s.openClients.Add(2)
+	defer s.openClients.Done()
 	go func() {
 		defer s.openClients.Done()
 		select {
@@ -141,20 +160,38 @@ func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
 			close(handlerCh)
 			return
 		}
-		if messageType != websocket.BinaryMessage {
-			s.logger.Error("Dropping non-binary message.")
+		var sm autoscaler.StatMessage
+		switch messageType {
+		case websocket.BinaryMessage:
+			err = gob.NewDecoder(bytes.NewBuffer(msg)).Decode(&sm)
+		case websocket.TextMessage:
+			err = json.Unmarshal(msg, &sm)
+		default:
+			s.logger.Errorf("Dropping message of type %d.", messageType)
 			continue
 		}
-		dec := gob.NewDecoder(bytes.NewBuffer(msg))
-		var sm autoscaler.StatMessage
-		err = dec.Decode(&sm)
 		if err != nil {
 			s.logger.Error(err)
 			continue
 		}
 
-		s.statsCh <- &sm
+		select {
+		case s.statsCh <- &sm:
+		case <-s.stopCh:
+			close(handlerCh)
+			return
+		}
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
 	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	return strings.HasPrefix(auth, prefix) &&
+		subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(s.token)) == 1
 }
 
 // Shutdown terminates the server gracefully for the given timeout period and then returns.
@@ -19,6 +19,8 @@ package statserver_test
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
+	"net/http"
 	"net/url"
 	"runtime"
 	"sync"
@@ -36,7 +38,7 @@ const testAddress = "127.0.0.1:0"
 
 func TestServerLifecycle(t *testing.T) {
 	statsCh := make(chan *autoscaler.StatMessage)
-	server := stats.New(testAddress, statsCh, zap.NewNop().Sugar())
+	server := stats.New(testAddress, statsCh, "", zap.NewNop().Sugar())
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
@@ -68,6 +70,66 @@ func TestStatsReceived(t *testing.T) {
 	closeSink(statSink, t)
 }
 
+func TestJSONStatsReceived(t *testing.T) {
+	statsCh := make(chan *autoscaler.StatMessage)
+	server := stats.NewTestServer(statsCh)
+
+	defer server.Shutdown(0)
+	go server.ListenAndServe()
+
+	statSink := dialOk(server.ListenAddr(), t)
+
+	sm := newStatMessage("test-namespace/test-revision", "pod1", 2.1, 51)
+	b, err := json.Marshal(sm)
+	if err != nil {
+		t.Fatal("Failed to encode statistic.", err)
+	}
+	if err := statSink.WriteMessage(websocket.TextMessage, b); err != nil {
+		t.Fatal("Failed to write to stat sink.", err)
+	}
+	recv, ok := <-statsCh
+	if !ok {
+		t.Fatal("statistic not received")
+	}
+	// JSON doesn't preserve the monotonic clock reading, so compare times separately.
+	if !recv.Stat.Time.Equal(*sm.Stat.Time) {
+		t.Fatalf("Expected time %v, got %v", sm.Stat.Time, recv.Stat.Time)
+	}
+	recv.Stat.Time = sm.Stat.Time
+	if !cmp.Equal(sm, recv) {
+		t.Fatalf("Expected and actual stats messages are not equal: %s", cmp.Diff(sm, recv))
+	}
+
+	closeSink(statSink, t)
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	statsCh := make(chan *autoscaler.StatMessage)
+	server := stats.NewTestServerWithToken(statsCh, "secret")
+
+	defer server.Shutdown(0)
+	go server.ListenAndServe()
+
+	listenAddr := server.ListenAddr()
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		_, resp, err := dialWithHeader(listenAddr, http.Header{"Authorization": {auth}}, t)
+		if err == nil {
+			t.Fatalf("Connection with Authorization %q not refused", auth)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d for Authorization %q, got %v", http.StatusUnauthorized, auth, resp)
+		}
+	}
+
+	statSink, _, err := dialWithHeader(listenAddr, http.Header{"Authorization": {"Bearer secret"}}, t)
+	if err != nil {
+		t.Fatal("Dial with token failed.", err)
+	}
+	assertReceivedOk(newStatMessage("test-namespace/test-revision", "pod1", 2.1, 51), statSink, statsCh, t)
+
+	closeSink(statSink, t)
+}
+
 func TestServerShutdown(t *testing.T) {
 	statsCh := make(chan *autoscaler.StatMessage)
 	server := stats.NewTestServer(statsCh)
@@ -146,10 +208,10 @@ func newStatMessage(revKey string, podName string, averageConcurrentRequests flo
 	return &autoscaler.StatMessage{
 		revKey,
 		autoscaler.Stat{
-			&now,
-			podName,
-			averageConcurrentRequests,
-			requestCount,
+			Time:                      &now,
+			PodName:                   podName,
+			AverageConcurrentRequests: averageConcurrentRequests,
+			RequestCount:              requestCount,
 		},
 	}
 }
@@ -175,6 +237,11 @@ func dialOk(serverURL string, t *testing.T) *websocket.Conn {
 }
 
 func dial(serverURL string, t *testing.T) (*websocket.Conn, error) {
+	statSink, _, err := dialWithHeader(serverURL, nil, t)
+	return statSink, err
+}
+
+func dialWithHeader(serverURL string, header http.Header, t *testing.T) (*websocket.Conn, *http.Response, error) {
 	u, err := url.Parse(serverURL)
 	if err != nil {
 		t.Fatal(err)
@@ -184,8 +251,7 @@ func dial(serverURL string, t *testing.T) (*websocket.Conn, error) {
 	dialer := &websocket.Dialer{
 		HandshakeTimeout: time.Second,
 	}
-	statSink, _, err := dialer.Dial(u.String(), nil)
-	return statSink, err
+	return dialer.Dial(u.String(), header)
 }
 
 func send(statSink *websocket.Conn, sm *autoscaler.StatMessage, t *testing.T) {
@@ -29,8 +29,12 @@ type TestServer struct {
 }
 
 func NewTestServer(statsCh chan<- *autoscaler.StatMessage) *TestServer {
+	return NewTestServerWithToken(statsCh, "")
+}
+
+func NewTestServerWithToken(statsCh chan<- *autoscaler.StatMessage, token string) *TestServer {
 	return &TestServer{
-		Server:     New(testAddress, statsCh, zap.NewNop().Sugar()),
+		Server:     New(testAddress, statsCh, token, zap.NewNop().Sugar()),
 		listenAddr: make(chan string, 1),
 	}
 }
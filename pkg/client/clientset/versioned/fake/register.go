@@ -16,6 +16,7 @@ limitations under the License.
 package fake
 
 import (
+	autoscalingv1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
 	networkingv1alpha3 "github.com/knative/serving/pkg/apis/istio/v1alpha3"
 	servingv1alpha1 "github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,6 +49,7 @@ func init() {
 // After this, RawExtensions in Kubernetes types will serialize kube-aggregator types
 // correctly.
 func AddToScheme(scheme *runtime.Scheme) {
+	autoscalingv1alpha1.AddToScheme(scheme)
 	networkingv1alpha3.AddToScheme(scheme)
 	servingv1alpha1.AddToScheme(scheme)
 }
@@ -21,6 +21,7 @@ import (
 	time "time"
 
 	versioned "github.com/knative/serving/pkg/client/clientset/versioned"
+	autoscaling "github.com/knative/serving/pkg/client/informers/externalversions/autoscaling"
 	internalinterfaces "github.com/knative/serving/pkg/client/informers/externalversions/internalinterfaces"
 	istio "github.com/knative/serving/pkg/client/informers/externalversions/istio"
 	serving "github.com/knative/serving/pkg/client/informers/externalversions/serving"
@@ -121,10 +122,15 @@ type SharedInformerFactory interface {
 	ForResource(resource schema.GroupVersionResource) (GenericInformer, error)
 	WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool
 
+	Autoscaling() autoscaling.Interface
 	Networking() istio.Interface
 	Serving() serving.Interface
 }
 
+func (f *sharedInformerFactory) Autoscaling() autoscaling.Interface {
+	return autoscaling.New(f, f.namespace, f.tweakListOptions)
+}
+
 func (f *sharedInformerFactory) Networking() istio.Interface {
 	return istio.New(f, f.namespace, f.tweakListOptions)
 }
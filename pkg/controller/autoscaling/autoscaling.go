@@ -27,6 +27,7 @@ import (
 	"github.com/knative/serving/pkg/logging/logkey"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	kubeinformers "k8s.io/client-go/informers"
 	servinginformers "github.com/knative/serving/pkg/client/informers/externalversions/serving/v1alpha1"
@@ -109,6 +110,18 @@ func (c *Controller) Run(numThreads int, stopCh <-chan struct{}) error {
 	return c.RunController(numThreads, stopCh, c.Reconcile, controllerName)
 }
 
+// Resync enqueues every revision known to the Controller, so that they are all reconciled again.
+func (c *Controller) Resync() {
+	revs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		c.logger.Errorf("Failed to list revisions for resync: %v", err)
+		return
+	}
+	for _, obj := range revs {
+		c.Enqueue(obj)
+	}
+}
+
 // Reconcile notifies the RevisionSynchronizer of the presence or absence.
 func (c *Controller) Reconcile(revKey string) error {
 	namespace, name, err := cache.SplitMetaNamespaceKey(revKey)
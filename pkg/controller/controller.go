@@ -186,6 +186,12 @@ func (c *Base) EnqueueKey(key string) {
 	c.WorkQueue.AddRateLimited(key)
 }
 
+// EnqueueKeyAfter takes a namespace/name string and puts it onto the work
+// queue once delay has passed.
+func (c *Base) EnqueueKeyAfter(key string, delay time.Duration) {
+	c.WorkQueue.AddAfter(key, delay)
+}
+
 // RunController starts the controller's worker threads, the number of which is threadiness. It then blocks until stopCh
 // is closed, at which point it shuts down its internal work queue and waits for workers to finish processing their
 // current work items.
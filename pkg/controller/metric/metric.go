@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	goerrors "errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	informers "github.com/knative/serving/pkg/client/informers/externalversions"
+	autoscalinginformers "github.com/knative/serving/pkg/client/informers/externalversions/autoscaling/v1alpha1"
+	listers "github.com/knative/serving/pkg/client/listers/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/controller"
+	"github.com/knative/serving/pkg/logging/logkey"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	controllerName      = "Metric"
+	controllerAgentName = "metric-controller"
+)
+
+// ErrNotOwned is returned by a MetricSynchronizer when the statistics of a Metric are collected
+// by another autoscaler replica, which is then left to record the status of the Metric.
+var ErrNotOwned = goerrors.New("metric is collected by another replica")
+
+// MetricSynchronizer is an interface for notifying the presence or absence of Metrics.
+type MetricSynchronizer interface {
+	// OnPresent is called when the given Metric exists. It returns an error when the statistics
+	// the Metric describes cannot be collected.
+	OnPresent(metric *v1alpha1.Metric, logger *zap.SugaredLogger) error
+
+	// OnAbsent is called when a Metric in the given namespace with the given name ceases to exist.
+	OnAbsent(namespace string, name string, logger *zap.SugaredLogger)
+}
+
+// Controller tracks Metrics and notifies a MetricSynchronizer of their presence and absence.
+type Controller struct {
+	*controller.Base
+	metricSynch            MetricSynchronizer
+	servingInformerFactory informers.SharedInformerFactory
+	sharedMetricInformer   autoscalinginformers.MetricInformer
+	lister                 listers.MetricLister
+	logger                 *zap.SugaredLogger
+}
+
+// NewController creates a Metric Controller.
+func NewController(
+	opts *controller.Options,
+	metricSynch MetricSynchronizer,
+	informerResyncInterval time.Duration) *Controller {
+	servingInformerFactory := informers.NewSharedInformerFactory(opts.ServingClientSet, informerResyncInterval)
+
+	sharedMetricInformer := servingInformerFactory.Autoscaling().V1alpha1().Metrics()
+
+	c := Controller{
+		Base: controller.NewBase(*opts,
+			controllerAgentName,
+			controllerName,
+		),
+		metricSynch:            metricSynch,
+		servingInformerFactory: servingInformerFactory,
+		sharedMetricInformer:   sharedMetricInformer,
+		lister:                 sharedMetricInformer.Lister(),
+		logger:                 opts.Logger,
+	}
+
+	opts.Logger.Debugf("NewController returning controller %#v", c)
+	return &c
+}
+
+// Run starts the Controller monitoring Metrics. The Controller uses numThreads goroutines for
+// monitoring and blocks until stopCh is closed, at which point it terminates gracefully
+// and returns.
+func (c *Controller) Run(numThreads int, stopCh <-chan struct{}) error {
+	c.logger.Info("Starting metric informer")
+	go c.servingInformerFactory.Start(stopCh)
+
+	c.logger.Info("Waiting for metric informer cache to sync")
+	informer := c.sharedMetricInformer.Informer()
+	if ok := cache.WaitForCacheSync(stopCh, informer.HasSynced); !ok {
+		c.logger.Fatalf("failed to wait for metric informer cache to sync")
+	}
+
+	c.logger.Info("Setting up event handlers")
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.Enqueue,
+		UpdateFunc: controller.PassNew(c.Enqueue),
+		DeleteFunc: c.Enqueue,
+	})
+
+	c.logger.Info("Launching controller worker threads")
+	return c.RunController(numThreads, stopCh, c.Reconcile, controllerName)
+}
+
+// Resync enqueues every Metric known to the Controller, so that they are all reconciled again.
+func (c *Controller) Resync() {
+	metrics, err := c.lister.List(labels.Everything())
+	if err != nil {
+		c.logger.Errorf("Failed to list metrics for resync: %v", err)
+		return
+	}
+	for _, obj := range metrics {
+		c.Enqueue(obj)
+	}
+}
+
+// Reconcile notifies the MetricSynchronizer of the presence or absence of the Metric, and records
+// whether its statistics are collected.
+func (c *Controller) Reconcile(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("invalid resource key %s: %v", key, err))
+		return nil
+	}
+
+	logger := c.logger.With(zap.String(logkey.Namespace, namespace), zap.String(logkey.Name, name))
+	logger.Debug("Reconcile Metric")
+
+	original, err := c.lister.Metrics(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Debug("Metric no longer exists")
+			c.metricSynch.OnAbsent(namespace, name, logger)
+			return nil
+		}
+		runtime.HandleError(err)
+		return err
+	}
+
+	logger.Debug("Metric exists")
+	metric := original.DeepCopy()
+	if err := c.metricSynch.OnPresent(metric, logger); err == ErrNotOwned {
+		logger.Debug("Metric is collected by another replica")
+		return nil
+	} else if err != nil {
+		logger.Errorf("Failed to collect metric: %v", err)
+		metric.Status.MarkNotReady("CollectionFailed", err.Error())
+	} else {
+		metric.Status.MarkReady()
+	}
+
+	if reflect.DeepEqual(original.Status, metric.Status) {
+		return nil
+	}
+	// TODO: for CRD there's no updatestatus, so use normal update
+	if _, err := c.ServingClientSet.AutoscalingV1alpha1().Metrics(namespace).Update(metric); err != nil {
+		logger.Errorf("Failed to update metric status: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	fakeBld "github.com/knative/build/pkg/client/clientset/versioned/fake"
+	"github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	fakeKna "github.com/knative/serving/pkg/client/clientset/versioned/fake"
+	"github.com/knative/serving/pkg/controller"
+	"github.com/knative/serving/pkg/controller/metric"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "test-namespace"
+	testMetric    = "test-revision-metric"
+)
+
+func TestControllerSynchronizesCreatesAndDeletes(t *testing.T) {
+	servingClient, ctl := newTestController(t, nil)
+	fakeSynchronizer := ctl.synch
+
+	servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Create(newTestMetric())
+
+	// Ensure metric creation has been seen before deleting it.
+	select {
+	case <-fakeSynchronizer.createdCh:
+	case <-time.After(time.Minute):
+		t.Fatal("Metric creation notification timed out")
+	}
+
+	// The status records that the statistics are collected.
+	awaitReadyStatus(t, servingClient, corev1.ConditionTrue)
+
+	servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Delete(testMetric, nil)
+
+	// Check the controller terminates normally.
+	ctl.wg.Wait()
+
+	if fakeSynchronizer.onAbsentCallCount.Load() == 0 {
+		t.Fatal("OnAbsent was not called")
+	}
+
+	if fakeSynchronizer.absentRanBeforePresent.Load() {
+		t.Fatal("OnAbsent ran before OnPresent")
+	}
+}
+
+func TestControllerReportsCollectionFailure(t *testing.T) {
+	servingClient, ctl := newTestController(t, errors.New("no scrape target"))
+	defer func() {
+		close(ctl.synch.stopCh)
+		ctl.wg.Wait()
+	}()
+
+	servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Create(newTestMetric())
+
+	cond := awaitReadyStatus(t, servingClient, corev1.ConditionFalse)
+	if got, want := cond.Reason, "CollectionFailed"; got != want {
+		t.Errorf("Ready reason = %q, want %q", got, want)
+	}
+	if got, want := cond.Message, "no scrape target"; got != want {
+		t.Errorf("Ready message = %q, want %q", got, want)
+	}
+}
+
+func TestControllerLeavesNotOwnedMetrics(t *testing.T) {
+	servingClient, ctl := newTestController(t, metric.ErrNotOwned)
+	defer func() {
+		close(ctl.synch.stopCh)
+		ctl.wg.Wait()
+	}()
+
+	servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Create(newTestMetric())
+
+	select {
+	case <-ctl.synch.createdCh:
+	case <-time.After(time.Minute):
+		t.Fatal("Metric creation notification timed out")
+	}
+
+	// Resyncing reconciles the Metric again, still without recording a status.
+	ctl.Resync()
+	timeout := time.After(5 * time.Second)
+	for ctl.synch.onPresentCallCount.Load() < 2 {
+		select {
+		case <-timeout:
+			t.Fatal("Resync did not reconcile the Metric")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	m, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(testMetric, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Metrics.Get() = %v", err)
+	}
+	if cond := m.Status.GetCondition(v1alpha1.MetricConditionReady); cond != nil {
+		t.Errorf("Ready condition = %#v, want none", cond)
+	}
+}
+
+type testController struct {
+	*metric.Controller
+	synch *testMetricSynchronizer
+	wg    *sync.WaitGroup
+}
+
+func newTestController(t *testing.T, presentErr error) (*fakeKna.Clientset, testController) {
+	kubeClient := fakeK8s.NewSimpleClientset()
+	servingClient := fakeKna.NewSimpleClientset()
+	buildClient := fakeBld.NewSimpleClientset()
+
+	opts := controller.Options{
+		KubeClientSet:    kubeClient,
+		ServingClientSet: servingClient,
+		BuildClientSet:   buildClient,
+		Logger:           zap.NewNop().Sugar(),
+	}
+
+	fakeSynchronizer := newTestMetricSynchronizer(presentErr)
+	ctl := metric.NewController(&opts,
+		fakeSynchronizer,
+		time.Duration(0), // disable resynch
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	// Run the controller.
+	go func() {
+		if err := ctl.Run(1, fakeSynchronizer.stopCh); err != nil {
+			t.Errorf("Error running controller: %v", err)
+		}
+		wg.Done()
+	}()
+
+	return servingClient, testController{Controller: ctl, synch: fakeSynchronizer, wg: wg}
+}
+
+func awaitReadyStatus(t *testing.T, servingClient *fakeKna.Clientset, status corev1.ConditionStatus) *v1alpha1.MetricCondition {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		m, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(testMetric, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Metrics.Get() = %v", err)
+		}
+		cond := m.Status.GetCondition(v1alpha1.MetricConditionReady)
+		if cond != nil && cond.Status == status {
+			return cond
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Metric Ready condition is %#v, want status %v", cond, status)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func newTestMetricSynchronizer(presentErr error) *testMetricSynchronizer {
+	return &testMetricSynchronizer{
+		onPresentCallCount:     atomic.NewUint32(0),
+		onAbsentCallCount:      atomic.NewUint32(0),
+		absentRanBeforePresent: atomic.NewBool(false),
+		presentErr:             presentErr,
+		createdCh:              make(chan struct{}),
+		stopCh:                 make(chan struct{}),
+	}
+}
+
+type testMetricSynchronizer struct {
+	onPresentCallCount     *atomic.Uint32
+	onAbsentCallCount      *atomic.Uint32
+	absentRanBeforePresent *atomic.Bool
+	presentErr             error
+	createdCh              chan struct{}
+	stopCh                 chan struct{}
+}
+
+func (metricSynch *testMetricSynchronizer) OnPresent(m *v1alpha1.Metric, logger *zap.SugaredLogger) error {
+	// OnPresent is called again when the status is updated.
+	if metricSynch.onPresentCallCount.Inc() == 1 {
+		close(metricSynch.createdCh)
+	}
+	return metricSynch.presentErr
+}
+
+func (metricSynch *testMetricSynchronizer) OnAbsent(namespace string, name string, logger *zap.SugaredLogger) {
+	metricSynch.onAbsentCallCount.Add(1)
+	if metricSynch.onPresentCallCount.Load() > 0 {
+		// OnAbsent may be called more than once
+		if metricSynch.onAbsentCallCount.Load() == 1 {
+			close(metricSynch.stopCh)
+		}
+	} else {
+		metricSynch.absentRanBeforePresent.Store(true)
+	}
+}
+
+func newTestMetric() *v1alpha1.Metric {
+	return &v1alpha1.Metric{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testMetric,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.MetricSpec{
+			ScrapeTarget: "test-revision",
+		},
+	}
+}
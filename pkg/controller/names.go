@@ -35,3 +35,7 @@ func GetRevisionHeaderName() string {
 func GetRevisionHeaderNamespace() string {
 	return "Knative-Serving-Namespace"
 }
+
+func GetTagHeaderName() string {
+	return "Knative-Serving-Tag"
+}
@@ -18,7 +18,9 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -29,6 +31,7 @@ const (
 	queueSidecarImageKey           = "queueSidecarImage"
 	autoscalerImageKey             = "autoscalerImage"
 	registriesSkippingTagResolving = "registriesSkippingTagResolving"
+	queueSidecarResponseStartKey   = "queueSidecarResponseStartTimeout"
 )
 
 // NewControllerConfigFromMap creates a Controller from the supplied Map
@@ -52,6 +55,17 @@ func NewControllerConfigFromMap(configMap map[string]string) (*Controller, error
 	} else {
 		nc.RegistriesSkippingTagResolving = toStringSet(registries, ",")
 	}
+
+	if rst, ok := configMap[queueSidecarResponseStartKey]; ok {
+		d, err := time.ParseDuration(rst)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s must not be negative, got %v", queueSidecarResponseStartKey, d)
+		}
+		nc.QueueSidecarResponseStartTimeout = d
+	}
 	return nc, nil
 }
 
@@ -81,4 +95,9 @@ type Controller struct {
 
 	// Repositories for which tag to digest resolving should be skipped
 	RegistriesSkippingTagResolving map[string]struct{}
+
+	// QueueSidecarResponseStartTimeout is how long the queue sidecar waits
+	// for the user container to start responding to a request, before
+	// answering it with a 504. Zero means no limit.
+	QueueSidecarResponseStartTimeout time.Duration
 }
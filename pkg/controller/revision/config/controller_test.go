@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/knative/serving/pkg/system"
@@ -137,6 +138,58 @@ func TestNewControllerConfigwWithBadRegisteries(t *testing.T) {
 	}
 }
 
+func TestNewControllerConfigWithResponseStartTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{{
+		name:  "duration",
+		value: "30s",
+		want:  30 * time.Second,
+	}, {
+		name:  "disabled",
+		value: "0s",
+	}, {
+		name:    "not a duration",
+		value:   "thirty seconds",
+		wantErr: true,
+	}, {
+		name:    "negative",
+		value:   "-1s",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := NewControllerConfigFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: system.Namespace,
+					Name:      ControllerConfigName,
+				},
+				Data: map[string]string{
+					queueSidecarImageKey:         "some-image",
+					queueSidecarResponseStartKey: test.value,
+				},
+			})
+
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("NewControllerConfigFromConfigMap() = %v, wanted error", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewControllerConfigFromConfigMap() = %v", err)
+			}
+			if c.QueueSidecarResponseStartTimeout != test.want {
+				t.Errorf("want %v, but got %v", test.want, c.QueueSidecarResponseStartTimeout)
+			}
+		})
+	}
+}
+
 func TestControllerConfiguration(t *testing.T) {
 	b, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s.yaml", ControllerConfigName))
 	if err != nil {
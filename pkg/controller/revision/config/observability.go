@@ -19,6 +19,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"text/template"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -46,6 +47,10 @@ type Observability struct {
 	// LoggingURLTemplate is a string containing the logging url template where
 	// the variable REVISION_UID will be replaced with the created revision's UID.
 	LoggingURLTemplate string
+
+	// RequestLogTemplate is the go text/template used by the queue-proxy to
+	// log each request it serves. Request logging is disabled when empty.
+	RequestLogTemplate string
 }
 
 // NewObservabilityFromConfigMap creates a Observability from the supplied ConfigMap
@@ -66,5 +71,12 @@ func NewObservabilityFromConfigMap(configMap *corev1.ConfigMap) (*Observability,
 	if rut, ok := configMap.Data["logging.revision-url-template"]; ok {
 		oc.LoggingURLTemplate = rut
 	}
+	if rlt, ok := configMap.Data["logging.request-log-template"]; ok {
+		if _, err := template.New("requestLog").Parse(rlt); err != nil {
+			return nil, fmt.Errorf("Received bad Observability ConfigMap, invalid %q: %v",
+				"logging.request-log-template", err)
+		}
+		oc.RequestLogTemplate = rlt
+	}
 	return oc, nil
 }
@@ -43,6 +43,9 @@ func TestNewObservabilityNoEntry(t *testing.T) {
 	if got, want := c.LoggingURLTemplate, ""; got != want {
 		t.Errorf("LoggingURLTemplate = %v, want %v", got, want)
 	}
+	if got, want := c.RequestLogTemplate, ""; got != want {
+		t.Errorf("RequestLogTemplate = %v, want %v", got, want)
+	}
 }
 
 func TestNewObservabilityNoSidecar(t *testing.T) {
@@ -64,6 +67,7 @@ func TestNewObservability(t *testing.T) {
 	wantFSI := "gcr.io/log-stuff/fluentd:latest"
 	wantFSOC := "the-config"
 	wantLUT := "https://logging.io"
+	wantRLT := "{{.Method}} {{.URI}} {{.Status}}"
 	c, err := NewObservabilityFromConfigMap(&corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: system.Namespace,
@@ -74,6 +78,7 @@ func TestNewObservability(t *testing.T) {
 			"logging.fluentd-sidecar-image":         wantFSI,
 			"logging.fluentd-sidecar-output-config": wantFSOC,
 			"logging.revision-url-template":         wantLUT,
+			"logging.request-log-template":          wantRLT,
 		},
 	})
 	if err != nil {
@@ -88,6 +93,24 @@ func TestNewObservability(t *testing.T) {
 	if got := c.LoggingURLTemplate; got != wantLUT {
 		t.Errorf("LoggingURLTemplate = %v, want %v", got, wantLUT)
 	}
+	if got := c.RequestLogTemplate; got != wantRLT {
+		t.Errorf("RequestLogTemplate = %v, want %v", got, wantRLT)
+	}
+}
+
+func TestNewObservabilityBadRequestLogTemplate(t *testing.T) {
+	c, err := NewObservabilityFromConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: system.Namespace,
+			Name:      ObservabilityConfigName,
+		},
+		Data: map[string]string{
+			"logging.request-log-template": "{{.Method",
+		},
+	})
+	if err == nil {
+		t.Fatalf("NewObservabilityFromConfigMap() = %v, want error", c)
+	}
 }
 
 func TestOurObservability(t *testing.T) {
@@ -184,6 +184,7 @@ func newTestController(t *testing.T, servingObjects ...runtime.Object) (
 			"stable-window":               "5m",
 			"panic-window":                "10s",
 			"scale-to-zero-threshold":     "10m",
+			"scale-to-zero-grace-period":  "0s",
 			"concurrency-quantum-of-time": "100ms",
 			"tick-interval":               "2s",
 		},
@@ -78,7 +78,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -150,7 +150,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -231,7 +231,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -258,6 +258,9 @@ func TestMakePodSpec(t *testing.T) {
 				}, {
 					Name: "SERVING_LOGGING_LEVEL",
 					// No logging level
+				}, {
+					Name:  "SERVING_READINESS_PROBE",
+					Value: `{"httpGet":{"path":"/","port":8080}}`,
 				}},
 			}},
 			Volumes: []corev1.Volume{varLogVolume},
@@ -310,7 +313,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -337,6 +340,9 @@ func TestMakePodSpec(t *testing.T) {
 				}, {
 					Name: "SERVING_LOGGING_LEVEL",
 					// No logging level
+				}, {
+					Name:  "SERVING_READINESS_PROBE",
+					Value: `{"exec":{"command":["echo","hello"]}}`,
 				}},
 			}},
 			Volumes: []corev1.Volume{varLogVolume},
@@ -391,7 +397,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -418,6 +424,9 @@ func TestMakePodSpec(t *testing.T) {
 				}, {
 					Name: "SERVING_LOGGING_LEVEL",
 					// No logging level
+				}, {
+					Name:  "SERVING_READINESS_PROBE",
+					Value: `{"httpGet":{"path":"/","port":0}}`,
 				}},
 			}},
 			Volumes: []corev1.Volume{varLogVolume},
@@ -468,7 +477,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -536,7 +545,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -647,7 +656,7 @@ func TestMakePodSpec(t *testing.T) {
 				Lifecycle:      queueLifecycle,
 				ReadinessProbe: queueReadinessProbe,
 				// These changed based on the Revision and configs passed in.
-				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+				Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 				Env: []corev1.EnvVar{{
 					Name:  "SERVING_NAMESPACE",
 					Value: "foo", // matches namespace
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"math"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/controller"
+	"github.com/knative/serving/pkg/controller/revision/resources/names"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultHPAUtilization is the percentage of their CPU or memory requests
+// that the pods of an HPA class Revision are scaled to use when it does not
+// specify a target.
+const defaultHPAUtilization = 80
+
+// MakeHPA creates the HorizontalPodAutoscaler scaling the Deployment of an
+// HPA class Revision, as described by its autoscaling annotations.
+func MakeHPA(rev *v1alpha1.Revision) (*autoscalingv2beta1.HorizontalPodAutoscaler, error) {
+	annotations, err := autoscaling.ParseAnnotations(rev.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	minReplicas := int32(1)
+	if annotations.MinScale > 0 {
+		minReplicas = annotations.MinScale
+	}
+	maxReplicas := int32(math.MaxInt32)
+	if annotations.MaxScale > 0 {
+		maxReplicas = annotations.MaxScale
+	}
+	metric := makeHPAMetric(annotations)
+
+	return &autoscalingv2beta1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.HPA(rev),
+			Namespace:       rev.Namespace,
+			Labels:          makeLabels(rev),
+			Annotations:     makeAnnotations(rev),
+			OwnerReferences: []metav1.OwnerReference{*controller.NewControllerRef(rev)},
+		},
+		Spec: autoscalingv2beta1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       names.Deployment(rev),
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: maxReplicas,
+			Metrics:     []autoscalingv2beta1.MetricSpec{metric},
+		},
+	}, nil
+}
+
+func makeHPAMetric(annotations *autoscaling.Annotations) autoscalingv2beta1.MetricSpec {
+	switch metric := annotations.Metric; metric {
+	case "", autoscaling.CPU, autoscaling.Memory:
+		name := corev1.ResourceCPU
+		if metric == autoscaling.Memory {
+			name = corev1.ResourceMemory
+		}
+		utilization := int32(defaultHPAUtilization)
+		if annotations.Target > 0 {
+			utilization = int32(annotations.Target)
+		}
+		return autoscalingv2beta1.MetricSpec{
+			Type: autoscalingv2beta1.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta1.ResourceMetricSource{
+				Name:                     name,
+				TargetAverageUtilization: &utilization,
+			},
+		}
+
+	default:
+		return autoscalingv2beta1.MetricSpec{
+			Type: autoscalingv2beta1.PodsMetricSourceType,
+			Pods: &autoscalingv2beta1.PodsMetricSource{
+				MetricName:         metric,
+				TargetAverageValue: *annotations.TargetQuantity,
+			},
+		}
+	}
+}
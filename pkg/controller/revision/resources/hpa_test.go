@@ -0,0 +1,192 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	"github.com/knative/serving/pkg/apis/serving"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMakeHPA(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		minReplicas int32
+		maxReplicas int32
+		metric      autoscalingv2beta1.MetricSpec
+	}{{
+		name:        "defaults to cpu",
+		annotations: map[string]string{},
+		minReplicas: 1,
+		maxReplicas: math.MaxInt32,
+		metric:      resourceMetric(corev1.ResourceCPU, 80),
+	}, {
+		name: "memory with bounds and target",
+		annotations: map[string]string{
+			autoscaling.MetricAnnotationKey:   autoscaling.Memory,
+			autoscaling.TargetAnnotationKey:   "60",
+			autoscaling.MinScaleAnnotationKey: "2",
+			autoscaling.MaxScaleAnnotationKey: "10",
+		},
+		minReplicas: 2,
+		maxReplicas: 10,
+		metric:      resourceMetric(corev1.ResourceMemory, 60),
+	}, {
+		name: "custom metric",
+		annotations: map[string]string{
+			autoscaling.MetricAnnotationKey: "queue_length",
+			autoscaling.TargetAnnotationKey: "500m",
+		},
+		minReplicas: 1,
+		maxReplicas: math.MaxInt32,
+		metric: autoscalingv2beta1.MetricSpec{
+			Type: autoscalingv2beta1.PodsMetricSourceType,
+			Pods: &autoscalingv2beta1.PodsMetricSource{
+				MetricName:         "queue_length",
+				TargetAverageValue: resource.MustParse("500m"),
+			},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.annotations[autoscaling.ClassAnnotationKey] = autoscaling.HPA
+			rev := &v1alpha1.Revision{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "foo",
+					Name:        "bar",
+					UID:         "1234",
+					Annotations: test.annotations,
+				},
+			}
+			want := &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "bar-hpa",
+					Labels: map[string]string{
+						serving.RevisionLabelKey: "bar",
+						serving.RevisionUID:      "1234",
+						AppLabelKey:              "bar",
+					},
+					Annotations: test.annotations,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+						Kind:               "Revision",
+						Name:               "bar",
+						UID:                "1234",
+						Controller:         &boolTrue,
+						BlockOwnerDeletion: &boolTrue,
+					}},
+				},
+				Spec: autoscalingv2beta1.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2beta1.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       "bar-deployment",
+					},
+					MinReplicas: &test.minReplicas,
+					MaxReplicas: test.maxReplicas,
+					Metrics:     []autoscalingv2beta1.MetricSpec{test.metric},
+				},
+			}
+
+			got, err := MakeHPA(rev)
+			if err != nil {
+				t.Fatalf("MakeHPA() = %v", err)
+			}
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b resource.Quantity) bool {
+				return a.Cmp(b) == 0
+			})); diff != "" {
+				t.Errorf("MakeHPA (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestMakeHPAErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+	}{{
+		name: "invalid min scale",
+		annotations: map[string]string{
+			autoscaling.MinScaleAnnotationKey: "zero",
+		},
+	}, {
+		name: "non-positive max scale",
+		annotations: map[string]string{
+			autoscaling.MaxScaleAnnotationKey: "0",
+		},
+	}, {
+		name: "min scale above max scale",
+		annotations: map[string]string{
+			autoscaling.MinScaleAnnotationKey: "5",
+			autoscaling.MaxScaleAnnotationKey: "2",
+		},
+	}, {
+		name: "invalid utilization",
+		annotations: map[string]string{
+			autoscaling.TargetAnnotationKey: "80%",
+		},
+	}, {
+		name: "custom metric without target",
+		annotations: map[string]string{
+			autoscaling.MetricAnnotationKey: "queue_length",
+		},
+	}, {
+		name: "custom metric with invalid target",
+		annotations: map[string]string{
+			autoscaling.MetricAnnotationKey: "queue_length",
+			autoscaling.TargetAnnotationKey: "lots",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.annotations[autoscaling.ClassAnnotationKey] = autoscaling.HPA
+			rev := &v1alpha1.Revision{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "foo",
+					Name:        "bar",
+					Annotations: test.annotations,
+				},
+			}
+			if hpa, err := MakeHPA(rev); err == nil {
+				t.Errorf("MakeHPA() = %v, wanted error", hpa)
+			}
+		})
+	}
+}
+
+func resourceMetric(name corev1.ResourceName, utilization int32) autoscalingv2beta1.MetricSpec {
+	return autoscalingv2beta1.MetricSpec{
+		Type: autoscalingv2beta1.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta1.ResourceMetricSource{
+			Name:                     name,
+			TargetAverageUtilization: &utilization,
+		},
+	}
+}
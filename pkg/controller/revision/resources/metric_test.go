@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/knative/serving/pkg/apis/autoscaling"
+	av1alpha1 "github.com/knative/serving/pkg/apis/autoscaling/v1alpha1"
+	"github.com/knative/serving/pkg/apis/serving"
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+func TestMakeMetric(t *testing.T) {
+	tests := []struct {
+		name string
+		rev  *v1alpha1.Revision
+		want *av1alpha1.Metric
+	}{{
+		name: "name is bar",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+		},
+		want: &av1alpha1.Metric{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar-metric",
+				Labels: map[string]string{
+					serving.RevisionLabelKey: "bar",
+					serving.RevisionUID:      "1234",
+					AppLabelKey:              "bar",
+				},
+				Annotations: map[string]string{},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+					Kind:               "Revision",
+					Name:               "bar",
+					UID:                "1234",
+					Controller:         &boolTrue,
+					BlockOwnerDeletion: &boolTrue,
+				}},
+			},
+			Spec: av1alpha1.MetricSpec{
+				ScrapeTarget: "bar",
+			},
+		},
+	}, {
+		name: "with annotations",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "blah",
+				Name:      "baz",
+				UID:       "4321",
+				Annotations: map[string]string{
+					autoscaling.MinScaleAnnotationKey: "2",
+				},
+			},
+		},
+		want: &av1alpha1.Metric{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "blah",
+				Name:      "baz-metric",
+				Labels: map[string]string{
+					serving.RevisionLabelKey: "baz",
+					serving.RevisionUID:      "4321",
+					AppLabelKey:              "baz",
+				},
+				Annotations: map[string]string{
+					autoscaling.MinScaleAnnotationKey: "2",
+				},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+					Kind:               "Revision",
+					Name:               "baz",
+					UID:                "4321",
+					Controller:         &boolTrue,
+					BlockOwnerDeletion: &boolTrue,
+				}},
+			},
+			Spec: av1alpha1.MetricSpec{
+				ScrapeTarget: "baz",
+			},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MakeMetric(test.rev)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MakeMetric (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
@@ -32,6 +32,14 @@ func VPA(rev *v1alpha1.Revision) string {
 	return rev.Name + "-vpa"
 }
 
+func HPA(rev *v1alpha1.Revision) string {
+	return rev.Name + "-hpa"
+}
+
+func Metric(rev *v1alpha1.Revision) string {
+	return rev.Name + "-metric"
+}
+
 func K8sService(rev *v1alpha1.Revision) string {
 	return rev.Name + "-service"
 }
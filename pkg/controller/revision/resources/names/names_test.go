@@ -57,6 +57,24 @@ func TestNamer(t *testing.T) {
 		},
 		f:    VPA,
 		want: "baz-vpa",
+	}, {
+		name: "HPA",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "baz",
+			},
+		},
+		f:    HPA,
+		want: "baz-hpa",
+	}, {
+		name: "Metric",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "baz",
+			},
+		},
+		f:    Metric,
+		want: "baz-metric",
 	}, {
 		name: "K8sService",
 		rev: &v1alpha1.Revision{
@@ -17,8 +17,10 @@ limitations under the License.
 package resources
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/autoscaler"
@@ -44,6 +46,10 @@ var (
 		// Provides health checks and lifecycle hooks.
 		Name:          queue.RequestQueueAdminPortName,
 		ContainerPort: int32(queue.RequestQueueAdminPort),
+	}, {
+		// Provides the Prometheus metrics of the queue-proxy.
+		Name:          queue.RequestQueueMetricsPortName,
+		ContainerPort: int32(queue.RequestQueueMetricsPort),
 	}}
 	// This handler (1) marks the service as not ready and (2)
 	// adds a small delay before the container is killed.
@@ -71,8 +77,8 @@ var (
 )
 
 // makeQueueContainer creates the container spec for queue sidecar.
-func makeQueueContainer(rev *v1alpha1.Revision, loggingConfig *logging.Config, autoscalerConfig *autoscaler.Config,
-	controllerConfig *config.Controller) *corev1.Container {
+func makeQueueContainer(rev *v1alpha1.Revision, loggingConfig *logging.Config, observabilityConfig *config.Observability,
+	autoscalerConfig *autoscaler.Config, controllerConfig *config.Controller) *corev1.Container {
 	configName := ""
 	if owner := metav1.GetControllerOf(rev); owner != nil && owner.Kind == "Configuration" {
 		configName = owner.Name
@@ -92,7 +98,7 @@ func makeQueueContainer(rev *v1alpha1.Revision, loggingConfig *logging.Config, a
 		loggingLevel = ll.String()
 	}
 
-	return &corev1.Container{
+	c := &corev1.Container{
 		Name:           queueContainerName,
 		Image:          controllerConfig.QueueSidecarImage,
 		Resources:      queueResources,
@@ -102,6 +108,7 @@ func makeQueueContainer(rev *v1alpha1.Revision, loggingConfig *logging.Config, a
 		Args: []string{
 			fmt.Sprintf("-concurrencyQuantumOfTime=%v", autoscalerConfig.ConcurrencyQuantumOfTime),
 			fmt.Sprintf("-concurrencyModel=%v", rev.Spec.ConcurrencyModel),
+			fmt.Sprintf("-containerConcurrency=%d", rev.Spec.GetContainerConcurrency()),
 		},
 		Env: []corev1.EnvVar{{
 			Name:  "SERVING_NAMESPACE",
@@ -133,4 +140,31 @@ func makeQueueContainer(rev *v1alpha1.Revision, loggingConfig *logging.Config, a
 			Value: loggingLevel,
 		}},
 	}
+	if rev.Spec.TimeoutSeconds > 0 {
+		c.Args = append(c.Args, fmt.Sprintf("-revisionTimeout=%v", time.Duration(rev.Spec.TimeoutSeconds)*time.Second))
+	}
+	if rst := controllerConfig.QueueSidecarResponseStartTimeout; rst > 0 {
+		c.Args = append(c.Args, fmt.Sprintf("-responseStartTimeout=%v", rst))
+	}
+	if len(rev.Spec.Container.Ports) > 0 {
+		// The Container names the protocol it serves, which requests are
+		// then proxied to it in, rather than the one they were received in.
+		c.Args = append(c.Args, fmt.Sprintf("-protocol=%s", rev.Spec.GetProtocol()))
+	}
+	if probe := rev.Spec.Container.ReadinessProbe; probe != nil {
+		// The queue-proxy runs the readiness probe of the user container
+		// from its own health endpoint. A Probe always marshals.
+		b, _ := json.Marshal(probe)
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  "SERVING_READINESS_PROBE",
+			Value: string(b),
+		})
+	}
+	if observabilityConfig.RequestLogTemplate != "" {
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  "SERVING_REQUEST_LOG_TEMPLATE",
+			Value: observabilityConfig.RequestLogTemplate,
+		})
+	}
+	return c
 }
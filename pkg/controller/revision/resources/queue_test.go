@@ -40,6 +40,7 @@ func TestMakeQueueContainer(t *testing.T) {
 		name string
 		rev  *v1alpha1.Revision
 		lc   *logging.Config
+		oc   *config.Observability
 		ac   *autoscaler.Config
 		cc   *config.Controller
 		want *corev1.Container
@@ -56,6 +57,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			},
 		},
 		lc: &logging.Config{},
+		oc: &config.Observability{},
 		ac: &autoscaler.Config{},
 		cc: &config.Controller{},
 		want: &corev1.Container{
@@ -66,7 +68,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			Lifecycle:      queueLifecycle,
 			ReadinessProbe: queueReadinessProbe,
 			// These changed based on the Revision and configs passed in.
-			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 			Env: []corev1.EnvVar{{
 				Name:  "SERVING_NAMESPACE",
 				Value: "foo", // matches namespace
@@ -108,6 +110,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			},
 		},
 		lc: &logging.Config{},
+		oc: &config.Observability{},
 		ac: &autoscaler.Config{},
 		cc: &config.Controller{
 			QueueSidecarImage: "alpine",
@@ -121,7 +124,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			ReadinessProbe: queueReadinessProbe,
 			// These changed based on the Revision and configs passed in.
 			Image: "alpine",
-			Args:  []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single"},
+			Args:  []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Single", "-containerConcurrency=1"},
 			Env: []corev1.EnvVar{{
 				Name:  "SERVING_NAMESPACE",
 				Value: "foo", // matches namespace
@@ -170,6 +173,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			},
 		},
 		lc: &logging.Config{},
+		oc: &config.Observability{},
 		ac: &autoscaler.Config{},
 		cc: &config.Controller{},
 		want: &corev1.Container{
@@ -180,7 +184,68 @@ func TestMakeQueueContainer(t *testing.T) {
 			Lifecycle:      queueLifecycle,
 			ReadinessProbe: queueReadinessProbe,
 			// These changed based on the Revision and configs passed in.
-			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
+			Env: []corev1.EnvVar{{
+				Name:  "SERVING_NAMESPACE",
+				Value: "baz", // matches namespace
+			}, {
+				Name:  "SERVING_CONFIGURATION",
+				Value: "the-parent-config-name",
+			}, {
+				Name:  "SERVING_REVISION",
+				Value: "blah", // matches name
+			}, {
+				Name:  "SERVING_AUTOSCALER",
+				Value: "autoscaler", // no autoscaler configured.
+			}, {
+				Name:  "SERVING_AUTOSCALER_PORT",
+				Value: "8080",
+			}, {
+				Name: "SERVING_POD",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			}, {
+				Name: "SERVING_LOGGING_CONFIG",
+				// No logging configuration
+			}, {
+				Name: "SERVING_LOGGING_LEVEL",
+				// No logging level
+			}},
+		},
+	}, {
+		name: "container concurrency",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "baz",
+				Name:      "blah",
+				UID:       "1234",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+					Kind:               "Configuration",
+					Name:               "the-parent-config-name",
+					Controller:         &boolTrue,
+					BlockOwnerDeletion: &boolTrue,
+				}},
+			},
+			Spec: v1alpha1.RevisionSpec{
+				ConcurrencyModel:     "Multi",
+				ContainerConcurrency: 10,
+			},
+		},
+		lc: &logging.Config{},
+		oc: &config.Observability{},
+		ac: &autoscaler.Config{},
+		cc: &config.Controller{},
+		want: &corev1.Container{
+			// These are effectively constant
+			Name:           queueContainerName,
+			Resources:      queueResources,
+			Ports:          queuePorts,
+			Lifecycle:      queueLifecycle,
+			ReadinessProbe: queueReadinessProbe,
+			// These changed based on the Revision and configs passed in.
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=10"},
 			Env: []corev1.EnvVar{{
 				Name:  "SERVING_NAMESPACE",
 				Value: "baz", // matches namespace
@@ -227,6 +292,7 @@ func TestMakeQueueContainer(t *testing.T) {
 				"queueproxy": zapcore.ErrorLevel,
 			},
 		},
+		oc: &config.Observability{},
 		ac: &autoscaler.Config{},
 		cc: &config.Controller{},
 		want: &corev1.Container{
@@ -237,7 +303,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			Lifecycle:      queueLifecycle,
 			ReadinessProbe: queueReadinessProbe,
 			// These changed based on the Revision and configs passed in.
-			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi"},
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 			Env: []corev1.EnvVar{{
 				Name:  "SERVING_NAMESPACE",
 				Value: "log", // matches namespace
@@ -279,6 +345,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			},
 		},
 		lc: &logging.Config{},
+		oc: &config.Observability{},
 		ac: &autoscaler.Config{
 			ConcurrencyQuantumOfTime: 12 * time.Minute,
 		},
@@ -293,7 +360,7 @@ func TestMakeQueueContainer(t *testing.T) {
 			Lifecycle:      queueLifecycle,
 			ReadinessProbe: queueReadinessProbe,
 			// These changed based on the Revision and configs passed in.
-			Args: []string{"-concurrencyQuantumOfTime=12m0s", "-concurrencyModel=Multi"},
+			Args: []string{"-concurrencyQuantumOfTime=12m0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
 			Env: []corev1.EnvVar{{
 				Name:  "SERVING_NAMESPACE",
 				Value: "what-does-the", // matches namespace
@@ -322,11 +389,246 @@ func TestMakeQueueContainer(t *testing.T) {
 				// No logging config
 			}},
 		},
+	}, {
+		name: "request log template",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+			Spec: v1alpha1.RevisionSpec{
+				ConcurrencyModel: "Multi",
+			},
+		},
+		lc: &logging.Config{},
+		oc: &config.Observability{
+			RequestLogTemplate: "{{.Method}} {{.URI}} {{.Status}}",
+		},
+		ac: &autoscaler.Config{},
+		cc: &config.Controller{},
+		want: &corev1.Container{
+			// These are effectively constant
+			Name:           queueContainerName,
+			Resources:      queueResources,
+			Ports:          queuePorts,
+			Lifecycle:      queueLifecycle,
+			ReadinessProbe: queueReadinessProbe,
+			// These changed based on the Revision and configs passed in.
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0"},
+			Env: []corev1.EnvVar{{
+				Name:  "SERVING_NAMESPACE",
+				Value: "foo", // matches namespace
+			}, {
+				Name: "SERVING_CONFIGURATION",
+				// No OwnerReference
+			}, {
+				Name:  "SERVING_REVISION",
+				Value: "bar", // matches name
+			}, {
+				Name:  "SERVING_AUTOSCALER",
+				Value: "autoscaler", // no autoscaler configured.
+			}, {
+				Name:  "SERVING_AUTOSCALER_PORT",
+				Value: "8080",
+			}, {
+				Name: "SERVING_POD",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			}, {
+				Name: "SERVING_LOGGING_CONFIG",
+				// No logging config
+			}, {
+				Name: "SERVING_LOGGING_LEVEL",
+				// No logging config
+			}, {
+				Name:  "SERVING_REQUEST_LOG_TEMPLATE",
+				Value: "{{.Method}} {{.URI}} {{.Status}}",
+			}},
+		},
+	}, {
+		name: "timeouts",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+			Spec: v1alpha1.RevisionSpec{
+				ConcurrencyModel: "Multi",
+				TimeoutSeconds:   90,
+			},
+		},
+		lc: &logging.Config{},
+		oc: &config.Observability{},
+		ac: &autoscaler.Config{},
+		cc: &config.Controller{
+			QueueSidecarResponseStartTimeout: 10 * time.Second,
+		},
+		want: &corev1.Container{
+			// These are effectively constant
+			Name:           queueContainerName,
+			Resources:      queueResources,
+			Ports:          queuePorts,
+			Lifecycle:      queueLifecycle,
+			ReadinessProbe: queueReadinessProbe,
+			// These changed based on the Revision and configs passed in.
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0",
+				"-revisionTimeout=1m30s", "-responseStartTimeout=10s"},
+			Env: []corev1.EnvVar{{
+				Name:  "SERVING_NAMESPACE",
+				Value: "foo", // matches namespace
+			}, {
+				Name: "SERVING_CONFIGURATION",
+				// No OwnerReference
+			}, {
+				Name:  "SERVING_REVISION",
+				Value: "bar", // matches name
+			}, {
+				Name:  "SERVING_AUTOSCALER",
+				Value: "autoscaler", // no autoscaler configured.
+			}, {
+				Name:  "SERVING_AUTOSCALER_PORT",
+				Value: "8080",
+			}, {
+				Name: "SERVING_POD",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			}, {
+				Name: "SERVING_LOGGING_CONFIG",
+				// No logging config
+			}, {
+				Name: "SERVING_LOGGING_LEVEL",
+				// No logging config
+			}},
+		},
+	}, {
+		name: "h2c",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+			Spec: v1alpha1.RevisionSpec{
+				ConcurrencyModel: "Multi",
+				Container: corev1.Container{
+					Ports: []corev1.ContainerPort{{
+						Name:          "h2c",
+						ContainerPort: 8080,
+					}},
+				},
+			},
+		},
+		lc: &logging.Config{},
+		oc: &config.Observability{},
+		ac: &autoscaler.Config{},
+		cc: &config.Controller{},
+		want: &corev1.Container{
+			// These are effectively constant
+			Name:           queueContainerName,
+			Resources:      queueResources,
+			Ports:          queuePorts,
+			Lifecycle:      queueLifecycle,
+			ReadinessProbe: queueReadinessProbe,
+			// These changed based on the Revision and configs passed in.
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0",
+				"-protocol=h2c"},
+			Env: []corev1.EnvVar{{
+				Name:  "SERVING_NAMESPACE",
+				Value: "foo", // matches namespace
+			}, {
+				Name: "SERVING_CONFIGURATION",
+				// No OwnerReference
+			}, {
+				Name:  "SERVING_REVISION",
+				Value: "bar", // matches name
+			}, {
+				Name:  "SERVING_AUTOSCALER",
+				Value: "autoscaler", // no autoscaler configured.
+			}, {
+				Name:  "SERVING_AUTOSCALER_PORT",
+				Value: "8080",
+			}, {
+				Name: "SERVING_POD",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			}, {
+				Name: "SERVING_LOGGING_CONFIG",
+				// No logging config
+			}, {
+				Name: "SERVING_LOGGING_LEVEL",
+				// No logging config
+			}},
+		},
+	}, {
+		name: "other port name",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+			Spec: v1alpha1.RevisionSpec{
+				ConcurrencyModel: "Multi",
+				Container: corev1.Container{
+					Ports: []corev1.ContainerPort{{
+						Name:          "http",
+						ContainerPort: 8080,
+					}},
+				},
+			},
+		},
+		lc: &logging.Config{},
+		oc: &config.Observability{},
+		ac: &autoscaler.Config{},
+		cc: &config.Controller{},
+		want: &corev1.Container{
+			// These are effectively constant
+			Name:           queueContainerName,
+			Resources:      queueResources,
+			Ports:          queuePorts,
+			Lifecycle:      queueLifecycle,
+			ReadinessProbe: queueReadinessProbe,
+			// These changed based on the Revision and configs passed in.
+			Args: []string{"-concurrencyQuantumOfTime=0s", "-concurrencyModel=Multi", "-containerConcurrency=0",
+				"-protocol=http1"},
+			Env: []corev1.EnvVar{{
+				Name:  "SERVING_NAMESPACE",
+				Value: "foo", // matches namespace
+			}, {
+				Name: "SERVING_CONFIGURATION",
+				// No OwnerReference
+			}, {
+				Name:  "SERVING_REVISION",
+				Value: "bar", // matches name
+			}, {
+				Name:  "SERVING_AUTOSCALER",
+				Value: "autoscaler", // no autoscaler configured.
+			}, {
+				Name:  "SERVING_AUTOSCALER_PORT",
+				Value: "8080",
+			}, {
+				Name: "SERVING_POD",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			}, {
+				Name: "SERVING_LOGGING_CONFIG",
+				// No logging config
+			}, {
+				Name: "SERVING_LOGGING_LEVEL",
+				// No logging config
+			}},
+		},
 	}}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := makeQueueContainer(test.rev, test.lc, test.ac, test.cc)
+			got := makeQueueContainer(test.rev, test.lc, test.oc, test.ac, test.cc)
 			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreUnexported(resource.Quantity{})); diff != "" {
 				t.Errorf("makeQueueContainer (-want, +got) = %v", diff)
 			}
@@ -28,13 +28,20 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var (
-	servicePorts = []corev1.ServicePort{{
-		Name:       "http",
+// makeServicePorts returns the ports of the revision's service. The port
+// is named after the protocol the revision serves, which tells the
+// activator and Istio whether to proxy requests to it over HTTP/2.
+func makeServicePorts(rev *v1alpha1.Revision) []corev1.ServicePort {
+	name := "http"
+	if rev.Spec.GetProtocol() == v1alpha1.RevisionProtocolH2C {
+		name = "http2"
+	}
+	return []corev1.ServicePort{{
+		Name:       name,
 		Port:       ServicePort,
 		TargetPort: intstr.IntOrString{Type: intstr.String, StrVal: queue.RequestQueuePortName},
 	}}
-)
+}
 
 // MakeK8sService creates a Kubernetes Service that targets all pods with the same
 // serving.RevisionLabelKey label. Traffic is routed to queue-proxy port.
@@ -48,7 +55,7 @@ func MakeK8sService(rev *v1alpha1.Revision) *corev1.Service {
 			OwnerReferences: []metav1.OwnerReference{*controller.NewControllerRef(rev)},
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: servicePorts,
+			Ports: makeServicePorts(rev),
 			Type:  "NodePort",
 			Selector: map[string]string{
 				serving.RevisionLabelKey: rev.Name,
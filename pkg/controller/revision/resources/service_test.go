@@ -22,9 +22,11 @@ import (
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+	"github.com/knative/serving/pkg/queue"
 )
 
 func TestMakeK8sService(t *testing.T) {
@@ -61,8 +63,12 @@ func TestMakeK8sService(t *testing.T) {
 				}},
 			},
 			Spec: corev1.ServiceSpec{
-				Ports: servicePorts,
-				Type:  "NodePort",
+				Ports: []corev1.ServicePort{{
+					Name:       "http",
+					Port:       ServicePort,
+					TargetPort: intstr.FromString(queue.RequestQueuePortName),
+				}},
+				Type: "NodePort",
 				Selector: map[string]string{
 					serving.RevisionLabelKey: "bar",
 				},
@@ -97,13 +103,64 @@ func TestMakeK8sService(t *testing.T) {
 				}},
 			},
 			Spec: corev1.ServiceSpec{
-				Ports: servicePorts,
-				Type:  "NodePort",
+				Ports: []corev1.ServicePort{{
+					Name:       "http",
+					Port:       ServicePort,
+					TargetPort: intstr.FromString(queue.RequestQueuePortName),
+				}},
+				Type: "NodePort",
 				Selector: map[string]string{
 					serving.RevisionLabelKey: "baz",
 				},
 			},
 		},
+	}, {
+		name: "h2c revision",
+		rev: &v1alpha1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "blah",
+				Name:      "grpc",
+				UID:       "1234",
+			},
+			Spec: v1alpha1.RevisionSpec{
+				Container: corev1.Container{
+					Ports: []corev1.ContainerPort{{
+						Name: "h2c",
+					}},
+				},
+			},
+		},
+		want: &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "blah",
+				Name:      "grpc-service",
+				Labels: map[string]string{
+					serving.RevisionLabelKey: "grpc",
+					serving.RevisionUID:      "1234",
+					AppLabelKey:              "grpc",
+				},
+				Annotations: map[string]string{},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+					Kind:               "Revision",
+					Name:               "grpc",
+					UID:                "1234",
+					Controller:         &boolTrue,
+					BlockOwnerDeletion: &boolTrue,
+				}},
+			},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{
+					Name:       "http2",
+					Port:       ServicePort,
+					TargetPort: intstr.FromString(queue.RequestQueuePortName),
+				}},
+				Type: "NodePort",
+				Selector: map[string]string{
+					serving.RevisionLabelKey: "grpc",
+				},
+			},
+		},
 	}}
 
 	for _, test := range tests {
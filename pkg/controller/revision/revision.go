@@ -29,6 +29,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/autoscaler"
 	"github.com/knative/serving/pkg/controller/revision/config"
@@ -320,9 +321,15 @@ func (c *Controller) reconcile(ctx context.Context, rev *v1alpha1.Revision) erro
 		}, {
 			name: "autoscaler k8s service",
 			f:    c.reconcileAutoscalerService,
+		}, {
+			name: "autoscaler metric",
+			f:    c.reconcileMetric,
 		}, {
 			name: "vertical pod autoscaler",
 			f:    c.reconcileVPA,
+		}, {
+			name: "horizontal pod autoscaler",
+			f:    c.reconcileHPA,
 		}}
 
 		for _, phase := range phases {
@@ -389,17 +396,32 @@ func (c *Controller) reconcileDeployment(ctx context.Context, rev *v1alpha1.Revi
 			logger.Errorf("Error reconciling deployment %q: %v", deploymentName, getDepErr)
 			return getDepErr
 		} else {
-			// Deployment exist. Update the replica count based on the serving state if necessary
-			var changed Changed
-			var err error
-			deployment, changed, err = c.checkAndUpdateDeployment(ctx, rev, deployment)
-			if err != nil {
-				logger.Errorf("Error updating deployment %q: %v", deploymentName, err)
-				return err
+			if rev.Spec.ServingState == v1alpha1.RevisionServingStateReserve {
+				// Route traffic to the activator before scaling down.
+				rev.Status.MarkInactive()
 			}
-			if changed == WasChanged {
-				logger.Infof("Updated deployment %q", deploymentName)
-				rev.Status.MarkDeploying("Updating")
+			if remaining := c.scaleToZeroGraceRemaining(rev); remaining > 0 {
+				// Keep the pods until the routes have switched over.
+				logger.Infof("Scaling deployment %q to zero in %v", deploymentName, remaining)
+				c.EnqueueKeyAfter(rev.Namespace+"/"+rev.Name, remaining)
+			} else {
+				// Deployment exist. Update the replica count based on the serving state if necessary
+				annotations, err := autoscaling.ParseAnnotations(rev.Annotations)
+				if err != nil {
+					logger.Error("Error parsing the autoscaling annotations", zap.Error(err))
+					return err
+				}
+				activationScale := autoscaler.ActivationScaleFor(annotations)
+				var changed Changed
+				deployment, changed, err = c.checkAndUpdateDeployment(ctx, rev, deployment, activationScale)
+				if err != nil {
+					logger.Errorf("Error updating deployment %q: %v", deploymentName, err)
+					return err
+				}
+				if changed == WasChanged {
+					logger.Infof("Updated deployment %q", deploymentName)
+					rev.Status.MarkDeploying("Updating")
+				}
 			}
 		}
 
@@ -433,12 +455,30 @@ func (c *Controller) reconcileDeployment(ctx context.Context, rev *v1alpha1.Revi
 	}
 }
 
+// scaleToZeroGraceRemaining returns how much longer the pods of a Reserve
+// revision are kept after it was marked Inactive.
+func (c *Controller) scaleToZeroGraceRemaining(rev *v1alpha1.Revision) time.Duration {
+	if rev.Spec.ServingState != v1alpha1.RevisionServingStateReserve {
+		return 0
+	}
+	cond := rev.Status.GetCondition(v1alpha1.RevisionConditionReady)
+	if cond == nil || cond.Reason != "Inactive" {
+		return 0
+	}
+	return cond.LastTransitionTime.Add(c.getAutoscalerConfig().ScaleToZeroGracePeriod).Sub(time.Now())
+}
+
 func (c *Controller) createDeployment(ctx context.Context, rev *v1alpha1.Revision) (*appsv1.Deployment, error) {
 	logger := logging.FromContext(ctx)
 
-	var replicaCount int32 = 1
-	if rev.Spec.ServingState == v1alpha1.RevisionServingStateReserve {
-		replicaCount = 0
+	var replicaCount int32
+	if rev.Spec.ServingState != v1alpha1.RevisionServingStateReserve {
+		annotations, err := autoscaling.ParseAnnotations(rev.Annotations)
+		if err != nil {
+			logger.Error("Error parsing the autoscaling annotations", zap.Error(err))
+			return nil, err
+		}
+		replicaCount = c.getAutoscalerConfig().InitialScaleFor(annotations)
 	}
 	deployment := resources.MakeDeployment(rev, c.getLoggingConfig(), c.getNetworkConfig(),
 		c.getObservabilityConfig(), c.getAutoscalerConfig(), c.getControllerConfig(), replicaCount)
@@ -453,8 +493,9 @@ func (c *Controller) createDeployment(ctx context.Context, rev *v1alpha1.Revisio
 	return c.KubeClientSet.AppsV1().Deployments(deployment.Namespace).Create(deployment)
 }
 
-// This is a generic function used both for deployment of user code & autoscaler
-func (c *Controller) checkAndUpdateDeployment(ctx context.Context, rev *v1alpha1.Revision, deployment *appsv1.Deployment) (*appsv1.Deployment, Changed, error) {
+// This is a generic function used both for deployment of user code & autoscaler.
+// A deployment scaled to zero is scaled to activationScale when the revision is active.
+func (c *Controller) checkAndUpdateDeployment(ctx context.Context, rev *v1alpha1.Revision, deployment *appsv1.Deployment, activationScale int32) (*appsv1.Deployment, Changed, error) {
 	logger := logging.FromContext(ctx)
 
 	// TODO(mattmoor): Generalize this to reconcile discrepancies vs. what
@@ -465,7 +506,7 @@ func (c *Controller) checkAndUpdateDeployment(ctx context.Context, rev *v1alpha1
 		desiredDeployment.Spec.Replicas = &one
 	}
 	if rev.Spec.ServingState == v1alpha1.RevisionServingStateActive && *desiredDeployment.Spec.Replicas == 0 {
-		*desiredDeployment.Spec.Replicas = 1
+		*desiredDeployment.Spec.Replicas = activationScale
 	} else if rev.Spec.ServingState == v1alpha1.RevisionServingStateReserve && *desiredDeployment.Spec.Replicas != 0 {
 		*desiredDeployment.Spec.Replicas = 0
 	}
@@ -577,6 +618,10 @@ func (c *Controller) reconcileService(ctx context.Context, rev *v1alpha1.Revisio
 			// If it does not exist, then we have nothing to do.
 			return nil
 		}
+		if c.scaleToZeroGraceRemaining(rev) > 0 {
+			// Keep the Service for as long as the pods behind it.
+			return nil
+		}
 		if err := c.deleteService(ctx, service); err != nil {
 			logger.Errorf("Error deleting Service %q: %v", serviceName, err)
 			return err
@@ -670,8 +715,9 @@ func (c *Controller) reconcileFluentdConfigMap(ctx context.Context, rev *v1alpha
 }
 
 func (c *Controller) reconcileAutoscalerService(ctx context.Context, rev *v1alpha1.Revision) error {
-	// If an autoscaler image is undefined, then skip the autoscaler reconciliation.
-	if c.getControllerConfig().AutoscalerImage == "" {
+	// If an autoscaler image is undefined, or the revision is scaled by an
+	// HPA, then skip the autoscaler reconciliation.
+	if c.getControllerConfig().AutoscalerImage == "" || usesHPA(rev) {
 		return nil
 	}
 
@@ -735,8 +781,9 @@ func (c *Controller) reconcileAutoscalerService(ctx context.Context, rev *v1alph
 }
 
 func (c *Controller) reconcileAutoscalerDeployment(ctx context.Context, rev *v1alpha1.Revision) error {
-	// If an autoscaler image is undefined, then skip the autoscaler reconciliation.
-	if c.getControllerConfig().AutoscalerImage == "" {
+	// If an autoscaler image is undefined, or the revision is scaled by an
+	// HPA, then skip the autoscaler reconciliation.
+	if c.getControllerConfig().AutoscalerImage == "" || usesHPA(rev) {
 		return nil
 	}
 
@@ -763,7 +810,7 @@ func (c *Controller) reconcileAutoscalerDeployment(ctx context.Context, rev *v1a
 		} else {
 			// Deployment exist. Update the replica count based on the serving state if necessary
 			var err error
-			deployment, _, err = c.checkAndUpdateDeployment(ctx, rev, deployment)
+			deployment, _, err = c.checkAndUpdateDeployment(ctx, rev, deployment, 1)
 			if err != nil {
 				logger.Errorf("Error updating deployment %q: %v", deploymentName, err)
 				return err
@@ -802,6 +849,66 @@ func (c *Controller) createAutoscalerDeployment(ctx context.Context, rev *v1alph
 	return c.KubeClientSet.AppsV1().Deployments(deployment.Namespace).Create(deployment)
 }
 
+func (c *Controller) reconcileMetric(ctx context.Context, rev *v1alpha1.Revision) error {
+	// If an autoscaler image is defined, the revision is scaled by its own
+	// autoscaler rather than the multitenant one. If it is scaled by an
+	// HPA, there are no statistics to collect.
+	if c.getControllerConfig().AutoscalerImage != "" || usesHPA(rev) {
+		return nil
+	}
+
+	ns := rev.Namespace
+	metricName := resourcenames.Metric(rev)
+	logger := logging.FromContext(ctx)
+	metricClient := c.ServingClientSet.AutoscalingV1alpha1().Metrics(ns)
+
+	metric, err := metricClient.Get(metricName, metav1.GetOptions{})
+	switch rev.Spec.ServingState {
+	case v1alpha1.RevisionServingStateActive, v1alpha1.RevisionServingStateReserve:
+		// When Active or Reserved, the Metric should exist and have a
+		// particular specification, so that the autoscaler can activate
+		// the revision again.
+		desiredMetric := resources.MakeMetric(rev)
+		if apierrs.IsNotFound(err) {
+			// If it does not exist, then create it.
+			if _, err := metricClient.Create(desiredMetric); err != nil {
+				logger.Errorf("Error creating Metric %q: %v", metricName, err)
+				return err
+			}
+			logger.Infof("Created Metric %q", metricName)
+		} else if err != nil {
+			logger.Errorf("Error reconciling Metric %q: %v", metricName, err)
+			return err
+		} else if !equality.Semantic.DeepEqual(desiredMetric.Spec, metric.Spec) {
+			metric.Spec = desiredMetric.Spec
+			if _, err := metricClient.Update(metric); err != nil {
+				logger.Errorf("Error updating Metric %q: %v", metricName, err)
+				return err
+			}
+			logger.Infof("Updated Metric %q", metricName)
+		}
+		return nil
+
+	case v1alpha1.RevisionServingStateRetired:
+		// When Retired, we remove the Metric.
+		if apierrs.IsNotFound(err) {
+			// If it does not exist, then we have nothing to do.
+			return nil
+		}
+		err := metricClient.Delete(metricName, fgDeleteOptions)
+		if err != nil && !apierrs.IsNotFound(err) {
+			logger.Errorf("Error deleting Metric %q: %v", metricName, err)
+			return err
+		}
+		logger.Infof("Deleted Metric %q", metricName)
+		return nil
+
+	default:
+		logger.Errorf("Unknown serving state: %v", rev.Spec.ServingState)
+		return nil
+	}
+}
+
 func (c *Controller) reconcileVPA(ctx context.Context, rev *v1alpha1.Revision) error {
 	logger := logging.FromContext(ctx)
 	if !c.getAutoscalerConfig().EnableVPA {
@@ -877,6 +984,74 @@ func (c *Controller) deleteVPA(ctx context.Context, vpa *vpav1alpha1.VerticalPod
 	return nil
 }
 
+// usesHPA tells whether the revision is scaled by a HorizontalPodAutoscaler
+// rather than the built-in autoscaler.
+func usesHPA(rev *v1alpha1.Revision) bool {
+	return rev.Annotations[autoscaling.ClassAnnotationKey] == autoscaling.HPA
+}
+
+func (c *Controller) reconcileHPA(ctx context.Context, rev *v1alpha1.Revision) error {
+	logger := logging.FromContext(ctx)
+	if !usesHPA(rev) {
+		return nil
+	}
+
+	ns := rev.Namespace
+	hpaName := resourcenames.HPA(rev)
+	hpaClient := c.KubeClientSet.AutoscalingV2beta1().HorizontalPodAutoscalers(ns)
+
+	// TODO(mattmoor): Switch to informer lister once it can reliably be sunk.
+	hpa, err := hpaClient.Get(hpaName, metav1.GetOptions{})
+	switch rev.Spec.ServingState {
+	case v1alpha1.RevisionServingStateActive, v1alpha1.RevisionServingStateReserve:
+		// When Active or Reserved, the HPA should exist and have a
+		// particular specification. It leaves a Deployment scaled to
+		// zero alone, so it need not be removed while Reserved.
+		desiredHPA, makeErr := resources.MakeHPA(rev)
+		if makeErr != nil {
+			logger.Errorf("Error making HPA %q: %v", hpaName, makeErr)
+			return makeErr
+		}
+		if apierrs.IsNotFound(err) {
+			// If it does not exist, then create it.
+			if _, err := hpaClient.Create(desiredHPA); err != nil {
+				logger.Errorf("Error creating HPA %q: %v", hpaName, err)
+				return err
+			}
+			logger.Infof("Created HPA %q", hpaName)
+		} else if err != nil {
+			logger.Errorf("Error reconciling HPA %q: %v", hpaName, err)
+			return err
+		} else if !equality.Semantic.DeepEqual(desiredHPA.Spec, hpa.Spec) {
+			hpa.Spec = desiredHPA.Spec
+			if _, err := hpaClient.Update(hpa); err != nil {
+				logger.Errorf("Error updating HPA %q: %v", hpaName, err)
+				return err
+			}
+			logger.Infof("Updated HPA %q", hpaName)
+		}
+		return nil
+
+	case v1alpha1.RevisionServingStateRetired:
+		// When Retired, we remove the underlying HPA.
+		if apierrs.IsNotFound(err) {
+			// If it does not exist, then we have nothing to do.
+			return nil
+		}
+		err := hpaClient.Delete(hpaName, fgDeleteOptions)
+		if err != nil && !apierrs.IsNotFound(err) {
+			logger.Errorf("Error deleting HPA %q: %v", hpaName, err)
+			return err
+		}
+		logger.Infof("Deleted HPA %q", hpaName)
+		return nil
+
+	default:
+		logger.Errorf("Unknown serving state: %v", rev.Spec.ServingState)
+		return nil
+	}
+}
+
 func (c *Controller) updateStatus(rev *v1alpha1.Revision) (*v1alpha1.Revision, error) {
 	newRev, err := c.revisionLister.Revisions(rev.Namespace).Get(rev.Name)
 	if err != nil {
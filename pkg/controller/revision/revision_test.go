@@ -40,6 +40,7 @@ import (
 	buildv1alpha1 "github.com/knative/build/pkg/apis/build/v1alpha1"
 	fakebuildclientset "github.com/knative/build/pkg/client/clientset/versioned/fake"
 	buildinformers "github.com/knative/build/pkg/client/informers/externalversions"
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	fakeclientset "github.com/knative/serving/pkg/client/clientset/versioned/fake"
@@ -171,6 +172,7 @@ func newTestControllerWithConfig(t *testing.T, controllerConfig *config.Controll
 			"stable-window":               "5m",
 			"panic-window":                "10s",
 			"scale-to-zero-threshold":     "10m",
+			"scale-to-zero-grace-period":  "0s",
 			"concurrency-quantum-of-time": "100ms",
 			"tick-interval":               "2s",
 		},
@@ -628,6 +630,56 @@ func TestNoAutoscalerImageCreatesNoAutoscalers(t *testing.T) {
 	}
 }
 
+func TestNoAutoscalerImageCreatesMetric(t *testing.T) {
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
+	rev := getTestRevision()
+	// Update controller config with no autoscaler image
+	controller.receiveControllerConfig(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "config-controller",
+				Namespace: system.Namespace,
+			},
+			Data: map[string]string{
+				"queueSidecarImage": testQueueImage,
+			},
+		})
+	controller.resolver = &nopResolver{}
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	metric, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(resourcenames.Metric(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Couldn't get metric: %v", err)
+	}
+	if got, want := metric.Spec.ScrapeTarget, rev.Name; got != want {
+		t.Errorf("Metric ScrapeTarget = %q, want %q", got, want)
+	}
+
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateReserve
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	if _, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(resourcenames.Metric(rev), metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected Metric to be kept for a Reserve revision, got: %v", err)
+	}
+
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateRetired
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	if _, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(resourcenames.Metric(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected Metric to be deleted, got: %v", err)
+	}
+}
+
+func TestAutoscalerImageCreatesNoMetric(t *testing.T) {
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
+	rev := getTestRevision()
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	if _, err := servingClient.AutoscalingV1alpha1().Metrics(testNamespace).Get(resourcenames.Metric(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected no Metric for a revision with its own autoscaler, got: %v", err)
+	}
+}
+
 func TestNoQueueSidecarImageUpdateFail(t *testing.T) {
 	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
 	rev := getTestRevision()
@@ -773,6 +825,151 @@ func TestReconcileReplicaCount(t *testing.T) {
 	}
 }
 
+func TestReconcileActivationScale(t *testing.T) {
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
+	rev := getTestRevision()
+	rev.Annotations = map[string]string{
+		autoscaling.ActivationScaleAnnotationKey: "5",
+	}
+
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateReserve
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	// Activate the revision. Replicas should jump to the activation scale,
+	// while the autoscaler still runs a single replica.
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateActive
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+	d1, err := kubeClient.AppsV1().Deployments(testNamespace).Get(resourcenames.Deployment(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected to have a deployment but found none: %v", err)
+	}
+	if *d1.Spec.Replicas != 5 {
+		t.Errorf("Expected deployment to have 5 replicas, got: %v", *d1.Spec.Replicas)
+	}
+	d2, err := kubeClient.AppsV1().Deployments(system.Namespace).Get(resourcenames.Autoscaler(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected to have an autoscaler deployment but found none: %v", err)
+	}
+	if *d2.Spec.Replicas != 1 {
+		t.Errorf("Expected autoscaler deployment to have 1 replicas, got: %v", *d2.Spec.Replicas)
+	}
+}
+
+func TestReconcileScaleToZeroGracePeriod(t *testing.T) {
+	controllerConfig := getTestControllerConfig()
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestControllerWithConfig(t, controllerConfig, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: system.Namespace,
+			Name:      autoscaler.ConfigName,
+		},
+		Data: map[string]string{
+			"max-scale-up-rate":           "1.0",
+			"single-concurrency-target":   "1.0",
+			"multi-concurrency-target":    "1.0",
+			"stable-window":               "5m",
+			"panic-window":                "10s",
+			"scale-to-zero-threshold":     "10m",
+			"scale-to-zero-grace-period":  "1m",
+			"concurrency-quantum-of-time": "100ms",
+			"tick-interval":               "2s",
+		},
+	}, getTestControllerConfigMap(),
+	)
+	revClient := servingClient.ServingV1alpha1().Revisions(testNamespace)
+	rev := getTestRevision()
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateReserve
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	// Within the grace period traffic goes to the activator, but the pods
+	// and the Service are kept.
+	rev, err := revClient.Get(rev.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Couldn't get revision: %v", err)
+	}
+	if !rev.Status.IsActivationRequired() {
+		t.Errorf("Expected revision to require activation, got conditions: %v", rev.Status.Conditions)
+	}
+	d, err := kubeClient.AppsV1().Deployments(testNamespace).Get(resourcenames.Deployment(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected to have a deployment but found none: %v", err)
+	}
+	if *d.Spec.Replicas == 0 {
+		t.Errorf("Expected deployment to keep its replicas during the grace period, got: %v", *d.Spec.Replicas)
+	}
+	if _, err := kubeClient.CoreV1().Services(testNamespace).Get(resourcenames.K8sService(rev), metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected Service to be kept during the grace period: %v", err)
+	}
+
+	// Once the grace period has passed the revision is scaled to zero.
+	for i, cond := range rev.Status.Conditions {
+		if cond.Type == v1alpha1.RevisionConditionReady {
+			rev.Status.Conditions[i].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+		}
+	}
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	d, err = kubeClient.AppsV1().Deployments(testNamespace).Get(resourcenames.Deployment(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected to have a deployment but found none: %v", err)
+	}
+	if *d.Spec.Replicas != 0 {
+		t.Errorf("Expected deployment to have 0 replicas, got: %v", *d.Spec.Replicas)
+	}
+	if _, err := kubeClient.CoreV1().Services(testNamespace).Get(resourcenames.K8sService(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected Service to be deleted, got: %v", err)
+	}
+}
+
+func TestCreateRevWithHPAClass(t *testing.T) {
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
+	rev := getTestRevision()
+	rev.Annotations = map[string]string{
+		autoscaling.ClassAnnotationKey:    autoscaling.HPA,
+		autoscaling.MaxScaleAnnotationKey: "10",
+	}
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	hpa, err := kubeClient.AutoscalingV2beta1().HorizontalPodAutoscalers(testNamespace).Get(resourcenames.HPA(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Couldn't get hpa: %v", err)
+	}
+	if got, want := hpa.Spec.ScaleTargetRef.Name, resourcenames.Deployment(rev); got != want {
+		t.Errorf("HPA scales %q, want %q", got, want)
+	}
+	if got, want := hpa.Spec.MaxReplicas, int32(10); got != want {
+		t.Errorf("HPA MaxReplicas = %d, want %d", got, want)
+	}
+	if _, err := kubeClient.AppsV1().Deployments(system.Namespace).Get(resourcenames.Autoscaler(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected no autoscaler deployment for an HPA class revision, got: %v", err)
+	}
+
+	rev.Spec.ServingState = v1alpha1.RevisionServingStateRetired
+	updateRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	if _, err := kubeClient.AutoscalingV2beta1().HorizontalPodAutoscalers(testNamespace).Get(resourcenames.HPA(rev), metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected HPA to be deleted, got: %v", err)
+	}
+}
+
+func TestCreateRevWithInitialScale(t *testing.T) {
+	kubeClient, _, servingClient, _, controller, kubeInformer, _, servingInformer, _, _ := newTestController(t)
+	rev := getTestRevision()
+	rev.Annotations = map[string]string{
+		autoscaling.InitialScaleAnnotationKey: "3",
+	}
+	createRevision(t, kubeClient, kubeInformer, servingClient, servingInformer, controller, rev)
+
+	deployment, err := kubeClient.AppsV1().Deployments(testNamespace).Get(resourcenames.Deployment(rev), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Couldn't get deployment: %v", err)
+	}
+	if got, want := *deployment.Spec.Replicas, int32(3); got != want {
+		t.Errorf("Deployment Replicas = %d, want %d", got, want)
+	}
+}
+
 func TestReceiveLoggingConfig(t *testing.T) {
 	_, _, _, _, controller, _, _, _, _, _ := newTestController(t)
 	cm := corev1.ConfigMap{
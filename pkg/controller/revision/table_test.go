@@ -468,6 +468,27 @@ func TestReconcile(t *testing.T) {
 			svcAS("foo", "update-user-deploy-failure", "Active", "busybox"),
 		},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: makeStatus(
+				rev("foo", "update-user-deploy-failure", "Reserve", "busybox"),
+				// Traffic is routed to the activator before the Deployment is scaled down.
+				v1alpha1.RevisionStatus{
+					ServiceName: svc("foo", "update-user-deploy-failure", "Reserve", "busybox").Name,
+					LogURL:      "http://logger.io/test-uid",
+					Conditions: []v1alpha1.RevisionCondition{{
+						Type:   "ResourcesAvailable",
+						Status: "Unknown",
+						Reason: "Deploying",
+					}, {
+						Type:   "ContainerHealthy",
+						Status: "Unknown",
+						Reason: "Deploying",
+					}, {
+						Type:   "Ready",
+						Status: "False",
+						Reason: "Inactive",
+					}},
+				}),
+		}, {
 			Object: deploy("foo", "update-user-deploy-failure", "Reserve", "busybox"),
 			// We don't get to updating the autoscaler deployment or deleting services.
 		}},
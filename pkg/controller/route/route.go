@@ -101,6 +101,12 @@ func NewController(
 		UpdateFunc: controller.PassNew(c.EnqueueReferringRoute),
 	})
 
+	// The autoscaler moves the activator in and out of the path of
+	// Revisions, which only changes their annotations.
+	revisionInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.enqueueRouteOnActivatorInPathChange,
+	})
+
 	// TODO(mattmoor): We should Reconcile Routes when controlled Services
 	// and VirtualServices change.
 
@@ -248,6 +254,31 @@ func (c *Controller) EnqueueReferringRoute(obj interface{}) {
 	c.Enqueue(route)
 }
 
+func (c *Controller) enqueueRouteOnActivatorInPathChange(old, new interface{}) {
+	oldRev, ok := old.(*v1alpha1.Revision)
+	if !ok {
+		return
+	}
+	newRev, ok := new.(*v1alpha1.Revision)
+	if !ok {
+		return
+	}
+	key := serving.ActivatorInPathAnnotationKey
+	if oldRev.Annotations[key] == newRev.Annotations[key] {
+		return
+	}
+	configName, ok := newRev.Labels[serving.ConfigurationLabelKey]
+	if !ok {
+		return
+	}
+	config, err := c.configurationLister.Configurations(newRev.Namespace).Get(configName)
+	if err != nil {
+		c.Logger.Errorf("Error fetching configuration %s of revision %s: %v", configName, newRev.Name, err)
+		return
+	}
+	c.EnqueueReferringRoute(config)
+}
+
 /////////////////////////////////////////
 // Misc helpers.
 /////////////////////////////////////////
@@ -160,7 +160,7 @@ func (t *trafficConfigBuilder) addConfigurationTarget(tt *v1alpha1.TrafficTarget
 	}
 	target := RevisionTarget{
 		TrafficTarget: *tt,
-		Active:        !rev.Status.IsActivationRequired(),
+		Active:        isActive(rev),
 	}
 	target.TrafficTarget.RevisionName = rev.Name
 	t.addFlattenedTarget(target)
@@ -177,7 +177,7 @@ func (t *trafficConfigBuilder) addRevisionTarget(tt *v1alpha1.TrafficTarget) err
 	}
 	target := RevisionTarget{
 		TrafficTarget: *tt,
-		Active:        !rev.Status.IsActivationRequired(),
+		Active:        isActive(rev),
 	}
 	t.revisions[tt.RevisionName] = rev
 	if configName, ok := rev.Labels[serving.ConfigurationLabelKey]; ok {
@@ -240,3 +240,9 @@ func (t *trafficConfigBuilder) build() (*TrafficConfig, error) {
 		Revisions:      t.revisions,
 	}, t.deferredTargetErr
 }
+
+// isActive tells whether traffic for the Revision can be routed to its pods directly, rather than through the
+// activator, which is kept in the path while the Revision needs activating or lacks spare burst capacity.
+func isActive(rev *v1alpha1.Revision) bool {
+	return !rev.Status.IsActivationRequired() && rev.Annotations[serving.ActivatorInPathAnnotationKey] != "true"
+}
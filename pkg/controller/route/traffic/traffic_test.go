@@ -62,6 +62,10 @@ var (
 	inactiveConfig *v1alpha1.Configuration
 	inactiveRev    *v1alpha1.Revision
 
+	// burstyConfig only has burstyRev, which is ready but has the activator in its path.
+	burstyConfig *v1alpha1.Configuration
+	burstyRev    *v1alpha1.Revision
+
 	// goodConfig has two good revisions: goodOldRev and goodNewRev
 	goodConfig *v1alpha1.Configuration
 	goodOldRev *v1alpha1.Revision
@@ -82,6 +86,7 @@ func setUp() {
 	unreadyConfig, unreadyRev = getTestUnreadyConfig("unready")
 	failedConfig, failedRev = getTestFailedConfig("failed")
 	inactiveConfig, inactiveRev = getTestInactiveConfig("inactive")
+	burstyConfig, burstyRev = getTestActivatorInPathConfig("bursty")
 	goodConfig, goodOldRev, goodNewRev = getTestReadyConfig("good")
 	niceConfig, niceOldRev, niceNewRev = getTestReadyConfig("nice")
 	servingClient := fakeclientset.NewSimpleClientset()
@@ -97,6 +102,7 @@ func setUp() {
 		unreadyConfig, unreadyRev,
 		failedConfig, failedRev,
 		inactiveConfig, inactiveRev,
+		burstyConfig, burstyRev,
 		revDeletedConfig,
 		emptyConfig,
 		goodConfig, goodOldRev, goodNewRev,
@@ -169,6 +175,33 @@ func TestBuildTrafficConfiguration_VanillaScaledToZero(t *testing.T) {
 	}
 }
 
+// The vanilla use case of 100% directing to latest revision of a configuration whose pods lack burst capacity.
+func TestBuildTrafficConfiguration_VanillaActivatorInPath(t *testing.T) {
+	tts := []v1alpha1.TrafficTarget{{
+		ConfigurationName: burstyConfig.Name,
+		Percent:           100,
+	}}
+	expected := &TrafficConfig{
+		Targets: map[string][]RevisionTarget{
+			"": {{
+				TrafficTarget: v1alpha1.TrafficTarget{
+					ConfigurationName: burstyConfig.Name,
+					RevisionName:      burstyRev.Name,
+					Percent:           100,
+				},
+				Active: false,
+			}},
+		},
+		Configurations: map[string]*v1alpha1.Configuration{burstyConfig.Name: burstyConfig},
+		Revisions:      map[string]*v1alpha1.Revision{burstyRev.Name: burstyRev},
+	}
+	if tc, err := BuildTrafficConfiguration(configLister, revLister, getTestRouteWithTrafficTargets(tts)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if diff := cmp.Diff(expected, tc); diff != "" {
+		t.Errorf("Unexpected traffic diff (-want +got): %v", diff)
+	}
+}
+
 // Transitioning from one good config to another by splitting traffic.
 func TestBuildTrafficConfiguration_TwoConfigs(t *testing.T) {
 	tts := []v1alpha1.TrafficTarget{{
@@ -695,6 +728,19 @@ func getTestInactiveConfig(name string) (*v1alpha1.Configuration, *v1alpha1.Revi
 	return config, rev
 }
 
+func getTestActivatorInPathConfig(name string) (*v1alpha1.Configuration, *v1alpha1.Revision) {
+	config := getTestConfig(name + "-config")
+	rev := getTestRevForConfig(config, name+"-revision")
+	rev.Annotations = map[string]string{
+		serving.ActivatorInPathAnnotationKey: "true",
+	}
+	rev.Status.MarkResourcesAvailable()
+	rev.Status.MarkContainerHealthy()
+	config.Status.SetLatestReadyRevisionName(rev.Name)
+	config.Status.SetLatestCreatedRevisionName(rev.Name)
+	return config, rev
+}
+
 func getTestReadyConfig(name string) (*v1alpha1.Configuration, *v1alpha1.Revision, *v1alpha1.Revision) {
 	config := getTestConfig(name + "-config")
 	rev1 := getTestRevForConfig(config, name+"-revision-1")
@@ -1,9 +1,13 @@
 package h2c
 
 import (
-	"crypto/tls"
+	"context"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"golang.org/x/net/http2"
 )
@@ -12,10 +16,257 @@ import (
 // to explicitly allow h2c (http2 without TLS) transport.
 // See https://github.com/golang/go/issues/14141 for more details.
 func NewTransport() http.RoundTripper {
-	return &http2.Transport{
-		AllowHTTP: true,
-		DialTLS: func(netw, addr string, cfg *tls.Config) (net.Conn, error) {
-			return net.Dial(netw, addr)
-		},
+	return newTransport((&net.Dialer{}).DialContext)
+}
+
+// NewTransportWithTimeouts is like NewTransport, but gives up connecting
+// after connectTimeout and waiting for the response headers after
+// responseTimeout. A zero timeout means no limit.
+func NewTransportWithTimeouts(connectTimeout, responseTimeout time.Duration) http.RoundTripper {
+	return NewTransportWithDialer((&net.Dialer{Timeout: connectTimeout}).DialContext, responseTimeout)
+}
+
+// NewTransportWithDialer is like NewTransportWithTimeouts, but opens
+// connections with dial, passing it the context of the request the
+// connection is opened for.
+func NewTransportWithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), responseTimeout time.Duration) http.RoundTripper {
+	t := newTransport(dial)
+	if responseTimeout <= 0 {
+		return t
+	}
+	return &responseTimeoutTransport{transport: t, timeout: responseTimeout}
+}
+
+// transport is an http2.Transport whose connections are opened by a
+// connPool. The DialTLS hook of the vendored http2.Transport is not
+// passed the context of the request, so requests would otherwise keep
+// waiting on a dial after they are cancelled.
+type transport struct {
+	transport *http2.Transport
+	pool      *connPool
+}
+
+func newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *transport {
+	pool := &connPool{dial: dial, conns: make(map[string][]*clientConn)}
+	pool.transport = &http2.Transport{AllowHTTP: true, ConnPool: pool}
+	return &transport{transport: pool.transport, pool: pool}
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// The pool records the connection the request ends up being sent
+	// over in req, which stays in use until the response body is closed.
+	req := &pooledRequest{}
+	resp, err := t.transport.RoundTrip(r.WithContext(context.WithValue(r.Context(), pooledRequestKey{}, req)))
+	if err != nil {
+		t.pool.release(req)
+		return nil, err
+	}
+	resp.Body = &callOnClose{ReadCloser: resp.Body, fn: func() { t.pool.release(req) }}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the connections no request is in flight on.
+func (t *transport) CloseIdleConnections() {
+	t.pool.closeIdle()
+}
+
+// connPool implements http2.ClientConnPool, dialing connections with the
+// context of the request they are first needed for. It counts the
+// requests in flight on each connection, which the vendored
+// http2.ClientConn does not tell, so that idle connections can be closed.
+type connPool struct {
+	transport *http2.Transport
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mux   sync.Mutex
+	conns map[string][]*clientConn
+}
+
+type clientConn struct {
+	*http2.ClientConn
+	conn     net.Conn
+	addr     string
+	inFlight int
+	// retired connections take no more requests, and are closed once
+	// none is in flight on them.
+	retired bool
+}
+
+// pooledRequest is the connection a request was last sent over.
+type pooledRequest struct {
+	cc *clientConn
+}
+
+type pooledRequestKey struct{}
+
+// GetClientConn implements http2.ClientConnPool.
+func (p *connPool) GetClientConn(r *http.Request, addr string) (*http2.ClientConn, error) {
+	p.mux.Lock()
+	cc := p.usable(addr)
+	if cc == nil {
+		p.mux.Unlock()
+		var err error
+		if cc, err = p.newConn(r.Context(), addr); err != nil {
+			return nil, err
+		}
+		p.mux.Lock()
+		p.conns[addr] = append(p.conns[addr], cc)
+	}
+	defer p.mux.Unlock()
+
+	// Requests retried by the http2.Transport over another connection
+	// are no longer in flight on the one they were first sent over.
+	if req, ok := r.Context().Value(pooledRequestKey{}).(*pooledRequest); ok {
+		p.releaseLocked(req)
+		req.cc = cc
+		cc.inFlight++
+	}
+	return cc.ClientConn, nil
+}
+
+// newConn opens a connection to addr. Only the dial is bound to ctx, as
+// the connection outlives the request it is opened for.
+func (p *connPool) newConn(ctx context.Context, addr string) (*clientConn, error) {
+	conn, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	h2cc, err := p.transport.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &clientConn{ClientConn: h2cc, conn: conn, addr: addr}, nil
+}
+
+// MarkDead implements http2.ClientConnPool.
+func (p *connPool) MarkDead(h2cc *http2.ClientConn) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, conns := range p.conns {
+		for _, cc := range conns {
+			if cc.ClientConn == h2cc {
+				p.retireLocked(cc)
+				return
+			}
+		}
+	}
+}
+
+// usable returns a connection to addr that can take a new request, if
+// any. Connections that cannot and have no request in flight, as they
+// were closed or told to go away, are retired. p.mux must be held.
+func (p *connPool) usable(addr string) *clientConn {
+	for _, cc := range p.conns[addr] {
+		switch {
+		case cc.CanTakeNewRequest():
+			return cc
+		case cc.inFlight == 0:
+			p.retireLocked(cc)
+		}
+	}
+	return nil
+}
+
+// retireLocked removes cc from the pool, closing it at once if no request
+// is in flight on it. p.mux must be held.
+func (p *connPool) retireLocked(cc *clientConn) {
+	if cc.retired {
+		return
+	}
+	cc.retired = true
+	conns := p.conns[cc.addr]
+	for i := range conns {
+		if conns[i] == cc {
+			conns = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(p.conns, cc.addr)
+	} else {
+		p.conns[cc.addr] = conns
+	}
+	if cc.inFlight == 0 {
+		cc.conn.Close()
+	}
+}
+
+func (p *connPool) release(req *pooledRequest) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.releaseLocked(req)
+}
+
+// releaseLocked records that req is no longer in flight on its
+// connection. p.mux must be held.
+func (p *connPool) releaseLocked(req *pooledRequest) {
+	cc := req.cc
+	if cc == nil {
+		return
+	}
+	req.cc = nil
+	cc.inFlight--
+	if cc.retired && cc.inFlight == 0 {
+		cc.conn.Close()
+	}
+}
+
+func (p *connPool) closeIdle() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, conns := range p.conns {
+		for _, cc := range conns {
+			if cc.inFlight == 0 {
+				p.retireLocked(cc)
+			}
+		}
+	}
+}
+
+// responseTimeoutTransport cancels requests whose response headers do not
+// arrive within timeout. The http2 transport has no equivalent of
+// http.Transport's ResponseHeaderTimeout.
+type responseTimeoutTransport struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+func (t *responseTimeoutTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(r.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	resp, err := t.transport.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() && err == nil {
+		// The timer fired just as the headers arrived.
+		resp.Body.Close()
+		err = fmt.Errorf("timeout awaiting response headers from %s", r.URL.Host)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The body is streamed after RoundTrip returns, so the request is
+	// only cancelled once it has been closed.
+	resp.Body = &callOnClose{ReadCloser: resp.Body, fn: cancel}
+	return resp, nil
+}
+
+// callOnClose calls fn once the body it wraps is closed.
+type callOnClose struct {
+	io.ReadCloser
+	fn func()
+}
+
+func (c *callOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.fn()
+	return err
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport.
+func (t *responseTimeoutTransport) CloseIdleConnections() {
+	if c, ok := t.transport.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2c
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// listenH2C serves handler with HTTP/2 over cleartext, with prior
+// knowledge, until the returned listener is closed.
+func listenH2C(t *testing.T, handler http.Handler) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	return l
+}
+
+// trackingDialer records the connections it opens.
+type trackingDialer struct {
+	mux   sync.Mutex
+	conns []*trackingConn
+}
+
+func (d *trackingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	tc := &trackingConn{Conn: conn}
+	d.conns = append(d.conns, tc)
+	return tc, nil
+}
+
+func (d *trackingDialer) dialed() []*trackingConn {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return append([]*trackingConn(nil), d.conns...)
+}
+
+// trackingConn records whether it was closed.
+type trackingConn struct {
+	net.Conn
+	mux    sync.Mutex
+	closed bool
+}
+
+func (c *trackingConn) Close() error {
+	c.mux.Lock()
+	c.closed = true
+	c.mux.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *trackingConn) isClosed() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.closed
+}
+
+func TestTransport_DialBoundToRequest(t *testing.T) {
+	dialStarted := make(chan struct{})
+	transport := NewTransportWithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		close(dialStarted)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest(http.MethodGet, "http://rev.default.svc.cluster.local/", nil)
+	errCh := make(chan error)
+	go func() {
+		_, err := transport.RoundTrip(req.WithContext(ctx))
+		errCh <- err
+	}()
+	<-dialStarted
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("RoundTrip() = nil, want an error for the cancelled request")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("RoundTrip() kept waiting on the dial after the request was cancelled")
+	}
+}
+
+func TestTransport_ClosesIdleConnections(t *testing.T) {
+	l := listenH2C(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer l.Close()
+	dialer := &trackingDialer{}
+	transport := NewTransportWithDialer(dialer.DialContext, 0)
+	get := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+l.Addr().String()+"/", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() = %v", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		return resp
+	}
+	closeIdle := transport.(interface{ CloseIdleConnections() }).CloseIdleConnections
+
+	get().Body.Close()
+	inFlight := get()
+	conns := dialer.dialed()
+	if len(conns) != 1 {
+		t.Fatalf("Dialed %d connections, want 1 shared by both requests", len(conns))
+	}
+
+	closeIdle()
+	if conns[0].isClosed() {
+		t.Error("CloseIdleConnections() closed a connection with a request in flight")
+	}
+	inFlight.Body.Close()
+	closeIdle()
+	if !conns[0].isClosed() {
+		t.Error("CloseIdleConnections() left an idle connection open")
+	}
+
+	get().Body.Close()
+	if got := len(dialer.dialed()); got != 2 {
+		t.Errorf("Dialed %d connections, want a new one after the idle one was closed", got)
+	}
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package leaderelection
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	leaseHolderKey    = "holder"
+	leaseRenewTimeKey = "renewTime"
+)
+
+// Buckets shards keys across the replicas of a component. Each key hashes
+// to one of a fixed number of buckets, and is owned by the replica holding
+// the lease of its bucket. Replicas only hold their fair share of the
+// leases, so that the buckets are spread across the replicas that are
+// alive.
+type Buckets struct {
+	kubeClient    kubernetes.Interface
+	namespace     string
+	name          string
+	self          string
+	buckets       int
+	leaseDuration time.Duration
+	now           func() time.Time // for testing
+
+	mux sync.RWMutex
+	// held maps the buckets whose lease self holds to when it was last
+	// renewed.
+	held     map[int]time.Time
+	onChange func()
+}
+
+// NewBuckets creates Buckets sharding keys into the given number of
+// buckets, whose leases are held by self for leaseDuration unless renewed.
+// The leases are kept in the ConfigMaps of the given namespace named
+// after name, which tells apart the work shared by different components.
+func NewBuckets(kubeClient kubernetes.Interface, namespace, name, self string, buckets int, leaseDuration time.Duration) *Buckets {
+	return &Buckets{
+		kubeClient:    kubeClient,
+		namespace:     namespace,
+		name:          name,
+		self:          self,
+		buckets:       buckets,
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+		held:          make(map[int]time.Time),
+	}
+}
+
+// OnChange registers f to be called whenever leases are acquired or
+// given up, for the work of the keys changing hands to be picked up or
+// dropped.
+func (b *Buckets) OnChange(f func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.onChange = f
+}
+
+// Bucket returns the bucket of the key made of the given namespace and
+// name.
+func (b *Buckets) Bucket(namespace, name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace + "/" + name))
+	return int(h.Sum32() % uint32(b.buckets))
+}
+
+// Owns reports whether this replica holds the lease of the bucket of the
+// key made of the given namespace and name. A lease that could not be
+// renewed in time is no longer held, since another replica may have taken
+// it over. It is forgotten then, which is a change of the buckets held.
+func (b *Buckets) Owns(namespace, name string) bool {
+	now := b.now()
+	b.mux.RLock()
+	renewed, ok := b.held[b.Bucket(namespace, name)]
+	b.mux.RUnlock()
+	if ok && now.Sub(renewed) >= b.leaseDuration {
+		before := b.heldBuckets()
+		b.forgetExpired(now)
+		b.notifyIfChanged(before)
+		return false
+	}
+	return ok
+}
+
+// Run acquires and renews leases until stopCh is closed, then releases
+// the leases held so that other replicas take them over right away.
+func (b *Buckets) Run(stopCh <-chan struct{}, logger *zap.SugaredLogger) {
+	// Renewing several times per lease duration leaves room for a failed
+	// update before the lease expires.
+	ticker := time.NewTicker(b.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		b.Sync(logger)
+		select {
+		case <-stopCh:
+			b.Release(logger)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lease is the state of a bucket's lease ConfigMap.
+type lease struct {
+	cm      *corev1.ConfigMap
+	holder  string
+	renewed time.Time
+}
+
+func (b *Buckets) expired(l lease, now time.Time) bool {
+	return l.holder == "" || now.Sub(l.renewed) >= b.leaseDuration
+}
+
+// Sync makes a single pass over the buckets, renewing the leases held,
+// taking over expired ones and giving up those beyond this replica's fair
+// share of the buckets.
+func (b *Buckets) Sync(logger *zap.SugaredLogger) {
+	defer b.notifyIfChanged(b.heldBuckets())
+
+	now := b.now()
+	live, err := b.heartbeat(now)
+	if err != nil {
+		logger.Errorf("Failed to record %s membership: %v", b.name, err)
+	}
+	live[b.self] = true
+	leases := make([]lease, b.buckets)
+	for i := range leases {
+		l, err := b.getLease(i)
+		if err != nil {
+			logger.Errorf("Failed to get lease of %s %d: %v", b.name, i, err)
+			// Counting the bucket as held by another replica keeps it
+			// from being taken over blindly.
+			l = lease{holder: "unknown", renewed: now}
+		}
+		leases[i] = l
+		if !b.expired(l, now) {
+			live[l.holder] = true
+		}
+	}
+	share := (b.buckets + len(live) - 1) / len(live)
+	held := 0
+	for _, l := range leases {
+		if l.holder == b.self && !b.expired(l, now) {
+			held++
+		}
+	}
+
+	for i, l := range leases {
+		switch {
+		case l.holder == b.self && !b.expired(l, now) && held > share:
+			// Give the bucket up for a replica holding less than its share.
+			held--
+			b.releaseLease(i, l, logger)
+		case l.holder == b.self && !b.expired(l, now):
+			b.writeLease(i, l, now, logger)
+		case b.expired(l, now) && held < share:
+			if b.writeLease(i, l, now, logger) {
+				held++
+			}
+		}
+	}
+	// Leases whose ConfigMap could not be read were not renewed either.
+	b.forgetExpired(now)
+}
+
+// Release gives up the leases held, and stops counting self among the
+// replicas sharing the buckets.
+func (b *Buckets) Release(logger *zap.SugaredLogger) {
+	defer b.notifyIfChanged(b.heldBuckets())
+
+	configMaps := b.kubeClient.CoreV1().ConfigMaps(b.namespace)
+	if cm, err := configMaps.Get(b.membersConfigMapName(), metav1.GetOptions{}); err == nil {
+		cm = cm.DeepCopy()
+		delete(cm.Data, b.self)
+		if _, err := configMaps.Update(cm); err != nil {
+			logger.Errorf("Failed to leave %s membership: %v", b.name, err)
+		}
+	}
+	now := b.now()
+	for i := 0; i < b.buckets; i++ {
+		l, err := b.getLease(i)
+		if err != nil {
+			logger.Errorf("Failed to get lease of %s %d: %v", b.name, i, err)
+			continue
+		}
+		if l.holder == b.self && !b.expired(l, now) {
+			b.releaseLease(i, l, logger)
+		}
+	}
+}
+
+// heartbeat records that self is alive as of now, and returns the
+// replicas that recently did the same.
+func (b *Buckets) heartbeat(now time.Time) (map[string]bool, error) {
+	live := make(map[string]bool)
+	configMaps := b.kubeClient.CoreV1().ConfigMaps(b.namespace)
+	cm, err := configMaps.Get(b.membersConfigMapName(), metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		_, err = configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      b.membersConfigMapName(),
+				Namespace: b.namespace,
+			},
+			Data: map[string]string{b.self: now.UTC().Format(time.RFC3339Nano)},
+		})
+		return live, err
+	} else if err != nil {
+		return live, err
+	}
+	data := make(map[string]string, len(cm.Data)+1)
+	for member, raw := range cm.Data {
+		// Members that stopped recording themselves are dropped, so
+		// that the ConfigMap does not grow forever.
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil && now.Sub(t) < b.leaseDuration {
+			live[member] = true
+			data[member] = raw
+		}
+	}
+	data[b.self] = now.UTC().Format(time.RFC3339Nano)
+	cm = cm.DeepCopy()
+	cm.Data = data
+	_, err = configMaps.Update(cm)
+	return live, err
+}
+
+// membersConfigMapName is the ConfigMap the replicas sharing the buckets
+// record themselves in, so that replicas holding no lease yet are counted
+// when dividing the buckets.
+func (b *Buckets) membersConfigMapName() string {
+	return b.name + "-members"
+}
+
+// configMapName is the ConfigMap holding the lease of bucket.
+func (b *Buckets) configMapName(bucket int) string {
+	return fmt.Sprintf("%s-%d", b.name, bucket)
+}
+
+func (b *Buckets) getLease(bucket int) (lease, error) {
+	cm, err := b.kubeClient.CoreV1().ConfigMaps(b.namespace).Get(b.configMapName(bucket), metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return lease{}, nil
+	} else if err != nil {
+		return lease{}, err
+	}
+	l := lease{cm: cm, holder: cm.Data[leaseHolderKey]}
+	if raw, ok := cm.Data[leaseRenewTimeKey]; ok {
+		if l.renewed, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return lease{}, fmt.Errorf("invalid %s %q: %v", leaseRenewTimeKey, raw, err)
+		}
+	}
+	return l, nil
+}
+
+// writeLease records self as the holder of bucket, as of now. Writes are
+// conditional on the ConfigMap not having changed since l was read, so
+// that only one of the replicas racing for a lease gets it.
+func (b *Buckets) writeLease(bucket int, l lease, now time.Time, logger *zap.SugaredLogger) bool {
+	data := map[string]string{
+		leaseHolderKey:    b.self,
+		leaseRenewTimeKey: now.UTC().Format(time.RFC3339Nano),
+	}
+	configMaps := b.kubeClient.CoreV1().ConfigMaps(b.namespace)
+	var err error
+	if l.cm == nil {
+		_, err = configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      b.configMapName(bucket),
+				Namespace: b.namespace,
+			},
+			Data: data,
+		})
+	} else {
+		cm := l.cm.DeepCopy()
+		cm.Data = data
+		_, err = configMaps.Update(cm)
+	}
+	if err != nil {
+		if !apierrs.IsConflict(err) && !apierrs.IsAlreadyExists(err) {
+			logger.Errorf("Failed to write lease of %s %d: %v", b.name, bucket, err)
+		}
+		b.forget(bucket)
+		return false
+	}
+	if l.holder != b.self {
+		logger.Infof("Acquired lease of %s %d", b.name, bucket)
+	}
+	b.mux.Lock()
+	b.held[bucket] = now
+	b.mux.Unlock()
+	return true
+}
+
+// releaseLease clears the holder of bucket, so that it is expired for the
+// other replicas.
+func (b *Buckets) releaseLease(bucket int, l lease, logger *zap.SugaredLogger) {
+	b.forget(bucket)
+	cm := l.cm.DeepCopy()
+	cm.Data = map[string]string{}
+	if _, err := b.kubeClient.CoreV1().ConfigMaps(b.namespace).Update(cm); err != nil {
+		logger.Errorf("Failed to release lease of %s %d: %v", b.name, bucket, err)
+		return
+	}
+	logger.Infof("Released lease of %s %d", b.name, bucket)
+}
+
+func (b *Buckets) forget(bucket int) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.held, bucket)
+}
+
+// forgetExpired forgets the leases held that were last renewed a lease
+// duration or more before now.
+func (b *Buckets) forgetExpired(now time.Time) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for bucket, renewed := range b.held {
+		if now.Sub(renewed) >= b.leaseDuration {
+			delete(b.held, bucket)
+		}
+	}
+}
+
+func (b *Buckets) heldBuckets() map[int]bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	held := make(map[int]bool, len(b.held))
+	for bucket := range b.held {
+		held[bucket] = true
+	}
+	return held
+}
+
+// notifyIfChanged calls the OnChange callback if the buckets held differ
+// from before.
+func (b *Buckets) notifyIfChanged(before map[int]bool) {
+	after := b.heldBuckets()
+	changed := len(before) != len(after)
+	for bucket := range before {
+		changed = changed || !after[bucket]
+	}
+	b.mux.RLock()
+	f := b.onChange
+	b.mux.RUnlock()
+	if changed && f != nil {
+		f()
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/knative/serving/pkg/logging/testing"
+	"k8s.io/client-go/kubernetes"
+	fakeK8s "k8s.io/client-go/kubernetes/fake"
+)
+
+const testBuckets = 8
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestBuckets(k8s kubernetes.Interface, self string, clock *testClock) *Buckets {
+	b := NewBuckets(k8s, "knative-serving", "test-bucket", self, testBuckets, 15*time.Second)
+	b.now = clock.Now
+	return b
+}
+
+// ownedBuckets returns how many buckets b owns, by finding a revision
+// name falling in each bucket.
+func ownedBuckets(b *Buckets) int {
+	names := make(map[int]string)
+	for i := 0; len(names) < testBuckets; i++ {
+		name := fmt.Sprintf("rev-%d", i)
+		if _, ok := names[b.Bucket("default", name)]; !ok {
+			names[b.Bucket("default", name)] = name
+		}
+	}
+	owned := 0
+	for _, name := range names {
+		if b.Owns("default", name) {
+			owned++
+		}
+	}
+	return owned
+}
+
+func TestBuckets_SingleReplica(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+
+	if got := ownedBuckets(a); got != 0 {
+		t.Errorf("Unexpected buckets owned before syncing. Want 0. Got %v.", got)
+	}
+	a.Sync(TestLogger(t))
+	if got := ownedBuckets(a); got != testBuckets {
+		t.Errorf("Unexpected buckets owned. Want %v. Got %v.", testBuckets, got)
+	}
+
+	// Ownership ends with the lease unless it is renewed.
+	clock.now = clock.now.Add(20 * time.Second)
+	if got := ownedBuckets(a); got != 0 {
+		t.Errorf("Unexpected buckets owned once the leases expired. Want 0. Got %v.", got)
+	}
+	a.Sync(TestLogger(t))
+	if got := ownedBuckets(a); got != testBuckets {
+		t.Errorf("Unexpected buckets owned after renewing. Want %v. Got %v.", testBuckets, got)
+	}
+}
+
+func TestBuckets_Rebalance(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+	b := newTestBuckets(k8s, "replica-b", clock)
+
+	a.Sync(TestLogger(t))
+	b.Sync(TestLogger(t))
+	if got := ownedBuckets(b); got != 0 {
+		t.Errorf("Unexpected buckets taken from a live replica. Want 0. Got %v.", got)
+	}
+
+	// a gives up the buckets beyond its share, which b then takes over.
+	a.Sync(TestLogger(t))
+	b.Sync(TestLogger(t))
+	if gotA, gotB := ownedBuckets(a), ownedBuckets(b); gotA != testBuckets/2 || gotB != testBuckets/2 {
+		t.Errorf("Unexpected buckets owned. Want %v each. Got %v and %v.", testBuckets/2, gotA, gotB)
+	}
+	for _, name := range []string{"rev-1", "rev-2", "rev-3"} {
+		if a.Owns("default", name) == b.Owns("default", name) {
+			t.Errorf("Expected %s to be owned by exactly one replica.", name)
+		}
+	}
+}
+
+func TestBuckets_Failover(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+	b := newTestBuckets(k8s, "replica-b", clock)
+	a.Sync(TestLogger(t))
+	b.Sync(TestLogger(t))
+
+	// a dies without releasing its leases, which b takes over once they
+	// expire.
+	clock.now = clock.now.Add(10 * time.Second)
+	b.Sync(TestLogger(t))
+	if got := ownedBuckets(b); got != 0 {
+		t.Errorf("Unexpected buckets owned before the leases expired. Want 0. Got %v.", got)
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+	b.Sync(TestLogger(t))
+	if got := ownedBuckets(b); got != testBuckets {
+		t.Errorf("Unexpected buckets owned after the leases expired. Want %v. Got %v.", testBuckets, got)
+	}
+}
+
+func TestBuckets_Release(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+	b := newTestBuckets(k8s, "replica-b", clock)
+	a.Sync(TestLogger(t))
+	b.Sync(TestLogger(t))
+
+	a.Release(TestLogger(t))
+	if got := ownedBuckets(a); got != 0 {
+		t.Errorf("Unexpected buckets owned after releasing them. Want 0. Got %v.", got)
+	}
+	b.Sync(TestLogger(t))
+	if got := ownedBuckets(b); got != testBuckets {
+		t.Errorf("Unexpected buckets owned after they were released. Want %v. Got %v.", testBuckets, got)
+	}
+}
+
+func TestBuckets_OnChange(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+	b := newTestBuckets(k8s, "replica-b", clock)
+	changesA, changesB := 0, 0
+	a.OnChange(func() { changesA++ })
+	b.OnChange(func() { changesB++ })
+
+	a.Sync(TestLogger(t))
+	if changesA != 1 {
+		t.Errorf("Unexpected changes after acquiring the buckets. Want 1. Got %v.", changesA)
+	}
+	// Renewing the leases held is no change.
+	a.Sync(TestLogger(t))
+	if changesA != 1 {
+		t.Errorf("Unexpected changes after renewing the buckets. Want 1. Got %v.", changesA)
+	}
+
+	b.Sync(TestLogger(t))
+	if changesB != 0 {
+		t.Errorf("Unexpected changes before acquiring any bucket. Want 0. Got %v.", changesB)
+	}
+	a.Sync(TestLogger(t))
+	b.Sync(TestLogger(t))
+	if changesA != 2 || changesB != 1 {
+		t.Errorf("Unexpected changes after rebalancing. Want 2 and 1. Got %v and %v.", changesA, changesB)
+	}
+
+	b.Release(TestLogger(t))
+	if changesB != 2 {
+		t.Errorf("Unexpected changes after releasing the buckets. Want 2. Got %v.", changesB)
+	}
+}
+
+func TestBuckets_OwnsExpired(t *testing.T) {
+	k8s := fakeK8s.NewSimpleClientset()
+	clock := &testClock{now: time.Now()}
+	a := newTestBuckets(k8s, "replica-a", clock)
+	changes := 0
+	a.OnChange(func() { changes++ })
+	a.Sync(TestLogger(t))
+
+	// The leases expire without a's Sync renewing them.
+	clock.now = clock.now.Add(15 * time.Second)
+	if got := ownedBuckets(a); got != 0 {
+		t.Errorf("Unexpected buckets owned after the leases expired. Want 0. Got %v.", got)
+	}
+	if got := len(a.heldBuckets()); got != 0 {
+		t.Errorf("Unexpected buckets held after the leases expired. Want 0. Got %v.", got)
+	}
+	if changes != 2 {
+		t.Errorf("Unexpected changes after the leases expired. Want 2. Got %v.", changes)
+	}
+}
@@ -0,0 +1,25 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+
+Package leaderelection shards work across the replicas of a component. Each key hashes to one of a fixed number of
+buckets, and the work of a key is owned by the replica holding the lease of its bucket. Leases are kept in ConfigMaps,
+as the vendored Kubernetes API predates Lease objects, and expire unless renewed, so that the buckets of a replica that
+goes away are taken over by the others.
+
+*/
+package leaderelection
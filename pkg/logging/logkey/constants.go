@@ -67,4 +67,7 @@ const (
 
 	// KubernetesService is the key used to represent a Kubernetes service name in logs
 	KubernetesService = "knative.dev/k8sservice"
+
+	// RequestID is the key used to represent the ID of an HTTP request in logs
+	RequestID = "knative.dev/requestid"
 )
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package network holds the HTTP plumbing shared by the binaries serving
+// requests on the data path, the activator and the queue-proxy.
+package network
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Drainer wraps a handler to keep track of the requests in flight, so
+// that a pod keeps serving them through its termination.
+type Drainer struct {
+	handler http.Handler
+	window  time.Duration
+
+	mux      sync.Mutex
+	inFlight int
+	started  time.Time
+	// idle, when set, is closed once no request is in flight anymore.
+	idle chan struct{}
+}
+
+// NewDrainer creates a Drainer serving requests with h. Once draining, it
+// keeps serving the requests still routed to the pod for the given window
+// before waiting on those in flight.
+func NewDrainer(h http.Handler, window time.Duration) *Drainer {
+	return &Drainer{
+		handler: h,
+		window:  window,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (d *Drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.Lock()
+	d.inFlight++
+	d.mux.Unlock()
+	defer d.finish()
+	d.handler.ServeHTTP(w, r)
+}
+
+// Draining reports whether Drain was called.
+func (d *Drainer) Draining() bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return !d.started.IsZero()
+}
+
+// Drain starts draining, if it has not yet, and returns once the drain
+// window has passed and no request is in flight, or once timeout has
+// passed since the drain started. It reports whether the requests in
+// flight finished.
+func (d *Drainer) Drain(timeout time.Duration) bool {
+	d.mux.Lock()
+	if d.started.IsZero() {
+		d.started = time.Now()
+	}
+	windowEnd, deadline := d.started.Add(d.window), d.started.Add(timeout)
+	d.mux.Unlock()
+
+	time.Sleep(time.Until(windowEnd))
+	for {
+		d.mux.Lock()
+		if d.inFlight == 0 {
+			d.mux.Unlock()
+			return true
+		}
+		if d.idle == nil {
+			d.idle = make(chan struct{})
+		}
+		idle := d.idle
+		d.mux.Unlock()
+
+		select {
+		case <-idle:
+		case <-time.After(time.Until(deadline)):
+			return false
+		}
+	}
+}
+
+func (d *Drainer) finish() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.inFlight--
+	if d.inFlight == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainer_Window(t *testing.T) {
+	d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 50*time.Millisecond)
+	if d.Draining() {
+		t.Error("Draining() = true, want false before Drain")
+	}
+
+	start := time.Now()
+	if !d.Drain(time.Second) {
+		t.Error("Drain() = false, want true without requests in flight")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Drain() returned after %v, want after the window of %v", elapsed, 50*time.Millisecond)
+	}
+	if !d.Draining() {
+		t.Error("Draining() = false, want true after Drain")
+	}
+
+	// Requests still routed to the pod are served while draining.
+	resp := httptest.NewRecorder()
+	d.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("Code = %d while draining, want %d", resp.Code, http.StatusOK)
+	}
+}
+
+func TestDrainer_WaitsForRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool
+		want    bool
+	}{{
+		name:    "request finishes",
+		timeout: time.Second,
+		release: true,
+		want:    true,
+	}, {
+		name:    "request outlives the timeout",
+		timeout: 50 * time.Millisecond,
+		want:    false,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+			}), 0)
+			done := make(chan struct{})
+			go func() {
+				d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+				close(done)
+			}()
+			<-started
+			defer func() {
+				close(release)
+				<-done
+			}()
+
+			if test.release {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					release <- struct{}{}
+				}()
+			}
+			if got := d.Drain(test.timeout); got != test.want {
+				t.Errorf("Drain() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDrainer_WaitsForRequestsFromTheWindow(t *testing.T) {
+	release := make(chan struct{})
+	d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}), 50*time.Millisecond)
+
+	// A request still routed to the pod arrives once draining started.
+	drained := make(chan bool)
+	go func() { drained <- d.Drain(time.Second) }()
+	for !d.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("Drain() returned with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if !<-drained {
+		t.Error("Drain() = false, want true once the request finished")
+	}
+}
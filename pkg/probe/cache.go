@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache probes a target at most once per TTL, answering with the result
+// of the last attempt in between, so that frequent health checks do not
+// load the target with probes.
+type Cache struct {
+	prober Prober
+	target Target
+	ttl    time.Duration
+	now    func() time.Time
+
+	mux     sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// NewCache creates a Cache of the probes of the target.
+func NewCache(target Target, ttl time.Duration) *Cache {
+	return &Cache{
+		prober: New(target.Probe),
+		target: target,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Check returns the result of the last attempt if it is more recent than
+// the TTL, and of a new attempt otherwise. Concurrent calls wait on the
+// same attempt.
+func (c *Cache) Check(ctx context.Context) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.checked.IsZero() && c.now().Sub(c.checked) < c.ttl {
+		return c.err
+	}
+	c.err = c.prober.Probe(ctx, c.target)
+	c.checked = c.now()
+	return c.err
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var probes int32
+	status := int32(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	target := serverTarget(t, server)
+	target.Probe = httpGetProbe("/")
+	c := NewCache(target, time.Second)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+	// The target fails, but the result of the last probe is still fresh.
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	now = now.Add(500 * time.Millisecond)
+	if err := c.Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v, want the cached nil", err)
+	}
+	if got := atomic.LoadInt32(&probes); got != 1 {
+		t.Errorf("Probes = %d, want 1 within the TTL", got)
+	}
+	now = now.Add(time.Second)
+	if err := c.Check(context.Background()); err == nil {
+		t.Error("Check() = nil, want the error of a new probe after the TTL")
+	}
+	if got := atomic.LoadInt32(&probes); got != 2 {
+		t.Errorf("Probes = %d, want 2 after the TTL", got)
+	}
+}
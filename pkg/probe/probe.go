@@ -0,0 +1,267 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package probe runs the readiness probes of Revisions against their
+// containers, as the kubelet does, for the components which wait on them.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knative/serving/pkg/h2c"
+	"golang.org/x/net/http2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultUserAgent is sent with HTTP probes whose Target does not set
+	// a User-Agent header. The queue-proxy does not count requests from
+	// "kube-probe/" user agents towards concurrency.
+	DefaultUserAgent = "kube-probe/knative"
+
+	// DefaultTimeout is used when a probe does not set TimeoutSeconds.
+	DefaultTimeout = 1 * time.Second
+
+	// maxBodyBytes is how much of an HTTP probe response is matched
+	// against Target.ExpectedBody, the same limit as the kubelet.
+	maxBodyBytes = 10 * 1024
+)
+
+// Target is an address together with the probe to run against it.
+type Target struct {
+	Host string
+	Port int32
+
+	// Probe describes how to probe the target. Without an HTTPGet
+	// handler the target is probed by opening a TCP connection.
+	Probe *corev1.Probe
+
+	// ConnectTimeout bounds opening the connection and ResponseTimeout
+	// bounds waiting for the response headers once connected. When zero,
+	// each falls back to the timeout of Probe.
+	ConnectTimeout  time.Duration
+	ResponseTimeout time.Duration
+
+	// ExpectedBody, if set, must match the body of an HTTP probe response
+	// for the target to be considered ready.
+	ExpectedBody *regexp.Regexp
+
+	// H2C probes HTTP targets with HTTP/2 over cleartext, for targets
+	// that do not speak HTTP/1.
+	H2C bool
+
+	// TLS, if set, probes the target over TLS with this configuration.
+	// HTTP targets are then probed with HTTP/2 if they negotiate it,
+	// regardless of H2C.
+	TLS *tls.Config
+
+	// Header holds the headers sent with HTTP probes ahead of those of
+	// Probe, such as the User-Agent overriding DefaultUserAgent.
+	Header http.Header
+}
+
+// Address returns the host and port of the target.
+func (t Target) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// Timeouts returns the connect and response timeouts of the target.
+func (t Target) Timeouts() (connect, response time.Duration) {
+	connect, response = t.ConnectTimeout, t.ResponseTimeout
+	if connect <= 0 {
+		connect = Timeout(t.Probe)
+	}
+	if response <= 0 {
+		response = Timeout(t.Probe)
+	}
+	return connect, response
+}
+
+// Timeout returns the timeout of a single attempt of the probe.
+func Timeout(probe *corev1.Probe) time.Duration {
+	if probe != nil && probe.TimeoutSeconds > 0 {
+		return time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// Prober performs a single probe attempt against a target.
+type Prober interface {
+	// Probe returns nil if the target is ready, or an error describing
+	// why it is not.
+	Probe(ctx context.Context, target Target) error
+}
+
+var (
+	_ Prober = (*HTTPGetProber)(nil)
+	_ Prober = (*TCPSocketProber)(nil)
+)
+
+// New returns the Prober implementation for the given probe.
+func New(probe *corev1.Probe) Prober {
+	// TODO: Probe with the gRPC health protocol when probe.GRPC is set.
+	// The vendored Kubernetes API (1.10) predates GRPCAction, and no gRPC
+	// client is vendored, so gRPC probes need a dependency update first.
+	if probe != nil && probe.HTTPGet != nil {
+		return &HTTPGetProber{}
+	}
+	return &TCPSocketProber{}
+}
+
+// HTTPGetProber probes a target with an HTTP GET request. Like the
+// kubelet, any status code in [200, 400) is considered a success.
+type HTTPGetProber struct{}
+
+// Probe implements Prober.
+func (p *HTTPGetProber) Probe(ctx context.Context, target Target) error {
+	action := &corev1.HTTPGetAction{}
+	if target.Probe != nil && target.Probe.HTTPGet != nil {
+		action = target.Probe.HTTPGet
+	}
+	scheme := strings.ToLower(string(action.Scheme))
+	if scheme == "" {
+		scheme = "http"
+	}
+	if target.TLS != nil {
+		scheme = "https"
+	}
+	path := action.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   target.Address(),
+		Path:   path,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+	for name, values := range target.Header {
+		req.Header[name] = values
+	}
+	for _, h := range action.HTTPHeaders {
+		req.Header.Add(h.Name, h.Value)
+	}
+
+	connectTimeout, responseTimeout := target.Timeouts()
+	// Like the kubelet, every probe uses a fresh connection, so there is
+	// nothing to gain from sharing the transport between probes.
+	transport := &http.Transport{
+		DialContext:           dialer(connectTimeout),
+		DisableKeepAlives:     true,
+		ResponseHeaderTimeout: responseTimeout,
+		TLSClientConfig:       target.TLS,
+	}
+	client := &http.Client{Transport: transport}
+	switch {
+	case target.TLS != nil:
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return err
+		}
+	case target.H2C:
+		client.Transport = h2c.NewTransportWithDialer(dialer(connectTimeout), responseTimeout)
+		if c, ok := client.Transport.(interface{ CloseIdleConnections() }); ok {
+			defer c.CloseIdleConnections()
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout+responseTimeout)
+	defer cancel()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("HTTP probe of %s returned status %d", u, resp.StatusCode)
+	}
+	if target.ExpectedBody != nil && !target.ExpectedBody.Match(body) {
+		return fmt.Errorf("HTTP probe of %s returned a body not matching %q", u, target.ExpectedBody)
+	}
+	return nil
+}
+
+// TCPSocketProber probes a target by opening a TCP connection to it.
+type TCPSocketProber struct{}
+
+// Probe implements Prober.
+func (p *TCPSocketProber) Probe(ctx context.Context, target Target) error {
+	connectTimeout, _ := target.Timeouts()
+	conn, err := dialer(connectTimeout)(ctx, "tcp", target.Address())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if target.TLS == nil {
+		return nil
+	}
+	// A TLS target is only ready once it completes the handshake with a
+	// certificate we trust.
+	if connectTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(connectTimeout))
+	}
+	return tls.Client(conn, target.TLS).Handshake()
+}
+
+// dialNetwork narrows "tcp" to the address family of host when it is an
+// IP literal, so that a dual-stack resolver is never consulted for the
+// other family. Hostnames are left to the resolver.
+func dialNetwork(network, host string) string {
+	if network != "tcp" {
+		return network
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return network
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
+
+// dialer returns a DialContext function that gives up connecting after
+// timeout and dials addr using the network matching its address family.
+func dialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, dialNetwork(network, host), addr)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestHTTPGetProber(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		wantErr   bool
+		wantAgent string
+	}{{
+		name:      "ok",
+		status:    http.StatusOK,
+		wantAgent: DefaultUserAgent,
+	}, {
+		name:      "user agent of the target",
+		status:    http.StatusOK,
+		header:    http.Header{"User-Agent": {"kube-probe/test"}},
+		wantAgent: "kube-probe/test",
+	}, {
+		name:      "server error",
+		status:    http.StatusServiceUnavailable,
+		wantErr:   true,
+		wantAgent: DefaultUserAgent,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotPath, gotAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAgent = r.Header.Get("User-Agent")
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			target := serverTarget(t, server)
+			target.Probe = httpGetProbe("healthz")
+			target.Header = test.header
+			err := (&HTTPGetProber{}).Probe(context.Background(), target)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Probe() = %v, wantErr %v", err, test.wantErr)
+			}
+			if gotPath != "/healthz" {
+				t.Errorf("Probed path = %q, want %q", gotPath, "/healthz")
+			}
+			if gotAgent != test.wantAgent {
+				t.Errorf("Probe User-Agent = %q, want %q", gotAgent, test.wantAgent)
+			}
+		})
+	}
+}
+
+func TestTCPSocketProber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %v", err)
+	}
+	target := Target{Host: "127.0.0.1", Port: int32(l.Addr().(*net.TCPAddr).Port)}
+
+	if err := (&TCPSocketProber{}).Probe(context.Background(), target); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+
+	l.Close()
+	if err := (&TCPSocketProber{}).Probe(context.Background(), target); err == nil {
+		t.Error("Probe() = nil, want error after listener closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, ok := New(nil).(*TCPSocketProber); !ok {
+		t.Error("New(nil) is not a TCPSocketProber")
+	}
+	if _, ok := New(httpGetProbe("/")).(*HTTPGetProber); !ok {
+		t.Error("New(httpGet) is not an HTTPGetProber")
+	}
+}
+
+func TestTargetTimeouts(t *testing.T) {
+	probe := httpGetProbe("/")
+	probe.TimeoutSeconds = 3
+	tests := []struct {
+		name         string
+		target       Target
+		wantConnect  time.Duration
+		wantResponse time.Duration
+	}{{
+		name:         "defaults",
+		target:       Target{},
+		wantConnect:  DefaultTimeout,
+		wantResponse: DefaultTimeout,
+	}, {
+		name:         "probe timeout",
+		target:       Target{Probe: probe},
+		wantConnect:  3 * time.Second,
+		wantResponse: 3 * time.Second,
+	}, {
+		name: "separate timeouts",
+		target: Target{
+			Probe:           probe,
+			ConnectTimeout:  100 * time.Millisecond,
+			ResponseTimeout: 10 * time.Second,
+		},
+		wantConnect:  100 * time.Millisecond,
+		wantResponse: 10 * time.Second,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connect, response := test.target.Timeouts()
+			if connect != test.wantConnect || response != test.wantResponse {
+				t.Errorf("Timeouts() = %v, %v, want %v, %v", connect, response, test.wantConnect, test.wantResponse)
+			}
+		})
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		host    string
+		want    string
+	}{{
+		network: "tcp",
+		host:    "rev.ns.svc.cluster.local",
+		want:    "tcp",
+	}, {
+		network: "tcp",
+		host:    "10.0.0.1",
+		want:    "tcp4",
+	}, {
+		network: "tcp",
+		host:    "fd00::1",
+		want:    "tcp6",
+	}, {
+		network: "tcp",
+		host:    "::ffff:10.0.0.1",
+		want:    "tcp4",
+	}, {
+		network: "unix",
+		host:    "10.0.0.1",
+		want:    "unix",
+	}}
+	for _, test := range tests {
+		if got := dialNetwork(test.network, test.host); got != test.want {
+			t.Errorf("dialNetwork(%q, %q) = %q, want %q", test.network, test.host, got, test.want)
+		}
+	}
+}
+
+func serverTarget(t *testing.T, server *httptest.Server) Target {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatalf("Failed to split host and port: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Failed to parse port: %v", err)
+	}
+	return Target{Host: host, Port: int32(port)}
+}
+
+func httpGetProbe(path string) *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: path},
+		},
+	}
+}
@@ -68,3 +68,9 @@ func (b *Breaker) Maybe(thunk func()) bool {
 		return true
 	}
 }
+
+// QueueDepth returns the number of function executions waiting for
+// capacity under the concurrency limit.
+func (b *Breaker) QueueDepth() int {
+	return len(b.pendingRequests)
+}
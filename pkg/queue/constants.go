@@ -33,6 +33,18 @@ const (
 	// health check and lifecyle hooks for queue-proxy.
 	RequestQueueAdminPort = 8022
 
+	// RequestQueueMetricsPortName specifies the port name for the
+	// Prometheus metrics of queue-proxy.
+	RequestQueueMetricsPortName string = "queue-metrics"
+
+	// RequestQueueMetricsPort specifies the port number for the
+	// Prometheus metrics of queue-proxy.
+	RequestQueueMetricsPort = 9090
+
+	// RequestQueueMetricsPath specifies the path the Prometheus metrics
+	// of queue-proxy are served at.
+	RequestQueueMetricsPath = "metrics"
+
 	// RequestQueueQuitPath specifies the path to send quit request to
 	// queue-proxy. This is used for preStop hook of queue-proxy. It:
 	// - marks the service as not ready, so that requests will no longer
@@ -44,4 +56,9 @@ const (
 	// RequestQueueHealthPath specifies the path for health checks for
 	// queue-proxy.
 	RequestQueueHealthPath = "health"
+
+	// RequestQueueStatsPath specifies the path the latest autoscaler
+	// stat of the queue-proxy is served at, for the autoscaler to pull
+	// when pushing stats fails.
+	RequestQueueStatsPath = "stats"
 )
@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+// Handler serves the requests the queue-proxy receives on its port by
+// forwarding them to the user container, gated through its Breaker, and
+// reporting them on its ReqChan for the concurrency metrics.
+type Handler struct {
+	// Proxy returns the handler forwarding the request to the user
+	// container.
+	Proxy func(*http.Request) http.Handler
+	// Breaker limits the requests in flight to the user container, and
+	// queues those in excess of it, or is nil for no limit.
+	Breaker *Breaker
+	// ReqChan receives a ReqIn and a ReqOut event for every request
+	// but probes.
+	ReqChan chan<- ReqEvent
+	// RequestLogger logs every request but probes, or is nil for none.
+	RequestLogger *RequestLogger
+	// StatsReporter records the metrics of every request but probes, or
+	// is nil for none.
+	StatsReporter StatsReporter
+
+	// concurrency is the number of requests in flight to the user
+	// container.
+	concurrency int32
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	proxy := h.Proxy(r)
+
+	if IsKubeProbe(r) {
+		// Do not count health checks for concurrency metrics
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	// Metrics for autoscaling
+	h.ReqChan <- ReqIn
+	defer func() {
+		h.ReqChan <- ReqOut
+	}()
+
+	start := time.Now()
+	var sw *statusWriter
+	if h.RequestLogger != nil || h.StatsReporter != nil {
+		sw = &statusWriter{ResponseWriter: w}
+		w = sw
+	}
+	var admitted time.Time
+	var concurrency int32
+	serve := func() {
+		admitted = time.Now()
+		concurrency = atomic.AddInt32(&h.concurrency, 1)
+		defer atomic.AddInt32(&h.concurrency, -1)
+		proxy.ServeHTTP(w, r)
+	}
+
+	if h.Breaker == nil {
+		serve()
+	} else if ok := h.Breaker.Maybe(serve); !ok {
+		http.Error(w, "overload", http.StatusServiceUnavailable)
+	}
+
+	if sw != nil {
+		end := time.Now()
+		e := RequestLogEntry{
+			Time:        start,
+			RemoteAddr:  r.RemoteAddr,
+			Method:      r.Method,
+			URI:         r.RequestURI,
+			Proto:       r.Proto,
+			Host:        r.Host,
+			Referer:     r.Referer(),
+			UserAgent:   r.UserAgent(),
+			Status:      sw.status(),
+			Bytes:       sw.bytes,
+			Latency:     end.Sub(start),
+			QueueWait:   end.Sub(start),
+			Concurrency: concurrency,
+		}
+		if !admitted.IsZero() {
+			e.QueueWait, e.AppTime = admitted.Sub(start), end.Sub(admitted)
+		}
+		// There is nowhere but the log itself to report its errors to,
+		// and the reporter only fails on invalid tags.
+		if h.RequestLogger != nil {
+			h.RequestLogger.Log(e)
+		}
+		if h.StatsReporter != nil {
+			h.StatsReporter.ReportRequest(e.Status, e.Latency, e.AppTime)
+		}
+	}
+}
+
+// Concurrency returns the number of requests in flight to the user
+// container.
+func (h *Handler) Concurrency() int32 {
+	return atomic.LoadInt32(&h.concurrency)
+}
+
+// QueueDepth returns the number of requests waiting for the Breaker to
+// admit them.
+func (h *Handler) QueueDepth() int {
+	if h.Breaker == nil {
+		return 0
+	}
+	return h.Breaker.QueueDepth()
+}
+
+// ProxyFor returns the Proxy of a Handler forwarding requests to a user
+// container serving protocol, with h2c or HTTP/1.1 as it names. gRPC then
+// works for requests received over HTTP/1.1 too. Requests to containers
+// naming no protocol are forwarded in the protocol they were received in.
+func ProxyFor(protocol v1alpha1.RevisionProtocolType, http1, h2c http.Handler) func(*http.Request) http.Handler {
+	return func(r *http.Request) http.Handler {
+		switch protocol {
+		case v1alpha1.RevisionProtocolH2C:
+			return h2c
+		case v1alpha1.RevisionProtocolHTTP1:
+			return http1
+		}
+		if r.ProtoMajor == 2 {
+			return h2c
+		}
+		return http1
+	}
+}
+
+// IsKubeProbe returns whether the request is a probe of the kubelet.
+func IsKubeProbe(r *http.Request) bool {
+	// Since K8s 1.8, prober requests have
+	//   User-Agent = "kube-probe/{major-version}.{minor-version}".
+	return strings.HasPrefix(r.Header.Get("User-Agent"), "kube-probe/")
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
+)
+
+func TestHandler_Forwards(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		breaker   *Breaker
+		want      []ReqEvent
+	}{{
+		name: "request",
+		want: []ReqEvent{ReqIn, ReqOut},
+	}, {
+		name:    "request through breaker",
+		breaker: NewBreaker(1, 1),
+		want:    []ReqEvent{ReqIn, ReqOut},
+	}, {
+		name:      "probe",
+		userAgent: "kube-probe/1.10",
+		breaker:   NewBreaker(1, 1),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reqChan := make(chan ReqEvent, 2)
+			h := &Handler{
+				Proxy: func(*http.Request) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusAccepted)
+					})
+				},
+				Breaker: test.breaker,
+				ReqChan: reqChan,
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("User-Agent", test.userAgent)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusAccepted {
+				t.Errorf("Code = %d, want %d", rec.Code, http.StatusAccepted)
+			}
+			close(reqChan)
+			var got []ReqEvent
+			for e := range reqChan {
+				got = append(got, e)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Events = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandler_Overload(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	b := NewBreaker(1, 1)
+	h := &Handler{
+		Proxy: func(*http.Request) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				entered <- struct{}{}
+				<-release
+			})
+		},
+		Breaker: b,
+		ReqChan: make(chan ReqEvent, 6),
+	}
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	codes := make(chan int, 2)
+	go func() { codes <- serve() }()
+	<-entered
+	go func() { codes <- serve() }()
+	// Wait for the second request to be queued.
+	for len(b.pendingRequests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := serve(); got != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want %d beyond the queue", got, http.StatusServiceUnavailable)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if got := <-codes; got != http.StatusOK {
+			t.Errorf("Code = %d, want %d within the queue", got, http.StatusOK)
+		}
+	}
+}
+
+func TestProxyFor(t *testing.T) {
+	http1 := http.RedirectHandler("/http1", http.StatusFound)
+	h2c := http.RedirectHandler("/h2c", http.StatusFound)
+	tests := []struct {
+		name       string
+		protocol   v1alpha1.RevisionProtocolType
+		protoMajor int
+		want       http.Handler
+	}{{
+		name:       "http1 request",
+		protoMajor: 1,
+		want:       http1,
+	}, {
+		name:       "http2 request",
+		protoMajor: 2,
+		want:       h2c,
+	}, {
+		name:       "http1 request to http1",
+		protocol:   v1alpha1.RevisionProtocolHTTP1,
+		protoMajor: 1,
+		want:       http1,
+	}, {
+		name:       "http2 request to http1",
+		protocol:   v1alpha1.RevisionProtocolHTTP1,
+		protoMajor: 2,
+		want:       http1,
+	}, {
+		name:       "http1 request to h2c",
+		protocol:   v1alpha1.RevisionProtocolH2C,
+		protoMajor: 1,
+		want:       h2c,
+	}, {
+		name:       "http2 request to h2c",
+		protocol:   v1alpha1.RevisionProtocolH2C,
+		protoMajor: 2,
+		want:       h2c,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.ProtoMajor = test.protoMajor
+			if got := ProxyFor(test.protocol, http1, h2c)(r); got != test.want {
+				t.Errorf("ProxyFor() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandler_Trailers(t *testing.T) {
+	l, err := NewRequestLogger("{{.Status}}", &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewRequestLogger() = %v", err)
+	}
+	h := &Handler{
+		Proxy: func(*http.Request) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("hello"))
+				w.Header().Set("Grpc-Status", "0")
+			})
+		},
+		ReqChan:       make(chan ReqEvent, 2),
+		RequestLogger: l,
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if got := w.Result().Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Trailer Grpc-Status = %q, want %q", got, "0")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// RequestLogEntry describes a request served by the queue-proxy. It is the
+// data the request log template is executed on.
+type RequestLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	URI        string
+	Proto      string
+	Host       string
+	Referer    string
+	UserAgent  string
+	Status     int
+	Bytes      int64
+
+	// Latency is how long the queue-proxy took to answer the request,
+	// QueueWait how much of it the request waited to be admitted by the
+	// Breaker, and AppTime how much the user container took to answer.
+	// Requests the Breaker rejects have no AppTime.
+	Latency   time.Duration
+	QueueWait time.Duration
+	AppTime   time.Duration
+
+	// Concurrency is the number of requests in flight to the user
+	// container when the request was admitted, itself included.
+	Concurrency int32
+}
+
+// RequestLogger writes a line per request, from its template.
+type RequestLogger struct {
+	mux  sync.Mutex
+	out  io.Writer
+	tmpl *template.Template
+}
+
+// NewRequestLogger creates a RequestLogger writing to out the lines the
+// given text/template produces from RequestLogEntry values.
+func NewRequestLogger(tmpl string, out io.Writer) (*RequestLogger, error) {
+	t, err := template.New("request-log").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request log template: %v", err)
+	}
+	return &RequestLogger{
+		out:  out,
+		tmpl: t,
+	}, nil
+}
+
+// Log writes the line of e, adding the newline the template does not end
+// with.
+func (l *RequestLogger) Log(e RequestLogEntry) error {
+	var b bytes.Buffer
+	if err := l.tmpl.Execute(&b, e); err != nil {
+		return err
+	}
+	if b.Len() == 0 || b.Bytes()[b.Len()-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	_, err := l.out.Write(b.Bytes())
+	return err
+}
+
+// statusWriter records the status code and the number of body bytes
+// written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, so that streamed responses are not held
+// back.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, so that upgraded connections such as
+// websockets are still proxied.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not an http.Hijacker", w.ResponseWriter)
+	}
+	if w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
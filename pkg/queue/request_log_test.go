@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{{
+		name: "fields",
+		tmpl: "{{.Method}} {{.URI}} {{.Status}} {{.Latency}} {{.QueueWait}} {{.AppTime}} {{.Concurrency}}",
+		want: "GET /foo 200 3s 1s 2s 4\n",
+	}, {
+		name: "newline of the template",
+		tmpl: "{{.Status}}\n",
+		want: "200\n",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			l, err := NewRequestLogger(test.tmpl, &b)
+			if err != nil {
+				t.Fatalf("NewRequestLogger() = %v", err)
+			}
+			err = l.Log(RequestLogEntry{
+				Method:      http.MethodGet,
+				URI:         "/foo",
+				Status:      http.StatusOK,
+				Latency:     3 * time.Second,
+				QueueWait:   time.Second,
+				AppTime:     2 * time.Second,
+				Concurrency: 4,
+			})
+			if err != nil {
+				t.Errorf("Log() = %v", err)
+			}
+			if got := b.String(); got != test.want {
+				t.Errorf("Log() wrote %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewRequestLogger_Invalid(t *testing.T) {
+	if _, err := NewRequestLogger("{{.Status", &bytes.Buffer{}); err == nil {
+		t.Error("NewRequestLogger() = nil, want error for an unclosed action")
+	}
+}
+
+func TestHandler_RequestLog(t *testing.T) {
+	var b bytes.Buffer
+	l, err := NewRequestLogger("{{.Method}} {{.Status}} {{.Bytes}} {{.Concurrency}}", &b)
+	if err != nil {
+		t.Fatalf("NewRequestLogger() = %v", err)
+	}
+	h := &Handler{
+		Proxy: func(*http.Request) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+			})
+		},
+		Breaker:       NewBreaker(1, 1),
+		ReqChan:       make(chan ReqEvent, 4),
+		RequestLogger: l,
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	probe := httptest.NewRequest(http.MethodGet, "/", nil)
+	probe.Header.Set("User-Agent", "kube-probe/1.10")
+	h.ServeHTTP(httptest.NewRecorder(), probe)
+
+	if got, want := b.String(), "POST 201 5 1\n"; got != want {
+		t.Errorf("Logged %q, want %q without the probe", got, want)
+	}
+}
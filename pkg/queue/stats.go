@@ -27,6 +27,9 @@ type ReqEvent int
 const (
 	ReqIn ReqEvent = iota
 	ReqOut
+	// ReqDequeued records a request done waiting to be handled, such as a
+	// request held by the activator until its revision is active.
+	ReqDequeued
 )
 
 // Channels is a structure for holding the channels for driving Stats.
@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/knative/serving/pkg/autoscaler"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	requestCountM = stats.Int64(
+		"queue_request_count",
+		"Number of requests served by the queue-proxy",
+		stats.UnitNone)
+	requestLatenciesM = stats.Float64(
+		"queue_request_latencies",
+		"Time taken by the queue-proxy to answer requests",
+		stats.UnitMilliseconds)
+	appLatenciesM = stats.Float64(
+		"queue_app_request_latencies",
+		"Time taken by the user container to answer requests",
+		stats.UnitMilliseconds)
+	queueDepthM = stats.Int64(
+		"queue_depth",
+		"Number of requests waiting for the container concurrency to admit them",
+		stats.UnitNone)
+	concurrentRequestsM = stats.Int64(
+		"queue_concurrent_requests",
+		"Number of requests in flight to the user container",
+		stats.UnitNone)
+	averageConcurrentRequestsM = stats.Float64(
+		"queue_average_concurrent_requests",
+		"Average number of requests in flight of the last stat sent to the autoscaler",
+		stats.UnitNone)
+	statRequestCountM = stats.Int64(
+		"queue_stat_request_count",
+		"Number of requests received of the last stat sent to the autoscaler",
+		stats.UnitNone)
+
+	// Latency buckets in milliseconds, from a fast response to the
+	// longest revision timeout.
+	latencyBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 300000}
+
+	namespaceTagKey     tag.Key
+	configTagKey        tag.Key
+	revisionTagKey      tag.Key
+	podTagKey           tag.Key
+	responseClassTagKey tag.Key
+
+	// views are the views of the measures above, registered on init.
+	views []*view.View
+)
+
+func init() {
+	var err error
+	// Create the tag keys that will be used to add tags to our measurements.
+	namespaceTagKey, err = tag.NewKey("destination_namespace")
+	if err != nil {
+		panic(err)
+	}
+	configTagKey, err = tag.NewKey("destination_configuration")
+	if err != nil {
+		panic(err)
+	}
+	revisionTagKey, err = tag.NewKey("destination_revision")
+	if err != nil {
+		panic(err)
+	}
+	podTagKey, err = tag.NewKey("destination_pod")
+	if err != nil {
+		panic(err)
+	}
+	responseClassTagKey, err = tag.NewKey("response_code_class")
+	if err != nil {
+		panic(err)
+	}
+
+	podTagKeys := []tag.Key{namespaceTagKey, configTagKey, revisionTagKey, podTagKey}
+	responseTagKeys := []tag.Key{namespaceTagKey, configTagKey, revisionTagKey, podTagKey, responseClassTagKey}
+	views = []*view.View{
+		&view.View{
+			Description: "Number of requests served by the queue-proxy",
+			Measure:     requestCountM,
+			Aggregation: view.Count(),
+			TagKeys:     responseTagKeys,
+		},
+		&view.View{
+			Description: "Time taken by the queue-proxy to answer requests",
+			Measure:     requestLatenciesM,
+			Aggregation: view.Distribution(latencyBounds...),
+			TagKeys:     responseTagKeys,
+		},
+		&view.View{
+			Description: "Time taken by the user container to answer requests",
+			Measure:     appLatenciesM,
+			Aggregation: view.Distribution(latencyBounds...),
+			TagKeys:     responseTagKeys,
+		},
+		&view.View{
+			Description: "Number of requests waiting for the container concurrency to admit them",
+			Measure:     queueDepthM,
+			Aggregation: view.LastValue(),
+			TagKeys:     podTagKeys,
+		},
+		&view.View{
+			Description: "Number of requests in flight to the user container",
+			Measure:     concurrentRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     podTagKeys,
+		},
+		&view.View{
+			Description: "Average number of requests in flight of the last stat sent to the autoscaler",
+			Measure:     averageConcurrentRequestsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     podTagKeys,
+		},
+		&view.View{
+			Description: "Number of requests received of the last stat sent to the autoscaler",
+			Measure:     statRequestCountM,
+			Aggregation: view.LastValue(),
+			TagKeys:     podTagKeys,
+		},
+	}
+	if err := view.Register(views...); err != nil {
+		panic(err)
+	}
+}
+
+// StatsReporter defines the interface for sending queue-proxy metrics.
+type StatsReporter interface {
+	// ReportRequest records a request answered with responseCode after
+	// latency, of which the user container took appTime. appTime is zero
+	// for requests the user container was not sent.
+	ReportRequest(responseCode int, latency, appTime time.Duration) error
+	// ReportQueueDepth records the number of requests waiting to be
+	// admitted and the number in flight to the user container.
+	ReportQueueDepth(depth int, concurrency int32) error
+	// ReportStat records the stat sent to the autoscaler, so that what
+	// the autoscaler scales on can be seen next to the other metrics.
+	ReportStat(stat *autoscaler.Stat) error
+}
+
+// Reporter reports the metrics of a queue-proxy through OpenCensus.
+type Reporter struct {
+	ctx context.Context
+}
+
+var _ StatsReporter = (*Reporter)(nil)
+
+// NewStatsReporter creates a reporter tagging the metrics it collects
+// with the given pod of a revision.
+func NewStatsReporter(namespace, config, revision, pod string) (*Reporter, error) {
+	// Our tags are static. So, we can get away with creating a single
+	// context and reuse it for reporting all of our metrics.
+	ctx, err := tag.New(
+		context.Background(),
+		tag.Insert(namespaceTagKey, namespace),
+		tag.Insert(configTagKey, config),
+		tag.Insert(revisionTagKey, revision),
+		tag.Insert(podTagKey, pod))
+	if err != nil {
+		return nil, err
+	}
+	return &Reporter{ctx: ctx}, nil
+}
+
+// ReportRequest implements StatsReporter.
+func (r *Reporter) ReportRequest(responseCode int, latency, appTime time.Duration) error {
+	ctx, err := tag.New(r.ctx, tag.Insert(responseClassTagKey, responseCodeClass(responseCode)))
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, requestCountM.M(1), requestLatenciesM.M(milliseconds(latency)))
+	if appTime > 0 {
+		stats.Record(ctx, appLatenciesM.M(milliseconds(appTime)))
+	}
+	return nil
+}
+
+// ReportQueueDepth implements StatsReporter.
+func (r *Reporter) ReportQueueDepth(depth int, concurrency int32) error {
+	stats.Record(r.ctx, queueDepthM.M(int64(depth)), concurrentRequestsM.M(int64(concurrency)))
+	return nil
+}
+
+// ReportStat implements StatsReporter.
+func (r *Reporter) ReportStat(stat *autoscaler.Stat) error {
+	stats.Record(r.ctx,
+		averageConcurrentRequestsM.M(stat.AverageConcurrentRequests),
+		statRequestCountM.M(int64(stat.RequestCount)))
+	return nil
+}
+
+func responseCodeClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
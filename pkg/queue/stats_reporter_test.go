@@ -0,0 +1,261 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/knative/serving/pkg/autoscaler"
+	"go.opencensus.io/stats/view"
+)
+
+func TestReporter_ReportRequest(t *testing.T) {
+	resetViews(t)
+	r, err := NewStatsReporter("testns", "testconfig", "testrev", "testpod")
+	if err != nil {
+		t.Fatalf("NewStatsReporter() = %v", err)
+	}
+	wantTags := map[string]string{
+		"destination_namespace":     "testns",
+		"destination_configuration": "testconfig",
+		"destination_revision":      "testrev",
+		"destination_pod":           "testpod",
+		"response_code_class":       "2xx",
+	}
+
+	expectSuccess(t, func() error {
+		return r.ReportRequest(http.StatusOK, 1500*time.Millisecond, 1000*time.Millisecond)
+	})
+	expectSuccess(t, func() error {
+		return r.ReportRequest(http.StatusCreated, 30*time.Millisecond, 10*time.Millisecond)
+	})
+	checkCount(t, "queue_request_count", wantTags, 2)
+	checkDistribution(t, "queue_request_latencies", wantTags, 2, 30, 1500)
+	checkDistribution(t, "queue_app_request_latencies", wantTags, 2, 10, 1000)
+}
+
+func TestReporter_ReportRequestRejected(t *testing.T) {
+	resetViews(t)
+	r, err := NewStatsReporter("testns", "testconfig", "rejected", "testpod")
+	if err != nil {
+		t.Fatalf("NewStatsReporter() = %v", err)
+	}
+	wantTags := map[string]string{
+		"destination_namespace":     "testns",
+		"destination_configuration": "testconfig",
+		"destination_revision":      "rejected",
+		"destination_pod":           "testpod",
+		"response_code_class":       "5xx",
+	}
+
+	expectSuccess(t, func() error {
+		return r.ReportRequest(http.StatusServiceUnavailable, time.Millisecond, 0)
+	})
+	checkCount(t, "queue_request_count", wantTags, 1)
+	if rows := rowsWithTags(t, "queue_app_request_latencies", wantTags); len(rows) != 0 {
+		t.Errorf("Unexpected queue_app_request_latencies rows for a rejected request: %v", rows)
+	}
+}
+
+func TestReporter_ReportQueueDepth(t *testing.T) {
+	resetViews(t)
+	r, err := NewStatsReporter("testns", "testconfig", "testrev", "testpod")
+	if err != nil {
+		t.Fatalf("NewStatsReporter() = %v", err)
+	}
+	wantTags := map[string]string{
+		"destination_namespace":     "testns",
+		"destination_configuration": "testconfig",
+		"destination_revision":      "testrev",
+		"destination_pod":           "testpod",
+	}
+
+	expectSuccess(t, func() error { return r.ReportQueueDepth(3, 10) })
+	expectSuccess(t, func() error { return r.ReportQueueDepth(1, 4) })
+	checkLastValue(t, "queue_depth", wantTags, 1)
+	checkLastValue(t, "queue_concurrent_requests", wantTags, 4)
+}
+
+func TestReporter_ReportStat(t *testing.T) {
+	resetViews(t)
+	r, err := NewStatsReporter("testns", "testconfig", "testrev", "testpod")
+	if err != nil {
+		t.Fatalf("NewStatsReporter() = %v", err)
+	}
+	wantTags := map[string]string{
+		"destination_namespace":     "testns",
+		"destination_configuration": "testconfig",
+		"destination_revision":      "testrev",
+		"destination_pod":           "testpod",
+	}
+
+	expectSuccess(t, func() error {
+		return r.ReportStat(&autoscaler.Stat{AverageConcurrentRequests: 2.5, RequestCount: 7})
+	})
+	checkLastValue(t, "queue_average_concurrent_requests", wantTags, 2.5)
+	checkLastValue(t, "queue_stat_request_count", wantTags, 7)
+}
+
+func TestResponseCodeClass(t *testing.T) {
+	for code, want := range map[int]string{
+		http.StatusOK:                  "2xx",
+		http.StatusTemporaryRedirect:   "3xx",
+		http.StatusBadRequest:          "4xx",
+		http.StatusGatewayTimeout:      "5xx",
+		http.StatusInternalServerError: "5xx",
+	} {
+		if got := responseCodeClass(code); got != want {
+			t.Errorf("Unexpected class for %v. Want %v. Got %v.", code, want, got)
+		}
+	}
+}
+
+type fakeStatsReporter struct {
+	codes []int
+}
+
+func (r *fakeStatsReporter) ReportRequest(responseCode int, latency, appTime time.Duration) error {
+	r.codes = append(r.codes, responseCode)
+	return nil
+}
+
+func (r *fakeStatsReporter) ReportQueueDepth(depth int, concurrency int32) error {
+	return nil
+}
+
+func (r *fakeStatsReporter) ReportStat(stat *autoscaler.Stat) error {
+	return nil
+}
+
+func TestHandler_ReportsRequests(t *testing.T) {
+	r := &fakeStatsReporter{}
+	h := &Handler{
+		ReqChan:       make(chan ReqEvent, 4),
+		StatsReporter: r,
+	}
+	h.Proxy = func(*http.Request) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := h.Concurrency(); got != 1 && !IsKubeProbe(r) {
+				t.Errorf("Concurrency() = %v while serving, want 1", got)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		})
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	probe := httptest.NewRequest(http.MethodGet, "/", nil)
+	probe.Header.Set("User-Agent", "kube-probe/1.10")
+	h.ServeHTTP(httptest.NewRecorder(), probe)
+
+	if got, want := r.codes, []int{http.StatusAccepted}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Reported %v, want %v without the probe", got, want)
+	}
+	if got := h.Concurrency(); got != 0 {
+		t.Errorf("Concurrency() = %v once served, want 0", got)
+	}
+	if got := h.QueueDepth(); got != 0 {
+		t.Errorf("QueueDepth() = %v without a Breaker, want 0", got)
+	}
+}
+
+// resetViews registers the views again once t is done, dropping the data
+// it recorded so that the counts of the next run start from zero.
+func resetViews(t *testing.T) {
+	t.Cleanup(func() {
+		view.Unregister(views...)
+		if err := view.Register(views...); err != nil {
+			t.Fatalf("Error registering the views again: %v", err)
+		}
+	})
+}
+
+func expectSuccess(t *testing.T, f func() error) {
+	t.Helper()
+	if err := f(); err != nil {
+		t.Errorf("Reporter.Report() expected success but got error %v", err)
+	}
+}
+
+// rowsWithTags returns the rows of the named view with exactly wantTags.
+func rowsWithTags(t *testing.T, name string, wantTags map[string]string) []*view.Row {
+	t.Helper()
+	d, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("Error retrieving %v: %v", name, err)
+	}
+	var rows []*view.Row
+	for _, row := range d {
+		if len(row.Tags) != len(wantTags) {
+			continue
+		}
+		match := true
+		for _, got := range row.Tags {
+			if wantTags[got.Key.Name()] != got.Value {
+				match = false
+			}
+		}
+		if match {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func checkCount(t *testing.T, name string, wantTags map[string]string, want int64) {
+	t.Helper()
+	d := rowsWithTags(t, name, wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of %v rows. Want 1. Got %v.", name, len(d))
+	}
+	if s, ok := d[0].Data.(*view.CountData); !ok {
+		t.Errorf("Unexpected data type. Want CountData. Got %T.", d[0].Data)
+	} else if s.Value != want {
+		t.Errorf("Unexpected %v. Want %v. Got %v.", name, want, s.Value)
+	}
+}
+
+func checkLastValue(t *testing.T, name string, wantTags map[string]string, want float64) {
+	t.Helper()
+	d := rowsWithTags(t, name, wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of %v rows. Want 1. Got %v.", name, len(d))
+	}
+	if s, ok := d[0].Data.(*view.LastValueData); !ok {
+		t.Errorf("Unexpected data type. Want LastValueData. Got %T.", d[0].Data)
+	} else if s.Value != want {
+		t.Errorf("Unexpected %v. Want %v. Got %v.", name, want, s.Value)
+	}
+}
+
+func checkDistribution(t *testing.T, name string, wantTags map[string]string, count int64, min, max float64) {
+	t.Helper()
+	d := rowsWithTags(t, name, wantTags)
+	if len(d) != 1 {
+		t.Fatalf("Unexpected number of %v rows. Want 1. Got %v.", name, len(d))
+	}
+	s, ok := d[0].Data.(*view.DistributionData)
+	if !ok {
+		t.Fatalf("Unexpected data type. Want DistributionData. Got %T.", d[0].Data)
+	}
+	if s.Count != count || s.Min != min || s.Max != max {
+		t.Errorf("Unexpected %v. Want count %v, min %v, max %v. Got count %v, min %v, max %v.",
+			name, count, min, max, s.Count, s.Min, s.Max)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutHandler wraps the handler forwarding requests to the user
+// container, so that requests it takes too long to respond to are answered
+// with a 504 and cancelled upstream.
+type TimeoutHandler struct {
+	handler              http.Handler
+	timeout              time.Duration
+	responseStartTimeout time.Duration
+}
+
+// NewTimeoutHandler creates a TimeoutHandler serving requests with h, which
+// must respond to them within timeout, and start responding within
+// responseStartTimeout. Zero means no limit for either.
+func NewTimeoutHandler(h http.Handler, timeout, responseStartTimeout time.Duration) *TimeoutHandler {
+	return &TimeoutHandler{
+		handler:              h,
+		timeout:              timeout,
+		responseStartTimeout: responseStartTimeout,
+	}
+}
+
+// ServeHTTP implements http.Handler. Requests timing out once the response
+// has started cannot be answered with a 504, and their connection is
+// aborted instead so that the client does not take the response as whole.
+func (h *TimeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.timeout <= 0 && h.responseStartTimeout <= 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	tw := &timeoutWriter{w: w, header: make(http.Header)}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer close(done)
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		h.handler.ServeHTTP(tw, r.WithContext(ctx))
+	}()
+
+	// Receiving from a nil channel blocks, for the timeouts not set.
+	var timeout, responseStart <-chan time.Time
+	if h.timeout > 0 {
+		t := time.NewTimer(h.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	if h.responseStartTimeout > 0 {
+		t := time.NewTimer(h.responseStartTimeout)
+		defer t.Stop()
+		responseStart = t.C
+	}
+	for {
+		select {
+		case <-done:
+			select {
+			case p := <-panicked:
+				panic(p)
+			default:
+			}
+			return
+		case <-timeout:
+			tw.timeOut(fmt.Sprintf("Revision did not respond within its timeout of %v", h.timeout), true)
+			return
+		case <-responseStart:
+			if tw.timeOut(fmt.Sprintf("Revision did not start responding within %v", h.responseStartTimeout), false) {
+				return
+			}
+			responseStart = nil
+		}
+	}
+}
+
+// timeoutWriter forwards the response of a request to its ResponseWriter
+// until the request times out, and drops it after.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	// header is kept apart from the header of w until the response
+	// starts, for the server may read the header of w once the request
+	// timed out while the handler still writes this one.
+	header http.Header
+
+	mux         sync.Mutex
+	wroteHeader bool
+	hijacked    bool
+	timedOut    bool
+}
+
+// timeOut answers the request with a 504 unless the response has started,
+// in which case it aborts the request if abort is set, and otherwise keeps
+// serving it. It reports whether the request timed out.
+func (tw *timeoutWriter) timeOut(msg string, abort bool) bool {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.hijacked {
+		// The connection is no longer an HTTP exchange to time out.
+		return false
+	}
+	if tw.wroteHeader {
+		if !abort {
+			return false
+		}
+		tw.timedOut = true
+		panic(http.ErrAbortHandler)
+	}
+	tw.timedOut = true
+	http.Error(tw.w, msg, http.StatusGatewayTimeout)
+	return true
+}
+
+// Header returns the header of w once the response has started, so that
+// trailers are still forwarded.
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.wroteHeader && !tw.timedOut {
+		return tw.w.Header()
+	}
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// Flush implements http.Flusher, so that streamed responses are not held
+// back.
+func (tw *timeoutWriter) Flush() {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, so that upgraded connections such as
+// websockets are still proxied. They are not timed out once hijacked.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not an http.Hijacker", tw.w)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
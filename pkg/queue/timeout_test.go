@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	tests := []struct {
+		name                 string
+		timeout              time.Duration
+		responseStartTimeout time.Duration
+		// respond is how long the handler takes to write its header, and
+		// finish how much longer it takes to write its body.
+		respond, finish time.Duration
+		wantStatus      int
+		wantBody        string
+	}{{
+		name:       "no timeouts",
+		respond:    10 * time.Millisecond,
+		wantStatus: http.StatusOK,
+		wantBody:   "hello",
+	}, {
+		name:       "within the timeout",
+		timeout:    time.Second,
+		wantStatus: http.StatusOK,
+		wantBody:   "hello",
+	}, {
+		name:       "timeout",
+		timeout:    10 * time.Millisecond,
+		respond:    time.Second,
+		wantStatus: http.StatusGatewayTimeout,
+		wantBody:   "Revision did not respond within its timeout of 10ms\n",
+	}, {
+		name:                 "response start timeout",
+		responseStartTimeout: 10 * time.Millisecond,
+		respond:              time.Second,
+		wantStatus:           http.StatusGatewayTimeout,
+		wantBody:             "Revision did not start responding within 10ms\n",
+	}, {
+		name:                 "response started",
+		responseStartTimeout: 10 * time.Millisecond,
+		finish:               50 * time.Millisecond,
+		wantStatus:           http.StatusOK,
+		wantBody:             "hello",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cancelled := make(chan struct{})
+			h := NewTimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(cancelled)
+				select {
+				case <-time.After(test.respond):
+				case <-r.Context().Done():
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("X-Test", "timeouts")
+				w.WriteHeader(http.StatusOK)
+				time.Sleep(test.finish)
+				w.Write([]byte("hello"))
+			}), test.timeout, test.responseStartTimeout)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := w.Code; got != test.wantStatus {
+				t.Errorf("Status = %v, want %v", got, test.wantStatus)
+			}
+			if got := w.Body.String(); got != test.wantBody {
+				t.Errorf("Body = %q, want %q", got, test.wantBody)
+			}
+			if test.wantStatus == http.StatusOK && w.Header().Get("X-Test") != "timeouts" {
+				t.Errorf("Header = %v, want the header of the handler", w.Header())
+			}
+			select {
+			case <-cancelled:
+			case <-time.After(time.Second):
+				t.Error("The request of the handler was not cancelled")
+			}
+		})
+	}
+}
+
+func TestTimeoutHandler_AbortsStartedResponse(t *testing.T) {
+	h := NewTimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		<-r.Context().Done()
+	}), 10*time.Millisecond, 0)
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("ServeHTTP() panicked with %v, want %v", p, http.ErrAbortHandler)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeoutHandler_Trailers(t *testing.T) {
+	h := NewTimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello"))
+		w.Header().Set("Grpc-Status", "0")
+	}), time.Second, 0)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Result().Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Trailer Grpc-Status = %q, want %q", got, "0")
+	}
+}
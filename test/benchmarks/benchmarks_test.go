@@ -0,0 +1,241 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmarks
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/knative/serving/pkg/activator"
+	"github.com/knative/serving/pkg/queue"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const thresholdsFile = "thresholds.yaml"
+
+var checkThresholds = flag.Bool("check-thresholds", false,
+	"Run every benchmark and fail if it is slower than allowed by "+thresholdsFile+".")
+
+// benchmarks lists the benchmarks covered by thresholdsFile.
+var benchmarks = []struct {
+	name string
+	fn   func(*testing.B)
+}{
+	{"BenchmarkTCPProbe", BenchmarkTCPProbe},
+	{"BenchmarkProbeLoop", BenchmarkProbeLoop},
+	{"BenchmarkBreaker", BenchmarkBreaker},
+	{"BenchmarkDedupingActivator", BenchmarkDedupingActivator},
+	{"BenchmarkProxyThroughput", BenchmarkProxyThroughput},
+}
+
+// BenchmarkTCPProbe measures a single TCP probe attempt.
+func BenchmarkTCPProbe(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	target := serverTarget(b, server)
+
+	prober := &activator.TCPSocketProber{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := prober.Probe(context.Background(), target); err != nil {
+			b.Fatalf("Probe() = %v", err)
+		}
+	}
+}
+
+// BenchmarkProbeLoop measures probing a ready revision over HTTP until it
+// is considered ready, including the bookkeeping of the probe tracker.
+func BenchmarkProbeLoop(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	target := serverTarget(b, server)
+	target.Probe = &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/"},
+		},
+	}
+
+	tracker := activator.NewProbeTracker(10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tracker.CheckProbe(context.Background(), target); err != nil {
+			b.Fatalf("CheckProbe() = %v", err)
+		}
+	}
+}
+
+// BenchmarkBreaker measures queueing requests in the queue-proxy's
+// breaker under contention.
+func BenchmarkBreaker(b *testing.B) {
+	breaker := queue.NewBreaker(10000, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			breaker.Maybe(func() {})
+		}
+	})
+}
+
+// BenchmarkDedupingActivator measures many requests waiting on the
+// activation of the same revision.
+func BenchmarkDedupingActivator(b *testing.B) {
+	a := activator.NewDedupingActivator(&readyActivator{})
+	defer a.Shutdown()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := a.ActiveEndpoint(context.Background(), "default", "rev"); err != nil {
+				b.Fatalf("ActiveEndpoint() = %v", err)
+			}
+		}
+	})
+}
+
+// BenchmarkProxyThroughput measures requests proxied to an active
+// revision end to end, the way the activator and queue-proxy do.
+func BenchmarkProxyThroughput(b *testing.B) {
+	body := bytes.Repeat([]byte("a"), 1024)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		b.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	proxy := httptest.NewServer(httputil.NewSingleHostReverseProxy(u))
+	defer proxy.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := client.Get(proxy.URL)
+			if err != nil {
+				b.Fatalf("Get() = %v", err)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+}
+
+func TestThresholdsCoverBenchmarks(t *testing.T) {
+	thresholds, err := LoadThresholds(thresholdsFile)
+	if err != nil {
+		t.Fatalf("LoadThresholds() = %v", err)
+	}
+	for _, bm := range benchmarks {
+		if _, ok := thresholds[bm.name]; !ok {
+			t.Errorf("%s has no threshold in %s", bm.name, thresholdsFile)
+		}
+	}
+	if len(thresholds) != len(benchmarks) {
+		t.Errorf("%s has %d thresholds, want %d", thresholdsFile, len(thresholds), len(benchmarks))
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	if !*checkThresholds {
+		t.Skip("Run with -check-thresholds to compare benchmarks against " + thresholdsFile)
+	}
+	thresholds, err := LoadThresholds(thresholdsFile)
+	if err != nil {
+		t.Fatalf("LoadThresholds() = %v", err)
+	}
+	for _, bm := range benchmarks {
+		result := testing.Benchmark(bm.fn)
+		t.Logf("%s\t%s\t%s", bm.name, result, result.MemString())
+		for _, regression := range thresholds[bm.name].Check(result.NsPerOp(), result.AllocsPerOp()) {
+			t.Errorf("%s regressed: %s", bm.name, regression)
+		}
+	}
+}
+
+func TestThresholdCheck(t *testing.T) {
+	threshold := Threshold{MaxNsPerOp: 1000, MaxAllocsPerOp: 10}
+	tests := []struct {
+		name        string
+		nsPerOp     int64
+		allocsPerOp int64
+		want        int
+	}{{
+		name:        "within",
+		nsPerOp:     1000,
+		allocsPerOp: 10,
+	}, {
+		name:        "slower",
+		nsPerOp:     1001,
+		allocsPerOp: 10,
+		want:        1,
+	}, {
+		name:        "slower and allocating more",
+		nsPerOp:     2000,
+		allocsPerOp: 20,
+		want:        2,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := threshold.Check(test.nsPerOp, test.allocsPerOp); len(got) != test.want {
+				t.Errorf("Check() = %v, want %d regressions", got, test.want)
+			}
+		})
+	}
+}
+
+// readyActivator is an Activator whose revisions are always ready.
+type readyActivator struct{}
+
+func (a *readyActivator) ActiveEndpoint(ctx context.Context, namespace, name string) (activator.Endpoint, activator.Status, error) {
+	return activator.Endpoint{FQDN: name + "." + namespace + ".svc.cluster.local", Port: 80}, 0, nil
+}
+
+func (a *readyActivator) Shutdown() {}
+
+func serverTarget(b *testing.B, server *httptest.Server) activator.ProbeTarget {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatalf("Failed to parse server URL: %v", err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		b.Fatalf("Failed to split host and port: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		b.Fatalf("Failed to parse port: %v", err)
+	}
+	return activator.ProbeTarget{Host: host, Port: int32(port)}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmarks
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// Threshold is the slowest acceptable result of a benchmark.
+type Threshold struct {
+	MaxNsPerOp     int64 `json:"maxNsPerOp"`
+	MaxAllocsPerOp int64 `json:"maxAllocsPerOp,omitempty"`
+}
+
+// LoadThresholds reads the thresholds of each benchmark, keyed by
+// benchmark name, from a YAML file.
+func LoadThresholds(path string) (map[string]Threshold, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	thresholds := make(map[string]Threshold)
+	if err := yaml.Unmarshal(b, &thresholds); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return thresholds, nil
+}
+
+// Check returns a description of every way the result of a benchmark
+// exceeds its threshold, or nothing if it is within it.
+func (t Threshold) Check(nsPerOp, allocsPerOp int64) []string {
+	var regressions []string
+	if t.MaxNsPerOp > 0 && nsPerOp > t.MaxNsPerOp {
+		regressions = append(regressions, fmt.Sprintf("%d ns/op exceeds %d ns/op", nsPerOp, t.MaxNsPerOp))
+	}
+	if t.MaxAllocsPerOp > 0 && allocsPerOp > t.MaxAllocsPerOp {
+		regressions = append(regressions, fmt.Sprintf("%d allocs/op exceeds %d allocs/op", allocsPerOp, t.MaxAllocsPerOp))
+	}
+	return regressions
+}